@@ -0,0 +1,38 @@
+#!/bin/bash
+# Builds the kube-scheduler with the SysdigMetrics plugin, behind the framework build tag, and the
+# client-go client of the clientgo tag: vets and tests pkg/plugin, cmd/kube-scheduler and
+# pkg/kubernetes, then writes the binary to $OUT (./kube-scheduler by default). They are built in a
+# module of their own, requiring k8s.io/kubernetes with the replace of its k8s.io/* staging
+# modules by the tags of the same release, like any out-of-tree plugin.
+# Set KUBERNETES_VERSION to build against another v1.30 release.
+set -euo pipefail
+
+version=${KUBERNETES_VERSION:-1.30.5}
+root=$(cd "$(dirname "$0")/../.." && pwd)
+out=$(realpath -m "${OUT:-kube-scheduler}")
+work=$(mktemp -d)
+trap 'rm -rf "$work"' EXIT
+
+# Versions of the dependencies of the scheduler itself
+yaml_version=v2.4.0
+
+export GO111MODULE=on GOFLAGS=-mod=mod
+tar -C "$root" --exclude .git -cf - . | tar -C "$work" -xf -
+cd "$work"
+go mod init github.com/draios/kubernetes-scheduler
+
+# The staging modules are required at v0.0.0 by k8s.io/kubernetes, and tagged v0.MINOR.PATCH
+gomod=$(go mod download -json "k8s.io/kubernetes@v$version" | sed -n 's|.*"GoMod": "\(.*\)".*|\1|p')
+staging=$(sed -n 's|^[[:space:]]*\(k8s.io/[^ ]*\) => ./staging/src/k8s.io/.*|\1|p' "$gomod")
+for module in $staging; do
+	go mod edit "-replace=$module=$module@v0.${version#*.}"
+done
+# The other modules are added by the builds below, which only import the packages of the framework
+# tag: go mod tidy would add the sql drivers of the other tags too
+go get "k8s.io/kubernetes@v$version" "gopkg.in/yaml.v2@$yaml_version"
+
+go vet -tags framework ./pkg/plugin ./cmd/kube-scheduler
+go test -tags framework -count 1 ./pkg/plugin
+go vet -tags clientgo ./pkg/kubernetes
+go test -tags clientgo -count 1 ./pkg/kubernetes
+go build -tags "framework clientgo" -o "$out" ./cmd/kube-scheduler
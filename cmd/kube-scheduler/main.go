@@ -0,0 +1,34 @@
+//go:build framework
+
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The upstream kube-scheduler with the SysdigMetrics Score plugin registered
+package main
+
+import (
+	"os"
+
+	"k8s.io/component-base/cli"
+	"k8s.io/kubernetes/cmd/kube-scheduler/app"
+
+	"github.com/draios/kubernetes-scheduler/pkg/plugin"
+)
+
+func main() {
+	command := app.NewSchedulerCommand(app.WithPlugin(plugin.Name, plugin.New))
+	os.Exit(cli.Run(command))
+}
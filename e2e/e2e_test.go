@@ -0,0 +1,235 @@
+//go:build e2e
+
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package e2e checks the scheduling loop against a real cluster: the scheduler runs in the test
+// process, reading its metrics from the mock Sysdig api or the static provider, and the pods
+// created in the cluster are asserted to be bound to the best node. Behind the e2e build tag,
+// run by e2e/run.sh against a kind cluster, see the README.
+package e2e
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/scheduler"
+	"github.com/draios/kubernetes-scheduler/pkg/sysdig/sysdigtest"
+)
+
+var (
+	kubeConfigFlag    = flag.String("kubeconfig", "", "Kubernetes config file of the cluster")
+	schedulerNameFlag = flag.String("scheduler-name", "sysdig-scheduler-e2e", "Scheduler name served by the scheduler under test")
+	namespaceFlag     = flag.String("namespace", "default", "Namespace the pods are created in")
+	expectNodeFlag    = flag.String("expect-node", "", "Node given the best metrics, where the pods must be bound")
+	failingNodeFlag   = flag.String("failing-node", "", "Node whose metrics are always answered with an error by the mock Sysdig api")
+	providerFlag      = flag.String("provider", "sysdig", "Metric provider of the scheduler, sysdig (the mock) or static")
+	timeoutFlag       = flag.Duration("timeout", time.Minute, "How long a pod is waited for")
+)
+
+const adminAddress = "127.0.0.1:18080"
+
+var kubeAPI kubernetes.KubernetesCoreV1Api
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if *kubeConfigFlag == "" || *expectNodeFlag == "" {
+		fmt.Println("Error: -kubeconfig and -expect-node must be set")
+		os.Exit(2)
+	}
+	if err := kubeAPI.LoadKubeConfigFile(*kubeConfigFlag); err != nil {
+		log.Fatalln("Error:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := startScheduler(ctx)
+	if err != nil {
+		log.Fatalln("Error:", err)
+	}
+	code := m.Run()
+	cancel()
+	<-done
+	os.Exit(code)
+}
+
+// Runs the scheduler until the context is done, the returned channel is closed once it has stopped
+func startScheduler(ctx context.Context) (<-chan struct{}, error) {
+	// The best node has the lowest cpu, the other ones are busier
+	values := map[string]map[string]float64{
+		*expectNodeFlag: {"cpu.used.percent": 20},
+		"*":             {"cpu.used.percent": 80},
+	}
+	var provider, token string
+	switch *providerFlag {
+	case "sysdig":
+		mock := &sysdigtest.Mock{Values: values, Latency: 20 * time.Millisecond}
+		if *failingNodeFlag != "" {
+			mock.Errors = map[string]int{*failingNodeFlag: http.StatusServiceUnavailable}
+		}
+		server := httptest.NewServer(mock)
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		provider = fmt.Sprintf("type: sysdig\n  sysdig:\n    accounts:\n      - name: mock\n        url: %s", server.URL)
+		token = "e2e"
+	case "static":
+		provider = fmt.Sprintf("type: static\n  static:\n    values:\n      %s: {cpu.used.percent: 20}\n      \"*\": {cpu.used.percent: 80}", *expectNodeFlag)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", *providerFlag)
+	}
+
+	dir, err := ioutil.TempDir("", "sysdig-scheduler-e2e")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	data := fmt.Sprintf("provider:\n  %s\nprofiles:\n  - schedulerName: %s\n    metrics:\n      - name: cpu.used.percent\nadmin:\n  address: %s\n",
+		provider, *schedulerNameFlag, adminAddress)
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		return nil, err
+	}
+
+	config, err := scheduler.LoadConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	s, err := scheduler.NewScheduler(scheduler.SchedulerOptions{Config: config, Kubeconfig: *kubeConfigFlag, SysdigToken: token})
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := s.Run(ctx); err != nil {
+			log.Fatalln("Error: scheduler:", err)
+		}
+	}()
+
+	// Healthy once the pod watch is open
+	for i := 0; i < 30; i++ {
+		if response, err := http.Get("http://" + adminAddress + "/healthz"); err == nil {
+			response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				return done, nil
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	return nil, fmt.Errorf("the scheduler is not healthy after 30s")
+}
+
+func TestBindsToBestNode(t *testing.T) {
+	ctx := testContext(t)
+	name := createPod(ctx, t, "e2e-best-", *schedulerNameFlag)
+	expectBound(ctx, t, name, *expectNodeFlag)
+}
+
+func TestBindsBurst(t *testing.T) {
+	ctx := testContext(t)
+	var names []string
+	for i := 0; i < 5; i++ {
+		names = append(names, createPod(ctx, t, "e2e-burst-", *schedulerNameFlag))
+	}
+	for _, name := range names {
+		expectBound(ctx, t, name, *expectNodeFlag)
+	}
+}
+
+// The pod of another scheduler must still be unbound once a pod of the scheduler created after it is bound
+func TestIgnoresOtherSchedulers(t *testing.T) {
+	ctx := testContext(t)
+	other := createPod(ctx, t, "e2e-other-", "e2e-other-scheduler")
+	ours := createPod(ctx, t, "e2e-ours-", *schedulerNameFlag)
+	expectBound(ctx, t, ours, *expectNodeFlag)
+
+	pod, err := kubeAPI.GetPod(ctx, *namespaceFlag, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Spec.NodeName != "" {
+		t.Errorf("pod %s of another scheduler was bound to %s", other, pod.Spec.NodeName)
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2**timeoutFlag)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// Creates a pause pod, deleted at the end of the test, and returns its name, made unique with the time
+func createPod(ctx context.Context, t *testing.T, prefix, schedulerName string) string {
+	t.Helper()
+	name := fmt.Sprintf("%s%d", prefix, time.Now().UnixNano())
+	pod := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": name, "labels": map[string]string{"app": "sysdig-scheduler-e2e"}},
+		"spec": map[string]interface{}{
+			"schedulerName": schedulerName,
+			"containers": []map[string]interface{}{{
+				"name":      "pause",
+				"image":     "registry.k8s.io/pause:3.9",
+				"resources": map[string]interface{}{"requests": map[string]string{"cpu": "10m", "memory": "16Mi"}},
+			}},
+		},
+	}
+	if err := kubeAPI.CreatePod(ctx, *namespaceFlag, pod); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := kubeAPI.DeletePod(context.Background(), *namespaceFlag, name); err != nil {
+			t.Logf("Error deleting pod %s: %s", name, err)
+		}
+	})
+	return name
+}
+
+// Waits for the pod to be bound and checks its node
+func expectBound(ctx context.Context, t *testing.T, name, nodeName string) {
+	t.Helper()
+	deadline := time.Now().Add(*timeoutFlag)
+	for time.Now().Before(deadline) {
+		pod, err := kubeAPI.GetPod(ctx, *namespaceFlag, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pod.Spec.NodeName == nodeName {
+			return
+		}
+		if pod.Spec.NodeName != "" {
+			t.Fatalf("pod %s bound to %s instead of %s", name, pod.Spec.NodeName, nodeName)
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+	t.Fatalf("pod %s not bound after %s", name, *timeoutFlag)
+}
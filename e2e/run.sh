@@ -0,0 +1,36 @@
+#!/bin/bash
+# Runs the end-to-end tests: creates a kind cluster, then runs the go test suite of e2e/, behind the
+# e2e build tag, which runs the scheduler against it with mock metrics making the second worker the
+# best node. The suite is built in a GOPATH of its own, with modules off and the dependencies
+# pinned, whatever the go settings of the shell and wherever the repository is checked out.
+# Set KEEP_CLUSTER=1 to keep the cluster afterwards.
+set -euo pipefail
+
+cluster=${CLUSTER:-sysdig-scheduler-e2e}
+root=$(cd "$(dirname "$0")/.." && pwd)
+work=$(mktemp -d)
+
+# Versions of the dependencies, gopkg.in/yaml.v2 being the only one without build tags
+yaml_version=v2.4.0
+
+cleanup() {
+	[ -z "${KEEP_CLUSTER:-}" ] && kind delete cluster --name "$cluster" || true
+	rm -rf "$work"
+}
+trap cleanup EXIT
+
+export GO111MODULE=off GOFLAGS= GOPATH="$work/gopath"
+package="$GOPATH/src/github.com/draios/kubernetes-scheduler"
+mkdir -p "$(dirname "$package")"
+ln -s "$root" "$package"
+git clone -q --branch "$yaml_version" --depth 1 https://github.com/go-yaml/yaml "$GOPATH/src/gopkg.in/yaml.v2"
+cd "$package"
+go vet -tags e2e ./e2e
+
+kind create cluster --name "$cluster" --config "$root/e2e/kind.yaml" --wait 120s
+kind get kubeconfig --name "$cluster" > "$work/kubeconfig"
+
+# The metrics are read from the mock Sysdig api, which fails for the control plane, or with
+# E2E_PROVIDER=static from the static provider. The scheduler log is printed when a test fails.
+go test -tags e2e -count 1 ./e2e -args -kubeconfig "$work/kubeconfig" -provider "${E2E_PROVIDER:-sysdig}" \
+	-expect-node "$cluster-worker2" -failing-node "$cluster-control-plane"
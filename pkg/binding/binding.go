@@ -0,0 +1,181 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Bindings of the pods to their nodes, safe against the other schedulers binding them first
+package binding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Conflict is returned when the pod was bound by someone else, or deleted, before the binding
+type Conflict struct {
+	Node string // Node the pod was bound to, empty if unknown or if the pod is gone
+	Gone bool
+}
+
+func (e Conflict) Error() string {
+	switch {
+	case e.Gone:
+		return "pod was deleted before the binding"
+	case e.Node != "":
+		return fmt.Sprintf("pod is already assigned to node %s", e.Node)
+	}
+	return "pod was bound by another scheduler"
+}
+
+// Binder binds a pod to a node. A Conflict is returned if the pod was bound by someone else, or
+// deleted, before the binding.
+type Binder interface {
+	Bind(ctx context.Context, pod kubernetes.KubePod, nodeName string) error
+}
+
+// Kubernetes binds the pods with the Binding subresource of the api server
+type Kubernetes struct {
+	API *kubernetes.KubernetesCoreV1Api
+}
+
+func (k *Kubernetes) Bind(ctx context.Context, pod kubernetes.KubePod, nodeName string) error {
+	return Bind(ctx, k.API, pod.Metadata.Namespace, pod.Metadata.Name, nodeName)
+}
+
+// Reads the pod again and returns a Conflict if it was bound or deleted since it was seen
+func Check(ctx context.Context, api *kubernetes.KubernetesCoreV1Api, namespace, name string) error {
+	current, err := api.GetPod(ctx, namespace, name)
+	if statusError, ok := err.(*kubernetes.StatusError); ok && statusError.Code == http.StatusNotFound {
+		return Conflict{Gone: true}
+	}
+	if err != nil {
+		return fmt.Errorf("error while reading the pod before the binding: %s", err)
+	}
+	if current.Spec.NodeName != "" {
+		return Conflict{Node: current.Spec.NodeName}
+	}
+	return nil
+}
+
+// Binds the pod to the node. The api server answers a 409 if the pod was bound in the
+// meantime, a Conflict is returned then. If the bindings endpoint is not supported, like on some
+// managed clusters, the binding subresource of the pod is used, then a patch of its nodeName.
+func Bind(ctx context.Context, api *kubernetes.KubernetesCoreV1Api, namespace, name, nodeName string) error {
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	code, message, err := post(api.CreateNamespacedBinding(ctx, namespace, bindingBody(namespace, name, "", nodeName)))
+	if err == nil && unsupported(code) {
+		code, message, err = bindFallback(ctx, api, namespace, name, nodeName)
+	}
+	if err != nil {
+		return err
+	}
+	if code == http.StatusConflict {
+		// Bound by another scheduler between the check and the binding
+		conflict := Conflict{}
+		if current, err := api.GetPod(ctx, namespace, name); err == nil {
+			conflict.Node = current.Spec.NodeName
+		}
+		return conflict
+	}
+	if code != 200 && code != 201 {
+		return fmt.Errorf("kube response error: %d %s", code, message)
+	}
+	return nil
+}
+
+// Binds the pod with its binding subresource, then with a patch of its nodeName if the
+// subresource is not supported either. Both are made for the UID of the pod, so a pod
+// recreated with the same name is not bound.
+func bindFallback(ctx context.Context, api *kubernetes.KubernetesCoreV1Api, namespace, name, nodeName string) (code int, message string, err error) {
+	current, err := api.GetPod(ctx, namespace, name)
+	if statusError, ok := err.(*kubernetes.StatusError); ok && statusError.Code == http.StatusNotFound {
+		return 0, "", Conflict{Gone: true}
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("error while reading the pod before the binding: %s", err)
+	}
+	if current.Spec.NodeName != "" {
+		return 0, "", Conflict{Node: current.Spec.NodeName}
+	}
+
+	code, message, err = post(api.CreatePodBinding(ctx, namespace, name, bindingBody(namespace, name, current.Metadata.UID, nodeName)))
+	if err != nil || !unsupported(code) {
+		return
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		// The uid is a precondition of the patch, the api server answers a 409 if it changed
+		"metadata": map[string]string{"uid": current.Metadata.UID},
+		"spec":     map[string]string{"nodeName": nodeName},
+	})
+	if err != nil {
+		return
+	}
+	return post(api.PatchPod(ctx, namespace, name, bytes.NewReader(patch)))
+}
+
+// Returns the body of a v1 Binding of the pod to the node, for the pod UID if set
+func bindingBody(namespace, name, uid, nodeName string) *bytes.Reader {
+	metadata := map[string]string{
+		"name":      name,
+		"namespace": namespace,
+	}
+	if uid != "" {
+		metadata["uid"] = uid
+	}
+	// Nodes are in the core group of every version, and have no namespace
+	data, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Binding",
+		"metadata":   metadata,
+		"target": map[string]string{
+			"apiVersion": "v1",
+			"kind":       "Node",
+			"name":       nodeName,
+		},
+	})
+	return bytes.NewReader(data)
+}
+
+// Returns the status code of an api server response and the message of its Status body
+func post(response *http.Response, err error) (code int, message string, _ error) {
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+
+	kubeResponse := kubernetes.KubeResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&kubeResponse); err != nil && response.StatusCode < 300 {
+		return 0, "", fmt.Errorf("error while decoding kube response: %s", err)
+	}
+	return response.StatusCode, kubeResponse.Message, nil
+}
+
+// Returns true if the api server, or a proxy in front of it, does not support the request:
+// a missing endpoint or method, or a rejected body
+func unsupported(code int) bool {
+	switch code {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusUnsupportedMediaType, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Placement delegates the bindings to an external placement service, which binds the pods itself,
+// like a cluster API controller creating the machines of the pods. The pod and its node are
+// posted to URL with the Headers:
+//
+//	{"namespace": "default", "name": "my-pod", "uid": "...", "node": "node-1"}
+//
+// Any 2xx answer accepts the binding. A 409 answer means the pod is bound elsewhere, its body
+// can name the node as {"node": "node-2"}, and a 404 or 410 that the pod is gone.
+type Placement struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client // http.DefaultClient if nil
+}
+
+type placementRequest struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UID       string `json:"uid,omitempty"`
+	Node      string `json:"node"`
+}
+
+func (p *Placement) Bind(ctx context.Context, pod kubernetes.KubePod, nodeName string) error {
+	data, err := json.Marshal(placementRequest{pod.Metadata.Namespace, pod.Metadata.Name, pod.Metadata.UID, nodeName})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", p.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range p.Headers {
+		request.Header.Set(name, value)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error while posting the binding to the placement service: %s", err)
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode <= 299:
+		return nil
+	case response.StatusCode == http.StatusConflict:
+		var bound struct {
+			Node string `json:"node"`
+		}
+		json.Unmarshal(body, &bound)
+		return Conflict{Node: bound.Node}
+	case response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone:
+		return Conflict{Gone: true}
+	}
+	return fmt.Errorf("placement service response error: %d %s", response.StatusCode, bytes.TrimSpace(body))
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// VirtualKubelet binds the pods to virtual-kubelet nodes, whose provider reads its settings from
+// the annotations of the pod: the Annotations are set on the pod, then it is bound with the
+// Binding subresource like on any node
+type VirtualKubelet struct {
+	API         *kubernetes.KubernetesCoreV1Api
+	Annotations map[string]string
+}
+
+func (v *VirtualKubelet) Bind(ctx context.Context, pod kubernetes.KubePod, nodeName string) error {
+	namespace := pod.Metadata.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	if len(v.Annotations) > 0 {
+		metadata := map[string]interface{}{"annotations": v.Annotations}
+		if pod.Metadata.UID != "" {
+			// The uid is a precondition of the patch, a pod recreated with the same name is not annotated
+			metadata["uid"] = pod.Metadata.UID
+		}
+		patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+		if err != nil {
+			return err
+		}
+		code, message, err := post(v.API.PatchPod(ctx, namespace, pod.Metadata.Name, bytes.NewReader(patch)))
+		if err != nil {
+			return err
+		}
+		switch {
+		case code == http.StatusNotFound || code == http.StatusConflict:
+			return Conflict{Gone: true}
+		case code != http.StatusOK:
+			return fmt.Errorf("error while annotating the pod for the virtual-kubelet provider: %d %s", code, message)
+		}
+	}
+	return Bind(ctx, v.API, namespace, pod.Metadata.Name, nodeName)
+}
@@ -46,3 +46,11 @@ func (c *Cache) Data() (data interface{}, ok bool) {
 	}
 	return c.data, true
 }
+
+// Discards the data, the next Data call misses
+func (c *Cache) Invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.loaded = false
+	c.data = nil
+}
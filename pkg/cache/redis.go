@@ -0,0 +1,199 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Redis is a Store on a Redis server, spoken to with the RESP protocol over a small pool of connections
+type Redis struct {
+	address  string
+	password string
+	db       int
+	tls      bool
+	// Prefix of all the keys, so several schedulers can share a server
+	prefix string
+
+	pool chan *redisConn
+}
+
+// Returns a store on the server, the connections are opened by the first commands
+func NewRedis(address, password string, db int, useTLS bool, prefix string) *Redis {
+	return &Redis{
+		address:  address,
+		password: password,
+		db:       db,
+		tls:      useTLS,
+		prefix:   prefix,
+		pool:     make(chan *redisConn, redisPoolSize),
+	}
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Idle connections kept open to the server
+const redisPoolSize = 10
+
+// Returned by the server instead of a value
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := r.do(ctx, "GET", r.prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply %v to GET", reply)
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := r.do(ctx, "SET", r.prefix+key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", r.prefix+key)
+	return err
+}
+
+// Sends a command on a pooled connection and returns its reply: nil, a string, []byte or an int64
+func (r *Redis) do(ctx context.Context, args ...string) (reply interface{}, err error) {
+	conn, err := r.get(ctx)
+	if err != nil {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.conn.SetDeadline(deadline)
+	} else {
+		conn.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	reply, err = conn.command(args...)
+	if _, isRedisError := err.(redisError); err != nil && !isRedisError {
+		// The connection is in an unknown state
+		conn.conn.Close()
+		return
+	}
+	r.put(conn)
+	return
+}
+
+// Takes an idle connection, or opens a new one authenticated and on the DB
+func (r *Redis) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-r.pool:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if r.tls {
+		conn, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", r.address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", r.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if r.password != "" {
+		if _, err = c.command("AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err = c.command("SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (r *Redis) put(conn *redisConn) {
+	select {
+	case r.pool <- conn:
+	default:
+		conn.conn.Close()
+	}
+}
+
+func (c *redisConn) command(args ...string) (interface{}, error) {
+	request := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		request += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	if _, err := io.WriteString(c.conn, request); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+func (c *redisConn) reply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	kind, content := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return content, nil
+	case '-':
+		return nil, redisError(content)
+	case ':':
+		return strconv.ParseInt(content, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(content)
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		data := make([]byte, length+2)
+		if _, err = io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:length], nil
+	}
+	return nil, fmt.Errorf("redis: unsupported reply %q", line)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedisReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  interface{}
+		err   string
+	}{
+		{name: "simple string", reply: "+OK\r\n", want: "OK"},
+		{name: "error", reply: "-ERR unknown command\r\n", err: "ERR unknown command"},
+		{name: "integer", reply: ":42\r\n", want: int64(42)},
+		{name: "negative integer", reply: ":-3\r\n", want: int64(-3)},
+		{name: "invalid integer", reply: ":4x\r\n", want: int64(0), err: "invalid syntax"},
+		{name: "bulk string", reply: "$5\r\nhello\r\n", want: []byte("hello")},
+		{name: "bulk string with a line break", reply: "$7\r\nhel\r\nlo\r\n", want: []byte("hel\r\nlo")},
+		{name: "empty bulk string", reply: "$0\r\n\r\n", want: []byte{}},
+		{name: "nil bulk string", reply: "$-1\r\n"},
+		{name: "truncated bulk string", reply: "$5\r\nhel", err: "EOF"},
+		{name: "array", reply: "*1\r\n$1\r\na\r\n", err: "unsupported reply"},
+		{name: "too short", reply: "+\n", err: "invalid reply"},
+		{name: "no line", reply: "+OK", err: "EOF"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &redisConn{reader: bufio.NewReader(strings.NewReader(test.reply))}
+			got, err := conn.reply()
+			if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("reply() error = %v, want %q", err, test.err)
+			}
+			if test.err == "" && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("reply() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+	if _, err := (&redisConn{reader: bufio.NewReader(strings.NewReader("-WRONGTYPE x\r\n"))}).reply(); !isRedisError(err) {
+		t.Errorf("reply() error = %#v, want a redisError", err)
+	}
+}
+
+func isRedisError(err error) bool {
+	_, ok := err.(redisError)
+	return ok
+}
+
+func TestRedisCommand(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	received := make(chan string, 1)
+	go func() {
+		defer server.Close()
+		data := make([]byte, 256)
+		n, _ := server.Read(data)
+		received <- string(data[:n])
+		server.Write([]byte("+OK\r\n"))
+	}()
+
+	conn := &redisConn{conn: client, reader: bufio.NewReader(client)}
+	reply, err := conn.command("SET", "key", "value")
+	if err != nil || reply != "OK" {
+		t.Fatalf("command() = %v, %v, want OK", reply, err)
+	}
+	if request := <-received; request != "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n" {
+		t.Errorf("request %q, want an array of bulk strings", request)
+	}
+}
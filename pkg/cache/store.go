@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps values under keys for a time to live. The Redis store is shared by
+// all the replicas pointing to the same server.
+type Store interface {
+	// Returns the value of the key, false if it is missing or expired
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Memory is a Store local to the process
+type Memory struct {
+	mutex   sync.Mutex
+	entries map[string]memoryEntry
+	sets    int
+}
+
+type memoryEntry struct {
+	value    []byte
+	deadline time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]memoryEntry{}}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	entry, ok := m.entries[key]
+	if !ok || time.Now().After(entry.deadline) {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.entries[key] = memoryEntry{value: value, deadline: time.Now().Add(ttl)}
+
+	// Drop the expired entries from time to time, the keys of deleted nodes are never read again
+	if m.sets++; m.sets%1000 == 0 {
+		now := time.Now()
+		for key, entry := range m.entries {
+			if now.After(entry.deadline) {
+				delete(m.entries, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.entries, key)
+	return nil
+}
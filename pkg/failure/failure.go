@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Typed errors of the scheduling attempts, with the reason operators alert on, the phase of the
+// attempt and the node and provider involved
+package failure
+
+import (
+	"context"
+	"errors"
+)
+
+// Reason is the class of a failure, in the CamelCase of the event reasons
+type Reason string
+
+const (
+	NoCandidates     Reason = "NoCandidates"     // No node passed the filters
+	NoNodeScored     Reason = "NoNodeScored"     // The candidates were all left out while scoring
+	NoNodeFound      Reason = "NoNodeFound"      // No node left to fall back or preempt on
+	NoMetrics        Reason = "NoMetrics"        // The provider has no data for the node
+	StaleMetrics     Reason = "StaleMetrics"     // The newest data of the node is too old
+	CircuitOpen      Reason = "CircuitOpen"      // The metrics of the node are not requested for a while
+	MetricsTimeout   Reason = "MetricsTimeout"   // The provider did not answer in time
+	ProviderError    Reason = "ProviderError"    // Any other error of the provider
+	ScorerError      Reason = "ScorerError"      // An external scorer failed
+	ThresholdReached Reason = "ThresholdReached" // A metric of the node is past a hard threshold
+	NodeChanged      Reason = "NodeChanged"      // The candidates changed before the binding
+	QuotaExceeded    Reason = "QuotaExceeded"    // A ResourceQuota of the namespace of the pod is exhausted
+	BindConflict     Reason = "BindConflict"     // The pod was bound or deleted by someone else
+	BindError        Reason = "BindError"        // The binding failed
+	NotDelegated     Reason = "NotDelegated"     // The pod could not be handed over to the default scheduler
+	Unknown          Reason = "Unknown"
+)
+
+// Phase is the step of the scheduling attempt that failed
+type Phase string
+
+const (
+	Filter     Phase = "filter"
+	Metrics    Phase = "metrics"
+	Score      Phase = "score"
+	Fallback   Phase = "fallback"
+	Preemption Phase = "preemption"
+	Bind       Phase = "bind"
+)
+
+// Error is a failure of a scheduling attempt. Its message is the one of the error it wraps.
+type Error struct {
+	Reason   Reason
+	Phase    Phase
+	Node     string // Empty if the failure is not about a node
+	Provider string // Empty if the failure is not about the metrics
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) FailureReason() Reason {
+	return e.Reason
+}
+
+// Reasoner is implemented by the errors knowing their reason, like the threshold errors
+type Reasoner interface {
+	FailureReason() Reason
+}
+
+// New returns a failure of the phase with a message
+func New(reason Reason, phase Phase, message string) *Error {
+	return &Error{Reason: reason, Phase: phase, Err: errors.New(message)}
+}
+
+// Returns the reason of an error: its own if it knows it, MetricsTimeout if a deadline was
+// exceeded, Unknown otherwise, and an empty reason for nil
+func ReasonOf(err error) Reason {
+	if err == nil {
+		return ""
+	}
+	var reasoner Reasoner
+	if errors.As(err, &reasoner) {
+		return reasoner.FailureReason()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return MetricsTimeout
+	}
+	return Unknown
+}
+
+// Returns the phase of a failure, empty if the error is not one
+func PhaseOf(err error) Phase {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Phase
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+//go:build !clientgo
+
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token files are read again after this time, service account tokens are rotated by the kubelet
+const tokenFileRefresh = time.Minute
+
+// Builds the configuration of the cluster a pod runs in, with its service account
+func inClusterConfig() KubeConf {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return KubeConf{
+		Clusters: []Cluster{{
+			Name: "in-cluster",
+			Data: ClusterData{Server: "https://" + host + ":" + port, CertificateAuthority: serviceAccountCAFile},
+		}},
+		Users:          []User{{Name: "service-account", Data: UserData{TokenFile: serviceAccountTokenFile}}},
+		Contexts:       []Context{{Name: "in-cluster", Data: ContextData{Cluster: "in-cluster", User: "service-account"}}},
+		CurrentContext: "in-cluster",
+	}
+}
+
+// Credentials of the user of the current context: a bearer token, static, read from a file or
+// returned by an exec plugin, or basic auth. Client certificates are set up with the TLS transport.
+type credentials struct {
+	user UserData
+
+	mutex      sync.Mutex
+	fileToken  string
+	fileRead   time.Time
+	execStatus *execCredentialStatus
+}
+
+// Status of an ExecCredential written by a credential plugin on its standard output
+type execCredentialStatus struct {
+	Token                 string     `json:"token"`
+	ExpirationTimestamp   *time.Time `json:"expirationTimestamp"`
+	ClientCertificateData string     `json:"clientCertificateData"`
+	ClientKeyData         string     `json:"clientKeyData"`
+}
+
+// Adds the credentials to the request
+func (c *credentials) authorize(request *http.Request) error {
+	if c == nil {
+		return nil
+	}
+	token, err := c.bearerToken()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	} else if c.user.Username != "" {
+		request.SetBasicAuth(c.user.Username, c.user.Password)
+	}
+	return nil
+}
+
+func (c *credentials) bearerToken() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch {
+	case c.user.Token != "":
+		return c.user.Token, nil
+	case c.user.TokenFile != "":
+		if time.Since(c.fileRead) > tokenFileRefresh {
+			data, err := ioutil.ReadFile(c.user.TokenFile)
+			if err != nil {
+				return "", fmt.Errorf("kubernetes: token file: %s", err)
+			}
+			c.fileToken, c.fileRead = strings.TrimSpace(string(data)), time.Now()
+		}
+		return c.fileToken, nil
+	case c.user.Exec != nil:
+		status, err := c.execCredential()
+		if err != nil {
+			return "", err
+		}
+		return status.Token, nil
+	}
+	return "", nil
+}
+
+// Returns the client certificate of the exec plugin, for the TLS handshakes
+func (c *credentials) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	status, err := c.execCredential()
+	if err != nil {
+		return nil, err
+	}
+	if status.ClientCertificateData == "" {
+		return &tls.Certificate{}, nil
+	}
+	certificate, err := tls.X509KeyPair([]byte(status.ClientCertificateData), []byte(status.ClientKeyData))
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: exec plugin certificate: %s", err)
+	}
+	return &certificate, nil
+}
+
+// Runs the exec plugin unless its last credential is still valid. Must be called with the mutex held.
+func (c *credentials) execCredential() (*execCredentialStatus, error) {
+	if status := c.execStatus; status != nil && (status.ExpirationTimestamp == nil || time.Now().Before(status.ExpirationTimestamp.Add(-10*time.Second))) {
+		return status, nil
+	}
+
+	plugin := c.user.Exec
+	apiVersion := plugin.APIVersion
+	if apiVersion == "" {
+		apiVersion = "client.authentication.k8s.io/v1"
+	}
+	info, err := json.Marshal(map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]bool{"interactive": false},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	command := exec.Command(plugin.Command, plugin.Args...)
+	command.Env = append(os.Environ(), "KUBERNETES_EXEC_INFO="+string(info))
+	for _, env := range plugin.Env {
+		command.Env = append(command.Env, env.Name+"="+env.Value)
+	}
+	var stdout, stderr bytes.Buffer
+	command.Stdout, command.Stderr = &stdout, &stderr
+	if err = command.Run(); err != nil {
+		return nil, fmt.Errorf("kubernetes: exec plugin %s: %s: %s", plugin.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var credential struct {
+		Status *execCredentialStatus `json:"status"`
+	}
+	if err = json.Unmarshal(stdout.Bytes(), &credential); err != nil {
+		return nil, fmt.Errorf("kubernetes: exec plugin %s: %s", plugin.Command, err)
+	}
+	if credential.Status == nil {
+		return nil, fmt.Errorf("kubernetes: exec plugin %s returned no status", plugin.Command)
+	}
+	c.execStatus = credential.Status
+	return c.execStatus, nil
+}
+
+// Drops the cached tokens after a 401, so the next request reads them again
+func (c *credentials) expire() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.fileRead, c.execStatus = time.Time{}, nil
+}
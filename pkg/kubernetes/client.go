@@ -0,0 +1,262 @@
+//go:build !clientgo
+
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/draios/kubernetes-scheduler/pkg/cache"
+	"github.com/draios/kubernetes-scheduler/pkg/transport"
+)
+
+// Configuration of the client read from the kubeconfig file, or from the service account of the
+// pod, and the credentials of the user of its current context. With the clientgo build tag it is
+// loaded by client-go instead.
+type clientConfig struct {
+	config      KubeConf
+	credentials *credentials
+}
+
+// Adds the credentials of the user to the request
+func (api *KubernetesCoreV1Api) authorize(request *http.Request) error {
+	return api.credentials.authorize(request)
+}
+
+// Drops the cached credentials after a 401, so the next request reads them again
+func (api *KubernetesCoreV1Api) expireCredentials() {
+	api.credentials.expire()
+}
+
+// Reads the configuration file and loads the config struct. Without a configuration file,
+// a pod uses the service account of the cluster it runs in.
+func (api *KubernetesCoreV1Api) LoadKubeConfig() (err error) {
+	file := getKubeConfigFileDefaultLocation()
+	if _, statErr := os.Stat(file); os.IsNotExist(statErr) && InCluster() {
+		err = api.useConfig(inClusterConfig())
+	} else {
+		err = api.LoadKubeConfigFile(file)
+	}
+	if err != nil {
+		err = fmt.Errorf("could not load the Kubernetes configuration: %s", err)
+	}
+	return
+}
+
+// Loads the config struct from a kubeconfig file, using its current context
+func (api *KubernetesCoreV1Api) LoadKubeConfigFile(file string) (err error) {
+	yamlFile, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var kubeConfig KubeConf
+	err = yaml.Unmarshal(yamlFile, &kubeConfig)
+	if err != nil {
+		return err
+	}
+
+	// Decode the certificate
+	for k, cluster := range kubeConfig.Clusters {
+		certBytes, err := base64.StdEncoding.DecodeString(cluster.Data.CertificateAuthorityDataStr)
+		if err != nil {
+			return fmt.Errorf("cluster %s: certificate-authority-data: %s", cluster.Name, err)
+		}
+		cluster.Data.CertificateAuthorityData = certBytes
+		cluster.Data.CertificateAuthority = resolvePath(file, cluster.Data.CertificateAuthority)
+		kubeConfig.Clusters[k] = cluster
+	}
+
+	// Decode the certificate and the key
+	for k, user := range kubeConfig.Users {
+		cert, err := base64.StdEncoding.DecodeString(user.Data.ClientCertificateDataStr)
+		if err != nil {
+			return fmt.Errorf("user %s: client-certificate-data: %s", user.Name, err)
+		}
+		user.Data.ClientCertificateData = cert
+		key, err := base64.StdEncoding.DecodeString(user.Data.ClientKeyDataStr)
+		if err != nil {
+			return fmt.Errorf("user %s: client-key-data: %s", user.Name, err)
+		}
+		user.Data.ClientKeyData = key
+		user.Data.ClientCertificate = resolvePath(file, user.Data.ClientCertificate)
+		user.Data.ClientKey = resolvePath(file, user.Data.ClientKey)
+		user.Data.TokenFile = resolvePath(file, user.Data.TokenFile)
+		kubeConfig.Users[k] = user
+	}
+
+	return api.useConfig(kubeConfig)
+}
+
+// Switches to another context of the kubeconfig file, to reach another cluster or as another user
+func (api *KubernetesCoreV1Api) UseContext(name string) error {
+	for _, context := range api.config.Contexts {
+		if context.Name == name {
+			api.config.CurrentContext = name
+			return api.useConfig(api.config)
+		}
+	}
+	return fmt.Errorf("kubernetes: context %q not found", name)
+}
+
+func (api *KubernetesCoreV1Api) useConfig(kubeConfig KubeConf) error {
+	api.config = kubeConfig
+	api.nodeList = cache.Cache{Timeout: 1 * time.Minute}
+	return api.loadTLSInfo()
+}
+
+// Paths of a kubeconfig are relative to the directory of the file
+func resolvePath(kubeConfigFile, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(kubeConfigFile), path)
+}
+
+// Returns the user and the cluster of the current context
+func (api *KubernetesCoreV1Api) currentContext() (user UserData, cluster ClusterData) {
+	var currentContextUser string
+	var currentContextCluster string
+
+	// Load current context information
+	for _, context := range api.config.Contexts {
+		if context.Name == api.config.CurrentContext {
+			currentContextUser = context.Data.User
+			currentContextCluster = context.Data.Cluster
+		}
+	}
+
+	for _, u := range api.config.Users {
+		if u.Name == currentContextUser {
+			user = u.Data
+		}
+	}
+	for _, c := range api.config.Clusters {
+		if c.Name == currentContextCluster {
+			cluster = c.Data
+		}
+	}
+	return
+}
+
+// Builds the http client of the current context, with the CA of the cluster and the credentials
+// of the user. The connections are kept open between requests.
+func (api *KubernetesCoreV1Api) loadTLSInfo() (err error) {
+	user, cluster := api.currentContext()
+	tlsConfig := &tls.Config{InsecureSkipVerify: cluster.InsecureSkipTLSVerify}
+
+	caCertData := cluster.CertificateAuthorityData
+	if len(caCertData) == 0 && cluster.CertificateAuthority != "" {
+		if caCertData, err = ioutil.ReadFile(cluster.CertificateAuthority); err != nil {
+			return
+		}
+	}
+	// Without a CA the system roots are used, like for the managed clusters with a public CA
+	if len(caCertData) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(caCertData)
+	}
+
+	certData, keyData := user.ClientCertificateData, user.ClientKeyData
+	if len(certData) == 0 && user.ClientCertificate != "" {
+		if certData, err = ioutil.ReadFile(user.ClientCertificate); err != nil {
+			return
+		}
+		if keyData, err = ioutil.ReadFile(user.ClientKey); err != nil {
+			return
+		}
+	}
+	if len(certData) > 0 {
+		certificate, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	api.credentials = &credentials{user: user}
+	if user.Exec != nil {
+		tlsConfig.GetClientCertificate = api.credentials.clientCertificate
+	}
+
+	base := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 20,
+	}
+	api.client = &http.Client{Transport: base}
+	if api.tuning != nil {
+		api.client.Transport = transport.Apply(base, *api.tuning, api.stats)
+	}
+	if api.wrap != nil {
+		api.client.Transport = api.wrap(api.client.Transport)
+	}
+	return
+}
+
+func (api *KubernetesCoreV1Api) currentApiUrlEndpoint() string {
+	for _, context := range api.config.Contexts {
+		if context.Name == api.config.CurrentContext {
+			for _, cluster := range api.config.Clusters {
+				if cluster.Name == context.Data.Cluster {
+					return cluster.Data.Server
+				}
+			}
+		}
+	}
+	log.Panic("kubernetes: current API Url endpoint couldn't be determined, checkout if the configuration is correct")
+	return ""
+}
+
+func getKubeConfigFileDefaultLocation() string {
+	kubeConf, isSet := os.LookupEnv("KUBECONFIG")
+	if isSet && kubeConf != "" {
+		return kubeConf
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		log.Panic(err)
+	}
+	return usr.HomeDir + "/.kube/config"
+}
+
+// Starts the informers keeping the nodes and the pods in memory until the context is done.
+// ListNodes and ListAssignedPods read from them once they are synced.
+func (api *KubernetesCoreV1Api) StartInformers(ctx context.Context) {
+	api.nodes = &nodeStore{}
+	api.pods = &podStore{}
+	go api.inform(ctx, "api/v1/nodes", api.nodes)
+	go api.inform(ctx, "api/v1/pods", api.pods)
+}
@@ -0,0 +1,191 @@
+//go:build clientgo
+
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/draios/kubernetes-scheduler/pkg/cache"
+	"github.com/draios/kubernetes-scheduler/pkg/transport"
+)
+
+// Configuration of the client loaded by client-go from the kubeconfig file, or from the service
+// account of the pod, with the credentials of the user of its context: tokens, client
+// certificates, exec credential plugins and auth providers.
+type clientConfig struct {
+	rest        *rest.Config
+	file        string // Kubeconfig file, KUBECONFIG or ~/.kube/config if empty
+	kubeContext string // Context of the file, its current context if empty
+}
+
+// The credentials are added by the transport of client-go, which refreshes them itself
+func (api *KubernetesCoreV1Api) authorize(request *http.Request) error {
+	return nil
+}
+
+func (api *KubernetesCoreV1Api) expireCredentials() {}
+
+// Reads the configuration file of the env KUBECONFIG or ~/.kube/config. Without a configuration
+// file, a pod uses the service account of the cluster it runs in.
+func (api *KubernetesCoreV1Api) LoadKubeConfig() error {
+	if err := api.loadClientConfig("", ""); err != nil {
+		return fmt.Errorf("could not load the Kubernetes configuration: %s", err)
+	}
+	return nil
+}
+
+// Loads the configuration of a kubeconfig file, using its current context
+func (api *KubernetesCoreV1Api) LoadKubeConfigFile(file string) error {
+	return api.loadClientConfig(file, "")
+}
+
+// Switches to another context of the kubeconfig file, to reach another cluster or as another user
+func (api *KubernetesCoreV1Api) UseContext(name string) error {
+	err := api.loadClientConfig(api.file, name)
+	if clientcmd.IsContextNotFound(err) {
+		return fmt.Errorf("kubernetes: context %q not found", name)
+	}
+	return err
+}
+
+func (api *KubernetesCoreV1Api) loadClientConfig(file, kubeContext string) error {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = file
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: kubeContext})
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return err
+	}
+	api.clientConfig = clientConfig{rest: config, file: file, kubeContext: kubeContext}
+	api.nodeList = cache.Cache{Timeout: 1 * time.Minute}
+	return api.loadTLSInfo()
+}
+
+// Builds the http client of the current context, with the TLS settings and the credentials of
+// client-go around the tuned transport. The connections are kept open between requests.
+func (api *KubernetesCoreV1Api) loadTLSInfo() error {
+	tlsConfig, err := rest.TLSConfigFor(api.rest)
+	if err != nil {
+		return err
+	}
+	base := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 20,
+	}
+	if api.rest.Proxy != nil {
+		base.Proxy = api.rest.Proxy
+	}
+	var roundTripper http.RoundTripper = base
+	if api.tuning != nil {
+		roundTripper = transport.Apply(base, *api.tuning, api.stats)
+	}
+	if roundTripper, err = rest.HTTPWrappersForConfig(api.rest, roundTripper); err != nil {
+		return err
+	}
+	api.client = &http.Client{Transport: roundTripper}
+	if api.wrap != nil {
+		api.client.Transport = api.wrap(api.client.Transport)
+	}
+	return nil
+}
+
+func (api *KubernetesCoreV1Api) currentApiUrlEndpoint() string {
+	server, _, err := rest.DefaultServerUrlFor(api.rest)
+	if err != nil {
+		log.Panicf("kubernetes: current API Url endpoint couldn't be determined: %s", err)
+	}
+	return strings.TrimSuffix(server.String(), "/")
+}
+
+// Starts the shared informers of client-go keeping the nodes and the pods in memory until the
+// context is done. ListNodes and ListAssignedPods read from them once they are synced.
+func (api *KubernetesCoreV1Api) StartInformers(ctx context.Context) {
+	api.nodes = &nodeStore{nodes: map[string]KubeNode{}}
+	api.pods = &podStore{pods: map[string]KubePod{}}
+	client, err := clientset.NewForConfigAndClient(api.rest, api.client)
+	if err != nil {
+		log.Printf("kubernetes: informers: %s", err)
+		return
+	}
+	factory := informers.NewSharedInformerFactory(client, 0)
+	nodes, err := factory.Core().V1().Nodes().Informer().AddEventHandler(storeHandler("nodes", api.nodes))
+	if err != nil {
+		log.Printf("kubernetes: informer nodes: %s", err)
+		return
+	}
+	pods, err := factory.Core().V1().Pods().Informer().AddEventHandler(storeHandler("pods", api.pods))
+	if err != nil {
+		log.Printf("kubernetes: informer pods: %s", err)
+		return
+	}
+	factory.Start(ctx.Done())
+
+	go func() {
+		if toolscache.WaitForCacheSync(ctx.Done(), nodes.HasSynced) {
+			api.nodes.mutex.Lock()
+			api.nodes.synced = true
+			api.nodes.mutex.Unlock()
+		}
+	}()
+	go func() {
+		if toolscache.WaitForCacheSync(ctx.Done(), pods.HasSynced) {
+			api.pods.mutex.Lock()
+			api.pods.synced = true
+			api.pods.mutex.Unlock()
+		}
+	}()
+}
+
+// Applies the notifications of a shared informer to the store, as the watch events they come from
+func storeHandler(name string, objects store) toolscache.ResourceEventHandlerFuncs {
+	apply := func(eventType string, object interface{}) {
+		if tombstone, ok := object.(toolscache.DeletedFinalStateUnknown); ok {
+			// Deleted while the watch was down
+			object = tombstone.Obj
+		}
+		data, err := json.Marshal(object)
+		if err == nil {
+			err = objects.apply(eventType, data)
+		}
+		if err != nil {
+			log.Printf("kubernetes: informer %s: %s", name, err)
+		}
+	}
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    func(object interface{}) { apply("ADDED", object) },
+		UpdateFunc: func(_, object interface{}) { apply("MODIFIED", object) },
+		DeleteFunc: func(object interface{}) { apply("DELETED", object) },
+	}
+}
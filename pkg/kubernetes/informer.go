@@ -0,0 +1,331 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Objects of a collection kept up to date by an informer
+type store interface {
+	// Replaces all the objects with the items of a list
+	replace(items []json.RawMessage) error
+	// Applies an ADDED, MODIFIED or DELETED watch event
+	apply(eventType string, object json.RawMessage) error
+}
+
+// Lists the collection into the store, then applies the watch events from the version of the
+// list. When the watch ends it is opened again from the version of the last event, the
+// collection is only listed again when that version is too old (410 Gone).
+func (api *KubernetesCoreV1Api) inform(ctx context.Context, apiMethod string, objects store) {
+	resourceVersion := ""
+	for ctx.Err() == nil {
+		if resourceVersion == "" {
+			items, version, err := api.listRaw(ctx, apiMethod, nil)
+			if err == nil {
+				err = objects.replace(items)
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("kubernetes: informer %s: %s", apiMethod, err)
+				}
+				select {
+				case <-time.After(5 * time.Second):
+				case <-ctx.Done():
+				}
+				continue
+			}
+			resourceVersion = version
+		}
+
+		version, gone := api.watchInto(ctx, apiMethod, resourceVersion, objects)
+		if gone {
+			log.Printf("kubernetes: informer %s: version %s is too old, listing again", apiMethod, resourceVersion)
+			resourceVersion = ""
+			continue
+		}
+		if version == resourceVersion {
+			// Nothing received, the api server may be down
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+		}
+		resourceVersion = version
+	}
+}
+
+// Applies the watch events from the version until the watch ends. Returns the version of the last
+// event, and true if the version is too old to be watched from.
+func (api *KubernetesCoreV1Api) watchInto(ctx context.Context, apiMethod, resourceVersion string, objects store) (version string, gone bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	version = resourceVersion
+	values := url.Values{}
+	values.Add("resourceVersion", resourceVersion)
+	// The bookmarks move the version forward while no object changes
+	values.Add("allowWatchBookmarks", "true")
+	events, err := api.Watch(ctx, "GET", apiMethod, values, nil)
+	if err != nil {
+		if status, ok := err.(*StatusError); ok && status.Code == http.StatusGone {
+			return version, true
+		}
+		if ctx.Err() == nil {
+			log.Printf("kubernetes: informer %s: %s", apiMethod, err)
+		}
+		return
+	}
+	for line := range events {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := json.Unmarshal(line, &event); err != nil {
+			log.Printf("kubernetes: informer %s: %s", apiMethod, err)
+			return
+		}
+		if event.Type == "ERROR" {
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				// The events since the version are not kept anymore
+				return version, true
+			}
+			log.Printf("kubernetes: informer %s: watch error %d: %s", apiMethod, status.Code, status.Message)
+			return
+		}
+
+		var object struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(event.Object, &object); err == nil && object.Metadata.ResourceVersion != "" {
+			version = object.Metadata.ResourceVersion
+		}
+		if event.Type == "BOOKMARK" {
+			continue
+		}
+		if err := objects.apply(event.Type, event.Object); err != nil {
+			log.Printf("kubernetes: informer %s: %s", apiMethod, err)
+		}
+	}
+	return
+}
+
+// Sends the events of the collection until the context is done, then closes the channel. The watch
+// is opened again from the version of the last event when it ends. The first list is sent as ADDED
+// events, and when the collection is listed again the changes since the last event are sent as
+// ADDED, MODIFIED and DELETED events.
+func (api *KubernetesCoreV1Api) WatchEvents(ctx context.Context, apiMethod string) <-chan []byte {
+	events := make(chan []byte)
+	go func() {
+		defer close(events)
+		api.inform(ctx, apiMethod, &eventStore{ctx: ctx, events: events, known: map[string]json.RawMessage{}})
+	}()
+	return events
+}
+
+// Forwards the events of a collection, keeping the objects to tell what changed when it is listed again
+type eventStore struct {
+	ctx    context.Context
+	events chan<- []byte
+	known  map[string]json.RawMessage
+}
+
+type objectMeta struct {
+	Metadata struct {
+		Namespace       string `json:"namespace"`
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+}
+
+func metaOf(object json.RawMessage) (meta objectMeta, key string, err error) {
+	err = json.Unmarshal(object, &meta)
+	return meta, meta.Metadata.Namespace + "/" + meta.Metadata.Name, err
+}
+
+func (s *eventStore) replace(items []json.RawMessage) error {
+	listed := map[string]json.RawMessage{}
+	for _, item := range items {
+		meta, key, err := metaOf(item)
+		if err != nil {
+			return err
+		}
+		listed[key] = item
+		previous, ok := s.known[key]
+		if !ok {
+			s.send("ADDED", item)
+		} else if previousMeta, _, _ := metaOf(previous); previousMeta.Metadata.ResourceVersion != meta.Metadata.ResourceVersion {
+			s.send("MODIFIED", item)
+		}
+	}
+	for key, object := range s.known {
+		if _, ok := listed[key]; !ok {
+			s.send("DELETED", object)
+		}
+	}
+	s.known = listed
+	return nil
+}
+
+func (s *eventStore) apply(eventType string, object json.RawMessage) error {
+	_, key, err := metaOf(object)
+	if err != nil {
+		return err
+	}
+	if eventType == "DELETED" {
+		delete(s.known, key)
+	} else {
+		s.known[key] = object
+	}
+	s.send(eventType, object)
+	return nil
+}
+
+// Sends a watch event, unless the context is done
+func (s *eventStore) send(eventType string, object json.RawMessage) {
+	data, err := json.Marshal(struct {
+		Type   string          `json:"type"`
+		Object json.RawMessage `json:"object"`
+	}{eventType, object})
+	if err != nil {
+		return
+	}
+	select {
+	case s.events <- data:
+	case <-s.ctx.Done():
+	}
+}
+
+type nodeStore struct {
+	mutex  sync.RWMutex
+	synced bool
+	nodes  map[string]KubeNode
+}
+
+func (s *nodeStore) replace(items []json.RawMessage) error {
+	nodes := map[string]KubeNode{}
+	for _, item := range items {
+		var node KubeNode
+		if err := json.Unmarshal(item, &node); err != nil {
+			return err
+		}
+		nodes[node.Metadata.Name] = node
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.nodes, s.synced = nodes, true
+	return nil
+}
+
+func (s *nodeStore) apply(eventType string, object json.RawMessage) error {
+	var node KubeNode
+	if err := json.Unmarshal(object, &node); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if eventType == "DELETED" {
+		delete(s.nodes, node.Metadata.Name)
+	} else {
+		s.nodes[node.Metadata.Name] = node
+	}
+	return nil
+}
+
+// Returns the nodes of the store, false if it is not synced yet
+func (s *nodeStore) list() (nodes []KubeNode, ok bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if !s.synced {
+		return nil, false
+	}
+	for _, node := range s.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes, true
+}
+
+type podStore struct {
+	mutex  sync.RWMutex
+	synced bool
+	pods   map[string]KubePod
+}
+
+func (s *podStore) replace(items []json.RawMessage) error {
+	pods := map[string]KubePod{}
+	for _, item := range items {
+		var pod KubePod
+		if err := json.Unmarshal(item, &pod); err != nil {
+			return err
+		}
+		pods[pod.Metadata.Namespace+"/"+pod.Metadata.Name] = pod
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pods, s.synced = pods, true
+	return nil
+}
+
+func (s *podStore) apply(eventType string, object json.RawMessage) error {
+	var pod KubePod
+	if err := json.Unmarshal(object, &pod); err != nil {
+		return err
+	}
+	key := pod.Metadata.Namespace + "/" + pod.Metadata.Name
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if eventType == "DELETED" {
+		delete(s.pods, key)
+	} else {
+		s.pods[key] = pod
+	}
+	return nil
+}
+
+// Returns the pods of the store assigned to a node and not terminated, false if it is not synced yet
+func (s *podStore) assigned() (pods []KubePod, ok bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if !s.synced {
+		return nil, false
+	}
+	for _, pod := range s.pods {
+		if pod.Spec.NodeName != "" && pod.Status.Phase != "Succeeded" && pod.Status.Phase != "Failed" {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, true
+}
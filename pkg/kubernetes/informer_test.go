@@ -0,0 +1,101 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInformersWithExecCredential(t *testing.T) {
+	var mutex sync.Mutex
+	authorizations := map[string]bool{}
+	// client-go only sends the credentials over TLS
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		authorizations[r.Header.Get("Authorization")] = true
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			// Nothing changes until the informers stop
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/nodes":
+			w.Write([]byte(`{"kind":"NodeList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[{"metadata":{"name":"node-1","resourceVersion":"1"}}]}`))
+		case "/api/v1/pods":
+			w.Write([]byte(`{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, "credential-plugin")
+	script := "#!/bin/sh\necho '{\"apiVersion\":\"client.authentication.k8s.io/v1\",\"kind\":\"ExecCredential\",\"status\":{\"token\":\"exec-token\"}}'\n"
+	if err := ioutil.WriteFile(plugin, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	data := "apiVersion: v1\nclusters:\n- name: test\n  cluster:\n    server: " + server.URL +
+		"\n    certificate-authority-data: " + base64.StdEncoding.EncodeToString(ca) +
+		"\ncontexts:\n- name: test\n  context:\n    cluster: test\n    user: test\ncurrent-context: test\nusers:\n- name: test\n  user:\n    exec:\n" +
+		"      apiVersion: client.authentication.k8s.io/v1\n      command: " + plugin + "\n      interactiveMode: Never\n"
+	if err := ioutil.WriteFile(kubeconfig, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var api KubernetesCoreV1Api
+	if err := api.LoadKubeConfigFile(kubeconfig); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api.StartInformers(ctx)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if nodes, ok := api.nodes.list(); ok {
+			if len(nodes) != 1 || nodes[0].Metadata.Name != "node-1" {
+				t.Fatalf("nodes of the informer %v, want node-1", nodes)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the node informer is not synced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !authorizations["Bearer exec-token"] || len(authorizations) != 1 {
+		t.Errorf("authorizations %v, want the token of the exec plugin", authorizations)
+	}
+}
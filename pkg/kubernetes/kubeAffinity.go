@@ -0,0 +1,180 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import "strconv"
+
+type KubeAffinity struct {
+	NodeAffinity    *KubeNodeAffinity `json:"nodeAffinity,omitempty"`
+	PodAffinity     *KubePodAffinity  `json:"podAffinity,omitempty"`
+	PodAntiAffinity *KubePodAffinity  `json:"podAntiAffinity,omitempty"`
+}
+
+// Only the required node affinity is enforced
+type KubeNodeAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution *KubeNodeSelector `json:"requiredDuringSchedulingIgnoredDuringExecution,omitempty"`
+}
+
+// Pod affinity and anti-affinity share the same structure
+type KubePodAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution  []KubePodAffinityTerm         `json:"requiredDuringSchedulingIgnoredDuringExecution,omitempty"`
+	PreferredDuringSchedulingIgnoredDuringExecution []KubeWeightedPodAffinityTerm `json:"preferredDuringSchedulingIgnoredDuringExecution,omitempty"`
+}
+
+type KubePodAffinityTerm struct {
+	LabelSelector *KubeLabelSelector `json:"labelSelector,omitempty"`
+	Namespaces    []string           `json:"namespaces,omitempty"`
+	TopologyKey   string             `json:"topologyKey"`
+}
+
+type KubeWeightedPodAffinityTerm struct {
+	Weight          int                 `json:"weight"`
+	PodAffinityTerm KubePodAffinityTerm `json:"podAffinityTerm"`
+}
+
+type KubeTopologySpreadConstraint struct {
+	MaxSkew           int                `json:"maxSkew"`
+	TopologyKey       string             `json:"topologyKey"`
+	WhenUnsatisfiable string             `json:"whenUnsatisfiable"`
+	LabelSelector     *KubeLabelSelector `json:"labelSelector,omitempty"`
+}
+
+type KubeLabelSelector struct {
+	MatchLabels      map[string]string              `json:"matchLabels,omitempty" yaml:"matchLabels"`
+	MatchExpressions []KubeLabelSelectorRequirement `json:"matchExpressions,omitempty" yaml:"matchExpressions"`
+}
+
+type KubeLabelSelectorRequirement struct {
+	Key      string   `json:"key" yaml:"key"`
+	Operator string   `json:"operator" yaml:"operator"`
+	Values   []string `json:"values,omitempty" yaml:"values"`
+}
+
+// Returns true if the labels match the selector. A nil selector matches nothing, like in Kubernetes.
+func (s *KubeLabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return false
+	}
+	for key, value := range s.MatchLabels {
+		if labels[key] != value {
+			return false
+		}
+	}
+	for _, requirement := range s.MatchExpressions {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the labels satisfy the requirement
+func (r KubeLabelSelectorRequirement) Matches(labels map[string]string) bool {
+	value, exists := labels[r.Key]
+	switch r.Operator {
+	case "In":
+		return exists && contains(r.Values, value)
+	case "NotIn":
+		return !exists || !contains(r.Values, value)
+	case "Exists":
+		return exists
+	case "DoesNotExist":
+		return !exists
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Node selector of a persistent volume or pod node affinity, the terms are ORed
+type KubeNodeSelector struct {
+	NodeSelectorTerms []KubeNodeSelectorTerm `json:"nodeSelectorTerms"`
+}
+
+// The requirements of a term are ANDed
+type KubeNodeSelectorTerm struct {
+	MatchExpressions []KubeNodeSelectorRequirement `json:"matchExpressions,omitempty"`
+	MatchFields      []KubeNodeSelectorRequirement `json:"matchFields,omitempty"`
+}
+
+type KubeNodeSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// Returns true if a term of the selector matches the node labels and name. A nil selector matches every node.
+func (s *KubeNodeSelector) Matches(labels map[string]string, nodeName string) bool {
+	if s == nil {
+		return true
+	}
+	for _, term := range s.NodeSelectorTerms {
+		if term.matches(labels, nodeName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t KubeNodeSelectorTerm) matches(labels map[string]string, nodeName string) bool {
+	if len(t.MatchExpressions) == 0 && len(t.MatchFields) == 0 {
+		return false
+	}
+	for _, requirement := range t.MatchExpressions {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+	for _, requirement := range t.MatchFields {
+		// metadata.name is the only field supported by Kubernetes
+		if requirement.Key != "metadata.name" || !requirement.Matches(map[string]string{requirement.Key: nodeName}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the labels satisfy the requirement, Gt and Lt compare integers
+func (r KubeNodeSelectorRequirement) Matches(labels map[string]string) bool {
+	switch r.Operator {
+	case "Gt", "Lt":
+		value, exists := labels[r.Key]
+		if !exists || len(r.Values) != 1 {
+			return false
+		}
+		actual, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		limit, err := strconv.ParseInt(r.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+		if r.Operator == "Gt" {
+			return actual > limit
+		}
+		return actual < limit
+	}
+	return KubeLabelSelectorRequirement{Key: r.Key, Operator: r.Operator, Values: r.Values}.Matches(labels)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// Attributes of a request checked by an access review, Resource with its subresource like pods/binding
+type KubeResourceAttributes struct {
+	Namespace   string `json:"namespace,omitempty"`
+	Verb        string `json:"verb"`
+	Group       string `json:"group"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+}
+
+// Returns whether the credentials of the client are allowed the request, and the reason the
+// authorizer gave if any, with a SelfSubjectAccessReview
+func (api *KubernetesCoreV1Api) CanI(ctx context.Context, attributes KubeResourceAttributes) (allowed bool, reason string, err error) {
+	if parts := strings.SplitN(attributes.Resource, "/", 2); len(parts) == 2 {
+		attributes.Resource, attributes.Subresource = parts[0], parts[1]
+	}
+	review := map[string]interface{}{
+		"apiVersion": "authorization.k8s.io/v1",
+		"kind":       "SelfSubjectAccessReview",
+		"spec":       map[string]interface{}{"resourceAttributes": attributes},
+	}
+	data, err := json.Marshal(review)
+	if err != nil {
+		return
+	}
+
+	apiMethod := "apis/authorization.k8s.io/v1/selfsubjectaccessreviews"
+	response, err := api.Request(ctx, "POST", apiMethod, "", nil, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 201 && response.StatusCode != 200 {
+		return false, "", &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	var answer struct {
+		Status struct {
+			Allowed bool   `json:"allowed"`
+			Reason  string `json:"reason"`
+		} `json:"status"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&answer)
+	return answer.Status.Allowed, answer.Status.Reason, err
+}
@@ -33,6 +33,8 @@ type Cluster struct {
 type ClusterData struct {
 	CertificateAuthorityDataStr string `yaml:"certificate-authority-data"`
 	CertificateAuthorityData    []byte
+	CertificateAuthority        string `yaml:"certificate-authority"`
+	InsecureSkipTLSVerify       bool   `yaml:"insecure-skip-tls-verify"`
 	Server                      string `yaml:"server"`
 }
 
@@ -57,6 +59,24 @@ type UserData struct {
 	ClientCertificateData    []byte
 	ClientKeyDataStr         string `yaml:"client-key-data"`
 	ClientKeyData            []byte
+	ClientCertificate        string      `yaml:"client-certificate"`
+	ClientKey                string      `yaml:"client-key"`
+	Token                    string      `yaml:"token"`
+	TokenFile                string      `yaml:"tokenFile"`
+	Username                 string      `yaml:"username"`
+	Password                 string      `yaml:"password"`
+	Exec                     *ExecConfig `yaml:"exec"`
+}
+
+// Credential plugin run to get a token or a client certificate, like aws eks get-token
+type ExecConfig struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Command    string   `yaml:"command"`
+	Args       []string `yaml:"args"`
+	Env        []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
 }
 
 type AuthProvider struct {
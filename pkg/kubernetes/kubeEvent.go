@@ -0,0 +1,123 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// KubeEvent is a core/v1 event about an object, listed by kubectl describe
+type KubeEvent struct {
+	Metadata struct {
+		GenerateName string            `json:"generateName"`
+		Namespace    string            `json:"namespace"`
+		Annotations  map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	InvolvedObject struct {
+		Kind      string `json:"kind"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+		UID       string `json:"uid"`
+	} `json:"involvedObject"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	Type    string `json:"type"` // Normal or Warning
+	Source  struct {
+		Component string `json:"component"`
+	} `json:"source"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	Count          int       `json:"count"`
+}
+
+// Returns an event about the pod reported by component
+func NewPodEvent(pod KubePod, component, eventType, reason, message string) (event KubeEvent) {
+	return NewEvent("Pod", pod.Metadata.Namespace, pod.Metadata.Name, pod.Metadata.UID, component, eventType, reason, message)
+}
+
+// Returns an event about an object of the kind reported by component
+func NewEvent(kind, namespace, name, uid, component, eventType, reason, message string) (event KubeEvent) {
+	event.Metadata.GenerateName = name + "."
+	event.Metadata.Namespace = namespace
+	event.InvolvedObject.Kind = kind
+	event.InvolvedObject.Namespace = namespace
+	event.InvolvedObject.Name = name
+	event.InvolvedObject.UID = uid
+	event.Type, event.Reason, event.Message = eventType, reason, message
+	event.Source.Component = component
+	event.FirstTimestamp = time.Now()
+	event.LastTimestamp = event.FirstTimestamp
+	event.Count = 1
+	return
+}
+
+// Creates an event in its namespace
+func (api *KubernetesCoreV1Api) CreateEvent(ctx context.Context, event KubeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	apiMethod := fmt.Sprintf("api/v1/namespaces/%s/events", event.Metadata.Namespace)
+	response, err := api.Request(ctx, "POST", apiMethod, "", nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 201 && response.StatusCode != 200 {
+		return &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	return nil
+}
+
+// Sets a condition of the pod status, like PodScheduled=False with the reason the scheduler gave up
+func (api *KubernetesCoreV1Api) SetPodCondition(ctx context.Context, namespace, name, conditionType, status, reason, message string) error {
+	patch := map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []map[string]interface{}{{
+				"type":               conditionType,
+				"status":             status,
+				"reason":             reason,
+				"message":            message,
+				"lastProbeTime":      nil,
+				"lastTransitionTime": time.Now().UTC().Format(time.RFC3339),
+			}},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	// The conditions are merged by type
+	apiMethod := fmt.Sprintf("api/v1/namespaces/%s/pods/%s/status", namespace, name)
+	response, err := api.Request(ctx, "PATCH", apiMethod, "application/strategic-merge-patch+json", nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	return nil
+}
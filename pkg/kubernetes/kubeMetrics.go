@@ -0,0 +1,113 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// NodeMetrics of the metrics.k8s.io api served by metrics-server
+type KubeNodeMetrics struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Timestamp time.Time         `json:"timestamp"`
+	Window    string            `json:"window"`
+	Usage     map[string]string `json:"usage"`
+}
+
+// Node part of the kubelet stats summary
+type KubeNodeSummary struct {
+	Node struct {
+		NodeName string `json:"nodeName"`
+		CPU      struct {
+			Time           time.Time `json:"time"`
+			UsageNanoCores float64   `json:"usageNanoCores"`
+		} `json:"cpu"`
+		Memory struct {
+			Time            time.Time `json:"time"`
+			AvailableBytes  float64   `json:"availableBytes"`
+			UsageBytes      float64   `json:"usageBytes"`
+			WorkingSetBytes float64   `json:"workingSetBytes"`
+		} `json:"memory"`
+		Fs struct {
+			Time           time.Time `json:"time"`
+			AvailableBytes float64   `json:"availableBytes"`
+			CapacityBytes  float64   `json:"capacityBytes"`
+			UsedBytes      float64   `json:"usedBytes"`
+		} `json:"fs"`
+	} `json:"node"`
+}
+
+// MetricValue of the custom.metrics.k8s.io api, served by adapters like the Prometheus adapter
+type KubeMetricValue struct {
+	DescribedObject struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"describedObject"`
+	MetricName string    `json:"metricName"`
+	Timestamp  time.Time `json:"timestamp"`
+	Value      string    `json:"value"`
+}
+
+// Reads the values of a custom metric of a node, the list is empty if the adapter has no value for it
+func (api *KubernetesCoreV1Api) GetNodeCustomMetric(ctx context.Context, nodeName, metricName string) (values []KubeMetricValue, err error) {
+	var list struct {
+		Items []KubeMetricValue `json:"items"`
+	}
+	err = api.getJSON(ctx, fmt.Sprintf("apis/custom.metrics.k8s.io/v1beta1/nodes/%s/%s", nodeName, metricName), &list)
+	return list.Items, err
+}
+
+// Reads the usage of a node from metrics-server
+func (api *KubernetesCoreV1Api) GetNodeMetrics(ctx context.Context, nodeName string) (nodeMetrics KubeNodeMetrics, err error) {
+	err = api.getJSON(ctx, "apis/metrics.k8s.io/v1beta1/nodes/"+nodeName, &nodeMetrics)
+	return
+}
+
+// Reads the stats summary of a node from its kubelet through the api server proxy
+func (api *KubernetesCoreV1Api) GetNodeSummary(ctx context.Context, nodeName string) (summary KubeNodeSummary, err error) {
+	err = api.getJSON(ctx, fmt.Sprintf("api/v1/nodes/%s/proxy/stats/summary", nodeName), &summary)
+	return
+}
+
+// Makes a GET request and decodes the json response into out
+func (api *KubernetesCoreV1Api) getJSON(ctx context.Context, apiMethod string, out interface{}) error {
+	response, err := api.Request(ctx, "GET", apiMethod, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// StatusError is returned when the api server answers with an unexpected status code
+type StatusError struct {
+	Code   int
+	Method string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kubernetes: %s error code %d", e.Method, e.Code)
+}
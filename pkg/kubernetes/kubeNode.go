@@ -0,0 +1,69 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+type KubeNode struct {
+	Metadata KubeNodeMetadata `json:"metadata"`
+	Spec     KubeNodeSpec     `json:"spec"`
+	Status   KubeNodeStatus   `json:"status"`
+}
+
+type KubeNodeMetadata struct {
+	Name              string            `json:"name"`
+	SelfLink          string            `json:"selfLink"`
+	Uid               string            `json:"uid"`
+	ResourceVersion   string            `json:"resourceVersion"`
+	CreationTimestamp string            `json:"creationTimestamp"`
+	Labels            map[string]string `json:"labels"`
+	Annotations       map[string]string `json:"annotations"`
+}
+
+type KubeNodeSpec struct {
+	PodCIDR       string `json:"podCIDR"`
+	ExternalID    string `json:"externalID"`
+	ProviderID    string `json:"providerID"`
+	Unschedulable bool   `json:"unschedulable"`
+}
+
+type KubeNodeStatus struct {
+	Capacity    map[string]string          `json:"capacity"`
+	Allocatable map[string]string          `json:"allocatable"`
+	Conditions  []KubeNodeStatusConditions `json:"conditions"`
+	Images      []KubeContainerImage       `json:"images"`
+	Addresses   []KubeNodeAddress          `json:"addresses"`
+}
+
+// Address of a node, of type InternalIP, ExternalIP, Hostname...
+type KubeNodeAddress struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// Image present on a node, under all its names
+type KubeContainerImage struct {
+	Names     []string `json:"names"`
+	SizeBytes int64    `json:"sizeBytes"`
+}
+
+type KubeNodeStatusConditions struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	LastHeartbeatTime  string `json:"lastHeartbeatTime"`
+	LastTransitionTime string `json:"lastTransitionTime"`
+	Reason             string `json:"reason"`
+	Message            string `json:"message"`
+}
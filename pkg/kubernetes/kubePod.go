@@ -36,6 +36,7 @@ type KubePod struct {
 		ResourceVersion   string            `json:"resourceVersion"`
 		CreationTimestamp time.Time         `json:"creationTimestamp"`
 		Labels            map[string]string `json:"labels"`
+		Annotations       map[string]string `json:"annotations"`
 		OwnerReferences []struct {
 			APIVersion         string `json:"apiVersion"`
 			Kind               string `json:"kind"`
@@ -52,6 +53,9 @@ type KubePod struct {
 				SecretName  string `json:"secretName"`
 				DefaultMode int    `json:"defaultMode"`
 			} `json:"secret"`
+			PersistentVolumeClaim *struct {
+				ClaimName string `json:"claimName"`
+			} `json:"persistentVolumeClaim,omitempty"`
 		} `json:"volumes"`
 		Containers []struct {
 			Name  string `json:"name"`
@@ -61,8 +65,7 @@ type KubePod struct {
 				ContainerPort int    `json:"containerPort"`
 				Protocol      string `json:"protocol"`
 			} `json:"ports"`
-			Resources struct {
-			} `json:"resources"`
+			Resources    KubeResources `json:"resources"`
 			VolumeMounts []struct {
 				Name      string `json:"name"`
 				ReadOnly  bool   `json:"readOnly"`
@@ -72,6 +75,8 @@ type KubePod struct {
 			TerminationMessagePolicy string `json:"terminationMessagePolicy"`
 			ImagePullPolicy          string `json:"imagePullPolicy"`
 		} `json:"containers"`
+		InitContainers []KubeInitContainer `json:"initContainers,omitempty"`
+		Overhead       map[string]string   `json:"overhead,omitempty"`
 		RestartPolicy                 string `json:"restartPolicy"`
 		TerminationGracePeriodSeconds int    `json:"terminationGracePeriodSeconds"`
 		DNSPolicy                     string `json:"dnsPolicy"`
@@ -81,6 +86,15 @@ type KubePod struct {
 		SecurityContext struct {
 		} `json:"securityContext"`
 		SchedulerName string `json:"schedulerName"`
+		Priority          *int   `json:"priority,omitempty"`
+		PriorityClassName string `json:"priorityClassName,omitempty"`
+		PreemptionPolicy  string `json:"preemptionPolicy,omitempty"`
+		ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+		SchedulingGates   []KubePodSchedulingGate `json:"schedulingGates,omitempty"`
+		OS                *KubePodOS              `json:"os,omitempty"`
+		NodeSelector  map[string]string `json:"nodeSelector,omitempty"`
+		Affinity      *KubeAffinity     `json:"affinity,omitempty"`
+		TopologySpreadConstraints []KubeTopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
 		Tolerations []struct {
 			Key               string `json:"key"`
 			Operator          string `json:"operator"`
@@ -115,5 +129,31 @@ type KubePod struct {
 			ContainerID  string `json:"containerID"`
 		} `json:"containerStatuses"`
 		QosClass string `json:"qosClass"`
+		NominatedNodeName string `json:"nominatedNodeName,omitempty"`
 	} `json:"status"`
 }
+
+// Operating system of the containers of a pod
+type KubePodOS struct {
+	Name string `json:"name"`
+}
+
+// Gate of a pod that must be removed before it is scheduled
+type KubePodSchedulingGate struct {
+	Name string `json:"name"`
+}
+
+// Init container of a pod, run to completion before the containers unless its restart policy
+// is Always: a sidecar running along them
+type KubeInitContainer struct {
+	Name          string        `json:"name"`
+	Image         string        `json:"image"`
+	Resources     KubeResources `json:"resources"`
+	RestartPolicy string        `json:"restartPolicy,omitempty"`
+}
+
+// Resource requirements of a container, with the quantities as Kubernetes strings ("500m", "1Gi")
+type KubeResources struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
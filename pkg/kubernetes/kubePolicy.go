@@ -0,0 +1,93 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PodDisruptionBudget of the policy/v1 api
+type KubePodDisruptionBudget struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Selector *KubeLabelSelector `json:"selector"`
+	} `json:"spec"`
+	Status struct {
+		DisruptionsAllowed int `json:"disruptionsAllowed"`
+	} `json:"status"`
+}
+
+// Lists the pod disruption budgets of all namespaces
+func (api *KubernetesCoreV1Api) ListPodDisruptionBudgets(ctx context.Context) (budgets []KubePodDisruptionBudget, err error) {
+	err = api.list(ctx, "apis/policy/v1/poddisruptionbudgets", nil, &budgets)
+	return
+}
+
+// Evicts a pod through the eviction api, which refuses with a 429 if a disruption budget would be
+// broken. The eviction has the api version of the api server.
+func (api *KubernetesCoreV1Api) EvictPod(ctx context.Context, namespace, name string) error {
+	eviction := map[string]interface{}{
+		"apiVersion": api.evictionVersion(),
+		"kind":       "Eviction",
+		"metadata":   map[string]string{"name": name, "namespace": namespace},
+	}
+	data, err := json.Marshal(eviction)
+	if err != nil {
+		return err
+	}
+
+	apiMethod := fmt.Sprintf("api/v1/namespaces/%s/pods/%s/eviction", namespace, name)
+	response, err := api.Request(ctx, "POST", apiMethod, "", nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 && response.StatusCode != 201 {
+		return &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	return nil
+}
+
+// Sets the node a pod is expected to run on once the preemption victims are gone
+func (api *KubernetesCoreV1Api) NominatePod(ctx context.Context, namespace, name, nodeName string) error {
+	patch := map[string]interface{}{
+		"status": map[string]string{"nominatedNodeName": nodeName},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	apiMethod := fmt.Sprintf("api/v1/namespaces/%s/pods/%s/status", namespace, name)
+	response, err := api.Request(ctx, "PATCH", apiMethod, "application/merge-patch+json", nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+)
+
+// ResourceQuota of a namespace, with the resources used by its objects
+type KubeResourceQuota struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Scopes        []string `json:"scopes,omitempty"`
+		ScopeSelector *struct {
+			MatchExpressions []KubeScopedResourceSelectorRequirement `json:"matchExpressions"`
+		} `json:"scopeSelector,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Hard map[string]string `json:"hard"`
+		Used map[string]string `json:"used"`
+	} `json:"status"`
+}
+
+// Scope of a quota selected by the values of the pods, like their PriorityClass
+type KubeScopedResourceSelectorRequirement struct {
+	ScopeName string   `json:"scopeName"`
+	Operator  string   `json:"operator"`
+	Values    []string `json:"values,omitempty"`
+}
+
+// Lists the resource quotas of a namespace
+func (api *KubernetesCoreV1Api) ListResourceQuotas(ctx context.Context, namespace string) (quotas []KubeResourceQuota, err error) {
+	err = api.list(ctx, fmt.Sprintf("api/v1/namespaces/%s/resourcequotas", namespace), nil, &quotas)
+	return
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+)
+
+// StatefulSet of the apps/v1 api, with its desired replicas only
+type KubeStatefulSet struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas *int `json:"replicas,omitempty"`
+	} `json:"spec"`
+}
+
+// Reads a StatefulSet
+func (api *KubernetesCoreV1Api) GetStatefulSet(ctx context.Context, namespace, name string) (statefulSet KubeStatefulSet, err error) {
+	err = api.getJSON(ctx, fmt.Sprintf("apis/apps/v1/namespaces/%s/statefulsets/%s", namespace, name), &statefulSet)
+	return
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+)
+
+// VerticalPodAutoscaler of the autoscaling.k8s.io/v1 api, with the recommendations of its target
+type KubeVerticalPodAutoscaler struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		TargetRef struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"targetRef"`
+	} `json:"spec"`
+	Status struct {
+		Recommendation *struct {
+			ContainerRecommendations []struct {
+				ContainerName string            `json:"containerName"`
+				Target        map[string]string `json:"target"`
+			} `json:"containerRecommendations"`
+		} `json:"recommendation,omitempty"`
+	} `json:"status"`
+}
+
+// Lists the vertical pod autoscalers of a namespace
+func (api *KubernetesCoreV1Api) ListVerticalPodAutoscalers(ctx context.Context, namespace string) (autoscalers []KubeVerticalPodAutoscaler, err error) {
+	err = api.list(ctx, fmt.Sprintf("apis/autoscaling.k8s.io/v1/namespaces/%s/verticalpodautoscalers", namespace), nil, &autoscalers)
+	return
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Oldest minor version of Kubernetes 1.x the client supports
+const MinSupportedMinor = 21
+
+// KubeVersion is the version of the api server, from /version
+type KubeVersion struct {
+	Major      string `json:"major"`
+	Minor      string `json:"minor"`
+	GitVersion string `json:"gitVersion"`
+}
+
+// Returns the major and minor numbers of the version, without the "+" of distributions like "27+"
+func (v KubeVersion) Numbers() (major, minor int, err error) {
+	if major, err = strconv.Atoi(strings.TrimRight(v.Major, "+")); err != nil {
+		return 0, 0, fmt.Errorf("major version %q: %s", v.Major, err)
+	}
+	if minor, err = strconv.Atoi(strings.TrimRight(v.Minor, "+")); err != nil {
+		return 0, 0, fmt.Errorf("minor version %q: %s", v.Minor, err)
+	}
+	return
+}
+
+// UnsupportedVersionError is returned for the api servers older than MinSupportedMinor
+type UnsupportedVersionError struct {
+	Version KubeVersion
+}
+
+func (e UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("Kubernetes %s is not supported, the scheduler needs 1.%d or later", e.Version.GitVersion, MinSupportedMinor)
+}
+
+// Reads the version of the api server
+func (api *KubernetesCoreV1Api) ServerVersion(ctx context.Context) (version KubeVersion, err error) {
+	err = api.getJSON(ctx, "version", &version)
+	return
+}
+
+// Reads the version of the api server and adapts the requests to it, before any other request is
+// made. An UnsupportedVersionError is returned for the versions older than MinSupportedMinor.
+// Until it is called the client uses the apis of the newest versions.
+func (api *KubernetesCoreV1Api) DetectVersion(ctx context.Context) (version KubeVersion, err error) {
+	if version, err = api.ServerVersion(ctx); err != nil {
+		return
+	}
+	major, minor, err := version.Numbers()
+	if err != nil {
+		return
+	}
+	if major != 1 || minor < MinSupportedMinor {
+		return version, UnsupportedVersionError{version}
+	}
+	api.minor = minor
+	return
+}
+
+// Returns the api version of the evictions: policy/v1 since Kubernetes 1.22, policy/v1beta1 before.
+// It is the only request depending on the version: the bindings, the core v1 events and the
+// policy/v1 disruption budgets are served the same way from 1.21 up, and the client takes no
+// leases, so they are deliberately not switched.
+func (api *KubernetesCoreV1Api) evictionVersion() string {
+	if api.minor != 0 && api.minor < 22 {
+		return "policy/v1beta1"
+	}
+	return "policy/v1"
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Annotation set on a claim with delayed binding to tell the provisioner the node chosen for the pod
+const SelectedNodeAnnotation = "volume.kubernetes.io/selected-node"
+
+type KubePersistentVolumeClaim struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		VolumeName       string  `json:"volumeName"`
+		StorageClassName *string `json:"storageClassName"`
+	} `json:"spec"`
+}
+
+type KubePersistentVolume struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeAffinity *struct {
+			Required *KubeNodeSelector `json:"required"`
+		} `json:"nodeAffinity"`
+		CSI *struct {
+			Driver       string `json:"driver"`
+			VolumeHandle string `json:"volumeHandle"`
+		} `json:"csi"`
+	} `json:"spec"`
+}
+
+type KubeStorageClass struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Provisioner       string `json:"provisioner"`
+	VolumeBindingMode string `json:"volumeBindingMode"`
+	AllowedTopologies []struct {
+		MatchLabelExpressions []struct {
+			Key    string   `json:"key"`
+			Values []string `json:"values"`
+		} `json:"matchLabelExpressions"`
+	} `json:"allowedTopologies"`
+}
+
+// Volume limits reported by the CSI drivers of a node
+type KubeCSINode struct {
+	Spec struct {
+		Drivers []struct {
+			Name        string `json:"name"`
+			Allocatable *struct {
+				Count *int `json:"count"`
+			} `json:"allocatable"`
+		} `json:"drivers"`
+	} `json:"spec"`
+}
+
+// Returns true if the storage class provisions a volume only once a pod using it is scheduled
+func (c KubeStorageClass) WaitForFirstConsumer() bool {
+	return c.VolumeBindingMode == "WaitForFirstConsumer"
+}
+
+// Returns true if the node labels are in the allowed topologies of the class, or if there are none
+func (c KubeStorageClass) Allows(labels map[string]string) bool {
+	if len(c.AllowedTopologies) == 0 {
+		return true
+	}
+	for _, term := range c.AllowedTopologies {
+		matches := true
+		for _, expression := range term.MatchLabelExpressions {
+			if value, ok := labels[expression.Key]; !ok || !contains(expression.Values, value) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// Lists the persistent volume claims of all namespaces
+func (api *KubernetesCoreV1Api) ListPersistentVolumeClaims(ctx context.Context) (claims []KubePersistentVolumeClaim, err error) {
+	err = api.list(ctx, "api/v1/persistentvolumeclaims", nil, &claims)
+	return
+}
+
+// Retrieves a persistent volume claim
+func (api *KubernetesCoreV1Api) GetPersistentVolumeClaim(ctx context.Context, namespace, name string) (claim KubePersistentVolumeClaim, err error) {
+	err = api.getJSON(ctx, fmt.Sprintf("api/v1/namespaces/%s/persistentvolumeclaims/%s", namespace, name), &claim)
+	return
+}
+
+// Lists the persistent volumes of the cluster
+func (api *KubernetesCoreV1Api) ListPersistentVolumes(ctx context.Context) (volumes []KubePersistentVolume, err error) {
+	err = api.list(ctx, "api/v1/persistentvolumes", nil, &volumes)
+	return
+}
+
+// Lists the storage classes of the cluster
+func (api *KubernetesCoreV1Api) ListStorageClasses(ctx context.Context) (classes []KubeStorageClass, err error) {
+	err = api.list(ctx, "apis/storage.k8s.io/v1/storageclasses", nil, &classes)
+	return
+}
+
+// Retrieves the CSI drivers of a node and their volume limits
+func (api *KubernetesCoreV1Api) GetCSINode(ctx context.Context, name string) (node KubeCSINode, err error) {
+	err = api.getJSON(ctx, "apis/storage.k8s.io/v1/csinodes/"+name, &node)
+	return
+}
+
+// Sets an annotation on a persistent volume claim
+func (api *KubernetesCoreV1Api) AnnotatePersistentVolumeClaim(ctx context.Context, namespace, name, key, value string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{key: value},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	apiMethod := fmt.Sprintf("api/v1/namespaces/%s/persistentvolumeclaims/%s", namespace, name)
+	response, err := api.Request(ctx, "PATCH", apiMethod, "application/merge-patch+json", nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	return nil
+}
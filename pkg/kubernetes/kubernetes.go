@@ -0,0 +1,484 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Small Kubernetes api wrapper
+package kubernetes
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"context"
+	"bytes"
+
+	"github.com/draios/kubernetes-scheduler/pkg/cache"
+	"github.com/draios/kubernetes-scheduler/pkg/transport"
+)
+
+type KubernetesCoreV1Api struct {
+	clientConfig
+	nodeList cache.Cache
+	client   *http.Client
+	wrap     func(http.RoundTripper) http.RoundTripper
+	tuning   *transport.Options
+	stats    *transport.Stats
+	minor    int // Minor version of the api server, 0 until detected
+
+	nodes *nodeStore
+	pods  *podStore
+}
+
+// GET requests failing with a network error, a 429 or a 5xx are tried this many times
+const requestAttempts = 4
+
+// Page size of the lists, bigger collections are read in several requests
+const listPageSize = 500
+
+func (api *KubernetesCoreV1Api) ReplaceDeploymentScheduler(ctx context.Context, item KubeDeploymentItem, scheduler string) (modified KubeDeploymentItem, err error) {
+	url := fmt.Sprintf("apis/apps/v1/namespaces/%s/deployments/%s", item.Metadata.Namespace, item.Metadata.Name)
+
+	patchRequest := []struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value string `json:"value,omitempty"`
+	}{{
+		Op:    "add",
+		Path:  "/spec/template/spec/schedulerName",
+		Value: scheduler,
+	}}
+
+	data, err := json.Marshal(patchRequest)
+	if err != nil {
+		return
+	}
+	body := bytes.NewReader(data)
+
+	response, err := api.Request(ctx, "PATCH", url, "application/json-patch+json", nil, body)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		var responseData struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(response.Body).Decode(&responseData)
+		err = fmt.Errorf("kubernetes: ReplaceDeploymentScheduler error code %d: %s", response.StatusCode, responseData.Message)
+		return
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&modified)
+	return
+}
+
+func (api *KubernetesCoreV1Api) ListNamespacedDeployments(ctx context.Context, namespace, fieldSelector string) (deployments KubeDeployments, err error) {
+
+	values := url.Values{}
+	values.Add("fieldSelector", fieldSelector)
+
+	response, err := api.Request(ctx, "GET", fmt.Sprintf("apis/apps/v1/namespaces/%s/deployments", namespace), "", values, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	err = json.NewDecoder(response.Body).Decode(&deployments)
+	return
+}
+
+// Lists the pods of a namespace, or of all namespaces if it is empty, matching the field selector
+func (api *KubernetesCoreV1Api) ListPods(ctx context.Context, namespace, fieldSelector string) (pods []KubePod, err error) {
+	values := url.Values{}
+	if fieldSelector != "" {
+		values.Add("fieldSelector", fieldSelector)
+	}
+
+	endpoint := "api/v1/pods"
+	if namespace != "" {
+		endpoint = fmt.Sprintf("api/v1/namespaces/%s/pods", namespace)
+	}
+
+	err = api.list(ctx, endpoint, values, &pods)
+	return
+}
+
+// Lists the pods assigned to a node and not terminated, from memory once the informers are synced
+func (api *KubernetesCoreV1Api) ListAssignedPods(ctx context.Context) ([]KubePod, error) {
+	if pods, ok := api.pods.assigned(); ok {
+		return pods, nil
+	}
+	return api.ListPods(ctx, "", "spec.nodeName!=,status.phase!=Succeeded,status.phase!=Failed")
+}
+
+// Reads a pod as a generic object, keeping all its fields
+func (api *KubernetesCoreV1Api) GetPodObject(ctx context.Context, namespace, name string) (pod map[string]interface{}, err error) {
+	err = api.getJSON(ctx, fmt.Sprintf("api/v1/namespaces/%s/pods/%s", namespace, name), &pod)
+	return
+}
+
+// Creates a pod from a generic object
+func (api *KubernetesCoreV1Api) CreatePod(ctx context.Context, namespace string, pod map[string]interface{}) error {
+	data, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+	apiMethod := fmt.Sprintf("api/v1/namespaces/%s/pods", namespace)
+	response, err := api.Request(ctx, "POST", apiMethod, "", nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 201 && response.StatusCode != 200 {
+		return &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	return nil
+}
+
+// Deletes a pod
+func (api *KubernetesCoreV1Api) DeletePod(ctx context.Context, namespace, name string) error {
+	apiMethod := fmt.Sprintf("api/v1/namespaces/%s/pods/%s", namespace, name)
+	response, err := api.Request(ctx, "DELETE", apiMethod, "", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 && response.StatusCode != 202 {
+		return &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	return nil
+}
+
+// Reads a pod
+func (api *KubernetesCoreV1Api) GetPod(ctx context.Context, namespace, name string) (pod KubePod, err error) {
+	err = api.getJSON(ctx, fmt.Sprintf("api/v1/namespaces/%s/pods/%s", namespace, name), &pod)
+	return
+}
+
+// Reads a node from the api server, bypassing the node caches
+func (api *KubernetesCoreV1Api) GetNode(ctx context.Context, name string) (node KubeNode, err error) {
+	err = api.getJSON(ctx, "api/v1/nodes/"+name, &node)
+	return
+}
+
+func (api *KubernetesCoreV1Api) CreateNamespacedBinding(ctx context.Context, namespace string, body io.Reader) (response *http.Response, err error) {
+	return api.Request(ctx, "POST", fmt.Sprintf("api/v1/namespaces/%s/bindings", namespace), "", nil, body)
+}
+
+// Creates a binding with the binding subresource of the pod
+func (api *KubernetesCoreV1Api) CreatePodBinding(ctx context.Context, namespace, name string, body io.Reader) (response *http.Response, err error) {
+	return api.Request(ctx, "POST", fmt.Sprintf("api/v1/namespaces/%s/pods/%s/binding", namespace, name), "", nil, body)
+}
+
+// Applies a merge patch to a pod
+func (api *KubernetesCoreV1Api) PatchPod(ctx context.Context, namespace, name string, body io.Reader) (response *http.Response, err error) {
+	return api.Request(ctx, "PATCH", fmt.Sprintf("api/v1/namespaces/%s/pods/%s", namespace, name), "application/merge-patch+json", nil, body)
+}
+
+// Opens a watch and sends its events, one per line, until it ends. The channel is closed when the
+// watch ends or the context is done, a watch refused by the api server is returned as a StatusError.
+func (api *KubernetesCoreV1Api) Watch(ctx context.Context, httpMethod, apiMethod string, values url.Values, body io.Reader) (responseChannel chan []byte, err error) {
+	if values == nil {
+		values = url.Values{}
+	}
+	values.Add("watch", "true")
+	response, err := api.Request(ctx, httpMethod, apiMethod, "", values, body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != 200 {
+		response.Body.Close()
+		return nil, &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	responseChannel = make(chan []byte)
+	go func() {
+		defer response.Body.Close()
+
+		reader := bufio.NewReader(response.Body)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Println(err)
+				}
+				close(responseChannel)
+				return
+			}
+			select {
+			case responseChannel <- line:
+			case <-ctx.Done():
+				close(responseChannel)
+				return
+			}
+		}
+	}()
+	return
+}
+
+// Sends a request to the api server with the credentials of the current context. GET requests are
+// retried with an exponential backoff, or the Retry-After of the server, on transient failures.
+func (api *KubernetesCoreV1Api) Request(ctx context.Context, httpMethod, apiMethod, contentType string, values url.Values, body io.Reader) (response *http.Response, err error) {
+	attempts := 1
+	if httpMethod == "GET" && body == nil {
+		attempts = requestAttempts
+	}
+	backoff := 200 * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		response, err = api.do(ctx, httpMethod, apiMethod, contentType, values, body)
+		if response != nil && response.StatusCode == http.StatusUnauthorized {
+			// Expired token, read it again for the next request
+			api.expireCredentials()
+		}
+		retryable := (err != nil && ctx.Err() == nil) || (response != nil && retryableStatus(response.StatusCode)) ||
+			(response != nil && response.StatusCode == http.StatusUnauthorized && attempt == 1)
+		if !retryable || attempt >= attempts {
+			return
+		}
+
+		wait := backoff
+		if response != nil {
+			if seconds, parseErr := strconv.Atoi(response.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+				wait = time.Duration(seconds) * time.Second
+			}
+			response.Body.Close()
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (api *KubernetesCoreV1Api) do(ctx context.Context, httpMethod, apiMethod, contentType string, values url.Values, body io.Reader) (response *http.Response, err error) {
+	apiUrl := api.currentApiUrlEndpoint()
+
+	request, err := http.NewRequestWithContext(ctx, httpMethod, apiUrl+"/"+apiMethod, body)
+	if err != nil {
+		return
+	}
+	if values != nil {
+		request.URL.RawQuery = values.Encode()
+	}
+	if err = api.authorize(request); err != nil {
+		return
+	}
+
+	// Get the info in json
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	request.Header.Add("Content-Type", contentType)
+
+	// Make the request
+	response, err = api.client.Do(request)
+	return
+}
+
+// Reads all the items of a collection, following the continue tokens of the pages, and
+// returns them with the resource version of the list
+func (api *KubernetesCoreV1Api) listRaw(ctx context.Context, apiMethod string, values url.Values) (items []json.RawMessage, resourceVersion string, err error) {
+	query := url.Values{}
+	for key, value := range values {
+		query[key] = value
+	}
+	query.Set("limit", strconv.Itoa(listPageSize))
+
+	for {
+		var page struct {
+			Metadata struct {
+				Continue        string `json:"continue"`
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+			Items []json.RawMessage `json:"items"`
+		}
+		response, err := api.Request(ctx, "GET", apiMethod, "", query, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if response.StatusCode != 200 {
+			response.Body.Close()
+			return nil, "", &StatusError{Code: response.StatusCode, Method: apiMethod}
+		}
+		err = json.NewDecoder(response.Body).Decode(&page)
+		response.Body.Close()
+		if err != nil {
+			return nil, "", err
+		}
+
+		items = append(items, page.Items...)
+		resourceVersion = page.Metadata.ResourceVersion
+		if page.Metadata.Continue == "" {
+			return items, resourceVersion, nil
+		}
+		query.Set("continue", page.Metadata.Continue)
+	}
+}
+
+// Reads all the items of a collection into the slice pointed by items
+func (api *KubernetesCoreV1Api) list(ctx context.Context, apiMethod string, values url.Values, items interface{}) error {
+	raw, _, err := api.listRaw(ctx, apiMethod, values)
+	if err != nil {
+		return err
+	}
+	if raw == nil {
+		raw = []json.RawMessage{}
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, items)
+}
+
+// Lists the nodes, from memory once the informers are synced
+func (api *KubernetesCoreV1Api) ListNodes(ctx context.Context) (nodes []KubeNode, err error) {
+	if nodes, ok := api.nodes.list(); ok {
+		return nodes, nil
+	}
+
+	if nodes, ok := api.nodeList.Data(); ok {
+		return nodes.([]KubeNode), nil
+	}
+
+	if err = api.list(ctx, "api/v1/nodes", nil, &nodes); err != nil {
+		return
+	}
+
+	api.nodeList.SetData(nodes)
+
+	return
+}
+
+func (api *KubernetesCoreV1Api) ListNamespacedReplicaset(ctx context.Context, namespace string, replicaName string) (replicaSet KubeReplicaSet, err error){
+	endpoint := fmt.Sprintf("apis/apps/v1/namespaces/%s/replicasets/%s", namespace, replicaName)
+	response, err := api.Request(ctx, "GET", endpoint, "", nil, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	err = json.NewDecoder(response.Body).Decode(&replicaSet)
+	return
+}
+
+// Sets an annotation of a pod, an empty value removes it
+func (api *KubernetesCoreV1Api) AnnotatePod(ctx context.Context, namespace, name, key, value string) error {
+	return api.annotate(ctx, fmt.Sprintf("api/v1/namespaces/%s/pods/%s", namespace, name), key, value)
+}
+
+// Sets an annotation of a node, an empty value removes it
+func (api *KubernetesCoreV1Api) AnnotateNode(ctx context.Context, name, key, value string) error {
+	return api.annotate(ctx, fmt.Sprintf("api/v1/nodes/%s", name), key, value)
+}
+
+// Sets an annotation of the object with a merge patch, an empty value removes it
+func (api *KubernetesCoreV1Api) annotate(ctx context.Context, apiMethod, key, value string) error {
+	var annotation interface{} = value
+	if value == "" {
+		annotation = nil
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{key: annotation},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	response, err := api.Request(ctx, "PATCH", apiMethod, "application/merge-patch+json", nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return &StatusError{Code: response.StatusCode, Method: apiMethod}
+	}
+	return nil
+}
+
+// Reads the data of a config map
+func (api *KubernetesCoreV1Api) GetConfigMap(ctx context.Context, namespace, name string) (data map[string]string, err error) {
+	var configMap struct {
+		Data map[string]string `json:"data"`
+	}
+	err = api.getJSON(ctx, fmt.Sprintf("api/v1/namespaces/%s/configmaps/%s", namespace, name), &configMap)
+	return configMap.Data, err
+}
+
+// Reads a secret and returns its decoded data
+func (api *KubernetesCoreV1Api) GetSecret(ctx context.Context, namespace, name string) (data map[string][]byte, err error) {
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	err = api.getJSON(ctx, fmt.Sprintf("api/v1/namespaces/%s/secrets/%s", namespace, name), &secret)
+	if err != nil {
+		return
+	}
+
+	data = map[string][]byte{}
+	for key, value := range secret.Data {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes: secret %s/%s key %s: %s", namespace, name, key, err)
+		}
+		data[key] = decoded
+	}
+	return
+}
+
+// Creates or updates an object with a server-side apply of its YAML manifest
+func (api *KubernetesCoreV1Api) Apply(ctx context.Context, apiMethod string, manifest []byte, fieldManager string) error {
+	values := url.Values{}
+	values.Add("fieldManager", fieldManager)
+	values.Add("force", "true")
+
+	response, err := api.Request(ctx, "PATCH", apiMethod, "application/apply-patch+yaml", values, bytes.NewReader(manifest))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 && response.StatusCode != 201 {
+		var responseData struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(response.Body).Decode(&responseData)
+		return fmt.Errorf("kubernetes: apply %s error code %d: %s", apiMethod, response.StatusCode, responseData.Message)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Suffixes of the Kubernetes resource quantities, longest first so "Ki" is matched before "k"
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50}, {"Ei", 1 << 60},
+	{"n", 1e-9}, {"u", 1e-6}, {"m", 1e-3},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15}, {"E", 1e18},
+}
+
+// Parses a resource quantity ("250m", "1.5Gi", "2e3") into its value in base units
+// (cores for cpu, bytes for memory)
+func ParseQuantity(quantity string) (value float64, err error) {
+	quantity = strings.TrimSpace(quantity)
+	if quantity == "" {
+		return 0, fmt.Errorf("kubernetes: empty quantity")
+	}
+
+	multiplier := 1.0
+	for _, s := range quantitySuffixes {
+		if strings.HasSuffix(quantity, s.suffix) {
+			quantity = strings.TrimSuffix(quantity, s.suffix)
+			multiplier = s.multiplier
+			break
+		}
+	}
+
+	value, err = strconv.ParseFloat(quantity, 64)
+	if err != nil {
+		return 0, fmt.Errorf("kubernetes: invalid quantity %q", quantity)
+	}
+	return value * multiplier, nil
+}
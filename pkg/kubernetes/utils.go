@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/draios/kubernetes-scheduler/pkg/transport"
+)
+
+// Wraps the transport of the requests to the api server, of the current context and the next ones.
+// The wrappers are applied in order, the last one sees the requests first.
+func (api *KubernetesCoreV1Api) WrapTransport(wrap func(http.RoundTripper) http.RoundTripper) {
+	if previous := api.wrap; previous != nil {
+		api.wrap = func(next http.RoundTripper) http.RoundTripper { return wrap(previous(next)) }
+	} else {
+		api.wrap = wrap
+	}
+	if api.client != nil {
+		api.client.Transport = wrap(api.client.Transport)
+	}
+}
+
+// Tunes the transport of the requests to the api server, of the current context and the next ones,
+// counting its connections in stats. The client of the current context is built again.
+func (api *KubernetesCoreV1Api) TuneTransport(options transport.Options, stats *transport.Stats) error {
+	api.tuning, api.stats = &options, stats
+	if api.client == nil {
+		return nil
+	}
+	return api.loadTLSInfo()
+}
+
+// Files mounted in the pods with the credentials of their service account
+const (
+	serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// Returns true if the process runs in a pod of the cluster
+func InCluster() bool {
+	_, err := os.Stat(serviceAccountTokenFile)
+	return err == nil && os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
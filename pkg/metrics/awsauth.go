@@ -0,0 +1,274 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const awsMetadataURL = "http://169.254.169.254/latest/"
+
+// AWSCredentials sign the requests to the AWS apis
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// Returns the AWS credentials of the environment: the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+// keys, the IAM role of the service account (IRSA, AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE),
+// the EKS Pod Identity agent (AWS_CONTAINER_CREDENTIALS_FULL_URI) or the role of the instance.
+func AWSCredentialsChain(client *http.Client) func(ctx context.Context, region string) (AWSCredentials, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	source := &awsCredentialsSource{client: client}
+	return source.credentials
+}
+
+// Caches the credentials until shortly before they expire
+type awsCredentialsSource struct {
+	client *http.Client
+
+	mutex  sync.Mutex
+	cached AWSCredentials
+}
+
+func (s *awsCredentialsSource) credentials(ctx context.Context, region string) (AWSCredentials, error) {
+	if key := os.Getenv("AWS_ACCESS_KEY_ID"); key != "" {
+		return AWSCredentials{AccessKeyID: key, SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// Renewed five minutes early, so the credentials do not expire during a request
+	if s.cached.AccessKeyID != "" && time.Now().Add(5*time.Minute).Before(s.cached.Expiration) {
+		return s.cached, nil
+	}
+	var credentials AWSCredentials
+	var err error
+	switch {
+	case os.Getenv("AWS_ROLE_ARN") != "" && os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "":
+		credentials, err = s.webIdentity(ctx, region)
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		credentials, err = s.container(ctx)
+	default:
+		credentials, err = s.instance(ctx)
+	}
+	if err != nil {
+		return credentials, err
+	}
+	s.cached = credentials
+	return credentials, nil
+}
+
+// Assumes the role of the service account with its projected token
+func (s *awsCredentialsSource) webIdentity(ctx context.Context, region string) (credentials AWSCredentials, err error) {
+	token, err := ioutil.ReadFile(os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"))
+	if err != nil {
+		return
+	}
+	values := url.Values{}
+	values.Set("Action", "AssumeRoleWithWebIdentity")
+	values.Set("Version", "2011-06-15")
+	values.Set("RoleArn", os.Getenv("AWS_ROLE_ARN"))
+	values.Set("RoleSessionName", "sysdig-scheduler")
+	values.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+	request, err := http.NewRequestWithContext(ctx, "GET", "https://sts."+region+".amazonaws.com/?"+values.Encode(), nil)
+	if err != nil {
+		return
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if err = statusError("sts", response); err != nil {
+		return
+	}
+	var result struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      time.Time
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err = xml.NewDecoder(response.Body).Decode(&result); err != nil {
+		return
+	}
+	c := result.Credentials
+	return AWSCredentials{c.AccessKeyId, c.SecretAccessKey, c.SessionToken, c.Expiration}, nil
+}
+
+// The credentials answered by the container credentials endpoints and the instance metadata
+type awsCredentialsResponse struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+// Reads the credentials of the EKS Pod Identity agent
+func (s *awsCredentialsSource) container(ctx context.Context) (credentials AWSCredentials, err error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"), nil)
+	if err != nil {
+		return
+	}
+	if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		token, err := ioutil.ReadFile(file)
+		if err != nil {
+			return credentials, err
+		}
+		request.Header.Set("Authorization", strings.TrimSpace(string(token)))
+	}
+	var result awsCredentialsResponse
+	if err = s.getJSON(request, "container credentials", &result); err != nil {
+		return
+	}
+	return AWSCredentials{result.AccessKeyId, result.SecretAccessKey, result.Token, result.Expiration}, nil
+}
+
+// Reads the credentials of the instance role from the instance metadata, with an IMDSv2 token
+func (s *awsCredentialsSource) instance(ctx context.Context) (credentials AWSCredentials, err error) {
+	role, err := awsMetadata(ctx, s.client, "meta-data/iam/security-credentials/")
+	if err != nil {
+		return
+	}
+	role = strings.TrimSpace(strings.SplitN(role, "\n", 2)[0])
+	if role == "" {
+		return credentials, fmt.Errorf("instance metadata: the instance has no role")
+	}
+	data, err := awsMetadata(ctx, s.client, "meta-data/iam/security-credentials/"+role)
+	if err != nil {
+		return
+	}
+	var result awsCredentialsResponse
+	if err = json.Unmarshal([]byte(data), &result); err != nil {
+		return
+	}
+	return AWSCredentials{result.AccessKeyId, result.SecretAccessKey, result.Token, result.Expiration}, nil
+}
+
+func (s *awsCredentialsSource) getJSON(request *http.Request, provider string, result interface{}) error {
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err := statusError(provider, response); err != nil {
+		return err
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// Reads a path of the instance metadata with an IMDSv2 session token
+func awsMetadata(ctx context.Context, client *http.Client, path string) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, "PUT", awsMetadataURL+"api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	token, err := readAll(client, request, "instance metadata")
+	if err != nil {
+		return "", err
+	}
+	if request, err = http.NewRequestWithContext(ctx, "GET", awsMetadataURL+path, nil); err != nil {
+		return "", err
+	}
+	request.Header.Set("X-aws-ec2-metadata-token", token)
+	return readAll(client, request, "instance metadata")
+}
+
+func readAll(client *http.Client, request *http.Request, provider string) (string, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", provider, err)
+	}
+	defer response.Body.Close()
+	if err := statusError(provider, response); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	return string(data), err
+}
+
+// Signs the request and its body with AWS Signature Version 4
+func signAWS(request *http.Request, body []byte, credentials AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	request.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := request.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	// Encode sorts the keys, AWS wants the spaces as %20
+	query := strings.Replace(request.URL.Query().Encode(), "+", "%20", -1)
+	payload := sha256.Sum256(body)
+	canonical := strings.Join([]string{request.Method, path, query, canonicalHeaders, signedHeaders, hex.EncodeToString(payload[:])}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	azureMetadataURL   = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureManagementURL = "https://management.azure.com"
+	azureAuthorityHost = "https://login.microsoftonline.com/"
+	azureAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// Returns the access tokens of the Azure Resource Manager: with workload identity (the
+// AZURE_FEDERATED_TOKEN_FILE, AZURE_CLIENT_ID and AZURE_TENANT_ID set by its webhook) the token of
+// the managed identity federated with the service account, otherwise the one of the managed identity
+// of the node, the user assigned identity clientID if not empty
+func AzureToken(clientID string, client *http.Client) func(ctx context.Context) (string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	source := &azureTokenSource{clientID: clientID, client: client}
+	return source.token
+}
+
+// Caches an access token until shortly before it expires
+type azureTokenSource struct {
+	clientID string
+	client   *http.Client
+
+	mutex   sync.Mutex
+	cached  string
+	expires time.Time
+}
+
+// The lifetime of the tokens, a number from Azure AD and a string from the instance metadata
+type azureSeconds int
+
+func (s *azureSeconds) UnmarshalJSON(data []byte) error {
+	seconds, err := strconv.Atoi(strings.Trim(string(data), `"`))
+	*s = azureSeconds(seconds)
+	return err
+}
+
+type azureTokenResponse struct {
+	AccessToken string       `json:"access_token"`
+	ExpiresIn   azureSeconds `json:"expires_in"`
+}
+
+func (s *azureTokenSource) token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cached != "" && time.Now().Before(s.expires) {
+		return s.cached, nil
+	}
+
+	var request *http.Request
+	var err error
+	if file := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); file != "" {
+		request, err = s.federatedRequest(ctx, file)
+	} else {
+		values := url.Values{}
+		values.Set("api-version", "2018-02-01")
+		values.Set("resource", azureManagementURL+"/")
+		if s.clientID != "" {
+			values.Set("client_id", s.clientID)
+		}
+		if request, err = http.NewRequestWithContext(ctx, "GET", azureMetadataURL+"?"+values.Encode(), nil); err == nil {
+			request.Header.Set("Metadata", "true")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if err := statusError("azure token", response); err != nil {
+		return "", err
+	}
+	var result azureTokenResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("no access token in the response")
+	}
+	s.cached = result.AccessToken
+	// Renewed a minute early, so a token does not expire during a request
+	s.expires = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return s.cached, nil
+}
+
+// Returns the request exchanging the projected service account token for an Azure AD token
+func (s *azureTokenSource) federatedRequest(ctx context.Context, file string) (*http.Request, error) {
+	assertion, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = azureAuthorityHost
+	}
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	if s.clientID != "" {
+		clientID = s.clientID
+	}
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", clientID)
+	form.Set("scope", azureManagementURL+"/.default")
+	form.Set("client_assertion_type", azureAssertionType)
+	form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+	endpoint := strings.TrimRight(authority, "/") + "/" + os.Getenv("AZURE_TENANT_ID") + "/oauth2/v2.0/token"
+	request, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return request, nil
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AzureMonitorProvider reads the metrics of the virtual machines of the nodes from Azure Monitor,
+// the virtual machine being the resource of the provider id of the node
+type AzureMonitorProvider struct {
+	// Metrics by name, the others are the host metric of that name, like Percentage CPU
+	Metrics map[string]AzureMetric
+	// Window the newest datapoint is searched in, 5m if 0
+	Window time.Duration
+	// ProviderID returns the cloud provider id of a node, azure:///subscriptions/...
+	ProviderID func(ctx context.Context, nodeName string) (string, error)
+	// Token returns the access token of the Azure Resource Manager
+	Token func(ctx context.Context) (string, error)
+	// Client of the requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// AzureMetric is an Azure Monitor metric, with its Namespace if it is not a host metric, like
+// the guest metrics of Azure Monitor Agent. Aggregation is Average, Maximum, Minimum, Total or Count.
+type AzureMetric struct {
+	Name        string
+	Namespace   string
+	Aggregation string
+}
+
+func (p *AzureMonitorProvider) Name() string {
+	return "azure-monitor"
+}
+
+func (p *AzureMonitorProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	token, err := p.Token(ctx)
+	if err != nil {
+		return nil, TransientError{fmt.Errorf("azure-monitor: could not get a token: %s", err)}
+	}
+	providerID, err := p.ProviderID(ctx, nodeName)
+	if err != nil {
+		return
+	}
+	resource, filter, err := azureResource(providerID)
+	if err != nil {
+		return nil, fmt.Errorf("azure-monitor: node %s: %s", nodeName, err)
+	}
+
+	for _, name := range metricNames {
+		metric, ok := p.Metrics[name]
+		if !ok {
+			metric = AzureMetric{Name: name}
+		}
+		value, err := p.metric(ctx, token, resource, filter, metric)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// Returns the resource of the metrics of a provider id, and the filter of the instance for the
+// scale sets: azure:///subscriptions/S/resourceGroups/G/providers/Microsoft.Compute/virtualMachineScaleSets/aks-pool-vmss/virtualMachines/3
+// is the instance aks-pool-vmss_3 of the scale set
+func azureResource(providerID string) (resource, filter string, err error) {
+	if !strings.HasPrefix(providerID, "azure://") {
+		return "", "", fmt.Errorf("not an Azure virtual machine: %s", providerID)
+	}
+	resource = strings.TrimPrefix(providerID, "azure://")
+	parts := strings.Split(resource, "/")
+	if n := len(parts); n > 4 && strings.EqualFold(parts[n-4], "virtualMachineScaleSets") && strings.EqualFold(parts[n-2], "virtualMachines") {
+		resource = strings.Join(parts[:n-2], "/")
+		filter = fmt.Sprintf("VMName eq '%s_%s'", parts[n-3], parts[n-1])
+	}
+	return
+}
+
+// Returns the newest value of the metric in the window
+func (p *AzureMonitorProvider) metric(ctx context.Context, token, resource, filter string, metric AzureMetric) (value float64, err error) {
+	window := p.Window
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+	aggregation := metric.Aggregation
+	if aggregation == "" {
+		aggregation = "Average"
+	}
+	now := time.Now().UTC()
+
+	values := url.Values{}
+	values.Set("api-version", "2018-01-01")
+	values.Set("metricnames", metric.Name)
+	values.Set("timespan", now.Add(-window).Format(time.RFC3339)+"/"+now.Format(time.RFC3339))
+	values.Set("interval", "PT1M")
+	values.Set("aggregation", aggregation)
+	if metric.Namespace != "" {
+		values.Set("metricnamespace", metric.Namespace)
+	}
+	if filter != "" {
+		values.Set("$filter", filter)
+	}
+	request, err := http.NewRequestWithContext(ctx, "GET", azureManagementURL+resource+"/providers/microsoft.insights/metrics?"+values.Encode(), nil)
+	if err != nil {
+		return
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, TransientError{err}
+	}
+	defer response.Body.Close()
+	if err = statusError("azure-monitor", response); err != nil {
+		return
+	}
+
+	var result struct {
+		Value []struct {
+			Timeseries []struct {
+				Data []map[string]interface{} `json:"data"`
+			} `json:"timeseries"`
+		} `json:"value"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return
+	}
+	// The datapoints are sorted by time, the minutes without data have no aggregation
+	key := strings.ToLower(aggregation)
+	for _, series := range result.Value {
+		for _, timeseries := range series.Timeseries {
+			for i := len(timeseries.Data) - 1; i >= 0; i-- {
+				if value, ok := timeseries.Data[i][key].(float64); ok {
+					return value, nil
+				}
+			}
+		}
+	}
+	return 0, NoDataFound
+}
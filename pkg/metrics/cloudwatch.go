@@ -0,0 +1,226 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CloudWatchProvider reads the metrics of the EC2 instances of the nodes from CloudWatch, the
+// instance being the last part of the provider id of the node
+type CloudWatchProvider struct {
+	// Region of the api, AWS_REGION or the region of the instance metadata if empty
+	Region string
+	// Metrics by name, the others are the AWS/EC2 metric of that name, like CPUUtilization
+	Metrics map[string]CloudWatchMetric
+	// Window the datapoints are combined over, 5m if 0
+	Window time.Duration
+	// ProviderID returns the cloud provider id of a node, aws:///us-east-1a/i-0abc
+	ProviderID func(ctx context.Context, nodeName string) (string, error)
+	// Hostname returns the host name of a node, the short host name if nil
+	Hostname HostnameFunc
+	// Credentials return the credentials signing the requests for a region
+	Credentials func(ctx context.Context, region string) (AWSCredentials, error)
+	// Client of the requests, http.DefaultClient if nil
+	Client *http.Client
+
+	regionMutex sync.Mutex
+	region      string
+}
+
+// CloudWatchMetric is a CloudWatch metric: the CWAgent metrics like mem_used_percent set the
+// Namespace, and the Dimensions, templates with {{.Node}} and {{.Hostname}}, they are published
+// with besides InstanceId. Statistic is Average, Maximum, Minimum, Sum or SampleCount.
+type CloudWatchMetric struct {
+	Namespace  string
+	MetricName string
+	Statistic  string
+	Dimensions map[string]string
+}
+
+func (p *CloudWatchProvider) Name() string {
+	return "cloudwatch"
+}
+
+func (p *CloudWatchProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	region, err := p.regionName(ctx)
+	if err != nil {
+		return nil, TransientError{fmt.Errorf("cloudwatch: could not find the region: %s", err)}
+	}
+	credentials, err := p.Credentials(ctx, region)
+	if err != nil {
+		return nil, TransientError{fmt.Errorf("cloudwatch: could not get the credentials: %s", err)}
+	}
+	providerID, err := p.ProviderID(ctx, nodeName)
+	if err != nil {
+		return
+	}
+	if !strings.HasPrefix(providerID, "aws://") {
+		return nil, fmt.Errorf("cloudwatch: node %s is not an EC2 instance: %s", nodeName, providerID)
+	}
+	instance := providerID[strings.LastIndex(providerID, "/")+1:]
+	host, err := hostname(ctx, p.Hostname, nodeName)
+	if err != nil {
+		return
+	}
+
+	for _, name := range metricNames {
+		metric, ok := p.Metrics[name]
+		if !ok {
+			metric = CloudWatchMetric{MetricName: name}
+		}
+		dimensions := map[string]string{"InstanceId": instance}
+		for key, text := range metric.Dimensions {
+			if dimensions[key], err = renderQuery(text, nodeName, host); err != nil {
+				return nil, err
+			}
+		}
+		value, err := p.statistic(ctx, region, credentials, metric, dimensions)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// Returns the region of the configuration, of the environment or of the instance metadata read once
+func (p *CloudWatchProvider) regionName(ctx context.Context) (string, error) {
+	for _, region := range []string{p.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")} {
+		if region != "" {
+			return region, nil
+		}
+	}
+	p.regionMutex.Lock()
+	defer p.regionMutex.Unlock()
+	if p.region == "" {
+		region, err := awsMetadata(ctx, p.client(), "meta-data/placement/region")
+		if err != nil {
+			return "", err
+		}
+		p.region = strings.TrimSpace(region)
+	}
+	return p.region, nil
+}
+
+func (p *CloudWatchProvider) client() *http.Client {
+	if p.Client == nil {
+		return http.DefaultClient
+	}
+	return p.Client
+}
+
+// Returns the statistic of the metric over the window, in a single period
+func (p *CloudWatchProvider) statistic(ctx context.Context, region string, credentials AWSCredentials, metric CloudWatchMetric, dimensions map[string]string) (value float64, err error) {
+	window := p.Window
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+	// The periods are multiples of 60 seconds
+	period := (int(window.Seconds()) + 59) / 60 * 60
+	namespace, statistic := metric.Namespace, metric.Statistic
+	if namespace == "" {
+		namespace = "AWS/EC2"
+	}
+	if statistic == "" {
+		statistic = "Average"
+	}
+	now := time.Now()
+
+	form := url.Values{}
+	form.Set("Action", "GetMetricStatistics")
+	form.Set("Version", "2010-08-01")
+	form.Set("Namespace", namespace)
+	form.Set("MetricName", metric.MetricName)
+	form.Set("StartTime", now.Add(-time.Duration(period)*time.Second).UTC().Format(time.RFC3339))
+	form.Set("EndTime", now.UTC().Format(time.RFC3339))
+	form.Set("Period", strconv.Itoa(period))
+	form.Set("Statistics.member.1", statistic)
+	member := 1
+	for key, dimension := range dimensions {
+		form.Set(fmt.Sprintf("Dimensions.member.%d.Name", member), key)
+		form.Set(fmt.Sprintf("Dimensions.member.%d.Value", member), dimension)
+		member++
+	}
+	body := []byte(form.Encode())
+
+	request, err := http.NewRequestWithContext(ctx, "POST", "https://monitoring."+region+".amazonaws.com/", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signAWS(request, body, credentials, region, "monitoring", now)
+
+	response, err := p.client().Do(request)
+	if err != nil {
+		return 0, TransientError{err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode == 400 {
+		// The throttled requests are answered with a 400 and the Throttling code
+		var failure struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		xml.NewDecoder(response.Body).Decode(&failure)
+		err = fmt.Errorf("cloudwatch: %s: %s", failure.Code, failure.Message)
+		if failure.Code == "Throttling" {
+			err = TransientError{err}
+		}
+		return 0, err
+	}
+	if err = statusError("cloudwatch", response); err != nil {
+		return
+	}
+
+	var result struct {
+		Datapoints []struct {
+			Timestamp   time.Time
+			Average     *float64
+			Maximum     *float64
+			Minimum     *float64
+			Sum         *float64
+			SampleCount *float64
+		} `xml:"GetMetricStatisticsResult>Datapoints>member"`
+	}
+	if err = xml.NewDecoder(response.Body).Decode(&result); err != nil {
+		return
+	}
+	// The datapoints are not sorted, the newest one is used
+	var newest time.Time
+	found := false
+	for _, point := range result.Datapoints {
+		values := map[string]*float64{"Average": point.Average, "Maximum": point.Maximum, "Minimum": point.Minimum, "Sum": point.Sum, "SampleCount": point.SampleCount}
+		if v := values[statistic]; v != nil && (!found || point.Timestamp.After(newest)) {
+			value, newest, found = *v, point.Timestamp, true
+		}
+	}
+	if !found {
+		return 0, NoDataFound
+	}
+	return value, nil
+}
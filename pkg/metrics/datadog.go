@@ -0,0 +1,167 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// DatadogProvider reads the node metrics from the Datadog timeseries query api
+type DatadogProvider struct {
+	// Site of the Datadog account, "datadoghq.com" if empty
+	Site string
+	// Queries indexed by metric name. They are templates where {{.Node}} is the node name
+	// and {{.Hostname}} the host name. Metrics without query use "avg:<metric>{host:{{.Node}}}".
+	Queries map[string]string
+	// Hostname returns the host name of a node, the short host name if nil
+	Hostname HostnameFunc
+	// Window of the query, the last point of the series is used
+	Window time.Duration
+	// Keys returns the api and application keys
+	Keys func(ctx context.Context) (apiKey, appKey string, err error)
+}
+
+// Fields available in the query templates
+type queryTemplateData struct {
+	Node     string
+	Hostname string
+	// InternalIP of the node, only in the scrape URLs
+	Address string
+}
+
+func (p *DatadogProvider) Name() string {
+	return "datadog"
+}
+
+func (p *DatadogProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	apiKey, appKey, err := p.Keys(ctx)
+	if err != nil {
+		return nil, TransientError{fmt.Errorf("datadog: could not read the keys: %s", err)}
+	}
+
+	host, err := hostname(ctx, p.Hostname, nodeName)
+	if err != nil {
+		return
+	}
+	for _, name := range metricNames {
+		query, err := p.query(name, nodeName, host)
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.request(ctx, apiKey, appKey, query)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// Renders the query of a metric for a node
+func (p *DatadogProvider) query(metricName, nodeName, host string) (string, error) {
+	text, ok := p.Queries[metricName]
+	if !ok {
+		text = "avg:" + metricName + "{host:{{.Node}}}"
+	}
+	return renderQuery(text, nodeName, host)
+}
+
+// Requests a query and returns the last point of the first series
+func (p *DatadogProvider) request(ctx context.Context, apiKey, appKey, query string) (value float64, err error) {
+	site := p.Site
+	if site == "" {
+		site = "datadoghq.com"
+	}
+	window := p.Window
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+
+	now := time.Now()
+	values := url.Values{}
+	values.Set("from", strconv.FormatInt(now.Add(-window).Unix(), 10))
+	values.Set("to", strconv.FormatInt(now.Unix(), 10))
+	values.Set("query", query)
+
+	request, err := http.NewRequestWithContext(ctx, "GET", "https://api."+site+"/api/v1/query?"+values.Encode(), nil)
+	if err != nil {
+		return
+	}
+	request.Header.Add("DD-API-KEY", apiKey)
+	request.Header.Add("DD-APPLICATION-KEY", appKey)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return 0, TransientError{err}
+	}
+	defer response.Body.Close()
+
+	if err = statusError("datadog", response); err != nil {
+		return
+	}
+
+	var result struct {
+		Series []struct {
+			PointList [][]*float64 `json:"pointlist"`
+		} `json:"series"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return
+	}
+
+	if len(result.Series) == 0 {
+		return 0, NoDataFound
+	}
+	points := result.Series[0].PointList
+	for i := len(points) - 1; i >= 0; i-- {
+		if len(points[i]) == 2 && points[i][1] != nil {
+			return *points[i][1], nil
+		}
+	}
+	return 0, NoDataFound
+}
+
+// Renders a query template for a node and its host name
+func renderQuery(text, nodeName, host string) (string, error) {
+	tmpl, err := template.New("query").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid query template %q: %s", text, err)
+	}
+	query := bytes.Buffer{}
+	err = tmpl.Execute(&query, queryTemplateData{Node: nodeName, Hostname: host})
+	return query.String(), err
+}
+
+// Returns an error for the non 2xx responses, transient for 429 and 5xx
+func statusError(provider string, response *http.Response) error {
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	err := fmt.Errorf("%s: response %s", provider, response.Status)
+	if response.StatusCode == 429 || response.StatusCode >= 500 {
+		return TransientError{err}
+	}
+	return err
+}
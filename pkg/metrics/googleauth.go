@@ -0,0 +1,201 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	googleMetadataURL     = "http://metadata.google.internal/computeMetadata/v1/"
+	googleMonitoringScope = "https://www.googleapis.com/auth/monitoring.read"
+)
+
+// Returns the access tokens of the service account key file, or of GOOGLE_APPLICATION_CREDENTIALS
+// if empty. Without any, the tokens come from the metadata server: the Kubernetes service account
+// bound with workload identity on GKE, or the service account of the instance.
+func GoogleToken(credentialsFile string, client *http.Client) func(ctx context.Context) (string, error) {
+	if credentialsFile == "" {
+		credentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	source := &googleTokenSource{credentialsFile: credentialsFile, client: client}
+	return source.token
+}
+
+// Caches an access token until shortly before it expires
+type googleTokenSource struct {
+	credentialsFile string
+	client          *http.Client
+
+	mutex   sync.Mutex
+	cached  string
+	expires time.Time
+}
+
+type googleTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func (s *googleTokenSource) token(ctx context.Context) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cached != "" && time.Now().Before(s.expires) {
+		return s.cached, nil
+	}
+
+	var response googleTokenResponse
+	var err error
+	if s.credentialsFile != "" {
+		response, err = s.serviceAccountToken(ctx)
+	} else {
+		var data []byte
+		if data, err = googleMetadata(ctx, s.client, "instance/service-accounts/default/token"); err == nil {
+			err = json.Unmarshal(data, &response)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if response.AccessToken == "" {
+		return "", fmt.Errorf("no access token in the response")
+	}
+	s.cached = response.AccessToken
+	// Renewed a minute early, so a token does not expire during a request
+	s.expires = time.Now().Add(time.Duration(response.ExpiresIn)*time.Second - time.Minute)
+	return s.cached, nil
+}
+
+// Exchanges a JWT signed with the service account key for an access token
+func (s *googleTokenSource) serviceAccountToken(ctx context.Context) (response googleTokenResponse, err error) {
+	data, err := ioutil.ReadFile(s.credentialsFile)
+	if err != nil {
+		return
+	}
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err = json.Unmarshal(data, &key); err != nil {
+		return response, fmt.Errorf("%s: %s", s.credentialsFile, err)
+	}
+	if key.Type != "service_account" {
+		return response, fmt.Errorf("%s: credentials of type %q, not service_account", s.credentialsFile, key.Type)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	assertion, err := signJWT(key.PrivateKey, map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": googleMonitoringScope,
+		"aud":   key.TokenURI,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return response, fmt.Errorf("%s: %s", s.credentialsFile, err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	request, err := http.NewRequestWithContext(ctx, "POST", key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	answer, err := s.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer answer.Body.Close()
+	if err = statusError("google-cloud token", answer); err != nil {
+		return
+	}
+	err = json.NewDecoder(answer.Body).Decode(&response)
+	return
+}
+
+// Returns a JWT with the claims signed with RS256 by the PEM private key
+func signJWT(privateKey string, claims map[string]interface{}) (string, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return "", fmt.Errorf("invalid private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("invalid private key: %s", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key is not RSA")
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + encoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + encoding.EncodeToString(signature), nil
+}
+
+// Reads a path of the metadata server
+func googleMetadata(ctx context.Context, client *http.Client, path string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", googleMetadataURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Metadata-Flavor", "Google")
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("metadata server: %s", err)
+	}
+	defer response.Body.Close()
+	if err := statusError("metadata server", response); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(response.Body)
+}
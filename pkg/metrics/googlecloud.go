@@ -0,0 +1,234 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GoogleCloudProvider reads the node metrics from Google Cloud Monitoring, with an MQL query or
+// the time series of the metric type filtered on the node
+type GoogleCloudProvider struct {
+	// Project the metrics are read from, the project of the metadata server if empty
+	Project string
+	// MQL queries indexed by metric name, templates with {{.Node}} and {{.Hostname}}. The other
+	// metrics are metric types, like kubernetes.io/node/cpu/allocatable_utilization, read with Filter.
+	Queries map[string]string
+	// Filter of the time series of the node, a template with {{.Node}} and {{.Hostname}},
+	// resource.type="k8s_node" AND resource.labels.node_name="{{.Node}}" if empty
+	Filter string
+	// Window the time series are averaged over, 5m if 0
+	Window time.Duration
+	// Hostname returns the host name of a node, the short host name if nil
+	Hostname HostnameFunc
+	// Token returns the OAuth2 access token of the requests
+	Token func(ctx context.Context) (string, error)
+	// Client of the requests, http.DefaultClient if nil
+	Client *http.Client
+
+	projectMutex sync.Mutex
+	project      string
+}
+
+const (
+	googleMonitoringURL = "https://monitoring.googleapis.com/v3/projects/"
+	googleDefaultFilter = `resource.type="k8s_node" AND resource.labels.node_name="{{.Node}}"`
+)
+
+func (p *GoogleCloudProvider) Name() string {
+	return "google-cloud"
+}
+
+func (p *GoogleCloudProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	project, err := p.projectID(ctx)
+	if err != nil {
+		return nil, TransientError{fmt.Errorf("google-cloud: could not find the project: %s", err)}
+	}
+	token, err := p.Token(ctx)
+	if err != nil {
+		return nil, TransientError{fmt.Errorf("google-cloud: could not get a token: %s", err)}
+	}
+	host, err := hostname(ctx, p.Hostname, nodeName)
+	if err != nil {
+		return
+	}
+
+	for _, name := range metricNames {
+		var value float64
+		if query, ok := p.Queries[name]; ok {
+			if query, err = renderQuery(query, nodeName, host); err != nil {
+				return nil, err
+			}
+			value, err = p.query(ctx, project, token, query)
+		} else {
+			filter := p.Filter
+			if filter == "" {
+				filter = googleDefaultFilter
+			}
+			if filter, err = renderQuery(filter, nodeName, host); err != nil {
+				return nil, err
+			}
+			value, err = p.listTimeSeries(ctx, project, token, fmt.Sprintf("metric.type=%q AND %s", name, filter))
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// Returns the project of the configuration, or the one of the metadata server read once
+func (p *GoogleCloudProvider) projectID(ctx context.Context) (string, error) {
+	if p.Project != "" {
+		return p.Project, nil
+	}
+	p.projectMutex.Lock()
+	defer p.projectMutex.Unlock()
+	if p.project == "" {
+		project, err := googleMetadata(ctx, p.client(), "project/project-id")
+		if err != nil {
+			return "", err
+		}
+		p.project = string(project)
+	}
+	return p.project, nil
+}
+
+func (p *GoogleCloudProvider) window() time.Duration {
+	if p.Window <= 0 {
+		return 5 * time.Minute
+	}
+	return p.Window
+}
+
+func (p *GoogleCloudProvider) client() *http.Client {
+	if p.Client == nil {
+		return http.DefaultClient
+	}
+	return p.Client
+}
+
+// A point value of the monitoring api, int64 values are strings
+type googlePointValue struct {
+	DoubleValue *float64 `json:"doubleValue"`
+	Int64Value  *string  `json:"int64Value"`
+}
+
+// Returns the value of the point, false if it has none
+func (v googlePointValue) float() (float64, bool) {
+	if v.DoubleValue != nil {
+		return *v.DoubleValue, true
+	}
+	if v.Int64Value != nil {
+		value, err := strconv.ParseInt(*v.Int64Value, 10, 64)
+		return float64(value), err == nil
+	}
+	return 0, false
+}
+
+// Lists the time series of the filter over the window, averaged into one point, and returns it
+func (p *GoogleCloudProvider) listTimeSeries(ctx context.Context, project, token, filter string) (value float64, err error) {
+	now := time.Now()
+	window := p.window()
+	values := url.Values{}
+	values.Set("filter", filter)
+	values.Set("interval.startTime", now.Add(-window).UTC().Format(time.RFC3339))
+	values.Set("interval.endTime", now.UTC().Format(time.RFC3339))
+	values.Set("aggregation.alignmentPeriod", strconv.Itoa(int(window.Seconds()))+"s")
+	values.Set("aggregation.perSeriesAligner", "ALIGN_MEAN")
+	values.Set("aggregation.crossSeriesReducer", "REDUCE_MEAN")
+
+	request, err := http.NewRequestWithContext(ctx, "GET", googleMonitoringURL+project+"/timeSeries?"+values.Encode(), nil)
+	if err != nil {
+		return
+	}
+	var result struct {
+		TimeSeries []struct {
+			Points []struct {
+				Value googlePointValue `json:"value"`
+			} `json:"points"`
+		} `json:"timeSeries"`
+	}
+	if err = p.do(request, token, &result); err != nil {
+		return
+	}
+	// The newest point first
+	for _, series := range result.TimeSeries {
+		for _, point := range series.Points {
+			if value, ok := point.Value.float(); ok {
+				return value, nil
+			}
+		}
+	}
+	return 0, NoDataFound
+}
+
+// Runs an MQL query and returns the newest value of its first time series
+func (p *GoogleCloudProvider) query(ctx context.Context, project, token, query string) (value float64, err error) {
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", googleMonitoringURL+project+"/timeSeries:query", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	var result struct {
+		TimeSeriesData []struct {
+			PointData []struct {
+				Values []googlePointValue `json:"values"`
+			} `json:"pointData"`
+		} `json:"timeSeriesData"`
+	}
+	if err = p.do(request, token, &result); err != nil {
+		return
+	}
+	for _, series := range result.TimeSeriesData {
+		for _, point := range series.PointData {
+			if len(point.Values) > 0 {
+				if value, ok := point.Values[0].float(); ok {
+					return value, nil
+				}
+			}
+		}
+	}
+	return 0, NoDataFound
+}
+
+// Sends the request with the token and decodes its answer into result
+func (p *GoogleCloudProvider) do(request *http.Request, token string, result interface{}) error {
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := p.client().Do(request)
+	if err != nil {
+		return TransientError{err}
+	}
+	defer response.Body.Close()
+	if err := statusError("google-cloud", response); err != nil {
+		return err
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
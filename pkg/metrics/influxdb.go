@@ -0,0 +1,219 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// InfluxDBProvider reads the node metrics from InfluxDB, with InfluxQL (v1) or Flux (v2) queries
+type InfluxDBProvider struct {
+	// URL of the InfluxDB server
+	URL string
+	// Version of the api, 1 (InfluxQL) or 2 (Flux)
+	Version int
+	// Database of the v1 queries
+	Database string
+	// Organization of the v2 queries
+	Org string
+	// Queries indexed by metric name, templates where {{.Node}} is the node name and
+	// {{.Hostname}} the host name. The last value returned is used.
+	Queries map[string]string
+	// Hostname returns the host name of a node, the short host name if nil
+	Hostname HostnameFunc
+	// Credentials returns the token (v2), or the user and password (v1). Nil for no authentication.
+	Credentials func(ctx context.Context) ([]string, error)
+	// Client makes the queries, http.DefaultClient if nil
+	Client *http.Client
+}
+
+func (p *InfluxDBProvider) Name() string {
+	return "influxdb"
+}
+
+func (p *InfluxDBProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	var credentials []string
+	if p.Credentials != nil {
+		credentials, err = p.Credentials(ctx)
+		if err != nil {
+			return nil, TransientError{fmt.Errorf("influxdb: could not read the credentials: %s", err)}
+		}
+	}
+
+	host, err := hostname(ctx, p.Hostname, nodeName)
+	if err != nil {
+		return
+	}
+	for _, name := range metricNames {
+		text, ok := p.Queries[name]
+		if !ok {
+			return nil, fmt.Errorf("influxdb: no query for metric %q", name)
+		}
+		query, err := renderQuery(text, nodeName, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var value float64
+		if p.Version == 2 {
+			value, err = p.flux(ctx, credentials, query)
+		} else {
+			value, err = p.influxQL(ctx, credentials, query)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// Runs an InfluxQL query with the v1 api and returns the last value of the first series
+func (p *InfluxDBProvider) influxQL(ctx context.Context, credentials []string, query string) (value float64, err error) {
+	values := url.Values{}
+	values.Set("db", p.Database)
+	values.Set("q", query)
+	if len(credentials) == 2 {
+		values.Set("u", credentials[0])
+		values.Set("p", credentials[1])
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(p.URL, "/")+"/query?"+values.Encode(), nil)
+	if err != nil {
+		return
+	}
+	response, err := p.client().Do(request)
+	if err != nil {
+		return 0, TransientError{err}
+	}
+	defer response.Body.Close()
+
+	if err = statusError("influxdb", response); err != nil {
+		return
+	}
+
+	var result struct {
+		Results []struct {
+			Error  string `json:"error"`
+			Series []struct {
+				Values [][]interface{} `json:"values"`
+			} `json:"series"`
+		} `json:"results"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return
+	}
+
+	if len(result.Results) == 0 {
+		return 0, NoDataFound
+	}
+	if result.Results[0].Error != "" {
+		return 0, fmt.Errorf("influxdb: %s", result.Results[0].Error)
+	}
+	if len(result.Results[0].Series) == 0 {
+		return 0, NoDataFound
+	}
+	rows := result.Results[0].Series[0].Values
+	for i := len(rows) - 1; i >= 0; i-- {
+		// The first column is the time
+		if len(rows[i]) > 1 {
+			if number, ok := rows[i][1].(float64); ok {
+				return number, nil
+			}
+		}
+	}
+	return 0, NoDataFound
+}
+
+// Runs a Flux query with the v2 api and returns the last _value of the result
+func (p *InfluxDBProvider) flux(ctx context.Context, credentials []string, query string) (value float64, err error) {
+	values := url.Values{}
+	values.Set("org", p.Org)
+
+	request, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(p.URL, "/")+"/api/v2/query?"+values.Encode(), strings.NewReader(query))
+	if err != nil {
+		return
+	}
+	request.Header.Add("Content-Type", "application/vnd.flux")
+	request.Header.Add("Accept", "application/csv")
+	if len(credentials) > 0 {
+		request.Header.Add("Authorization", "Token "+credentials[0])
+	}
+
+	response, err := p.client().Do(request)
+	if err != nil {
+		return 0, TransientError{err}
+	}
+	defer response.Body.Close()
+
+	if err = statusError("influxdb", response); err != nil {
+		return
+	}
+
+	reader := csv.NewReader(response.Body)
+	reader.FieldsPerRecord = -1
+	valueColumn := -1
+	found := false
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		// Every table of the result starts with a header row
+		if header := columnIndex(record, "_value"); header >= 0 {
+			valueColumn = header
+			continue
+		}
+		if valueColumn < 0 || valueColumn >= len(record) {
+			continue
+		}
+		if number, err := strconv.ParseFloat(record[valueColumn], 64); err == nil {
+			value, found = number, true
+		}
+	}
+	if !found {
+		return 0, NoDataFound
+	}
+	return value, nil
+}
+
+func columnIndex(record []string, column string) int {
+	for i, name := range record {
+		if name == column {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *InfluxDBProvider) client() *http.Client {
+	if p.Client == nil {
+		return http.DefaultClient
+	}
+	return p.Client
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Metric names understood by the Kubernetes providers, named after their Sysdig counterparts
+const (
+	CPUUsedPercent    = "cpu.used.percent"
+	CPUCoresUsed      = "cpu.cores.used"
+	MemoryUsedPercent = "memory.used.percent"
+	MemoryBytesUsed   = "memory.bytes.used"
+	FsUsedPercent     = "fs.used.percent"
+)
+
+// MetricsServerProvider reads the node usage from the metrics.k8s.io api (metrics-server)
+type MetricsServerProvider struct {
+	Kube *kubernetes.KubernetesCoreV1Api
+}
+
+func (p *MetricsServerProvider) Name() string {
+	return "metrics-server"
+}
+
+func (p *MetricsServerProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	nodeMetrics, err := p.Kube.GetNodeMetrics(ctx, nodeName)
+	if err != nil {
+		return nil, kubeError(err)
+	}
+	cpu, err := kubernetes.ParseQuantity(nodeMetrics.Usage["cpu"])
+	if err != nil {
+		return nil, NoDataFound
+	}
+	memory, err := kubernetes.ParseQuantity(nodeMetrics.Usage["memory"])
+	if err != nil {
+		return nil, NoDataFound
+	}
+	capacity, err := nodeCapacity(ctx, p.Kube, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := map[string]float64{
+		CPUCoresUsed:      cpu,
+		CPUUsedPercent:    percent(cpu, capacity["cpu"]),
+		MemoryBytesUsed:   memory,
+		MemoryUsedPercent: percent(memory, capacity["memory"]),
+	}
+	return pick(p.Name(), usage, metricNames)
+}
+
+// KubeletSummaryProvider reads the node usage from the kubelet stats summary api
+type KubeletSummaryProvider struct {
+	Kube *kubernetes.KubernetesCoreV1Api
+}
+
+func (p *KubeletSummaryProvider) Name() string {
+	return "kubelet-summary"
+}
+
+func (p *KubeletSummaryProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	summary, err := p.Kube.GetNodeSummary(ctx, nodeName)
+	if err != nil {
+		return nil, kubeError(err)
+	}
+	capacity, err := nodeCapacity(ctx, p.Kube, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	cpu := summary.Node.CPU.UsageNanoCores / 1e9
+	memory := summary.Node.Memory.WorkingSetBytes
+	usage := map[string]float64{
+		CPUCoresUsed:      cpu,
+		CPUUsedPercent:    percent(cpu, capacity["cpu"]),
+		MemoryBytesUsed:   memory,
+		MemoryUsedPercent: percent(memory, capacity["memory"]),
+		FsUsedPercent:     percent(summary.Node.Fs.UsedBytes, summary.Node.Fs.CapacityBytes),
+	}
+	return pick(p.Name(), usage, metricNames)
+}
+
+// CustomMetricsProvider reads node metrics from the custom.metrics.k8s.io api, so the backends exposed
+// through an adapter (Prometheus adapter, KEDA, Stackdriver) can be used. The metric names are the
+// names of the adapter, one request is made for every metric.
+type CustomMetricsProvider struct {
+	Kube *kubernetes.KubernetesCoreV1Api
+}
+
+func (p *CustomMetricsProvider) Name() string {
+	return "custom-metrics"
+}
+
+func (p *CustomMetricsProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	for _, name := range metricNames {
+		metricValues, err := p.Kube.GetNodeCustomMetric(ctx, nodeName, name)
+		if err != nil {
+			return nil, kubeError(err)
+		}
+		if len(metricValues) == 0 {
+			return nil, NoDataFound
+		}
+		value, err := kubernetes.ParseQuantity(metricValues[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: metric %s of node %s: %s", p.Name(), name, nodeName, err)
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// Returns the cpu (cores) and memory (bytes) capacity of a node
+func nodeCapacity(ctx context.Context, kube *kubernetes.KubernetesCoreV1Api, nodeName string) (capacity map[string]float64, err error) {
+	nodes, err := kube.ListNodes(ctx)
+	if err != nil {
+		return nil, TransientError{err}
+	}
+	for _, node := range nodes {
+		if node.Metadata.Name != nodeName {
+			continue
+		}
+		capacity = map[string]float64{}
+		for _, resource := range []string{"cpu", "memory"} {
+			if value, err := kubernetes.ParseQuantity(node.Status.Capacity[resource]); err == nil {
+				capacity[resource] = value
+			}
+		}
+		return capacity, nil
+	}
+	return nil, NoDataFound
+}
+
+// Marks the api server errors worth retrying as transient
+func kubeError(err error) error {
+	if statusError, ok := err.(*kubernetes.StatusError); ok {
+		if statusError.Code == 404 {
+			return NoDataFound
+		}
+		if statusError.Code != 429 && statusError.Code < 500 {
+			return err
+		}
+	}
+	return TransientError{err}
+}
+
+// Returns the values of the requested metrics in order
+func pick(provider string, available map[string]float64, metricNames []string) (values []float64, err error) {
+	for _, name := range metricNames {
+		value, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported metric %q", provider, name)
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+func percent(value, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return value / total * 100
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Metric providers the scheduler can score the nodes with
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var NoDataFound = errors.New("no data found with those parameters")
+
+// BatchUnsupported is returned by a BatchProvider that can't read several nodes in one request
+var BatchUnsupported = errors.New("the metrics of several nodes can't be read in one request")
+
+// Provider retrieves the current value of node metrics from a monitoring backend
+type Provider interface {
+	// Name of the provider, used in logs
+	Name() string
+	// NodeMetrics returns the values of the metrics for a node, in the same order as the names
+	NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error)
+}
+
+// NamespaceProvider is a Provider that can also read the metrics of the containers of a namespace on a node
+type NamespaceProvider interface {
+	Provider
+	NamespaceMetrics(ctx context.Context, nodeName, namespace string, metricNames []string) (values []float64, err error)
+}
+
+// ScopedProvider is a Provider that can also read the metrics of the containers on a node matching
+// a scope, the values of backend labels like kubernetes.namespace.name or kubernetes.pod.label.app
+type ScopedProvider interface {
+	Provider
+	ScopedMetrics(ctx context.Context, nodeName string, scope map[string]string, metricNames []string) (values []float64, err error)
+}
+
+// BatchProvider is a Provider that can also read the metrics of several nodes in one request
+type BatchProvider interface {
+	Provider
+	// NodesMetrics returns the values of the metrics for the nodes found, in the same order as the
+	// names, or BatchUnsupported if the provider can't read them together as configured
+	NodesMetrics(ctx context.Context, nodeNames []string, metricNames []string) (values map[string][]float64, err error)
+}
+
+// SeriesProvider is a Provider that can also read the datapoints of node metrics over a window
+type SeriesProvider interface {
+	Provider
+	// NodeSeries returns the datapoints of every metric over the window, one every sampling
+	NodeSeries(ctx context.Context, nodeName string, metricNames []string, window, sampling time.Duration) (series [][]float64, err error)
+}
+
+// HostnameFunc returns the host name a monitoring backend knows a node by
+type HostnameFunc func(ctx context.Context, nodeName string) (string, error)
+
+// ShortHostname returns the node name up to the first dot, the default host name
+func ShortHostname(ctx context.Context, nodeName string) (string, error) {
+	return strings.Split(nodeName, ".")[0], nil
+}
+
+// Returns the host name of the node with the function, the short host name if it is nil
+func hostname(ctx context.Context, fn HostnameFunc, nodeName string) (string, error) {
+	if fn == nil {
+		fn = ShortHostname
+	}
+	return fn(ctx, nodeName)
+}
+
+// StaleDataError is returned when the newest datapoint of a node is older than the maximum age
+// of the provider, like when its agent is down or its host was renamed
+type StaleDataError struct {
+	Newest time.Time
+}
+
+func (e StaleDataError) Error() string {
+	return fmt.Sprintf("stale metrics, the newest datapoint is %s old", time.Since(e.Newest).Round(time.Second))
+}
+
+// TransientError marks a provider error that may succeed if the request is retried
+type TransientError struct {
+	Err error
+}
+
+func (e TransientError) Error() string {
+	return e.Err.Error()
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Results of the requests going through a ResponseCache
+const (
+	CacheHit         = "hit"
+	CacheRevalidated = "revalidated"
+	CacheMiss        = "miss"
+)
+
+// The answers with an ETag or a Last-Modified header are kept this many TTLs to revalidate them
+const revalidateTTLs = 10
+
+// ResponseCache is a RoundTripper answering the same request again from memory for TTL, while the
+// backend would answer the same datapoints. Past TTL the request is made again, conditional with
+// If-None-Match and If-Modified-Since if the answer had an ETag or a Last-Modified header, and a
+// 304 is answered with the body kept. Only the 200 answers are kept, by method, url, body and
+// Authorization header. Record, if set, is called with the result of every request.
+type ResponseCache struct {
+	Transport http.RoundTripper // http.DefaultTransport if nil
+	TTL       time.Duration
+	Record    func(result string)
+
+	mutex     sync.Mutex
+	responses map[string]*cachedResponse
+	swept     time.Time
+}
+
+type cachedResponse struct {
+	header http.Header
+	body   []byte
+	time   time.Time
+}
+
+func (c *ResponseCache) RoundTrip(request *http.Request) (*http.Response, error) {
+	key, err := cacheKey(request)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	cached, ok := c.responses[key]
+	c.mutex.Unlock()
+	if ok && time.Since(cached.time) < c.TTL {
+		c.record(CacheHit)
+		return cached.response(request), nil
+	}
+
+	if ok {
+		request = request.Clone(request.Context())
+		if etag := cached.header.Get("ETag"); etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.header.Get("Last-Modified"); modified != "" {
+			request.Header.Set("If-Modified-Since", modified)
+		}
+	}
+	response, err := c.transport().RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	if ok && response.StatusCode == http.StatusNotModified {
+		response.Body.Close()
+		c.store(key, &cachedResponse{header: cached.header, body: cached.body, time: time.Now()})
+		c.record(CacheRevalidated)
+		return cached.response(request), nil
+	}
+	c.record(CacheMiss)
+	if response.StatusCode != http.StatusOK {
+		return response, nil
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, &cachedResponse{header: response.Header, body: body, time: time.Now()})
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return response, nil
+}
+
+// Keeps the answer, and drops the ones too old to be used or revalidated at most once per TTL
+func (c *ResponseCache) store(key string, cached *cachedResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.responses == nil {
+		c.responses = map[string]*cachedResponse{}
+	}
+	c.responses[key] = cached
+	if time.Since(c.swept) < c.TTL {
+		return
+	}
+	c.swept = time.Now()
+	for key, response := range c.responses {
+		age := time.Since(response.time)
+		validated := response.header.Get("ETag") != "" || response.header.Get("Last-Modified") != ""
+		if age > revalidateTTLs*c.TTL || (age > c.TTL && !validated) {
+			delete(c.responses, key)
+		}
+	}
+}
+
+func (c *ResponseCache) record(result string) {
+	if c.Record != nil {
+		c.Record(result)
+	}
+}
+
+func (c *ResponseCache) transport() http.RoundTripper {
+	if c.Transport == nil {
+		return http.DefaultTransport
+	}
+	return c.Transport
+}
+
+// Returns a 200 answer to the request with the body kept
+func (c *cachedResponse) response(request *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(c.body)),
+		ContentLength: int64(len(c.body)),
+		Request:       request,
+	}
+}
+
+// Returns the key of the request, from its method, url, body and credentials. The body is read
+// and replaced.
+func cacheKey(request *http.Request) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.String() + "\n" + request.Header.Get("Authorization") + "\n"))
+	if request.Body != nil {
+		body, err := ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
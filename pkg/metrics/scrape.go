@@ -0,0 +1,367 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// ScrapeProvider scrapes the Prometheus endpoint of every node directly, like node_exporter or
+// the cadvisor endpoint of the kubelet, for the clusters where no monitoring backend is reachable
+type ScrapeProvider struct {
+	// URL of the endpoint of a node, a template where {{.Node}} is the node name, {{.Hostname}}
+	// the host name and {{.Address}} the InternalIP of the node
+	URL string
+	// Metrics indexed by metric name
+	Metrics map[string]ScrapeMetric
+	// Hostname returns the host name of a node, the short host name if nil
+	Hostname HostnameFunc
+	// Kube finds the addresses of the nodes
+	Kube *kubernetes.KubernetesCoreV1Api
+	// Client scrapes the endpoints, http.DefaultClient if nil
+	Client *http.Client
+	// Token returns the bearer token sent to the endpoints, nil for no authentication
+	Token func(ctx context.Context) (string, error)
+
+	mutex    sync.Mutex
+	previous map[string]map[string]scrapedCounter // Last counters indexed by node and metric name, for the rates
+}
+
+// ScrapeMetric maps a metric to the samples of a scraped one
+type ScrapeMetric struct {
+	// Sample is the name of the scraped metric, like node_load1
+	Sample string
+	// Labels the samples must have, like mode: idle
+	Labels map[string]string
+	// Aggregation of the matching samples: sum (the default), avg, min, max, p95 or stddev
+	Aggregation string
+	// Rate turns a counter into its increase per second since the previous scrape of the node
+	Rate bool
+	// Scale multiplies the value, 1 if 0
+	Scale float64
+}
+
+// A scraped sample, its name, labels and value
+type scrapedSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// Value of a counter before its scale, and when it was scraped
+type scrapedCounter struct {
+	value float64
+	time  time.Time
+}
+
+// Interval between the two scrapes of a node whose rates have no previous scrape
+const firstRateInterval = time.Second
+
+func (p *ScrapeProvider) Name() string {
+	return "scrape"
+}
+
+func (p *ScrapeProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	for _, name := range metricNames {
+		if _, ok := p.Metrics[name]; !ok {
+			return nil, fmt.Errorf("scrape: no mapping for metric %q", name)
+		}
+	}
+	endpoint, err := p.endpoint(ctx, nodeName)
+	if err != nil {
+		return
+	}
+
+	raw, now, err := p.scrape(ctx, endpoint, metricNames)
+	if err != nil {
+		return
+	}
+	previous := p.counters(nodeName)
+	if p.missingRates(metricNames, previous) {
+		// Without a previous scrape the counters are read again in a moment
+		for name, value := range raw {
+			previous[name] = scrapedCounter{value, now}
+		}
+		select {
+		case <-time.After(firstRateInterval):
+		case <-ctx.Done():
+			return nil, TransientError{ctx.Err()}
+		}
+		if raw, now, err = p.scrape(ctx, endpoint, metricNames); err != nil {
+			return
+		}
+	}
+	p.setCounters(nodeName, raw, now)
+
+	for _, name := range metricNames {
+		metric := p.Metrics[name]
+		value := raw[name]
+		if metric.Rate {
+			last := previous[name]
+			elapsed := now.Sub(last.time).Seconds()
+			if elapsed <= 0 || value < last.value {
+				// The counter was reset by a restart of the exporter
+				return nil, NoDataFound
+			}
+			value = (value - last.value) / elapsed
+		}
+		if metric.Scale != 0 {
+			value *= metric.Scale
+		}
+		values = append(values, value)
+	}
+	return
+}
+
+// Returns the URL of the endpoint of the node
+func (p *ScrapeProvider) endpoint(ctx context.Context, nodeName string) (string, error) {
+	host, err := hostname(ctx, p.Hostname, nodeName)
+	if err != nil {
+		return "", err
+	}
+	data := queryTemplateData{Node: nodeName, Hostname: host}
+	if strings.Contains(p.URL, ".Address") {
+		if data.Address, err = nodeAddress(ctx, p.Kube, nodeName); err != nil {
+			return "", err
+		}
+	}
+	tmpl, err := template.New("url").Parse(p.URL)
+	if err != nil {
+		return "", fmt.Errorf("scrape: invalid url template %q: %s", p.URL, err)
+	}
+	endpoint := bytes.Buffer{}
+	err = tmpl.Execute(&endpoint, data)
+	return endpoint.String(), err
+}
+
+// Scrapes the endpoint and returns the aggregated value of every metric before its rate and scale
+func (p *ScrapeProvider) scrape(ctx context.Context, endpoint string, metricNames []string) (values map[string]float64, now time.Time, err error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return
+	}
+	request.Header.Add("Accept", "text/plain")
+	if p.Token != nil {
+		token, err := p.Token(ctx)
+		if err != nil {
+			return nil, now, TransientError{fmt.Errorf("scrape: could not read the token: %s", err)}
+		}
+		request.Header.Add("Authorization", "Bearer "+token)
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, now, TransientError{err}
+	}
+	defer response.Body.Close()
+	now = time.Now()
+
+	if err = statusError("scrape", response); err != nil {
+		return
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range metricNames {
+		wanted[p.Metrics[name].Sample] = true
+	}
+	samples, err := parseSamples(response.Body, wanted)
+	if err != nil {
+		return nil, now, fmt.Errorf("scrape: %s: %s", endpoint, err)
+	}
+
+	values = map[string]float64{}
+	for _, name := range metricNames {
+		metric := p.Metrics[name]
+		var matching []float64
+		for _, sample := range samples {
+			if sample.name == metric.Sample && labelsMatch(sample.labels, metric.Labels) {
+				matching = append(matching, sample.value)
+			}
+		}
+		if len(matching) == 0 {
+			return nil, now, NoDataFound
+		}
+		aggregation := metric.Aggregation
+		if aggregation == "" {
+			aggregation = AggregationSum
+		}
+		values[name] = Aggregate(matching, aggregation)
+	}
+	return
+}
+
+// Returns true if a rate of the metrics has no previous counter
+func (p *ScrapeProvider) missingRates(metricNames []string, previous map[string]scrapedCounter) bool {
+	for _, name := range metricNames {
+		if _, found := previous[name]; p.Metrics[name].Rate && !found {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a copy of the last counters of the node
+func (p *ScrapeProvider) counters(nodeName string) map[string]scrapedCounter {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	counters := map[string]scrapedCounter{}
+	for name, counter := range p.previous[nodeName] {
+		counters[name] = counter
+	}
+	return counters
+}
+
+// Stores the counters of the rates of a scrape of the node
+func (p *ScrapeProvider) setCounters(nodeName string, values map[string]float64, now time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.previous == nil {
+		p.previous = map[string]map[string]scrapedCounter{}
+	}
+	if p.previous[nodeName] == nil {
+		p.previous[nodeName] = map[string]scrapedCounter{}
+	}
+	for name, value := range values {
+		if p.Metrics[name].Rate {
+			p.previous[nodeName][name] = scrapedCounter{value, now}
+		}
+	}
+}
+
+// Returns true if the labels have all the wanted values
+func labelsMatch(labels, wanted map[string]string) bool {
+	for name, value := range wanted {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Parses the samples of the wanted metrics in the Prometheus text format
+func parseSamples(reader io.Reader, wanted map[string]bool) (samples []scrapedSample, err error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		end := strings.IndexAny(line, "{ ")
+		if end < 0 || !wanted[line[:end]] {
+			continue
+		}
+		sample := scrapedSample{name: line[:end], labels: map[string]string{}}
+		rest := line[end:]
+		if rest[0] == '{' {
+			if rest, err = parseLabels(rest[1:], sample.labels); err != nil {
+				return nil, fmt.Errorf("metric %s: %s", sample.name, err)
+			}
+		}
+		// The timestamp after the value, if any, is ignored
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("metric %s has no value", sample.name)
+		}
+		if sample.value, err = strconv.ParseFloat(fields[0], 64); err != nil {
+			return nil, fmt.Errorf("metric %s: %s", sample.name, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+// Parses the labels up to the closing brace and returns what follows it
+func parseLabels(text string, labels map[string]string) (rest string, err error) {
+	for {
+		text = strings.TrimLeft(text, " ,")
+		if strings.HasPrefix(text, "}") {
+			return text[1:], nil
+		}
+		equal := strings.Index(text, "=")
+		if equal < 0 || len(text) < equal+2 || text[equal+1] != '"' {
+			return "", fmt.Errorf("invalid labels")
+		}
+		name := strings.TrimSpace(text[:equal])
+		value, end, escaped := strings.Builder{}, -1, false
+		for i, c := range text[equal+2:] {
+			if escaped {
+				if c == 'n' {
+					c = '\n'
+				}
+				value.WriteRune(c)
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				end = equal + 2 + i
+				break
+			} else {
+				value.WriteRune(c)
+			}
+		}
+		if end < 0 {
+			return "", fmt.Errorf("unterminated value of label %s", name)
+		}
+		labels[name] = value.String()
+		text = text[end+1:]
+	}
+}
+
+// Returns the InternalIP of a node
+func nodeAddress(ctx context.Context, kube *kubernetes.KubernetesCoreV1Api, nodeName string) (string, error) {
+	nodes, err := kube.ListNodes(ctx)
+	if err != nil {
+		return "", TransientError{err}
+	}
+	for _, node := range nodes {
+		if node.Metadata.Name != nodeName {
+			continue
+		}
+		for _, address := range node.Status.Addresses {
+			if address.Type == "InternalIP" {
+				return address.Address, nil
+			}
+		}
+		return "", fmt.Errorf("scrape: node %s has no InternalIP", nodeName)
+	}
+	return "", NoDataFound
+}
+
+// Reads a bearer token file every time, so the rotated service account tokens are seen
+func TokenFile(file string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		data, err := ioutil.ReadFile(file)
+		return strings.TrimSpace(string(data)), err
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"time"
+)
+
+// StaticProvider returns fixed values, indexed by node name and then metric name, for the tests
+// and the demos. The "*" node has the values of the nodes that are not listed.
+type StaticProvider struct {
+	Values map[string]map[string]float64
+}
+
+func (p *StaticProvider) Name() string {
+	return "static"
+}
+
+func (p *StaticProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	available, ok := p.Values[nodeName]
+	if !ok {
+		if available, ok = p.Values["*"]; !ok {
+			return nil, NoDataFound
+		}
+	}
+	return pick(p.Name(), available, metricNames)
+}
+
+// Returns a single datapoint of every value, they never change
+func (p *StaticProvider) NodeSeries(ctx context.Context, nodeName string, metricNames []string, window, sampling time.Duration) (series [][]float64, err error) {
+	values, err := p.NodeMetrics(ctx, nodeName, metricNames)
+	for _, value := range values {
+		series = append(series, []float64{value})
+	}
+	return
+}
@@ -0,0 +1,399 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/sysdig"
+)
+
+// Aggregations of the datapoints of a window
+const (
+	AggregationAvg    = "avg"
+	AggregationMin    = "min"
+	AggregationMax    = "max"
+	AggregationP95    = "p95"
+	AggregationLast   = "last"
+	AggregationSum    = "sum"
+	AggregationStdDev = "stddev"
+)
+
+// SysdigProvider reads the host metrics from Sysdig Monitor. The datapoints of the last Window
+// (60s if unset), one every Sampling (the whole window if unset), are combined with Aggregation
+// (avg if unset). If ClientFor is set it returns the client of the account the node reports to,
+// instead of Client.
+//
+// The request can be changed to read container or label scoped metrics: Filter is a template of
+// the filter, with {{.Node}} and {{.Hostname}} (host.hostName = '{{.Hostname}}' if unset), DataSource
+// is host (the default) or container, and TimeAggregation and GroupAggregation (timeAvg and avg by
+// default) are the aggregations of the metrics in the request. With SegmentBy the data is segmented
+// by those keys and the values of the segments are combined with SegmentAggregation (avg if unset).
+// Hostname returns the host name of a node, the short host name if it is nil. With MaxAge a
+// node whose newest datapoint is older returns a StaleDataError instead of its values. With Batch
+// the metrics of several nodes are read in one request, unless Filter is set.
+type SysdigProvider struct {
+	Client      *sysdig.SysdigApiClient
+	ClientFor   func(ctx context.Context, nodeName string) (*sysdig.SysdigApiClient, error)
+	Window      time.Duration
+	Sampling    time.Duration
+	Aggregation string
+	MaxAge      time.Duration
+
+	Filter             string
+	DataSource         string
+	TimeAggregation    string
+	GroupAggregation   string
+	SegmentBy          []string
+	SegmentAggregation string
+
+	Hostname HostnameFunc
+	Batch    bool
+}
+
+// Filter of the host of a node
+const defaultSysdigFilter = "host.hostName = '{{.Hostname}}'"
+
+func (p *SysdigProvider) Name() string {
+	return "sysdig"
+}
+
+// Retrieves the metrics of the host by calling the Sysdig Api once
+func (p *SysdigProvider) NodeMetrics(ctx context.Context, nodeName string, metricNames []string) (values []float64, err error) {
+	series, err := p.NodeSeries(ctx, nodeName, metricNames, p.Window, p.Sampling)
+	if err != nil {
+		return
+	}
+	return aggregateSeries(series, p.Aggregation), nil
+}
+
+// Retrieves the datapoints of the metrics of the host over the window, one every sampling
+func (p *SysdigProvider) NodeSeries(ctx context.Context, nodeName string, metricNames []string, window, sampling time.Duration) (series [][]float64, err error) {
+	filter, err := p.filter(ctx, nodeName)
+	if err != nil {
+		return
+	}
+	dataSource, groupAggregation := p.sources()
+	return p.query(ctx, nodeName, filter, dataSource, groupAggregation, metricNames, window, sampling)
+}
+
+// Retrieves the metrics of several hosts in one request by account, segmented by host.hostName.
+// The nodes without data, with stale data or whose host name or account can't be found are left
+// out. Returns BatchUnsupported unless Batch is set, or with a Filter.
+func (p *SysdigProvider) NodesMetrics(ctx context.Context, nodeNames []string, metricNames []string) (values map[string][]float64, err error) {
+	if !p.Batch || p.Filter != "" {
+		return nil, BatchUnsupported
+	}
+
+	// Nodes by account and host name
+	groups := map[*sysdig.SysdigApiClient]map[string][]string{}
+	for _, nodeName := range nodeNames {
+		host, err := hostname(ctx, p.Hostname, nodeName)
+		if err != nil {
+			continue
+		}
+		client := p.Client
+		if p.ClientFor != nil {
+			if client, err = p.ClientFor(ctx, nodeName); err != nil {
+				continue
+			}
+		}
+		if groups[client] == nil {
+			groups[client] = map[string][]string{}
+		}
+		groups[client][host] = append(groups[client][host], nodeName)
+	}
+
+	dataSource, groupAggregation := p.sources()
+	keys := append([]string{"host.hostName"}, p.SegmentBy...)
+	values = map[string][]float64{}
+	for client, hosts := range groups {
+		quoted := make([]string, 0, len(hosts))
+		for host := range hosts {
+			quoted = append(quoted, "'"+host+"'")
+		}
+		sort.Strings(quoted)
+		filter := fmt.Sprintf("host.hostName in (%s)", strings.Join(quoted, ", "))
+		points, err := p.getData(ctx, client, keys, metricNames, filter, dataSource, groupAggregation, p.Window, p.Sampling)
+		if err != nil {
+			return nil, err
+		}
+
+		byHost := map[string][]sysdigPoint{}
+		for _, point := range points {
+			if len(point.D) == 0 {
+				continue
+			}
+			if host, ok := point.D[0].(string); ok {
+				byHost[host] = append(byHost[host], sysdigPoint{T: point.T, D: point.D[1:]})
+			}
+		}
+		for host, nodes := range hosts {
+			series, err := p.series(byHost[host], metricNames)
+			if err != nil {
+				continue
+			}
+			for _, nodeName := range nodes {
+				values[nodeName] = aggregateSeries(series, p.Aggregation)
+			}
+		}
+	}
+	return values, nil
+}
+
+// Returns the data source and the group aggregation of the requests
+func (p *SysdigProvider) sources() (dataSource, groupAggregation string) {
+	dataSource, groupAggregation = p.DataSource, p.GroupAggregation
+	if dataSource == "" {
+		dataSource = "host"
+	}
+	if groupAggregation == "" {
+		groupAggregation = "avg"
+	}
+	return
+}
+
+// Retrieves the metrics of the containers of the namespace on the host, summed over the containers
+func (p *SysdigProvider) NamespaceMetrics(ctx context.Context, nodeName, namespace string, metricNames []string) (values []float64, err error) {
+	return p.ScopedMetrics(ctx, nodeName, map[string]string{"kubernetes.namespace.name": namespace}, metricNames)
+}
+
+// Retrieves the metrics of the containers of the host with those label values, summed over the containers
+func (p *SysdigProvider) ScopedMetrics(ctx context.Context, nodeName string, scope map[string]string, metricNames []string) (values []float64, err error) {
+	filter, err := p.filter(ctx, nodeName)
+	if err != nil {
+		return
+	}
+	labels := make([]string, 0, len(scope))
+	for label := range scope {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		filter = fmt.Sprintf(`%s and %s = '%s'`, filter, label, scope[label])
+	}
+	series, err := p.query(ctx, nodeName, filter, "container", "sum", metricNames, p.Window, p.Sampling)
+	if err != nil {
+		return
+	}
+	return aggregateSeries(series, p.Aggregation), nil
+}
+
+// Returns the filter of the request for a node
+func (p *SysdigProvider) filter(ctx context.Context, nodeName string) (string, error) {
+	host, err := hostname(ctx, p.Hostname, nodeName)
+	if err != nil {
+		return "", err
+	}
+	if p.Filter == "" {
+		return renderQuery(defaultSysdigFilter, nodeName, host)
+	}
+	return renderQuery(p.Filter, nodeName, host)
+}
+
+// Reads the datapoints of the metrics matching the filter over the window (60s if unset), combined
+// across the hosts or containers with the group aggregation
+func (p *SysdigProvider) query(ctx context.Context, nodeName, filter, dataSource, groupAggregation string, metricNames []string, window, sampling time.Duration) (series [][]float64, err error) {
+	client := p.Client
+	if p.ClientFor != nil {
+		if client, err = p.ClientFor(ctx, nodeName); err != nil {
+			return
+		}
+	}
+	points, err := p.getData(ctx, client, p.SegmentBy, metricNames, filter, dataSource, groupAggregation, window, sampling)
+	if err != nil {
+		return
+	}
+	return p.series(points, metricNames)
+}
+
+// A datapoint of the data answer: its time, then the grouping keys and the metric values
+type sysdigPoint struct {
+	T int64         `json:"t"`
+	D []interface{} `json:"d"`
+}
+
+// Requests the datapoints of the metrics grouped by the keys over the window (60s if unset)
+func (p *SysdigProvider) getData(ctx context.Context, client *sysdig.SysdigApiClient, keys, metricNames []string, filter, dataSource, groupAggregation string, window, sampling time.Duration) (points []sysdigPoint, err error) {
+	if window <= 0 {
+		window = time.Minute
+	}
+	if sampling <= 0 || sampling > window {
+		sampling = window
+	}
+	start := -int(window.Seconds())
+	end := 0
+	timeAggregation := p.TimeAggregation
+	if timeAggregation == "" {
+		timeAggregation = "timeAvg"
+	}
+
+	// The grouping keys come first in the datapoints
+	var sysdigMetrics []map[string]interface{}
+	for _, key := range keys {
+		sysdigMetrics = append(sysdigMetrics, map[string]interface{}{"id": key})
+	}
+	for _, name := range metricNames {
+		sysdigMetrics = append(sysdigMetrics, map[string]interface{}{
+			"id": name,
+			"aggregations": map[string]string{
+				"time": timeAggregation, "group": groupAggregation,
+			},
+		})
+	}
+
+	metricDataResponse, err := client.GetData(ctx, sysdigMetrics, start, end, int(sampling.Seconds()), filter, dataSource)
+	if err != nil {
+		err = TransientError{err}
+		return
+	}
+	defer metricDataResponse.Body.Close()
+
+	if metricDataResponse.StatusCode != 200 {
+		err = fmt.Errorf("metric data response: %s", metricDataResponse.Status)
+		if metricDataResponse.StatusCode == 429 || metricDataResponse.StatusCode >= 500 {
+			err = TransientError{err}
+		}
+		return
+	}
+
+	all, err := ioutil.ReadAll(metricDataResponse.Body)
+	if err != nil {
+		err = TransientError{err}
+		return
+	}
+
+	var metricData struct {
+		Data []sysdigPoint `json:"data"`
+	}
+	if err = json.Unmarshal(all, &metricData); err != nil {
+		return
+	}
+	return metricData.Data, nil
+}
+
+// Returns the series of every metric from the datapoints, the segments of the SegmentBy keys
+// combined with the segment aggregation at every time
+func (p *SysdigProvider) series(points []sysdigPoint, metricNames []string) (series [][]float64, err error) {
+	// Values of the segments at every time, every one with a value per metric
+	segments := map[int64][][]float64{}
+	for _, point := range points {
+		if row, ok := pointValues(point.D, len(p.SegmentBy), len(metricNames)); ok {
+			segments[point.T] = append(segments[point.T], row)
+		}
+	}
+	if len(segments) == 0 {
+		err = NoDataFound
+		return
+	}
+	times := make([]int64, 0, len(segments))
+	for t := range segments {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	if newest := time.Unix(times[len(times)-1], 0); p.MaxAge > 0 && time.Since(newest) > p.MaxAge {
+		err = StaleDataError{Newest: newest}
+		return
+	}
+
+	series = make([][]float64, len(metricNames))
+	for m := range metricNames {
+		series[m] = make([]float64, len(times))
+		for i, t := range times {
+			segmentValues := make([]float64, len(segments[t]))
+			for s, row := range segments[t] {
+				segmentValues[s] = row[m]
+			}
+			series[m][i] = Aggregate(segmentValues, p.SegmentAggregation)
+		}
+	}
+	return
+}
+
+// Combines the datapoints of every metric into a value
+func aggregateSeries(series [][]float64, aggregation string) []float64 {
+	values := make([]float64, len(series))
+	for m := range series {
+		values[m] = Aggregate(series[m], aggregation)
+	}
+	return values
+}
+
+// Returns the metric values of a datapoint, after its grouping keys. False if one is missing.
+func pointValues(data []interface{}, keys, metrics int) (row []float64, ok bool) {
+	if len(data) < keys+metrics {
+		return nil, false
+	}
+	for _, value := range data[keys : keys+metrics] {
+		number, isNumber := value.(float64)
+		if !isNumber {
+			return nil, false
+		}
+		row = append(row, number)
+	}
+	return row, true
+}
+
+// Combines the datapoints of a series, in time order, with the aggregation
+func Aggregate(series []float64, aggregation string) float64 {
+	switch aggregation {
+	case AggregationMin:
+		result := math.Inf(1)
+		for _, value := range series {
+			result = math.Min(result, value)
+		}
+		return result
+	case AggregationMax:
+		result := math.Inf(-1)
+		for _, value := range series {
+			result = math.Max(result, value)
+		}
+		return result
+	case AggregationP95:
+		sorted := append([]float64(nil), series...)
+		sort.Float64s(sorted)
+		return sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+	case AggregationLast:
+		return series[len(series)-1]
+	case AggregationSum:
+		var sum float64
+		for _, value := range series {
+			sum += value
+		}
+		return sum
+	case AggregationStdDev:
+		average := Aggregate(series, AggregationAvg)
+		var squares float64
+		for _, value := range series {
+			squares += (value - average) * (value - average)
+		}
+		return math.Sqrt(squares / float64(len(series)))
+	default:
+		var sum float64
+		for _, value := range series {
+			sum += value
+		}
+		return sum / float64(len(series))
+	}
+}
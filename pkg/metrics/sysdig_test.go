@@ -0,0 +1,50 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	series := []float64{4, 8, 2, 6}
+	tests := []struct {
+		aggregation string
+		series      []float64
+		want        float64
+	}{
+		{AggregationAvg, series, 5},
+		{"", series, 5},
+		{AggregationMin, series, 2},
+		{AggregationMax, series, 8},
+		{AggregationLast, series, 6},
+		{AggregationSum, series, 20},
+		{AggregationStdDev, series, math.Sqrt(5)},
+		{AggregationStdDev, []float64{3, 3, 3}, 0},
+		// The smallest value with 95% of the datapoints lower or equal
+		{AggregationP95, []float64{5, 1, 4, 2, 3}, 5},
+		{AggregationP95, []float64{20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, 19},
+		{AggregationP95, []float64{7}, 7},
+		{AggregationLast, []float64{7}, 7},
+	}
+	for _, test := range tests {
+		if got := Aggregate(test.series, test.aggregation); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("Aggregate(%v, %q) = %v, want %v", test.series, test.aggregation, got, test.want)
+		}
+	}
+}
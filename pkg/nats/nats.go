@@ -0,0 +1,152 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Subscriptions to the subjects of a NATS server, spoken to with its text protocol
+package nats
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returned by the server in a -ERR line
+type ServerError string
+
+func (e ServerError) Error() string {
+	return "nats: " + string(e)
+}
+
+// Subscribes to the subject on the server of the url (nats://[user:password@|token@]host:port, or
+// tls://), in the queue group if not empty so each message reaches a single subscriber of the group.
+// The payload of every message is passed to handle. Blocks until the context is done, returning
+// nil, or the connection fails.
+func Subscribe(ctx context.Context, rawURL, subject, queueGroup string, handle func(payload []byte)) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	switch u.Scheme {
+	case "nats":
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	case "tls":
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: u.Hostname()}}).DialContext(ctx, "tcp", address)
+	default:
+		return fmt.Errorf("nats: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Unblocks the reads once the context is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := readLine(reader)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "sysdig-scheduler", "lang": "go"}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			options["user"], options["pass"] = u.User.Username(), password
+		} else {
+			options["auth_token"] = u.User.Username()
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	sub := "SUB " + subject
+	if queueGroup != "" {
+		sub += " " + queueGroup
+	}
+	if _, err = fmt.Fprintf(conn, "CONNECT %s\r\n%s 1\r\nPING\r\n", connect, sub); err != nil {
+		return err
+	}
+
+	for {
+		// The server pings every 2 minutes by default, a silent connection is dead
+		conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := readLine(reader)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		switch {
+		case line == "PING":
+			if _, err = io.WriteString(conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || len(fields) < 4 {
+				return fmt.Errorf("nats: malformed message %q", line)
+			}
+			payload := make([]byte, size+2)
+			if _, err = io.ReadFull(reader, payload); err != nil {
+				return err
+			}
+			handle(payload[:size])
+		case strings.HasPrefix(line, "-ERR"):
+			return ServerError(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+		// +OK, PONG and INFO updates need no answer
+	}
+}
+
+// Reads a line without its \r\n
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,197 @@
+//go:build framework
+
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin is the Filter and Score plugin of the kube-scheduler scheduling framework rejecting
+// and scoring the nodes with the filters and the metrics of a profile, so the upstream scheduler
+// keeps all its default plugins. It is built against k8s.io/kubernetes v1.30 with the framework
+// build tag, by cmd/kube-scheduler/build.sh.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/scheduler"
+)
+
+// Name of the plugin in the KubeSchedulerConfiguration
+const Name = "SysdigMetrics"
+
+// Key of the scores in the cycle state
+const stateKey framework.StateKey = Name
+
+// Key of the rejected nodes in the cycle state
+const rejectionsKey framework.StateKey = Name + "/rejections"
+
+// Args are the arguments of the plugin in the KubeSchedulerConfiguration
+type Args struct {
+	// Config is the configuration file of the profiles, the one of the scheduler
+	Config string `json:"config"`
+	// Profile is the name of the profile scoring the nodes, the first one if empty
+	Profile string `json:"profile,omitempty"`
+	// Kubeconfig of the cluster, the env KUBECONFIG or the service account of the pod if empty
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+}
+
+// Plugin filters the nodes once per scheduling cycle in PreFilter and scores them in PreScore,
+// Filter and Score return the results
+type Plugin struct {
+	args      Args
+	handle    framework.Handle
+	scheduler *scheduler.Scheduler
+}
+
+var (
+	_ framework.PreFilterPlugin = &Plugin{}
+	_ framework.FilterPlugin    = &Plugin{}
+	_ framework.PreScorePlugin  = &Plugin{}
+	_ framework.ScorePlugin     = &Plugin{}
+)
+
+// Reasons of the rejected nodes of a cycle, by node name
+type nodeRejections map[string]error
+
+func (r nodeRejections) Clone() framework.StateData {
+	return r
+}
+
+// Scores of the nodes of a cycle, by node name
+type nodeScores map[string]int64
+
+func (s nodeScores) Clone() framework.StateData {
+	return s
+}
+
+// New is the factory of the plugin, registered with app.WithPlugin. The Sysdig token is read
+// from the env SDC_TOKEN.
+func New(ctx context.Context, obj runtime.Object, handle framework.Handle) (framework.Plugin, error) {
+	var args Args
+	if err := frameworkruntime.DecodeInto(obj, &args); err != nil {
+		return nil, err
+	}
+	if args.Config == "" {
+		return nil, fmt.Errorf("%s: the config argument must be set", Name)
+	}
+	config, err := scheduler.LoadConfig(args.Config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", Name, err)
+	}
+	s, err := scheduler.NewScheduler(scheduler.SchedulerOptions{Config: config, Kubeconfig: args.Kubeconfig, SysdigToken: os.Getenv("SDC_TOKEN")})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", Name, err)
+	}
+	return &Plugin{args: args, handle: handle, scheduler: s}, nil
+}
+
+func (p *Plugin) Name() string {
+	return Name
+}
+
+// Runs the filters and the thresholds of the profile on all the nodes and stores the rejected
+// ones in the cycle state
+func (p *Plugin) PreFilter(ctx context.Context, state *framework.CycleState, pod *v1.Pod) (*framework.PreFilterResult, *framework.Status) {
+	kubePod, err := convertPod(pod)
+	if err != nil {
+		return nil, framework.AsStatus(err)
+	}
+	nodes, err := p.handle.SnapshotSharedLister().NodeInfos().List()
+	if err != nil {
+		return nil, framework.AsStatus(err)
+	}
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Node().Name)
+	}
+	rejected, err := p.scheduler.FilterNodes(ctx, p.args.Profile, kubePod, names)
+	if err != nil {
+		return nil, framework.AsStatus(err)
+	}
+	state.Write(rejectionsKey, nodeRejections(rejected))
+	return nil, nil
+}
+
+// The rejections don't depend on the other pods of the cycle
+func (p *Plugin) PreFilterExtensions() framework.PreFilterExtensions {
+	return nil
+}
+
+// Rejects the node if PreFilter did. Evicting pods doesn't bring a metric back under its
+// threshold, so the rejection is unresolvable by the preemption.
+func (p *Plugin) Filter(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeInfo *framework.NodeInfo) *framework.Status {
+	data, err := state.Read(rejectionsKey)
+	if err != nil {
+		return framework.AsStatus(fmt.Errorf("%s: reading the rejected nodes: %s", Name, err))
+	}
+	if reason, ok := data.(nodeRejections)[nodeInfo.Node().Name]; ok {
+		return framework.NewStatus(framework.UnschedulableAndUnresolvable, reason.Error())
+	}
+	return nil
+}
+
+// Reads the metrics of the nodes passing the filters and stores their scores in the cycle state
+func (p *Plugin) PreScore(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodes []*framework.NodeInfo) *framework.Status {
+	kubePod, err := convertPod(pod)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Node().Name)
+	}
+	scored, err := p.scheduler.ScoreNodes(ctx, p.args.Profile, kubePod, names)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+	scores := nodeScores{}
+	for _, node := range scored {
+		scores[node.Name] = node.Score
+	}
+	state.Write(stateKey, scores)
+	return nil
+}
+
+// Returns the score of the node stored by PreScore, from 0 to framework.MaxNodeScore
+func (p *Plugin) Score(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) (int64, *framework.Status) {
+	data, err := state.Read(stateKey)
+	if err != nil {
+		return 0, framework.AsStatus(fmt.Errorf("%s: reading the scores: %s", Name, err))
+	}
+	return data.(nodeScores)[nodeName], nil
+}
+
+// The scores are normalized by PreScore already
+func (p *Plugin) ScoreExtensions() framework.ScoreExtensions {
+	return nil
+}
+
+// Converts the pod to the client type of the scheduler, whose fields have the same names
+func convertPod(pod *v1.Pod) (kubePod kubernetes.KubePod, err error) {
+	data, err := json.Marshal(pod)
+	if err == nil {
+		err = json.Unmarshal(data, &kubePod)
+	}
+	return
+}
@@ -0,0 +1,72 @@
+//go:build framework
+
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+func TestFilter(t *testing.T) {
+	state := framework.NewCycleState()
+	state.Write(rejectionsKey, nodeRejections{"hot": errors.New("MetricThresholds: cpu.used.percent is 95, above the threshold of 90")})
+	p := &Plugin{}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+
+	tests := []struct {
+		node string
+		want framework.Code
+	}{
+		{"hot", framework.UnschedulableAndUnresolvable},
+		{"cool", framework.Success},
+	}
+	for _, test := range tests {
+		nodeInfo := framework.NewNodeInfo()
+		nodeInfo.SetNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: test.node}})
+		if status := p.Filter(context.Background(), state, pod, nodeInfo); status.Code() != test.want {
+			t.Errorf("Filter(%s) = %v, want %v", test.node, status, test.want)
+		}
+	}
+
+	if status := p.Filter(context.Background(), framework.NewCycleState(), pod, framework.NewNodeInfo()); status.IsSuccess() {
+		t.Error("Filter without PreFilter succeeded")
+	}
+}
+
+func TestConvertPod(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Labels: map[string]string{"app": "web"}},
+		Spec:       v1.PodSpec{SchedulerName: "sysdig-scheduler", Containers: []v1.Container{{Name: "web", Image: "nginx"}}},
+	}
+	kubePod, err := convertPod(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kubePod.Metadata.Name != "web" || kubePod.Metadata.Labels["app"] != "web" || kubePod.Spec.SchedulerName != "sysdig-scheduler" {
+		t.Errorf("convertPod() = %+v", kubePod)
+	}
+	if len(kubePod.Spec.Containers) != 1 || kubePod.Spec.Containers[0].Image != "nginx" {
+		t.Errorf("convertPod() containers = %+v", kubePod.Spec.Containers)
+	}
+}
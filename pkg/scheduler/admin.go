@@ -0,0 +1,129 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Health of the scheduler, it is healthy while its pod watch is open
+type healthState struct {
+	mutex   sync.Mutex
+	healthy bool
+	reason  string
+}
+
+func (h *healthState) set(healthy bool, reason string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.healthy, h.reason = healthy, reason
+}
+
+func (h *healthState) get() (healthy bool, reason string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.healthy, h.reason
+}
+
+// Serves the admin endpoints: /healthz answers 200 while the scheduler is healthy, 503 otherwise.
+// /debug/nodes/NAME returns the last scoring rounds of a node and /debug/pods/NAMESPACE/NAME the
+// last decisions for a pod, /debug/explain/NAMESPACE/NAME ranks the nodes for a pending pod and
+// POST /v1/placement for any pod, without binding them, /debug/experiments compares the arms of
+// the experiments, /v1/features reads and sets the feature flags, and /metrics exports the last score and metric values of the nodes as
+// Prometheus gauges, the throttling of the scheduler by the api server, the shadow comparisons
+// and the outcomes of the experiments.
+// With profiling the pprof profiles are served under /debug/pprof/ and the runtime variables,
+// the number of goroutines and of queued pods included, on /debug/vars.
+func (s *Scheduler) adminHandler(profiling bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if healthy, reason := s.health.get(); !healthy {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unhealthy", "reason": reason})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/debug/nodes/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/debug/nodes/")
+		if name == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node name missing"})
+			return
+		}
+		writeJSON(w, http.StatusOK, s.history.node(name))
+	})
+	mux.HandleFunc("/debug/pods/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/debug/pods/"), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected /debug/pods/NAMESPACE/NAME"})
+			return
+		}
+		writeJSON(w, http.StatusOK, s.history.pod(parts[0], parts[1]))
+	})
+	mux.HandleFunc("/debug/explain/", s.explainPodHandler)
+	mux.HandleFunc("/v1/placement", s.placementHandler)
+	mux.HandleFunc("/v1/schedule/", s.scheduleHandler)
+	mux.HandleFunc("/v1/alerts", s.alertHandler)
+	mux.HandleFunc("/debug/experiments", s.experimentsHandler)
+	mux.HandleFunc("/v1/features", s.featuresHandler)
+	mux.HandleFunc("/v1/features/", s.featuresHandler)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		s.gauges.write(w)
+		throttle.write(w)
+		s.shadow.write(w)
+		failures.write(w)
+		s.queue.write(w)
+		s.experiments.write(w)
+		transports.write(w)
+		s.observer.write(w)
+	})
+	if profiling {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
+	return mux
+}
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+	// Over the running schedulers
+	expvar.Publish("queuedPods", expvar.Func(func() interface{} {
+		queued := 0
+		for _, s := range running.all() {
+			queued += s.queue.length()
+		}
+		return queued
+	}))
+	expvar.Publish("oldestQueuedPodSeconds", expvar.Func(func() interface{} {
+		var oldest time.Duration
+		for _, s := range running.all() {
+			if age := s.queue.oldest(); age > oldest {
+				oldest = age
+			}
+		}
+		return oldest.Seconds()
+	}))
+}
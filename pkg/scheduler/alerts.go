@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Host or node named by the entity of a Sysdig alert, like host.hostName = 'ip-10-0-1-12'
+var alertEntity = regexp.MustCompile(`(?:host\.hostName|kubernetes\.node\.name)\s*=\s*['"]([^'"]+)['"]`)
+
+// Alert notifications received, by outcome
+var alertNotifications = expvar.NewMap("alertNotifications")
+
+// Notification of the Sysdig webhook channel, only the fields the scheduler uses
+type sysdigAlertNotification struct {
+	Alert struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	} `json:"alert"`
+	State    string `json:"state"` // ACTIVE or OK
+	Resolved bool   `json:"resolved"`
+	Entities []struct {
+		Entity string `json:"entity"`
+	} `json:"entities"`
+}
+
+func (c AlertsConfig) validate() error {
+	if c.Exclude < 0 {
+		return errors.New("alerts: exclude can't be negative")
+	}
+	return nil
+}
+
+// Nodes excluded by an active alert, with the alert name and the time the exclusion ends
+type alertExclusions struct {
+	mutex sync.Mutex
+	nodes map[string]alertExclusion
+}
+
+type alertExclusion struct {
+	alert string
+	until time.Time
+}
+
+// Returns the name of the alert excluding the node, if any
+func (a *alertExclusions) active(nodeName string) (alert string, ok bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	exclusion, ok := a.nodes[nodeName]
+	if ok && time.Now().After(exclusion.until) {
+		delete(a.nodes, nodeName)
+		return "", false
+	}
+	return exclusion.alert, ok
+}
+
+func (a *alertExclusions) set(nodeName, alert string, duration time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.nodes[nodeName] = alertExclusion{alert, time.Now().Add(duration)}
+}
+
+func (a *alertExclusions) clear(nodeName string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.nodes, nodeName)
+}
+
+// Rejects the nodes of the Sysdig alerts still active within their exclusion
+func sysdigAlertFilter(state *cycleState, node kubernetes.KubeNode) error {
+	if alert, ok := state.scheduler.alerted.active(node.Metadata.Name); ok {
+		return fmt.Errorf("alert %q is active", alert)
+	}
+	return nil
+}
+
+// Handles a POST of the Sysdig webhook notification channel on /v1/alerts: the metrics of the
+// nodes of the alert are read again by the next pods, and the nodes are excluded for the alerts
+// exclude while the alert is active
+func (s *Scheduler) alertHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "expected a POST"})
+		return
+	}
+	if !s.config.Alerts.Enabled {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "the alerts are not enabled"})
+		return
+	}
+	var notification sysdigAlertNotification
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&notification); err != nil {
+		alertNotifications.Add("malformed", 1)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	nodes := s.alertNodes(r.Context(), notification)
+	resolved := notification.Resolved || notification.State == "OK"
+	for _, nodeName := range nodes {
+		s.invalidateNodeMetrics(r.Context(), nodeName)
+		switch {
+		case resolved:
+			s.alerted.clear(nodeName)
+		case s.config.Alerts.Exclude > 0:
+			s.alerted.set(nodeName, notification.Alert.Name, s.config.Alerts.Exclude)
+		}
+	}
+	outcome := "active"
+	if resolved {
+		outcome = "resolved"
+	}
+	if len(nodes) == 0 {
+		alertNotifications.Add("unmatched", 1)
+	} else {
+		alertNotifications.Add(outcome, 1)
+	}
+	log.Printf("Alert %q %s on nodes %v", notification.Alert.Name, outcome, nodes)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"nodes": nodes})
+}
+
+// Returns the ready nodes named by the entities or the scope of the alert, by node name or host name
+func (s *Scheduler) alertNodes(ctx context.Context, notification sysdigAlertNotification) (nodes []string) {
+	hosts := map[string]bool{}
+	for _, entity := range notification.Entities {
+		for _, match := range alertEntity.FindAllStringSubmatch(entity.Entity, -1) {
+			hosts[match[1]] = true
+		}
+	}
+	if len(hosts) == 0 {
+		for _, match := range alertEntity.FindAllStringSubmatch(notification.Alert.Scope, -1) {
+			hosts[match[1]] = true
+		}
+	}
+	if len(hosts) == 0 {
+		return
+	}
+
+	hostname := s.hostnameFunc(s.config.Provider.Hostname)
+	for _, node := range s.allReadyNodes(ctx) {
+		name := node.Metadata.Name
+		if hosts[name] {
+			nodes = append(nodes, name)
+			continue
+		}
+		if host, err := hostname(ctx, name); err == nil && hosts[host] {
+			nodes = append(nodes, name)
+		}
+	}
+	return
+}
+
+// Drops the cached, prefetched and smoothed metrics of the node for every profile, so they are read
+// again from the provider
+func (s *Scheduler) invalidateNodeMetrics(ctx context.Context, nodeName string) {
+	for _, profile := range s.profiles.all() {
+		for _, variant := range profile.withVariants() {
+			if err := s.metricCache.Delete(ctx, metricCacheKey(variant, nodeName)); err != nil {
+				log.Printf("Error deleting the cached metrics of %s: %s", nodeName, err)
+			}
+			variant.prefetched.remove(nodeName)
+			variant.smoothed.remove(nodeName)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+)
+
+// Queue of items handed to a worker in the background, shared by the audit log and the
+// notifications. The items are dropped when the worker can't keep up.
+type asyncSink struct {
+	mutex  sync.Mutex
+	closed bool
+	items  chan interface{}
+	done   chan struct{}
+}
+
+// Starts the worker, which reads the items until the sink is closed and the queue drained
+func newAsyncSink(size int, worker func(items <-chan interface{})) *asyncSink {
+	s := &asyncSink{items: make(chan interface{}, size), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		worker(s.items)
+	}()
+	return s
+}
+
+// Queues the item. Returns true if it was dropped because the queue is full, the items pushed
+// once the sink is closed are ignored.
+func (s *asyncSink) push(item interface{}) (full bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.items <- item:
+		return false
+	default:
+		return true
+	}
+}
+
+// Stops accepting items, the worker handles the queued ones and returns
+func (s *asyncSink) stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.items)
+	}
+}
+
+// Waits for the worker to return once stopped. Returns false if the context is done first.
+func (s *asyncSink) wait(ctx context.Context) bool {
+	select {
+	case <-s.done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
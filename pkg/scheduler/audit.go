@@ -0,0 +1,340 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Audit sink types
+const (
+	auditFile    = "file"
+	auditWebhook = "webhook"
+	auditS3      = "s3"
+	auditSQL     = "sql"
+)
+
+// Outcomes of a scheduling decision
+const (
+	outcomeBound     = "bound"     // Bound to the best node by metrics
+	outcomePreempted = "preempted" // Bound after evicting lower priority pods
+	outcomeFallback  = "fallback"  // Bound to the node chosen by the profile fallback
+	outcomeDelegated = "delegated" // Handed to the default scheduler
+	outcomeRemote    = "remote"    // Created on a node of another cluster
+	outcomeConflict  = "conflict"  // Bound by another scheduler, or deleted, before the binding
+	outcomeFailed    = "failed"
+	outcomeObserved  = "observed" // Decided by the observer, nothing bound
+)
+
+// One scheduling decision as written to the audit sink
+type auditRecord struct {
+	ID         string            `json:"id"`
+	Time       time.Time         `json:"time"`
+	Namespace  string            `json:"namespace"`
+	Pod        string            `json:"pod"`
+	Profile    string            `json:"profile"`
+	Metrics    []string          `json:"metrics"`
+	Candidates []auditCandidate  `json:"candidates"`
+	Rejected   map[string]string `json:"rejected,omitempty"`
+	Node       string            `json:"node,omitempty"`
+	Outcome    string            `json:"outcome"`
+	Error      string            `json:"error,omitempty"`
+	Reason     failure.Reason    `json:"reason,omitempty"`
+	Phase      failure.Phase     `json:"phase,omitempty"`
+	Fallbacks  []string          `json:"fallbacks,omitempty"`
+	Duration   float64           `json:"durationSeconds"`
+	Inputs     *decisionInputs   `json:"inputs,omitempty"`
+
+	err error
+}
+
+// A node scored during the decision, with the metric values of the profile, or of its node pool
+// named by MetricNames
+type auditCandidate struct {
+	Node        string         `json:"node"`
+	Score       *float64       `json:"score,omitempty"`
+	Metrics     []float64      `json:"metrics,omitempty"`
+	MetricNames []string       `json:"metricNames,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Reason      failure.Reason `json:"reason,omitempty"`
+}
+
+// Metric and scorer values of the scored nodes, recorded to replay the decision
+type decisionInputs struct {
+	QoSClass string       `json:"qosClass,omitempty"`
+	Nodes    []nodeInputs `json:"nodes"`
+}
+
+// Values of a scored node by metric or scorer name, kept for the nodes past a threshold too
+type nodeInputs struct {
+	Node   string             `json:"node"`
+	Values map[string]float64 `json:"values,omitempty"`
+	Error  string             `json:"error,omitempty"`
+}
+
+// Starts the record of a decision for the pod
+func newAuditRecord(profile *Profile, pod kubernetes.KubePod) *auditRecord {
+	return &auditRecord{
+		ID:        newDecisionID(),
+		Time:      time.Now(),
+		Namespace: pod.Metadata.Namespace,
+		Pod:       pod.Metadata.Name,
+		Profile:   profile.Name,
+		Metrics:   profile.metricNames,
+	}
+}
+
+// Sets the filtering and scoring results of the decision
+func (r *auditRecord) setNodes(rejected map[string]error, scored NodeList) {
+	for name, reason := range rejected {
+		if r.Rejected == nil {
+			r.Rejected = map[string]string{}
+		}
+		r.Rejected[name] = reason.Error()
+	}
+	for _, node := range scored {
+		candidate := auditCandidate{Node: node.name}
+		if node.err != nil {
+			candidate.Error, candidate.Reason = node.err.Error(), failure.ReasonOf(node.err)
+		} else {
+			score := node.score
+			candidate.Score, candidate.Metrics, candidate.MetricNames = &score, node.metrics, node.names
+		}
+		r.Candidates = append(r.Candidates, candidate)
+	}
+}
+
+// Sets the inputs of the decision from the values of the scored nodes
+func (r *auditRecord) setInputs(profile *Profile, pod kubernetes.KubePod, scored NodeList) {
+	r.Inputs = &decisionInputs{QoSClass: pod.Status.QosClass}
+	for _, node := range scored {
+		input := nodeInputs{Node: node.name}
+		if node.err != nil {
+			input.Error = node.err.Error()
+		}
+		// The values follow the metrics, then the scorer values
+		names := node.metricNames(profile)
+		for i, value := range node.metrics {
+			if input.Values == nil {
+				input.Values = map[string]float64{}
+			}
+			if i < len(names) {
+				input.Values[names[i]] = value
+			} else if s := i - len(names); s < len(profile.Scorers) {
+				input.Values[profile.Scorers[s].Name] = value
+			}
+		}
+		r.Inputs.Nodes = append(r.Inputs.Nodes, input)
+	}
+}
+
+// Sets the outcome of the decision
+func (r *auditRecord) finish(outcome, node string, err error) {
+	r.Outcome, r.Node, r.err = outcome, node, err
+	if err != nil {
+		r.Error, r.Reason, r.Phase = err.Error(), failure.ReasonOf(err), failure.PhaseOf(err)
+	}
+	r.Duration = time.Since(r.Time).Seconds()
+}
+
+// Checks that the sink of the configured type is set
+func (c AuditConfig) validate() error {
+	switch c.Type {
+	case "":
+	case auditFile:
+		if c.File == "" {
+			return errors.New("audit: file must be set")
+		}
+	case auditWebhook:
+		if c.Webhook == nil || c.Webhook.URL == "" {
+			return errors.New("audit: webhook url must be set")
+		}
+	case auditS3:
+		if c.S3 == nil || c.S3.Bucket == "" || c.S3.Region == "" {
+			return errors.New("audit: s3 bucket and region must be set")
+		}
+	case auditSQL:
+		if c.SQL == nil || c.SQL.Driver == "" {
+			return errors.New("audit: sql driver must be set")
+		}
+		if err := c.SQL.checkDriver(); err != nil {
+			return fmt.Errorf("audit: %s", err)
+		}
+		if c.SQL.Table != "" && !sqlIdentifier.MatchString(c.SQL.Table) {
+			return fmt.Errorf("audit: invalid sql table %q", c.SQL.Table)
+		}
+	default:
+		return fmt.Errorf("audit: unknown sink type %q", c.Type)
+	}
+	return nil
+}
+
+// Destination of the batches of JSON lines
+type auditSink interface {
+	write(ctx context.Context, batch []byte) error
+}
+
+// Writes the decisions to the sink in the background. A nil logger discards them.
+type auditLogger struct {
+	config  AuditConfig
+	sink    auditSink
+	records *asyncSink
+}
+
+// Returns the logger of the configuration, nil if the audit is disabled
+func (s *Scheduler) newAuditLogger(c AuditConfig) *auditLogger {
+	var sink auditSink
+	switch c.Type {
+	case auditFile:
+		sink = fileSink{path: c.File}
+	case auditWebhook:
+		sink = webhookSink{config: *c.Webhook}
+	case auditS3:
+		sink = s3Sink{
+			config: *c.S3,
+			keys:   s.credentials(c.S3.Secret, []string{"access-key-id", "secret-access-key"}, []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"}),
+		}
+	case auditSQL:
+		sink = &sqlSink{config: *c.SQL, dsn: c.SQL.dsn(s)}
+	default:
+		return nil
+	}
+
+	logger := &auditLogger{config: c, sink: sink}
+	logger.records = newAsyncSink(10*c.BatchSize, logger.run)
+	return logger
+}
+
+// Queues the record, it is dropped if the sink can't keep up
+func (a *auditLogger) record(record *auditRecord) {
+	if a == nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Println("audit: error while encoding a record:", err)
+		return
+	}
+
+	if a.records.push(append(line, '\n')) {
+		log.Printf("audit: queue full, decision for %s/%s dropped", record.Namespace, record.Pod)
+	}
+}
+
+// Sends the queued records in batches until the logger is closed
+func (a *auditLogger) run(records <-chan interface{}) {
+	ticker := time.NewTicker(a.config.FlushInterval)
+	defer ticker.Stop()
+
+	var batch bytes.Buffer
+	count := 0
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := a.sink.write(ctx, batch.Bytes()); err != nil {
+			log.Printf("audit: error while writing %d decisions: %s", count, err)
+		}
+		batch.Reset()
+		count = 0
+	}
+
+	for {
+		select {
+		case line, ok := <-records:
+			if !ok {
+				flush()
+				return
+			}
+			batch.Write(line.([]byte))
+			count++
+			if count >= a.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Stops accepting records and waits for the queued ones to be written
+func (a *auditLogger) close(ctx context.Context) {
+	if a == nil {
+		return
+	}
+	a.records.stop()
+	if !a.records.wait(ctx) {
+		log.Println("audit: shutdown timeout reached, pending decisions lost")
+	}
+}
+
+// Appends the batches to a local file
+type fileSink struct {
+	path string
+}
+
+func (s fileSink) write(ctx context.Context, batch []byte) error {
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(batch); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Posts the batches to a webhook
+type webhookSink struct {
+	config WebhookConfig
+}
+
+func (s webhookSink) write(ctx context.Context, batch []byte) error {
+	request, err := http.NewRequestWithContext(ctx, "POST", s.config.URL, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	for name, value := range s.config.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook: error code %d", response.StatusCode)
+	}
+	return nil
+}
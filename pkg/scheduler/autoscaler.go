@@ -0,0 +1,133 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/binding"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// How often the ready nodes are listed to find the ones added for the unschedulable pods
+const newNodeCheckInterval = 10 * time.Second
+
+// Pods no node could take, waiting for the Cluster Autoscaler to add a node. Indexed by namespace/name.
+type unschedulablePodSet struct {
+	scheduler *Scheduler
+	mutex     sync.Mutex
+	pods      map[string]unschedulablePod
+}
+
+type unschedulablePod struct {
+	profile *Profile
+	pod     kubernetes.KubePod
+}
+
+// Marks the pod unschedulable the way the default scheduler does, PodScheduled=False with the
+// Unschedulable reason and a FailedScheduling event, so the Cluster Autoscaler adds a node for it.
+// The pod is tried again once a new node is ready.
+func (u *unschedulablePodSet) add(ctx context.Context, profile *Profile, pod kubernetes.KubePod, nodes int, rejected map[string]error) {
+	u.mutex.Lock()
+	u.pods[pod.Metadata.Namespace+"/"+pod.Metadata.Name] = unschedulablePod{profile, pod}
+	u.mutex.Unlock()
+
+	message := unschedulableMessage(nodes, rejected)
+	if err := u.scheduler.kubeAPI.SetPodCondition(ctx, pod.Metadata.Namespace, pod.Metadata.Name, "PodScheduled", "False", "Unschedulable", message); err != nil {
+		log.Printf("Error setting the PodScheduled condition of %s: %s", pod.Metadata.Name, err)
+	}
+	u.scheduler.reportPodEvent(ctx, pod, "Warning", "FailedScheduling", message)
+}
+
+// Returns the pods waiting for a node and forgets them
+func (u *unschedulablePodSet) take() (pods []unschedulablePod) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for key, pod := range u.pods {
+		pods = append(pods, pod)
+		delete(u.pods, key)
+	}
+	return
+}
+
+// Forgets a deleted pod
+func (u *unschedulablePodSet) remove(pod kubernetes.KubePod) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	delete(u.pods, pod.Metadata.Namespace+"/"+pod.Metadata.Name)
+}
+
+// Returns the message of the default scheduler, like "0/3 nodes are available: 2 NodeResourcesFit, 1 NodeUnschedulable."
+func unschedulableMessage(nodes int, rejected map[string]error) string {
+	counts := map[string]int{}
+	for _, reason := range rejected {
+		name := "Error"
+		if err, ok := reason.(filterError); ok {
+			name = err.filter
+		}
+		counts[name]++
+	}
+
+	reasons := make([]string, 0, len(counts))
+	for name, count := range counts {
+		reasons = append(reasons, fmt.Sprintf("%d %s", count, name))
+	}
+	sort.Strings(reasons)
+	return fmt.Sprintf("0/%d nodes are available: %s.", nodes, strings.Join(reasons, ", "))
+}
+
+// Tries the unschedulable pods again every time a node not seen before is ready, until the context is done
+func (s *Scheduler) watchNewNodes(ctx context.Context) {
+	known := map[string]bool{}
+	for _, node := range s.nodesAvailable(ctx) {
+		known[node.Metadata.Name] = true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(newNodeCheckInterval):
+		}
+
+		added := false
+		for _, node := range s.nodesAvailable(ctx) {
+			if !known[node.Metadata.Name] {
+				log.Printf("Node %s is ready, trying the unschedulable pods again", node.Metadata.Name)
+				known[node.Metadata.Name] = true
+				added = true
+			}
+		}
+		if !added {
+			continue
+		}
+
+		for _, waiting := range s.unschedulablePods.take() {
+			// Bound by another scheduler or deleted meanwhile
+			if err := binding.Check(ctx, &s.kubeAPI, waiting.pod.Metadata.Namespace, waiting.pod.Metadata.Name); err != nil {
+				continue
+			}
+			s.queue.push(waiting.profile, waiting.pod)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Delays of the scheduling loop while the api server throttles the scheduler: the delay doubles
+// from throttleMinDelay on every 429 up to throttleMaxDelay, and halves every throttleHalfLife
+// without one
+const (
+	throttleMinDelay = 100 * time.Millisecond
+	throttleMaxDelay = 30 * time.Second
+	throttleHalfLife = 10 * time.Second
+)
+
+// Adaptive delay between the scheduling attempts, raised by the 429 answers of the api server
+type apiThrottle struct {
+	mutex     sync.Mutex
+	delay     time.Duration // Delay at the last 429
+	last      time.Time     // Time of the last 429
+	until     time.Time     // End of the Retry-After of the last 429
+	throttled *expvar.Int
+}
+
+var throttle = &apiThrottle{throttled: expvar.NewInt("apiThrottledResponses")}
+
+// Records a 429 of the api server, with its Retry-After if any
+func (t *apiThrottle) record(retryAfter time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	delay := t.current(now) * 2
+	if delay < throttleMinDelay {
+		delay = throttleMinDelay
+	}
+	if delay > throttleMaxDelay {
+		delay = throttleMaxDelay
+	}
+	if t.current(now) == 0 {
+		log.Printf("The api server is throttling the requests, slowing down the scheduling")
+	}
+	t.delay, t.last = delay, now
+	if until := now.Add(retryAfter); until.After(t.until) {
+		t.until = until
+	}
+	t.throttled.Add(1)
+}
+
+// Returns the delay decayed since the last 429, zero once below throttleMinDelay / 10
+func (t *apiThrottle) current(now time.Time) time.Duration {
+	if t.delay == 0 {
+		return 0
+	}
+	delay := time.Duration(float64(t.delay) * math.Pow(0.5, float64(now.Sub(t.last))/float64(throttleHalfLife)))
+	if delay < throttleMinDelay/10 {
+		return 0
+	}
+	return delay
+}
+
+// Returns how long the next scheduling attempt must wait: the current delay, or the rest of the
+// Retry-After of the api server if longer
+func (t *apiThrottle) wait() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	delay := t.current(now)
+	if retry := t.until.Sub(now); retry > delay {
+		delay = retry
+	}
+	return delay
+}
+
+// Sleeps the delay of the scheduling loop, returns an error if the context is done first
+func (t *apiThrottle) sleep(ctx context.Context) error {
+	delay := t.wait()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Writes the throttling of the scheduler as Prometheus metrics
+func (t *apiThrottle) write(w http.ResponseWriter) {
+	fmt.Fprintln(w, "# HELP sysdig_scheduler_api_throttled_total Responses of the api server throttling the scheduler (429).")
+	fmt.Fprintln(w, "# TYPE sysdig_scheduler_api_throttled_total counter")
+	fmt.Fprintf(w, "sysdig_scheduler_api_throttled_total %d\n", t.throttled.Value())
+	fmt.Fprintln(w, "# HELP sysdig_scheduler_throttle_delay_seconds Delay between the scheduling attempts while the api server throttles the scheduler.")
+	fmt.Fprintln(w, "# TYPE sysdig_scheduler_throttle_delay_seconds gauge")
+	fmt.Fprintf(w, "sysdig_scheduler_throttle_delay_seconds %s\n", promValue(t.wait().Seconds()))
+}
+
+// Reports the 429 answers of the api server to the throttle
+type throttleTransport struct {
+	next http.RoundTripper
+}
+
+func (t *throttleTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(request)
+	if err == nil && response.StatusCode == http.StatusTooManyRequests {
+		var retryAfter time.Duration
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		throttle.record(retryAfter)
+	}
+	return response, err
+}
+
+// Slows down the scheduling loop when the api server answers 429
+func (s *Scheduler) watchThrottling() {
+	s.kubeAPI.WrapTransport(func(next http.RoundTripper) http.RoundTripper {
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		return &throttleTransport{next: next}
+	})
+	expvar.Publish("throttleDelaySeconds", expvar.Func(func() interface{} { return throttle.wait().Seconds() }))
+}
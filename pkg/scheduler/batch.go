@@ -0,0 +1,100 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"log"
+
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+)
+
+// Requests reading the metrics of several nodes at once, and the nodes they returned
+var (
+	batchRequests = expvar.NewInt("batchRequests")
+	batchedNodes  = expvar.NewInt("batchedNodes")
+)
+
+// Returns the metrics of the nodes prefetched or cached, and reads the others in one request
+// with a batch provider, caching them. Nil without a batch provider, the nodes missing are read
+// one by one.
+func (s *Scheduler) batchMetrics(ctx context.Context, profile *Profile, nodes []string) map[string][]float64 {
+	if _, ok := profile.provider.(metrics.BatchProvider); !ok || len(nodes) < 2 || len(profile.Windows) > 0 {
+		return nil
+	}
+	values := map[string][]float64{}
+	useCache := !s.bindLimits.enabled()
+	var missing []string
+	for _, nodeName := range nodes {
+		if found, ok := profile.prefetched.get(nodeName, prefetchMaxAgeIntervals*profile.PrefetchInterval); ok {
+			values[nodeName] = found
+			continue
+		}
+		if useCache {
+			if found, ok := s.cachedMetrics(ctx, profile, nodeName); ok {
+				values[nodeName] = found
+				continue
+			}
+		}
+		missing = append(missing, nodeName)
+	}
+	if len(missing) < 2 {
+		return values
+	}
+
+	for nodeName, found := range s.fetchBatch(ctx, profile, missing) {
+		values[nodeName] = found
+		if useCache {
+			s.cacheMetrics(ctx, profile, nodeName, found)
+		}
+	}
+	return values
+}
+
+// Reads the metrics of the nodes in one request of the batch provider of the profile, retrying
+// transient errors. Returns the values of the nodes found, nil if the request failed.
+func (s *Scheduler) fetchBatch(ctx context.Context, profile *Profile, nodes []string) (values map[string][]float64) {
+	provider, ok := profile.provider.(metrics.BatchProvider)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.config.MetricsTimeout)
+	defer cancel()
+
+	err := withRetries(ctx, s.config.Retry, func() (err error) {
+		if err = s.limits.of(profile).waitMetrics(ctx); err != nil {
+			return
+		}
+		values, err = provider.NodesMetrics(ctx, nodes, profile.metricNames)
+		return
+	})
+	if err == metrics.BatchUnsupported {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error reading the metrics of %d nodes at once, reading them one by one: %s", len(nodes), err)
+		return nil
+	}
+	batchRequests.Add(1)
+	batchedNodes.Add(int64(len(values)))
+	for nodeName, found := range values {
+		s.breakers.record(nodeName, nil)
+		values[nodeName] = profile.smooth(nodeName, found)
+	}
+	return
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/sysdig/sysdigtest"
+)
+
+// Schedules made-up pods on made-up nodes, against an in-memory Kubernetes api and the Sysdig
+// mock, and prints the throughput, the latency of the attempts and the api calls they made
+func (s *Scheduler) runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	podCount := flags.Int("pods", 1000, "Number of pods to schedule")
+	nodeCount := flags.Int("nodes", 100, "Number of nodes of the cluster")
+	metricNames := flags.String("metric", "cpu.used.percent,memory.used.percent", "Comma separated metrics of the profile")
+	strategy := flags.String("strategy", strategySpread, "spread or binpack")
+	latency := flags.Duration("metrics-latency", 5*time.Millisecond, "Delay of every answer of the Sysdig mock")
+	configFile := flags.String("c", "", "Configuration file, to bench its first profile instead of -metric and -strategy")
+	seed := flags.Int64("seed", 0, "Seed of the random jitters and faults, the one of the configuration or the time by default")
+	flags.Parse(args)
+
+	if *configFile != "" {
+		var err error
+		if s.config, err = LoadConfig(*configFile); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+	} else {
+		profile := &Profile{Name: "bench", SchedulerName: "bench", Strategy: *strategy}
+		for _, name := range strings.Split(*metricNames, ",") {
+			profile.Metrics = append(profile.Metrics, MetricConfig{Name: strings.TrimSpace(name)})
+		}
+		if err := profile.init(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+		s.config.Profiles = []*Profile{profile}
+		s.config.setDefaults()
+	}
+	if *seed != 0 {
+		s.config.Seed = *seed
+	}
+	seedRandom(s.config.Seed)
+	profile := s.config.Profiles[0]
+
+	mock := httptest.NewServer(&sysdigtest.Mock{Generate: demoValue, Latency: *latency})
+	defer mock.Close()
+	s.sysdigAPI.SetURL(mock.URL)
+	s.sysdigAPI.SetToken("bench")
+	provider, err := s.newProvider(profile.providerConfig(s.config))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	profile.setProvider(s, provider)
+
+	cluster := newBenchCluster(*nodeCount)
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+	if err := s.useBenchCluster(server.URL); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	// The attempts log every decision
+	log.SetOutput(ioutil.Discard)
+	latencies := make([]time.Duration, *podCount)
+	slots := make(chan struct{}, s.config.SchedulingConcurrency)
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	for i := 0; i < *podCount; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			pod := cluster.addPod(fmt.Sprintf("bench-%d", i), profile.SchedulerName)
+			ctx, cancel := context.WithTimeout(context.Background(), s.config.SchedulingTimeout)
+			defer cancel()
+			attempt := time.Now()
+			s.schedulePod(ctx, profile, pod)
+			latencies[i] = time.Since(attempt)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	log.SetOutput(os.Stderr)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	fmt.Printf("Pods:       %d on %d nodes, %d bound\n", *podCount, *nodeCount, cluster.boundPods())
+	fmt.Printf("Throughput: %.1f pods/s\n", float64(*podCount)/elapsed.Seconds())
+	fmt.Printf("Latency:    p50 %s, p99 %s, max %s\n", percentile(latencies, 0.50), percentile(latencies, 0.99), percentile(latencies, 1))
+	fmt.Println("Api calls:")
+	for _, call := range cluster.sortedCalls() {
+		fmt.Printf("  %-40s %d\n", call, cluster.calls[call])
+	}
+}
+
+// Returns the duration of the sorted list the share of them are below, rounded to 0.1ms
+func percentile(sorted []time.Duration, share float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(share*float64(len(sorted)-1))].Round(100 * time.Microsecond)
+}
+
+// In-memory Kubernetes api with the nodes and pods of the bench, counting the calls. The pods
+// are indexed by namespace/name.
+type benchCluster struct {
+	mutex sync.Mutex
+	nodes []kubernetes.KubeNode
+	pods  map[string]*kubernetes.KubePod
+	calls map[string]int
+}
+
+func newBenchCluster(nodeCount int) *benchCluster {
+	cluster := &benchCluster{pods: map[string]*kubernetes.KubePod{}, calls: map[string]int{}}
+	for i := 0; i < nodeCount; i++ {
+		node := kubernetes.KubeNode{}
+		node.Metadata.Name = fmt.Sprintf("node-%d", i)
+		node.Metadata.Labels = map[string]string{"kubernetes.io/hostname": node.Metadata.Name}
+		node.Status.Allocatable = map[string]string{"cpu": "64", "memory": "256Gi", "pods": "1000"}
+		node.Status.Conditions = []kubernetes.KubeNodeStatusConditions{{Type: "Ready", Status: "True"}}
+		cluster.nodes = append(cluster.nodes, node)
+	}
+	return cluster
+}
+
+// Adds a pending pod of the scheduler
+func (c *benchCluster) addPod(name, schedulerName string) kubernetes.KubePod {
+	pod := kubernetes.KubePod{}
+	pod.Metadata.Name = name
+	pod.Metadata.Namespace = "bench"
+	pod.Metadata.UID = name
+	pod.Metadata.CreationTimestamp = time.Now()
+	pod.Spec.SchedulerName = schedulerName
+	pod.Status.Phase = "Pending"
+	c.add(pod)
+	return pod
+}
+
+func (c *benchCluster) add(pod kubernetes.KubePod) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.pods[pod.Metadata.Namespace+"/"+pod.Metadata.Name] = &pod
+}
+
+func (c *benchCluster) boundPods() (bound int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, pod := range c.pods {
+		if pod.Spec.NodeName != "" {
+			bound++
+		}
+	}
+	return
+}
+
+// Returns the api calls made, sorted
+func (c *benchCluster) sortedCalls() (calls []string) {
+	for call := range c.calls {
+		calls = append(calls, call)
+	}
+	sort.Strings(calls)
+	return
+}
+
+func (c *benchCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	// The names of the objects are left out of the counted calls
+	resource := parts[len(parts)-1]
+	if len(parts) == 6 && parts[4] == "pods" {
+		resource = "pods/NAME"
+	}
+	call := r.Method + " " + resource
+	c.calls[call]++
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/v1/nodes":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"metadata": map[string]string{}, "items": c.nodes})
+	case r.Method == "GET" && r.URL.Path == "/api/v1/pods":
+		var assigned []kubernetes.KubePod
+		for _, pod := range c.pods {
+			if pod.Spec.NodeName != "" {
+				assigned = append(assigned, *pod)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"metadata": map[string]string{}, "items": assigned})
+	case r.Method == "GET" && resource == "pods/NAME":
+		if pod, ok := c.pods[parts[3]+"/"+parts[5]]; ok {
+			writeJSON(w, http.StatusOK, pod)
+			return
+		}
+		writeJSON(w, http.StatusNotFound, map[string]string{"reason": "NotFound"})
+	case r.Method == "POST" && resource == "bindings" && len(parts) == 5:
+		var binding struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Target struct {
+				Name string `json:"name"`
+			} `json:"target"`
+		}
+		json.NewDecoder(r.Body).Decode(&binding)
+		pod, ok := c.pods[parts[3]+"/"+binding.Metadata.Name]
+		if !ok || pod.Spec.NodeName != "" {
+			writeJSON(w, http.StatusConflict, map[string]string{"reason": "Conflict"})
+			return
+		}
+		pod.Spec.NodeName = binding.Target.Name
+		writeJSON(w, http.StatusCreated, binding)
+	case r.Method == "POST":
+		writeJSON(w, http.StatusCreated, map[string]string{})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"reason": "NotFound"})
+	}
+}
+
+// Points the Kubernetes client to the bench api, with a kubeconfig file written for it
+func (s *Scheduler) useBenchCluster(url string) error {
+	file, err := ioutil.TempFile("", "bench-kubeconfig")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	fmt.Fprintf(file, `apiVersion: v1
+kind: Config
+clusters:
+  - name: bench
+    cluster: {server: %q}
+users:
+  - name: bench
+    user: {token: bench}
+contexts:
+  - name: bench
+    context: {cluster: bench, user: bench}
+current-context: bench
+`, url)
+	file.Close()
+	return s.kubeAPI.LoadKubeConfigFile(file.Name())
+}
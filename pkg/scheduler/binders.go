@@ -0,0 +1,75 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+
+	"github.com/draios/kubernetes-scheduler/pkg/binding"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Backends of the binders
+const (
+	binderVirtualKubelet = "virtual-kubelet"
+	binderPlacement      = "placement"
+)
+
+// Pods bound by backend, "kubernetes" for the Binding subresource
+var bindingBackends = expvar.NewMap("bindingBackends")
+
+func (c BinderConfig) validate() error {
+	switch c.Type {
+	case binderVirtualKubelet:
+	case binderPlacement:
+		if c.URL == "" {
+			return errors.New("binders: the placement url must be set")
+		}
+		if c.Selector == nil {
+			return errors.New("binders: the nodes of the placement service must be selected")
+		}
+	default:
+		return fmt.Errorf("binders: unknown type %q", c.Type)
+	}
+	return nil
+}
+
+// Returns the backend of the binder, the virtual kubelets being annotated with the client
+func (c BinderConfig) binder(api *kubernetes.KubernetesCoreV1Api) binding.Binder {
+	if c.Type == binderPlacement {
+		return &binding.Placement{URL: c.URL, Headers: c.Headers}
+	}
+	return &binding.VirtualKubelet{API: api, Annotations: c.Annotations}
+}
+
+// Returns the binder of the first configuration selecting the node, and the name of its backend.
+// The other nodes, and the nodes that can't be read, are bound with the Binding subresource.
+func (s *Scheduler) binderFor(ctx context.Context, nodeName string) (binding.Binder, string) {
+	if len(s.config.Binders) > 0 {
+		if node, err := s.findNode(ctx, nodeName); err == nil {
+			for _, c := range s.config.Binders {
+				if c.Selector.Matches(node.Metadata.Labels) {
+					return c.binder(&s.kubeAPI), c.Type
+				}
+			}
+		}
+	}
+	return &binding.Kubernetes{API: &s.kubeAPI}, "kubernetes"
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Maximum length of the message of an event accepted by the api server
+const maxEventMessage = 1024
+
+// Number of best candidates detailed in the Scheduled event
+const scheduledTopNodes = 3
+
+// Records the Scheduled event on a bound pod, with the breakdown of the decision
+func (s *Scheduler) reportScheduled(ctx context.Context, profile *Profile, pod kubernetes.KubePod, record *auditRecord) {
+	s.reportPodEvent(ctx, pod, "Normal", "Scheduled", scheduledMessage(profile, record))
+}
+
+// Returns the message of the Scheduled event: the node, the best candidates with their score and
+// metric values, and the nodes rejected by every filter. The end of the lists is cut to fit.
+func scheduledMessage(profile *Profile, record *auditRecord) string {
+	parts := []string{fmt.Sprintf("Successfully assigned %s/%s to %s (%s, decision %s)", record.Namespace, record.Pod, record.Node, record.Outcome, record.ID)}
+
+	var scored, failed []auditCandidate
+	for _, candidate := range record.Candidates {
+		if candidate.Score == nil {
+			failed = append(failed, candidate)
+		} else {
+			scored = append(scored, candidate)
+		}
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		if profile.lowerIsBetter() {
+			return *scored[i].Score < *scored[j].Score
+		}
+		return *scored[i].Score > *scored[j].Score
+	})
+	if len(scored) > scheduledTopNodes {
+		scored = scored[:scheduledTopNodes]
+	}
+	var top []string
+	for _, candidate := range scored {
+		var values []string
+		names := record.Metrics
+		if candidate.MetricNames != nil {
+			names = candidate.MetricNames
+		}
+		for m, value := range candidate.Metrics {
+			if m < len(names) {
+				values = append(values, fmt.Sprintf("%s=%.4g", names[m], value))
+			}
+		}
+		top = append(top, fmt.Sprintf("%s %.4g [%s]", candidate.Node, *candidate.Score, strings.Join(values, " ")))
+	}
+	if len(top) > 0 {
+		parts = append(parts, "top: "+strings.Join(top, ", "))
+	}
+
+	// The rejected nodes are grouped by the filter before the reason
+	byFilter := map[string][]string{}
+	for node, reason := range record.Rejected {
+		filter := strings.SplitN(reason, ":", 2)[0]
+		byFilter[filter] = append(byFilter[filter], node)
+	}
+	for _, candidate := range failed {
+		byFilter["Metrics"] = append(byFilter["Metrics"], candidate.Node)
+	}
+	var filterNames []string
+	for filter := range byFilter {
+		filterNames = append(filterNames, filter)
+	}
+	sort.Strings(filterNames)
+	for _, filter := range filterNames {
+		nodes := byFilter[filter]
+		sort.Strings(nodes)
+		parts = append(parts, fmt.Sprintf("rejected by %s (%d): %s", filter, len(nodes), strings.Join(nodes, ", ")))
+	}
+
+	message := strings.Join(parts, "; ")
+	if len(message) > maxEventMessage {
+		message = message[:maxEventMessage-3] + "..."
+	}
+	return message
+}
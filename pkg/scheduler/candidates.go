@@ -0,0 +1,118 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/binding"
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Pods bound to another candidate because the binding to their best node failed
+var bindFallbacks = expvar.NewInt("bindFallbacks")
+
+// Returns the best node followed by the other scored candidates, from the best to the worst
+func rankedCandidates(profile *Profile, best Node, scored NodeList) []Node {
+	candidates := []Node{best}
+	var others NodeList
+	for _, node := range scored {
+		if node.err == nil && node.name != best.name {
+			others = append(others, node)
+		}
+	}
+	sort.SliceStable(others, func(i, j int) bool {
+		if profile.lowerIsBetter() {
+			return others[i].score < others[j].score
+		}
+		return others[i].score > others[j].score
+	})
+	return append(candidates, others...)
+}
+
+// Binds the pod to the first of the ranked candidates taking it, up to BindFallbacks of them after
+// the best one. The next candidate is tried when the node changed before the binding or the api
+// server answered a conflict while the pod is still unbound. Returns the node bound, or the last
+// one tried, and the candidates given up with their reason.
+func (s *Scheduler) bindCandidates(ctx context.Context, profile *Profile, pod kubernetes.KubePod, candidates []Node, check bool) (node Node, fallbacks []string, err error) {
+	if len(candidates) > s.config.BindFallbacks+1 {
+		candidates = candidates[:s.config.BindFallbacks+1]
+	}
+	var checkCtx context.Context
+	if check {
+		var cancel context.CancelFunc
+		checkCtx, cancel = context.WithTimeout(ctx, s.config.PreBind.Budget)
+		defer cancel()
+	}
+
+	for _, node = range candidates {
+		if err = s.bindCandidate(ctx, checkCtx, profile, pod, node.name); err == nil || !retryableBinding(err) {
+			break
+		}
+		log.Printf("Binding %s to %s failed, trying the next candidate: %s", pod.Metadata.Name, node.name, err)
+		fallbacks = append(fallbacks, fmt.Sprintf("%s: %s", node.name, err))
+	}
+	if err == nil && len(fallbacks) > 0 {
+		bindFallbacks.Add(1)
+		message := fmt.Sprintf("Bound to %s after %d fallback(s): %s", node.name, len(fallbacks), strings.Join(fallbacks, "; "))
+		log.Printf("Pod %s %s", pod.Metadata.Name, message)
+		s.reportPodEvent(ctx, pod, "Normal", "BindFallback", message)
+	}
+	return
+}
+
+// Checks the node again if checkCtx is set, reserves it and binds the pod to it. Once checkCtx is
+// done the node is bound unchecked.
+func (s *Scheduler) bindCandidate(ctx, checkCtx context.Context, profile *Profile, pod kubernetes.KubePod, nodeName string) error {
+	if checkCtx != nil {
+		err := s.validateNode(checkCtx, profile, nodeName)
+		if err != nil && checkCtx.Err() != nil {
+			log.Printf("Pre-binding checks of %s out of budget, binding %s unchecked", pod.Metadata.Name, nodeName)
+		} else if err != nil {
+			return &failure.Error{Reason: failure.NodeChanged, Phase: failure.Bind, Node: nodeName,
+				Err: fmt.Errorf("node %s %s", nodeName, err)}
+		}
+	}
+	// The node is checked again with the reservations of the pods being bound meanwhile
+	if err := s.reservations.reserve(ctx, pod, nodeName); err != nil {
+		return &failure.Error{Reason: failure.NodeChanged, Phase: failure.Bind, Node: nodeName, Err: err}
+	}
+	s.annotateReservation(ctx, pod, nodeName)
+	if err := s.bindPod(ctx, pod, nodeName); err != nil {
+		s.reservations.release(pod)
+		return err
+	}
+	return nil
+}
+
+// Returns true if the binding may succeed on another candidate
+func retryableBinding(err error) bool {
+	return failure.ReasonOf(err) == failure.NodeChanged || transientConflict(err)
+}
+
+// Returns true for a conflict answered while the pod is still unbound and not deleted
+func transientConflict(err error) bool {
+	var conflict binding.Conflict
+	return errors.As(err, &conflict) && !conflict.Gone && conflict.Node == ""
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Resources of the capacity report, the memory being reported in GiB
+var capacityResources = []string{"cpu", "memory", "pods"}
+
+// Allocatable and requested resources of a node or a zone, with the utilization metrics of the
+// profile, averaged over the nodes of a zone
+type capacityRow struct {
+	Node        string             `json:"node,omitempty"`
+	Zone        string             `json:"zone"`
+	Nodes       int                `json:"nodes,omitempty"`
+	Allocatable resourceList       `json:"allocatable"`
+	Requested   resourceList       `json:"requested"`
+	Metrics     map[string]float64 `json:"metrics,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+type capacityReport struct {
+	Nodes []capacityRow `json:"nodes"`
+	Zones []capacityRow `json:"zones"`
+}
+
+// Prints the allocatable resources, the requests and the utilization metrics of the ready nodes
+// and of their zones, for capacity planning
+func (s *Scheduler) runCapacity(args []string) {
+	flags := flag.NewFlagSet("capacity", flag.ExitOnError)
+	profileFlags := newProfileFlags(flags)
+	output := flags.String("o", "table", "Output format: table, json or csv")
+	flags.Parse(args)
+
+	if *output != "table" && *output != "json" && *output != "csv" {
+		fmt.Printf("Error: unknown output %q\n", *output)
+		os.Exit(2)
+	}
+	profile := profileFlags.load(s, flags, "capacity")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.SchedulingTimeout)
+	defer cancel()
+	report, err := s.capacityOf(ctx, profile)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	case "csv":
+		writer := csv.NewWriter(os.Stdout)
+		writer.WriteAll(report.rows(profile))
+	default:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, row := range report.rows(profile) {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		writer.Flush()
+	}
+}
+
+// Returns the capacity of the ready nodes selected by the configuration, their metrics read with
+// the profile, and the sums of their zones
+func (s *Scheduler) capacityOf(ctx context.Context, profile *Profile) (report capacityReport, err error) {
+	requested, err := s.requestedByNode(ctx)
+	if err != nil {
+		return
+	}
+	nodes := s.nodesAvailable(ctx)
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.Metadata.Name)
+	}
+	scored := map[string]Node{}
+	for _, node := range s.scoreNodes(ctx, profile, kubernetes.KubePod{}, names) {
+		scored[node.name] = node
+	}
+
+	zones := map[string]*capacityRow{}
+	metricCounts := map[string]map[string]int{}
+	for _, node := range nodes {
+		name := node.Metadata.Name
+		row := capacityRow{Node: name, Zone: nodeZone(node), Allocatable: resourceList{}, Requested: resourceList{}}
+		allocatable := parseResourceList(node.Status.Allocatable)
+		for _, resource := range capacityResources {
+			row.Allocatable[resource] = allocatable[resource]
+			row.Requested[resource] = requested[name][resource]
+		}
+		if result, ok := scored[name]; ok && result.err != nil {
+			row.Error = result.err.Error()
+		} else if ok {
+			row.Metrics = map[string]float64{}
+			for i, metric := range result.metricNames(profile) {
+				row.Metrics[metric] = result.metrics[i]
+			}
+		}
+		report.Nodes = append(report.Nodes, row)
+
+		zone, ok := zones[row.Zone]
+		if !ok {
+			zone = &capacityRow{Zone: row.Zone, Allocatable: resourceList{}, Requested: resourceList{}, Metrics: map[string]float64{}}
+			zones[row.Zone] = zone
+			metricCounts[row.Zone] = map[string]int{}
+		}
+		zone.Nodes++
+		zone.Allocatable.add(row.Allocatable)
+		zone.Requested.add(row.Requested)
+		for metric, value := range row.Metrics {
+			zone.Metrics[metric] += value
+			metricCounts[row.Zone][metric]++
+		}
+	}
+
+	for name, zone := range zones {
+		for metric, count := range metricCounts[name] {
+			zone.Metrics[metric] /= float64(count)
+		}
+		report.Zones = append(report.Zones, *zone)
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool {
+		if report.Nodes[i].Zone != report.Nodes[j].Zone {
+			return report.Nodes[i].Zone < report.Nodes[j].Zone
+		}
+		return report.Nodes[i].Node < report.Nodes[j].Node
+	})
+	sort.Slice(report.Zones, func(i, j int) bool { return report.Zones[i].Zone < report.Zones[j].Zone })
+	return
+}
+
+// Returns the header and the rows of the table and csv outputs, the nodes then the zones
+func (r capacityReport) rows(profile *Profile) (rows [][]string) {
+	header := []string{"SCOPE", "NAME", "ZONE"}
+	for _, resource := range capacityResources {
+		name := strings.ToUpper(resource)
+		if resource == "memory" {
+			name += " GiB"
+		}
+		header = append(header, name+" ALLOCATABLE", name+" REQUESTED", name+" REQUESTED %")
+	}
+	// The metrics of the node pools are listed after the ones of the profile
+	metrics := append([]string(nil), profile.metricNames...)
+	for _, pool := range profile.pools {
+		for _, name := range pool.profile.metricNames {
+			if !containsString(metrics, name) {
+				metrics = append(metrics, name)
+			}
+		}
+	}
+	for _, metric := range metrics {
+		header = append(header, strings.ToUpper(metric))
+	}
+	rows = append(rows, append(header, "ERROR"))
+
+	add := func(scope, name string, row capacityRow) {
+		values := []string{scope, name, row.Zone}
+		if row.Zone == "" {
+			values[2] = "-"
+		}
+		for _, resource := range capacityResources {
+			allocatable, requested := row.Allocatable[resource], row.Requested[resource]
+			if resource == "memory" {
+				allocatable, requested = allocatable/(1<<30), requested/(1<<30)
+			}
+			percent := "-"
+			if allocatable > 0 {
+				percent = fmt.Sprintf("%.1f", requested/allocatable*100)
+			}
+			values = append(values, fmt.Sprintf("%.4g", allocatable), fmt.Sprintf("%.4g", requested), percent)
+		}
+		for _, metric := range metrics {
+			if value, ok := row.Metrics[metric]; ok {
+				values = append(values, fmt.Sprintf("%.4g", value))
+			} else {
+				values = append(values, "-")
+			}
+		}
+		rows = append(rows, append(values, row.Error))
+	}
+	for _, row := range r.Nodes {
+		add("node", row.Node, row)
+	}
+	for _, row := range r.Zones {
+		add("zone", fmt.Sprintf("%d nodes", row.Nodes), row)
+	}
+	return
+}
+
+// Returns true if the list contains the value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Annotation of the pods that must avoid the spot and preemptible nodes
+const criticalAnnotation = "sysdig-scheduler/critical"
+
+// Penalty of a spot node for a critical pod when the scorer doesn't set one
+const defaultSpotPenalty = 100
+
+// Labels set by the cloud providers and the node provisioners on the spot and preemptible nodes
+var spotLabels = map[string]string{
+	"karpenter.sh/capacity-type":            "spot",
+	"eks.amazonaws.com/capacityType":        "SPOT",
+	"cloud.google.com/gke-spot":             "true",
+	"cloud.google.com/gke-preemptible":      "true",
+	"kubernetes.azure.com/scalesetpriority": "spot",
+	"node.kubernetes.io/lifecycle":          "spot",
+	"node-role.kubernetes.io/spot-worker":   "true",
+	"sigs.k8s.io/cluster-api-capacity-type": "spot",
+}
+
+// Generation of an instance type: m5.large and c6gn.xlarge on AWS, n2-standard-4 on GCP and
+// Standard_D4s_v5 on Azure
+var instanceGenerations = []*regexp.Regexp{
+	regexp.MustCompile(`^[a-z]+([0-9]+)[a-z0-9-]*\.[a-z0-9]+$`),
+	regexp.MustCompile(`^[a-z]+([0-9]+)[a-z]?-[a-z]+`),
+	regexp.MustCompile(`^Standard_.+_v([0-9]+)$`),
+}
+
+// Returns true if the labels of the node mark it as a spot or preemptible instance
+func isSpotNode(labels map[string]string) bool {
+	for label, value := range spotLabels {
+		if labels[label] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the generation of the instance type, 0 if it is not known
+func instanceGeneration(instanceType string) int {
+	for _, expression := range instanceGenerations {
+		if match := expression.FindStringSubmatch(instanceType); match != nil {
+			generation, _ := strconv.Atoi(match[1])
+			return generation
+		}
+	}
+	if strings.HasPrefix(instanceType, "Standard_") {
+		return 1 // Azure sizes without a version suffix are the first one
+	}
+	return 0
+}
+
+// Scores the nodes with the cloud metadata of their labels, lower is better: SpotPenalty on the
+// spot and preemptible nodes for the pods with the sysdig-scheduler/critical annotation, plus
+// GenerationPenalty for every instance generation the node is behind the newest of the cluster.
+type cloudNodeScorer struct {
+	schedulerScorer
+	spotPenalty       float64
+	generationPenalty float64
+}
+
+func (s *cloudNodeScorer) Name() string {
+	return "cloud-node"
+}
+
+func (s *cloudNodeScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (score float64, err error) {
+	if critical, _ := strconv.ParseBool(pod.Annotations[criticalAnnotation]); critical && isSpotNode(node.Labels) {
+		score += s.spotPenalty
+	}
+	if s.generationPenalty == 0 {
+		return
+	}
+	generation := instanceGeneration(node.Labels[scoring.InstanceTypeLabel])
+	if generation == 0 {
+		return
+	}
+	newest := generation
+	for _, other := range s.scheduler.allReadyNodes(ctx) {
+		if g := instanceGeneration(other.Metadata.Labels[scoring.InstanceTypeLabel]); g > newest {
+			newest = g
+		}
+	}
+	score += s.generationPenalty * float64(newest-generation)
+	return
+}
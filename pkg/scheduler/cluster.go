@@ -0,0 +1,202 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/cache"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotation set on the copies of the pods placed in another cluster
+const sourceClusterAnnotation = "sysdig-scheduler/source-cluster"
+
+// Api server of a cluster the profiles can burst to, with its ready nodes cached
+type remoteCluster struct {
+	scheduler *Scheduler
+	name      string
+	api       *kubernetes.KubernetesCoreV1Api
+	nodes     cache.Cache
+}
+
+// A node of a remote cluster
+type clusterNode struct {
+	cluster *remoteCluster
+	node    Node
+}
+
+// Connects to the clusters of the configuration
+func (s *Scheduler) loadClusters(c Config) error {
+	for _, cluster := range c.Clusters {
+		api := &kubernetes.KubernetesCoreV1Api{}
+		if err := api.LoadKubeConfigFile(cluster.Kubeconfig); err != nil {
+			return fmt.Errorf("cluster %s: %s", cluster.Name, err)
+		}
+		if cluster.Context != "" {
+			if err := api.UseContext(cluster.Context); err != nil {
+				return fmt.Errorf("cluster %s: %s", cluster.Name, err)
+			}
+		}
+		s.clusters[cluster.Name] = &remoteCluster{scheduler: s, name: cluster.Name, api: api, nodes: cache.Cache{Timeout: 15 * time.Second}}
+	}
+	return nil
+}
+
+// Returns the ready nodes of the cluster, without the cordoned ones and those in maintenance
+func (c *remoteCluster) readyNodes(ctx context.Context) []kubernetes.KubeNode {
+	if nodes, ok := c.nodes.Data(); ok {
+		return nodes.([]kubernetes.KubeNode)
+	}
+	nodes, err := c.api.ListNodes(ctx)
+	if err != nil {
+		log.Printf("cluster %s: error while listing the nodes: %s", c.name, err)
+		return nil
+	}
+	var ready []kubernetes.KubeNode
+	now := time.Now()
+	for _, node := range onlyReady(nodes) {
+		if nodeSchedulable(node, now) == nil && len(c.scheduler.nodeConditionsWith(node, conditionReject)) == 0 {
+			ready = append(ready, node)
+		}
+	}
+	c.nodes.SetData(ready)
+	return ready
+}
+
+// Returns the best node of the remote clusters of the profile if it beats the local best node,
+// or if there is no local node. The scores of separate lists can't be compared under the
+// normalizations over the nodes, so the local nodes scored with the profile and the remote
+// ones are scored again together from their raw values. Only pods without a controller can
+// move: the controller would create the pod again in the local cluster.
+func (s *Scheduler) bestRemoteNode(ctx context.Context, profile *Profile, pod kubernetes.KubePod, scored NodeList, local Node, hasLocal bool) (best clusterNode, ok bool) {
+	if _, controlled := controllerOf(pod); controlled || len(profile.Clusters) == 0 {
+		return
+	}
+
+	// The local nodes first, then the remote ones in the order of remotes
+	var combined NodeList
+	for _, node := range scored {
+		// The nodes of a pool have other metrics
+		if node.err == nil && node.names == nil {
+			combined = append(combined, node)
+		}
+	}
+	locals := len(combined)
+	var remotes []*remoteCluster
+	for _, name := range profile.Clusters {
+		cluster := s.clusters[name]
+		var names []string
+		for _, node := range cluster.readyNodes(ctx) {
+			names = append(names, node.Metadata.Name)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		for _, node := range s.scoreNodes(ctx, profile, pod, names) {
+			if node.err == nil {
+				combined = append(combined, node)
+				remotes = append(remotes, cluster)
+			}
+		}
+	}
+	if len(remotes) == 0 {
+		return
+	}
+
+	scoreList(profile, combined)
+	if profile.WindowConsensus == consensusRank {
+		rankConsensus(profile, combined)
+	}
+	for i, cluster := range remotes {
+		node := combined[locals+i]
+		if node.err == nil && (!ok || better(profile, node, best.node)) {
+			best, ok = clusterNode{cluster: cluster, node: node}, true
+		}
+	}
+	if !ok || !hasLocal {
+		return
+	}
+	for _, node := range combined[:locals] {
+		if node.name == local.name {
+			return best, node.err != nil || better(profile, best.node, node)
+		}
+	}
+	// The local node was not scored with the profile, it can't be compared
+	return best, false
+}
+
+// Returns true if a has a better score than b for the profile strategy
+func better(profile *Profile, a, b Node) bool {
+	if profile.lowerIsBetter() {
+		return a.score < b.score
+	}
+	return a.score > b.score
+}
+
+// Creates a copy of the pod on the node of the remote cluster and deletes the local one. If the
+// local pod can't be deleted the copy is deleted, so the pod never runs in both clusters.
+func (s *Scheduler) placeInCluster(ctx context.Context, target clusterNode, pod kubernetes.KubePod) error {
+	object, err := s.kubeAPI.GetPodObject(ctx, pod.Metadata.Namespace, pod.Metadata.Name)
+	if err != nil {
+		return err
+	}
+
+	// Only the fields the user set are copied
+	metadata, _ := object["metadata"].(map[string]interface{})
+	copied := map[string]interface{}{"name": pod.Metadata.Name, "namespace": pod.Metadata.Namespace}
+	for _, field := range []string{"labels", "annotations"} {
+		if value, ok := metadata[field]; ok {
+			copied[field] = value
+		}
+	}
+	annotations, _ := copied["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = map[string]interface{}{}
+	}
+	annotations[sourceClusterAnnotation] = "local"
+	copied["annotations"] = annotations
+
+	spec, _ := object["spec"].(map[string]interface{})
+	if spec == nil {
+		return fmt.Errorf("pod %s has no spec", pod.Metadata.Name)
+	}
+	spec["nodeName"] = target.node.name
+
+	remote := map[string]interface{}{"apiVersion": "v1", "kind": "Pod", "metadata": copied, "spec": spec}
+	if err := target.cluster.api.CreatePod(ctx, pod.Metadata.Namespace, remote); err != nil {
+		return fmt.Errorf("cluster %s: %s", target.cluster.name, err)
+	}
+	err = s.kubeAPI.DeletePod(ctx, pod.Metadata.Namespace, pod.Metadata.Name)
+	if statusError, ok := err.(*kubernetes.StatusError); ok && statusError.Code == 404 {
+		// Deleted meanwhile, only the copy is left
+		return nil
+	}
+	if err != nil {
+		// The attempt may be out of time already
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.config.SchedulingTimeout)
+		defer cancel()
+		if cleanupErr := target.cluster.api.DeletePod(cleanupCtx, pod.Metadata.Namespace, pod.Metadata.Name); cleanupErr != nil {
+			return fmt.Errorf("deleting the local pod: %s, and its copy in cluster %s: %s", err, target.cluster.name, cleanupErr)
+		}
+		return fmt.Errorf("deleting the local pod, its copy in cluster %s was deleted: %s", target.cluster.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+// Commands run instead of the scheduler when named as the first argument
+var commands = map[string]func(args []string){
+	"bench":    withScheduler((*Scheduler).runBench),
+	"capacity": withScheduler((*Scheduler).runCapacity),
+	"config":   runConfig,
+	"webhook":  runWebhook,
+	"install":  withScheduler((*Scheduler).runInstall),
+	"explain":  runExplain,
+	"history":  withScheduler((*Scheduler).runHistory),
+	"score":    withScheduler((*Scheduler).runScore),
+	"simulate": withScheduler((*Scheduler).runSimulate),
+	"schedule": runSchedule,
+	"replay":   withScheduler((*Scheduler).runReplay),
+}
+
+// Runs a command with a scheduler of its own, whose clients and configuration it loads
+func withScheduler(command func(s *Scheduler, args []string)) func(args []string) {
+	return func(args []string) {
+		command(newScheduler(), args)
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"log"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Version of the api server the scheduler talks to, empty until read
+var kubernetesVersion = expvar.NewString("kubernetesVersion")
+
+// Reads the version of the api server so the requests are adapted to it. An unsupported version is
+// an error; an api server not answering is assumed to be of the newest version.
+func (s *Scheduler) detectKubernetesVersion(ctx context.Context) error {
+	version, err := s.kubeAPI.DetectVersion(ctx)
+	if unsupported, ok := err.(kubernetes.UnsupportedVersionError); ok {
+		return unsupported
+	}
+	if err != nil {
+		log.Printf("Error reading the version of the api server, the newest apis are used: %s", err)
+		return nil
+	}
+	log.Printf("Kubernetes %s", version.GitVersion)
+	kubernetesVersion.Set(version.GitVersion)
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// What is done with the nodes having a condition set to True
+const (
+	conditionReject   = "reject"
+	conditionPenalize = "penalize"
+	conditionIgnore   = "ignore"
+)
+
+// Node conditions checked by default besides Ready, the nodes with one of them are rejected.
+// KernelDeadlock and ReadonlyFilesystem are only set by Node Problem Detector.
+var defaultNodeConditions = map[string]string{
+	"MemoryPressure":     conditionReject,
+	"DiskPressure":       conditionReject,
+	"PIDPressure":        conditionReject,
+	"NetworkUnavailable": conditionReject,
+	"KernelDeadlock":     conditionReject,
+	"ReadonlyFilesystem": conditionReject,
+}
+
+func validateNodeConditions(conditions map[string]string) error {
+	for condition, action := range conditions {
+		switch action {
+		case conditionReject, conditionPenalize, conditionIgnore:
+		default:
+			return fmt.Errorf("node condition %s: unknown action %q", condition, action)
+		}
+	}
+	return nil
+}
+
+// Returns the conditions of the node that are True and have the action, sorted
+func (s *Scheduler) nodeConditionsWith(node kubernetes.KubeNode, action string) (conditions []string) {
+	for _, status := range node.Status.Conditions {
+		if status.Status == "True" && s.config.NodeConditions[status.Type] == action {
+			conditions = append(conditions, status.Type)
+		}
+	}
+	sort.Strings(conditions)
+	return
+}
+
+// Rejects the nodes with a condition to reject, like MemoryPressure
+func nodeConditionsFilter(state *cycleState, node kubernetes.KubeNode) error {
+	if conditions := state.scheduler.nodeConditionsWith(node, conditionReject); len(conditions) > 0 {
+		return fmt.Errorf("node has %v", conditions)
+	}
+	return nil
+}
+
+// Leaves out the candidates with a condition to penalize while other candidates don't have any,
+// they are only chosen when no other node can take the pod
+func preferHealthyNodes(state *cycleState, candidates []string, rejected map[string]error) []string {
+	var healthy []string
+	penalized := map[string][]string{}
+	for _, name := range candidates {
+		node, _ := state.node(name)
+		if conditions := state.scheduler.nodeConditionsWith(node, conditionPenalize); len(conditions) > 0 {
+			penalized[name] = conditions
+		} else {
+			healthy = append(healthy, name)
+		}
+	}
+	if len(healthy) == 0 || len(penalized) == 0 {
+		return candidates
+	}
+	for name, conditions := range penalized {
+		rejected[name] = filterError{"NodeConditions", fmt.Errorf("node has %v and other nodes don't", conditions)}
+	}
+	return healthy
+}
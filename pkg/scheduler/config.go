@@ -0,0 +1,1572 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+	"gopkg.in/yaml.v2"
+)
+
+// Scheduling strategies
+const (
+	strategySpread  = "spread"  // The node with the lowest score is the best one
+	strategyBinpack = "binpack" // The node with the highest score is the best one
+)
+
+// Directions of a metric, the values that are better for a node regardless of the strategy
+const (
+	directionLower  = "lower"
+	directionHigher = "higher"
+)
+
+// Time given to the in-flight bindings to finish after a SIGTERM, below the
+// default terminationGracePeriodSeconds of 30s
+const defaultShutdownTimeout = 25 * time.Second
+
+// Config is the content of the configuration file provided with -c or SDC_CONFIG
+type Config struct {
+	Profiles   []*Profile      `yaml:"profiles"`
+	Namespaces NamespaceFilter `yaml:"namespaces"`
+
+	// NodeSelector restricts the nodes the pods are placed on, all the nodes if it is not set
+	NodeSelector *kubernetes.KubeLabelSelector `yaml:"nodeSelector"`
+
+	// NodeConditions are the actions on the nodes with a condition set to True, besides Ready:
+	// reject, penalize (chosen only when no other node is) or ignore
+	NodeConditions map[string]string `yaml:"nodeConditions"`
+	// UnschedulableConditions are condition types rejecting the nodes where they are True, like
+	// the ones of Node Problem Detector. An action of NodeConditions for the same type wins.
+	UnschedulableConditions []string `yaml:"unschedulableConditions"`
+
+	// OptInLabel is a label the pods must have, set to "true", to be scheduled, so pods naming the
+	// scheduler by mistake are not placed by it. Disabled if empty.
+	OptInLabel string `yaml:"optInLabel"`
+
+	// PreemptOtherSchedulers lets the preemption evict the pods of any scheduler, by default only
+	// the pods with the scheduler name of a profile are evicted
+	PreemptOtherSchedulers bool `yaml:"preemptOtherSchedulers"`
+
+	// Evictions are the checks of every pod evicted by the preemption or the descheduler
+	Evictions EvictionConfig `yaml:"evictions"`
+
+	// DefaultScheduler is the scheduler name the default-scheduler fallback hands the pods to
+	DefaultScheduler string `yaml:"defaultScheduler"`
+
+	// ShutdownTimeout is how long in-flight bindings are waited for on SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+
+	// SchedulingTimeout is the deadline of a whole scheduling attempt, from the node list to the binding
+	SchedulingTimeout time.Duration `yaml:"schedulingTimeout"`
+
+	// SchedulingConcurrency is the maximum number of pods being scheduled at the same time,
+	// the pending pods wait in a queue ordered by priority
+	SchedulingConcurrency int `yaml:"schedulingConcurrency"`
+
+	// GangRetryInterval is how often the pod groups waiting for capacity are tried again
+	GangRetryInterval time.Duration `yaml:"gangRetryInterval"`
+
+	// SchedulingDeadline is how long after its creation a pod that could not be placed is tried
+	// again, before it is marked unschedulable. Disabled if 0, the pods can set their own deadline.
+	SchedulingDeadline time.Duration `yaml:"schedulingDeadline"`
+
+	// RecoverPendingAfter is the age of the pending pods queued at startup with a Recovered event,
+	// left by a previous scheduler that crashed, 1m if unset
+	RecoverPendingAfter time.Duration `yaml:"recoverPendingAfter"`
+
+	// WarmUp keeps the nodes that just became Ready from attracting all the pending pods at once
+	WarmUp WarmUpConfig `yaml:"warmUp"`
+
+	// Flapping excludes the nodes going Ready and NotReady over and over
+	Flapping FlappingConfig `yaml:"flapping"`
+
+	// NodeScores publishes the last scores of every node for the other controllers
+	NodeScores NodeScoresConfig `yaml:"nodeScores"`
+
+	// ReserveAnnotation sets the sysdig-scheduler/reserved-node annotation on the pods before binding them
+	ReserveAnnotation bool `yaml:"reserveAnnotation"`
+	// DecisionAnnotation sets the sysdig-scheduler/decision-id annotation on the pods with the ID
+	// of their last scheduling attempt
+	DecisionAnnotation bool `yaml:"decisionAnnotation"`
+
+	// ClusterAutoscaler marks the pods no node can take unschedulable like the default scheduler,
+	// so the Cluster Autoscaler adds a node, and tries them again once a new node is ready
+	ClusterAutoscaler bool `yaml:"clusterAutoscaler"`
+	// Provisioning asks the node provisioners for a node when every candidate is past the thresholds
+	Provisioning ProvisioningConfig `yaml:"provisioning"`
+
+	// VPARecommendations checks the fit of the pods with the target recommendations of the
+	// VerticalPodAutoscaler of their workload when they are above their requests
+	VPARecommendations bool `yaml:"vpaRecommendations"`
+
+	// StatefulSetPinning places every StatefulSet ordinal back on the node it was last bound to,
+	// while the node passes the filters, for the workloads keeping their data on the node
+	StatefulSetPinning bool `yaml:"statefulSetPinning"`
+
+	// PreBind checks the chosen node again right before binding the pod to it
+	PreBind PreBindConfig `yaml:"preBind"`
+	// CheckResourceQuotas fails the pods of a namespace with an exceeded ResourceQuota before
+	// their nodes are scored, with a QuotaExceeded event
+	CheckResourceQuotas bool `yaml:"checkResourceQuotas"`
+	// BindFallbacks is the number of next candidates tried when the binding to the best node fails
+	// because the node changed or of a transient conflict, 3 by default
+	BindFallbacks int `yaml:"bindFallbacks"`
+
+	// MinimalRBAC turns off preemption and the other features needing more permissions than
+	// scheduling the pods, so the scheduler runs with the required permissions only
+	MinimalRBAC bool `yaml:"minimalRBAC"`
+
+	// Alerts reacts to the Sysdig alert notifications sent to the admin server
+	Alerts AlertsConfig `yaml:"alerts"`
+
+	// Trigger is what queues the pods for scheduling, their watch by default
+	Trigger TriggerConfig `yaml:"trigger"`
+
+	// Sharding splits the pods between several replicas of the scheduler
+	Sharding ShardingConfig `yaml:"sharding"`
+
+	// MaxPodsPerNode caps the pods of the scheduler profiles on every node below the allocatable
+	// pods of the kubelet, unlimited if 0
+	MaxPodsPerNode int `yaml:"maxPodsPerNode"`
+
+	// PriorityReservations keep a share of the labeled nodes free for the high priority pods
+	PriorityReservations []PriorityReservationConfig `yaml:"priorityReservations"`
+
+	// PercentageOfNodesToScore only scores that share of the nodes passing the filters, at least
+	// 100 of them, to bound the metric requests on large clusters. All of them are scored if 0.
+	PercentageOfNodesToScore int `yaml:"percentageOfNodesToScore"`
+
+	// MetricsConcurrency is the maximum number of metric requests running at the same time
+	MetricsConcurrency int `yaml:"metricsConcurrency"`
+	// MetricsTimeout is the deadline of every metric request, retries included
+	MetricsTimeout time.Duration `yaml:"metricsTimeout"`
+
+	// Provider is the metrics backend of the profiles that don't set their own
+	Provider ProviderConfig `yaml:"provider"`
+
+	// WatchPolicies adds the profiles defined by SchedulingPolicy custom resources
+	WatchPolicies bool `yaml:"watchPolicies"`
+	// WatchNodePools keeps the pods of the NodePool custom resources on the nodes of their pool
+	WatchNodePools bool `yaml:"watchNodePools"`
+
+	// Tuning is a ConfigMap overriding the metrics and strategy of the profiles, applied live
+	Tuning *TuningConfig `yaml:"tuning"`
+
+	// State keeps the recent bindings and the circuit breakers across restarts
+	State *StateConfig `yaml:"state"`
+
+	// FaultInjection makes requests fail on purpose, only with the -inject-faults flag
+	FaultInjection *FaultInjectionConfig `yaml:"faultInjection"`
+	// Seed of the random jitters and faults, for reproducible runs. The time is used if 0.
+	Seed int64 `yaml:"seed"`
+
+	// Extender serves the kube-scheduler extender api with the scores of a profile
+	Extender ExtenderConfig `yaml:"extender"`
+
+	// Admin serves the health of the scheduler
+	Admin AdminConfig `yaml:"admin"`
+
+	Retry          RetryConfig          `yaml:"retry"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuitBreaker"`
+
+	// HTTP tunes the connections to the Sysdig api and to the api server
+	HTTP HTTPConfig `yaml:"http"`
+
+	// BindRateLimit limits how fast pods are bound, disabled by default
+	BindRateLimit RateLimitConfig `yaml:"bindRateLimit"`
+
+	// Audit persists every scheduling decision, disabled if no sink type is set
+	Audit AuditConfig `yaml:"audit"`
+
+	// Clusters are other clusters the profiles can place pods in
+	Clusters []ClusterConfig `yaml:"clusters"`
+
+	// Tracing exports a trace of every scheduling attempt, disabled if no endpoint is set
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// Notifications posts every decision with a placement to the endpoints as it is made
+	Notifications []NotificationConfig `yaml:"notifications"`
+
+	// Binders bind the pods placed on some nodes with another backend than the Binding subresource
+	Binders []BinderConfig `yaml:"binders"`
+
+	// Descheduler evicts pods from the overloaded nodes, disabled if no metric is set
+	Descheduler DeschedulerConfig `yaml:"descheduler"`
+
+	// Cache keeps the metric values of the nodes, in memory unless the replicas share a Redis server
+	Cache CacheConfig `yaml:"cache"`
+
+	// NamespaceQuotas cap the share of every node the pods of a namespace can take
+	NamespaceQuotas []NamespaceQuota `yaml:"namespaceQuotas"`
+
+	// Shadow compares the choices of a profile with the nodes chosen by another scheduler
+	Shadow *ShadowConfig `yaml:"shadow"`
+
+	// Observer decides every pending pod without binding it or writing to the api server
+	Observer *ObserverConfig `yaml:"observer"`
+
+	// FeatureFlags gate the preemption, descheduler, gangScheduling and fallback features by
+	// namespace, they are replaced at runtime on /v1/features of the admin server
+	FeatureFlags map[string]FeatureFlag `yaml:"featureFlags"`
+
+	// Experiments split the pods of a profile with another one and compare their outcomes
+	Experiments []ExperimentConfig `yaml:"experiments"`
+}
+
+// NamespaceQuota caps the share of a node each namespace allowed by Namespaces can take, at
+// MaxPercent of the allocatable Resource requested by the pods of the namespace scheduled by this
+// scheduler, or of the Metric of the containers of the namespace read from Provider (the global
+// provider if unset). Only the sysdig provider reads the metrics of a namespace.
+type NamespaceQuota struct {
+	Namespaces NamespaceFilter `yaml:"namespaces"`
+	Resource   string          `yaml:"resource"`
+	Metric     string          `yaml:"metric"`
+	MaxPercent float64         `yaml:"maxPercent"`
+	Provider   *ProviderConfig `yaml:"provider"`
+
+	provider metrics.NamespaceProvider
+}
+
+// NotificationConfig is an endpoint receiving a POST for each decision with one of the Outcomes
+// (those placing the pod if empty), as a CloudEvent (Format "cloudevents", the default) or "json"
+type NotificationConfig struct {
+	URL      string            `yaml:"url"`
+	Format   string            `yaml:"format"`
+	Headers  map[string]string `yaml:"headers"`
+	Outcomes []string          `yaml:"outcomes"`
+}
+
+// BinderConfig binds the pods placed on the nodes matching Selector with a backend other than the
+// Binding subresource. Type "virtual-kubelet" sets the Annotations on the pod, read by the provider
+// of the node, before binding it; its Selector is the type=virtual-kubelet label by default. Type
+// "placement" posts the pod and its node to the URL of an external placement service, with the
+// Headers, and the service binds the pod.
+type BinderConfig struct {
+	Type        string                        `yaml:"type"`
+	Selector    *kubernetes.KubeLabelSelector `yaml:"selector"`
+	Annotations map[string]string             `yaml:"annotations"`
+	URL         string                        `yaml:"url"`
+	Headers     map[string]string             `yaml:"headers"`
+}
+
+// EvictionConfig checks the pods evicted by the preemption and the descheduler: the pods with one
+// of the DoNotEvictAnnotations, besides the sysdig-scheduler, Karpenter and Cluster Autoscaler
+// ones, and the pods whose eviction would break a PodDisruptionBudget are kept. With DryRun the
+// pods are only given an EvictionPreview event.
+type EvictionConfig struct {
+	DryRun                bool              `yaml:"dryRun"`
+	DoNotEvictAnnotations map[string]string `yaml:"doNotEvictAnnotations"`
+}
+
+// DeschedulerConfig evicts, every Interval, up to MaxEvictions pods scheduled by the profile named
+// Profile (the first profile if empty) from the nodes whose Metric is above Threshold
+type DeschedulerConfig struct {
+	Interval     time.Duration `yaml:"interval"`
+	Profile      string        `yaml:"profile"`
+	Metric       string        `yaml:"metric"`
+	Threshold    float64       `yaml:"threshold"`
+	MaxEvictions int           `yaml:"maxEvictions"`
+}
+
+// WarmUpConfig is the Period after a node becomes Ready during which at most BindingsPerMinute
+// pods are bound to it (unlimited if 0) and the warm-up scorers penalize it. Disabled if 0.
+type WarmUpConfig struct {
+	Period            time.Duration `yaml:"period"`
+	BindingsPerMinute int           `yaml:"bindingsPerMinute"`
+}
+
+// FlappingConfig excludes the nodes whose Ready condition changed more than MaxTransitions times
+// during the last Window (10m by default), until it changes less often. Disabled if 0.
+type FlappingConfig struct {
+	MaxTransitions int           `yaml:"maxTransitions"`
+	Window         time.Duration `yaml:"window"`
+}
+
+// PreBindConfig reads the chosen node again right before its binding and checks it is still Ready,
+// not cordoned and, with fresh metrics, within the thresholds of the profile. A node that changed
+// is replaced by the next candidate, like a failed binding. The checks take at most Budget (1s by
+// default), past it the node being checked is bound.
+type PreBindConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Budget  time.Duration `yaml:"budget"`
+}
+
+// ProvisioningConfig marks a pod whose candidates are all past the thresholds of its profile
+// unschedulable instead of falling back, like a pod no node can take with ClusterAutoscaler, with
+// the capacity it needs in its sysdig-scheduler/capacity-needed annotation. With NodeClass set, a
+// Karpenter NodeClaim of NodePool is created for that capacity too. Disabled if not Enabled.
+type ProvisioningConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	NodePool  string        `yaml:"nodePool"`
+	NodeClass *NodeClassRef `yaml:"nodeClass"`
+}
+
+// NodeClassRef names the Karpenter node class of the NodeClaims, like an EC2NodeClass
+type NodeClassRef struct {
+	Group string `yaml:"group" json:"group"`
+	Kind  string `yaml:"kind" json:"kind"`
+	Name  string `yaml:"name" json:"name"`
+}
+
+// ShardingConfig splits the pods between Shards replicas of the scheduler, each scheduling the pods
+// whose hash of namespace/name falls in its Shard, from 0 to Shards-1. With ShardFromHostname the
+// Shard is the ordinal ending the hostname, like the pods of a StatefulSet. With ShardsFromReplicas
+// the Shards follow the replicas of that StatefulSet, so it can be autoscaled, and Shards is only
+// used until they are read. Disabled if Shards is 0.
+type ShardingConfig struct {
+	Shards             int  `yaml:"shards"`
+	Shard              int  `yaml:"shard"`
+	ShardFromHostname  bool `yaml:"shardFromHostname"`
+	ShardsFromReplicas bool `yaml:"shardsFromReplicas"`
+
+	statefulSet string // StatefulSet of the replicas, with ShardsFromReplicas
+	namespace   string
+	replicas    *int32 // Shards read from the replicas of the StatefulSet, 0 until they are read
+}
+
+// AlertsConfig accepts the notifications of a Sysdig webhook channel on /v1/alerts of the admin
+// server when Enabled: the metrics of the nodes of an alert are read again by the next pod, and
+// with Exclude the nodes are rejected for that long or until the alert is resolved
+type AlertsConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Exclude time.Duration `yaml:"exclude"`
+}
+
+// TriggerConfig queues the added pods as they are watched (Mode "watch", the default), or only the
+// pods named by a POST to /v1/schedule/NAMESPACE/NAME on the admin server (Mode "webhook") or by the
+// NAMESPACE/NAME messages of Subject on the NATS server at URL (Mode "queue"), in QueueGroup if set
+type TriggerConfig struct {
+	Mode       string `yaml:"mode"`
+	URL        string `yaml:"url"`
+	Subject    string `yaml:"subject"`
+	QueueGroup string `yaml:"queueGroup"`
+}
+
+// NodeScoresConfig writes the last scores of every node every Interval (1m if unset), in the
+// sysdig-scheduler/scores annotation of the node (Target "annotation") or in the NodeScore
+// resource named like the node (Target "crd"). Disabled if Target is empty.
+type NodeScoresConfig struct {
+	Target   string        `yaml:"target"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ShadowConfig ranks the nodes for the pending pods of SchedulerName (default-scheduler if empty)
+// with the profile named Profile, without binding them, and compares its best node with the node
+// the pods are bound to
+type ShadowConfig struct {
+	Profile       string `yaml:"profile"`
+	SchedulerName string `yaml:"schedulerName"`
+}
+
+// ObserverConfig runs the scheduler read-only: every pending pod, whatever its scheduler, is filtered
+// and scored like a scheduling attempt and the decision is published, but nothing is bound. The pods
+// of no profile are decided with Profile, the first profile if empty. The nodes are scored every
+// minute for the /metrics gauges unless the admin scoreInterval is set.
+type ObserverConfig struct {
+	Profile string `yaml:"profile"`
+}
+
+// ExperimentConfig schedules the Split share (0.5 by default) of the pods of the Control profile,
+// chosen by the hash of their namespace and name, with the Candidate profile, and compares the
+// scheduling latency, the restarts and the utilization of the nodes of both arms over the Window
+// (24h by default). A verdict is given once both arms have MinPods bound pods, 30 by default.
+type ExperimentConfig struct {
+	Name      string        `yaml:"name"`
+	Control   string        `yaml:"control"`
+	Candidate string        `yaml:"candidate"`
+	Split     float64       `yaml:"split"`
+	Window    time.Duration `yaml:"window"`
+	MinPods   int           `yaml:"minPods"`
+}
+
+// CacheConfig is where the metric values of the nodes are kept for TTL, in the scheduler memory
+// (Type "memory", the default) or in a Redis server shared by several schedulers (Type "redis")
+type CacheConfig struct {
+	Type  string        `yaml:"type"`
+	TTL   time.Duration `yaml:"ttl"`
+	Redis *RedisConfig  `yaml:"redis"`
+}
+
+// RedisConfig is a Redis server reached on Address, with TLS if set. The password is read from the
+// "password" entry of the secret, or from REDIS_PASSWORD. Prefix is prepended to all the keys.
+type RedisConfig struct {
+	Address string     `yaml:"address"`
+	DB      int        `yaml:"db"`
+	TLS     bool       `yaml:"tls"`
+	Prefix  string     `yaml:"prefix"`
+	Secret  *SecretRef `yaml:"secret"`
+}
+
+// ClusterConfig is a cluster reached with its kubeconfig file, with its current context or Context,
+// named to be listed in the profiles
+type ClusterConfig struct {
+	Name       string `yaml:"name"`
+	Kubeconfig string `yaml:"kubeconfig"`
+	Context    string `yaml:"context"`
+}
+
+// TracingConfig is the OTLP/HTTP collector the spans are exported to, like http://otel-collector:4318
+type TracingConfig struct {
+	Endpoint    string            `yaml:"endpoint"`
+	ServiceName string            `yaml:"serviceName"`
+	Headers     map[string]string `yaml:"headers"`
+}
+
+// RateLimitConfig sets the bindings per second allowed for the whole scheduler and for every
+// node, with bursts of up to Burst and PerNodeBurst bindings (1 if unset). A rate of 0 disables the limit.
+type RateLimitConfig struct {
+	PodsPerSecond        float64 `yaml:"podsPerSecond"`
+	Burst                int     `yaml:"burst"`
+	PerNodePodsPerSecond float64 `yaml:"perNodePodsPerSecond"`
+	PerNodeBurst         int     `yaml:"perNodeBurst"`
+}
+
+// ProfileLimits caps a profile at Concurrency scheduling attempts at the same time, KubeQPS
+// requests per second to the api server and MetricsQPS requests per second to its metrics
+// provider, with bursts of up to KubeBurst and MetricsBurst requests (1 if unset). 0 is unlimited.
+type ProfileLimits struct {
+	Concurrency  int     `yaml:"concurrency"`
+	KubeQPS      float64 `yaml:"kubeQPS"`
+	KubeBurst    int     `yaml:"kubeBurst"`
+	MetricsQPS   float64 `yaml:"metricsQPS"`
+	MetricsBurst int     `yaml:"metricsBurst"`
+}
+
+// AuditConfig selects the sink the scheduling decisions are written to, in batches
+// sent every FlushInterval or as soon as BatchSize decisions are waiting. RecordInputs adds the
+// metric and scorer values of every scored node, for the replay command.
+type AuditConfig struct {
+	Type          string         `yaml:"type"`
+	File          string         `yaml:"file"`
+	Webhook       *WebhookConfig `yaml:"webhook"`
+	S3            *S3Config      `yaml:"s3"`
+	SQL           *SQLConfig     `yaml:"sql"`
+	FlushInterval time.Duration  `yaml:"flushInterval"`
+	BatchSize     int            `yaml:"batchSize"`
+	RecordInputs  bool           `yaml:"recordInputs"`
+}
+
+// WebhookConfig is an endpoint receiving the decisions as a JSON lines POST body
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// S3Config is the bucket every batch is uploaded to as a JSON lines object. The keys are read
+// from the "access-key-id" and "secret-access-key" entries of the secret, or from
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY. Endpoint allows S3 compatible stores.
+type S3Config struct {
+	Bucket   string     `yaml:"bucket"`
+	Region   string     `yaml:"region"`
+	Prefix   string     `yaml:"prefix"`
+	Endpoint string     `yaml:"endpoint"`
+	Secret   *SecretRef `yaml:"secret"`
+}
+
+// SQLConfig is the database the decisions are inserted in, through a database/sql Driver compiled
+// in with its build tag: postgres, or sqlite for a local file. The DSN is read from the "dsn" entry
+// of the secret, or from AUDIT_SQL_DSN. Table is scheduling_decisions by default.
+type SQLConfig struct {
+	Driver string     `yaml:"driver"`
+	Table  string     `yaml:"table"`
+	Secret *SecretRef `yaml:"secret"`
+}
+
+// ExtenderConfig enables the kube-scheduler extender server on Address, scoring the nodes
+// with the profile named Profile (the first profile if empty)
+type ExtenderConfig struct {
+	Address        string `yaml:"address"`
+	Profile        string `yaml:"profile"`
+	ServerSecurity `yaml:",inline"`
+}
+
+// AdminConfig enables the admin server on Address, with /healthz and the score history of the last
+// NodeHistory rounds of every node (20 by default) and the last PodHistory decisions (1000 by default)
+type AdminConfig struct {
+	Address     string `yaml:"address"`
+	NodeHistory int    `yaml:"nodeHistory"`
+	PodHistory  int    `yaml:"podHistory"`
+	// ScoreInterval scores all the nodes with every profile in the background for the /metrics
+	// gauges, which are only updated by the scheduled pods if 0
+	ScoreInterval  time.Duration `yaml:"scoreInterval"`
+	ServerSecurity `yaml:",inline"`
+}
+
+// TuningConfig is the ConfigMap with the tuning of the profiles: every key is the name of a
+// profile and its value the YAML of the strategy, metrics and score replacing the ones of the profile
+type TuningConfig struct {
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+}
+
+// ServerSecurity serves over TLS with the certificate and key files, reloaded when they change.
+// With ClientCAFile or BearerTokenFile only the clients with a certificate signed by the CA or
+// one of the tokens of the file, one per line, are answered. /healthz is always answered.
+type ServerSecurity struct {
+	TLS             *ServerTLSConfig `yaml:"tls"`
+	BearerTokenFile string           `yaml:"bearerTokenFile"`
+}
+
+type ServerTLSConfig struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+// ProviderConfig selects the backend the metrics are read from
+type ProviderConfig struct {
+	Type     string          `yaml:"type"`
+	Sysdig   *SysdigConfig   `yaml:"sysdig"`
+	Datadog  *DatadogConfig  `yaml:"datadog"`
+	InfluxDB *InfluxDBConfig `yaml:"influxdb"`
+	Static   *StaticConfig   `yaml:"static"`
+	Scrape   *ScrapeConfig   `yaml:"scrape"`
+
+	GoogleCloud  *GoogleCloudConfig  `yaml:"googleCloud"`
+	CloudWatch   *CloudWatchConfig   `yaml:"cloudWatch"`
+	AzureMonitor *AzureMonitorConfig `yaml:"azureMonitor"`
+
+	Hostname *HostnameConfig `yaml:"hostname"`
+
+	ResponseCache *ResponseCacheConfig `yaml:"responseCache"`
+}
+
+// ResponseCacheConfig answers the same request to the sysdig or influxdb backend from memory for
+// TTL, then revalidates the answer with its ETag or Last-Modified header if it had one
+type ResponseCacheConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// HostnameConfig sets how the host name of a node, {{.Hostname}} in the queries and filters, is
+// found: short (the node name up to the first dot, the default), node (the full node name), label
+// (the value of the node Label), instance-id (the last part of the cloud provider id of the node),
+// template (Template rendered with {{.Node}}, {{.Labels}} and {{.InstanceID}}) or regex (the first
+// group of Regex matching the node name, the whole match if it has no groups). Case (lower or upper)
+// changes the case of the host name found. The Aliases by node name, then the ones of the
+// AliasConfigMap, then the sysdig-scheduler/host-alias annotation of the node win over the strategy.
+type HostnameConfig struct {
+	Strategy       string            `yaml:"strategy"`
+	Label          string            `yaml:"label"`
+	Template       string            `yaml:"template"`
+	Regex          string            `yaml:"regex"`
+	Case           string            `yaml:"case"`
+	Aliases        map[string]string `yaml:"aliases"`
+	AliasConfigMap *SecretRef        `yaml:"aliasConfigMap"`
+}
+
+// SysdigConfig sets the window the metrics are read over, the interval of its datapoints
+// and how they are combined: avg, min, max, p95 or last. The nodes whose newest datapoint is
+// older than MaxAge are not scored. With Accounts every node is read from the first account
+// whose node selector matches its labels.
+//
+// Filter, a template with {{.Node}} and {{.Hostname}}, DataSource (host or container) and the
+// TimeAggregation and GroupAggregation of the metrics replace the ones of the request. With
+// SegmentBy the values of the segments are combined with SegmentAggregation: avg, min, max or sum.
+// With Batch the nodes scored together are read in one request by account, unless Filter is set.
+type SysdigConfig struct {
+	Window      time.Duration   `yaml:"window"`
+	Sampling    time.Duration   `yaml:"sampling"`
+	Aggregation string          `yaml:"aggregation"`
+	MaxAge      time.Duration   `yaml:"maxAge"`
+	Accounts    []SysdigAccount `yaml:"accounts"`
+
+	Filter             string   `yaml:"filter"`
+	DataSource         string   `yaml:"dataSource"`
+	TimeAggregation    string   `yaml:"timeAggregation"`
+	GroupAggregation   string   `yaml:"groupAggregation"`
+	SegmentBy          []string `yaml:"segmentBy"`
+	SegmentAggregation string   `yaml:"segmentAggregation"`
+	Batch              bool     `yaml:"batch"`
+}
+
+// SysdigAccount is a Sysdig backend, a SaaS Region (us1, us2, us4, eu1, au1) or the URL of an
+// on-prem installation. The token, which can be scoped to a team, is read from the "token" entry
+// of the secret, or from SDC_TOKEN. An empty node selector matches every node. CAFile adds a
+// CA bundle to the system roots, CertFile and KeyFile are a client certificate and Proxy is the
+// URL of the proxy the requests go through (HTTPS_PROXY if unset).
+type SysdigAccount struct {
+	Name         string            `yaml:"name"`
+	Region       string            `yaml:"region"`
+	URL          string            `yaml:"url"`
+	Secret       *SecretRef        `yaml:"secret"`
+	NodeSelector map[string]string `yaml:"nodeSelector"`
+
+	CAFile   string `yaml:"caFile"`
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	Proxy    string `yaml:"proxy"`
+}
+
+// DatadogConfig is the configuration of the datadog provider. The keys are read from
+// the "api-key" and "app-key" entries of the secret, or from DD_API_KEY and DD_APP_KEY.
+type DatadogConfig struct {
+	Site    string            `yaml:"site"`
+	Queries map[string]string `yaml:"queries"`
+	Window  time.Duration     `yaml:"window"`
+	Secret  *SecretRef        `yaml:"secret"`
+}
+
+// GoogleCloudConfig is the configuration of the google-cloud provider, reading the metrics of
+// Project (the one of the metadata server if empty) from Cloud Monitoring. The metrics with an MQL
+// query in Queries run it, the others are metric types averaged over Window (5m by default) in the
+// time series matching Filter, both templates with {{.Node}} and {{.Hostname}}. The tokens are
+// signed with the service account key of CredentialsFile or GOOGLE_APPLICATION_CREDENTIALS, or
+// else come from the metadata server, with workload identity on GKE.
+type GoogleCloudConfig struct {
+	Project         string            `yaml:"project"`
+	Queries         map[string]string `yaml:"queries"`
+	Filter          string            `yaml:"filter"`
+	Window          time.Duration     `yaml:"window"`
+	CredentialsFile string            `yaml:"credentialsFile"`
+}
+
+// CloudWatchConfig is the configuration of the cloudwatch provider, reading the metrics of the EC2
+// instances of the nodes in Region (AWS_REGION or the one of the instance if empty) over Window,
+// 5m by default. The Metrics by name are read from their Namespace with their Statistic and the
+// Dimensions they are published with besides InstanceId, the others are AWS/EC2 metrics. The
+// credentials are the keys of the environment, the IAM role of the service account, the one of
+// EKS Pod Identity or the role of the instance.
+type CloudWatchConfig struct {
+	Region  string                            `yaml:"region"`
+	Window  time.Duration                     `yaml:"window"`
+	Metrics map[string]CloudWatchMetricConfig `yaml:"metrics"`
+}
+
+type CloudWatchMetricConfig struct {
+	Namespace  string            `yaml:"namespace"`
+	MetricName string            `yaml:"metricName"`
+	Statistic  string            `yaml:"statistic"`
+	Dimensions map[string]string `yaml:"dimensions"`
+}
+
+// AzureMonitorConfig is the configuration of the azure-monitor provider, reading the newest value
+// in Window (5m by default) of the metrics of the virtual machines of the nodes. The Metrics by
+// name are read with their Name, Namespace and Aggregation, the others are host metrics. The token
+// is the one of workload identity, or of the managed identity of the node, ClientID for a user
+// assigned one.
+type AzureMonitorConfig struct {
+	Window   time.Duration                `yaml:"window"`
+	ClientID string                       `yaml:"clientID"`
+	Metrics  map[string]AzureMetricConfig `yaml:"metrics"`
+}
+
+type AzureMetricConfig struct {
+	Name        string `yaml:"name"`
+	Namespace   string `yaml:"namespace"`
+	Aggregation string `yaml:"aggregation"`
+}
+
+// StaticConfig is the configuration of the static provider, the values of the metrics by node
+// name, with "*" for the nodes that are not listed. It is meant for tests and demos.
+type StaticConfig struct {
+	Values map[string]map[string]float64 `yaml:"values"`
+}
+
+// InfluxDBConfig is the configuration of the influxdb provider. With version 2 the token is read
+// from the "token" entry of the secret or INFLUX_TOKEN. With version 1 the "username" and "password"
+// entries of the secret are used if it is set.
+type InfluxDBConfig struct {
+	URL      string            `yaml:"url"`
+	Version  int               `yaml:"version"`
+	Database string            `yaml:"database"`
+	Org      string            `yaml:"org"`
+	Queries  map[string]string `yaml:"queries"`
+	Secret   *SecretRef        `yaml:"secret"`
+}
+
+// ScrapeConfig is the configuration of the scrape provider, reading the Prometheus endpoint of
+// every node at URL, a template with {{.Node}}, {{.Hostname}} and {{.Address}} (the InternalIP of
+// the node). Every metric is read from the samples named Sample with the Labels, combined with
+// Aggregation (sum by default), turned into a rate per second if Rate is set and multiplied by
+// Scale. CAFile verifies the endpoints served over TLS and the token of BearerTokenFile, read
+// again on every request, is sent to them.
+type ScrapeConfig struct {
+	URL             string                        `yaml:"url"`
+	Metrics         map[string]ScrapeMetricConfig `yaml:"metrics"`
+	CAFile          string                        `yaml:"caFile"`
+	BearerTokenFile string                        `yaml:"bearerTokenFile"`
+}
+
+type ScrapeMetricConfig struct {
+	Sample      string            `yaml:"sample"`
+	Labels      map[string]string `yaml:"labels"`
+	Aggregation string            `yaml:"aggregation"`
+	Rate        bool              `yaml:"rate"`
+	Scale       float64           `yaml:"scale"`
+}
+
+// SecretRef points to a Kubernetes secret
+type SecretRef struct {
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+}
+
+// RetryConfig sets how many times a failed metrics request is retried, with a
+// jittered exponential backoff between InitialBackoff and MaxBackoff
+type RetryConfig struct {
+	Attempts       int           `yaml:"attempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+}
+
+// HTTPConfig tunes the transports of the Sysdig api, its accounts included, and of the api server
+type HTTPConfig struct {
+	Sysdig     TransportConfig `yaml:"sysdig"`
+	Kubernetes TransportConfig `yaml:"kubernetes"`
+}
+
+// TransportConfig sizes the pool of connections kept alive to a backend: MaxIdleConnsPerHost of
+// them stay open between the requests, closed after IdleConnTimeout, and at most MaxConnsPerHost are
+// open at the same time (0 is unlimited). Timeout is the deadline of a request, reading its answer
+// included, the watches excepted. DNSCacheTTL keeps the resolved addresses, resolved on every new
+// connection if 0.
+type TransportConfig struct {
+	MaxIdleConns          int           `yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost   int           `yaml:"maxIdleConnsPerHost"`
+	MaxConnsPerHost       int           `yaml:"maxConnsPerHost"`
+	IdleConnTimeout       time.Duration `yaml:"idleConnTimeout"`
+	KeepAlive             time.Duration `yaml:"keepAlive"`
+	DialTimeout           time.Duration `yaml:"dialTimeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"responseHeaderTimeout"`
+	Timeout               time.Duration `yaml:"timeout"`
+	DNSCacheTTL           time.Duration `yaml:"dnsCacheTTL"`
+}
+
+// CircuitBreakerConfig sets after how many consecutive failures the metrics of a
+// node stop being requested, and for how long
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failureThreshold"`
+	OpenDuration     time.Duration `yaml:"openDuration"`
+}
+
+// NamespaceFilter restricts the namespaces the scheduler takes pods from.
+// Both lists accept glob patterns ("team-*"), and deny takes precedence over allow.
+// An empty allow list allows every namespace.
+type NamespaceFilter struct {
+	Allow []string `yaml:"allow" json:"allow,omitempty"`
+	Deny  []string `yaml:"deny" json:"deny,omitempty"`
+}
+
+// FeatureFlag enables a feature for the pods of the Namespaces, every one if empty, or for none
+// when Enabled is false. A feature without flag is enabled everywhere.
+type FeatureFlag struct {
+	Enabled    *bool           `yaml:"enabled" json:"enabled"`
+	Namespaces NamespaceFilter `yaml:"namespaces" json:"namespaces"`
+}
+
+// Profile is a named scheduling policy served by this process under its own scheduler name
+type Profile struct {
+	Name          string         `yaml:"name"`
+	SchedulerName string         `yaml:"schedulerName"`
+	Metrics       []MetricConfig `yaml:"metrics"`
+	Strategy      string         `yaml:"strategy"`
+	Fallback      string         `yaml:"fallback"`
+
+	// Score is an expression over the raw metric and scorer values replacing their weighted sum,
+	// like "0.6*cpu.used.percent + 0.4*(100 - fs.free.percent)". Its metrics are read even if unlisted.
+	Score string `yaml:"score"`
+
+	// Namespaces and PodSelector restrict the pods handled by the profile
+	Namespaces  NamespaceFilter               `yaml:"namespaces"`
+	PodSelector *kubernetes.KubeLabelSelector `yaml:"podSelector"`
+
+	// Provider overrides the metrics backend of the configuration
+	Provider *ProviderConfig `yaml:"provider"`
+
+	// ZoneBalancing chooses the node within the zone running the fewest replicas of the workload
+	ZoneBalancing bool `yaml:"zoneBalancing"`
+
+	// Clusters are the names of the other clusters whose nodes compete with the local ones
+	Clusters []string `yaml:"clusters"`
+
+	// Scorers add the weighted values of external scorers to the score of the nodes
+	Scorers []ScorerConfig `yaml:"scorers"`
+
+	// PrefetchInterval reads the metrics of all the ready nodes in the background, disabled if 0
+	PrefetchInterval time.Duration `yaml:"prefetchInterval"`
+
+	// CacheTTL overrides the TTL of the metric cache for the values of the profile
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+
+	// TieBreaker chooses among the nodes whose score is within TieMargin of the best one:
+	// headroom, fewest-pods, image-locality or round-robin. The sort order decides if unset.
+	TieBreaker string  `yaml:"tieBreaker"`
+	TieMargin  float64 `yaml:"tieMargin"`
+
+	// Schedules switch the strategy during recurring time windows, the first active one wins
+	Schedules []StrategySchedule `yaml:"schedules"`
+
+	// Limits keep the profile from taking the api server and metrics budget of the other profiles
+	Limits ProfileLimits `yaml:"limits"`
+
+	// QoSClasses override the strategy and the thresholds for the pods of a QoS class, like
+	// binpacking the BestEffort pods while spreading the Guaranteed ones
+	QoSClasses map[string]QoSClassConfig `yaml:"qosClasses"`
+
+	// NodePools score the nodes of a pool, like the GPU or storage nodes, with their own metrics
+	NodePools []NodePoolConfig `yaml:"nodePools"`
+
+	// Windows read the metrics over several windows, like 1m, 10m and 1h, so neither a momentary
+	// spike nor a stale average decides alone. WindowConsensus combines them: weighted (default)
+	// scores the average of the values of the windows by weight, rank the average of the ranks.
+	Windows         []WindowConfig `yaml:"windows"`
+	WindowConsensus string         `yaml:"windowConsensus"`
+
+	provider    metrics.Provider
+	prefetched  *prefetchedMetrics
+	smoothed    *smoothedMetrics
+	scorers     []scoring.Scorer
+	metricNames []string
+	score       *scoring.Expression
+	qosProfiles map[string]*Profile // Indexed by QoS class
+	pools       []nodePool
+}
+
+// PriorityReservationConfig reserves the Fraction of the allocatable Resources (cpu and memory by
+// default) of the nodes matching Selector for the pods of the PriorityClasses or with a priority of
+// at least MinPriority. The other pods are not placed where they would dip into it, the first
+// reservation matching a node wins.
+type PriorityReservationConfig struct {
+	Selector        *kubernetes.KubeLabelSelector `yaml:"selector"`
+	Fraction        float64                       `yaml:"fraction"`
+	Resources       []string                      `yaml:"resources"`
+	MinPriority     *int                          `yaml:"minPriority"`
+	PriorityClasses []string                      `yaml:"priorityClasses"`
+}
+
+// WindowConfig is a window the metrics are averaged over, with a datapoint every Sampling (the
+// whole window if unset), and the Weight of its values or rank, 1 by default
+type WindowConfig struct {
+	Window   time.Duration `yaml:"window"`
+	Sampling time.Duration `yaml:"sampling"`
+	Weight   float64       `yaml:"weight"`
+}
+
+// NodePoolConfig scores the nodes matching Selector with Metrics instead of the metrics of the
+// profile, the first matching pool wins. The nodes are normalized and scored within their pool,
+// then ranked with the others on their score as it is.
+type NodePoolConfig struct {
+	Name     string                        `yaml:"name"`
+	Selector *kubernetes.KubeLabelSelector `yaml:"selector"`
+	Metrics  []MetricConfig                `yaml:"metrics"`
+}
+
+// ScorerConfig is an external scorer, a Go plugin (Type "plugin") exporting a scoring.Scorer
+// named Scorer, or a command (Type "exec") run with Args for every node. Type "cost" is the
+// built-in scorer returning the hourly price of the nodes, from the PriceLabel of the node or
+// the Prices table indexed by instance type. Type "resource-metric" scores the pods requesting the
+// extended Resource with the Metric of the profile provider, and the other pods with 0. Type
+// "recent-bindings" returns the share of the node requested by the pods bound during the Window.
+// Type "locality" returns the distance of the node to the pods of the Target, service/NAME,
+// statefulset/NAME or key=value labels, overridden by the sysdig-scheduler/locality annotation.
+// Type "scoped-metric" returns the Metric of the containers of the node sharing the Scope of the
+// pod, a list of kubernetes.namespace.name and kubernetes.pod.label.KEY labels. Type
+// "image-locality" returns the megabytes of the images of the pod missing on the node. Type
+// "cloud-node" returns SpotPenalty (100 by default) on the spot nodes for the critical pods, plus
+// GenerationPenalty for every instance generation the node is behind the newest one. Type
+// "ephemeral-storage" returns the share of the ephemeral storage of the node requested with the
+// pod, or the disk utilization Metric of the profile provider if set and higher. Type "warm-up"
+// returns the percentage of the warm-up period left to the node. Type "owner-spread" returns the
+// number of pods of the controller of the pod already on the node. Type "energy" returns the watts
+// of the power Metric by allocatable core of the node, times the CarbonIntensity of the region of
+// the node (gCO2/kWh, indexed by region or read from the CarbonLabel of the node) if set. Type
+// "topology-spread" returns the replicas of the controller of the pod past MaxSkew (1 by default)
+// it would add to the failure domain of the node, the value of its TopologyKey label. Type
+// "memory-trend" returns how far past Threshold (90 by default) the Metric (memory.used.percent by
+// default) is projected at the end of the Horizon (15m by default), from its Trend over the Window
+// (30m by default): linear (default) for the least squares line, or ewma.
+type ScorerConfig struct {
+	Name       string             `yaml:"name"`
+	Type       string             `yaml:"type"`
+	Path       string             `yaml:"path"`
+	Args       []string           `yaml:"args"`
+	Weight     float64            `yaml:"weight"`
+	Prices     map[string]float64 `yaml:"prices"`
+	PriceLabel string             `yaml:"priceLabel"`
+	Resource   string             `yaml:"resource"`
+	Metric     string             `yaml:"metric"`
+	Window     time.Duration      `yaml:"window"`
+	Target     string             `yaml:"target"`
+	Scope      []string           `yaml:"scope"`
+
+	SpotPenalty       float64 `yaml:"spotPenalty"`
+	GenerationPenalty float64 `yaml:"generationPenalty"`
+
+	CarbonIntensity map[string]float64 `yaml:"carbonIntensity"`
+	CarbonLabel     string             `yaml:"carbonLabel"`
+
+	TopologyKey string `yaml:"topologyKey"`
+	MaxSkew     int    `yaml:"maxSkew"`
+
+	Threshold float64       `yaml:"threshold"`
+	Horizon   time.Duration `yaml:"horizon"`
+	Trend     string        `yaml:"trend"`
+}
+
+// MetricConfig is a Sysdig metric and the weight it has in the profile score. Normalize makes
+// metrics of different units comparable: none (default), minmax, zscore, or range between Min and Max.
+// Transform is applied to the values before: invert, log, clamp between Min and Max, free-to-used.
+// Direction is lower or higher if lower or higher values are better regardless of the strategy.
+// The nodes with a raw value above RejectAbove or below RejectBelow are never chosen, nor the
+// nodes whose value is not Stability over a longer window. With Smoothing, the exponential moving
+// average of the values read with that alpha is scored instead, from 0 (disabled) to 1 (last value).
+type MetricConfig struct {
+	Name        string   `yaml:"name"`
+	Weight      float64  `yaml:"weight"`
+	Normalize   string   `yaml:"normalize"`
+	Min         float64  `yaml:"min"`
+	Max         float64  `yaml:"max"`
+	Transform   []string `yaml:"transform"`
+	Direction   string   `yaml:"direction"`
+	RejectAbove *float64 `yaml:"rejectAbove"`
+	RejectBelow *float64 `yaml:"rejectBelow"`
+	Smoothing   float64  `yaml:"smoothing"`
+
+	Stability *StabilityConfig `yaml:"stability"`
+}
+
+// StabilityConfig rejects the nodes whose metric has a standard deviation above MaxStdDev over
+// the Window (15m if unset), with a datapoint every Sampling (1m if unset), like flapping nodes.
+type StabilityConfig struct {
+	Window    time.Duration `yaml:"window"`
+	Sampling  time.Duration `yaml:"sampling"`
+	MaxStdDev float64       `yaml:"maxStdDev"`
+}
+
+// Reads and validates the configuration file
+func LoadConfig(file string) (config Config, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return
+	}
+
+	if len(config.Profiles) == 0 {
+		err = fmt.Errorf("config %s: at least one profile must be defined", file)
+		return
+	}
+
+	config.setDefaults()
+
+	if err = config.Provider.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if err = config.Namespaces.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if err = config.WarmUp.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if err = config.Flapping.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if err = config.NodeScores.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if err = config.Provisioning.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if err = config.Trigger.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+	if err = config.Alerts.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+	if config.Alerts.Enabled && config.Admin.Address == "" {
+		return config, fmt.Errorf("config %s: alerts: the notifications are received by the admin server", file)
+	}
+	if config.Trigger.Mode == triggerWebhook && config.Admin.Address == "" {
+		return config, fmt.Errorf("config %s: trigger: the webhook mode needs the admin server", file)
+	}
+
+	if err = config.Sharding.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if err = config.Audit.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if err = validateNotifications(config.Notifications); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	for i := range config.Binders {
+		if err = config.Binders[i].validate(); err != nil {
+			return config, fmt.Errorf("config %s: %s", file, err)
+		}
+	}
+
+	if err = config.Cache.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if config.State != nil {
+		if err = config.State.validate(); err != nil {
+			return config, fmt.Errorf("config %s: %s", file, err)
+		}
+	}
+
+	if config.FaultInjection != nil {
+		if err = config.FaultInjection.validate(); err != nil {
+			return config, fmt.Errorf("config %s: %s", file, err)
+		}
+	}
+
+	if err = config.HTTP.validate(); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	if err = validateFeatureFlags(config.FeatureFlags); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	for i := range config.PriorityReservations {
+		if err = config.PriorityReservations[i].validate(); err != nil {
+			return config, fmt.Errorf("config %s: priority reservation %d: %s", file, i, err)
+		}
+	}
+
+	if config.Tuning != nil && (config.Tuning.Namespace == "" || config.Tuning.Name == "") {
+		return config, fmt.Errorf("config %s: tuning: the configmap namespace and name must be set", file)
+	}
+
+	if err = validateNodeConditions(config.NodeConditions); err != nil {
+		return config, fmt.Errorf("config %s: %s", file, err)
+	}
+
+	for _, quota := range config.NamespaceQuotas {
+		if err = quota.validate(); err != nil {
+			return config, fmt.Errorf("config %s: %s", file, err)
+		}
+	}
+
+	// Profiles with the same scheduler name are told apart by their namespaces and pod selector
+	seen := map[string]bool{}
+	catchAll := map[string]string{} // Profile handling all the pods of a scheduler name
+	for _, profile := range config.Profiles {
+		if err = profile.init(); err != nil {
+			return config, fmt.Errorf("config %s: %s", file, err)
+		}
+		if seen[profile.Name] {
+			return config, fmt.Errorf("config %s: profile name %q is used more than once", file, profile.Name)
+		}
+		seen[profile.Name] = true
+		if previous, ok := catchAll[profile.SchedulerName]; ok {
+			return config, fmt.Errorf("config %s: profile %q is never used, profile %q before it handles all the pods of %s", file, profile.Name, previous, profile.SchedulerName)
+		}
+		if profile.matchesAll() {
+			catchAll[profile.SchedulerName] = profile.Name
+		}
+	}
+
+	clusterNames := map[string]bool{}
+	for _, cluster := range config.Clusters {
+		if cluster.Name == "" || cluster.Kubeconfig == "" {
+			return config, fmt.Errorf("config %s: the clusters need a name and a kubeconfig", file)
+		}
+		clusterNames[cluster.Name] = true
+	}
+	for _, profile := range config.Profiles {
+		for _, name := range profile.Clusters {
+			if !clusterNames[name] {
+				return config, fmt.Errorf("config %s: profile %q: cluster %q is not defined", file, profile.Name, name)
+			}
+		}
+	}
+
+	if config.Descheduler.Metric != "" && config.Descheduler.Profile != "" && config.profileByName(config.Descheduler.Profile) == nil {
+		return config, fmt.Errorf("config %s: descheduler profile %q is not defined", file, config.Descheduler.Profile)
+	}
+
+	if config.Observer != nil && config.profileByName(config.Observer.Profile) == nil {
+		return config, fmt.Errorf("config %s: observer profile %q is not defined", file, config.Observer.Profile)
+	}
+	if config.Shadow != nil && config.profileByName(config.Shadow.Profile) == nil {
+		return config, fmt.Errorf("config %s: shadow profile %q is not defined", file, config.Shadow.Profile)
+	}
+	for _, experiment := range config.Experiments {
+		if err = experiment.validate(config); err != nil {
+			return config, fmt.Errorf("config %s: %s", file, err)
+		}
+	}
+
+	if err = config.Extender.ServerSecurity.validate(); err != nil {
+		return config, fmt.Errorf("config %s: extender %s", file, err)
+	}
+	if err = config.Admin.ServerSecurity.validate(); err != nil {
+		return config, fmt.Errorf("config %s: admin %s", file, err)
+	}
+
+	if config.PercentageOfNodesToScore < 0 || config.PercentageOfNodesToScore > 100 {
+		return config, fmt.Errorf("config %s: percentageOfNodesToScore must be between 0 and 100", file)
+	}
+
+	if config.Extender.Address != "" && config.Extender.Profile != "" && config.profileByName(config.Extender.Profile) == nil {
+		return config, fmt.Errorf("config %s: extender profile %q is not defined", file, config.Extender.Profile)
+	}
+	return
+}
+
+// Fills the settings that were not provided
+func (c *Config) setDefaults() {
+	if c.Provider.Type == "" {
+		c.Provider.Type = providerSysdig
+	}
+	if c.State != nil && c.State.Interval <= 0 {
+		c.State.Interval = 30 * time.Second
+	}
+	for _, condition := range c.UnschedulableConditions {
+		if _, ok := c.NodeConditions[condition]; !ok {
+			if c.NodeConditions == nil {
+				c.NodeConditions = map[string]string{}
+			}
+			c.NodeConditions[condition] = conditionReject
+		}
+	}
+	// The conditions that are not listed keep their default action
+	for condition, action := range defaultNodeConditions {
+		if _, ok := c.NodeConditions[condition]; !ok {
+			if c.NodeConditions == nil {
+				c.NodeConditions = map[string]string{}
+			}
+			c.NodeConditions[condition] = action
+		}
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if c.DefaultScheduler == "" {
+		c.DefaultScheduler = "default-scheduler"
+	}
+	if c.SchedulingTimeout <= 0 {
+		c.SchedulingTimeout = 30 * time.Second
+	}
+	if c.SchedulingConcurrency <= 0 {
+		c.SchedulingConcurrency = 16
+	}
+	if c.GangRetryInterval <= 0 {
+		c.GangRetryInterval = 30 * time.Second
+	}
+	if c.RecoverPendingAfter <= 0 {
+		c.RecoverPendingAfter = time.Minute
+	}
+	if c.NodeScores.Interval <= 0 {
+		c.NodeScores.Interval = time.Minute
+	}
+	if c.PreBind.Budget <= 0 {
+		c.PreBind.Budget = time.Second
+	}
+	if c.BindFallbacks <= 0 {
+		c.BindFallbacks = 3
+	}
+	if c.MetricsConcurrency <= 0 {
+		c.MetricsConcurrency = 20
+	}
+	if c.MetricsTimeout <= 0 {
+		c.MetricsTimeout = 10 * time.Second
+	}
+	c.HTTP.Sysdig.setDefaults(defaultSysdigTransport)
+	c.HTTP.Kubernetes.setDefaults(defaultKubernetesTransport)
+	if c.Retry.Attempts <= 0 {
+		c.Retry.Attempts = 3
+	}
+	if c.Retry.InitialBackoff <= 0 {
+		c.Retry.InitialBackoff = 200 * time.Millisecond
+	}
+	if c.Retry.MaxBackoff <= 0 {
+		c.Retry.MaxBackoff = 2 * time.Second
+	}
+	if c.Flapping.MaxTransitions > 0 && c.Flapping.Window <= 0 {
+		c.Flapping.Window = 10 * time.Minute
+	}
+	if c.CircuitBreaker.FailureThreshold <= 0 {
+		c.CircuitBreaker.FailureThreshold = 5
+	}
+	if c.CircuitBreaker.OpenDuration <= 0 {
+		c.CircuitBreaker.OpenDuration = 30 * time.Second
+	}
+	if c.Audit.FlushInterval <= 0 {
+		c.Audit.FlushInterval = 10 * time.Second
+	}
+	if c.Audit.BatchSize <= 0 {
+		c.Audit.BatchSize = 100
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "sysdig-kubernetes-scheduler"
+	}
+	for i := range c.Binders {
+		if c.Binders[i].Type == binderVirtualKubelet && c.Binders[i].Selector == nil {
+			c.Binders[i].Selector = &kubernetes.KubeLabelSelector{MatchLabels: map[string]string{"type": "virtual-kubelet"}}
+		}
+	}
+	for i := range c.Notifications {
+		if c.Notifications[i].Format == "" {
+			c.Notifications[i].Format = notificationCloudEvents
+		}
+		if len(c.Notifications[i].Outcomes) == 0 {
+			c.Notifications[i].Outcomes = placementOutcomes
+		}
+	}
+	if c.Descheduler.Interval <= 0 {
+		c.Descheduler.Interval = 5 * time.Minute
+	}
+	if c.Descheduler.MaxEvictions <= 0 {
+		c.Descheduler.MaxEvictions = 1
+	}
+	if c.Observer != nil {
+		c.setObserverDefaults()
+	}
+	if c.Shadow != nil && c.Shadow.SchedulerName == "" {
+		c.Shadow.SchedulerName = "default-scheduler"
+	}
+	for i := range c.Experiments {
+		experiment := &c.Experiments[i]
+		if experiment.Split == 0 {
+			experiment.Split = 0.5
+		}
+		if experiment.Window <= 0 {
+			experiment.Window = 24 * time.Hour
+		}
+		if experiment.MinPods <= 0 {
+			experiment.MinPods = 30
+		}
+	}
+	if c.Cache.Type == "" {
+		c.Cache.Type = cacheMemory
+	}
+	if c.Cache.TTL <= 0 {
+		c.Cache.TTL = 15 * time.Second
+	}
+}
+
+// Returns the profile with that name, nil if there is none
+func (c *Config) profileByName(name string) *Profile {
+	for _, profile := range c.Profiles {
+		if profile.Name == name {
+			return profile
+		}
+	}
+	return nil
+}
+
+// Returns true if a profile reads its metrics from the provider type
+func (c *Config) usesProvider(providerType string) bool {
+	for _, profile := range c.Profiles {
+		if profile.providerConfig(*c).Type == providerType {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if a profile reads from Sysdig with the SDC_TOKEN / -t token
+func (c *Config) needsSysdigToken() bool {
+	for _, profile := range c.Profiles {
+		provider := profile.providerConfig(*c)
+		if provider.Type != providerSysdig {
+			continue
+		}
+		if provider.Sysdig == nil || len(provider.Sysdig.Accounts) == 0 {
+			return true
+		}
+		for _, account := range provider.Sysdig.Accounts {
+			if account.Secret == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns true if a configuration profile has strategy schedules
+func (c *Config) hasSchedules() bool {
+	for _, profile := range c.Profiles {
+		if len(profile.Schedules) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Validates the profile, fills the defaults and prepares the Sysdig metric request
+func (p *Profile) init() error {
+	if p.SchedulerName == "" {
+		return fmt.Errorf("profile %q: schedulerName must be set", p.Name)
+	}
+	if p.Name == "" {
+		p.Name = p.SchedulerName
+	}
+	if err := p.parseScore(); err != nil {
+		return fmt.Errorf("profile %q: %s", p.Name, err)
+	}
+	if len(p.Metrics) == 0 {
+		return fmt.Errorf("profile %q: at least one metric must be defined", p.Name)
+	}
+
+	if err := p.Namespaces.validate(); err != nil {
+		return fmt.Errorf("profile %q: %s", p.Name, err)
+	}
+
+	switch p.Strategy {
+	case "":
+		p.Strategy = strategySpread
+	case strategySpread, strategyBinpack:
+	default:
+		return fmt.Errorf("profile %q: unknown strategy %q", p.Name, p.Strategy)
+	}
+
+	for i := range p.Schedules {
+		if err := p.Schedules[i].init(); err != nil {
+			return fmt.Errorf("profile %q: schedule %d: %s", p.Name, i+1, err)
+		}
+	}
+
+	switch p.Fallback {
+	case "":
+		p.Fallback = fallbackDefaultScheduler
+	case fallbackDefaultScheduler, fallbackRoundRobin, fallbackLeastRecentlyUsed, fallbackAllocatable:
+	default:
+		return fmt.Errorf("profile %q: unknown fallback %q", p.Name, p.Fallback)
+	}
+
+	if err := p.validateTieBreaker(); err != nil {
+		return fmt.Errorf("profile %q: %s", p.Name, err)
+	}
+	if err := p.validateWindows(); err != nil {
+		return fmt.Errorf("profile %q: %s", p.Name, err)
+	}
+
+	if l := p.Limits; l.Concurrency < 0 || l.KubeQPS < 0 || l.KubeBurst < 0 || l.MetricsQPS < 0 || l.MetricsBurst < 0 {
+		return fmt.Errorf("profile %q: the limits can't be negative", p.Name)
+	}
+
+	if p.PrefetchInterval > 0 {
+		p.prefetched = &prefetchedMetrics{values: map[string]prefetchedValues{}}
+	}
+
+	if p.Provider != nil {
+		if err := p.Provider.validate(); err != nil {
+			return fmt.Errorf("profile %q: %s", p.Name, err)
+		}
+	}
+
+	p.metricNames = nil
+	p.smoothed = nil
+	for i, metric := range p.Metrics {
+		if metric.Name == "" {
+			return fmt.Errorf("profile %q: metric %d has no name", p.Name, i)
+		}
+		if metric.Weight == 0 {
+			p.Metrics[i].Weight = 1
+		}
+		if err := p.Metrics[i].validateNormalization(); err != nil {
+			return fmt.Errorf("profile %q: %s", p.Name, err)
+		}
+		if err := p.Metrics[i].validateTransform(); err != nil {
+			return fmt.Errorf("profile %q: %s", p.Name, err)
+		}
+		if err := metric.validateSmoothing(); err != nil {
+			return fmt.Errorf("profile %q: %s", p.Name, err)
+		}
+		if metric.Smoothing > 0 && p.smoothed == nil {
+			p.smoothed = &smoothedMetrics{nodes: map[string]smoothedValues{}}
+		}
+		if stability := metric.Stability; stability != nil {
+			if stability.MaxStdDev <= 0 {
+				return fmt.Errorf("profile %q: metric %s: the stability maxStdDev must be positive", p.Name, metric.Name)
+			}
+			if stability.Window <= 0 {
+				stability.Window = defaultStabilityWindow
+			}
+			if stability.Sampling <= 0 {
+				stability.Sampling = defaultStabilitySampling
+			}
+		}
+		p.metricNames = append(p.metricNames, metric.Name)
+	}
+
+	p.scorers = nil
+	for i, scorerConfig := range p.Scorers {
+		if scorerConfig.Weight == 0 {
+			p.Scorers[i].Weight = 1
+		}
+		var scorer scoring.Scorer
+		switch scorerConfig.Type {
+		case "plugin":
+			loaded, err := scoring.LoadPlugin(scorerConfig.Path)
+			if err != nil {
+				return fmt.Errorf("profile %q: scorer %q: %s", p.Name, scorerConfig.Name, err)
+			}
+			scorer = loaded
+		case "exec":
+			scorer = &scoring.Exec{ScorerName: scorerConfig.Name, Path: scorerConfig.Path, Args: scorerConfig.Args}
+		case "cost":
+			if len(scorerConfig.Prices) == 0 && scorerConfig.PriceLabel == "" {
+				return fmt.Errorf("profile %q: scorer %q: prices or priceLabel must be set", p.Name, scorerConfig.Name)
+			}
+			scorer = &scoring.Cost{Prices: scorerConfig.Prices, PriceLabel: scorerConfig.PriceLabel}
+		case "resource-metric":
+			if scorerConfig.Resource == "" || scorerConfig.Metric == "" {
+				return fmt.Errorf("profile %q: scorer %q: resource and metric must be set", p.Name, scorerConfig.Name)
+			}
+			scorer = &resourceMetricScorer{profile: p, resource: scorerConfig.Resource, metric: scorerConfig.Metric}
+		case "recent-bindings":
+			window := scorerConfig.Window
+			if window <= 0 {
+				window = defaultLedgerWindow
+			}
+			scorer = &recentBindingsScorer{window: window}
+		case "locality":
+			scorer = &localityScorer{target: scorerConfig.Target}
+		case "scoped-metric":
+			if scorerConfig.Metric == "" {
+				return fmt.Errorf("profile %q: scorer %q: metric must be set", p.Name, scorerConfig.Name)
+			}
+			if err := validateScope(scorerConfig.Scope); err != nil {
+				return fmt.Errorf("profile %q: scorer %q: %s", p.Name, scorerConfig.Name, err)
+			}
+			scorer = &scopedMetricScorer{profile: p, metric: scorerConfig.Metric, scope: scorerConfig.Scope}
+		case "image-locality":
+			scorer = &imageLocalityScorer{}
+		case "cloud-node":
+			spotPenalty := scorerConfig.SpotPenalty
+			if spotPenalty == 0 {
+				spotPenalty = defaultSpotPenalty
+			}
+			scorer = &cloudNodeScorer{spotPenalty: spotPenalty, generationPenalty: scorerConfig.GenerationPenalty}
+		case "ephemeral-storage":
+			scorer = &ephemeralStorageScorer{profile: p, metric: scorerConfig.Metric}
+		case "warm-up":
+			scorer = &warmUpScorer{}
+		case "owner-spread":
+			scorer = &ownerSpreadScorer{}
+		case "energy":
+			if scorerConfig.Metric == "" {
+				return fmt.Errorf("profile %q: scorer %q: metric must be set", p.Name, scorerConfig.Name)
+			}
+			scorer = &energyScorer{profile: p, metric: scorerConfig.Metric, carbonIntensity: scorerConfig.CarbonIntensity, carbonLabel: scorerConfig.CarbonLabel}
+		case "topology-spread":
+			if scorerConfig.TopologyKey == "" {
+				return fmt.Errorf("profile %q: scorer %q: topologyKey must be set", p.Name, scorerConfig.Name)
+			}
+			if scorerConfig.MaxSkew < 0 {
+				return fmt.Errorf("profile %q: scorer %q: maxSkew can't be negative", p.Name, scorerConfig.Name)
+			}
+			maxSkew := scorerConfig.MaxSkew
+			if maxSkew == 0 {
+				maxSkew = 1
+			}
+			scorer = &topologySpreadScorer{topologyKey: scorerConfig.TopologyKey, maxSkew: maxSkew}
+		case "memory-trend":
+			trend := &memoryTrendScorer{profile: p, metric: scorerConfig.Metric, window: scorerConfig.Window,
+				horizon: scorerConfig.Horizon, threshold: scorerConfig.Threshold, trend: scorerConfig.Trend}
+			if trend.metric == "" {
+				trend.metric = defaultTrendMetric
+			}
+			if trend.window <= 0 {
+				trend.window = defaultTrendWindow
+			}
+			if trend.horizon <= 0 {
+				trend.horizon = defaultTrendHorizon
+			}
+			if trend.threshold == 0 {
+				trend.threshold = defaultTrendThreshold
+			}
+			switch trend.trend {
+			case "":
+				trend.trend = trendLinear
+			case trendLinear, trendEWMA:
+			default:
+				return fmt.Errorf("profile %q: scorer %q: unknown trend %q", p.Name, scorerConfig.Name, trend.trend)
+			}
+			if trend.window < 2*trendSampling {
+				return fmt.Errorf("profile %q: scorer %q: the window must hold at least 2 datapoints of %s", p.Name, scorerConfig.Name, trendSampling)
+			}
+			scorer = trend
+		default:
+			return fmt.Errorf("profile %q: scorer %q: unknown type %q", p.Name, scorerConfig.Name, scorerConfig.Type)
+		}
+		p.scorers = append(p.scorers, scorer)
+	}
+
+	if err := p.initNodePools(); err != nil {
+		return err
+	}
+	return p.initQoSClasses()
+}
+
+// Returns true if the lowest score is the best one for this profile
+func (p *Profile) lowerIsBetter() bool {
+	return p.Strategy != strategyBinpack
+}
+
+// Checks that all the patterns are valid globs
+func (f NamespaceFilter) validate() error {
+	for _, pattern := range append(f.Allow, f.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("namespace pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Returns true if pods from the namespace can be scheduled
+func (f NamespaceFilter) allowed(namespace string) bool {
+	if namespace == "" {
+		namespace = "default"
+	}
+	for _, pattern := range f.Deny {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return false
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range f.Allow {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the metrics backend configuration of the profile
+func (p *Profile) providerConfig(config Config) ProviderConfig {
+	if p.Provider != nil {
+		return *p.Provider
+	}
+	return config.Provider
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Version of the schema of the configuration, bumped when a field changes in an incompatible way
+const configSchemaVersion = "v1"
+
+// Go durations like 90s or 1h30m, the integers are nanoseconds
+const durationPattern = `^-?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$|^0$`
+
+// Prints the JSON schema of the configuration file, or checks configuration files against it
+func runConfig(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "schema":
+			runConfigSchema(args[1:])
+			return
+		case "validate":
+			runConfigValidate(args[1:])
+			return
+		}
+	}
+	fmt.Printf("Usage: %s config schema | validate -f FILE\n", os.Args[0])
+	os.Exit(2)
+}
+
+// Prints the JSON schema of the configuration file
+func runConfigSchema(args []string) {
+	flags := flag.NewFlagSet("config schema", flag.ExitOnError)
+	output := flags.String("o", "", "File the schema is written to, the standard output if empty")
+	flags.Parse(args)
+
+	data, err := json.MarshalIndent(configSchema(), "", "  ")
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := ioutil.WriteFile(*output, data, 0644); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+}
+
+// Checks the configuration files, JSON or YAML: the unknown fields are errors, then the
+// configuration is validated like at startup
+func runConfigValidate(args []string) {
+	flags := flag.NewFlagSet("config validate", flag.ExitOnError)
+	file := flags.String("f", "", "Configuration file to validate, more can follow the flags")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s config validate -f FILE [FILE...]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	files := flags.Args()
+	if *file != "" {
+		files = append([]string{*file}, files...)
+	}
+	if len(files) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	invalid := 0
+	for _, file := range files {
+		if err := validateConfigFile(file); err != nil {
+			fmt.Println(err)
+			invalid++
+			continue
+		}
+		fmt.Printf("%s: valid\n", file)
+	}
+	if invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+func validateConfigFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var strict Config
+	if err := yaml.UnmarshalStrict(data, &strict); err != nil {
+		return fmt.Errorf("config %s: %s", file, err)
+	}
+	_, err = LoadConfig(file)
+	return err
+}
+
+// Returns the JSON schema of the configuration file, from the fields of Config and their yaml names
+func configSchema() map[string]interface{} {
+	definitions := map[string]interface{}{}
+	schemaOf(reflect.TypeOf(Config{}), definitions)
+	// The configuration is the document itself
+	root := definitions["Config"].(map[string]interface{})
+	delete(definitions, "Config")
+
+	document := map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     "urn:kubernetes-scheduler:config:" + configSchemaVersion,
+		"title":   "kubernetes-scheduler configuration " + configSchemaVersion,
+		"$defs":   definitions,
+	}
+	for key, value := range root {
+		document[key] = value
+	}
+	return document
+}
+
+// Returns the schema of a type, the structs are added to the definitions and referenced
+func schemaOf(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]interface{}{"type": []string{"string", "integer"}, "pattern": durationPattern}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), definitions)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), definitions)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), definitions)}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return structSchema(t, definitions)
+		}
+		if _, ok := definitions[name]; !ok {
+			// Set before the fields, for the types referencing themselves
+			definitions[name] = nil
+			definitions[name] = structSchema(t, definitions)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	}
+	// Anything the yaml decoder accepts
+	return map[string]interface{}{}
+}
+
+// Returns the schema of the fields of a struct, by their yaml name, the inlined structs included.
+// The unknown fields are refused like by config validate.
+func structSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	addFields(t, properties, definitions)
+	return map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+}
+
+func addFields(t reflect.Type, properties, definitions map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		inline := false
+		for _, option := range tag[1:] {
+			inline = inline || option == "inline"
+		}
+		if inline {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			addFields(fieldType, properties, definitions)
+			continue
+		}
+		if name == "" {
+			// Like the yaml decoder
+			name = strings.ToLower(field.Name)
+		}
+		properties[name] = schemaOf(field.Type, definitions)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/binding"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotation of the pods overriding the scheduling deadline of the configuration, like 10m
+const schedulingDeadlineAnnotation = "sysdig-scheduler/scheduling-deadline"
+
+// Longest wait between two attempts of a pod with a deadline
+const deadlineRetryInterval = 10 * time.Second
+
+// Returns the scheduling deadline of the pod, false if it has none
+func (s *Scheduler) podDeadline(pod kubernetes.KubePod) (deadline time.Time, ok bool) {
+	timeout := s.config.SchedulingDeadline
+	if value, set := pod.Metadata.Annotations[schedulingDeadlineAnnotation]; set {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Ignoring the %s annotation of %s: invalid duration %q", schedulingDeadlineAnnotation, pod.Metadata.Name, value)
+		} else {
+			timeout = parsed
+		}
+	}
+	if timeout <= 0 {
+		return
+	}
+	return pod.Metadata.CreationTimestamp.Add(timeout), true
+}
+
+// Tries a pod that could not be placed again later, until its deadline. Past the deadline the pod
+// is marked PodScheduled=False with the last error and a warning event, and it is not tried again.
+func (s *Scheduler) retryUntilDeadline(profile *Profile, pod kubernetes.KubePod, reason string) {
+	deadline, ok := s.podDeadline(pod)
+	if !ok {
+		return
+	}
+	if wait := time.Until(deadline); wait > 0 {
+		if wait > deadlineRetryInterval {
+			wait = deadlineRetryInterval
+		}
+		time.AfterFunc(wait, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), s.config.SchedulingTimeout)
+			defer cancel()
+			// Bound by another scheduler or deleted meanwhile
+			if err := binding.Check(ctx, &s.kubeAPI, pod.Metadata.Namespace, pod.Metadata.Name); err != nil {
+				return
+			}
+			s.queue.push(profile, pod)
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.SchedulingTimeout)
+	defer cancel()
+	message := fmt.Sprintf("Not placed by %s before its scheduling deadline: %s", pod.Spec.SchedulerName, reason)
+	if err := s.kubeAPI.SetPodCondition(ctx, pod.Metadata.Namespace, pod.Metadata.Name, "PodScheduled", "False", "SchedulingDeadlineExceeded", message); err != nil {
+		log.Printf("Error setting the PodScheduled condition of %s: %s", pod.Metadata.Name, err)
+	}
+	s.reportPodEvent(ctx, pod, "Warning", "SchedulingDeadlineExceeded", message)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotation of the pods and of their events with the ID of the last scheduling attempt
+const decisionIDAnnotation = "sysdig-scheduler/decision-id"
+
+type decisionIDKey struct{}
+
+// Returns a random ID for a scheduling attempt
+func newDecisionID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Returns the context of the scheduling attempt with that decision ID
+func withDecisionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, decisionIDKey{}, id)
+}
+
+// Returns the decision ID of the scheduling attempt of the context, empty outside of an attempt
+func decisionIDOf(ctx context.Context) string {
+	id, _ := ctx.Value(decisionIDKey{}).(string)
+	return id
+}
+
+// Annotates the pod with the ID of its decision, errors are logged
+func (s *Scheduler) annotateDecision(ctx context.Context, pod kubernetes.KubePod, record *auditRecord) {
+	if !s.config.DecisionAnnotation || record.Outcome == outcomeConflict {
+		return
+	}
+	if err := s.kubeAPI.AnnotatePod(ctx, pod.Metadata.Namespace, pod.Metadata.Name, decisionIDAnnotation, record.ID); err != nil {
+		log.Printf("Error annotating the decision %s of %s: %s", record.ID, pod.Metadata.Name, err)
+	}
+}
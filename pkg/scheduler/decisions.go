@@ -0,0 +1,135 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Prints the decisions stored by the sql audit sink, of a node or a pod over a time range
+func (s *Scheduler) runHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	configFile := flags.String("c", "", "Configuration file of the scheduler, with the sql audit sink")
+	driver := flags.String("driver", "", "Driver of the database, instead of the one of the configuration")
+	dsn := flags.String("dsn", "", "DSN of the database, AUDIT_SQL_DSN or the secret of the configuration by default")
+	table := flags.String("table", "", "Table of the decisions, instead of the one of the configuration")
+	node := flags.String("node", "", "Only the decisions placing a pod on the node")
+	pod := flags.String("pod", "", "Only the decisions of the NAMESPACE/POD")
+	since := flags.Duration("since", time.Hour, "Only the decisions of this last period")
+	limit := flags.Int("limit", 1000, "Maximum number of decisions printed")
+	output := flags.String("o", "table", "Output format: table or json")
+	kubeConfigFile := flags.String("k", "", "Kubernetes config file, to read the secret of the DSN")
+	flags.StringVar(kubeConfigFile, "kubeconfig", "", "Kubernetes config file, same as -k")
+	flags.Parse(args)
+
+	sqlConfig := SQLConfig{}
+	if *configFile != "" {
+		loaded, err := LoadConfig(*configFile)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+		if loaded.Audit.SQL != nil {
+			sqlConfig = *loaded.Audit.SQL
+		}
+	}
+	if *driver != "" {
+		sqlConfig.Driver = *driver
+	}
+	if *table != "" {
+		sqlConfig.Table = *table
+	}
+	if sqlConfig.Driver == "" {
+		fmt.Println("Error: -driver or -c with an sql audit sink must be set")
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err := sqlConfig.checkDriver(); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	if sqlConfig.Table != "" && !sqlIdentifier.MatchString(sqlConfig.Table) {
+		fmt.Printf("Error: invalid table %q\n", sqlConfig.Table)
+		os.Exit(2)
+	}
+	var namespace, name string
+	if *pod != "" {
+		parts := strings.Split(*pod, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			fmt.Println("Error: -pod must be NAMESPACE/POD")
+			os.Exit(2)
+		}
+		namespace, name = parts[0], parts[1]
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Printf("Error: unknown output %q\n", *output)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if *dsn == "" {
+		if sqlConfig.Secret != nil {
+			if *kubeConfigFile != "" {
+				os.Setenv("KUBECONFIG", *kubeConfigFile)
+			}
+			if err := s.kubeAPI.LoadKubeConfig(); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(2)
+			}
+		}
+		values, err := sqlConfig.dsn(s)(ctx)
+		if err != nil {
+			fmt.Println("Error: DSN:", err)
+			os.Exit(2)
+		}
+		*dsn = values[0]
+	}
+	db, err := openAuditDB(ctx, sqlConfig, *dsn)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	decisions, err := queryDecisions(ctx, db, sqlConfig, time.Now().Add(-*since), *node, namespace, name, *limit)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(decisions)
+		return
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TIME\tPOD\tPROFILE\tNODE\tOUTCOME\tDURATION\tERROR")
+	for _, decision := range decisions {
+		fmt.Fprintf(writer, "%s\t%s/%s\t%s\t%s\t%s\t%.3fs\t%s\n", decision.Time.Local().Format(time.RFC3339),
+			decision.Namespace, decision.Pod, decision.Profile, decision.Node, decision.Outcome, decision.Duration, decision.Error)
+	}
+	writer.Flush()
+}
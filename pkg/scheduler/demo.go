@@ -0,0 +1,51 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"hash/fnv"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/sysdig/sysdigtest"
+)
+
+// Starts the mock of demo mode on a local port and points the Sysdig client to it
+func (s *Scheduler) startDemoMock() error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	go http.Serve(listener, &sysdigtest.Mock{Generate: demoValue, Latency: 20 * time.Millisecond})
+	s.sysdigAPI.SetURL("http://" + listener.Addr().String())
+	s.sysdigAPI.SetToken("demo")
+	log.Printf("Demo mode: metrics made up by a mock Sysdig api on %s", listener.Addr())
+	return nil
+}
+
+// Returns a made-up value between 0 and 100, different for every host and metric and
+// slowly changing over time, so the best node changes every few minutes
+func demoValue(host, metric string) float64 {
+	hash := fnv.New32a()
+	hash.Write([]byte(host + "/" + metric))
+	phase := float64(hash.Sum32()%360) * math.Pi / 180
+	minutes := float64(time.Now().Unix()) / 60
+	return 50 + 40*math.Sin(phase+minutes/5)
+}
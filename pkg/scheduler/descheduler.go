@@ -0,0 +1,145 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotation keeping a pod from being evicted by the descheduler and the preemption
+const doNotEvictAnnotation = "sysdig-scheduler/do-not-evict"
+
+// Evicts pods from the nodes whose descheduler metric is above the threshold, every interval
+// until the context is done, so their controllers recreate them and they are scheduled again
+func (s *Scheduler) runDescheduler(ctx context.Context, profile *Profile) {
+	ticker := time.NewTicker(s.config.Descheduler.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.deschedule(ctx, profile)
+	}
+}
+
+type nodeValue struct {
+	name  string
+	value float64
+}
+
+// Runs a rebalancing cycle, evicting at most MaxEvictions pods from the hottest nodes first
+func (s *Scheduler) deschedule(ctx context.Context, profile *Profile) {
+	descheduler := s.config.Descheduler
+	var hot []nodeValue
+	cold := 0
+	for _, node := range s.nodesAvailable(ctx) {
+		metricCtx, cancel := context.WithTimeout(ctx, s.config.MetricsTimeout)
+		values, err := profile.provider.NodeMetrics(metricCtx, node.Metadata.Name, []string{descheduler.Metric})
+		cancel()
+		if err != nil {
+			log.Printf("Descheduler: no %s for node %s: %s", descheduler.Metric, node.Metadata.Name, err)
+			continue
+		}
+		if values[0] > descheduler.Threshold {
+			hot = append(hot, nodeValue{node.Metadata.Name, values[0]})
+		} else {
+			cold++
+		}
+	}
+	// Evicted pods would come back to the same kind of node
+	if len(hot) == 0 || cold == 0 {
+		return
+	}
+	sort.Slice(hot, func(i, j int) bool { return hot[i].value > hot[j].value })
+
+	budgets, err := s.kubeAPI.ListPodDisruptionBudgets(ctx)
+	if err != nil {
+		log.Println("Descheduler: listing the disruption budgets:", err)
+		return
+	}
+
+	var evicted []kubernetes.KubePod
+	for _, node := range hot {
+		pods, err := s.kubeAPI.ListPods(ctx, "", "spec.nodeName="+node.name+",status.phase=Running")
+		if err != nil {
+			log.Printf("Descheduler: listing the pods of node %s: %s", node.name, err)
+			continue
+		}
+		for _, pod := range s.evictionCandidates(profile, pods) {
+			if len(evicted) >= descheduler.MaxEvictions {
+				return
+			}
+			reason := fmt.Sprintf("from node %s, %s is %.2f", node.name, descheduler.Metric, node.value)
+			previewed, err := s.evictPod(ctx, pod, budgets, evicted, reason)
+			if err != nil {
+				log.Printf("Descheduler: pod %s/%s not evicted: %s", pod.Metadata.Namespace, pod.Metadata.Name, err)
+				continue
+			}
+			if !previewed {
+				log.Printf("Descheduler: evicted pod %s/%s %s", pod.Metadata.Namespace, pod.Metadata.Name, reason)
+			}
+			// The previews count like evictions, so they show what a real cycle would do
+			evicted = append(evicted, pod)
+			// One pod per node and cycle, so the metric can reflect the eviction
+			break
+		}
+	}
+}
+
+// Returns the pods scheduled by the profile that a controller other than a DaemonSet would
+// recreate, lowest priority and youngest first
+func (s *Scheduler) evictionCandidates(profile *Profile, pods []kubernetes.KubePod) (candidates []kubernetes.KubePod) {
+	for _, pod := range pods {
+		if pod.Spec.SchedulerName != profile.SchedulerName || !s.config.Namespaces.allowed(pod.Metadata.Namespace) {
+			continue
+		}
+		if !s.features.enabled(featureDescheduler, pod.Metadata.Namespace) {
+			continue
+		}
+		if _, protected := s.doNotEvict(pod); protected {
+			continue
+		}
+		if _, ok := controllerOf(pod); !ok || ownedByDaemonSet(pod) {
+			continue
+		}
+		candidates = append(candidates, pod)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if podPriority(candidates[i]) != podPriority(candidates[j]) {
+			return podPriority(candidates[i]) < podPriority(candidates[j])
+		}
+		return candidates[i].Metadata.CreationTimestamp.After(candidates[j].Metadata.CreationTimestamp)
+	})
+	return
+}
+
+func ownedByDaemonSet(pod kubernetes.KubePod) bool {
+	for _, owner := range pod.Metadata.OwnerReferences {
+		if owner.Controller && owner.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Scores the nodes with the power they draw by allocatable core, the watts of the Metric of the
+// profile provider (like the Kepler or Scaphandre node power) divided by the cores of the node,
+// lower is more efficient. With carbon intensities the score is the grams of CO2 emitted per hour
+// by core instead: the watts by core times the intensity (gCO2/kWh) of the region of the node,
+// read from the CarbonLabel of the node if set, or else from the table by region.
+type energyScorer struct {
+	schedulerScorer
+	profile         *Profile
+	metric          string
+	carbonIntensity map[string]float64
+	carbonLabel     string
+}
+
+func (s *energyScorer) Name() string {
+	return "energy"
+}
+
+func (s *energyScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (float64, error) {
+	kubeNode, err := s.scheduler.findNode(ctx, node.Name)
+	if err != nil {
+		return 0, err
+	}
+	cores := parseResourceList(kubeNode.Status.Allocatable)["cpu"]
+	if cores <= 0 {
+		return 0, fmt.Errorf("node %s has no allocatable cpu", node.Name)
+	}
+	values, err := s.profile.provider.NodeMetrics(ctx, node.Name, []string{s.metric})
+	if err != nil {
+		return 0, fmt.Errorf("%s of node %s: %s", s.metric, node.Name, err)
+	}
+	watts := values[0] / cores
+
+	if len(s.carbonIntensity) == 0 && s.carbonLabel == "" {
+		return watts, nil
+	}
+	intensity, err := s.intensity(node)
+	if err != nil {
+		return 0, err
+	}
+	return watts * intensity / 1000, nil
+}
+
+// Returns the carbon intensity of the electricity of the node, in gCO2/kWh
+func (s *energyScorer) intensity(node scoring.Node) (float64, error) {
+	if s.carbonLabel != "" {
+		if value, ok := node.Labels[s.carbonLabel]; ok {
+			intensity, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return 0, fmt.Errorf("node %s: invalid carbon intensity label: %s", node.Name, err)
+			}
+			return intensity, nil
+		}
+	}
+	if intensity, ok := s.carbonIntensity[node.Labels[regionLabel]]; ok {
+		return intensity, nil
+	}
+	if intensity, ok := s.carbonIntensity["default"]; ok {
+		return intensity, nil
+	}
+	return 0, fmt.Errorf("no carbon intensity for node %s in region %q", node.Name, node.Labels[regionLabel])
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Local storage of the node shared by the writable layers, the logs and the emptyDir volumes of the pods
+const ephemeralStorage = "ephemeral-storage"
+
+// Scores the nodes with the percentage of their allocatable ephemeral storage requested by their
+// pods with the pod, or with the disk utilization Metric of the node if higher: the pods writing
+// without requests fill the disk too
+type ephemeralStorageScorer struct {
+	schedulerScorer
+	profile *Profile
+	metric  string
+}
+
+func (s *ephemeralStorageScorer) Name() string {
+	return ephemeralStorage
+}
+
+func (s *ephemeralStorageScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (percent float64, err error) {
+	if kubeNode, err := s.scheduler.findNode(ctx, node.Name); err == nil {
+		allocatable := parseResourceList(kubeNode.Status.Allocatable)
+		if allocatable[ephemeralStorage] > 0 {
+			requested, err := s.scheduler.requestedOnNode(ctx, node.Name)
+			if err != nil {
+				return 0, err
+			}
+			percent = (requested[ephemeralStorage] + pod.Requests[ephemeralStorage]) / allocatable[ephemeralStorage] * 100
+		}
+	}
+
+	if s.metric == "" {
+		return
+	}
+	values, err := s.profile.provider.NodeMetrics(ctx, node.Name, []string{s.metric})
+	if err != nil {
+		return 0, fmt.Errorf("%s of node %s: %s", s.metric, node.Name, err)
+	}
+	return math.Max(percent, values[0]), nil
+}
+
+// Returns the resources requested by the pods assigned to the node
+func (s *Scheduler) requestedOnNode(ctx context.Context, nodeName string) (requested resourceList, err error) {
+	pods, err := s.kubeAPI.ListAssignedPods(ctx)
+	if err != nil {
+		return
+	}
+	requested = resourceList{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == nodeName {
+			requested.add(podRequests(pod))
+		}
+	}
+	return
+}
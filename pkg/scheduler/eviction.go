@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotations keeping a pod from being evicted, with the value protecting it
+var doNotEvictAnnotations = map[string]string{
+	doNotEvictAnnotation:                             "true",
+	"karpenter.sh/do-not-evict":                      "true",
+	"karpenter.sh/do-not-disrupt":                    "true",
+	"cluster-autoscaler.kubernetes.io/safe-to-evict": "false",
+}
+
+// Evictions by outcome: evicted, previewed, protected or failed
+var evictionOutcomes = expvar.NewMap("evictions")
+
+// Returns the annotation keeping the pod from being evicted, if any, those of the configuration
+// included, sorted so the same one is reported every time
+func (s *Scheduler) doNotEvict(pod kubernetes.KubePod) (annotation string, ok bool) {
+	var keys []string
+	for key := range doNotEvictAnnotations {
+		keys = append(keys, key)
+	}
+	for key := range s.config.Evictions.DoNotEvictAnnotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, protecting := s.config.Evictions.DoNotEvictAnnotations[key]
+		if !protecting {
+			value = doNotEvictAnnotations[key]
+		}
+		if pod.Metadata.Annotations[key] == value {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Evicts the pod for the reason, unless an annotation or a disruption budget protects it, the
+// pods evicted before in the same cycle counted as gone. With dryRun only an EvictionPreview event
+// is recorded and previewed is true.
+func (s *Scheduler) evictPod(ctx context.Context, pod kubernetes.KubePod, budgets []kubernetes.KubePodDisruptionBudget, evicted []kubernetes.KubePod, reason string) (previewed bool, err error) {
+	name := pod.Metadata.Namespace + "/" + pod.Metadata.Name
+	if annotation, ok := s.doNotEvict(pod); ok {
+		evictionOutcomes.Add("protected", 1)
+		return false, fmt.Errorf("pod %s has the %s annotation", name, annotation)
+	}
+	protected, _ := splitByBudgets(append(append([]kubernetes.KubePod(nil), evicted...), pod), budgets)
+	if last := len(protected) - 1; last >= 0 && protected[last].Metadata.Namespace+"/"+protected[last].Metadata.Name == name {
+		evictionOutcomes.Add("protected", 1)
+		return false, fmt.Errorf("evicting pod %s would break a disruption budget", name)
+	}
+
+	if s.config.Evictions.DryRun {
+		log.Printf("Dry run: pod %s would be evicted %s", name, reason)
+		s.reportPodEvent(ctx, pod, "Normal", "EvictionPreview", fmt.Sprintf("Would be evicted %s, not evicted in dry run", reason))
+		evictionOutcomes.Add("previewed", 1)
+		return true, nil
+	}
+	if err = s.kubeAPI.EvictPod(ctx, pod.Metadata.Namespace, pod.Metadata.Name); err != nil {
+		evictionOutcomes.Add("failed", 1)
+		return false, fmt.Errorf("evicting %s: %s", name, err)
+	}
+	evictionOutcomes.Add("evicted", 1)
+	return false, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+func TestDoNotEvict(t *testing.T) {
+	tests := []struct {
+		name        string
+		configured  map[string]string
+		annotations map[string]string
+		annotation  string
+	}{
+		{name: "no annotation"},
+		{name: "other annotation", annotations: map[string]string{"team": "web"}},
+		{name: "scheduler annotation", annotations: map[string]string{doNotEvictAnnotation: "true"}, annotation: doNotEvictAnnotation},
+		{name: "karpenter do-not-evict", annotations: map[string]string{"karpenter.sh/do-not-evict": "true"}, annotation: "karpenter.sh/do-not-evict"},
+		{name: "karpenter do-not-disrupt", annotations: map[string]string{"karpenter.sh/do-not-disrupt": "true"}, annotation: "karpenter.sh/do-not-disrupt"},
+		{name: "karpenter other value", annotations: map[string]string{"karpenter.sh/do-not-evict": "false"}},
+		{name: "not safe to evict", annotations: map[string]string{"cluster-autoscaler.kubernetes.io/safe-to-evict": "false"}, annotation: "cluster-autoscaler.kubernetes.io/safe-to-evict"},
+		{name: "safe to evict", annotations: map[string]string{"cluster-autoscaler.kubernetes.io/safe-to-evict": "true"}},
+		{
+			name:        "configured annotation",
+			configured:  map[string]string{"example.com/keep": "yes"},
+			annotations: map[string]string{"example.com/keep": "yes"},
+			annotation:  "example.com/keep",
+		},
+		{
+			name:        "configured annotation other value",
+			configured:  map[string]string{"example.com/keep": "yes"},
+			annotations: map[string]string{"example.com/keep": "true"},
+		},
+		{
+			name:        "configured value replacing a built-in one",
+			configured:  map[string]string{"karpenter.sh/do-not-evict": "always"},
+			annotations: map[string]string{"karpenter.sh/do-not-evict": "true"},
+		},
+		{
+			name:        "configured value of a built-in annotation",
+			configured:  map[string]string{"karpenter.sh/do-not-evict": "always"},
+			annotations: map[string]string{"karpenter.sh/do-not-evict": "always"},
+			annotation:  "karpenter.sh/do-not-evict",
+		},
+		{
+			name:        "first annotation in order",
+			annotations: map[string]string{"karpenter.sh/do-not-evict": "true", "cluster-autoscaler.kubernetes.io/safe-to-evict": "false"},
+			annotation:  "cluster-autoscaler.kubernetes.io/safe-to-evict",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testScheduler(Config{Evictions: EvictionConfig{DoNotEvictAnnotations: test.configured}})
+			annotation, ok := s.doNotEvict(testPod("default", "web", nil, test.annotations))
+			if annotation != test.annotation || ok != (test.annotation != "") {
+				t.Errorf("doNotEvict() = %q, %v, want %q", annotation, ok, test.annotation)
+			}
+		})
+	}
+}
+
+func TestEvictPodBudgets(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	budgets := []kubernetes.KubePodDisruptionBudget{testBudget("default", 2, web)}
+	tests := []struct {
+		name    string
+		pods    []kubernetes.KubePod
+		evicted int // Pods evicted in the cycle, the others are protected
+	}{
+		{
+			name:    "within the budget",
+			pods:    []kubernetes.KubePod{testPod("default", "web-1", web, nil), testPod("default", "web-2", web, nil)},
+			evicted: 2,
+		},
+		{
+			name:    "past the budget",
+			pods:    []kubernetes.KubePod{testPod("default", "web-1", web, nil), testPod("default", "web-2", web, nil), testPod("default", "web-3", web, nil)},
+			evicted: 2,
+		},
+		{
+			name: "pods not selected by the budget",
+			pods: []kubernetes.KubePod{
+				testPod("default", "web-1", web, nil), testPod("default", "web-2", web, nil),
+				testPod("default", "db-1", map[string]string{"app": "db"}, nil), testPod("other", "web-1", web, nil),
+			},
+			evicted: 4,
+		},
+		{
+			name:    "protected by an annotation, not counted in the budget",
+			pods:    []kubernetes.KubePod{testPod("default", "web-1", web, map[string]string{"karpenter.sh/do-not-evict": "true"}), testPod("default", "web-2", web, nil), testPod("default", "web-3", web, nil)},
+			evicted: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testScheduler(Config{})
+			requests := s.fakeKubeAPI(t, nil)
+
+			// One cycle: the pods evicted before count as gone
+			var evicted []kubernetes.KubePod
+			for _, pod := range test.pods {
+				previewed, err := s.evictPod(context.Background(), pod, budgets, evicted, "in a test")
+				if previewed {
+					t.Errorf("%s previewed without dry run", pod.Metadata.Name)
+				}
+				if err == nil {
+					evicted = append(evicted, pod)
+				}
+			}
+			if len(evicted) != test.evicted {
+				t.Errorf("%d pods evicted, want %d", len(evicted), test.evicted)
+			}
+			for _, pod := range test.pods {
+				path := "POST /api/v1/namespaces/" + pod.Metadata.Namespace + "/pods/" + pod.Metadata.Name + "/eviction"
+				want := 0
+				for _, other := range evicted {
+					if other.Metadata.Namespace == pod.Metadata.Namespace && other.Metadata.Name == pod.Metadata.Name {
+						want = 1
+					}
+				}
+				if got := requests.count(path); got != want {
+					t.Errorf("%d evictions of %s/%s, want %d", got, pod.Metadata.Namespace, pod.Metadata.Name, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvictPodDryRun(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	budgets := []kubernetes.KubePodDisruptionBudget{testBudget("default", 1, web)}
+	s := testScheduler(Config{Evictions: EvictionConfig{DryRun: true}})
+	requests := s.fakeKubeAPI(t, nil)
+
+	pod := testPod("default", "web-1", web, nil)
+	previewed, err := s.evictPod(context.Background(), pod, budgets, nil, "in a test")
+	if err != nil || !previewed {
+		t.Fatalf("evictPod() = %v, %v, want a preview", previewed, err)
+	}
+	if got := requests.count("POST /api/v1/namespaces/default/pods/web-1/eviction"); got != 0 {
+		t.Errorf("%d evictions in dry run", got)
+	}
+	if got := requests.count("POST /api/v1/namespaces/default/events"); got != 1 {
+		t.Errorf("%d EvictionPreview events, want 1", got)
+	}
+
+	// The checks still apply in dry run, the previewed pods count as evicted
+	_, err = s.evictPod(context.Background(), testPod("default", "web-2", web, nil), budgets, []kubernetes.KubePod{pod}, "in a test")
+	if err == nil || !strings.Contains(err.Error(), "disruption budget") {
+		t.Errorf("evictPod() past the budget in dry run = %v, want a budget error", err)
+	}
+	_, err = s.evictPod(context.Background(), testPod("default", "db-1", nil, map[string]string{doNotEvictAnnotation: "true"}), budgets, nil, "in a test")
+	if err == nil || !strings.Contains(err.Error(), doNotEvictAnnotation) {
+		t.Errorf("evictPod() of an annotated pod in dry run = %v, want an annotation error", err)
+	}
+}
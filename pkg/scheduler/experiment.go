@@ -0,0 +1,329 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+)
+
+// Arms of an experiment
+const (
+	armControl   = "control"
+	armCandidate = "candidate"
+)
+
+// Checks that both profiles of the experiment are defined
+func (e ExperimentConfig) validate(c Config) error {
+	if e.Name == "" {
+		return fmt.Errorf("experiment: the name must be set")
+	}
+	for _, name := range []string{e.Control, e.Candidate} {
+		if c.profileByName(name) == nil {
+			return fmt.Errorf("experiment %q: profile %q is not defined", e.Name, name)
+		}
+	}
+	if e.Control == e.Candidate {
+		return fmt.Errorf("experiment %q: the control and candidate profiles must differ", e.Name)
+	}
+	if e.Split <= 0 || e.Split >= 1 {
+		return fmt.Errorf("experiment %q: the split must be between 0 and 1", e.Name)
+	}
+	return nil
+}
+
+// Returns the arm of the pod, from the hash of its namespace and name so that all the replicas
+// agree and a pod keeps its arm across attempts
+func (e ExperimentConfig) arm(pod kubernetes.KubePod) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(pod.Metadata.Namespace + "/" + pod.Metadata.Name))
+	if float64(hash.Sum32()%10000)/10000 < e.Split {
+		return armCandidate
+	}
+	return armControl
+}
+
+// Returns the profile scheduling the pod matched by the profile: the candidate profile for the
+// pods of the candidate arm of its experiment, the profile itself otherwise
+func (s *Scheduler) experimentProfile(profile *Profile, pod kubernetes.KubePod) *Profile {
+	for _, experiment := range s.config.Experiments {
+		if experiment.Control != profile.Name || experiment.arm(pod) != armCandidate {
+			continue
+		}
+		if candidate := s.profiles.staticByName(experiment.Candidate); candidate != nil {
+			return candidate
+		}
+	}
+	return profile
+}
+
+// A pod bound by an arm of an experiment
+type experimentSample struct {
+	at          time.Time
+	latency     float64 // Seconds from the creation of the pod to its binding
+	utilization float64 // Share of the cpu of the node requested after the binding
+}
+
+// Outcomes of an arm over the window of the experiment
+type experimentArm struct {
+	samples  []experimentSample
+	restarts []time.Time
+}
+
+// A bound pod whose restarts are counted for its arm
+type experimentPod struct {
+	experiment, arm string
+	bound           time.Time
+	restarts        int
+}
+
+// Outcomes of the arms of the experiments, indexed by experiment and arm
+type experimentOutcomes struct {
+	scheduler *Scheduler
+	mutex     sync.Mutex
+	arms      map[string]map[string]*experimentArm
+	pods      map[string]*experimentPod
+}
+
+func (o *experimentOutcomes) arm(experiment, arm string) *experimentArm {
+	if o.arms[experiment] == nil {
+		o.arms[experiment] = map[string]*experimentArm{}
+	}
+	if o.arms[experiment][arm] == nil {
+		o.arms[experiment][arm] = &experimentArm{}
+	}
+	return o.arms[experiment][arm]
+}
+
+// Records the binding of a pod of an experiment, its restarts are followed from then on
+func (o *experimentOutcomes) recordBinding(ctx context.Context, pod kubernetes.KubePod, nodeName string) {
+	profile := o.scheduler.profiles.forPod(pod)
+	if profile == nil {
+		return
+	}
+	for _, experiment := range o.scheduler.config.Experiments {
+		arm := experiment.arm(pod)
+		if name := map[string]string{armControl: experiment.Control, armCandidate: experiment.Candidate}[arm]; name != profile.Name {
+			continue
+		}
+		sample := experimentSample{at: time.Now(), latency: time.Since(pod.Metadata.CreationTimestamp).Seconds()}
+		if node, err := o.scheduler.findNode(ctx, nodeName); err == nil {
+			if cpu := parseResourceList(node.Status.Allocatable)["cpu"]; cpu > 0 {
+				if requested, err := o.scheduler.requestedOnNode(ctx, nodeName); err == nil {
+					// The pod is not listed on the node yet
+					requested.add(podRequests(pod))
+					sample.utilization = requested["cpu"] / cpu * 100
+				}
+			}
+		}
+
+		o.mutex.Lock()
+		o.arm(experiment.Name, arm).samples = append(o.arm(experiment.Name, arm).samples, sample)
+		o.pods[pod.Metadata.Namespace+"/"+pod.Metadata.Name+"/"+pod.Metadata.UID] = &experimentPod{experiment: experiment.Name, arm: arm, bound: sample.at, restarts: restartCount(pod)}
+		o.mutex.Unlock()
+		return
+	}
+}
+
+// Counts the container restarts of the pods bound by the experiments
+func (o *experimentOutcomes) observe(event kubernetes.KubePodEvent) {
+	pod := event.Object
+	key := pod.Metadata.Namespace + "/" + pod.Metadata.Name + "/" + pod.Metadata.UID
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	tracked, ok := o.pods[key]
+	if !ok {
+		return
+	}
+	if event.Type == "DELETED" {
+		delete(o.pods, key)
+		return
+	}
+	restarts := restartCount(pod)
+	arm := o.arm(tracked.experiment, tracked.arm)
+	for ; tracked.restarts < restarts; tracked.restarts++ {
+		arm.restarts = append(arm.restarts, time.Now())
+	}
+}
+
+// Drops the outcomes older than the window of their experiment, the mutex being held
+func (o *experimentOutcomes) prune() {
+	for _, experiment := range o.scheduler.config.Experiments {
+		since := time.Now().Add(-experiment.Window)
+		for _, arm := range o.arms[experiment.Name] {
+			for len(arm.samples) > 0 && arm.samples[0].at.Before(since) {
+				arm.samples = arm.samples[1:]
+			}
+			for len(arm.restarts) > 0 && arm.restarts[0].Before(since) {
+				arm.restarts = arm.restarts[1:]
+			}
+		}
+		for key, pod := range o.pods {
+			if pod.experiment == experiment.Name && pod.bound.Before(since) {
+				delete(o.pods, key)
+			}
+		}
+	}
+}
+
+func restartCount(pod kubernetes.KubePod) (restarts int) {
+	for _, status := range pod.Status.ContainerStatuses {
+		restarts += status.RestartCount
+	}
+	return
+}
+
+// Outcomes of an arm over the window
+type armReport struct {
+	Profile           string  `json:"profile"`
+	Pods              int     `json:"pods"`
+	LatencySeconds    float64 `json:"latencySeconds"`
+	RestartsPerPod    float64 `json:"restartsPerPod"`
+	UtilizationMean   float64 `json:"utilizationMean"`
+	UtilizationSpread float64 `json:"utilizationSpread"`
+}
+
+// Comparison of the arms of an experiment. Every arm wins the measures where it is lower, the
+// winner being the arm winning most of them once both have enough pods.
+type experimentReport struct {
+	Name    string               `json:"name"`
+	Window  string               `json:"window"`
+	Arms    map[string]armReport `json:"arms"`
+	Winners map[string]string    `json:"winners,omitempty"`
+	Verdict string               `json:"verdict"`
+}
+
+// Returns the reports of the experiments
+func (o *experimentOutcomes) reports() (reports []experimentReport) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.prune()
+	for _, experiment := range o.scheduler.config.Experiments {
+		report := experimentReport{Name: experiment.Name, Window: experiment.Window.String(), Arms: map[string]armReport{}}
+		for arm, profile := range map[string]string{armControl: experiment.Control, armCandidate: experiment.Candidate} {
+			outcomes := o.arm(experiment.Name, arm)
+			result := armReport{Profile: profile, Pods: len(outcomes.samples)}
+			if result.Pods > 0 {
+				var latencies, utilizations []float64
+				for _, sample := range outcomes.samples {
+					latencies = append(latencies, sample.latency)
+					utilizations = append(utilizations, sample.utilization)
+				}
+				result.LatencySeconds = metrics.Aggregate(latencies, metrics.AggregationAvg)
+				result.RestartsPerPod = float64(len(outcomes.restarts)) / float64(result.Pods)
+				result.UtilizationMean = metrics.Aggregate(utilizations, metrics.AggregationAvg)
+				result.UtilizationSpread = metrics.Aggregate(utilizations, metrics.AggregationStdDev)
+			}
+			report.Arms[arm] = result
+		}
+		report.Verdict = report.verdict(experiment.MinPods)
+		reports = append(reports, report)
+	}
+	return
+}
+
+// Compares the arms on every measure and returns the winner, inconclusive without enough pods
+func (r *experimentReport) verdict(minPods int) string {
+	control, candidate := r.Arms[armControl], r.Arms[armCandidate]
+	if control.Pods < minPods || candidate.Pods < minPods {
+		return "inconclusive"
+	}
+	r.Winners = map[string]string{}
+	wins := map[string]int{}
+	for measure, values := range map[string][2]float64{
+		"latency":           {control.LatencySeconds, candidate.LatencySeconds},
+		"restarts":          {control.RestartsPerPod, candidate.RestartsPerPod},
+		"utilizationSpread": {control.UtilizationSpread, candidate.UtilizationSpread},
+	} {
+		switch {
+		case values[0] < values[1]:
+			r.Winners[measure] = armControl
+			wins[armControl]++
+		case values[1] < values[0]:
+			r.Winners[measure] = armCandidate
+			wins[armCandidate]++
+		default:
+			r.Winners[measure] = "tie"
+		}
+	}
+	switch {
+	case wins[armControl] > wins[armCandidate]:
+		return armControl
+	case wins[armCandidate] > wins[armControl]:
+		return armCandidate
+	}
+	return "tie"
+}
+
+// Serves the reports of the experiments as json
+func (s *Scheduler) experimentsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.experiments.reports())
+}
+
+// Writes the outcomes of the arms as Prometheus gauges
+func (o *experimentOutcomes) write(w http.ResponseWriter) {
+	if len(o.scheduler.config.Experiments) == 0 {
+		return
+	}
+	reports := o.reports()
+	for _, gauge := range []struct {
+		name, help string
+		value      func(armReport) float64
+	}{
+		{"pods", "Pods bound by the arm of the experiment over its window.", func(a armReport) float64 { return float64(a.Pods) }},
+		{"latency_seconds", "Mean time from the creation of the pods of the arm to their binding.", func(a armReport) float64 { return a.LatencySeconds }},
+		{"restarts_per_pod", "Container restarts of the pods of the arm per pod bound.", func(a armReport) float64 { return a.RestartsPerPod }},
+		{"node_utilization_spread", "Standard deviation of the cpu requested on the nodes the pods of the arm were bound to, in percent.", func(a armReport) float64 { return a.UtilizationSpread }},
+	} {
+		fmt.Fprintf(w, "# HELP sysdig_scheduler_experiment_%s %s\n", gauge.name, gauge.help)
+		fmt.Fprintf(w, "# TYPE sysdig_scheduler_experiment_%s gauge\n", gauge.name)
+		for _, report := range reports {
+			for _, arm := range []string{armControl, armCandidate} {
+				fmt.Fprintf(w, "sysdig_scheduler_experiment_%s{experiment=%s,arm=%s,profile=%s} %s\n", gauge.name,
+					promLabel(report.Name), promLabel(arm), promLabel(report.Arms[arm].Profile), promValue(gauge.value(report.Arms[arm])))
+			}
+		}
+	}
+}
+
+// Logs the verdict of every experiment once per window
+func (s *Scheduler) reportExperiments(ctx context.Context, experiment ExperimentConfig) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(experiment.Window):
+		}
+		for _, report := range s.experiments.reports() {
+			if report.Name == experiment.Name {
+				control, candidate := report.Arms[armControl], report.Arms[armCandidate]
+				log.Printf("Experiment %s over %s: %s (%s: %d pods, %.1fs, %.2f restarts per pod, %.1f%% spread; %s: %d pods, %.1fs, %.2f restarts per pod, %.1f%% spread)",
+					report.Name, report.Window, report.Verdict,
+					control.Profile, control.Pods, control.LatencySeconds, control.RestartsPerPod, control.UtilizationSpread,
+					candidate.Profile, candidate.Pods, candidate.LatencySeconds, candidate.RestartsPerPod, candidate.UtilizationSpread)
+			}
+		}
+	}
+}
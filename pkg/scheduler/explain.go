@@ -0,0 +1,249 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Prints why a pod was placed on its node, from the decisions kept by the admin server. With the
+// pod subcommand, ranks the nodes for a pending pod instead.
+func runExplain(args []string) {
+	if len(args) > 0 && args[0] == "pod" {
+		runExplainPod(args[1:])
+		return
+	}
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	server := adminServerFlags(flags)
+	all := flags.Bool("all", false, "Print all the decisions kept for the pod, not only the last one")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s explain [flags] NAMESPACE/POD\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "       %s explain pod [flags] NAMESPACE/POD\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	parts := strings.Split(flags.Arg(0), "/")
+	if flags.NArg() != 1 || len(parts) != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var decisions []auditRecord
+	if err := server.get("/debug/pods/"+parts[0]+"/"+parts[1], &decisions); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if len(decisions) == 0 {
+		fmt.Printf("No decision kept for %s, it may be older than the history of the scheduler\n", flags.Arg(0))
+		os.Exit(1)
+	}
+	if !*all {
+		decisions = decisions[len(decisions)-1:]
+	}
+	for i, decision := range decisions {
+		if i > 0 {
+			fmt.Println()
+		}
+		printDecision(decision)
+	}
+}
+
+// Prints the nodes filtered and scored by the scheduler for a pending pod, without binding it
+func runExplainPod(args []string) {
+	flags := flag.NewFlagSet("explain pod", flag.ExitOnError)
+	server := adminServerFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s explain pod [flags] NAMESPACE/POD\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	parts := strings.Split(flags.Arg(0), "/")
+	if flags.NArg() != 1 || len(parts) != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var result placementResult
+	if err := server.get("/debug/explain/"+parts[0]+"/"+parts[1], &result); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	printPlacement(flags.Arg(0), result)
+	for _, node := range result.Nodes {
+		if node.Score != nil {
+			return
+		}
+	}
+	os.Exit(1)
+}
+
+// Admin server queried by the explain commands
+type adminServer struct {
+	url       *string
+	caFile    *string
+	tokenFile *string
+}
+
+// Registers the flags locating the admin server
+func adminServerFlags(flags *flag.FlagSet) adminServer {
+	return adminServer{
+		url:       flags.String("admin-url", "http://localhost:8080", "Url of the admin server of the scheduler"),
+		caFile:    flags.String("ca", "", "CA certificate file of the admin server, if it uses TLS"),
+		tokenFile: flags.String("token-file", "", "File with a bearer token of the admin server"),
+	}
+}
+
+// Decodes the answer of the admin server to a GET of the path in v
+func (s adminServer) get(path string, v interface{}) error {
+	return s.do("GET", path, v)
+}
+
+// Decodes the answer of the admin server to a request of the path in v
+func (s adminServer) do(method, path string, v interface{}) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if *s.caFile != "" {
+		data, err := ioutil.ReadFile(*s.caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(data)
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	request, err := http.NewRequest(method, strings.TrimSuffix(*s.url, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	if *s.tokenFile != "" {
+		token, err := ioutil.ReadFile(*s.tokenFile)
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusAccepted {
+		var answer map[string]string
+		if json.NewDecoder(response.Body).Decode(&answer) == nil && answer["error"] != "" {
+			return fmt.Errorf("the admin server answered %d: %s", response.StatusCode, answer["error"])
+		}
+		return fmt.Errorf("the admin server answered %d", response.StatusCode)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// Prints the candidates from the best to the worst, then the nodes rejected with their filter
+func printPlacement(pod string, result placementResult) {
+	fmt.Printf("Pod %s, profile %s, nothing reserved or bound\n\n", pod, result.Profile)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "NODE\tSCORE\tMETRICS\tNOTE")
+	best := true
+	for _, node := range result.Nodes {
+		score, metrics, note := "-", "", node.Error
+		if node.Score != nil {
+			var values []string
+			for name, value := range node.Metrics {
+				values = append(values, fmt.Sprintf("%s=%.4g", name, value))
+			}
+			sort.Strings(values)
+			score, metrics = fmt.Sprintf("%.4g", *node.Score), strings.Join(values, " ")
+			if best {
+				note, best = "best", false
+			}
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", node.Node, score, metrics, note)
+	}
+	var rejected []string
+	for node := range result.Rejected {
+		rejected = append(rejected, node)
+	}
+	sort.Strings(rejected)
+	for _, node := range rejected {
+		fmt.Fprintf(writer, "%s\t-\t\trejected by %s\n", node, result.Rejected[node])
+	}
+	writer.Flush()
+	if best {
+		fmt.Println("\nNo node can take the pod")
+	}
+}
+
+// Prints the outcome of the decision, then the candidates by score and the rejected nodes
+func printDecision(decision auditRecord) {
+	fmt.Printf("Pod %s/%s, profile %s, %s\n", decision.Namespace, decision.Pod, decision.Profile, decision.Time.Format(time.RFC3339))
+	if decision.ID != "" {
+		fmt.Printf("Decision: %s\n", decision.ID)
+	}
+	outcome := decision.Outcome
+	if decision.Node != "" {
+		outcome += " to " + decision.Node
+	}
+	if decision.Error != "" {
+		outcome += ": " + decision.Error
+	}
+	fmt.Printf("Outcome: %s, in %.3fs\n", outcome, decision.Duration)
+	fmt.Printf("Metrics: %s\n\n", strings.Join(decision.Metrics, ", "))
+
+	candidates := decision.Candidates
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if (candidates[i].Score == nil) != (candidates[j].Score == nil) {
+			return candidates[i].Score != nil
+		}
+		return candidates[i].Score != nil && *candidates[i].Score < *candidates[j].Score
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "NODE\tSCORE\tMETRICS\tNOTE")
+	for _, candidate := range candidates {
+		score, metrics, note := "-", "", candidate.Error
+		if candidate.Score != nil {
+			score, metrics = fmt.Sprintf("%.4g", *candidate.Score), fmt.Sprint(candidate.Metrics)
+		}
+		if candidate.Node == decision.Node {
+			note = "chosen"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", candidate.Node, score, metrics, note)
+	}
+	var rejected []string
+	for node := range decision.Rejected {
+		rejected = append(rejected, node)
+	}
+	sort.Strings(rejected)
+	for _, node := range rejected {
+		fmt.Fprintf(writer, "%s\t-\t\trejected: %s\n", node, decision.Rejected[node])
+	}
+	writer.Flush()
+}
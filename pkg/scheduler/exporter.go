@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Last score and metric values of every node for every profile, exported as Prometheus gauges
+type scoreGauges struct {
+	mutex    sync.Mutex
+	profiles map[string]map[string]nodeGauges // Indexed by profile and node name
+}
+
+type nodeGauges struct {
+	score   float64
+	metrics map[string]float64
+	time    time.Time // When the node was scored
+}
+
+// Stores the scores of a round. A full round replaces the nodes of the profile, so the
+// nodes that are gone stop being exported. The nodes that failed are dropped.
+func (g *scoreGauges) record(profile *Profile, scored NodeList, full bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	nodes := g.profiles[profile.Name]
+	if nodes == nil || full {
+		nodes = map[string]nodeGauges{}
+		g.profiles[profile.Name] = nodes
+	}
+	for _, node := range scored {
+		if node.err != nil {
+			delete(nodes, node.name)
+			continue
+		}
+		values := nodeGauges{score: node.score, metrics: map[string]float64{}, time: time.Now()}
+		for i, name := range node.metricNames(profile) {
+			values.metrics[name] = node.metrics[i]
+		}
+		nodes[node.name] = values
+	}
+}
+
+// Stops exporting a deleted node for all the profiles
+func (g *scoreGauges) remove(nodeName string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for _, nodes := range g.profiles {
+		delete(nodes, nodeName)
+	}
+}
+
+// Writes the gauges in the Prometheus text format, sorted so the output is stable
+func (g *scoreGauges) write(w http.ResponseWriter) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	var scores, metrics []string
+	for profile, nodes := range g.profiles {
+		for node, values := range nodes {
+			scores = append(scores, fmt.Sprintf("sysdig_scheduler_node_score{profile=%s,node=%s} %s",
+				promLabel(profile), promLabel(node), promValue(values.score)))
+			for metric, value := range values.metrics {
+				metrics = append(metrics, fmt.Sprintf("sysdig_scheduler_node_metric{profile=%s,node=%s,metric=%s} %s",
+					promLabel(profile), promLabel(node), promLabel(metric), promValue(value)))
+			}
+		}
+	}
+	sort.Strings(scores)
+	sort.Strings(metrics)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP sysdig_scheduler_node_score Score of the node in the last scoring round of the profile.")
+	fmt.Fprintln(w, "# TYPE sysdig_scheduler_node_score gauge")
+	for _, line := range scores {
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintln(w, "# HELP sysdig_scheduler_node_metric Metric value of the node in the last scoring round of the profile.")
+	fmt.Fprintln(w, "# TYPE sysdig_scheduler_node_metric gauge")
+	for _, line := range metrics {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// Returns a quoted Prometheus label value
+func promLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// Returns a Prometheus sample value, NaN and infinities included
+func promValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Scores all the available nodes with every profile every interval, until the context is done,
+// so the gauges follow the cluster even while no pod is scheduled
+func (s *Scheduler) exportScoresLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var names []string
+		for _, node := range s.nodesAvailable(ctx) {
+			names = append(names, node.Metadata.Name)
+		}
+		for _, profile := range s.profiles.all() {
+			s.gauges.record(profile, s.scoreNodes(ctx, profile, kubernetes.KubePod{}, names), true)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Highest score an extender can give to a node
+const maxExtenderPriority = 10
+
+// Arguments sent by kube-scheduler to the extender
+type extenderArgs struct {
+	Pod   kubernetes.KubePod `json:"pod"`
+	Nodes *struct {
+		Items []kubernetes.KubeNode `json:"items"`
+	} `json:"nodes,omitempty"`
+	NodeNames *[]string `json:"nodenames,omitempty"`
+}
+
+type extenderFilterResult struct {
+	Nodes *struct {
+		Items []kubernetes.KubeNode `json:"items"`
+	} `json:"nodes,omitempty"`
+	NodeNames   *[]string         `json:"nodenames,omitempty"`
+	FailedNodes map[string]string `json:"failedNodes"`
+	Error       string            `json:"error,omitempty"`
+}
+
+type hostPriority struct {
+	Host  string `json:"host"`
+	Score int64  `json:"score"`
+}
+
+// Serves the kube-scheduler extender api, so the upstream scheduler keeps all its default
+// predicates and priorities and adds the scores of a profile to them
+func (s *Scheduler) extenderHandler(profile *Profile) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/filter", func(w http.ResponseWriter, r *http.Request) {
+		args, nodes, ok := s.decodeExtenderArgs(w, r)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), s.config.SchedulingTimeout)
+		defer cancel()
+
+		selected := s.selectNodes(nodes)
+		candidates, rejected := s.filterNodes(ctx, args.Pod, selected)
+		if len(selected) < len(nodes) {
+			passed := map[string]bool{}
+			for _, node := range selected {
+				passed[node.Metadata.Name] = true
+			}
+			for _, node := range nodes {
+				if !passed[node.Metadata.Name] {
+					rejected[node.Metadata.Name] = errors.New("node not selected by the nodeSelector of the scheduler")
+				}
+			}
+		}
+		if profile.hasThresholds() {
+			// Nodes without metrics are left to the other predicates of kube-scheduler
+			scored := s.scoreNodes(ctx, profile, args.Pod, candidates)
+			candidates = nil
+			for _, node := range scored {
+				if failure.ReasonOf(node.err) == failure.ThresholdReached {
+					rejected[node.name] = node.err
+					continue
+				}
+				candidates = append(candidates, node.name)
+			}
+		}
+		result := extenderFilterResult{FailedNodes: map[string]string{}}
+		for name, reason := range rejected {
+			result.FailedNodes[name] = reason.Error()
+		}
+		if args.NodeNames != nil {
+			result.NodeNames = &candidates
+		} else {
+			passed := map[string]bool{}
+			for _, name := range candidates {
+				passed[name] = true
+			}
+			result.Nodes = &struct {
+				Items []kubernetes.KubeNode `json:"items"`
+			}{}
+			for _, node := range nodes {
+				if passed[node.Metadata.Name] {
+					result.Nodes.Items = append(result.Nodes.Items, node)
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("/prioritize", func(w http.ResponseWriter, r *http.Request) {
+		args, nodes, ok := s.decodeExtenderArgs(w, r)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), s.config.SchedulingTimeout)
+		defer cancel()
+
+		var names []string
+		for _, node := range nodes {
+			names = append(names, node.Metadata.Name)
+		}
+		writeJSON(w, http.StatusOK, scaledPriorities(profile, s.scoreNodes(ctx, profile, args.Pod, names), maxExtenderPriority))
+	})
+	return mux
+}
+
+// Decodes the extender arguments, the nodes are the full objects or only their names
+// when the extender is configured as nodeCacheCapable
+func (s *Scheduler) decodeExtenderArgs(w http.ResponseWriter, r *http.Request) (args extenderArgs, nodes []kubernetes.KubeNode, ok bool) {
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if args.Nodes != nil {
+		return args, args.Nodes.Items, true
+	}
+	if args.NodeNames != nil {
+		known := map[string]kubernetes.KubeNode{}
+		for _, node := range s.allReadyNodes(r.Context()) {
+			known[node.Metadata.Name] = node
+		}
+		for _, name := range *args.NodeNames {
+			node, found := known[name]
+			if !found {
+				node.Metadata.Name = name
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return args, nodes, true
+}
+
+// Scales the scores of the nodes from 0 to maximum, the range of the extender or of the
+// scheduling framework, the best node gets the maximum. Nodes without metrics get 0.
+func scaledPriorities(profile *Profile, nodes NodeList, maximum int64) (priorities []hostPriority) {
+	if len(nodes) == 0 {
+		return []hostPriority{}
+	}
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, node := range nodes {
+		if node.err == nil {
+			lowest = math.Min(lowest, node.score)
+			highest = math.Max(highest, node.score)
+		}
+	}
+	for _, node := range nodes {
+		priority := hostPriority{Host: node.name}
+		if node.err == nil {
+			fraction := 1.0
+			if highest > lowest {
+				fraction = (node.score - lowest) / (highest - lowest)
+				if profile.lowerIsBetter() {
+					fraction = 1 - fraction
+				}
+			}
+			priority.Score = int64(math.Round(fraction * float64(maximum)))
+		}
+		priorities = append(priorities, priority)
+	}
+	return
+}
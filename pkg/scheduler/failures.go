@@ -0,0 +1,104 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+)
+
+// Failures of the scheduling attempts and of the nodes left out while scoring, by reason and
+// phase, so the operators can alert on a class of failures
+type failureCounters struct {
+	counts *expvar.Map // Indexed by reason/phase
+}
+
+var failures = &failureCounters{counts: expvar.NewMap("failures")}
+
+// Counts a failure under its reason and phase
+func (c *failureCounters) record(err error) {
+	if err == nil {
+		return
+	}
+	c.counts.Add(string(failure.ReasonOf(err))+"/"+string(failure.PhaseOf(err)), 1)
+}
+
+// Writes the counters in the Prometheus text format
+func (c *failureCounters) write(w http.ResponseWriter) {
+	var lines []string
+	c.counts.Do(func(kv expvar.KeyValue) {
+		parts := strings.SplitN(kv.Key, "/", 2)
+		lines = append(lines, fmt.Sprintf("sysdig_scheduler_failures_total{reason=%s,phase=%s} %s",
+			promLabel(parts[0]), promLabel(parts[1]), kv.Value))
+	})
+	sort.Strings(lines)
+	fmt.Fprintln(w, "# HELP sysdig_scheduler_failures_total Failed scheduling attempts and nodes left out while scoring, by reason and phase.")
+	fmt.Fprintln(w, "# TYPE sysdig_scheduler_failures_total counter")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// Records a Warning event on the pod whose attempt failed, with the reason of the failure as the
+// event reason
+func (s *Scheduler) reportFailed(ctx context.Context, pod kubernetes.KubePod, record *auditRecord) {
+	message := fmt.Sprintf("Not scheduled by %s in decision %s", pod.Spec.SchedulerName, record.ID)
+	if record.Phase != "" {
+		message += fmt.Sprintf(", failed in the %s phase", record.Phase)
+	}
+	reason := record.Reason
+	if reason == "" {
+		reason = failure.Unknown
+	}
+	s.reportPodEvent(ctx, pod, "Warning", string(reason), message+": "+record.Error)
+}
+
+// Types the error of a node while reading its metrics or scoring it, with the node, the
+// provider and the reason matching the error
+func nodeFailure(profile *Profile, nodeName string, phase failure.Phase, err error) error {
+	reason := failure.ReasonOf(err)
+	if typed, ok := err.(*failure.Error); ok {
+		// The shared errors like circuitOpen are copied, not filled
+		phase, err = typed.Phase, typed.Err
+	} else if reason == failure.Unknown {
+		var stale metrics.StaleDataError
+		switch {
+		case err == metrics.NoDataFound:
+			reason = failure.NoMetrics
+		case errors.As(err, &stale):
+			reason = failure.StaleMetrics
+		case phase == failure.Score:
+			reason = failure.ScorerError
+		default:
+			reason = failure.ProviderError
+		}
+	}
+	typed := &failure.Error{Reason: reason, Phase: phase, Node: nodeName, Err: err}
+	if profile.provider != nil {
+		typed.Provider = profile.provider.Name()
+	}
+	return typed
+}
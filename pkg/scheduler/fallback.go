@@ -0,0 +1,158 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Fallbacks used when the best node can't be calculated from the metrics
+const (
+	fallbackDefaultScheduler  = "default-scheduler"   // Hand the pods over to the default scheduler
+	fallbackRoundRobin        = "round-robin"         // Rotate over the available nodes
+	fallbackLeastRecentlyUsed = "least-recently-used" // The node that received a pod the longest time ago
+	fallbackAllocatable       = "allocatable"         // The node with the most free allocatable resources
+)
+
+// Records a successful binding, used by the least recently used fallback
+func (s *Scheduler) recordBinding(nodeName string) {
+	s.lastBindingsMutex.Lock()
+	defer s.lastBindingsMutex.Unlock()
+	s.lastBindings[nodeName] = time.Now()
+}
+
+// Forgets the last binding of a deleted node
+func (s *Scheduler) forgetBinding(nodeName string) {
+	s.lastBindingsMutex.Lock()
+	defer s.lastBindingsMutex.Unlock()
+	delete(s.lastBindings, nodeName)
+}
+
+// Chooses a node without metrics following the fallback of the profile
+func (s *Scheduler) fallbackNode(ctx context.Context, profile *Profile, nodes []string) (node Node, err error) {
+	if len(nodes) == 0 {
+		return node, failure.New(failure.NoCandidates, failure.Fallback, "node list must contain at least one element")
+	}
+
+	sorted := append([]string(nil), nodes...)
+	sort.Strings(sorted)
+
+	switch profile.Fallback {
+	case fallbackRoundRobin:
+		s.roundRobinMutex.Lock()
+		defer s.roundRobinMutex.Unlock()
+		position := s.roundRobinNext[profile.Name] % len(sorted)
+		s.roundRobinNext[profile.Name] = position + 1
+		return Node{name: sorted[position]}, nil
+
+	case fallbackLeastRecentlyUsed:
+		s.lastBindingsMutex.Lock()
+		defer s.lastBindingsMutex.Unlock()
+		best := sorted[0]
+		for _, name := range sorted[1:] {
+			if s.lastBindings[name].Before(s.lastBindings[best]) {
+				best = name
+			}
+		}
+		return Node{name: best}, nil
+
+	case fallbackAllocatable:
+		return s.mostAllocatableNode(ctx, sorted)
+	}
+	return node, failure.New(failure.NoNodeFound, failure.Fallback, "no node found")
+}
+
+// Returns the node with the highest fraction of free cpu and memory
+func (s *Scheduler) mostAllocatableNode(ctx context.Context, names []string) (node Node, err error) {
+	kubeNodes, err := s.kubeAPI.ListNodes(ctx)
+	if err != nil {
+		return
+	}
+	requested, err := s.requestedByNode(ctx)
+	if err != nil {
+		return
+	}
+
+	candidates := map[string]bool{}
+	for _, name := range names {
+		candidates[name] = true
+	}
+
+	found := false
+	for _, kubeNode := range kubeNodes {
+		if !candidates[kubeNode.Metadata.Name] {
+			continue
+		}
+		free := freeFraction(parseResourceList(kubeNode.Status.Allocatable), requested[kubeNode.Metadata.Name])
+		if !found || free > node.score {
+			node = Node{name: kubeNode.Metadata.Name, score: free}
+			found = true
+		}
+	}
+	if !found {
+		err = failure.New(failure.NoNodeFound, failure.Fallback, "no node found")
+	}
+	return
+}
+
+// Average of the free fraction of cpu and memory of a node
+func freeFraction(allocatable, requested resourceList) float64 {
+	free := 0.0
+	for _, resource := range []string{"cpu", "memory"} {
+		if allocatable[resource] > 0 {
+			free += (allocatable[resource] - requested[resource]) / allocatable[resource]
+		}
+	}
+	return free / 2
+}
+
+// Changes the scheduler of the deployment owning the pod to the default scheduler. The pods
+// not owned by a deployment, and the deployments that can't be changed, return a NotDelegated
+// failure and the pod stays Pending.
+func (s *Scheduler) delegateToDefaultScheduler(ctx context.Context, pod kubernetes.KubePod) (err error) {
+	defer func() {
+		if err != nil {
+			err = &failure.Error{Reason: failure.NotDelegated, Phase: failure.Fallback, Err: fmt.Errorf("not handed over to the default scheduler: %s", err)}
+		}
+	}()
+
+	log.Println("falling back to the default scheduler...")
+	deploymentName, err := s.findDeploymentNameFromPod(ctx, pod)
+	if err != nil {
+		return
+	}
+	deployments, err := s.kubeAPI.ListNamespacedDeployments(ctx, pod.Metadata.Namespace, "metadata.name="+deploymentName)
+	if err != nil {
+		return
+	}
+	if len(deployments.Items) == 0 {
+		return fmt.Errorf("deployment %s not found", deploymentName)
+	}
+	for _, item := range deployments.Items {
+		if _, err = s.kubeAPI.ReplaceDeploymentScheduler(ctx, item, s.config.DefaultScheduler); err != nil {
+			return fmt.Errorf("could not modify deployment %s: %s", item.Metadata.Name, err)
+		}
+	}
+	return nil
+}
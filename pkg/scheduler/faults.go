@@ -0,0 +1,167 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Number of faults injected, by fault, served in /debug/vars
+var injectedFaults = expvar.NewMap("injectedFaults")
+
+// Faults of the metric backends, nil unless they are injected
+var metricFaults *MetricFaults
+
+// FaultInjectionConfig makes a share of the requests fail on purpose, to test the retries, the
+// circuit breakers and the fallbacks in staging. Every value is the probability, between 0 and 1, of
+// a request getting the fault. It is only applied with the -inject-faults flag.
+type FaultInjectionConfig struct {
+	// Metrics are the faults of the requests to the metric backends
+	Metrics MetricFaults `yaml:"metrics"`
+	// Kubernetes are the faults of the requests to the api server, the watches are left alone
+	Kubernetes KubernetesFaults `yaml:"kubernetes"`
+}
+
+// MetricFaults: Timeout holds the request until its context is done, ServerError answers a 503
+// and EmptyData answers a Sysdig response without datapoints
+type MetricFaults struct {
+	Timeout     float64 `yaml:"timeout"`
+	ServerError float64 `yaml:"serverError"`
+	EmptyData   float64 `yaml:"emptyData"`
+}
+
+// KubernetesFaults: Conflict answers the bindings with a 409, TooManyRequests answers a 429
+type KubernetesFaults struct {
+	Conflict        float64 `yaml:"conflict"`
+	TooManyRequests float64 `yaml:"tooManyRequests"`
+}
+
+// Returns an error if a probability is out of range
+func (c FaultInjectionConfig) validate() error {
+	probabilities := map[string][]float64{
+		"metrics":    {c.Metrics.Timeout, c.Metrics.ServerError, c.Metrics.EmptyData},
+		"kubernetes": {c.Kubernetes.Conflict, c.Kubernetes.TooManyRequests},
+	}
+	for name, values := range probabilities {
+		var total float64
+		for _, value := range values {
+			if value < 0 || value > 1 {
+				return fmt.Errorf("faultInjection: the %s probabilities must be between 0 and 1", name)
+			}
+			total += value
+		}
+		if total > 1 {
+			return fmt.Errorf("faultInjection: the %s probabilities add up to more than 1", name)
+		}
+	}
+	return nil
+}
+
+// Injects the faults in the requests to the api server and to the metric backends, before the
+// providers are created
+func (s *Scheduler) injectFaults(c FaultInjectionConfig) {
+	log.Println("Warning: injecting faults in the requests to the metric backends and the api server")
+	s.kubeAPI.WrapTransport(func(next http.RoundTripper) http.RoundTripper {
+		return &kubernetesFaultTransport{next: next, faults: c.Kubernetes}
+	})
+	metricFaults = &c.Metrics
+	http.DefaultClient.Transport = wrapMetricFaults(http.DefaultClient.Transport)
+}
+
+// Returns the transport with the metric faults, unchanged if they are not injected
+func wrapMetricFaults(next http.RoundTripper) http.RoundTripper {
+	if metricFaults == nil {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &metricFaultTransport{next: next, faults: *metricFaults}
+}
+
+type metricFaultTransport struct {
+	next   http.RoundTripper
+	faults MetricFaults
+}
+
+func (t *metricFaultTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	draw := random.Float64()
+	switch {
+	case draw < t.faults.Timeout:
+		recordFault("metrics timeout", request)
+		<-request.Context().Done()
+		return nil, fmt.Errorf("injected timeout: %s", request.Context().Err())
+	case draw < t.faults.Timeout+t.faults.ServerError:
+		recordFault("metrics server error", request)
+		return faultResponse(request, http.StatusServiceUnavailable, `{"message":"injected fault"}`), nil
+	case draw < t.faults.Timeout+t.faults.ServerError+t.faults.EmptyData:
+		recordFault("metrics empty data", request)
+		return faultResponse(request, http.StatusOK, `{"data":[]}`), nil
+	}
+	return t.next.RoundTrip(request)
+}
+
+type kubernetesFaultTransport struct {
+	next   http.RoundTripper
+	faults KubernetesFaults
+}
+
+func (t *kubernetesFaultTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.URL.Query().Get("watch") == "true" {
+		return t.next.RoundTrip(request)
+	}
+	draw := random.Float64()
+	switch {
+	case draw < t.faults.Conflict && request.Method == "POST" && strings.HasSuffix(request.URL.Path, "/binding"):
+		recordFault("kubernetes conflict", request)
+		return faultResponse(request, http.StatusConflict, `{"kind":"Status","status":"Failure","message":"injected conflict","reason":"Conflict","code":409}`), nil
+	case draw >= t.faults.Conflict && draw < t.faults.Conflict+t.faults.TooManyRequests:
+		recordFault("kubernetes too many requests", request)
+		response := faultResponse(request, http.StatusTooManyRequests, `{"kind":"Status","status":"Failure","message":"injected fault","reason":"TooManyRequests","code":429}`)
+		response.Header.Set("Retry-After", "1")
+		return response, nil
+	}
+	return t.next.RoundTrip(request)
+}
+
+func recordFault(fault string, request *http.Request) {
+	injectedFaults.Add(fault, 1)
+	log.Printf("Injecting a %s fault into %s %s", fault, request.Method, request.URL.Path)
+}
+
+// Returns a json response to the request, without reaching the server
+func faultResponse(request *http.Request, status int, body string) *http.Response {
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
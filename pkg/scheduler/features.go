@@ -0,0 +1,198 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// The features gated by a flag
+const (
+	featurePreemption     = "preemption"
+	featureDescheduler    = "descheduler"
+	featureGangScheduling = "gangScheduling"
+	featureFallback       = "fallback"
+)
+
+var featureNames = []string{featurePreemption, featureDescheduler, featureGangScheduling, featureFallback}
+
+// Checks that the flags gate known features with valid namespace patterns
+func validateFeatureFlags(flags map[string]FeatureFlag) error {
+	for name, flag := range flags {
+		if err := flag.validate(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f FeatureFlag) validate(name string) error {
+	known := false
+	for _, feature := range featureNames {
+		known = known || feature == name
+	}
+	if !known {
+		return fmt.Errorf("feature flag %q: unknown feature, expected one of %s", name, strings.Join(featureNames, ", "))
+	}
+	if err := f.Namespaces.validate(); err != nil {
+		return fmt.Errorf("feature flag %s: %s", name, err)
+	}
+	return nil
+}
+
+// Returns true if the flag enables its feature for the pods of the namespace
+func (f FeatureFlag) enabled(namespace string) bool {
+	return (f.Enabled == nil || *f.Enabled) && f.Namespaces.allowed(namespace)
+}
+
+// The flags set at runtime by the admin server, replacing the configured ones until they are reset
+type featureFlags struct {
+	scheduler *Scheduler
+	mutex     sync.RWMutex
+	overrides map[string]FeatureFlag
+}
+
+// Times a feature was skipped because of its flag, by feature
+var featureGated = expvar.NewMap("featureGated")
+
+func init() {
+	// The flags of the first running scheduler, the ones of a process running a single scheduler
+	expvar.Publish("featureFlags", expvar.Func(func() interface{} {
+		if schedulers := running.all(); len(schedulers) > 0 {
+			return schedulers[0].features.states()
+		}
+		return nil
+	}))
+}
+
+// Returns the flag of the feature, the one set at runtime if any, else the configured one.
+// A feature without flag is enabled everywhere.
+func (f *featureFlags) flag(name string) (flag FeatureFlag, overridden bool) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	if flag, ok := f.overrides[name]; ok {
+		return flag, true
+	}
+	return f.scheduler.config.FeatureFlags[name], false
+}
+
+// Returns true if the feature is enabled for the pods of the namespace
+func (f *featureFlags) enabled(name, namespace string) bool {
+	flag, _ := f.flag(name)
+	if flag.enabled(namespace) {
+		return true
+	}
+	featureGated.Add(name, 1)
+	return false
+}
+
+func (f *featureFlags) set(name string, flag FeatureFlag) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.overrides[name] = flag
+}
+
+// Goes back to the configured flag of the feature
+func (f *featureFlags) reset(name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.overrides, name)
+}
+
+// State of a feature flag on the admin server
+type featureFlagState struct {
+	Enabled    bool            `json:"enabled"`
+	Namespaces NamespaceFilter `json:"namespaces"`
+	Overridden bool            `json:"overridden"`
+}
+
+func (f *featureFlags) state(name string) featureFlagState {
+	flag, overridden := f.flag(name)
+	return featureFlagState{Enabled: flag.Enabled == nil || *flag.Enabled, Namespaces: flag.Namespaces, Overridden: overridden}
+}
+
+func (f *featureFlags) states() map[string]featureFlagState {
+	states := map[string]featureFlagState{}
+	for _, name := range featureNames {
+		states[name] = f.state(name)
+	}
+	return states
+}
+
+// Serves the feature flags: GET /v1/features returns all of them and GET /v1/features/NAME one,
+// PUT /v1/features/NAME replaces the flag with the one of the body until the restart or
+// DELETE /v1/features/NAME, which goes back to the configured flag
+func (s *Scheduler) featuresHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/features"), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "expected a GET"})
+			return
+		}
+		writeJSON(w, http.StatusOK, s.features.states())
+		return
+	}
+	if err := (FeatureFlag{}).validate(name); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var flag FeatureFlag
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&flag); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := flag.validate(name); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		s.features.set(name, flag)
+		log.Printf("Feature flag %s set to %s", name, describeFlag(flag))
+	case http.MethodDelete:
+		s.features.reset(name)
+		flag, _ := s.features.flag(name)
+		log.Printf("Feature flag %s reset to %s", name, describeFlag(flag))
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "expected a GET, PUT or DELETE"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.features.state(name))
+}
+
+// Returns a short description of the flag for the logs
+func describeFlag(flag FeatureFlag) string {
+	if flag.Enabled != nil && !*flag.Enabled {
+		return "disabled"
+	}
+	description := "enabled"
+	if len(flag.Namespaces.Allow) > 0 {
+		description += " in " + strings.Join(flag.Namespaces.Allow, ", ")
+	}
+	if len(flag.Namespaces.Deny) > 0 {
+		description += " except " + strings.Join(flag.Namespaces.Deny, ", ")
+	}
+	return description
+}
@@ -0,0 +1,322 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/tracing"
+)
+
+// State shared by the filters during a scheduling attempt
+type cycleState struct {
+	scheduler   *Scheduler
+	ctx         context.Context
+	pod         kubernetes.KubePod
+	nodes       []kubernetes.KubeNode
+	nodesByName map[string]kubernetes.KubeNode
+
+	pods       []kubernetes.KubePod
+	podsLoaded bool
+	requested  map[string]resourceList
+	managed    map[string]int // Pods of the scheduler profiles by node
+	fit        resourceList   // Requests of the pod checked against the free resources
+
+	volumes *volumeState
+}
+
+// Returns the pods assigned to a node and not terminated, listed once per attempt
+func (s *cycleState) assignedPods() ([]kubernetes.KubePod, error) {
+	if s.podsLoaded {
+		return s.pods, nil
+	}
+	pods, err := s.scheduler.kubeAPI.ListAssignedPods(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.pods, s.podsLoaded = pods, true
+	return pods, nil
+}
+
+// Returns the resources requested by the pods assigned to the node and reserved on it
+func (s *cycleState) requestedOn(nodeName string) (resourceList, error) {
+	if s.requested == nil {
+		pods, err := s.assignedPods()
+		if err != nil {
+			return nil, err
+		}
+		s.requested = map[string]resourceList{}
+		for _, pod := range pods {
+			if s.requested[pod.Spec.NodeName] == nil {
+				s.requested[pod.Spec.NodeName] = resourceList{}
+			}
+			s.requested[pod.Spec.NodeName].add(podRequests(pod))
+		}
+		s.scheduler.reservations.addTo(s.requested, pods, s.pod)
+	}
+	return s.requested[nodeName], nil
+}
+
+// Returns the requests of the pod checked against the free resources of the nodes
+func (s *cycleState) fitRequests() resourceList {
+	if s.fit == nil {
+		s.fit = s.scheduler.fitRequests(s.ctx, s.pod)
+	}
+	return s.fit
+}
+
+// Name of the filter checking the requests of the pod against the free resources of the node
+const resourcesFitFilter = "NodeResourcesFit"
+
+// A filter returns nil if the pod can be placed on the node, or the reason why it can't
+type nodeFilter func(state *cycleState, node kubernetes.KubeNode) error
+
+// Filters run in order before scoring, a node must pass all of them
+var filters = []struct {
+	name   string
+	filter nodeFilter
+}{
+	{"NodeUnschedulable", nodeUnschedulableFilter},
+	{"NodeConditions", nodeConditionsFilter},
+	{"NodeFlapping", nodeFlappingFilter},
+	{"SysdigAlert", sysdigAlertFilter},
+	{"NodeAffinity", nodeAffinityFilter},
+	{"NodePool", nodePoolFilter},
+	{"ExcludedNodes", excludedNodesFilter},
+	{"NodePlatform", nodePlatformFilter},
+	{"PodAntiAffinity", podAntiAffinityFilter},
+	{"OnePerNode", onePerNodeFilter},
+	{"NodeWarmUp", nodeWarmUpFilter},
+	{"MaxPodsPerNode", maxPodsFilter},
+	{"PodTopologySpread", topologySpreadFilter},
+	{"VolumeBinding", volumeBindingFilter},
+	{"NamespaceQuota", namespaceQuotaFilter},
+	{"PriorityReservation", priorityReservationFilter},
+	// Last, so a node rejected by it passes all the others and can be freed by preemption
+	{resourcesFitFilter, nodeResourcesFitFilter},
+}
+
+// Reason of a node rejection, with the name of the filter that rejected it
+type filterError struct {
+	filter string
+	err    error
+}
+
+func (e filterError) Error() string {
+	return fmt.Sprintf("%s: %s", e.filter, e.err)
+}
+
+// Returns the names of the nodes passing all the filters, and the reason of the rejected ones
+func (s *Scheduler) filterNodes(ctx context.Context, pod kubernetes.KubePod, nodes []kubernetes.KubeNode) (candidates []string, rejected map[string]error) {
+	ctx, span := tracing.Start(ctx, "filter")
+	defer span.End()
+
+	state := s.newCycleState(ctx, pod, nodes)
+	rejected = map[string]error{}
+
+	for _, node := range nodes {
+		if err := filterNode(state, node); err != nil {
+			rejected[node.Metadata.Name] = err
+			continue
+		}
+		candidates = append(candidates, node.Metadata.Name)
+	}
+	candidates = preferHealthyNodes(state, candidates, rejected)
+	candidates = preferAnnotatedNodes(state, candidates, rejected)
+	candidates = preferPinnedNode(state, candidates, rejected)
+
+	for name, reason := range rejected {
+		log.Printf("Node %s rejected for %s: %s", name, pod.Metadata.Name, reason)
+	}
+	span.SetAttribute("candidates", len(candidates))
+	span.SetAttribute("rejected", len(rejected))
+	return
+}
+
+// Returns a filterError if a filter rejects the node
+func filterNode(state *cycleState, node kubernetes.KubeNode) error {
+	for _, f := range filters {
+		if err := f.filter(state, node); err != nil {
+			return filterError{f.name, err}
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) newCycleState(ctx context.Context, pod kubernetes.KubePod, nodes []kubernetes.KubeNode) *cycleState {
+	state := &cycleState{scheduler: s, ctx: ctx, pod: pod, nodes: nodes, nodesByName: map[string]kubernetes.KubeNode{}}
+	for _, node := range nodes {
+		state.nodesByName[node.Metadata.Name] = node
+	}
+	return state
+}
+
+// Returns the node with that name from the attempt nodes
+func (s *cycleState) node(name string) (kubernetes.KubeNode, bool) {
+	node, ok := s.nodesByName[name]
+	return node, ok
+}
+
+// Returns true if the pod is selected by an affinity term of a pod in namespace
+func termMatches(term kubernetes.KubePodAffinityTerm, termNamespace string, pod kubernetes.KubePod) bool {
+	namespaces := term.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{termNamespace}
+	}
+	for _, namespace := range namespaces {
+		if namespace == pod.Metadata.Namespace {
+			return term.LabelSelector.Matches(pod.Metadata.Labels)
+		}
+	}
+	return false
+}
+
+// Rejects the nodes in the same topology domain as pods matching a required anti-affinity term,
+// of the pod being scheduled or of the pods already running
+func podAntiAffinityFilter(state *cycleState, node kubernetes.KubeNode) error {
+	var podTerms []kubernetes.KubePodAffinityTerm
+	if affinity := state.pod.Spec.Affinity; affinity != nil && affinity.PodAntiAffinity != nil {
+		podTerms = affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	}
+
+	pods, err := state.assignedPods()
+	if err != nil {
+		return err
+	}
+
+	for _, other := range pods {
+		otherNode, ok := state.node(other.Spec.NodeName)
+		if !ok {
+			continue
+		}
+
+		for _, term := range podTerms {
+			if sameDomain(node, otherNode, term.TopologyKey) && termMatches(term, state.pod.Metadata.Namespace, other) {
+				return fmt.Errorf("pod %s/%s matches the anti-affinity of the pod in %s", other.Metadata.Namespace, other.Metadata.Name, term.TopologyKey)
+			}
+		}
+
+		if other.Spec.Affinity == nil || other.Spec.Affinity.PodAntiAffinity == nil {
+			continue
+		}
+		for _, term := range other.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			if sameDomain(node, otherNode, term.TopologyKey) && termMatches(term, other.Metadata.Namespace, state.pod) {
+				return fmt.Errorf("the anti-affinity of pod %s/%s matches the pod in %s", other.Metadata.Namespace, other.Metadata.Name, term.TopologyKey)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns true if both nodes have the same value for the topology key
+func sameDomain(a, b kubernetes.KubeNode, topologyKey string) bool {
+	value, ok := a.Metadata.Labels[topologyKey]
+	if !ok {
+		return false
+	}
+	other, ok := b.Metadata.Labels[topologyKey]
+	return ok && value == other
+}
+
+// Rejects the nodes where the pod would break a DoNotSchedule topology spread constraint
+func topologySpreadFilter(state *cycleState, node kubernetes.KubeNode) error {
+	for _, constraint := range state.pod.Spec.TopologySpreadConstraints {
+		if constraint.WhenUnsatisfiable != "" && constraint.WhenUnsatisfiable != "DoNotSchedule" {
+			continue
+		}
+
+		domain, ok := node.Metadata.Labels[constraint.TopologyKey]
+		if !ok {
+			return fmt.Errorf("node has no %s label", constraint.TopologyKey)
+		}
+
+		counts, err := state.domainCounts(constraint)
+		if err != nil {
+			return err
+		}
+		minimum := -1
+		for _, count := range counts {
+			if minimum < 0 || count < minimum {
+				minimum = count
+			}
+		}
+		if skew := counts[domain] + 1 - minimum; skew > constraint.MaxSkew {
+			return fmt.Errorf("skew %d in %s=%s exceeds the maximum of %d", skew, constraint.TopologyKey, domain, constraint.MaxSkew)
+		}
+	}
+	return nil
+}
+
+// Counts the pods matching the constraint selector in every topology domain of the nodes
+func (s *cycleState) domainCounts(constraint kubernetes.KubeTopologySpreadConstraint) (counts map[string]int, err error) {
+	pods, err := s.assignedPods()
+	if err != nil {
+		return
+	}
+
+	counts = map[string]int{}
+	for _, node := range s.nodes {
+		if domain, ok := node.Metadata.Labels[constraint.TopologyKey]; ok {
+			counts[domain] = 0
+		}
+	}
+	for _, pod := range pods {
+		if pod.Metadata.Namespace != s.pod.Metadata.Namespace || !constraint.LabelSelector.Matches(pod.Metadata.Labels) {
+			continue
+		}
+		node, ok := s.node(pod.Spec.NodeName)
+		if !ok {
+			continue
+		}
+		if domain, ok := node.Metadata.Labels[constraint.TopologyKey]; ok {
+			counts[domain]++
+		}
+	}
+	return
+}
+
+// Rejects the nodes without enough allocatable resources left for the requests of the pod
+func nodeResourcesFitFilter(state *cycleState, node kubernetes.KubeNode) error {
+	if len(node.Status.Allocatable) == 0 {
+		return nil
+	}
+	requested, err := state.requestedOn(node.Metadata.Name)
+	if err != nil {
+		return err
+	}
+
+	allocatable := parseResourceList(node.Status.Allocatable)
+	free := parseResourceList(node.Status.Allocatable)
+	free.sub(requested)
+	for name, value := range state.fitRequests() {
+		if _, exposed := allocatable[name]; value > 0 && !exposed {
+			if name == ephemeralStorage {
+				// Not reported by the kubelets without local storage isolation, nothing to check then
+				continue
+			}
+			// Extended resources like nvidia.com/gpu only exist on some nodes
+			return fmt.Errorf("node does not expose %s", name)
+		}
+		if value > 0 && free[name] < value {
+			return fmt.Errorf("insufficient %s", name)
+		}
+	}
+	return nil
+}
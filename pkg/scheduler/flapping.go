@@ -0,0 +1,111 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+func (c FlappingConfig) validate() error {
+	if c.MaxTransitions < 0 || c.Window < 0 {
+		return errors.New("flapping: maxTransitions and the window can't be negative")
+	}
+	return nil
+}
+
+// Changes of the Ready condition of the nodes seen by the node watch, within the flapping window
+type readyTransitions struct {
+	scheduler *Scheduler
+	mutex     sync.Mutex
+	nodes     map[string]*nodeTransitions
+}
+
+type nodeTransitions struct {
+	status string      // Last status of the Ready condition
+	times  []time.Time // Changes of the status, the oldest first
+}
+
+// Records a change of the Ready condition of the node since it was last seen
+func (t *readyTransitions) observe(node kubernetes.KubeNode) {
+	if t.scheduler.config.Flapping.MaxTransitions <= 0 {
+		return
+	}
+	status := "Unknown"
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == "Ready" {
+			status = condition.Status
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	seen, ok := t.nodes[node.Metadata.Name]
+	if !ok {
+		t.nodes[node.Metadata.Name] = &nodeTransitions{status: status}
+		return
+	}
+	if seen.status != status {
+		seen.status = status
+		seen.times = append(seen.times, time.Now())
+	}
+	seen.prune(t.scheduler.config.Flapping.Window)
+}
+
+// Drops the changes older than the window
+func (n *nodeTransitions) prune(window time.Duration) {
+	i := 0
+	for i < len(n.times) && time.Since(n.times[i]) > window {
+		i++
+	}
+	n.times = n.times[i:]
+}
+
+// Returns the number of changes of the Ready condition of the node during the window
+func (t *readyTransitions) count(nodeName string) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	seen, ok := t.nodes[nodeName]
+	if !ok {
+		return 0
+	}
+	seen.prune(t.scheduler.config.Flapping.Window)
+	return len(seen.times)
+}
+
+// Forgets a deleted node
+func (t *readyTransitions) remove(nodeName string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.nodes, nodeName)
+}
+
+// Rejects the nodes that went Ready and NotReady more than MaxTransitions times during the
+// window, whose pods would be restarted over and over
+func nodeFlappingFilter(state *cycleState, node kubernetes.KubeNode) error {
+	if state.scheduler.config.Flapping.MaxTransitions <= 0 {
+		return nil
+	}
+	if count := state.scheduler.transitions.count(node.Metadata.Name); count > state.scheduler.config.Flapping.MaxTransitions {
+		return fmt.Errorf("node Ready condition changed %d times in the last %s", count, state.scheduler.config.Flapping.Window)
+	}
+	return nil
+}
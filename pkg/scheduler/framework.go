@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Highest score of a node in the scheduling framework, framework.MaxNodeScore
+const MaxFrameworkScore = 100
+
+// NodeScore is the score of a node for a pod in the scheduling framework range
+type NodeScore struct {
+	Name  string
+	Score int64
+	Err   error // Why the node has no score, nil if it was scored
+}
+
+// Scores the nodes for the pod with the profile of the name, the first one if empty, from 0 to
+// MaxFrameworkScore: the best node gets the maximum, the nodes without metrics or past a
+// threshold 0. Used by the kube-scheduler plugin, the scheduler doesn't need to run.
+func (s *Scheduler) ScoreNodes(ctx context.Context, profileName string, pod kubernetes.KubePod, nodes []string) ([]NodeScore, error) {
+	profile, err := s.config.frameworkProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.SchedulingTimeout)
+	defer cancel()
+	scored := s.scoreNodes(ctx, profile, pod, nodes)
+	errs := map[string]error{}
+	for i, node := range scored {
+		if node.err != nil {
+			errs[node.name] = node.err
+		} else if node.names != nil {
+			// The nodes of a pool are scored with other metrics, they can't be compared on one scale
+			scored[i].err = failure.New(failure.NoNodeScored, failure.Score, "node of a node pool")
+			errs[node.name] = scored[i].err
+		}
+	}
+
+	var scores []NodeScore
+	for _, priority := range scaledPriorities(profile, scored, MaxFrameworkScore) {
+		scores = append(scores, NodeScore{Name: priority.Host, Score: priority.Score, Err: errs[priority.Host]})
+	}
+	return scores, nil
+}
+
+// Returns why the profile of the name, the first one if empty, rejects each of the nodes for the
+// pod: a filter of the scheduler, or a hard threshold of a metric. The requests are left to the
+// NodeResourcesFit plugin, which counts the victims of the preemption, and the nodes the scheduler
+// doesn't know yet are not rejected. Used by the kube-scheduler plugin.
+func (s *Scheduler) FilterNodes(ctx context.Context, profileName string, pod kubernetes.KubePod, nodes []string) (map[string]error, error) {
+	profile, err := s.config.frameworkProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.SchedulingTimeout)
+	defer cancel()
+	wanted := map[string]bool{}
+	for _, name := range nodes {
+		wanted[name] = true
+	}
+	var known []kubernetes.KubeNode
+	for _, node := range s.nodesAvailable(ctx) {
+		if wanted[node.Metadata.Name] {
+			known = append(known, node)
+		}
+	}
+
+	candidates, rejected := s.filterNodes(ctx, pod, known)
+	for name, reason := range rejected {
+		// Last filter, the node passed all the others
+		if f, ok := reason.(filterError); ok && f.filter == resourcesFitFilter {
+			delete(rejected, name)
+			candidates = append(candidates, name)
+		}
+	}
+	if profile.hasThresholds() && len(candidates) > 0 {
+		for name, reason := range thresholdRejections(s.scoreNodes(ctx, profile, pod, candidates)) {
+			rejected[name] = reason
+		}
+	}
+	return rejected, nil
+}
+
+// Returns the profile of the name, the first one if empty
+func (c *Config) frameworkProfile(name string) (*Profile, error) {
+	if name == "" && len(c.Profiles) > 0 {
+		return c.Profiles[0], nil
+	}
+	if profile := c.profileByName(name); profile != nil {
+		return profile, nil
+	}
+	return nil, fmt.Errorf("profile %q is not defined", name)
+}
@@ -0,0 +1,338 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotations grouping the pods that must be bound together
+const (
+	podGroupAnnotation  = "sysdig-scheduler/pod-group"
+	minMemberAnnotation = "sysdig-scheduler/min-member"
+)
+
+// Pods of a group waiting until the whole group can be placed
+type podGroup struct {
+	profile    *Profile
+	minMember  int
+	pods       map[string]kubernetes.KubePod // Indexed by pod name
+	bound      int                           // Members already bound, counted toward minMember
+	scheduling bool                          // Set while an attempt places the group, outside of the lock
+}
+
+type gangScheduler struct {
+	scheduler *Scheduler
+	mutex     sync.Mutex
+	groups    map[string]*podGroup // Indexed by namespace/group
+}
+
+// Returns the namespace/group key of the pod, if it belongs to a group
+func podGroupOf(pod kubernetes.KubePod) (key string, ok bool) {
+	group, ok := pod.Metadata.Annotations[podGroupAnnotation]
+	if !ok || group == "" {
+		return "", false
+	}
+	return pod.Metadata.Namespace + "/" + group, true
+}
+
+// Adds a pod to its group and tries to schedule the group
+func (g *gangScheduler) add(ctx context.Context, profile *Profile, pod kubernetes.KubePod) {
+	key, _ := podGroupOf(pod)
+	minMember, err := strconv.Atoi(pod.Metadata.Annotations[minMemberAnnotation])
+	if err != nil || minMember < 1 {
+		minMember = 1
+	}
+
+	g.mutex.Lock()
+	group, ok := g.groups[key]
+	if !ok {
+		group = &podGroup{profile: profile, pods: map[string]kubernetes.KubePod{}}
+		g.groups[key] = group
+	}
+	if minMember > group.minMember {
+		group.minMember = minMember
+	}
+	group.pods[pod.Metadata.Name] = pod
+	g.mutex.Unlock()
+
+	g.trySchedule(ctx, key)
+}
+
+// Drops a deleted pod from its group, the group is forgotten once empty
+func (g *gangScheduler) remove(pod kubernetes.KubePod) {
+	key, ok := podGroupOf(pod)
+	if !ok {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if group, ok := g.groups[key]; ok {
+		delete(group.pods, pod.Metadata.Name)
+		if len(group.pods) == 0 {
+			delete(g.groups, key)
+		}
+	}
+}
+
+// Binds all the pods of the group if, with the members already bound, there are at least
+// minMember of them and they all fit. The pods are copied under the lock, and placed and bound
+// without it; a single attempt runs per group. The members bound before a failed binding count
+// toward minMember, so the next attempt places the rest of the group.
+func (g *gangScheduler) trySchedule(ctx context.Context, key string) {
+	g.mutex.Lock()
+	group, ok := g.groups[key]
+	if !ok || group.scheduling {
+		g.mutex.Unlock()
+		return
+	}
+	if len(group.pods)+group.bound < group.minMember {
+		log.Printf("pod group %s: waiting for members, %d of %d", key, len(group.pods)+group.bound, group.minMember)
+		g.mutex.Unlock()
+		return
+	}
+	profile := group.profile
+	var pods []kubernetes.KubePod
+	for _, pod := range group.pods {
+		pods = append(pods, pod)
+	}
+	group.scheduling = true
+	g.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, g.scheduler.config.SchedulingTimeout)
+	defer cancel()
+
+	var bound []string
+	placement, err := g.scheduler.placeGroup(ctx, profile, pods)
+	if err == nil {
+		err = g.scheduler.reservePlacement(ctx, pods, placement)
+	}
+	if err != nil {
+		log.Printf("pod group %s: not scheduled, %s", key, err)
+		placement = nil
+	}
+	for _, pod := range pods {
+		nodeName, ok := placement[pod.Metadata.Name]
+		if !ok {
+			continue
+		}
+		g.scheduler.annotateReservation(ctx, pod, nodeName)
+		err := g.scheduler.bindPod(ctx, pod, nodeName)
+		if err != nil {
+			g.scheduler.reservations.release(pod)
+		}
+		if conflict := failure.ReasonOf(err) == failure.BindConflict; err != nil && !conflict {
+			log.Printf("pod group %s: error while binding %s to %s: %s", key, pod.Metadata.Name, nodeName, err)
+			continue
+		}
+		bound = append(bound, pod.Metadata.Name)
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	group.scheduling = false
+	for _, name := range bound {
+		if _, ok := group.pods[name]; ok {
+			delete(group.pods, name)
+			group.bound++
+		}
+	}
+	// The group may have been emptied and created again meanwhile
+	if len(group.pods) == 0 && g.groups[key] == group {
+		delete(g.groups, key)
+	}
+}
+
+// Reserves the nodes of the placement for every pod of the group before any is bound, the filters
+// running again with the reservations of the members placed before. If a node no longer fits, the
+// reservations of the group are released and the group is not bound.
+func (s *Scheduler) reservePlacement(ctx context.Context, pods []kubernetes.KubePod, placement map[string]string) error {
+	var reserved []kubernetes.KubePod
+	for _, pod := range pods {
+		nodeName, ok := placement[pod.Metadata.Name]
+		if !ok {
+			continue
+		}
+		if err := s.reservations.reserve(ctx, pod, nodeName); err != nil {
+			for _, other := range reserved {
+				s.reservations.release(other)
+			}
+			return fmt.Errorf("pod %s: %s", pod.Metadata.Name, err)
+		}
+		reserved = append(reserved, pod)
+	}
+	return nil
+}
+
+// Assigns a node to every pod of the group, walking the nodes from best to worst score and
+// keeping track of the resources already taken by the group and reserved for the other pods.
+// Every pod only takes the nodes passing its own filters, and the nodes without metrics only
+// after the scored ones and if the fallback of the profile takes them, never the nodes past a
+// threshold. Fails if a pod doesn't fit.
+func (s *Scheduler) placeGroup(ctx context.Context, profile *Profile, pods []kubernetes.KubePod) (placement map[string]string, err error) {
+	pods = append([]kubernetes.KubePod(nil), pods...)
+	// The biggest pods are placed first
+	sort.Slice(pods, func(i, j int) bool {
+		a, b := podRequests(pods[i]), podRequests(pods[j])
+		if a["cpu"] != b["cpu"] {
+			return a["cpu"] > b["cpu"]
+		}
+		return a["memory"] > b["memory"]
+	})
+
+	nodes := s.nodesAvailable(ctx)
+	allowed := map[string]map[string]bool{} // Nodes passing the filters, by pod name
+	var union []string
+	for _, pod := range pods {
+		candidates, _ := s.filterNodes(ctx, pod, nodes)
+		allowed[pod.Metadata.Name] = map[string]bool{}
+		for _, name := range candidates {
+			if !allowedByAny(allowed, name) {
+				union = append(union, name)
+			}
+			allowed[pod.Metadata.Name][name] = true
+		}
+	}
+	// The nodes are ranked once, by their metrics
+	scored := s.scoreNodes(ctx, profile, pods[0], union)
+	var ranked NodeList
+	unscored := map[string]bool{}
+	for _, node := range scored {
+		if node.err == nil {
+			ranked = append(ranked, node)
+		} else {
+			unscored[node.name] = true
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if profile.lowerIsBetter() {
+			return ranked[i].score < ranked[j].score
+		}
+		return ranked[i].score > ranked[j].score
+	})
+	for _, name := range s.fallbackCandidates(profile, pods[0], union, scored) {
+		if unscored[name] {
+			ranked = append(ranked, Node{name: name})
+		}
+	}
+
+	free, err := s.freeByNode(ctx, nodes)
+	if err != nil {
+		return
+	}
+
+	placement = map[string]string{}
+	for _, pod := range pods {
+		requests := podRequests(pod)
+		placed := false
+		for _, node := range ranked {
+			if allowed[pod.Metadata.Name][node.name] && free[node.name].fits(requests) {
+				free[node.name].sub(requests)
+				placement[pod.Metadata.Name] = node.name
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			return nil, fmt.Errorf("not enough capacity for pod %s", pod.Metadata.Name)
+		}
+	}
+	return
+}
+
+// Returns true if a pod of the group already passed the filters of the node
+func allowedByAny(allowed map[string]map[string]bool, node string) bool {
+	for _, nodes := range allowed {
+		if nodes[node] {
+			return true
+		}
+	}
+	return false
+}
+
+// Retries the waiting groups periodically until the context is done, dropping the pods
+// that don't exist anymore or were bound by someone else
+func (g *gangScheduler) retryLoop(ctx context.Context) {
+	ticker := time.NewTicker(g.scheduler.config.GangRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// The pods are read again without the lock
+		g.mutex.Lock()
+		waiting := map[string][]kubernetes.KubePod{}
+		for key, group := range g.groups {
+			for _, pod := range group.pods {
+				waiting[key] = append(waiting[key], pod)
+			}
+		}
+		g.mutex.Unlock()
+
+		bound, deleted := map[string][]string{}, map[string][]string{}
+		for key, pods := range waiting {
+			for _, pod := range pods {
+				current, err := g.scheduler.kubeAPI.GetPod(ctx, pod.Metadata.Namespace, pod.Metadata.Name)
+				if err == nil && current.Spec.NodeName != "" {
+					bound[key] = append(bound[key], pod.Metadata.Name)
+				} else if statusError, ok := err.(*kubernetes.StatusError); ok && statusError.Code == 404 {
+					deleted[key] = append(deleted[key], pod.Metadata.Name)
+				}
+			}
+		}
+
+		g.mutex.Lock()
+		var keys []string
+		for key := range waiting {
+			group, ok := g.groups[key]
+			if !ok {
+				continue
+			}
+			for _, name := range bound[key] {
+				if _, ok := group.pods[name]; ok {
+					delete(group.pods, name)
+					group.bound++
+				}
+			}
+			for _, name := range deleted[key] {
+				delete(group.pods, name)
+			}
+			if len(group.pods) == 0 {
+				delete(g.groups, key)
+				continue
+			}
+			keys = append(keys, key)
+		}
+		g.mutex.Unlock()
+
+		for _, key := range keys {
+			g.trySchedule(ctx, key)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"sync"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Pods waiting for their scheduling gates to be removed, indexed by namespace/name
+type gatedPodSet struct {
+	mutex sync.Mutex
+	pods  map[string]bool
+}
+
+// Returns true if the pod has scheduling gates left, it is then remembered until they are removed
+func (g *gatedPodSet) gated(pod kubernetes.KubePod) bool {
+	if len(pod.Spec.SchedulingGates) == 0 {
+		return false
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.pods[pod.Metadata.Namespace+"/"+pod.Metadata.Name] = true
+	return true
+}
+
+// Returns true the first time the pod is seen without gates after it was gated
+func (g *gatedPodSet) released(pod kubernetes.KubePod) bool {
+	if len(pod.Spec.SchedulingGates) > 0 {
+		return false
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	key := pod.Metadata.Namespace + "/" + pod.Metadata.Name
+	if !g.pods[key] {
+		return false
+	}
+	delete(g.pods, key)
+	return true
+}
+
+// Forgets a deleted pod
+func (g *gatedPodSet) remove(pod kubernetes.KubePod) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.pods, pod.Metadata.Namespace+"/"+pod.Metadata.Name)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Nodes and pods whose state was dropped once they were deleted
+var (
+	forgottenNodes = expvar.NewInt("forgottenNodes")
+	forgottenPods  = expvar.NewInt("forgottenPods")
+)
+
+func init() {
+	// Summed over the running schedulers
+	expvar.Publish("stateSize", expvar.Func(func() interface{} {
+		sizes := map[string]int{}
+		for _, s := range running.all() {
+			for name, size := range s.stateSizes() {
+				sizes[name] += size
+			}
+		}
+		return sizes
+	}))
+}
+
+type nodeEvent struct {
+	Type   string              `json:"type"`
+	Object kubernetes.KubeNode `json:"object"`
+}
+
+// Follows the nodes until the context is done: their Ready changes are recorded for the flapping
+// filter, and the state kept for them is dropped once they are deleted, so the nodes removed by the
+// autoscalers don't pile up in a long running scheduler. Every time the watch is opened the nodes
+// seen before and deleted meanwhile are dropped too.
+func (s *Scheduler) watchNodes(ctx context.Context) {
+	known := map[string]bool{}
+	for ctx.Err() == nil {
+		if nodes, err := s.kubeAPI.ListNodes(ctx); err != nil {
+			log.Println("error while listing the nodes to forget:", err)
+		} else {
+			current := map[string]bool{}
+			for _, node := range nodes {
+				current[node.Metadata.Name] = true
+				s.transitions.observe(node)
+			}
+			for name := range known {
+				if !current[name] {
+					s.forgetNode(ctx, name)
+				}
+			}
+			known = current
+		}
+
+		ch, err := s.kubeAPI.Watch(ctx, "GET", "api/v1/nodes", nil, nil)
+		if err != nil {
+			log.Println("error while watching the deleted nodes:", err)
+		} else {
+			for data := range ch {
+				event := nodeEvent{}
+				if err := json.Unmarshal(data, &event); err != nil {
+					log.Println("error while decoding a node event:", err)
+					continue
+				}
+				switch event.Type {
+				case "ADDED", "MODIFIED":
+					known[event.Object.Metadata.Name] = true
+					s.transitions.observe(event.Object)
+				case "DELETED":
+					delete(known, event.Object.Metadata.Name)
+					s.forgetNode(ctx, event.Object.Metadata.Name)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Drops the metrics, breakers, bindings, gauges, history, alert, pins and Ready changes of a deleted node
+func (s *Scheduler) forgetNode(ctx context.Context, nodeName string) {
+	log.Printf("Node %s deleted, forgetting its state", nodeName)
+	s.invalidateNodeMetrics(ctx, nodeName)
+	s.breakers.remove(nodeName)
+	s.ledger.remove(nodeName)
+	s.forgetBinding(nodeName)
+	s.gauges.remove(nodeName)
+	s.history.removeNode(nodeName)
+	s.alerted.clear(nodeName)
+	s.pins.removeNode(nodeName)
+	s.transitions.remove(nodeName)
+	forgottenNodes.Add(1)
+}
+
+// Drops a deleted pod from the queue, the gates, the reservations and the pods waiting for a node
+// or their group
+func (s *Scheduler) forgetPod(pod kubernetes.KubePod) {
+	s.queue.remove(pod)
+	s.gatedPods.remove(pod)
+	s.reservations.release(pod)
+	s.unschedulablePods.remove(pod)
+	s.recoveredPods.remove(pod)
+	s.gangs.remove(pod)
+	forgottenPods.Add(1)
+}
+
+// Returns the number of entries kept by the per node and per pod state, to spot a leak
+func (s *Scheduler) stateSizes() map[string]int {
+	sizes := map[string]int{}
+	for _, profile := range s.profiles.all() {
+		for _, variant := range profile.withVariants() {
+			if variant.prefetched != nil {
+				variant.prefetched.mutex.RLock()
+				sizes["prefetchedNodes"] += len(variant.prefetched.values)
+				variant.prefetched.mutex.RUnlock()
+			}
+			if variant.smoothed != nil {
+				variant.smoothed.mutex.Lock()
+				sizes["smoothedNodes"] += len(variant.smoothed.nodes)
+				variant.smoothed.mutex.Unlock()
+			}
+		}
+	}
+
+	s.breakers.mutex.Lock()
+	sizes["breakers"] = len(s.breakers.nodes)
+	s.breakers.mutex.Unlock()
+	s.ledger.mutex.Lock()
+	sizes["ledgerNodes"] = len(s.ledger.nodes)
+	s.ledger.mutex.Unlock()
+	s.lastBindingsMutex.Lock()
+	sizes["lastBindings"] = len(s.lastBindings)
+	s.lastBindingsMutex.Unlock()
+	s.gauges.mutex.Lock()
+	for _, nodes := range s.gauges.profiles {
+		sizes["gaugeNodes"] += len(nodes)
+	}
+	s.gauges.mutex.Unlock()
+	s.history.mutex.Lock()
+	sizes["historyNodes"] = len(s.history.nodes)
+	s.history.mutex.Unlock()
+	s.alerted.mutex.Lock()
+	sizes["alertedNodes"] = len(s.alerted.nodes)
+	s.alerted.mutex.Unlock()
+	s.pins.mutex.Lock()
+	sizes["pinnedOrdinals"] = len(s.pins.nodes)
+	s.pins.mutex.Unlock()
+	s.transitions.mutex.Lock()
+	sizes["readyTransitions"] = len(s.transitions.nodes)
+	s.transitions.mutex.Unlock()
+
+	sizes["queuedPods"] = s.queue.length()
+	s.gatedPods.mutex.Lock()
+	sizes["gatedPods"] = len(s.gatedPods.pods)
+	s.gatedPods.mutex.Unlock()
+	s.reservations.mutex.Lock()
+	sizes["reservations"] = len(s.reservations.pods)
+	s.reservations.mutex.Unlock()
+	s.unschedulablePods.mutex.Lock()
+	sizes["unschedulablePods"] = len(s.unschedulablePods.pods)
+	s.unschedulablePods.mutex.Unlock()
+	s.recoveredPods.mutex.Lock()
+	sizes["recoveredPods"] = len(s.recoveredPods.uids)
+	s.recoveredPods.mutex.Unlock()
+	s.gangs.mutex.Lock()
+	sizes["podGroups"] = len(s.gangs.groups)
+	s.gangs.mutex.Unlock()
+	return sizes
+}
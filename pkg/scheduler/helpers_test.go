@@ -0,0 +1,104 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Requests received by a fake api server, as "METHOD path"
+type apiRequests struct {
+	mutex    sync.Mutex
+	requests []string
+}
+
+func (r *apiRequests) add(request string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, request)
+}
+
+// Returns the number of requests received with the method and path
+func (r *apiRequests) count(request string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	count := 0
+	for _, received := range r.requests {
+		if received == request {
+			count++
+		}
+	}
+	return count
+}
+
+// Points the Kubernetes client of the scheduler to a fake api server answering with the handler,
+// 201 without one, for the duration of the test
+func (s *Scheduler) fakeKubeAPI(t *testing.T, handler http.HandlerFunc) *apiRequests {
+	t.Helper()
+	received := &apiRequests{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.add(r.Method + " " + r.URL.Path)
+		if handler == nil {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("{}"))
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	data := "apiVersion: v1\nclusters:\n- name: test\n  cluster:\n    server: " + server.URL +
+		"\ncontexts:\n- name: test\n  context:\n    cluster: test\n    user: test\ncurrent-context: test\nusers:\n- name: test\n  user:\n    token: test\n"
+	if err := ioutil.WriteFile(kubeconfig, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.kubeAPI.LoadKubeConfigFile(kubeconfig); err != nil {
+		t.Fatal(err)
+	}
+	return received
+}
+
+// Returns a scheduler with the configuration, whose clients are not loaded
+func testScheduler(c Config) *Scheduler {
+	s := newScheduler()
+	s.config = c
+	return s
+}
+
+func testPod(namespace, name string, labels, annotations map[string]string) (pod kubernetes.KubePod) {
+	pod.Metadata.Namespace = namespace
+	pod.Metadata.Name = name
+	pod.Metadata.Labels = labels
+	pod.Metadata.Annotations = annotations
+	return
+}
+
+func testBudget(namespace string, allowed int, labels map[string]string) (budget kubernetes.KubePodDisruptionBudget) {
+	budget.Metadata.Namespace = namespace
+	budget.Metadata.Name = "budget"
+	budget.Spec.Selector = &kubernetes.KubeLabelSelector{MatchLabels: labels}
+	budget.Status.DisruptionsAllowed = allowed
+	return
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// A node in a scoring round, with its score or the reason it was left out
+type nodeHistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Pod     string    `json:"pod"`
+	Profile string    `json:"profile"`
+	Score   *float64  `json:"score,omitempty"`
+	Metrics []float64 `json:"metrics,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Chosen  bool      `json:"chosen"`
+}
+
+// Last scoring rounds of every node and last decisions of the pods, for the admin api
+type scoreHistory struct {
+	mutex     sync.Mutex
+	perNode   int
+	nodes     map[string][]nodeHistoryEntry
+	perPod    int
+	decisions []*auditRecord
+}
+
+// Keeps perNode rounds of every node and the perPod last decisions, 20 and 1000 if 0
+func newScoreHistory(perNode, perPod int) *scoreHistory {
+	if perNode <= 0 {
+		perNode = 20
+	}
+	if perPod <= 0 {
+		perPod = 1000
+	}
+	return &scoreHistory{perNode: perNode, perPod: perPod, nodes: map[string][]nodeHistoryEntry{}}
+}
+
+// Adds the decision and the rounds of its candidate and rejected nodes
+func (h *scoreHistory) record(record *auditRecord) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	pod := record.Namespace + "/" + record.Pod
+	for _, candidate := range record.Candidates {
+		h.add(candidate.Node, nodeHistoryEntry{
+			Time:    record.Time,
+			Pod:     pod,
+			Profile: record.Profile,
+			Score:   candidate.Score,
+			Metrics: candidate.Metrics,
+			Reason:  candidate.Error,
+			Chosen:  candidate.Node == record.Node,
+		})
+	}
+	for node, reason := range record.Rejected {
+		h.add(node, nodeHistoryEntry{Time: record.Time, Pod: pod, Profile: record.Profile, Reason: reason})
+	}
+
+	h.decisions = append(h.decisions, record)
+	if len(h.decisions) > h.perPod {
+		h.decisions = h.decisions[len(h.decisions)-h.perPod:]
+	}
+}
+
+func (h *scoreHistory) add(node string, entry nodeHistoryEntry) {
+	entries := append(h.nodes[node], entry)
+	if len(entries) > h.perNode {
+		entries = entries[len(entries)-h.perNode:]
+	}
+	h.nodes[node] = entries
+}
+
+// Returns the rounds of the node, the oldest first
+func (h *scoreHistory) node(name string) []nodeHistoryEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]nodeHistoryEntry{}, h.nodes[name]...)
+}
+
+// Forgets the rounds of a deleted node, its decisions are kept with the ones of the pods
+func (h *scoreHistory) removeNode(name string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.nodes, name)
+}
+
+// Returns the decisions kept for the pod, the oldest first
+func (h *scoreHistory) pod(namespace, name string) (decisions []*auditRecord) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	decisions = []*auditRecord{}
+	for _, record := range h.decisions {
+		if record.Namespace == namespace && record.Pod == name {
+			decisions = append(decisions, record)
+		}
+	}
+	return
+}
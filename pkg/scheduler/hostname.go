@@ -0,0 +1,233 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+)
+
+// Strategies finding the host name of a node
+const (
+	hostnameShort      = "short"
+	hostnameNode       = "node"
+	hostnameLabel      = "label"
+	hostnameInstanceID = "instance-id"
+	hostnameTemplate   = "template"
+	hostnameRegex      = "regex"
+)
+
+// Fields available in the host name templates
+type hostnameTemplateData struct {
+	Node       string
+	Labels     map[string]string
+	InstanceID string
+}
+
+func (h HostnameConfig) validate() error {
+	switch h.Strategy {
+	case "", hostnameShort, hostnameNode, hostnameInstanceID:
+	case hostnameLabel:
+		if h.Label == "" {
+			return fmt.Errorf("the label must be set with the label strategy")
+		}
+	case hostnameTemplate:
+		if _, err := template.New("hostname").Parse(h.Template); err != nil || h.Template == "" {
+			return fmt.Errorf("invalid template %q: %v", h.Template, err)
+		}
+	case hostnameRegex:
+		if _, err := regexp.Compile(h.Regex); err != nil || h.Regex == "" {
+			return fmt.Errorf("invalid regex %q: %v", h.Regex, err)
+		}
+	default:
+		return fmt.Errorf("unknown strategy %q", h.Strategy)
+	}
+	switch h.Case {
+	case "", "lower", "upper":
+	default:
+		return fmt.Errorf("unknown case %q", h.Case)
+	}
+	if h.AliasConfigMap != nil && (h.AliasConfigMap.Namespace == "" || h.AliasConfigMap.Name == "") {
+		return fmt.Errorf("the alias configmap namespace and name must be set")
+	}
+	return nil
+}
+
+// Annotation of a node with the host name its monitoring agent reports, when it can't be found
+// from the node name, like after a cloud rename
+const hostAliasAnnotation = "sysdig-scheduler/host-alias"
+
+// Returns the function finding the host name of a node: its alias if it has one, otherwise the
+// host name of the strategy of the configuration in the configured case
+func (s *Scheduler) hostnameFunc(h *HostnameConfig) metrics.HostnameFunc {
+	base := s.strategyHostnameFunc(h)
+	if base == nil {
+		base = metrics.ShortHostname
+	}
+	if h == nil {
+		h = &HostnameConfig{}
+	}
+	var configMap *hostAliasConfigMap
+	if h.AliasConfigMap != nil {
+		configMap = &hostAliasConfigMap{scheduler: s, ref: *h.AliasConfigMap}
+	}
+
+	return func(ctx context.Context, nodeName string) (string, error) {
+		if alias, ok := h.Aliases[nodeName]; ok {
+			return alias, nil
+		}
+		if alias, ok := configMap.lookup(ctx, nodeName); ok {
+			return alias, nil
+		}
+		// The nodes of the other clusters are not known, they have no annotation then
+		if node, err := s.findNode(ctx, nodeName); err == nil && node.Metadata.Annotations[hostAliasAnnotation] != "" {
+			return node.Metadata.Annotations[hostAliasAnnotation], nil
+		}
+
+		host, err := base(ctx, nodeName)
+		switch h.Case {
+		case "lower":
+			host = strings.ToLower(host)
+		case "upper":
+			host = strings.ToUpper(host)
+		}
+		return host, err
+	}
+}
+
+// Time the aliases of the ConfigMap are kept before it is read again
+const hostAliasRefresh = time.Minute
+
+// ConfigMap whose keys are node names and values the host names of the nodes, read again after
+// hostAliasRefresh
+type hostAliasConfigMap struct {
+	scheduler *Scheduler
+	ref       SecretRef
+	mutex     sync.Mutex
+	aliases   map[string]string
+	read      time.Time
+}
+
+// Returns the alias of the node in the ConfigMap. If it can't be read, the aliases read before are used.
+func (c *hostAliasConfigMap) lookup(ctx context.Context, nodeName string) (alias string, ok bool) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if time.Since(c.read) > hostAliasRefresh {
+		data, err := c.scheduler.kubeAPI.GetConfigMap(ctx, c.ref.Namespace, c.ref.Name)
+		if err != nil {
+			log.Printf("Error reading the host aliases of configmap %s/%s: %s", c.ref.Namespace, c.ref.Name, err)
+		} else {
+			c.aliases = data
+		}
+		c.read = time.Now()
+	}
+	alias, ok = c.aliases[nodeName]
+	return
+}
+
+// Returns the function finding the host name of a node with the strategy of the configuration,
+// nil for the short host name. The strategies reading the node only know the local nodes.
+func (s *Scheduler) strategyHostnameFunc(h *HostnameConfig) metrics.HostnameFunc {
+	if h == nil {
+		return nil
+	}
+	switch h.Strategy {
+	case hostnameNode:
+		return func(ctx context.Context, nodeName string) (string, error) {
+			return nodeName, nil
+		}
+	case hostnameRegex:
+		regex := regexp.MustCompile(h.Regex)
+		return func(ctx context.Context, nodeName string) (string, error) {
+			match := regex.FindStringSubmatch(nodeName)
+			if match == nil {
+				return "", fmt.Errorf("node %s does not match the hostname regex", nodeName)
+			}
+			return match[len(match)-1], nil
+		}
+	case hostnameLabel:
+		return func(ctx context.Context, nodeName string) (string, error) {
+			node, err := s.findNode(ctx, nodeName)
+			if err != nil {
+				return "", err
+			}
+			value, ok := node.Metadata.Labels[h.Label]
+			if !ok {
+				return "", fmt.Errorf("node %s has no %s label", nodeName, h.Label)
+			}
+			return value, nil
+		}
+	case hostnameInstanceID:
+		return func(ctx context.Context, nodeName string) (string, error) {
+			providerID, err := s.nodeProviderID(ctx, nodeName)
+			return instanceID(providerID), err
+		}
+	case hostnameTemplate:
+		tmpl := template.Must(template.New("hostname").Parse(h.Template))
+		return func(ctx context.Context, nodeName string) (string, error) {
+			node, err := s.findNode(ctx, nodeName)
+			if err != nil {
+				return "", err
+			}
+			host := bytes.Buffer{}
+			err = tmpl.Execute(&host, hostnameTemplateData{Node: nodeName, Labels: node.Metadata.Labels, InstanceID: instanceID(node.Spec.ProviderID)})
+			return host.String(), err
+		}
+	}
+	return nil
+}
+
+// Returns the instance id of a cloud provider id, its last part: i-0abc of aws:///us-east-1a/i-0abc
+func instanceID(providerID string) string {
+	parts := strings.Split(strings.TrimRight(providerID, "/"), "/")
+	return parts[len(parts)-1]
+}
+
+// Returns the cloud provider id of the ready node with that name
+func (s *Scheduler) nodeProviderID(ctx context.Context, nodeName string) (string, error) {
+	node, err := s.findNode(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+	if node.Spec.ProviderID == "" {
+		return "", fmt.Errorf("node %s has no provider id", nodeName)
+	}
+	return node.Spec.ProviderID, nil
+}
+
+// Returns the ready node with that name
+func (s *Scheduler) findNode(ctx context.Context, nodeName string) (node kubernetes.KubeNode, err error) {
+	for _, node := range s.allReadyNodes(ctx) {
+		if node.Metadata.Name == nodeName {
+			return node, nil
+		}
+	}
+	return node, fmt.Errorf("node %s not found", nodeName)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Returns the image name with the registry, repository and tag Docker defaults, so that nginx
+// and docker.io/library/nginx:latest are the same image
+func normalizeImage(image string) string {
+	name, suffix := image, ""
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, suffix = name[:i], name[i:]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, suffix = name[:i], name[i:]
+	} else {
+		suffix = ":latest"
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 1 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		if len(parts) == 1 {
+			name = "library/" + name
+		}
+		name = "docker.io/" + name
+	}
+	return name + suffix
+}
+
+// Returns the size in bytes of the images of the pod containers already present on the node
+func imageBytesOnNode(pod kubernetes.KubePod, node kubernetes.KubeNode) (size int64) {
+	present := map[string]int64{}
+	for _, image := range node.Status.Images {
+		for _, name := range image.Names {
+			present[normalizeImage(name)] = image.SizeBytes
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		size += present[normalizeImage(container.Image)]
+	}
+	return
+}
+
+// Scores the nodes with the megabytes of the pod images they would have to pull, lower is better.
+// The size of an image missing on a node is its size on the other nodes, 0 if no node has it.
+type imageLocalityScorer struct {
+	schedulerScorer
+}
+
+func (s *imageLocalityScorer) Name() string {
+	return "image-locality"
+}
+
+func (s *imageLocalityScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (float64, error) {
+	sizes := map[string]int64{}
+	var present map[string]bool
+	for _, kubeNode := range s.scheduler.allReadyNodes(ctx) {
+		onNode := map[string]bool{}
+		for _, image := range kubeNode.Status.Images {
+			for _, name := range image.Names {
+				name = normalizeImage(name)
+				onNode[name] = true
+				if image.SizeBytes > sizes[name] {
+					sizes[name] = image.SizeBytes
+				}
+			}
+		}
+		if kubeNode.Metadata.Name == node.Name {
+			present = onNode
+		}
+	}
+
+	var missing int64
+	for _, image := range pod.Images {
+		if image = normalizeImage(image); !present[image] {
+			missing += sizes[image]
+		}
+	}
+	return float64(missing) / 1e6, nil
+}
@@ -0,0 +1,358 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Parameters of the installation manifests
+type installParameters struct {
+	Namespace     string
+	Image         string
+	SchedulerName string
+	Config        string // Content of the configuration file
+	TokenSecret   string // Secret with the Sysdig token in its "token" key, empty if not needed
+	Token         string // Token to create the secret with, empty to use an existing secret
+}
+
+// Manifests of the scheduler, applied in order
+var installManifests = template.Must(template.New("install").Funcs(template.FuncMap{"indent": indent}).Parse(`
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{.SchedulerName}}
+  namespace: {{.Namespace}}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: {{.SchedulerName}}
+rules:
+  - apiGroups: [""]
+    resources: ["pods"]
+    verbs: ["get", "list", "watch", "create", "delete", "patch"]
+  - apiGroups: [""]
+    resources: ["pods/binding", "bindings", "pods/eviction"]
+    verbs: ["create"]
+  - apiGroups: [""]
+    resources: ["pods/status"]
+    verbs: ["patch"]
+  - apiGroups: [""]
+    resources: ["events"]
+    verbs: ["create"]
+  - apiGroups: [""]
+    resources: ["nodes"]
+    verbs: ["get", "list", "watch", "patch"]
+  - apiGroups: [""]
+    resources: ["nodes/proxy", "nodes/metrics"]
+    verbs: ["get"]
+  - apiGroups: [""]
+    resources: ["secrets"]
+    verbs: ["get"]
+  - apiGroups: [""]
+    resources: ["persistentvolumes"]
+    verbs: ["list"]
+  - apiGroups: [""]
+    resources: ["services"]
+    verbs: ["get"]
+  - apiGroups: [""]
+    resources: ["resourcequotas"]
+    verbs: ["list"]
+  - apiGroups: [""]
+    resources: ["configmaps"]
+    verbs: ["get", "list", "watch", "create", "patch"]
+  - apiGroups: [""]
+    resources: ["persistentvolumeclaims"]
+    verbs: ["get", "list", "patch"]
+  - apiGroups: ["storage.k8s.io"]
+    resources: ["storageclasses"]
+    verbs: ["list"]
+  - apiGroups: ["storage.k8s.io"]
+    resources: ["csinodes"]
+    verbs: ["get"]
+  - apiGroups: ["apps"]
+    resources: ["replicasets", "deployments", "statefulsets"]
+    verbs: ["get", "list", "patch"]
+  - apiGroups: ["policy"]
+    resources: ["poddisruptionbudgets"]
+    verbs: ["list"]
+  - apiGroups: ["metrics.k8s.io"]
+    resources: ["nodes"]
+    verbs: ["get"]
+  - apiGroups: ["custom.metrics.k8s.io"]
+    resources: ["nodes/*"]
+    verbs: ["get"]
+  - apiGroups: ["scheduling.sysdig.com"]
+    resources: ["schedulingpolicies", "nodepools"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: ["scheduling.sysdig.com"]
+    resources: ["nodescores"]
+    verbs: ["get", "create", "patch"]
+  - apiGroups: ["karpenter.sh"]
+    resources: ["nodeclaims"]
+    verbs: ["get", "create", "patch"]
+  - apiGroups: ["autoscaling.k8s.io"]
+    resources: ["verticalpodautoscalers"]
+    verbs: ["list"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: {{.SchedulerName}}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: {{.SchedulerName}}
+subjects:
+  - kind: ServiceAccount
+    name: {{.SchedulerName}}
+    namespace: {{.Namespace}}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{.SchedulerName}}
+  namespace: {{.Namespace}}
+data:
+  config.yaml: |
+{{indent 4 .Config}}
+{{- if .Token}}
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: {{.TokenSecret}}
+  namespace: {{.Namespace}}
+type: Opaque
+stringData:
+  token: {{printf "%q" .Token}}
+{{- end}}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.SchedulerName}}
+  namespace: {{.Namespace}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: {{.SchedulerName}}
+  template:
+    metadata:
+      labels:
+        app: {{.SchedulerName}}
+    spec:
+      serviceAccountName: {{.SchedulerName}}
+      containers:
+        - name: scheduler
+          image: {{.Image}}
+          env:
+            - name: SDC_CONFIG
+              value: /etc/sysdig-scheduler/config.yaml
+            - name: POD_NAME
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.name
+            - name: POD_NAMESPACE
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.namespace
+{{- if .TokenSecret}}
+            - name: SDC_TOKEN
+              valueFrom:
+                secretKeyRef:
+                  name: {{.TokenSecret}}
+                  key: token
+            # Read again when the secret is rotated
+            - name: SDC_TOKEN_FILE
+              value: /etc/sysdig-scheduler-token/token
+{{- end}}
+          ports:
+            - name: admin
+              containerPort: 8080
+          livenessProbe:
+            httpGet:
+              path: /healthz
+              port: admin
+          volumeMounts:
+            - name: config
+              mountPath: /etc/sysdig-scheduler
+{{- if .TokenSecret}}
+            - name: token
+              mountPath: /etc/sysdig-scheduler-token
+              readOnly: true
+{{- end}}
+      volumes:
+        - name: config
+          configMap:
+            name: {{.SchedulerName}}
+{{- if .TokenSecret}}
+        - name: token
+          secret:
+            secretName: {{.TokenSecret}}
+{{- end}}
+`))
+
+// Indents every line of the text
+func indent(spaces int, text string) string {
+	padding := strings.Repeat(" ", spaces)
+	return padding + strings.Replace(strings.TrimRight(text, "\n"), "\n", "\n"+padding, -1)
+}
+
+// Renders the manifests of the scheduler and applies them, or prints them with -dry-run
+func (s *Scheduler) runInstall(args []string) {
+	flags := flag.NewFlagSet("install", flag.ExitOnError)
+	namespace := flags.String("namespace", "kube-system", "Namespace the scheduler runs in")
+	image := flags.String("image", "sysdig/kubernetes-scheduler", "Image of the scheduler")
+	schedulerName := flags.String("s", "sysdig-scheduler", "Scheduler name")
+	metric := flags.String("m", "", "[+|-]Sysdig metric to monitorize, when no configuration file is given")
+	configFile := flags.String("c", "", "Configuration file with the scheduling profiles")
+	token := flags.String("t", "", "Sysdig Cloud token, stored in the token secret")
+	tokenSecret := flags.String("token-secret", "sysdig-scheduler-token", "Secret with the Sysdig token in its \"token\" key")
+	kubeConfigFile := flags.String("k", "", "Kubernetes config file")
+	flags.StringVar(kubeConfigFile, "kubeconfig", "", "Kubernetes config file, same as -k")
+	kubeContext := flags.String("context", "", "Context of the Kubernetes config file, instead of its current context")
+	dryRun := flags.Bool("dry-run", false, "Print the manifests instead of applying them")
+	flags.Parse(args)
+
+	parameters := installParameters{Namespace: *namespace, Image: *image, SchedulerName: *schedulerName, TokenSecret: *tokenSecret, Token: *token}
+	var err error
+	parameters.Config, err = installConfig(*configFile, *schedulerName, *metric)
+	if err != nil {
+		fmt.Println("Error:", err)
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// The token secret is only needed if a profile reads from Sysdig
+	var installed Config
+	yaml.Unmarshal([]byte(parameters.Config), &installed)
+	installed.setDefaults()
+	if !installed.needsSysdigToken() {
+		parameters.TokenSecret, parameters.Token = "", ""
+	}
+
+	var rendered bytes.Buffer
+	if err := installManifests.Execute(&rendered, parameters); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *dryRun {
+		fmt.Print(strings.TrimLeft(rendered.String(), "\n"))
+		return
+	}
+
+	if *kubeConfigFile != "" {
+		os.Setenv("KUBECONFIG", *kubeConfigFile)
+	}
+	if err := s.kubeAPI.LoadKubeConfig(); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	if *kubeContext != "" {
+		if err := s.kubeAPI.UseContext(*kubeContext); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, manifest := range strings.Split(rendered.String(), "\n---\n") {
+		apiMethod, description, err := manifestPath(manifest)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if err := s.kubeAPI.Apply(ctx, apiMethod, []byte(manifest), "sysdig-scheduler-install"); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(description, "applied")
+	}
+}
+
+// Returns the configuration file content, or a single profile built from the scheduler name and the metric
+func installConfig(configFile, schedulerName, metric string) (string, error) {
+	if configFile != "" {
+		if _, err := LoadConfig(configFile); err != nil {
+			return "", err
+		}
+		data, err := ioutil.ReadFile(configFile)
+		return string(data), err
+	}
+	if metric == "" {
+		return "", fmt.Errorf("either -c or -m must be set")
+	}
+
+	profile := Profile{SchedulerName: schedulerName, Strategy: strategySpread}
+	if metric[0] == '+' {
+		profile.Strategy = strategyBinpack
+	}
+	profile.Metrics = []MetricConfig{{Name: strings.TrimLeft(metric, "+-")}}
+
+	data, err := yaml.Marshal(map[string]interface{}{
+		"admin": map[string]string{"address": ":8080"},
+		"profiles": []map[string]interface{}{{
+			"schedulerName": profile.SchedulerName,
+			"strategy":      profile.Strategy,
+			"metrics":       []map[string]string{{"name": profile.Metrics[0].Name}},
+		}},
+	})
+	return string(data), err
+}
+
+// Api paths of the kinds in the installation manifests
+var installKinds = map[string]string{
+	"ServiceAccount":     "api/v1/namespaces/%s/serviceaccounts/%s",
+	"ConfigMap":          "api/v1/namespaces/%s/configmaps/%s",
+	"Secret":             "api/v1/namespaces/%s/secrets/%s",
+	"Deployment":         "apis/apps/v1/namespaces/%s/deployments/%s",
+	"ClusterRole":        "apis/rbac.authorization.k8s.io/v1/clusterroles/%[2]s",
+	"ClusterRoleBinding": "apis/rbac.authorization.k8s.io/v1/clusterrolebindings/%[2]s",
+}
+
+// Returns the api path of the object of a manifest and its kind/name
+func manifestPath(manifest string) (apiMethod, description string, err error) {
+	var object struct {
+		Kind     string `yaml:"kind"`
+		Metadata struct {
+			Name      string `yaml:"name"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"metadata"`
+	}
+	if err = yaml.Unmarshal([]byte(manifest), &object); err != nil {
+		return
+	}
+	path, ok := installKinds[object.Kind]
+	if !ok {
+		return "", "", fmt.Errorf("unknown kind %q in the manifests", object.Kind)
+	}
+	return fmt.Sprintf(path, object.Metadata.Namespace, object.Metadata.Name), object.Kind + "/" + object.Metadata.Name, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Default window of the recent bindings scorer, about the time the metrics take to show a new pod
+const defaultLedgerWindow = 2 * time.Minute
+
+// Requests of the pods bound by the scheduler recently, per node, until the metrics see them
+type bindingLedger struct {
+	mutex     sync.Mutex
+	retention time.Duration
+	nodes     map[string][]ledgerEntry
+}
+
+type ledgerEntry struct {
+	requests resourceList
+	time     time.Time
+}
+
+// Keeps the bindings for at least the window
+func (l *bindingLedger) retain(window time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if window > l.retention {
+		l.retention = window
+	}
+}
+
+// Records the requests of a pod bound to the node, nothing is kept if no scorer reads them
+func (l *bindingLedger) record(nodeName string, requests resourceList) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.retention <= 0 {
+		return
+	}
+	now := time.Now()
+	entries := l.nodes[nodeName][:0]
+	for _, entry := range l.nodes[nodeName] {
+		if now.Sub(entry.time) < l.retention {
+			entries = append(entries, entry)
+		}
+	}
+	l.nodes[nodeName] = append(entries, ledgerEntry{requests, now})
+}
+
+// Forgets the bindings of a deleted node
+func (l *bindingLedger) remove(nodeName string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.nodes, nodeName)
+}
+
+// Returns the number of pods bound to the node during the window
+func (l *bindingLedger) count(nodeName string, window time.Duration) (count int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, entry := range l.nodes[nodeName] {
+		if time.Since(entry.time) < window {
+			count++
+		}
+	}
+	return
+}
+
+// Returns the requests of the pods bound to the node during the window
+func (l *bindingLedger) requested(nodeName string, window time.Duration) resourceList {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	requested := resourceList{}
+	for _, entry := range l.nodes[nodeName] {
+		if time.Since(entry.time) < window {
+			requested.add(entry.requests)
+		}
+	}
+	return requested
+}
+
+// Scores the nodes with the percentage of their allocatable cpu and memory requested by the pods
+// the scheduler bound to them during the window, the load the metrics of the node don't show yet
+type recentBindingsScorer struct {
+	schedulerScorer
+	window time.Duration
+}
+
+// The bindings of the window are kept by the ledger of the scheduler
+func (s *recentBindingsScorer) setScheduler(scheduler *Scheduler) {
+	s.scheduler = scheduler
+	s.scheduler.ledger.retain(s.window)
+}
+
+func (s *recentBindingsScorer) Name() string {
+	return "recent-bindings"
+}
+
+func (s *recentBindingsScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (float64, error) {
+	requested := s.scheduler.ledger.requested(node.Name, s.window)
+	if len(requested) == 0 {
+		return 0, nil
+	}
+	kubeNode, err := s.scheduler.findNode(ctx, node.Name)
+	if err != nil {
+		// The nodes of the other clusters are not bound by this scheduler
+		return 0, nil
+	}
+	allocatable := parseResourceList(kubeNode.Status.Allocatable)
+	var percent float64
+	for _, resource := range []string{"cpu", "memory"} {
+		if allocatable[resource] > 0 {
+			percent += requested[resource] / allocatable[resource] * 100 / 2
+		}
+	}
+	return percent, nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Annotation of the pods overriding the target of the locality scorer, in the same format
+const localityAnnotation = "sysdig-scheduler/locality"
+
+// Values of the locality scorer, lower is closer to the target pods
+const (
+	localitySameNode  = 0
+	localitySameZone  = 50
+	localityElsewhere = 100
+)
+
+// Scores the nodes by their distance to the pods of a target in the namespace of the pod being
+// scheduled: 0 on a node running one of them, 50 in the zone of one of them, 100 elsewhere. The
+// target is service/NAME, statefulset/NAME or key=value labels. Pods without a target score 0.
+type localityScorer struct {
+	schedulerScorer
+	target string
+}
+
+func (s *localityScorer) Name() string {
+	return "locality"
+}
+
+func (s *localityScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (float64, error) {
+	target := s.target
+	if value, ok := pod.Annotations[localityAnnotation]; ok {
+		target = value
+	}
+	if target == "" {
+		return localitySameNode, nil
+	}
+	matches, err := s.scheduler.localityTarget(ctx, pod.Namespace, target)
+	if err != nil {
+		return 0, fmt.Errorf("locality target %q: %s", target, err)
+	}
+
+	pods, err := s.scheduler.kubeAPI.ListAssignedPods(ctx)
+	if err != nil {
+		return 0, err
+	}
+	zones := map[string]bool{}
+	for _, other := range pods {
+		if other.Metadata.Namespace != pod.Namespace || !matches(other) {
+			continue
+		}
+		if other.Spec.NodeName == node.Name {
+			return localitySameNode, nil
+		}
+		if otherNode, err := s.scheduler.findNode(ctx, other.Spec.NodeName); err == nil {
+			zones[nodeZone(otherNode)] = true
+		}
+	}
+
+	if kubeNode, err := s.scheduler.findNode(ctx, node.Name); err == nil {
+		if zone := nodeZone(kubeNode); zone != "" && zones[zone] {
+			return localitySameZone, nil
+		}
+	}
+	return localityElsewhere, nil
+}
+
+// Returns a function telling if a pod belongs to the target
+func (s *Scheduler) localityTarget(ctx context.Context, namespace, target string) (func(kubernetes.KubePod) bool, error) {
+	kind, name := "", ""
+	if parts := strings.SplitN(target, "/", 2); len(parts) == 2 && !strings.Contains(parts[0], "=") {
+		kind, name = parts[0], parts[1]
+	}
+
+	switch kind {
+	case "service":
+		service, err := s.kubeAPI.GetService(ctx, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(service.Spec.Selector) == 0 {
+			return nil, fmt.Errorf("the service has no selector")
+		}
+		selector := kubernetes.KubeLabelSelector{MatchLabels: service.Spec.Selector}
+		return func(pod kubernetes.KubePod) bool { return selector.Matches(pod.Metadata.Labels) }, nil
+	case "statefulset":
+		return func(pod kubernetes.KubePod) bool {
+			for _, owner := range pod.Metadata.OwnerReferences {
+				if owner.Kind == "StatefulSet" && owner.Name == name {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "":
+		selector, err := parseOnePerNode(target, nil)
+		if err != nil {
+			return nil, err
+		}
+		return func(pod kubernetes.KubePod) bool { return selector.Matches(pod.Metadata.Labels) }, nil
+	default:
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+}
@@ -0,0 +1,497 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scheduler is a custom Kubernetes scheduler with custom metrics from Sysdig Monitor
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	kube "github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/tracing"
+	"os/user"
+)
+
+// Flags, defined by Main only so the programs embedding the package keep their own
+var (
+	sysdigTokenFlag    *string
+	sysdigTokenFile    *string
+	kubeConfigFileFlag *string
+	sysdigMetricFlag   *string
+	schedulerNameFlag  *string
+	configFileFlag     *string
+	kubeContextFlag    *string
+	demoFlag           *bool
+	profilingFlag      *bool
+	injectFaultsFlag   *bool
+	minimalRBACFlag    *bool
+	observerFlag       *bool
+)
+
+func defineFlags() {
+	sysdigTokenFlag = flag.String("t", "", "Sysdig Cloud Token")
+	sysdigTokenFile = flag.String("token-file", "", "File with the Sysdig Cloud token, like a mounted secret, read again when it changes")
+	kubeConfigFileFlag = flag.String("k", "", "Kubernetes config file")
+	sysdigMetricFlag = flag.String("m", "", "Sysdig metric to monitorize")
+	schedulerNameFlag = flag.String("s", "", "Scheduler name")
+	configFileFlag = flag.String("c", "", "Configuration file with the scheduling profiles")
+	kubeContextFlag = flag.String("context", "", "Context of the Kubernetes config file, instead of its current context")
+	demoFlag = flag.Bool("demo", false, "Reads made-up Sysdig metrics from a local mock, no token is needed")
+	profilingFlag = flag.Bool("profiling", false, "Serves the pprof profiles and the runtime variables on the admin server")
+	injectFaultsFlag = flag.Bool("inject-faults", false, "Injects the faults of the faultInjection configuration, for resilience tests")
+	minimalRBACFlag = flag.Bool("minimal-rbac", false, "Turns off the features needing more than the permissions to schedule, same as minimalRBAC")
+	observerFlag = flag.Bool("observer", false, "Decides every pending pod without binding anything, with read-only permissions, same as observer")
+	flag.StringVar(kubeConfigFileFlag, "kubeconfig", "", "Kubernetes config file, same as -k")
+}
+
+// Loads the kubernetes configuration, the profiles and the metric providers of the scheduler
+func (s *Scheduler) setup() {
+
+	flag.Usage = usage
+	flag.Parse()
+
+	// KUBECONFIG parameter / env var
+	if _, kubeTokenSetByEnv := os.LookupEnv("KUBECONFIG"); !kubeTokenSetByEnv && *kubeConfigFileFlag == "" {
+		usr, _ := user.Current()
+		os.Setenv("KUBECONFIG", usr.HomeDir+"/.kube/config")
+	} else {
+		if *kubeConfigFileFlag != "" {
+			os.Setenv("KUBECONFIG", *kubeConfigFileFlag)
+		}
+	}
+	if err := s.kubeAPI.LoadKubeConfig(); err != nil {
+		fmt.Println("Error:", err)
+		usage()
+	}
+	if *kubeContextFlag != "" {
+		if err := s.kubeAPI.UseContext(*kubeContextFlag); err != nil {
+			fmt.Println("Error:", err)
+			usage()
+		}
+	}
+
+	// SDC_CONFIG parameter / env var
+	configFile, configFileEnvIsSet := os.LookupEnv("SDC_CONFIG")
+	if *configFileFlag != "" {
+		configFile = *configFileFlag
+	}
+	if configFileEnvIsSet || configFile != "" {
+		var err error
+		s.config, err = LoadConfig(configFile)
+		if err != nil {
+			fmt.Println("Error:", err)
+			usage()
+		}
+	} else {
+		// Without a configuration file, a single profile is built from the parameters
+		s.config.Profiles = []*Profile{profileFromParameters()}
+		s.config.setDefaults()
+	}
+
+	seedRandom(s.config.Seed)
+
+	if *minimalRBACFlag {
+		s.config.MinimalRBAC = true
+	}
+	if *observerFlag && s.config.Observer == nil {
+		s.config.Observer = &ObserverConfig{}
+		s.config.setObserverDefaults()
+	}
+
+	if *injectFaultsFlag {
+		if s.config.FaultInjection == nil {
+			fmt.Println("Error: -inject-faults needs the faultInjection section of the configuration")
+			usage()
+		}
+		s.injectFaults(*s.config.FaultInjection)
+	} else if s.config.FaultInjection != nil {
+		log.Println("Ignoring the faultInjection configuration without the -inject-faults flag")
+	}
+	if err := s.tuneTransports(); err != nil {
+		fmt.Println("Error:", err)
+		usage()
+	}
+	s.watchThrottling()
+	s.limitProfileRequests()
+
+	// SCD_TOKEN parameter / env var, only needed if a profile reads from Sysdig
+	if *demoFlag {
+		if err := s.startDemoMock(); err != nil {
+			fmt.Println("Error:", err)
+			usage()
+		}
+	} else if s.config.needsSysdigToken() {
+		if envFile, ok := os.LookupEnv("SDC_TOKEN_FILE"); ok && *sysdigTokenFile == "" {
+			*sysdigTokenFile = envFile
+		}
+		if *sysdigTokenFile != "" {
+			if err := s.watchSysdigToken(*sysdigTokenFile); err != nil {
+				fmt.Println("Error:", err)
+				usage()
+			}
+		} else if sysdigTokenEnv, tokenSetByEnv := os.LookupEnv("SDC_TOKEN"); !tokenSetByEnv && *sysdigTokenFlag == "" {
+			fmt.Println("Error: Sysdig Cloud token is not set.")
+			usage()
+		} else {
+			if tokenSetByEnv {
+				s.sysdigAPI.SetToken(sysdigTokenEnv)
+			}
+			if *sysdigTokenFlag != "" { // If the flag is set, overrides the environment
+				s.sysdigAPI.SetToken(*sysdigTokenFlag)
+			}
+		}
+	}
+}
+
+// Builds the profile defined by the -s and -m parameters or their env vars
+func profileFromParameters() *Profile {
+	profile := &Profile{Name: "default"}
+	// SCD_METRIC parameter / env var
+	var sysdigMetric string
+	if sysdigMetricEnv, sysdigMetricEnvIsSet := os.LookupEnv("SDC_METRIC"); !sysdigMetricEnvIsSet && *sysdigMetricFlag == "" {
+		fmt.Println("The Sysdig metric must be defined")
+		usage()
+	} else {
+		if sysdigMetricEnvIsSet {
+			sysdigMetric = sysdigMetricEnv
+		}
+		if *sysdigMetricFlag != "" {
+			sysdigMetric = *sysdigMetricFlag
+		}
+		highOrLowMetric := sysdigMetric[0]
+		if highOrLowMetric == '-' {
+			sysdigMetric = sysdigMetric[1:]
+		} else if highOrLowMetric == '+' {
+			sysdigMetric = sysdigMetric[1:]
+			profile.Strategy = strategyBinpack
+		}
+		profile.Metrics = []MetricConfig{{Name: sysdigMetric}}
+	}
+
+	// SDC_SCHEDULER parameter / env var
+	if schedulerNameEnv, schedulernameEnvIsSet := os.LookupEnv("SDC_SCHEDULER"); !schedulernameEnvIsSet && *schedulerNameFlag == "" {
+		fmt.Println("Scheduler name must be set")
+		usage()
+	} else {
+		if schedulernameEnvIsSet {
+			profile.SchedulerName = schedulerNameEnv
+		}
+		if *schedulerNameFlag != "" {
+			profile.SchedulerName = *schedulerNameFlag
+		}
+	}
+
+	if err := profile.init(); err != nil {
+		fmt.Println("Error:", err)
+		usage()
+	}
+	return profile
+}
+
+// Usage description
+func usage() {
+	fmt.Printf("Usage: %s [-c CONFIG_FILE | -s SCHEDULER_NAME -m [+|-]SYSDIG_METRIC] [-t SYSDIG_TOKEN | -token-file FILE] [-k KUBERNETES_CONFIG_FILE] [-context CONTEXT]", os.Args[0])
+	fmt.Print(`
+The Kubernetes config file is read from -k (or -kubeconfig), the env KUBECONFIG or ~/.kube/config.
+Inside a pod without a config file, the service account of the pod is used.
+If the env SDC_TOKEN is not set, the -t option must be provided when reading the metrics from Sysdig, unless -demo is set.
+With -token-file (or the env SDC_TOKEN_FILE) the token is read from the file instead, and again whenever it changes.
+If the env [+|-]SDC_METRIC is not set, the -m option must be provided. Sort mode: "+" higher, "-" lower. Default sort mode: lower.
+If the env SDC_SCHEDULER is not set, the -s option must be provided.
+If the env SDC_CONFIG or the -c option are provided, the profiles are read from the file and -s / -m are ignored.
+
+Commands:
+  bench        Schedules made-up pods on made-up nodes and prints the throughput and latency
+  capacity     Prints the allocatable resources, requests and metrics of the nodes and zones
+  config       Prints the JSON schema of the configuration file, or validates configuration files
+  explain      Explains the placement of a pod from the score history of the admin server
+  history      Prints the decisions stored by the sql audit sink, by node or pod
+  install      Renders and applies the manifests of the scheduler
+  replay       Takes again the decisions of an audit file with the profiles of a configuration
+  schedule     Asks the admin server to queue a pod, with the webhook or queue trigger
+  score        Prints the ready nodes ranked by their metrics, without scheduling anything
+  simulate     Prints the placements of pods on a cluster snapshot with its metric values
+  webhook      Admission webhook keeping pods away from this scheduler while it is unhealthy
+`)
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// Main runs the kubernetes-scheduler command: a companion command named by the first argument,
+// or the scheduler configured by the flags until it receives SIGTERM
+func Main() {
+
+	// Companion commands run instead of the scheduler, with their own flags
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+	defineFlags()
+	scheduler := newScheduler()
+	scheduler.setup()
+	if err := scheduler.init(SchedulerOptions{Config: scheduler.config, Profiling: *profilingFlag}); err != nil {
+		fmt.Println("Error:", err)
+		usage()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-signals
+		log.Printf("received %s", sig)
+		scheduler.Stop()
+	}()
+
+	if err := scheduler.Run(context.Background()); err != nil {
+		log.Fatalln("fatal:", err)
+	}
+}
+
+// Decodes a pod watch event and handles it
+func (s *Scheduler) handlePodEvent(ctx context.Context, data []byte) {
+	event := kube.KubePodEvent{}
+	err := json.Unmarshal(data, &event)
+	if err != nil {
+		log.Println("Error:", err)
+		return
+	}
+	s.handlePod(ctx, event)
+}
+
+// Queues the pod of a watch event for scheduling if it belongs to one of our profiles
+func (s *Scheduler) handlePod(ctx context.Context, event kube.KubePodEvent) {
+	if event.Type == "ADDED" && s.recoveredPods.take(event.Object) {
+		// Queued at startup before the watch listed it
+		return
+	}
+
+	if s.config.Shadow != nil {
+		s.shadow.observe(ctx, event)
+	}
+	if len(s.config.Experiments) > 0 {
+		s.experiments.observe(event)
+	}
+	if s.config.Observer != nil {
+		// Nothing is scheduled, the pods are only decided
+		s.observer.observe(ctx, event)
+		return
+	}
+
+	if event.Type == "DELETED" {
+		s.forgetPod(event.Object)
+		return
+	}
+
+	// If the pod has been added, or its last scheduling gate removed, is in Pending phase and
+	// matches a profile, schedule it. Without the watch trigger, the added pods wait for their
+	// trigger, a released pod was already triggered.
+	profile := s.profiles.forPod(event.Object)
+	added := (event.Type == "ADDED" && s.config.Trigger.watch()) || (event.Type == "MODIFIED" && s.gatedPods.released(event.Object))
+	if event.Object.Status.Phase == "Pending" && profile != nil && added {
+		s.admitPod(ctx, profile, event.Object)
+	}
+}
+
+// Queues the pod for scheduling with the profile, unless it isn't for this replica, its namespace
+// or opt-in label keep it away or it waits for its scheduling gates. Returns the reason it isn't queued.
+func (s *Scheduler) admitPod(ctx context.Context, profile *Profile, pod kube.KubePod) error {
+	if !s.config.Sharding.owns(pod) {
+		// Scheduled by the replica of its shard
+		return errNotOwned
+	}
+	if !s.config.Namespaces.allowed(pod.Metadata.Namespace) {
+		log.Printf("Ignoring %s: namespace %s is not allowed", pod.Metadata.Name, pod.Metadata.Namespace)
+		return fmt.Errorf("namespace %s is not allowed", pod.Metadata.Namespace)
+	}
+	if !s.optedIn(pod) {
+		log.Printf("Ignoring %s: label %s is not set to true", pod.Metadata.Name, s.config.OptInLabel)
+		message := fmt.Sprintf("Not scheduled by %s without the %s=true label", pod.Spec.SchedulerName, s.config.OptInLabel)
+		s.reportPodEvent(ctx, pod, "Warning", "NotOptedIn", message)
+		return fmt.Errorf("label %s is not set to true", s.config.OptInLabel)
+	}
+
+	if s.gatedPods.gated(pod) {
+		log.Printf("Waiting for the scheduling gates of %s to be removed", pod.Metadata.Name)
+		return errGated
+	}
+
+	// Pods of a group are bound together once the whole group fits, one by one without gang scheduling
+	if _, ok := podGroupOf(pod); ok && s.features.enabled(featureGangScheduling, pod.Metadata.Namespace) {
+		s.gangs.add(ctx, profile, pod)
+		return nil
+	}
+
+	s.queue.push(profile, pod)
+	return nil
+}
+
+// Finds the best node for the pod with the profile and binds it, the decision is audited
+func (s *Scheduler) schedulePod(ctx context.Context, profile *Profile, pod kube.KubePod) {
+	profile = profile.forQoSClass(pod)
+	record := newAuditRecord(profile, pod)
+	log.Printf("Scheduling %s with profile %s, decision %s", pod.Metadata.Name, profile.Name, record.ID)
+	ctx = withDecisionID(s.withProfileLimits(ctx, profile), record.ID)
+	ctx, span := tracing.Start(ctx, "schedule")
+	span.SetAttribute("pod", pod.Metadata.Namespace+"/"+pod.Metadata.Name)
+	span.SetAttribute("profile", profile.Name)
+	span.SetAttribute("decision.id", record.ID)
+	defer func() {
+		span.SetAttribute("node", record.Node)
+		span.SetAttribute("outcome", record.Outcome)
+		if record.Error != "" {
+			span.SetError(errors.New(record.Error))
+		}
+		span.End()
+		s.auditLog.record(record)
+		s.notifications.notify(record)
+		s.history.record(record)
+		s.annotateDecision(ctx, pod, record)
+		switch record.Outcome {
+		case outcomeBound, outcomePreempted, outcomeFallback:
+			s.reportScheduled(ctx, profile, pod, record)
+			if len(s.config.Experiments) > 0 {
+				s.experiments.recordBinding(ctx, pod, record.Node)
+			}
+		}
+		if record.Outcome == outcomeFailed {
+			failures.record(record.err)
+			s.reportFailed(ctx, pod, record)
+			s.retryUntilDeadline(profile, pod, record.Error)
+		}
+	}()
+
+	if s.config.CheckResourceQuotas {
+		if err := s.checkResourceQuotas(ctx, pod); err != nil {
+			log.Printf("Not scheduling %s: %s", pod.Metadata.Name, err)
+			record.finish(outcomeFailed, "", err)
+			return
+		}
+	}
+
+	available := s.nodesAvailable(ctx)
+	nodes, rejected := s.filterNodes(ctx, pod, available)
+	record.setNodes(rejected, nil)
+	if profile.ZoneBalancing {
+		nodes = s.balanceZones(ctx, pod, available, nodes)
+	}
+
+	// When no node has room left, lower priority pods are preempted on the best node that can be freed
+	if len(nodes) == 0 && len(rejected) > 0 && !s.config.MinimalRBAC {
+		nodeName, err := s.preempt(ctx, profile, pod, rejected)
+		if err == nil {
+			err = s.bindCandidate(ctx, nil, profile, pod, nodeName)
+			if err != nil {
+				log.Println("error while scheduling a pod:", err)
+			}
+			record.finish(bindingOutcome(outcomePreempted, err), nodeName, err)
+			return
+		}
+		log.Println("preemption not possible:", err)
+	}
+
+	outcome := outcomeBound
+	candidates, scored, err := s.getBestNodeByMetrics(ctx, profile, pod, s.sampleNodes(nodes))
+	record.setNodes(nil, scored)
+	if s.config.Audit.RecordInputs {
+		record.setInputs(profile, pod, scored)
+	}
+	var bestNodeFound Node
+	if err == nil {
+		bestNodeFound = candidates[0]
+	}
+
+	// The nodes of the other clusters of the profile are taken when they beat the local best node
+	if remote, ok := s.bestRemoteNode(ctx, profile, pod, scored, bestNodeFound, err == nil); ok {
+		log.Printf("Best node found in cluster %s: %s %g", remote.cluster.name, remote.node.name, remote.node.score)
+		if err := s.placeInCluster(ctx, remote, pod); err != nil {
+			log.Println("error while placing a pod in another cluster:", err)
+			record.finish(outcomeFailed, "", err)
+			return
+		}
+		record.finish(outcomeRemote, remote.cluster.name+"/"+remote.node.name, nil)
+		return
+	}
+	if err != nil {
+		log.Println("error while retrieving the best node:", err.Error())
+		// A new node is better than one past the thresholds, and no fallback takes them
+		if overThresholds(scored) {
+			switch {
+			case s.config.Provisioning.Enabled:
+				s.requestProvisioning(ctx, profile, pod, len(available), scored)
+			case s.config.ClusterAutoscaler:
+				s.unschedulablePods.add(ctx, profile, pod, len(available), thresholdRejections(scored))
+			}
+			record.finish(outcomeFailed, "", err)
+			return
+		}
+		if !s.features.enabled(featureFallback, pod.Metadata.Namespace) {
+			log.Printf("Not falling back for %s: disabled by its feature flag", pod.Metadata.Name)
+			record.finish(outcomeFailed, "", err)
+			return
+		}
+		// In case a node could not be found, fallback to the default scheduler or to a node chosen without metrics
+		if profile.Fallback == fallbackDefaultScheduler {
+			if err := s.delegateToDefaultScheduler(ctx, pod); err != nil {
+				log.Println("error while falling back to the default scheduler:", err)
+				record.finish(outcomeFailed, "", err)
+				return
+			}
+			record.finish(outcomeDelegated, "", err)
+			return
+		}
+		log.Printf("falling back to the %s strategy...", profile.Fallback)
+		outcome = outcomeFallback
+		bestNodeFound, err = s.fallbackNode(ctx, profile, withinThresholds(nodes, scored))
+		if err != nil {
+			log.Println("error while retrieving a fallback node:", err.Error())
+			if s.config.ClusterAutoscaler && len(nodes) == 0 {
+				s.unschedulablePods.add(ctx, profile, pod, len(available), rejected)
+			}
+			record.finish(outcomeFailed, "", err)
+			return
+		}
+		candidates = []Node{bestNodeFound}
+	}
+
+	log.Println("Best node found: ", bestNodeFound.name, bestNodeFound.score, "decision", record.ID)
+	node, fallbacks, err := s.bindCandidates(ctx, profile, pod, candidates, s.config.PreBind.Enabled && outcome == outcomeBound)
+	record.Fallbacks = fallbacks
+	if err != nil {
+		log.Println("error while scheduling a pod:", err)
+		record.finish(bindingOutcome(outcomeFailed, err), node.name, err)
+		return
+	}
+	record.finish(outcome, node.name, nil)
+}
+
+// Returns the outcome of a failed binding, the conflict outcome if the pod was taken before it
+func bindingOutcome(outcome string, err error) string {
+	if failure.ReasonOf(err) == failure.BindConflict && !transientConflict(err) {
+		return outcomeConflict
+	}
+	return outcome
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotation of the nodes with maintenance windows, comma separated START/END RFC 3339 times
+// like 2026-10-14T22:00:00Z/2026-10-15T02:00:00Z, during which no pod is placed on them
+const maintenanceWindowAnnotation = "sysdig-scheduler/maintenance-window"
+
+// Rejects the cordoned nodes and the nodes in a maintenance window
+func nodeUnschedulableFilter(state *cycleState, node kubernetes.KubeNode) error {
+	return nodeSchedulable(node, time.Now())
+}
+
+// Returns why no pod can be placed on the node at the time, nil if pods can be placed
+func nodeSchedulable(node kubernetes.KubeNode, now time.Time) error {
+	if node.Spec.Unschedulable {
+		return fmt.Errorf("node is cordoned")
+	}
+	windows, ok := node.Metadata.Annotations[maintenanceWindowAnnotation]
+	if !ok {
+		return nil
+	}
+	for _, window := range strings.Split(windows, ",") {
+		start, end, err := parseWindow(strings.TrimSpace(window))
+		if err != nil {
+			// The node was meant to be in maintenance at some point
+			return fmt.Errorf("invalid maintenance window %q: %s", window, err)
+		}
+		if !now.Before(start) && now.Before(end) {
+			return fmt.Errorf("node is in maintenance until %s", end.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+func parseWindow(window string) (start, end time.Time, err error) {
+	parts := strings.Split(window, "/")
+	if len(parts) != 2 {
+		err = fmt.Errorf("must be START/END")
+		return
+	}
+	if start, err = time.Parse(time.RFC3339, parts[0]); err != nil {
+		return
+	}
+	if end, err = time.Parse(time.RFC3339, parts[1]); err != nil {
+		return
+	}
+	if !end.After(start) {
+		err = fmt.Errorf("the end is not after the start")
+	}
+	return
+}
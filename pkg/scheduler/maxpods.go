@@ -0,0 +1,63 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Rejects the nodes already running MaxPodsPerNode pods of the scheduler profiles, the pods
+// being bound included. The allocatable pods of the kubelet are checked by the resources filter.
+func maxPodsFilter(state *cycleState, node kubernetes.KubeNode) error {
+	if state.scheduler.config.MaxPodsPerNode <= 0 {
+		return nil
+	}
+	counts, err := state.managedPods()
+	if err != nil {
+		return err
+	}
+	if count := counts[node.Metadata.Name]; count >= state.scheduler.config.MaxPodsPerNode {
+		return fmt.Errorf("node runs %d pods of the scheduler, the maximum is %d", count, state.scheduler.config.MaxPodsPerNode)
+	}
+	return nil
+}
+
+// Returns the number of pods of the scheduler profiles on every node, with the reservations of
+// the pods being bound that are not assigned yet
+func (s *cycleState) managedPods() (map[string]int, error) {
+	if s.managed != nil {
+		return s.managed, nil
+	}
+	pods, err := s.assignedPods()
+	if err != nil {
+		return nil, err
+	}
+	s.managed = map[string]int{}
+	for _, pod := range pods {
+		if s.scheduler.profiles.serves(pod.Spec.SchedulerName) {
+			s.managed[pod.Spec.NodeName]++
+		}
+	}
+	reserved := map[string]resourceList{}
+	s.scheduler.reservations.addTo(reserved, pods, s.pod)
+	for node, requests := range reserved {
+		s.managed[node] += int(requests["pods"])
+	}
+	return s.managed, nil
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Defaults of the memory-trend scorer
+const (
+	defaultTrendMetric    = "memory.used.percent"
+	defaultTrendWindow    = 30 * time.Minute
+	defaultTrendHorizon   = 15 * time.Minute
+	defaultTrendThreshold = 90
+	trendSampling         = time.Minute
+	// Weight of the last change in the ewma trend, the older ones fade
+	ewmaTrendAlpha = 0.3
+)
+
+// How the memory-trend scorer extrapolates the series
+const (
+	trendLinear = "linear"
+	trendEWMA   = "ewma"
+)
+
+// Scores the nodes with how far past the threshold their memory usage is projected to be at the
+// end of the horizon, extrapolating the trend of its series over the window: the least squares
+// line, or the last value plus the exponential moving average of its changes. The nodes projected
+// below the threshold score 0, lower is better. The nodes without history score 0 too.
+type memoryTrendScorer struct {
+	schedulerScorer
+	profile   *Profile
+	metric    string
+	window    time.Duration
+	horizon   time.Duration
+	threshold float64
+	trend     string
+}
+
+// Returns true if a scorer of the profile extrapolates the memory trend of the nodes
+func (p *Profile) hasMemoryTrend() bool {
+	for _, scorer := range p.Scorers {
+		if scorer.Type == "memory-trend" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryTrendScorer) Name() string {
+	return "memory-trend"
+}
+
+func (s *memoryTrendScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (float64, error) {
+	projected, err := s.projected(ctx, node.Name)
+	if err == metrics.NoDataFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s trend of node %s: %s", s.metric, node.Name, err)
+	}
+	return math.Max(0, projected-s.threshold), nil
+}
+
+// Returns the value of the metric of the node projected at the end of the horizon. It is cached for
+// a sampling interval, the window moves by a datapoint in that time.
+func (s *memoryTrendScorer) projected(ctx context.Context, nodeName string) (projected float64, err error) {
+	key := "trend/" + s.profile.Name + "/" + s.metric + "/" + s.trend + "/" + s.window.String() + "/" + s.horizon.String() + "/" + nodeName
+	if data, ok, _ := s.scheduler.metricCache.Get(ctx, key); ok && json.Unmarshal(data, &projected) == nil {
+		return
+	}
+	provider, ok := s.profile.provider.(metrics.SeriesProvider)
+	if !ok {
+		return 0, fmt.Errorf("the %s provider can't read the series of the metrics", s.profile.provider.Name())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.scheduler.config.MetricsTimeout)
+	defer cancel()
+	var series [][]float64
+	err = withRetries(ctx, s.scheduler.config.Retry, func() (err error) {
+		series, err = provider.NodeSeries(ctx, nodeName, []string{s.metric}, s.window, trendSampling)
+		return
+	})
+	if err != nil {
+		return
+	}
+	if len(series) != 1 || len(series[0]) == 0 {
+		return 0, metrics.NoDataFound
+	}
+	steps := float64(s.horizon / trendSampling)
+	if s.trend == trendEWMA {
+		projected = extrapolateEWMA(series[0], steps)
+	} else {
+		projected = extrapolateLinear(series[0], steps)
+	}
+
+	if data, err := json.Marshal(projected); err == nil {
+		s.scheduler.metricCache.Set(ctx, key, data, trendSampling)
+	}
+	return
+}
+
+// Returns the value of the least squares line of the datapoints, one per step, steps after the last one
+func extrapolateLinear(values []float64, steps float64) float64 {
+	n := float64(len(values))
+	if len(values) < 2 {
+		return values[len(values)-1]
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, value := range values {
+		x := float64(i)
+		sumX += x
+		sumY += value
+		sumXY += x * value
+		sumXX += x * x
+	}
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	intercept := (sumY - slope*sumX) / n
+	return intercept + slope*(n-1+steps)
+}
+
+// Returns the last datapoint plus the exponential moving average of the changes between the
+// datapoints for every step
+func extrapolateEWMA(values []float64, steps float64) float64 {
+	var trend float64
+	for i := 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		if i == 1 {
+			trend = change
+		} else {
+			trend = ewmaTrendAlpha*change + (1-ewmaTrendAlpha)*trend
+		}
+	}
+	return values[len(values)-1] + trend*steps
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExtrapolateLinear(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		steps  float64
+		want   float64
+	}{
+		{"one datapoint", []float64{40}, 10, 40},
+		{"flat", []float64{50, 50, 50}, 10, 50},
+		{"line", []float64{10, 12, 14, 16}, 5, 26},
+		{"decreasing", []float64{90, 80, 70}, 2, 50},
+		{"least squares", []float64{0, 2, 1, 3}, 1, 3.5},
+		{"no step", []float64{10, 12, 14}, 0, 14},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := extrapolateLinear(test.values, test.steps); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("extrapolateLinear(%v, %v) = %v, want %v", test.values, test.steps, got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtrapolateEWMA(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		steps  float64
+		want   float64
+	}{
+		{"one datapoint", []float64{40}, 10, 40},
+		{"constant change", []float64{10, 12, 14, 16}, 5, 26},
+		{"first change", []float64{10, 20}, 1, 30},
+		// trend 10, then 0.3*0 + 0.7*10 = 7
+		{"fading change", []float64{10, 20, 20}, 2, 34},
+		// trend -10, then 0.3*20 + 0.7*-10 = -1
+		{"recent change weighted", []float64{30, 20, 40}, 1, 39},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := extrapolateEWMA(test.values, test.steps); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("extrapolateEWMA(%v, %v) = %v, want %v", test.values, test.steps, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sync"
+	"sort"
+	"github.com/draios/kubernetes-scheduler/pkg/binding"
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+	"github.com/draios/kubernetes-scheduler/pkg/tracing"
+)
+
+// Retrieves the metrics of a profile for a node, from memory if they were prefetched recently,
+// then from the metric cache. The cache is skipped while the bindings are rate limited, so every
+// binding is scored with metrics read after the previous one.
+func (s *Scheduler) getMetrics(ctx context.Context, profile *Profile, nodeName string) (metricValues []float64, err error) {
+	ctx, span := tracing.Start(ctx, "metrics")
+	span.SetAttribute("node", nodeName)
+	span.SetAttribute("provider", profile.provider.Name())
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	if values, ok := profile.prefetched.get(nodeName, prefetchMaxAgeIntervals*profile.PrefetchInterval); ok {
+		span.SetAttribute("prefetched", true)
+		return values, nil
+	}
+	useCache := !s.bindLimits.enabled()
+	if useCache {
+		if values, ok := s.cachedMetrics(ctx, profile, nodeName); ok {
+			span.SetAttribute("cached", true)
+			return values, nil
+		}
+	}
+	metricValues, err = s.fetches.do(ctx, profile, nodeName, func(ctx context.Context) ([]float64, error) {
+		return s.fetchMetrics(ctx, profile, nodeName)
+	})
+	if err == nil && useCache {
+		s.cacheMetrics(ctx, profile, nodeName, metricValues)
+	}
+	return
+}
+
+// Reads the metrics of a profile for a node from its provider, retrying transient
+// errors and skipping the node while its circuit breaker is open
+func (s *Scheduler) fetchMetrics(ctx context.Context, profile *Profile, nodeName string) (metricValues []float64, err error) {
+	if !s.breakers.allow(nodeName) {
+		return nil, circuitOpen
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.MetricsTimeout)
+	defer cancel()
+
+	err = withRetries(ctx, s.config.Retry, func() (err error) {
+		if err = s.limits.of(profile).waitMetrics(ctx); err != nil {
+			return
+		}
+		metricValues, err = profile.provider.NodeMetrics(ctx, nodeName, profile.metricNames)
+		return
+	})
+	if err == nil {
+		metricValues = profile.smooth(nodeName, metricValues)
+	}
+	if stale, ok := err.(metrics.StaleDataError); ok {
+		// The backend answered, the agent of the node is the one not reporting
+		staleNodes.Add(profile.Name, 1)
+		return nil, stale
+	}
+	if err != metrics.NoDataFound {
+		s.breakers.record(nodeName, err)
+	}
+	return
+}
+
+// Metric reads returning stale data, by profile
+var staleNodes = expvar.NewMap("staleNodes")
+
+// Appends the values of the scorers of the profile for the node to a copy of its metric values.
+// The metric values are shared with the other pods scored at the same time, the scorer values
+// depend on the pod and must not leak to them.
+func runScorers(ctx context.Context, profile *Profile, pod scoring.Pod, node scoring.Node, metricValues []float64) ([]float64, error) {
+	metricValues = append(make([]float64, 0, len(metricValues)+len(profile.scorers)), metricValues...)
+	node.Metrics = map[string]float64{}
+	for i, name := range profile.metricNames {
+		node.Metrics[name] = metricValues[i]
+	}
+	for _, scorer := range profile.scorers {
+		value, err := scorer.Score(ctx, pod, node)
+		if err != nil {
+			return nil, err
+		}
+		metricValues = append(metricValues, value)
+	}
+	return metricValues, nil
+}
+
+// Ranks the nodes based in the metrics of the profile from a list of node names, the best one first.
+// The scored nodes, failed ones included, are returned too. Several pods are scored at the
+// same time, the reservations keep them from overcommitting a node.
+func (s *Scheduler) getBestNodeByMetrics(ctx context.Context, profile *Profile, pod kubernetes.KubePod, nodes []string) (ranked []Node, scored NodeList, err error) {
+	if len(nodes) == 0 {
+		err = failure.New(failure.NoCandidates, failure.Filter, "node list must contain at least one element")
+		return
+	}
+
+	ctx, span := tracing.Start(ctx, "score")
+	span.SetAttribute("nodes", len(nodes))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	// Fill the list with all the succeeded nodes
+	nodeList := NodeList{}
+	scored = s.scoreNodes(ctx, profile, pod, nodes)
+	s.gauges.record(profile, scored, false)
+	for _, node := range scored {
+		if node.err != nil {
+			failures.record(node.err)
+		}
+		if failure.ReasonOf(node.err) == failure.ThresholdReached {
+			log.Printf("Node %s rejected: %s", node.name, node.err)
+			continue
+		}
+		if failure.ReasonOf(node.err) == failure.StaleMetrics {
+			log.Printf("Node %s excluded: %s", node.name, node.err)
+			continue
+		}
+		if node.err != nil {
+			// Print any errors found
+			log.Printf("Error retrieving node %q: %q", node.name, node.err.Error())
+			continue
+		}
+		nodeList = append(nodeList, node)
+	}
+
+	// Calculate the best node
+	bestNodeFound, err := bestNodeFromList(profile, nodeList)
+	if err == nil {
+		ranked = rankedCandidates(profile, s.breakTie(ctx, profile, pod, nodeList, bestNodeFound), nodeList)
+	}
+	return
+}
+
+// Retrieves the metrics of every node and calculates their score. The nodes whose
+// metrics could not be retrieved are returned with the error.
+func (s *Scheduler) scoreNodes(ctx context.Context, profile *Profile, pod kubernetes.KubePod, nodes []string) (scored NodeList) {
+	if len(profile.pools) > 0 {
+		return s.scoreNodePools(ctx, profile, pod, nodes)
+	}
+
+	var scorerPod scoring.Pod
+	labels := map[string]map[string]string{}
+	if len(profile.scorers) > 0 {
+		scorerPod = scoring.Pod{
+			Name:        pod.Metadata.Name,
+			Namespace:   pod.Metadata.Namespace,
+			Labels:      pod.Metadata.Labels,
+			Annotations: pod.Metadata.Annotations,
+			Requests:    podRequests(pod),
+		}
+		for _, container := range pod.Spec.Containers {
+			scorerPod.Images = append(scorerPod.Images, container.Image)
+		}
+		scorerPod.Controller, _ = controllerOf(pod)
+		for _, node := range s.nodesAvailable(ctx) {
+			labels[node.Metadata.Name] = node.Metadata.Labels
+		}
+	}
+
+	// With a batch provider the nodes are read together first, the others one by one
+	batched := s.batchMetrics(ctx, profile, nodes)
+
+	// We will make all the request asynchronous for performance reasons,
+	// with at most MetricsConcurrency of them running at the same time
+	wg := sync.WaitGroup{}
+	semaphore := make(chan struct{}, s.config.MetricsConcurrency)
+	nodeStatsChannel := make(chan Node, len(nodes))
+
+	// Launch all requests asynchronously
+	// to retrieve the metrics of each node
+	for _, node := range nodes {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			nodeStatsChannel <- Node{name: node, err: nodeFailure(profile, node, failure.Metrics, ctx.Err())}
+			continue
+		}
+		wg.Add(1)
+
+		go func(nodeName string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			phase := failure.Metrics
+			metricValues, ok := batched[nodeName]
+			var windows [][]float64
+			var err error
+			if len(profile.Windows) > 0 {
+				metricValues, windows, err = s.getWindowMetrics(ctx, profile, nodeName)
+			} else if !ok {
+				metricValues, err = s.getMetrics(ctx, profile, nodeName)
+			}
+			if err == nil {
+				err = s.checkStability(ctx, profile, nodeName)
+			}
+			if err == nil && len(profile.scorers) > 0 {
+				phase = failure.Score
+				metricValues, err = runScorers(ctx, profile, scorerPod, scoring.Node{Name: nodeName, Labels: labels[nodeName]}, metricValues)
+			}
+			if err == nil { // No error found, we will send the struct
+				nodeStatsChannel <- Node{name: nodeName, metrics: metricValues, windows: windows}
+			} else {
+				nodeStatsChannel <- Node{name: nodeName, err: nodeFailure(profile, nodeName, phase, err)}
+			}
+		}(node)
+	}
+
+	wg.Wait()
+	close(nodeStatsChannel)
+
+	for node := range nodeStatsChannel {
+		scored = append(scored, node)
+	}
+	// The nodes past a threshold are left out before normalizing, some normalizations need the values of all the nodes
+	applyThresholds(profile, scored)
+	scoreList(profile, scored)
+	if profile.WindowConsensus == consensusRank {
+		rankConsensus(profile, scored)
+	}
+	return
+}
+
+// Sorts the list and returns the best node for the profile strategy
+func bestNodeFromList(profile *Profile, list NodeList) (node Node, err error) {
+	sort.Sort(list)
+
+	length := len(list)
+	if length == 0 {
+		return node, failure.New(failure.NoNodeScored, failure.Score, "no node could be scored")
+	}
+
+	if profile.lowerIsBetter() {
+		return list[0], nil // Get the first -> Lower
+	} else {
+		return list[length-1], nil // Get the last -> Higher
+	}
+}
+
+// Returns the ready nodes of the cluster selected by the node selector of the configuration
+func (s *Scheduler) nodesAvailable(ctx context.Context) []kubernetes.KubeNode {
+	return s.selectNodes(s.allReadyNodes(ctx))
+}
+
+// Returns the nodes matching the node selector of the configuration, all of them if it is not set
+func (s *Scheduler) selectNodes(nodes []kubernetes.KubeNode) (selected []kubernetes.KubeNode) {
+	if s.config.NodeSelector == nil {
+		return nodes
+	}
+	for _, node := range nodes {
+		if s.config.NodeSelector.Matches(node.Metadata.Labels) {
+			selected = append(selected, node)
+		}
+	}
+	return
+}
+
+// Returns a list of all the available nodes found in the Kubernetes cluster
+func (s *Scheduler) allReadyNodes(ctx context.Context) (readyNodes []kubernetes.KubeNode) {
+	if nodes, ok := s.cachedNodes.Data(); ok {
+		return nodes.([]kubernetes.KubeNode)
+	}
+
+	ctx, span := tracing.Start(ctx, "list nodes")
+	defer span.End()
+	nodes, err := s.kubeAPI.ListNodes(ctx)
+	if err != nil {
+		log.Println(err)
+		span.SetError(err)
+	}
+	readyNodes = onlyReady(nodes)
+
+	s.cachedNodes.SetData(readyNodes)
+	return
+}
+
+// Returns the nodes with the Ready condition
+func onlyReady(nodes []kubernetes.KubeNode) (readyNodes []kubernetes.KubeNode) {
+	for _, node := range nodes {
+		for _, status := range node.Status.Conditions {
+			if status.Status == "True" && status.Type == "Ready" {
+				readyNodes = append(readyNodes, node)
+			}
+		}
+	}
+	return
+}
+
+// Returns the deployment owning the pod through its ReplicaSet, an error for the other pods
+func (s *Scheduler) findDeploymentNameFromPod(ctx context.Context, pod kubernetes.KubePod) (deploymentName string, err error) {
+	if len(pod.Metadata.OwnerReferences) == 0 {
+		return "", errors.New("the pod has no owner")
+	}
+	owner := pod.Metadata.OwnerReferences[0]
+	if owner.Kind != "ReplicaSet" {
+		return "", fmt.Errorf("%s is not supported yet as a OwnerReference", owner.Kind)
+	}
+	replicaSet, err := s.kubeAPI.ListNamespacedReplicaset(ctx, pod.Metadata.Namespace, owner.Name)
+	if err != nil {
+		return "", err
+	}
+	if len(replicaSet.Metadata.OwnerReferences) == 0 || replicaSet.Metadata.OwnerReferences[0].Kind != "Deployment" {
+		return "", fmt.Errorf("ReplicaSet %s is not owned by a Deployment", owner.Name)
+	}
+	return replicaSet.Metadata.OwnerReferences[0].Name, nil
+}
+
+// Binds the pod to the node and checks the api server response. The pod is read again first,
+// so a pod bound or deleted since its event returns a binding.Conflict without a binding.
+func (s *Scheduler) bindPod(ctx context.Context, pod kubernetes.KubePod, nodeName string) (err error) {
+	ctx, span := tracing.Start(ctx, "bind")
+	span.SetAttribute("node", nodeName)
+	defer func() {
+		if conflict, ok := err.(binding.Conflict); ok {
+			span.SetAttribute("conflict", true)
+			s.reportConflict(ctx, pod, nodeName, conflict)
+			err = &failure.Error{Reason: failure.BindConflict, Phase: failure.Bind, Node: nodeName, Err: err}
+		} else if err != nil {
+			err = &failure.Error{Reason: failure.BindError, Phase: failure.Bind, Node: nodeName, Err: err}
+		}
+		span.SetError(err)
+		span.End()
+	}()
+
+	if err = s.bindLimits.waitNode(ctx, nodeName); err != nil {
+		return fmt.Errorf("waiting for the rate limit of %s: %s", nodeName, err)
+	}
+
+	if err = binding.Check(ctx, &s.kubeAPI, pod.Metadata.Namespace, pod.Metadata.Name); err != nil {
+		return err
+	}
+
+	if err = s.bindVolumes(ctx, pod, nodeName); err != nil {
+		return err
+	}
+
+	binder, backend := s.binderFor(ctx, nodeName)
+	span.SetAttribute("backend", backend)
+	if err = binder.Bind(ctx, pod, nodeName); err != nil {
+		return err
+	}
+	bindingBackends.Add(backend, 1)
+	s.recordBinding(nodeName)
+	s.ledger.record(nodeName, podRequests(pod))
+	s.pins.record(pod, nodeName)
+	return nil
+}
+
+// Records a Normal event on the pod telling why it was not bound to the node, the pod is fine.
+// Nothing is recorded while the pod is still unbound, the next candidate is tried then.
+func (s *Scheduler) reportConflict(ctx context.Context, pod kubernetes.KubePod, nodeName string, conflict binding.Conflict) {
+	if conflict.Gone || conflict.Node == "" {
+		return
+	}
+	message := fmt.Sprintf("Not bound to %s by %s: %s", nodeName, pod.Spec.SchedulerName, conflict)
+	s.reportPodEvent(ctx, pod, "Normal", "BindingConflict", message)
+}
+
+// Records an event on the pod from its scheduler, errors are logged
+func (s *Scheduler) reportPodEvent(ctx context.Context, pod kubernetes.KubePod, eventType, reason, message string) {
+	event := kubernetes.NewPodEvent(pod, pod.Spec.SchedulerName, eventType, reason, message)
+	if id := decisionIDOf(ctx); id != "" {
+		event.Metadata.Annotations = map[string]string{decisionIDAnnotation: id}
+	}
+	if err := s.kubeAPI.CreateEvent(ctx, event); err != nil {
+		log.Printf("Error creating the %s event of %s: %s", reason, pod.Metadata.Name, err)
+	}
+}
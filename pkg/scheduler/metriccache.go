@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/cache"
+)
+
+// Cache types
+const (
+	cacheMemory = "memory"
+	cacheRedis  = "redis"
+)
+
+func (c CacheConfig) validate() error {
+	switch c.Type {
+	case cacheMemory:
+	case cacheRedis:
+		if c.Redis == nil || c.Redis.Address == "" {
+			return errors.New("cache: redis address must be set")
+		}
+	default:
+		return fmt.Errorf("cache: unknown type %q", c.Type)
+	}
+	return nil
+}
+
+// Returns the store of the configuration, the Redis password is read from its secret or REDIS_PASSWORD
+func (s *Scheduler) newMetricCache(ctx context.Context, c CacheConfig) (cache.Store, error) {
+	if c.Type != cacheRedis {
+		return cache.NewMemory(), nil
+	}
+	password := os.Getenv("REDIS_PASSWORD")
+	if c.Redis.Secret != nil {
+		values, err := s.credentials(c.Redis.Secret, []string{"password"}, nil)(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cache: %s", err)
+		}
+		password = values[0]
+	}
+	return cache.NewRedis(c.Redis.Address, password, c.Redis.DB, c.Redis.TLS, c.Redis.Prefix), nil
+}
+
+// Returns the key of the metric values of a node for a profile. The provider and the metric names
+// are part of it, so the profiles of the same name with other metrics, like the replicas running
+// another configuration or a policy replacing a profile, don't share values.
+func metricCacheKey(profile *Profile, nodeName string) string {
+	sum := sha1.Sum([]byte(profile.provider.Name() + "\n" + strings.Join(profile.metricNames, "\n")))
+	return "metrics/" + profile.Name + "/" + hex.EncodeToString(sum[:8]) + "/" + nodeName
+}
+
+// Returns how long the metric values of the profile are cached, the TTL of the cache by default
+func (p *Profile) cacheTTL(defaultTTL time.Duration) time.Duration {
+	if p.CacheTTL > 0 {
+		return p.CacheTTL
+	}
+	return defaultTTL
+}
+
+// Returns the metric values of the node cached for the profile. Errors of the store are logged
+// and read as a miss, the metrics are then read from the provider.
+func (s *Scheduler) cachedMetrics(ctx context.Context, profile *Profile, nodeName string) (metricValues []float64, ok bool) {
+	data, ok, err := s.metricCache.Get(ctx, metricCacheKey(profile, nodeName))
+	if err != nil {
+		log.Printf("Error reading the metric cache: %s", err)
+		return nil, false
+	}
+	if !ok {
+		return
+	}
+	if err = json.Unmarshal(data, &metricValues); err != nil || len(metricValues) != len(profile.metricNames) {
+		return nil, false
+	}
+	return
+}
+
+// Caches the metric values of the node for the profile
+func (s *Scheduler) cacheMetrics(ctx context.Context, profile *Profile, nodeName string, metricValues []float64) {
+	data, err := json.Marshal(metricValues)
+	if err != nil {
+		return
+	}
+	if err = s.metricCache.Set(ctx, metricCacheKey(profile, nodeName), data, profile.cacheTTL(s.config.Cache.TTL)); err != nil {
+		log.Printf("Error writing the metric cache: %s", err)
+	}
+}
+
+// Metric reads in flight, indexed by cache key. The pods scored at the same time share the read
+// of a node instead of requesting the same metrics several times.
+type metricFetches struct {
+	mutex sync.Mutex
+	calls map[string]*metricFetch
+}
+
+type metricFetch struct {
+	done   chan struct{}
+	values []float64
+	err    error
+}
+
+// Calls fetch unless a read of the same metrics of the node is in flight, whose result is returned
+// then. The read runs on a context detached from the callers, bounded by the MetricsTimeout of
+// fetch, so a pod timing out doesn't fail the others waiting for it: every caller stops waiting
+// when its own context is done.
+func (f *metricFetches) do(ctx context.Context, profile *Profile, nodeName string, fetch func(context.Context) ([]float64, error)) ([]float64, error) {
+	key := metricCacheKey(profile, nodeName)
+	f.mutex.Lock()
+	call, ok := f.calls[key]
+	if !ok {
+		call = &metricFetch{done: make(chan struct{})}
+		f.calls[key] = call
+		go func() {
+			call.values, call.err = fetch(context.WithoutCancel(ctx))
+			f.mutex.Lock()
+			delete(f.calls, key)
+			f.mutex.Unlock()
+			close(call.done)
+		}()
+	}
+	f.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.values, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
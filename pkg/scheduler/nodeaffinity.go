@@ -0,0 +1,95 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Well-known labels of the operating system and architecture of the nodes
+const (
+	osLabel   = "kubernetes.io/os"
+	archLabel = "kubernetes.io/arch"
+)
+
+// Annotation of the pods listing the os/arch platforms their images are built for, like
+// linux/amd64,linux/arm64, as reported by the registry. All the platforms of the node OS if unset.
+const imagePlatformsAnnotation = "sysdig-scheduler/image-platforms"
+
+// Rejects the nodes not matching the node selector or the required node affinity of the pod
+func nodeAffinityFilter(state *cycleState, node kubernetes.KubeNode) error {
+	for key, value := range state.pod.Spec.NodeSelector {
+		if node.Metadata.Labels[key] != value {
+			return fmt.Errorf("node does not match the node selector %s=%s", key, value)
+		}
+	}
+	if affinity := state.pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil {
+		if !affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.Matches(node.Metadata.Labels, node.Metadata.Name) {
+			return fmt.Errorf("node does not match the required node affinity")
+		}
+	}
+	return nil
+}
+
+// Rejects the nodes of another operating system than the pod, linux unless the pod sets its os or
+// selects the os of its nodes, and the nodes of a platform the images of the pod are not built for.
+// The nodes without the os and arch labels are not rejected.
+func nodePlatformFilter(state *cycleState, node kubernetes.KubeNode) error {
+	nodeOS, ok := node.Metadata.Labels[osLabel]
+	if !ok {
+		return nil
+	}
+	if podOS, ok := podOS(state.pod); ok && podOS != nodeOS {
+		return fmt.Errorf("%s node, the pod runs on %s", nodeOS, podOS)
+	}
+
+	value, ok := state.pod.Metadata.Annotations[imagePlatformsAnnotation]
+	if !ok {
+		return nil
+	}
+	nodeArch := node.Metadata.Labels[archLabel]
+	for _, platform := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(platform), "/", 3)
+		if parts[0] == nodeOS && (len(parts) == 1 || nodeArch == "" || parts[1] == nodeArch) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the images are not built for %s/%s", nodeOS, nodeArch)
+}
+
+// Returns the operating system the pod needs, false if the pod leaves it to its node selection
+func podOS(pod kubernetes.KubePod) (string, bool) {
+	if pod.Spec.OS != nil && pod.Spec.OS.Name != "" {
+		return pod.Spec.OS.Name, true
+	}
+	if _, ok := pod.Spec.NodeSelector[osLabel]; ok {
+		return "", false
+	}
+	if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil && affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			for _, requirement := range term.MatchExpressions {
+				if requirement.Key == osLabel {
+					return "", false
+				}
+			}
+		}
+	}
+	return "linux", true
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotations of the pods listing the nodes to place them on first, or never
+const (
+	preferredNodesAnnotation = "sysdig-scheduler/preferred-nodes"
+	excludedNodesAnnotation  = "sysdig-scheduler/excluded-nodes"
+)
+
+// Name of the filter leaving out the other nodes when a preferred node of the pod can take it
+const preferredNodesFilter = "PreferredNodes"
+
+// A node of an annotation: a node name, or a label term key=value or key!=value
+type nodeTerm struct {
+	name  string
+	key   string
+	value string
+	not   bool
+}
+
+// Nodes listed in an annotation, a node is listed if it matches one of the terms
+type nodeTerms []nodeTerm
+
+// Parses comma separated node names and label terms
+func parseNodeTerms(value string) (terms nodeTerms) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+		case strings.Contains(item, "!="):
+			parts := strings.SplitN(item, "!=", 2)
+			terms = append(terms, nodeTerm{key: strings.TrimSpace(parts[0]), value: strings.TrimSpace(parts[1]), not: true})
+		case strings.Contains(item, "="):
+			parts := strings.SplitN(item, "=", 2)
+			terms = append(terms, nodeTerm{key: strings.TrimSpace(parts[0]), value: strings.TrimSpace(parts[1])})
+		default:
+			terms = append(terms, nodeTerm{name: item})
+		}
+	}
+	return
+}
+
+// Returns true if the node matches one of the terms
+func (t nodeTerms) matches(node kubernetes.KubeNode) bool {
+	for _, term := range t {
+		if term.name != "" {
+			if node.Metadata.Name == term.name {
+				return true
+			}
+			continue
+		}
+		value, ok := node.Metadata.Labels[term.key]
+		if (ok && value == term.value) != term.not {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejects the nodes listed in the excluded-nodes annotation of the pod
+func excludedNodesFilter(state *cycleState, node kubernetes.KubeNode) error {
+	value, ok := state.pod.Metadata.Annotations[excludedNodesAnnotation]
+	if ok && parseNodeTerms(value).matches(node) {
+		return errors.New("node is excluded by the pod")
+	}
+	return nil
+}
+
+// Leaves out the other candidates when some of the nodes listed in the preferred-nodes
+// annotation of the pod are candidates, the pod goes to the other nodes only when none is
+func preferAnnotatedNodes(state *cycleState, candidates []string, rejected map[string]error) []string {
+	value, ok := state.pod.Metadata.Annotations[preferredNodesAnnotation]
+	if !ok {
+		return candidates
+	}
+	terms := parseNodeTerms(value)
+	var preferred, others []string
+	for _, name := range candidates {
+		if node, _ := state.node(name); terms.matches(node) {
+			preferred = append(preferred, name)
+		} else {
+			others = append(others, name)
+		}
+	}
+	if len(preferred) == 0 {
+		return candidates
+	}
+	for _, name := range others {
+		rejected[name] = filterError{preferredNodesFilter, fmt.Errorf("the pod prefers %s", value)}
+	}
+	return preferred
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Api path of the NodePool custom resources, see deploy/nodepool-crd.yaml
+const nodePoolsAPI = "apis/scheduling.sysdig.com/v1alpha1/nodepools"
+
+type nodePoolEvent struct {
+	Type   string           `json:"type"`
+	Object nodePoolResource `json:"object"`
+}
+
+// NodePool custom resource, the nodes of its selector where the pods of its namespaces or pod
+// selector are scored with the profile or the SchedulingPolicy it refers to
+type nodePoolResource struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeSelector *kubernetes.KubeLabelSelector `json:"nodeSelector"`
+		Namespaces   []string                      `json:"namespaces"`
+		PodSelector  *kubernetes.KubeLabelSelector `json:"podSelector"`
+		// Profile of the configuration, or Policy, the namespace/name of a SchedulingPolicy
+		Profile string `json:"profile"`
+		Policy  string `json:"policy"`
+		// MaxUtilization rejects the nodes where the pod would take the requested cpu or memory
+		// above that percentage of the allocatable, unlimited if 0
+		MaxUtilization float64 `json:"maxUtilization"`
+	} `json:"spec"`
+}
+
+// Checks the resource, a pool without a node selector would take every node
+func (p nodePoolResource) validate() error {
+	if p.Spec.NodeSelector == nil {
+		return fmt.Errorf("the node selector must be set")
+	}
+	if len(p.Spec.Namespaces) == 0 && p.Spec.PodSelector == nil {
+		return fmt.Errorf("the namespaces or the pod selector must be set")
+	}
+	if p.Spec.Profile != "" && p.Spec.Policy != "" {
+		return fmt.Errorf("the profile and the policy can't be set together")
+	}
+	if p.Spec.MaxUtilization < 0 || p.Spec.MaxUtilization > 100 {
+		return fmt.Errorf("the max utilization must be a percentage")
+	}
+	return nil
+}
+
+// Returns true if the pod belongs to the pool, by its namespace or its labels
+func (p nodePoolResource) selects(pod kubernetes.KubePod) bool {
+	if containsString(p.Spec.Namespaces, pod.Metadata.Namespace) {
+		return true
+	}
+	return p.Spec.PodSelector != nil && p.Spec.PodSelector.Matches(pod.Metadata.Labels)
+}
+
+// The NodePool resources, indexed by name
+type nodePoolSet struct {
+	mutex sync.RWMutex
+	pools map[string]nodePoolResource
+}
+
+// Returns the first pool in name order the pod belongs to
+func (s *nodePoolSet) forPod(pod kubernetes.KubePod) (pool nodePoolResource, ok bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	names := make([]string, 0, len(s.pools))
+	for name := range s.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if s.pools[name].selects(pod) {
+			return s.pools[name], true
+		}
+	}
+	return
+}
+
+func (s *nodePoolSet) set(pool nodePoolResource) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pools[pool.Metadata.Name] = pool
+}
+
+func (s *nodePoolSet) remove(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pools, name)
+}
+
+// Returns the profile of the pool of the pod matched by the profile, the profile itself if the pod
+// has no pool, or if its pool refers to no profile or to one that is not defined
+func (s *Scheduler) nodePoolProfile(profile *Profile, pod kubernetes.KubePod) *Profile {
+	if !s.config.WatchNodePools {
+		return profile
+	}
+	pool, ok := s.nodePoolResources.forPod(pod)
+	if !ok {
+		return profile
+	}
+	var referred *Profile
+	switch {
+	case pool.Spec.Profile != "":
+		referred = s.profiles.staticByName(pool.Spec.Profile)
+	case pool.Spec.Policy != "":
+		referred = s.profiles.policyByName(pool.Spec.Policy)
+	}
+	if referred == nil {
+		return profile
+	}
+	return referred
+}
+
+// Rejects the nodes out of the pool of the pod, and the pool nodes where the pod would take the
+// requests above the max utilization of the pool
+func nodePoolFilter(state *cycleState, node kubernetes.KubeNode) error {
+	if !state.scheduler.config.WatchNodePools {
+		return nil
+	}
+	pool, ok := state.scheduler.nodePoolResources.forPod(state.pod)
+	if !ok {
+		return nil
+	}
+	if !pool.Spec.NodeSelector.Matches(node.Metadata.Labels) {
+		return fmt.Errorf("node is not in node pool %s", pool.Metadata.Name)
+	}
+	if pool.Spec.MaxUtilization <= 0 {
+		return nil
+	}
+
+	requested, err := state.requestedOn(node.Metadata.Name)
+	if err != nil {
+		return err
+	}
+	allocatable := parseResourceList(node.Status.Allocatable)
+	for _, name := range []string{"cpu", "memory"} {
+		if allocatable[name] <= 0 {
+			continue
+		}
+		if utilization := (requested[name] + state.fitRequests()[name]) / allocatable[name] * 100; utilization > pool.Spec.MaxUtilization {
+			return fmt.Errorf("%s requested on the node would be %.0f%%, above the %g%% of node pool %s", name, utilization, pool.Spec.MaxUtilization, pool.Metadata.Name)
+		}
+	}
+	return nil
+}
+
+// Keeps the NodePool resources up to date until the context is done
+func (s *Scheduler) watchNodePools(ctx context.Context) {
+	for ctx.Err() == nil {
+		ch, err := s.kubeAPI.Watch(ctx, "GET", nodePoolsAPI, nil, nil)
+		if err != nil {
+			log.Println("error while watching the node pools:", err)
+		} else {
+			for data := range ch {
+				s.handleNodePoolEvent(data)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Applies a change of a NodePool
+func (s *Scheduler) handleNodePoolEvent(data []byte) {
+	event := nodePoolEvent{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Println("error while decoding a node pool event:", err)
+		return
+	}
+
+	pool := event.Object
+	switch event.Type {
+	case "ADDED", "MODIFIED":
+		if err := pool.validate(); err != nil {
+			log.Printf("rejecting node pool %s: %s", pool.Metadata.Name, err)
+			s.nodePoolResources.remove(pool.Metadata.Name)
+			return
+		}
+		log.Printf("applying node pool %s", pool.Metadata.Name)
+		s.nodePoolResources.set(pool)
+	case "DELETED":
+		log.Printf("removing node pool %s", pool.Metadata.Name)
+		s.nodePoolResources.remove(pool.Metadata.Name)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+)
+
+// A node pool of a profile, scored with the copy of the profile with the metrics of the pool
+type nodePool struct {
+	name     string
+	selector *kubernetes.KubeLabelSelector
+	profile  *Profile
+}
+
+// Builds the copies of the profile scoring its node pools
+func (p *Profile) initNodePools() error {
+	p.pools = nil
+	for i, pool := range p.NodePools {
+		if pool.Name == "" {
+			pool.Name = fmt.Sprint(i)
+		}
+		if pool.Selector == nil {
+			return fmt.Errorf("profile %q: node pool %s: selector must be set", p.Name, pool.Name)
+		}
+		if len(pool.Metrics) == 0 {
+			return fmt.Errorf("profile %q: node pool %s: at least one metric must be defined", p.Name, pool.Name)
+		}
+
+		variant := *p
+		variant.NodePools, variant.QoSClasses = nil, nil
+		variant.Metrics = append([]MetricConfig(nil), pool.Metrics...)
+		variant.Score, variant.score = "", nil
+		if err := variant.init(); err != nil {
+			return fmt.Errorf("%s, in node pool %s", err, pool.Name)
+		}
+		// The prefetch loop reads the metrics of the profile, the pool ones are read on demand
+		variant.prefetched = nil
+		p.pools = append(p.pools, nodePool{pool.Name, pool.Selector, &variant})
+	}
+	return nil
+}
+
+// Returns the copy of the profile for the first node pool the node belongs to, the profile itself
+// if none
+func (p *Profile) forNode(node kubernetes.KubeNode) *Profile {
+	for _, pool := range p.pools {
+		if pool.selector.Matches(node.Metadata.Labels) {
+			return pool.profile
+		}
+	}
+	return p
+}
+
+// Embedded by the scorers reading the state of the scheduler, set with the provider of their profile
+type schedulerScorer struct {
+	scheduler *Scheduler
+}
+
+func (s *schedulerScorer) setScheduler(scheduler *Scheduler) {
+	s.scheduler = scheduler
+}
+
+// Sets the scheduler and the metric provider of the profile, of its scorers and of its QoS class
+// and node pool copies
+func (p *Profile) setProvider(scheduler *Scheduler, provider metrics.Provider) {
+	p.provider = provider
+	for _, scorer := range p.scorers {
+		if scorer, ok := scorer.(interface{ setScheduler(*Scheduler) }); ok {
+			scorer.setScheduler(scheduler)
+		}
+	}
+	for _, variant := range p.qosProfiles {
+		variant.setProvider(scheduler, provider)
+	}
+	for _, pool := range p.pools {
+		pool.profile.setProvider(scheduler, provider)
+	}
+}
+
+// Returns the profile with its QoS class and node pool variants, which keep their own metric state
+func (p *Profile) withVariants() (all []*Profile) {
+	all = append(all, p)
+	for _, variant := range p.qosProfiles {
+		all = append(all, variant.withVariants()...)
+	}
+	for _, pool := range p.pools {
+		all = append(all, pool.profile.withVariants()...)
+	}
+	return
+}
+
+// Scores the nodes of every node pool with its metrics and the other nodes with the metrics of
+// the profile. The values of the pool nodes keep the names of their metrics.
+func (s *Scheduler) scoreNodePools(ctx context.Context, profile *Profile, pod kubernetes.KubePod, nodes []string) (scored NodeList) {
+	groups := map[*Profile][]string{}
+	var order []*Profile
+	for _, name := range nodes {
+		variant := profile
+		// The nodes of the other clusters are not known, they are scored with the profile
+		if node, err := s.findNode(ctx, name); err == nil {
+			variant = profile.forNode(node)
+		}
+		if _, ok := groups[variant]; !ok {
+			order = append(order, variant)
+		}
+		groups[variant] = append(groups[variant], name)
+	}
+
+	for _, variant := range order {
+		group := s.scoreNodes(ctx, variant, pod, groups[variant])
+		if variant != profile {
+			for i := range group {
+				group[i].names = variant.metricNames
+			}
+		}
+		scored = append(scored, group...)
+	}
+	return
+}
+
+// Returns the names of the metric values of the node
+func (n Node) metricNames(profile *Profile) []string {
+	if n.names != nil {
+		return n.names
+	}
+	return profile.metricNames
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+const (
+	nodeScoresAnnotation = "annotation"
+	nodeScoresCRD        = "crd"
+
+	// Annotation of the nodes with their last scores, in JSON
+	scoresAnnotation = "sysdig-scheduler/scores"
+
+	nodeScoresAPI = "apis/scheduling.sysdig.com/v1alpha1/nodescores"
+)
+
+func (c NodeScoresConfig) validate() error {
+	switch c.Target {
+	case "", nodeScoresAnnotation, nodeScoresCRD:
+		return nil
+	}
+	return fmt.Errorf("nodeScores: unknown target %q", c.Target)
+}
+
+// Last score of a node with a profile, as published
+type nodeScore struct {
+	Profile string             `json:"profile"`
+	Score   float64            `json:"score"`
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	Time    string             `json:"time"`
+}
+
+// Returns the last scores of every node, sorted by profile. The scores and metrics that
+// are not finite are left out, JSON can't encode them.
+func (g *scoreGauges) byNode() map[string][]nodeScore {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	scores := map[string][]nodeScore{}
+	for profile, nodes := range g.profiles {
+		for node, values := range nodes {
+			if math.IsNaN(values.score) || math.IsInf(values.score, 0) {
+				continue
+			}
+			score := nodeScore{Profile: profile, Score: values.score, Metrics: map[string]float64{}, Time: values.time.UTC().Format(time.RFC3339)}
+			for metric, value := range values.metrics {
+				if !math.IsNaN(value) && !math.IsInf(value, 0) {
+					score.Metrics[metric] = value
+				}
+			}
+			scores[node] = append(scores[node], score)
+		}
+	}
+	for _, list := range scores {
+		sort.Slice(list, func(i, j int) bool { return list[i].Profile < list[j].Profile })
+	}
+	return scores
+}
+
+// Publishes the last scores of the available nodes every interval until the context is done.
+// A node is only written again when its scores changed.
+func (s *Scheduler) publishNodeScoresLoop(ctx context.Context, c NodeScoresConfig) {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	published := map[string]string{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		scores := s.gauges.byNode()
+		for _, node := range s.nodesAvailable(ctx) {
+			name := node.Metadata.Name
+			if len(scores[name]) == 0 {
+				continue
+			}
+			data, err := json.Marshal(scores[name])
+			if err != nil {
+				log.Printf("error while encoding the scores of node %s: %s", name, err)
+				continue
+			}
+			if published[name] == string(data) {
+				continue
+			}
+			if err := s.publishNodeScores(ctx, c.Target, node, scores[name], data); err != nil {
+				log.Printf("error while publishing the scores of node %s: %s", name, err)
+				continue
+			}
+			published[name] = string(data)
+		}
+	}
+}
+
+// Writes the scores of the node in its annotation or its NodeScore resource, owned by the
+// node so the resource is deleted with it
+func (s *Scheduler) publishNodeScores(ctx context.Context, target string, node kubernetes.KubeNode, scores []nodeScore, data []byte) error {
+	if target == nodeScoresAnnotation {
+		return s.kubeAPI.AnnotateNode(ctx, node.Metadata.Name, scoresAnnotation, string(data))
+	}
+
+	manifest, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "scheduling.sysdig.com/v1alpha1",
+		"kind":       "NodeScore",
+		"metadata": map[string]interface{}{
+			"name": node.Metadata.Name,
+			"ownerReferences": []map[string]string{
+				{"apiVersion": "v1", "kind": "Node", "name": node.Metadata.Name, "uid": node.Metadata.Uid},
+			},
+		},
+		"status": map[string]interface{}{"scores": scores},
+	})
+	if err != nil {
+		return err
+	}
+	return s.kubeAPI.Apply(ctx, nodeScoresAPI+"/"+node.Metadata.Name, manifest, "sysdig-scheduler")
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Checks the normalization of the metric and fills the default
+func (m *MetricConfig) validateNormalization() error {
+	switch m.Normalize {
+	case "":
+		m.Normalize = scoring.NormalizeNone
+	case scoring.NormalizeNone, scoring.NormalizeMinMax, scoring.NormalizeZScore:
+	case scoring.NormalizeRange:
+		if m.Max <= m.Min {
+			return fmt.Errorf("metric %s: max must be greater than min", m.Name)
+		}
+	default:
+		return fmt.Errorf("metric %s: unknown normalization %q", m.Name, m.Normalize)
+	}
+	return nil
+}
+
+// Checks the transformations and the direction of the metric
+func (m *MetricConfig) validateTransform() error {
+	for _, transform := range m.Transform {
+		switch transform {
+		case scoring.TransformInvert, scoring.TransformLog, scoring.TransformFreeToUsed:
+		case scoring.TransformClamp:
+			if m.Max <= m.Min {
+				return fmt.Errorf("metric %s: max must be greater than min", m.Name)
+			}
+		default:
+			return fmt.Errorf("metric %s: unknown transformation %q", m.Name, transform)
+		}
+	}
+	switch m.Direction {
+	case "", directionLower, directionHigher:
+	default:
+		return fmt.Errorf("metric %s: unknown direction %q", m.Name, m.Direction)
+	}
+	return nil
+}
+
+// Returns true if the direction of the metric is the opposite of the profile strategy, so its
+// values are reversed before they are added to the score
+func (m MetricConfig) reversed(profile *Profile) bool {
+	switch m.Direction {
+	case directionLower:
+		return !profile.lowerIsBetter()
+	case directionHigher:
+		return profile.lowerIsBetter()
+	}
+	return false
+}
+
+// Parses the score expression of the profile and adds its variables that are neither a metric
+// nor a scorer to the metrics, so they are read
+func (p *Profile) parseScore() (err error) {
+	p.score = nil
+	if p.Score == "" {
+		return nil
+	}
+	if p.score, err = scoring.ParseExpression(p.Score); err != nil {
+		return
+	}
+
+	known := map[string]bool{}
+	for _, metric := range p.Metrics {
+		known[metric.Name] = true
+	}
+	for _, scorer := range p.Scorers {
+		known[scorer.Name] = true
+	}
+	// The metrics may be shared with the profile this one was copied from
+	metrics := p.Metrics[:len(p.Metrics):len(p.Metrics)]
+	for _, name := range p.score.Variables() {
+		if !known[name] {
+			metrics = append(metrics, MetricConfig{Name: name})
+		}
+	}
+	p.Metrics = metrics
+	return nil
+}
+
+// Calculates the score of every node without errors from its normalized metric values.
+// The normalizations over the nodes only use the nodes in the list. A node whose score is not a
+// finite number gets an error instead.
+func scoreList(profile *Profile, list NodeList) {
+	var valid []int
+	var candidates []scoring.Candidate
+	for i, node := range list {
+		if node.err == nil {
+			valid = append(valid, i)
+			candidates = append(candidates, scoring.Candidate{Name: node.name, Values: node.metrics})
+		}
+	}
+
+	metrics := make([]scoring.Metric, len(profile.Metrics))
+	for m, metric := range profile.Metrics {
+		metrics[m] = scoring.Metric{Name: metric.Name, Weight: metric.Weight, Normalize: metric.Normalize, Min: metric.Min, Max: metric.Max,
+			Transforms: metric.Transform, Reverse: metric.reversed(profile)}
+	}
+	scorerWeights := make([]float64, len(profile.Scorers))
+	for s, scorer := range profile.Scorers {
+		scorerWeights[s] = scorer.Weight
+	}
+
+	if profile.score != nil {
+		scoreExpression(profile, list, valid)
+		return
+	}
+
+	scoring.Score(metrics, scorerWeights, candidates)
+	for k, i := range valid {
+		score := candidates[k].Score
+		if math.IsNaN(score) || math.IsInf(score, 0) {
+			list[i].err = fmt.Errorf("score %g is not a finite number", score)
+			continue
+		}
+		list[i].score = score
+	}
+}
+
+// Sets the score of the nodes to the value of the score expression of the profile over their raw
+// metric and scorer values. A node whose score can't be calculated gets the error.
+func scoreExpression(profile *Profile, list NodeList, valid []int) {
+	for _, i := range valid {
+		values := map[string]float64{}
+		for m, metric := range profile.Metrics {
+			values[metric.Name] = list[i].metrics[m]
+		}
+		for s, scorer := range profile.Scorers {
+			values[scorer.Name] = list[i].metrics[len(profile.Metrics)+s]
+		}
+		score, err := profile.score.Eval(values)
+		if err != nil {
+			list[i].err = fmt.Errorf("score expression: %s", err)
+			continue
+		}
+		list[i].score = score
+	}
+}
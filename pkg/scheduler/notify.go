@@ -0,0 +1,180 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Notification formats
+const (
+	notificationCloudEvents = "cloudevents" // CloudEvents 1.0 in structured mode
+	notificationJSON        = "json"        // The decision as the body
+)
+
+// Outcomes notified by default, the ones placing the pod on a node
+var placementOutcomes = []string{outcomeBound, outcomePreempted, outcomeFallback, outcomeRemote}
+
+// Checks the format and the url of the notification endpoints
+func validateNotifications(notifications []NotificationConfig) error {
+	for _, n := range notifications {
+		if n.URL == "" {
+			return errors.New("notifications: url must be set")
+		}
+		if n.Format != notificationCloudEvents && n.Format != notificationJSON {
+			return fmt.Errorf("notifications: unknown format %q for %s", n.Format, n.URL)
+		}
+	}
+	return nil
+}
+
+// Posts the decisions to the endpoints in the background. A nil notifier discards them.
+type notifier struct {
+	endpoints []*notificationEndpoint
+}
+
+type notificationEndpoint struct {
+	config   NotificationConfig
+	outcomes map[string]bool
+	events   *asyncSink
+}
+
+// Returns the notifier of the endpoints, nil if there is none
+func newNotifier(configs []NotificationConfig) *notifier {
+	if len(configs) == 0 {
+		return nil
+	}
+	n := &notifier{}
+	for _, c := range configs {
+		endpoint := &notificationEndpoint{config: c, outcomes: map[string]bool{}}
+		for _, outcome := range c.Outcomes {
+			endpoint.outcomes[outcome] = true
+		}
+		endpoint.events = newAsyncSink(100, endpoint.run)
+		n.endpoints = append(n.endpoints, endpoint)
+	}
+	return n
+}
+
+// Queues the decision for the endpoints notified of its outcome, it is dropped if one can't keep up
+func (n *notifier) notify(record *auditRecord) {
+	if n == nil {
+		return
+	}
+	for _, endpoint := range n.endpoints {
+		if !endpoint.outcomes[record.Outcome] {
+			continue
+		}
+		if endpoint.events.push(record) {
+			log.Printf("notifications: queue of %s full, decision for %s/%s dropped", endpoint.config.URL, record.Namespace, record.Pod)
+		}
+	}
+}
+
+// Stops accepting decisions and waits for the queued ones to be sent
+func (n *notifier) close(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	for _, endpoint := range n.endpoints {
+		endpoint.events.stop()
+	}
+	for _, endpoint := range n.endpoints {
+		if !endpoint.events.wait(ctx) {
+			log.Println("notifications: shutdown timeout reached, pending notifications lost")
+			return
+		}
+	}
+}
+
+func (e *notificationEndpoint) run(events <-chan interface{}) {
+	for event := range events {
+		record := event.(*auditRecord)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := e.send(ctx, record); err != nil {
+			log.Printf("notifications: error while notifying %s of %s/%s: %s", e.config.URL, record.Namespace, record.Pod, err)
+		}
+		cancel()
+	}
+}
+
+// Event of the CloudEvents specification, with the decision as data
+type cloudEvent struct {
+	SpecVersion     string       `json:"specversion"`
+	ID              string       `json:"id"`
+	Source          string       `json:"source"`
+	Type            string       `json:"type"`
+	Subject         string       `json:"subject"`
+	Time            time.Time    `json:"time"`
+	DataContentType string       `json:"datacontenttype"`
+	Data            *auditRecord `json:"data"`
+}
+
+func (e *notificationEndpoint) send(ctx context.Context, record *auditRecord) error {
+	var body interface{} = record
+	contentType := "application/json"
+	if e.config.Format == notificationCloudEvents {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		body = cloudEvent{
+			SpecVersion:     "1.0",
+			ID:              hex.EncodeToString(id),
+			Source:          "/sysdig-kubernetes-scheduler/profiles/" + record.Profile,
+			Type:            "com.sysdig.scheduler.pod." + record.Outcome,
+			Subject:         record.Namespace + "/" + record.Pod,
+			Time:            record.Time,
+			DataContentType: "application/json",
+			Data:            record,
+		}
+		contentType = "application/cloudevents+json"
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", e.config.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	for name, value := range e.config.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("error code %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Outcomes of the observed decisions, once the pod is bound by its scheduler
+const (
+	observerAgree       = "agree"       // The pod was bound to the node the observer chose
+	observerDisagree    = "disagree"    // The pod was bound to another node
+	observerUnplaceable = "unplaceable" // The observer found no node for the pod
+)
+
+// Pending pods decided by the observer, compared once bound
+type observedDecisions struct {
+	scheduler *Scheduler
+	mutex     sync.Mutex
+	pods      map[string]*observedPod
+	outcomes  *expvar.Map // Indexed by profile/outcome
+	slots     chan struct{}
+}
+
+// Pod decided by the observer, the comparison is made once both nodes are known
+type observedPod struct {
+	profile string
+	decided bool
+	node    string // Best node of the observer, empty if none
+	bound   string
+}
+
+// Outcomes of the observed decisions, counted over the schedulers of the process
+var observedOutcomes = expvar.NewMap("observedDecisions")
+
+// Fills the profile of the observer and the interval of the score gauges
+func (c *Config) setObserverDefaults() {
+	if c.Observer.Profile == "" && len(c.Profiles) > 0 {
+		c.Observer.Profile = c.Profiles[0].Name
+	}
+	if c.Admin.ScoreInterval <= 0 {
+		c.Admin.ScoreInterval = time.Minute
+	}
+}
+
+// Turns off the features writing to the api server, and returns their names
+func (c *Config) observe() (disabled []string) {
+	for _, feature := range optionalFeatures {
+		if !feature.enabled(c) {
+			continue
+		}
+		for _, p := range feature.permissions(c) {
+			if !p.readOnly() {
+				feature.disable(c)
+				disabled = append(disabled, feature.name)
+				break
+			}
+		}
+	}
+	c.MinimalRBAC = true
+	return
+}
+
+// Returns true for the permissions reading the api server
+func (p permission) readOnly() bool {
+	return p.verb == "get" || p.verb == "list" || p.verb == "watch"
+}
+
+// Follows the pods of every scheduler: a pending pod is decided like a scheduling attempt, without
+// reserving or binding anything, and compared with the node it is bound to
+func (o *observedDecisions) observe(ctx context.Context, event kubernetes.KubePodEvent) {
+	pod := event.Object
+	key := pod.Metadata.Namespace + "/" + pod.Metadata.Name + "/" + pod.Metadata.UID
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if event.Type == "DELETED" {
+		delete(o.pods, key)
+		return
+	}
+
+	tracked, ok := o.pods[key]
+	switch {
+	case !ok && pod.Spec.NodeName == "" && pod.Status.Phase == "Pending":
+		profile := o.scheduler.profiles.forPod(pod)
+		if profile == nil {
+			profile = o.scheduler.profiles.staticByName(o.scheduler.config.Observer.Profile)
+		}
+		if profile == nil {
+			return
+		}
+		o.pods[key] = &observedPod{profile: profile.Name}
+		go o.decide(ctx, key, profile, pod)
+	case ok && pod.Spec.NodeName != "" && tracked.bound == "":
+		tracked.bound = pod.Spec.NodeName
+		o.compare(key, tracked)
+	}
+}
+
+// Filters and scores the nodes for the pod and records the decision, at most the scheduling
+// concurrency at the same time
+func (o *observedDecisions) decide(ctx context.Context, key string, profile *Profile, pod kubernetes.KubePod) {
+	o.mutex.Lock()
+	if o.slots == nil {
+		o.slots = make(chan struct{}, o.scheduler.config.SchedulingConcurrency)
+	}
+	slots := o.slots
+	o.mutex.Unlock()
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-ctx.Done():
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.scheduler.config.SchedulingTimeout)
+	defer cancel()
+	profile = profile.forQoSClass(pod)
+	record := newAuditRecord(profile, pod)
+	candidates, rejected := o.scheduler.filterNodes(ctx, pod, o.scheduler.nodesAvailable(ctx))
+	record.setNodes(rejected, nil)
+	var scored NodeList
+	if len(candidates) > 0 {
+		scored = o.scheduler.scoreNodes(ctx, profile, pod, candidates)
+	}
+	record.setNodes(nil, scored)
+	if o.scheduler.config.Audit.RecordInputs {
+		record.setInputs(profile, pod, scored)
+	}
+
+	var best string
+	if ranking := rankNodes(profile, scored); len(ranking) > 0 && ranking[0].Score != nil {
+		best = ranking[0].Node
+		record.finish(outcomeObserved, best, nil)
+	} else {
+		record.finish(outcomeObserved, "", failure.New(failure.NoNodeScored, failure.Score, "no node could be scored"))
+	}
+	o.scheduler.auditLog.record(record)
+	o.scheduler.history.record(record)
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	tracked, ok := o.pods[key]
+	if !ok {
+		return
+	}
+	tracked.decided, tracked.node = true, best
+	o.compare(key, tracked)
+}
+
+// Counts the outcome once the pod is decided and bound, the mutex being held
+func (o *observedDecisions) compare(key string, tracked *observedPod) {
+	if !tracked.decided || tracked.bound == "" {
+		return
+	}
+	delete(o.pods, key)
+
+	outcome := observerDisagree
+	switch tracked.node {
+	case "":
+		outcome = observerUnplaceable
+	case tracked.bound:
+		outcome = observerAgree
+	default:
+		log.Printf("Observer profile %s would have bound %s to %s instead of %s", tracked.profile, key, tracked.node, tracked.bound)
+	}
+	o.outcomes.Add(tracked.profile+"/"+outcome, 1)
+}
+
+// Writes the outcomes of the observed decisions as Prometheus counters
+func (o *observedDecisions) write(w http.ResponseWriter) {
+	if o.scheduler.config.Observer == nil {
+		return
+	}
+	var lines []string
+	o.outcomes.Do(func(kv expvar.KeyValue) {
+		parts := strings.SplitN(kv.Key, "/", 2)
+		lines = append(lines, fmt.Sprintf("sysdig_scheduler_observer_decisions_total{profile=%s,outcome=%s} %s",
+			promLabel(parts[0]), promLabel(parts[1]), kv.Value))
+	})
+	sort.Strings(lines)
+	fmt.Fprintln(w, "# HELP sysdig_scheduler_observer_decisions_total Pods bound by their scheduler to the node the observer chose or not.")
+	fmt.Fprintln(w, "# TYPE sysdig_scheduler_observer_decisions_total counter")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
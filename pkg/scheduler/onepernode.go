@@ -0,0 +1,76 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotation of the pods that must be the only pod on their node matching a label selector,
+// comma separated key=value labels like app=agent. An empty selector uses the labels of the pod.
+const onePerNodeAnnotation = "sysdig-scheduler/one-per-node"
+
+// Rejects the nodes already running a pod of the namespace matching the one per node selector of the pod
+func onePerNodeFilter(state *cycleState, node kubernetes.KubeNode) error {
+	value, ok := state.pod.Metadata.Annotations[onePerNodeAnnotation]
+	if !ok {
+		return nil
+	}
+	selector, err := parseOnePerNode(value, state.pod.Metadata.Labels)
+	if err != nil {
+		return fmt.Errorf("invalid %s annotation %q: %s", onePerNodeAnnotation, value, err)
+	}
+
+	pods, err := state.assignedPods()
+	if err != nil {
+		return err
+	}
+	for _, other := range pods {
+		if other.Spec.NodeName != node.Metadata.Name || other.Metadata.Namespace != state.pod.Metadata.Namespace {
+			continue
+		}
+		if selector.Matches(other.Metadata.Labels) {
+			return fmt.Errorf("pod %s/%s already runs on the node", other.Metadata.Namespace, other.Metadata.Name)
+		}
+	}
+	return nil
+}
+
+// Returns the selector of a one per node annotation, matching the labels if it is empty
+func parseOnePerNode(value string, labels map[string]string) (*kubernetes.KubeLabelSelector, error) {
+	matchLabels := map[string]string{}
+	for _, term := range strings.Split(value, ",") {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+		parts := strings.SplitN(term, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%q must be key=value", term)
+		}
+		matchLabels[parts[0]] = parts[1]
+	}
+	if len(matchLabels) == 0 {
+		if len(labels) == 0 {
+			return nil, fmt.Errorf("the pod has no labels")
+		}
+		matchLabels = labels
+	}
+	return &kubernetes.KubeLabelSelector{MatchLabels: matchLabels}, nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Name of the filter leaving out the other nodes when the node of a StatefulSet ordinal can take it
+const statefulSetPinningFilter = "StatefulSetPinning"
+
+// Node every StatefulSet ordinal was last bound to, indexed by the namespace/name of its pods
+type ordinalPins struct {
+	scheduler *Scheduler
+	mutex     sync.Mutex
+	nodes     map[string]string
+}
+
+// Returns the key of the StatefulSet ordinal of the pod, false if the pod has no ordinal
+func ordinalKey(pod kubernetes.KubePod) (string, bool) {
+	for _, owner := range pod.Metadata.OwnerReferences {
+		if owner.Kind != "StatefulSet" || !strings.HasPrefix(pod.Metadata.Name, owner.Name+"-") {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimPrefix(pod.Metadata.Name, owner.Name+"-")); err != nil {
+			continue
+		}
+		return pod.Metadata.Namespace + "/" + pod.Metadata.Name, true
+	}
+	return "", false
+}
+
+// Records the node the pod was bound to, if it is a StatefulSet pod and pinning is enabled
+func (p *ordinalPins) record(pod kubernetes.KubePod, nodeName string) {
+	key, ok := ordinalKey(pod)
+	if !p.scheduler.config.StatefulSetPinning || !ok {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.nodes[key] = nodeName
+}
+
+// Returns the node the ordinal of the pod was last bound to
+func (p *ordinalPins) node(pod kubernetes.KubePod) (string, bool) {
+	key, ok := ordinalKey(pod)
+	if !ok {
+		return "", false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	node, ok := p.nodes[key]
+	return node, ok
+}
+
+// Unpins the ordinals bound to a deleted node, their pods go to the best node again
+func (p *ordinalPins) removeNode(nodeName string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for key, node := range p.nodes {
+		if node == nodeName {
+			delete(p.nodes, key)
+		}
+	}
+}
+
+// Returns the pinned ordinals
+func (p *ordinalPins) snapshot() map[string]string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	saved := map[string]string{}
+	for key, node := range p.nodes {
+		saved[key] = node
+	}
+	return saved
+}
+
+// Restores the saved pins of the ordinals bound to no node since the start
+func (p *ordinalPins) restore(saved map[string]string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for key, node := range saved {
+		if _, ok := p.nodes[key]; !ok {
+			p.nodes[key] = node
+		}
+	}
+}
+
+// Leaves out the other candidates when the node the StatefulSet ordinal was last bound to passed
+// the filters, so the pod finds its local storage again. Otherwise the pod goes elsewhere and the
+// ordinal is pinned to its new node.
+func preferPinnedNode(state *cycleState, candidates []string, rejected map[string]error) []string {
+	if !state.scheduler.config.StatefulSetPinning {
+		return candidates
+	}
+	pinned, ok := state.scheduler.pins.node(state.pod)
+	if !ok {
+		return candidates
+	}
+	found := false
+	for _, name := range candidates {
+		found = found || name == pinned
+	}
+	if !found {
+		return candidates
+	}
+	for _, name := range candidates {
+		if name != pinned {
+			rejected[name] = filterError{statefulSetPinningFilter, fmt.Errorf("the ordinal was placed on %s", pinned)}
+		}
+	}
+	return []string{pinned}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Placement query: the pod to place, or only its requests, namespace and labels
+type placementQuery struct {
+	Pod       *kubernetes.KubePod `json:"pod,omitempty"`
+	Requests  map[string]string   `json:"requests,omitempty"`
+	Namespace string              `json:"namespace,omitempty"`
+	Labels    map[string]string   `json:"labels,omitempty"`
+	// Profile scoring the nodes, the profile matching the pod by default
+	Profile string `json:"profile,omitempty"`
+}
+
+// Placement answer: the nodes passing the filters from the best to the worst and the rejected ones
+type placementResult struct {
+	Profile  string            `json:"profile"`
+	Nodes    []rankedNode      `json:"nodes"`
+	Rejected map[string]string `json:"rejected"`
+}
+
+var noPlacementProfile = errors.New("no profile matches the pod")
+
+// Answers POST /v1/placement with the ranking of the nodes for the pod of the query,
+// filtered and scored like a scheduling attempt but without reserving or binding anything
+func (s *Scheduler) placementHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "only POST is allowed"})
+		return
+	}
+	var query placementQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	pod, err := query.pod()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	profile, err := query.profile(&s.profiles, pod)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.SchedulingTimeout)
+	defer cancel()
+	writeJSON(w, http.StatusOK, s.placeNodes(ctx, profile, pod))
+}
+
+// Answers GET /debug/explain/NAMESPACE/NAME with the ranking of the nodes for a pending pod read
+// from the api server, like a placement query with the pod
+func (s *Scheduler) explainPodHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/debug/explain/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected /debug/explain/NAMESPACE/NAME"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.SchedulingTimeout)
+	defer cancel()
+	pod, err := s.kubeAPI.GetPod(ctx, parts[0], parts[1])
+	if statusError, ok := err.(*kubernetes.StatusError); ok && statusError.Code == http.StatusNotFound {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("pod %s/%s not found", parts[0], parts[1])})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	if pod.Spec.NodeName != "" {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("pod is already assigned to node %s", pod.Spec.NodeName)})
+		return
+	}
+	profile, err := placementQuery{}.profile(&s.profiles, pod)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.placeNodes(ctx, profile, pod))
+}
+
+// Returns the pod of the query, built from its requests if no pod is given
+func (q placementQuery) pod() (pod kubernetes.KubePod, err error) {
+	if q.Pod != nil {
+		if len(q.Requests) > 0 {
+			return pod, errors.New("pod and requests are exclusive")
+		}
+		return *q.Pod, nil
+	}
+	for name, value := range q.Requests {
+		if _, err = kubernetes.ParseQuantity(value); err != nil {
+			return pod, fmt.Errorf("request %s: %s", name, err)
+		}
+	}
+	// The containers of a pod are anonymous structs, the pod is decoded like one sent by the api server
+	spec, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "placement", "namespace": q.Namespace, "labels": q.Labels},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "placement", "resources": map[string]interface{}{"requests": q.Requests}},
+			},
+		},
+	})
+	if err == nil {
+		err = json.Unmarshal(spec, &pod)
+	}
+	return
+}
+
+// Returns the profile named by the query, or the one matching the pod. A pod without a
+// scheduler name is matched as if it asked for the scheduler of the first profile.
+func (q placementQuery) profile(profiles *profileSet, pod kubernetes.KubePod) (*Profile, error) {
+	all := profiles.all()
+	if q.Profile != "" {
+		for _, profile := range all {
+			if profile.Name == q.Profile {
+				return profile, nil
+			}
+		}
+		return nil, fmt.Errorf("profile %q is not defined", q.Profile)
+	}
+	if pod.Spec.SchedulerName == "" && len(all) > 0 {
+		pod.Spec.SchedulerName = all[0].SchedulerName
+	}
+	if profile := profiles.forPod(pod); profile != nil {
+		return profile, nil
+	}
+	return nil, noPlacementProfile
+}
+
+// Filters and scores the available nodes for the pod, and ranks them for the profile strategy
+func (s *Scheduler) placeNodes(ctx context.Context, profile *Profile, pod kubernetes.KubePod) (result placementResult) {
+	profile = profile.forQoSClass(pod)
+	result = placementResult{Profile: profile.Name, Nodes: []rankedNode{}, Rejected: map[string]string{}}
+	candidates, rejected := s.filterNodes(ctx, pod, s.nodesAvailable(ctx))
+	for name, reason := range rejected {
+		result.Rejected[name] = reason.Error()
+	}
+	if len(candidates) > 0 {
+		result.Nodes = rankNodes(profile, s.scoreNodes(ctx, profile, pod, candidates))
+	}
+	return
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+)
+
+// Api path of the SchedulingPolicy custom resources, see deploy/schedulingpolicy-crd.yaml
+const schedulingPoliciesAPI = "apis/scheduling.sysdig.com/v1alpha1/schedulingpolicies"
+
+type schedulingPolicyEvent struct {
+	Type   string           `json:"type"`
+	Object schedulingPolicy `json:"object"`
+}
+
+// SchedulingPolicy custom resource, every policy becomes a profile
+type schedulingPolicy struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		SchedulerName string `json:"schedulerName"`
+		Strategy      string `json:"strategy"`
+		Fallback      string `json:"fallback"`
+		Metrics       []struct {
+			Name        string   `json:"name"`
+			Weight      float64  `json:"weight"`
+			Normalize   string   `json:"normalize"`
+			Min         float64  `json:"min"`
+			Max         float64  `json:"max"`
+			RejectAbove *float64 `json:"rejectAbove"`
+			RejectBelow *float64 `json:"rejectBelow"`
+		} `json:"metrics"`
+		Namespaces struct {
+			Allow []string `json:"allow"`
+			Deny  []string `json:"deny"`
+		} `json:"namespaces"`
+		PodSelector   *kubernetes.KubeLabelSelector `json:"podSelector"`
+		ZoneBalancing bool                          `json:"zoneBalancing"`
+	} `json:"spec"`
+}
+
+// Returns the namespace/name of the policy
+func (p schedulingPolicy) key() string {
+	return p.Metadata.Namespace + "/" + p.Metadata.Name
+}
+
+// Converts the policy to a profile reading the metrics from the provider
+func (p schedulingPolicy) profile(provider metrics.Provider) (*Profile, error) {
+	profile := &Profile{
+		Name:          "policy:" + p.key(),
+		SchedulerName: p.Spec.SchedulerName,
+		Strategy:      p.Spec.Strategy,
+		Fallback:      p.Spec.Fallback,
+		Namespaces:    NamespaceFilter{Allow: p.Spec.Namespaces.Allow, Deny: p.Spec.Namespaces.Deny},
+		PodSelector:   p.Spec.PodSelector,
+		ZoneBalancing: p.Spec.ZoneBalancing,
+		provider:      provider,
+	}
+	for _, metric := range p.Spec.Metrics {
+		profile.Metrics = append(profile.Metrics, MetricConfig{Name: metric.Name, Weight: metric.Weight, Normalize: metric.Normalize, Min: metric.Min, Max: metric.Max,
+			RejectAbove: metric.RejectAbove, RejectBelow: metric.RejectBelow})
+	}
+	return profile, profile.init()
+}
+
+// Keeps the profiles of the SchedulingPolicy resources up to date until the context is done.
+// The policies read their metrics from the provider of the configuration.
+func (s *Scheduler) watchPolicies(ctx context.Context) {
+	provider, err := s.newProvider(s.config.Provider)
+	if err != nil {
+		log.Println("error while creating the policies provider:", err)
+		return
+	}
+
+	for ctx.Err() == nil {
+		ch, err := s.kubeAPI.Watch(ctx, "GET", schedulingPoliciesAPI, nil, nil)
+		if err != nil {
+			log.Println("error while watching the scheduling policies:", err)
+		} else {
+			for data := range ch {
+				s.handlePolicyEvent(data, provider)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Applies a change of a SchedulingPolicy
+func (s *Scheduler) handlePolicyEvent(data []byte, provider metrics.Provider) {
+	event := schedulingPolicyEvent{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Println("error while decoding a scheduling policy event:", err)
+		return
+	}
+
+	switch event.Type {
+	case "ADDED", "MODIFIED":
+		profile, err := event.Object.profile(provider)
+		if err != nil {
+			log.Printf("rejecting scheduling policy %s: %s", event.Object.key(), err)
+			s.profiles.deletePolicy(event.Object.key())
+			return
+		}
+		profile.setProvider(s, provider)
+		log.Printf("applying scheduling policy %s", event.Object.key())
+		s.profiles.setPolicy(event.Object.key(), profile)
+	case "DELETED":
+		log.Printf("removing scheduling policy %s", event.Object.key())
+		s.profiles.deletePolicy(event.Object.key())
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Reads the node again and returns why it can no longer take the pod: not Ready, cordoned, or
+// past a threshold of the profile with fresh metrics. Metrics that can't be read don't reject it.
+func (s *Scheduler) validateNode(ctx context.Context, profile *Profile, nodeName string) error {
+	node, err := s.kubeAPI.GetNode(ctx, nodeName)
+	if err != nil {
+		return err
+	}
+	if node.Spec.Unschedulable {
+		return errors.New("was cordoned")
+	}
+	if len(onlyReady([]kubernetes.KubeNode{node})) == 0 {
+		return errors.New("is no longer Ready")
+	}
+	profile = profile.forNode(node)
+	if !profile.hasThresholds() {
+		return nil
+	}
+	values, err := s.fetchMetrics(ctx, profile, nodeName)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Printf("Metrics of %s not checked before the binding: %s", nodeName, err)
+		return nil
+	}
+	list := NodeList{{name: nodeName, metrics: values}}
+	applyThresholds(profile, list)
+	return list[0].err
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Lower priority pods to evict from a node so the preemptor fits
+type preemptionPlan struct {
+	node    string
+	victims []kubernetes.KubePod
+}
+
+// Returns the priority resolved from the PriorityClass of the pod at admission, 0 if it has none
+func podPriority(pod kubernetes.KubePod) int {
+	if pod.Spec.Priority == nil {
+		return 0
+	}
+	return *pod.Spec.Priority
+}
+
+// Frees a node for the pod by evicting lower priority pods, then waits for them to be gone.
+// Only the nodes rejected for their resources are candidates, and among the ones where the
+// victims don't break a disruption budget the best by the profile metrics is chosen.
+func (s *Scheduler) preempt(ctx context.Context, profile *Profile, pod kubernetes.KubePod, rejected map[string]error) (nodeName string, err error) {
+	if pod.Spec.PreemptionPolicy == "Never" {
+		return "", errors.New("the preemption policy of the pod is Never")
+	}
+	if !s.features.enabled(featurePreemption, pod.Metadata.Namespace) {
+		return "", errors.New("preemption is disabled by its feature flag")
+	}
+
+	var candidates []string
+	for name, reason := range rejected {
+		if reason, ok := reason.(filterError); ok && reason.filter == resourcesFitFilter {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", failure.New(failure.NoNodeFound, failure.Preemption, "no node found")
+	}
+
+	budgets, err := s.kubeAPI.ListPodDisruptionBudgets(ctx)
+	if err != nil {
+		return
+	}
+
+	state := s.newCycleState(ctx, pod, s.nodesAvailable(ctx))
+	plans := map[string]preemptionPlan{}
+	var names []string
+	for _, name := range candidates {
+		node, _ := state.node(name)
+		if plan, ok := selectVictims(state, budgets, node); ok {
+			plans[name] = plan
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", errors.New("no node can fit the pod by preempting lower priority pods")
+	}
+
+	best, err := s.bestPreemptionNode(ctx, profile, pod, names)
+	if err != nil {
+		return "", err
+	}
+	plan := plans[best]
+	log.Printf("Preempting %d pods on %s for %s", len(plan.victims), plan.node, pod.Metadata.Name)
+
+	if err := s.kubeAPI.NominatePod(ctx, pod.Metadata.Namespace, pod.Metadata.Name, plan.node); err != nil {
+		log.Println("error while setting the nominated node:", err)
+	}
+	previewed := false
+	for i, victim := range plan.victims {
+		preview, err := s.evictPod(ctx, victim, budgets, plan.victims[:i], "to preempt it for "+pod.Metadata.Namespace+"/"+pod.Metadata.Name)
+		if err != nil {
+			return "", err
+		}
+		previewed = previewed || preview
+	}
+	if previewed {
+		return "", errors.New("dry run, the victims were not evicted")
+	}
+
+	err = s.waitForDeletion(ctx, plan.victims)
+	return plan.node, err
+}
+
+// Finds the lower priority pods to remove from the node so the pod fits, keeping as many as possible
+// like kube-scheduler: all of them are removed, then added back by decreasing priority while the pod
+// still fits, the ones protected by a disruption budget first. Returns false if the pod can't fit
+// or a victim would break a disruption budget.
+func selectVictims(state *cycleState, budgets []kubernetes.KubePodDisruptionBudget, node kubernetes.KubeNode) (plan preemptionPlan, ok bool) {
+	pods, err := state.assignedPods()
+	if err != nil {
+		return
+	}
+	requested, err := state.requestedOn(node.Metadata.Name)
+	if err != nil {
+		return
+	}
+
+	free := parseResourceList(node.Status.Allocatable)
+	free.sub(requested)
+	priority := podPriority(state.pod)
+	var lower []kubernetes.KubePod
+	for _, other := range pods {
+		if other.Spec.NodeName == node.Metadata.Name && podPriority(other) < priority && state.scheduler.preemptible(other) {
+			lower = append(lower, other)
+			free.add(podRequests(other))
+		}
+	}
+
+	requests := state.fitRequests()
+	if len(lower) == 0 || !free.fits(requests) {
+		return
+	}
+
+	sort.SliceStable(lower, func(i, j int) bool {
+		return podPriority(lower[i]) > podPriority(lower[j])
+	})
+	protected, unprotected := splitByBudgets(lower, budgets)
+
+	plan.node = node.Metadata.Name
+	for _, group := range [][]kubernetes.KubePod{protected, unprotected} {
+		for _, other := range group {
+			otherRequests := podRequests(other)
+			free.sub(otherRequests)
+			if free.fits(requests) {
+				continue
+			}
+			free.add(otherRequests)
+			plan.victims = append(plan.victims, other)
+		}
+	}
+
+	// The eviction api would refuse the protected victims anyway
+	protectedVictims, _ := splitByBudgets(plan.victims, budgets)
+	return plan, len(protectedVictims) == 0
+}
+
+// Returns true if the pod can be a victim: only the pods of our scheduler names, unless the
+// configuration allows preempting the pods of the other schedulers, without a do-not-evict annotation
+func (s *Scheduler) preemptible(pod kubernetes.KubePod) bool {
+	if _, protected := s.doNotEvict(pod); protected {
+		return false
+	}
+	return s.config.PreemptOtherSchedulers || s.profiles.serves(pod.Spec.SchedulerName)
+}
+
+// Splits the pods between the ones whose eviction would break a disruption budget, counting the
+// earlier pods of the list as already evicted, and the others
+func splitByBudgets(pods []kubernetes.KubePod, budgets []kubernetes.KubePodDisruptionBudget) (protected, unprotected []kubernetes.KubePod) {
+	allowed := make([]int, len(budgets))
+	for i, budget := range budgets {
+		allowed[i] = budget.Status.DisruptionsAllowed
+	}
+
+	for _, pod := range pods {
+		breaks := false
+		for i, budget := range budgets {
+			if budget.Metadata.Namespace != pod.Metadata.Namespace || !budget.Spec.Selector.Matches(pod.Metadata.Labels) {
+				continue
+			}
+			allowed[i]--
+			if allowed[i] < 0 {
+				breaks = true
+			}
+		}
+		if breaks {
+			protected = append(protected, pod)
+		} else {
+			unprotected = append(unprotected, pod)
+		}
+	}
+	return
+}
+
+// Returns the best node by the profile metrics. Without metrics, the node is chosen by the fallback
+// of the profile among the nodes not past a threshold, like a pod without preemption, and none is
+// returned when the pods are handed over to the default scheduler or every node is past a threshold.
+func (s *Scheduler) bestPreemptionNode(ctx context.Context, profile *Profile, pod kubernetes.KubePod, names []string) (string, error) {
+	list := s.scoreNodes(ctx, profile, pod, names)
+	var scored NodeList
+	for _, node := range list {
+		if node.err == nil {
+			scored = append(scored, node)
+		}
+	}
+	if best, err := bestNodeFromList(profile, scored); err == nil {
+		return best.name, nil
+	}
+	if overThresholds(list) {
+		return "", failure.New(failure.ThresholdReached, failure.Preemption, "every node that can be freed is past a threshold")
+	}
+	fallbacks := s.fallbackCandidates(profile, pod, names, list)
+	if len(fallbacks) == 0 {
+		return "", failure.New(failure.NoNodeFound, failure.Preemption, "no node that can be freed has metrics")
+	}
+	node, err := s.fallbackNode(ctx, profile, fallbacks)
+	return node.name, err
+}
+
+// Waits until the pods are deleted or replaced by new pods with the same name
+func (s *Scheduler) waitForDeletion(ctx context.Context, pods []kubernetes.KubePod) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for _, pod := range pods {
+		for {
+			current, err := s.kubeAPI.GetPod(ctx, pod.Metadata.Namespace, pod.Metadata.Name)
+			if statusError, ok := err.(*kubernetes.StatusError); ok && statusError.Code == 404 {
+				break
+			}
+			if err == nil && current.Metadata.UID != pod.Metadata.UID {
+				break
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return fmt.Errorf("waiting for %s/%s to terminate: %s", pod.Metadata.Namespace, pod.Metadata.Name, ctx.Err())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Returns a pod of the default namespace on the node with the priority, requesting the cpu
+func podOn(t *testing.T, name, nodeName string, priority int, cpu string, labels map[string]string) kubernetes.KubePod {
+	t.Helper()
+	pod := testPod("default", name, labels, nil)
+	spec := `{"containers": [{"name": "main", "resources": {"requests": {"cpu": "` + cpu + `"}}}]}`
+	if err := json.Unmarshal([]byte(spec), &pod.Spec); err != nil {
+		t.Fatal(err)
+	}
+	pod.Spec.NodeName = nodeName
+	pod.Spec.Priority = &priority
+	return pod
+}
+
+func podNames(pods []kubernetes.KubePod) (names []string) {
+	for _, pod := range pods {
+		names = append(names, pod.Metadata.Name)
+	}
+	return
+}
+
+func TestSplitByBudgets(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	pods := []kubernetes.KubePod{
+		testPod("default", "web-1", web, nil),
+		testPod("default", "db-1", map[string]string{"app": "db"}, nil),
+		testPod("default", "web-2", web, nil),
+		testPod("other", "web-1", web, nil),
+		testPod("default", "web-3", web, nil),
+	}
+	tests := []struct {
+		name        string
+		budgets     []kubernetes.KubePodDisruptionBudget
+		protected   []string
+		unprotected []string
+	}{
+		{name: "without budgets", unprotected: []string{"web-1", "db-1", "web-2", "web-1", "web-3"}},
+		{
+			name:        "no disruption allowed",
+			budgets:     []kubernetes.KubePodDisruptionBudget{testBudget("default", 0, web)},
+			protected:   []string{"web-1", "web-2", "web-3"},
+			unprotected: []string{"db-1", "web-1"},
+		},
+		{
+			name:        "earlier pods counted as evicted",
+			budgets:     []kubernetes.KubePodDisruptionBudget{testBudget("default", 2, web)},
+			protected:   []string{"web-3"},
+			unprotected: []string{"web-1", "db-1", "web-2", "web-1"},
+		},
+		{
+			name: "every budget of the pod",
+			budgets: []kubernetes.KubePodDisruptionBudget{
+				testBudget("default", 5, web),
+				testBudget("default", 1, map[string]string{"app": "web"}),
+			},
+			protected:   []string{"web-2", "web-3"},
+			unprotected: []string{"web-1", "db-1", "web-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			protected, unprotected := splitByBudgets(pods, test.budgets)
+			if names := podNames(protected); !reflect.DeepEqual(names, test.protected) {
+				t.Errorf("protected %v, want %v", names, test.protected)
+			}
+			if names := podNames(unprotected); !reflect.DeepEqual(names, test.unprotected) {
+				t.Errorf("unprotected %v, want %v", names, test.unprotected)
+			}
+		})
+	}
+}
+
+func TestSelectVictims(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	var node kubernetes.KubeNode
+	node.Metadata.Name = "node-1"
+	node.Status.Allocatable = map[string]string{"cpu": "4", "pods": "110"}
+
+	tests := []struct {
+		name    string
+		others  bool // The pods of the other schedulers can be preempted
+		pod     kubernetes.KubePod
+		pods    []kubernetes.KubePod
+		budgets []kubernetes.KubePodDisruptionBudget
+		victims []string
+		ok      bool
+	}{
+		{
+			name:    "fewest victims",
+			others:  true,
+			pod:     podOn(t, "pending", "", 10, "2", nil),
+			pods:    []kubernetes.KubePod{podOn(t, "small", "node-1", 0, "1", nil), podOn(t, "large", "node-1", 0, "2", nil), podOn(t, "high", "node-1", 100, "1", nil)},
+			victims: []string{"large"},
+			ok:      true,
+		},
+		{
+			name:    "higher priorities kept first",
+			others:  true,
+			pod:     podOn(t, "pending", "", 10, "2", nil),
+			pods:    []kubernetes.KubePod{podOn(t, "low", "node-1", 1, "2", nil), podOn(t, "medium", "node-1", 5, "2", nil)},
+			victims: []string{"low"},
+			ok:      true,
+		},
+		{
+			name:   "pods of other nodes",
+			others: true,
+			pod:    podOn(t, "pending", "", 10, "2", nil),
+			pods:   []kubernetes.KubePod{podOn(t, "high", "node-1", 100, "4", nil), podOn(t, "low", "node-2", 0, "2", nil)},
+		},
+		{
+			name:   "not fitting without the lower priority pods",
+			others: true,
+			pod:    podOn(t, "pending", "", 10, "5", nil),
+			pods:   []kubernetes.KubePod{podOn(t, "low", "node-1", 0, "1", nil)},
+		},
+		{
+			name: "pods of other schedulers",
+			pod:  podOn(t, "pending", "", 10, "2", nil),
+			pods: []kubernetes.KubePod{podOn(t, "low", "node-1", 0, "4", nil)},
+		},
+		{
+			name:    "protected pods kept first",
+			others:  true,
+			pod:     podOn(t, "pending", "", 10, "2", nil),
+			pods:    []kubernetes.KubePod{podOn(t, "web-1", "node-1", 1, "2", web), podOn(t, "web-2", "node-1", 1, "2", web)},
+			budgets: []kubernetes.KubePodDisruptionBudget{testBudget("default", 1, web)},
+			victims: []string{"web-1"},
+			ok:      true,
+		},
+		{
+			name:    "victim breaking a budget",
+			others:  true,
+			pod:     podOn(t, "pending", "", 10, "2", nil),
+			pods:    []kubernetes.KubePod{podOn(t, "web-1", "node-1", 1, "2", web), podOn(t, "web-2", "node-1", 1, "2", web)},
+			budgets: []kubernetes.KubePodDisruptionBudget{testBudget("default", 0, web)},
+			victims: []string{"web-2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testScheduler(Config{PreemptOtherSchedulers: test.others})
+			state := s.newCycleState(context.Background(), test.pod, []kubernetes.KubeNode{node})
+			state.pods, state.podsLoaded = test.pods, true
+
+			plan, ok := selectVictims(state, test.budgets, node)
+			if ok != test.ok {
+				t.Fatalf("selectVictims() ok = %v, want %v", ok, test.ok)
+			}
+			if names := podNames(plan.victims); test.victims != nil && !reflect.DeepEqual(names, test.victims) {
+				t.Errorf("victims %v, want %v", names, test.victims)
+			}
+			if ok && plan.node != "node-1" {
+				t.Errorf("plan for node %q", plan.node)
+			}
+		})
+	}
+}
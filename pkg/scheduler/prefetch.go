@@ -0,0 +1,145 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Prefetched metric values are used while younger than this many prefetch intervals
+const prefetchMaxAgeIntervals = 3
+
+// Metric values of the ready nodes, read in the background so the pods are scored from memory
+type prefetchedMetrics struct {
+	mutex  sync.RWMutex
+	values map[string]prefetchedValues
+}
+
+type prefetchedValues struct {
+	metrics []float64
+	time    time.Time
+}
+
+// Returns a copy of the values of the node if they are younger than maxAge
+func (p *prefetchedMetrics) get(nodeName string, maxAge time.Duration) ([]float64, bool) {
+	if p == nil {
+		return nil, false
+	}
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	values, ok := p.values[nodeName]
+	if !ok || time.Since(values.time) > maxAge {
+		return nil, false
+	}
+	// The scorers append their values to the metrics
+	return append([]float64(nil), values.metrics...), true
+}
+
+// Forgets the values of the node, read again by the next prefetch or pod
+func (p *prefetchedMetrics) remove(nodeName string) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.values, nodeName)
+}
+
+// Refreshes the values of the ready nodes every prefetch interval of the profile, until the context is done
+func (s *Scheduler) prefetchLoop(ctx context.Context, profile *Profile) {
+	ticker := time.NewTicker(profile.PrefetchInterval)
+	defer ticker.Stop()
+	for {
+		s.prefetch(ctx, profile)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reads the metrics of all the ready nodes, together with a batch provider and otherwise at most
+// MetricsConcurrency at the same time. The nodes that failed keep their previous values until
+// they are too old, the nodes that are gone are dropped.
+func (s *Scheduler) prefetch(ctx context.Context, profile *Profile) {
+	nodes := s.nodesAvailable(ctx)
+	start := time.Now()
+
+	wg := sync.WaitGroup{}
+	semaphore := make(chan struct{}, s.config.MetricsConcurrency)
+	results := make(chan prefetchResult, len(nodes))
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.Metadata.Name)
+	}
+	batched := s.fetchBatch(ctx, profile, names)
+	for _, node := range nodes {
+		if values, ok := batched[node.Metadata.Name]; ok {
+			results <- prefetchResult{node.Metadata.Name, values, nil}
+			continue
+		}
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		wg.Add(1)
+		go func(nodeName string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			values, err := s.fetchMetrics(ctx, profile, nodeName)
+			results <- prefetchResult{nodeName, values, err}
+		}(node.Metadata.Name)
+	}
+	wg.Wait()
+	close(results)
+
+	current := map[string]bool{}
+	failed := 0
+	profile.prefetched.mutex.Lock()
+	for result := range results {
+		current[result.node] = true
+		if result.err != nil {
+			failed++
+			continue
+		}
+		profile.prefetched.values[result.node] = prefetchedValues{metrics: result.metrics, time: time.Now()}
+	}
+	for name := range profile.prefetched.values {
+		if !current[name] {
+			delete(profile.prefetched.values, name)
+		}
+	}
+	profile.prefetched.mutex.Unlock()
+
+	if failed > 0 {
+		log.Printf("Prefetch for profile %s: %d of %d nodes failed", profile.Name, failed, len(nodes))
+	}
+	if elapsed := time.Since(start); elapsed > profile.PrefetchInterval {
+		log.Printf("Prefetch for profile %s took %s, longer than its interval of %s", profile.Name, elapsed, profile.PrefetchInterval)
+	}
+}
+
+type prefetchResult struct {
+	node    string
+	metrics []float64
+	err     error
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Checks the reservation and sets its default resources
+func (r *PriorityReservationConfig) validate() error {
+	if r.Selector == nil {
+		return fmt.Errorf("the node selector must be set")
+	}
+	if r.Fraction <= 0 || r.Fraction >= 1 {
+		return fmt.Errorf("the fraction must be between 0 and 1")
+	}
+	if r.MinPriority == nil && len(r.PriorityClasses) == 0 {
+		return fmt.Errorf("minPriority or priorityClasses must be set")
+	}
+	if len(r.Resources) == 0 {
+		r.Resources = []string{"cpu", "memory"}
+	}
+	return nil
+}
+
+// Returns true if the pod can use the reserved headroom, by its priority class or its priority
+func (r PriorityReservationConfig) admits(pod kubernetes.KubePod) bool {
+	for _, class := range r.PriorityClasses {
+		if pod.Spec.PriorityClassName == class {
+			return true
+		}
+	}
+	return r.MinPriority != nil && podPriority(pod) >= *r.MinPriority
+}
+
+// Rejects the nodes where the pod would dip into the headroom of the first priority reservation
+// matching the node, unless the pod is admitted to it. The headroom is the fraction of the
+// allocatable resources left free after the pods assigned and being bound.
+func priorityReservationFilter(state *cycleState, node kubernetes.KubeNode) error {
+	for _, reservation := range state.scheduler.config.PriorityReservations {
+		if !reservation.Selector.Matches(node.Metadata.Labels) {
+			continue
+		}
+		if reservation.admits(state.pod) {
+			return nil
+		}
+		requested, err := state.requestedOn(node.Metadata.Name)
+		if err != nil {
+			return err
+		}
+		allocatable := parseResourceList(node.Status.Allocatable)
+		requests := state.fitRequests()
+		for _, name := range reservation.Resources {
+			if requests[name] <= 0 || allocatable[name] <= 0 {
+				continue
+			}
+			if allocatable[name]-requested[name]-requests[name] < allocatable[name]*reservation.Fraction {
+				return fmt.Errorf("%s would dip into the %g%% reserved for the high priority pods", name, reservation.Fraction*100)
+			}
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// The profiles of the configuration, plus the ones defined by SchedulingPolicy resources,
+// which can change at any time
+type profileSet struct {
+	scheduler *Scheduler
+	mutex     sync.RWMutex
+	static    []*Profile
+	policies  map[string]*Profile // Indexed by policy namespace/name
+}
+
+// Returns the first profile matching the pod, configuration profiles first and then the
+// policies in name order, replaced by the profile of its NodePool or the candidate profile of
+// its experiment. Nil if none matches.
+func (s *profileSet) forPod(pod kubernetes.KubePod) *Profile {
+	for _, profile := range s.all() {
+		if profile.matches(pod) {
+			return s.scheduler.experimentProfile(s.scheduler.nodePoolProfile(profile, pod), pod)
+		}
+	}
+	return nil
+}
+
+// Returns all the profiles in matching order
+func (s *profileSet) all() (all []*Profile) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	all = append(all, s.static...)
+	names := make([]string, 0, len(s.policies))
+	for name := range s.policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		all = append(all, s.policies[name])
+	}
+	return
+}
+
+// Returns the configuration profile in use with the name, nil if there is none
+func (s *profileSet) staticByName(name string) *Profile {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, profile := range s.static {
+		if profile.Name == name {
+			return profile
+		}
+	}
+	return nil
+}
+
+// Returns the profile of the policy with the namespace/name, nil if there is none
+func (s *profileSet) policyByName(name string) *Profile {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.policies[name]
+}
+
+// Replaces the configuration profile with the same name, the attempts in flight keep the previous one
+func (s *profileSet) setStatic(profile *Profile) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, current := range s.static {
+		if current.Name == profile.Name {
+			s.static[i] = profile
+		}
+	}
+}
+
+// Adds or replaces the profile of a policy
+func (s *profileSet) setPolicy(name string, profile *Profile) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.policies == nil {
+		s.policies = map[string]*Profile{}
+	}
+	s.policies[name] = profile
+}
+
+// Removes the profile of a policy
+func (s *profileSet) deletePolicy(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.policies, name)
+}
+
+// Returns true if the pod is handled by the profile: same scheduler name, allowed
+// namespace and labels matching the pod selector if there is one
+func (p *Profile) matches(pod kubernetes.KubePod) bool {
+	if pod.Spec.SchedulerName != p.SchedulerName || !p.Namespaces.allowed(pod.Metadata.Namespace) {
+		return false
+	}
+	return p.PodSelector == nil || p.PodSelector.Matches(pod.Metadata.Labels)
+}
+
+// Returns true if the profile handles all the pods of its scheduler name
+func (p *Profile) matchesAll() bool {
+	return len(p.Namespaces.Allow) == 0 && len(p.Namespaces.Deny) == 0 && p.PodSelector == nil
+}
+
+// Returns true if a profile has the scheduler name
+func (s *profileSet) serves(schedulerName string) bool {
+	for _, profile := range s.all() {
+		if profile.SchedulerName == schedulerName {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the pod has the opt-in label of the configuration, or if none is required
+func (s *Scheduler) optedIn(pod kubernetes.KubePod) bool {
+	return s.config.OptInLabel == "" || pod.Metadata.Labels[s.config.OptInLabel] == "true"
+}
@@ -0,0 +1,474 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/cache"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+	"github.com/draios/kubernetes-scheduler/pkg/sysdig"
+)
+
+// Metric provider types
+const (
+	providerSysdig         = "sysdig"
+	providerMetricsServer  = "metrics-server"
+	providerKubeletSummary = "kubelet-summary"
+	providerCustomMetrics  = "custom-metrics"
+	providerDatadog        = "datadog"
+	providerInfluxDB       = "influxdb"
+	providerStatic         = "static"
+	providerScrape         = "scrape"
+	providerGoogleCloud    = "google-cloud"
+	providerCloudWatch     = "cloudwatch"
+	providerAzureMonitor   = "azure-monitor"
+)
+
+// Checks that the provider type is known
+func (c ProviderConfig) validate() error {
+	if c.Hostname != nil {
+		if err := c.Hostname.validate(); err != nil {
+			return fmt.Errorf("hostname: %s", err)
+		}
+	}
+	if c.ResponseCache != nil {
+		if c.ResponseCache.TTL <= 0 {
+			return fmt.Errorf("response cache: the ttl must be positive")
+		}
+		if c.Type != "" && c.Type != providerSysdig && c.Type != providerInfluxDB {
+			return fmt.Errorf("response cache: only the %s and %s providers can keep their answers", providerSysdig, providerInfluxDB)
+		}
+	}
+	switch c.Type {
+	case "", providerSysdig:
+		if c.Sysdig != nil {
+			switch c.Sysdig.Aggregation {
+			case "", metrics.AggregationAvg, metrics.AggregationMin, metrics.AggregationMax, metrics.AggregationP95, metrics.AggregationLast:
+			default:
+				return fmt.Errorf("sysdig provider: unknown aggregation %q", c.Sysdig.Aggregation)
+			}
+			switch c.Sysdig.SegmentAggregation {
+			case "", metrics.AggregationAvg, metrics.AggregationMin, metrics.AggregationMax, metrics.AggregationSum:
+			default:
+				return fmt.Errorf("sysdig provider: unknown segment aggregation %q", c.Sysdig.SegmentAggregation)
+			}
+			switch c.Sysdig.DataSource {
+			case "", "host", "container":
+			default:
+				return fmt.Errorf("sysdig provider: unknown data source %q", c.Sysdig.DataSource)
+			}
+			if _, err := template.New("filter").Parse(c.Sysdig.Filter); err != nil {
+				return fmt.Errorf("sysdig provider: invalid filter: %s", err)
+			}
+			if c.Sysdig.Batch && c.Sysdig.Filter != "" {
+				return fmt.Errorf("sysdig provider: batch can't be used with a filter")
+			}
+			if c.Sysdig.Window%time.Second != 0 || c.Sysdig.Sampling%time.Second != 0 {
+				return fmt.Errorf("sysdig provider: the window and the sampling must be whole seconds")
+			}
+			if c.Sysdig.MaxAge > 0 && (c.Sysdig.Sampling <= 0 || c.Sysdig.Sampling >= c.Sysdig.MaxAge) {
+				// With a single datapoint for the whole window its age tells nothing
+				return fmt.Errorf("sysdig provider: maxAge needs a sampling shorter than it")
+			}
+			for _, account := range c.Sysdig.Accounts {
+				if account.Region != "" && sysdig.Regions[account.Region] == "" {
+					return fmt.Errorf("sysdig provider: account %q: unknown region %q", account.Name, account.Region)
+				}
+				if account.Secret != nil && account.Secret.Name == "" {
+					return fmt.Errorf("sysdig provider: account %q: the secret name must be set", account.Name)
+				}
+				if account.URL != "" {
+					// IPv6 addresses must be in brackets, https://[fd00::10]:443
+					if _, err := url.ParseRequestURI(account.URL); err != nil {
+						return fmt.Errorf("sysdig provider: account %q: invalid url: %s", account.Name, err)
+					}
+				}
+				if (account.CertFile == "") != (account.KeyFile == "") {
+					return fmt.Errorf("sysdig provider: account %q: the certFile and the keyFile must be set together", account.Name)
+				}
+			}
+		}
+		return nil
+	case providerMetricsServer, providerKubeletSummary, providerCustomMetrics:
+		return nil
+	case providerStatic:
+		if c.Static == nil || len(c.Static.Values) == 0 {
+			return fmt.Errorf("static provider: the values must be set")
+		}
+		return nil
+	case providerDatadog:
+		if c.Datadog != nil && c.Datadog.Secret != nil && c.Datadog.Secret.Name == "" {
+			return fmt.Errorf("datadog provider: the secret name must be set")
+		}
+		return nil
+	case providerScrape:
+		if c.Scrape == nil || c.Scrape.URL == "" {
+			return fmt.Errorf("scrape provider: the url must be set")
+		}
+		if _, err := template.New("url").Parse(c.Scrape.URL); err != nil {
+			return fmt.Errorf("scrape provider: invalid url: %s", err)
+		}
+		if len(c.Scrape.Metrics) == 0 {
+			return fmt.Errorf("scrape provider: the metrics must be set")
+		}
+		for name, metric := range c.Scrape.Metrics {
+			if metric.Sample == "" {
+				return fmt.Errorf("scrape provider: metric %q: the sample must be set", name)
+			}
+			switch metric.Aggregation {
+			case "", metrics.AggregationSum, metrics.AggregationAvg, metrics.AggregationMin, metrics.AggregationMax, metrics.AggregationP95, metrics.AggregationStdDev:
+			default:
+				return fmt.Errorf("scrape provider: metric %q: unknown aggregation %q", name, metric.Aggregation)
+			}
+		}
+		return nil
+	case providerGoogleCloud:
+		if c.GoogleCloud == nil {
+			return nil
+		}
+		for name, query := range c.GoogleCloud.Queries {
+			if _, err := template.New("query").Parse(query); err != nil {
+				return fmt.Errorf("google-cloud provider: metric %q: invalid query: %s", name, err)
+			}
+		}
+		if _, err := template.New("filter").Parse(c.GoogleCloud.Filter); err != nil {
+			return fmt.Errorf("google-cloud provider: invalid filter: %s", err)
+		}
+		if c.GoogleCloud.Window%time.Second != 0 {
+			return fmt.Errorf("google-cloud provider: the window must be whole seconds")
+		}
+		return nil
+	case providerCloudWatch:
+		if c.CloudWatch == nil {
+			return nil
+		}
+		for name, metric := range c.CloudWatch.Metrics {
+			if metric.MetricName == "" {
+				return fmt.Errorf("cloudwatch provider: metric %q: the metric name must be set", name)
+			}
+			switch metric.Statistic {
+			case "", "Average", "Maximum", "Minimum", "Sum", "SampleCount":
+			default:
+				return fmt.Errorf("cloudwatch provider: metric %q: unknown statistic %q", name, metric.Statistic)
+			}
+			for key, dimension := range metric.Dimensions {
+				if _, err := template.New("dimension").Parse(dimension); err != nil {
+					return fmt.Errorf("cloudwatch provider: metric %q: invalid dimension %s: %s", name, key, err)
+				}
+			}
+		}
+		return nil
+	case providerAzureMonitor:
+		if c.AzureMonitor == nil {
+			return nil
+		}
+		for name, metric := range c.AzureMonitor.Metrics {
+			if metric.Name == "" {
+				return fmt.Errorf("azure-monitor provider: metric %q: the name must be set", name)
+			}
+			switch metric.Aggregation {
+			case "", "Average", "Maximum", "Minimum", "Total", "Count":
+			default:
+				return fmt.Errorf("azure-monitor provider: metric %q: unknown aggregation %q", name, metric.Aggregation)
+			}
+		}
+		return nil
+	case providerInfluxDB:
+		if c.InfluxDB == nil || c.InfluxDB.URL == "" {
+			return fmt.Errorf("influxdb provider: the url must be set")
+		}
+		switch c.InfluxDB.Version {
+		case 0, 1:
+			if c.InfluxDB.Database == "" {
+				return fmt.Errorf("influxdb provider: the database must be set with version 1")
+			}
+		case 2:
+			if c.InfluxDB.Org == "" {
+				return fmt.Errorf("influxdb provider: the org must be set with version 2")
+			}
+		default:
+			return fmt.Errorf("influxdb provider: unknown version %d", c.InfluxDB.Version)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown provider type %q", c.Type)
+}
+
+// Creates the metrics provider of a configuration
+func (s *Scheduler) newProvider(c ProviderConfig) (metrics.Provider, error) {
+	switch c.Type {
+	case "", providerSysdig:
+		provider := &metrics.SysdigProvider{Client: &s.sysdigAPI, Hostname: s.hostnameFunc(c.Hostname)}
+		if c.ResponseCache != nil {
+			// A copy with its own cache, the token source is shared
+			client := s.sysdigAPI
+			client.SetHTTPClient(c.cachedClient(client.HTTPClient()))
+			provider.Client = &client
+		}
+		if c.Sysdig != nil {
+			provider.Window, provider.Sampling, provider.Aggregation = c.Sysdig.Window, c.Sysdig.Sampling, c.Sysdig.Aggregation
+			provider.MaxAge = c.Sysdig.MaxAge
+			provider.Filter, provider.DataSource = c.Sysdig.Filter, c.Sysdig.DataSource
+			provider.TimeAggregation, provider.GroupAggregation = c.Sysdig.TimeAggregation, c.Sysdig.GroupAggregation
+			provider.SegmentBy, provider.SegmentAggregation = c.Sysdig.SegmentBy, c.Sysdig.SegmentAggregation
+			provider.Batch = c.Sysdig.Batch
+			if len(c.Sysdig.Accounts) > 0 {
+				clientFor, err := s.sysdigAccounts(c.Sysdig.Accounts, c.cachedClient)
+				if err != nil {
+					return nil, err
+				}
+				provider.ClientFor = clientFor
+			}
+		}
+		return provider, nil
+	case providerMetricsServer:
+		return &metrics.MetricsServerProvider{Kube: &s.kubeAPI}, nil
+	case providerKubeletSummary:
+		return &metrics.KubeletSummaryProvider{Kube: &s.kubeAPI}, nil
+	case providerCustomMetrics:
+		return &metrics.CustomMetricsProvider{Kube: &s.kubeAPI}, nil
+	case providerStatic:
+		return &metrics.StaticProvider{Values: c.Static.Values}, nil
+	case providerDatadog:
+		datadog := DatadogConfig{}
+		if c.Datadog != nil {
+			datadog = *c.Datadog
+		}
+		keys := s.credentials(datadog.Secret, []string{"api-key", "app-key"}, []string{"DD_API_KEY", "DD_APP_KEY"})
+		return &metrics.DatadogProvider{
+			Site:     datadog.Site,
+			Queries:  datadog.Queries,
+			Window:   datadog.Window,
+			Hostname: s.hostnameFunc(c.Hostname),
+			Keys: func(ctx context.Context) (apiKey, appKey string, err error) {
+				values, err := keys(ctx)
+				if err != nil {
+					return
+				}
+				return values[0], values[1], nil
+			},
+		}, nil
+	case providerScrape:
+		provider := &metrics.ScrapeProvider{
+			URL:      c.Scrape.URL,
+			Metrics:  map[string]metrics.ScrapeMetric{},
+			Hostname: s.hostnameFunc(c.Hostname),
+			Kube:     &s.kubeAPI,
+		}
+		for name, metric := range c.Scrape.Metrics {
+			provider.Metrics[name] = metrics.ScrapeMetric(metric)
+		}
+		if c.Scrape.CAFile != "" {
+			client, err := sysdig.NewHTTPClient(c.Scrape.CAFile, "", "", "")
+			if err != nil {
+				return nil, fmt.Errorf("scrape provider: %s", err)
+			}
+			client.Transport = wrapMetricFaults(client.Transport)
+			provider.Client = client
+		}
+		if c.Scrape.BearerTokenFile != "" {
+			provider.Token = metrics.TokenFile(c.Scrape.BearerTokenFile)
+		}
+		return provider, nil
+	case providerGoogleCloud:
+		google := GoogleCloudConfig{}
+		if c.GoogleCloud != nil {
+			google = *c.GoogleCloud
+		}
+		return &metrics.GoogleCloudProvider{
+			Project:  google.Project,
+			Queries:  google.Queries,
+			Filter:   google.Filter,
+			Window:   google.Window,
+			Hostname: s.hostnameFunc(c.Hostname),
+			Token:    metrics.GoogleToken(google.CredentialsFile, nil),
+		}, nil
+	case providerCloudWatch:
+		cloudWatch := CloudWatchConfig{}
+		if c.CloudWatch != nil {
+			cloudWatch = *c.CloudWatch
+		}
+		provider := &metrics.CloudWatchProvider{
+			Region:      cloudWatch.Region,
+			Metrics:     map[string]metrics.CloudWatchMetric{},
+			Window:      cloudWatch.Window,
+			ProviderID:  s.nodeProviderID,
+			Hostname:    s.hostnameFunc(c.Hostname),
+			Credentials: metrics.AWSCredentialsChain(nil),
+		}
+		for name, metric := range cloudWatch.Metrics {
+			provider.Metrics[name] = metrics.CloudWatchMetric(metric)
+		}
+		return provider, nil
+	case providerAzureMonitor:
+		azure := AzureMonitorConfig{}
+		if c.AzureMonitor != nil {
+			azure = *c.AzureMonitor
+		}
+		provider := &metrics.AzureMonitorProvider{
+			Metrics:    map[string]metrics.AzureMetric{},
+			Window:     azure.Window,
+			ProviderID: s.nodeProviderID,
+			Token:      metrics.AzureToken(azure.ClientID, nil),
+		}
+		for name, metric := range azure.Metrics {
+			provider.Metrics[name] = metrics.AzureMetric(metric)
+		}
+		return provider, nil
+	case providerInfluxDB:
+		influx := *c.InfluxDB
+		provider := &metrics.InfluxDBProvider{
+			URL:      influx.URL,
+			Version:  influx.Version,
+			Database: influx.Database,
+			Org:      influx.Org,
+			Queries:  influx.Queries,
+			Hostname: s.hostnameFunc(c.Hostname),
+			Client:   c.cachedClient(nil),
+		}
+		if influx.Version == 2 {
+			provider.Credentials = s.credentials(influx.Secret, []string{"token"}, []string{"INFLUX_TOKEN"})
+		} else if influx.Secret != nil {
+			provider.Credentials = s.credentials(influx.Secret, []string{"username", "password"}, nil)
+		}
+		return provider, nil
+	}
+	return nil, fmt.Errorf("unknown provider type %q", c.Type)
+}
+
+// Answers of the metric backends kept by the response caches, by result: hit, revalidated or miss
+var responseCacheResults = expvar.NewMap("responseCache")
+
+// Returns a copy of the client whose answers are kept by the response cache of the provider, or
+// the client itself without one. A nil client is http.DefaultClient.
+func (c ProviderConfig) cachedClient(client *http.Client) *http.Client {
+	if c.ResponseCache == nil {
+		return client
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	cached := *client
+	cached.Transport = &metrics.ResponseCache{
+		Transport: client.Transport,
+		TTL:       c.ResponseCache.TTL,
+		Record:    func(result string) { responseCacheResults.Add(result, 1) },
+	}
+	return &cached
+}
+
+// Returns a function reading the credentials from the keys of a secret, or from the
+// environment variables if there is no secret. Secrets are read again every minute.
+func (s *Scheduler) credentials(secret *SecretRef, keys, envs []string) func(ctx context.Context) ([]string, error) {
+	cached := &cache.Cache{Timeout: time.Minute}
+	return func(ctx context.Context) (values []string, err error) {
+		if data, ok := cached.Data(); ok {
+			return data.([]string), nil
+		}
+		if secret == nil {
+			for _, env := range envs {
+				value, ok := os.LookupEnv(env)
+				if !ok {
+					return nil, fmt.Errorf("%s is not set", env)
+				}
+				values = append(values, value)
+			}
+			return
+		}
+
+		namespace := secret.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		data, err := s.kubeAPI.GetSecret(ctx, namespace, secret.Name)
+		if err != nil {
+			return
+		}
+		for _, key := range keys {
+			value, ok := data[key]
+			if !ok {
+				return nil, fmt.Errorf("secret %s/%s has no key %s", namespace, secret.Name, key)
+			}
+			values = append(values, strings.TrimSpace(string(value)))
+		}
+		cached.SetData(values)
+		return
+	}
+}
+
+// Returns a function choosing the client of the first account whose node selector matches
+// the labels of the node. The nodes that are not known locally only match empty selectors.
+func (s *Scheduler) sysdigAccounts(accounts []SysdigAccount, cachedClient func(*http.Client) *http.Client) (func(ctx context.Context, nodeName string) (*sysdig.SysdigApiClient, error), error) {
+	urls := make([]string, len(accounts))
+	tokens := make([]func(ctx context.Context) ([]string, error), len(accounts))
+	httpClients := make([]*http.Client, len(accounts))
+	for i, account := range accounts {
+		urls[i] = account.URL
+		if account.Region != "" {
+			urls[i] = sysdig.Regions[account.Region]
+		}
+		tokens[i] = s.credentials(account.Secret, []string{"token"}, []string{"SDC_TOKEN"})
+		if account.CAFile != "" || account.CertFile != "" || account.Proxy != "" {
+			client, err := sysdig.NewHTTPClient(account.CAFile, account.CertFile, account.KeyFile, account.Proxy)
+			if err != nil {
+				return nil, fmt.Errorf("sysdig account %s: %s", account.Name, err)
+			}
+			httpClients[i] = s.tunedSysdigClient(client)
+		} else {
+			// The accounts without settings of their own share the connections of the default client
+			httpClients[i] = s.sysdigAPI.HTTPClient()
+		}
+		httpClients[i] = cachedClient(httpClients[i])
+	}
+
+	return func(ctx context.Context, nodeName string) (*sysdig.SysdigApiClient, error) {
+		var labels map[string]string
+		for _, node := range s.nodesAvailable(ctx) {
+			if node.Metadata.Name == nodeName {
+				labels = node.Metadata.Labels
+			}
+		}
+
+		for i, account := range accounts {
+			selector := &kubernetes.KubeLabelSelector{MatchLabels: account.NodeSelector}
+			if len(account.NodeSelector) > 0 && !selector.Matches(labels) {
+				continue
+			}
+			token, err := tokens[i](ctx)
+			if err != nil {
+				return nil, fmt.Errorf("sysdig account %s: %s", account.Name, err)
+			}
+			// A client per request, the token of the secret can change
+			client := &sysdig.SysdigApiClient{}
+			client.SetURL(urls[i])
+			client.SetToken(token[0])
+			client.SetHTTPClient(httpClients[i])
+			return client, nil
+		}
+		return nil, fmt.Errorf("no sysdig account matches node %s", nodeName)
+	}, nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+const (
+	// JSON of the capacity a pod needs, set when no candidate is within the thresholds
+	capacityNeededAnnotation = "sysdig-scheduler/capacity-needed"
+	nodeClaimsAPI            = "apis/karpenter.sh/v1/nodeclaims"
+)
+
+// Capacity needed by a pod, for the node provisioners
+type capacityNeeded struct {
+	Requests     map[string]string `json:"requests"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Reason       string            `json:"reason"`
+}
+
+func (p ProvisioningConfig) validate() error {
+	if p.NodeClass != nil && (p.NodeClass.Group == "" || p.NodeClass.Kind == "" || p.NodeClass.Name == "") {
+		return errors.New("provisioning: the group, kind and name of the node class must be set")
+	}
+	return nil
+}
+
+// Returns true if nodes were scored and every one of them is past a threshold
+func overThresholds(scored NodeList) bool {
+	for _, node := range scored {
+		if failure.ReasonOf(node.err) != failure.ThresholdReached {
+			return false
+		}
+	}
+	return len(scored) > 0
+}
+
+// Marks the pod unschedulable with the nodes past the thresholds, so the Cluster Autoscaler or
+// Karpenter add a node, and tells the capacity it needs in an annotation and, with a node class,
+// a NodeClaim. The pod is tried again once a new node is ready.
+func (s *Scheduler) requestProvisioning(ctx context.Context, profile *Profile, pod kubernetes.KubePod, nodes int, scored NodeList) {
+	rejected := thresholdRejections(scored)
+	s.unschedulablePods.add(ctx, profile, pod, nodes, rejected)
+
+	requests := podRequests(pod)
+	delete(requests, "pods")
+	capacity := capacityNeeded{
+		Requests:     requests.quantities(),
+		NodeSelector: pod.Spec.NodeSelector,
+		Reason:       unschedulableMessage(nodes, rejected),
+	}
+	data, err := json.Marshal(capacity)
+	if err == nil {
+		err = s.kubeAPI.AnnotatePod(ctx, pod.Metadata.Namespace, pod.Metadata.Name, capacityNeededAnnotation, string(data))
+	}
+	if err != nil {
+		log.Printf("Error setting the capacity needed by %s: %s", pod.Metadata.Name, err)
+	}
+
+	if s.config.Provisioning.NodeClass != nil {
+		if err := s.createNodeClaim(ctx, pod, capacity); err != nil {
+			log.Printf("Error creating the NodeClaim of %s: %s", pod.Metadata.Name, err)
+		}
+	}
+}
+
+// Applies a NodeClaim with the capacity needed by the pod, named after the pod UID so the pod
+// tried again doesn't ask for a second node
+func (s *Scheduler) createNodeClaim(ctx context.Context, pod kubernetes.KubePod, capacity capacityNeeded) error {
+	requirements := []map[string]interface{}{}
+	var keys []string
+	for key := range capacity.NodeSelector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		requirements = append(requirements, map[string]interface{}{
+			"key": key, "operator": "In", "values": []string{capacity.NodeSelector[key]},
+		})
+	}
+
+	metadata := map[string]interface{}{
+		"name":        "sysdig-scheduler-" + pod.Metadata.UID,
+		"annotations": map[string]string{"sysdig-scheduler/pod": pod.Metadata.Namespace + "/" + pod.Metadata.Name},
+	}
+	if s.config.Provisioning.NodePool != "" {
+		metadata["labels"] = map[string]string{"karpenter.sh/nodepool": s.config.Provisioning.NodePool}
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "karpenter.sh/v1",
+		"kind":       "NodeClaim",
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"nodeClassRef": s.config.Provisioning.NodeClass,
+			"requirements": requirements,
+			"resources":    map[string]interface{}{"requests": capacity.Requests},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return s.kubeAPI.Apply(ctx, nodeClaimsAPI+"/"+metadata["name"].(string), manifest, "sysdig-scheduler")
+}
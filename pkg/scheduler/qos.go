@@ -0,0 +1,98 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// QoS classes of the pods, set by the api server in their status
+const (
+	qosGuaranteed = "Guaranteed"
+	qosBurstable  = "Burstable"
+	qosBestEffort = "BestEffort"
+)
+
+// QoSClassConfig overrides the strategy of the profile and the thresholds of its metrics, by
+// metric name, for the pods of a QoS class. The thresholds replace both the ones of the metric.
+type QoSClassConfig struct {
+	Strategy   string                     `yaml:"strategy"`
+	Thresholds map[string]MetricThreshold `yaml:"thresholds"`
+}
+
+type MetricThreshold struct {
+	RejectAbove *float64 `yaml:"rejectAbove"`
+	RejectBelow *float64 `yaml:"rejectBelow"`
+}
+
+// Prepares a copy of the profile for every QoS class with a configuration
+func (p *Profile) initQoSClasses() error {
+	p.qosProfiles = nil
+	for class, qos := range p.QoSClasses {
+		switch class {
+		case qosGuaranteed, qosBurstable, qosBestEffort:
+		default:
+			return fmt.Errorf("profile %q: unknown QoS class %q", p.Name, class)
+		}
+		switch qos.Strategy {
+		case "", strategySpread, strategyBinpack:
+		default:
+			return fmt.Errorf("profile %q: QoS class %s: unknown strategy %q", p.Name, class, qos.Strategy)
+		}
+
+		variant := *p
+		variant.QoSClasses = nil
+		if qos.Strategy != "" {
+			variant.Strategy = qos.Strategy
+		}
+		variant.Metrics = append([]MetricConfig(nil), p.Metrics...)
+		for name, threshold := range qos.Thresholds {
+			found := false
+			for i := range variant.Metrics {
+				if variant.Metrics[i].Name == name {
+					variant.Metrics[i].RejectAbove, variant.Metrics[i].RejectBelow = threshold.RejectAbove, threshold.RejectBelow
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("profile %q: QoS class %s: %q is not a metric of the profile", p.Name, class, name)
+			}
+		}
+		if err := variant.init(); err != nil {
+			return err
+		}
+		// Same metrics, the prefetch loop fills the values of the profile for all its classes
+		variant.prefetched = p.prefetched
+
+		if p.qosProfiles == nil {
+			p.qosProfiles = map[string]*Profile{}
+		}
+		p.qosProfiles[class] = &variant
+	}
+	return nil
+}
+
+// Returns the copy of the profile for the QoS class of the pod, the profile itself if its class
+// has no configuration
+func (p *Profile) forQoSClass(pod kubernetes.KubePod) *Profile {
+	if variant, ok := p.qosProfiles[pod.Status.QosClass]; ok {
+		return variant
+	}
+	return p
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// A pending pod waiting for its scheduling attempt
+type queuedPod struct {
+	profile *Profile
+	pod     kubernetes.KubePod
+	seq     uint64
+	queued  time.Time
+}
+
+// Heap of the queued pods, the highest priority first, then the oldest
+type podHeap []*queuedPod
+
+func (h podHeap) Len() int { return len(h) }
+
+func (h podHeap) Less(i, j int) bool {
+	if a, b := podPriority(h[i].pod), podPriority(h[j].pod); a != b {
+		return a > b
+	}
+	if a, b := h[i].pod.Metadata.CreationTimestamp, h[j].pod.Metadata.CreationTimestamp; !a.Equal(b) {
+		return a.Before(b)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h podHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *podHeap) Push(x interface{}) { *h = append(*h, x.(*queuedPod)) }
+
+func (h *podHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// Pods waiting for a free scheduling slot and the bind rate limit
+type schedulingQueue struct {
+	scheduler *Scheduler
+	mutex     sync.Mutex
+	pods      podHeap
+	seq       uint64
+	closed    bool
+	ready     chan struct{}
+}
+
+// Queues the pod for the profile
+func (q *schedulingQueue) push(profile *Profile, pod kubernetes.KubePod) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return
+	}
+	q.seq++
+	heap.Push(&q.pods, &queuedPod{profile: profile, pod: pod, seq: q.seq, queued: time.Now()})
+	q.signal()
+}
+
+// Returns the number of queued pods
+func (q *schedulingQueue) length() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.pods)
+}
+
+// Pods of a profile waiting in the queue
+type queueStats struct {
+	depth  int
+	oldest time.Duration // Time the pod queued first has been waiting
+}
+
+// Returns the queued pods by profile name
+func (q *schedulingQueue) stats() map[string]queueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	stats := map[string]queueStats{}
+	for _, queued := range q.pods {
+		profile := stats[queued.profile.Name]
+		profile.depth++
+		if waiting := time.Since(queued.queued); waiting > profile.oldest {
+			profile.oldest = waiting
+		}
+		stats[queued.profile.Name] = profile
+	}
+	return stats
+}
+
+// Returns the time the pod queued first has been waiting, 0 if the queue is empty
+func (q *schedulingQueue) oldest() (oldest time.Duration) {
+	for _, profile := range q.stats() {
+		if profile.oldest > oldest {
+			oldest = profile.oldest
+		}
+	}
+	return
+}
+
+// Writes the depth of the queue and the wait of its oldest pod by profile in the Prometheus text
+// format, for the autoscaling of the replicas. The profiles are written even without queued pods.
+func (q *schedulingQueue) write(w http.ResponseWriter) {
+	stats := q.stats()
+	names := []string{}
+	for _, profile := range q.scheduler.config.Profiles {
+		names = append(names, profile.Name)
+	}
+	for name := range stats {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP sysdig_scheduler_queue_depth Pods of the profile waiting in the scheduling queue.")
+	fmt.Fprintln(w, "# TYPE sysdig_scheduler_queue_depth gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "sysdig_scheduler_queue_depth{profile=%s} %d\n", promLabel(name), stats[name].depth)
+	}
+	fmt.Fprintln(w, "# HELP sysdig_scheduler_queue_oldest_pod_seconds Time the oldest pod of the profile has been waiting in the scheduling queue.")
+	fmt.Fprintln(w, "# TYPE sysdig_scheduler_queue_oldest_pod_seconds gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "sysdig_scheduler_queue_oldest_pod_seconds{profile=%s} %s\n", promLabel(name), promValue(stats[name].oldest.Seconds()))
+	}
+}
+
+// Drops a deleted pod from the queue, before an attempt is started for it
+func (q *schedulingQueue) remove(pod kubernetes.KubePod) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	key := pod.Metadata.Namespace + "/" + pod.Metadata.Name + "/" + pod.Metadata.UID
+	var pods podHeap
+	for _, queued := range q.pods {
+		if queued.pod.Metadata.Namespace+"/"+queued.pod.Metadata.Name+"/"+queued.pod.Metadata.UID != key {
+			pods = append(pods, queued)
+		}
+	}
+	if len(pods) < len(q.pods) {
+		q.pods = pods
+		heap.Init(&q.pods)
+	}
+}
+
+// Blocks until a pod is queued, returns false once the queue is closed or the context done
+func (q *schedulingQueue) wait(ctx context.Context) bool {
+	for {
+		q.mutex.Lock()
+		closed, length := q.closed, len(q.pods)
+		q.mutex.Unlock()
+		if closed {
+			return false
+		}
+		if length > 0 {
+			return true
+		}
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Takes the first pod whose profile has a free scheduling slot, which it takes, and adds its
+// attempt to inFlight. Returns false if the queue is closed or no pod can be taken.
+func (q *schedulingQueue) pop(inFlight *sync.WaitGroup) (*queuedPod, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return nil, false
+	}
+	var skipped []*queuedPod
+	defer func() {
+		for _, pod := range skipped {
+			heap.Push(&q.pods, pod)
+		}
+	}()
+	for len(q.pods) > 0 {
+		next := heap.Pop(&q.pods).(*queuedPod)
+		if q.scheduler.limits.of(next.profile).acquire() {
+			inFlight.Add(1)
+			return next, true
+		}
+		skipped = append(skipped, next)
+	}
+	return nil, false
+}
+
+// Wakes up the dispatch loop, when a pod is queued or the slot of a profile is free
+func (q *schedulingQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Stops the attempts of the queued pods, they are Pending again for the next scheduler to come up
+func (q *schedulingQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.signal()
+}
+
+// Starts the attempts of the queued pods in order, at most SchedulingConcurrency at the same time
+// and at most the concurrency of the limits of their profile.
+// A free slot is waited for before taking the pod, so the pods queued meanwhile with a higher
+// priority go first, and the bind rate limit once a pod is taken, so no token is spent without an
+// attempt. Every attempt must finish within the scheduling timeout.
+func (s *Scheduler) dispatch(ctx context.Context, inFlight *sync.WaitGroup) {
+	slots := make(chan struct{}, s.config.SchedulingConcurrency)
+	for s.queue.wait(ctx) {
+		if err := throttle.sleep(ctx); err != nil {
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		next, ok := s.queue.pop(inFlight)
+		if !ok {
+			<-slots
+			// The queued pods wait for a slot of their profile
+			select {
+			case <-s.queue.ready:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		if err := s.bindLimits.waitGlobal(ctx); err != nil {
+			inFlight.Done()
+			<-slots
+			s.limits.of(next.profile).release()
+			return
+		}
+
+		go func() {
+			defer inFlight.Done()
+			defer func() { <-slots }()
+			defer func() {
+				s.limits.of(next.profile).release()
+				s.queue.signal()
+			}()
+			ctx, cancel := context.WithTimeout(ctx, s.config.SchedulingTimeout)
+			defer cancel()
+			s.schedulePod(ctx, next.profile, next.pod)
+		}()
+	}
+}
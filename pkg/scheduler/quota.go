@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+)
+
+// Checks that every quota caps either a resource or a metric
+func (q NamespaceQuota) validate() error {
+	if (q.Resource == "") == (q.Metric == "") {
+		return errors.New("namespace quota: one of resource or metric must be set")
+	}
+	if q.MaxPercent <= 0 {
+		return fmt.Errorf("namespace quota %s%s: maxPercent must be greater than 0", q.Resource, q.Metric)
+	}
+	return q.Namespaces.validate()
+}
+
+// Sets the provider of the quotas reading a metric, which must read the metrics of a namespace
+func (q *NamespaceQuota) init(scheduler *Scheduler, config Config) error {
+	if q.Metric == "" {
+		return nil
+	}
+	providerConfig := config.Provider
+	if q.Provider != nil {
+		providerConfig = *q.Provider
+	}
+	provider, err := scheduler.newProvider(providerConfig)
+	if err != nil {
+		return err
+	}
+	namespaceProvider, ok := provider.(metrics.NamespaceProvider)
+	if !ok {
+		return fmt.Errorf("namespace quota %s: the %s provider can't read the metrics of a namespace", q.Metric, provider.Name())
+	}
+	q.provider = namespaceProvider
+	return nil
+}
+
+// Rejects the nodes where the namespace of the pod would take more than its share of the node
+func namespaceQuotaFilter(state *cycleState, node kubernetes.KubeNode) error {
+	namespace := state.pod.Metadata.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	for _, quota := range state.scheduler.config.NamespaceQuotas {
+		if !quota.Namespaces.allowed(namespace) {
+			continue
+		}
+		var used float64
+		var err error
+		if quota.Resource != "" {
+			used, err = state.namespaceShare(node, namespace, quota.Resource)
+		} else {
+			used, err = state.scheduler.namespaceUsage(state.ctx, quota, node.Metadata.Name, namespace)
+		}
+		if err != nil {
+			return err
+		}
+		if used > quota.MaxPercent {
+			return fmt.Errorf("namespace %s would use %.1f%% of the %s%s of the node, above its quota of %g%%", namespace, used, quota.Resource, quota.Metric, quota.MaxPercent)
+		}
+	}
+	return nil
+}
+
+// Returns the percentage of the allocatable resource of the node requested by the pods of the
+// namespace scheduled by this scheduler, the pod being scheduled included
+func (s *cycleState) namespaceShare(node kubernetes.KubeNode, namespace, resource string) (float64, error) {
+	allocatable := parseResourceList(node.Status.Allocatable)[resource]
+	if allocatable <= 0 {
+		return 0, nil
+	}
+	pods, err := s.assignedPods()
+	if err != nil {
+		return 0, err
+	}
+	requested := podRequests(s.pod)[resource]
+	for _, pod := range pods {
+		podNamespace := pod.Metadata.Namespace
+		if podNamespace == "" {
+			podNamespace = "default"
+		}
+		if pod.Spec.NodeName == node.Metadata.Name && podNamespace == namespace && s.scheduler.profiles.serves(pod.Spec.SchedulerName) {
+			requested += podRequests(pod)[resource]
+		}
+	}
+	return requested / allocatable * 100, nil
+}
+
+// Returns the current value of the quota metric for the containers of the namespace on the node
+func (s *Scheduler) namespaceUsage(ctx context.Context, quota NamespaceQuota, nodeName, namespace string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.MetricsTimeout)
+	defer cancel()
+	values, err := quota.provider.NamespaceMetrics(ctx, nodeName, namespace, []string{quota.Metric})
+	if err == metrics.NoDataFound {
+		// Nothing of the namespace runs on the node
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s of namespace %s: %s", quota.Metric, namespace, err)
+	}
+	return values[0], nil
+}
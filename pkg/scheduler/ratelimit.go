@@ -0,0 +1,231 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Token bucket refilled at rate tokens per second up to burst tokens
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Takes a token and returns how long to wait until it is available
+func (b *tokenBucket) reserve() time.Duration {
+	return b.reserveAt(time.Now())
+}
+
+// Takes a token at the time now, refilling the bucket for the time elapsed since the last one
+func (b *tokenBucket) reserveAt(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Waits for a token of the bucket, a nil bucket never waits
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	delay := b.reserve()
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Limits the bindings of the whole scheduler and of every node
+type bindLimiter struct {
+	config RateLimitConfig
+	global *tokenBucket
+	mutex  sync.Mutex
+	nodes  map[string]*tokenBucket
+}
+
+func newBindLimiter(c RateLimitConfig) *bindLimiter {
+	limiter := &bindLimiter{config: c, nodes: map[string]*tokenBucket{}}
+	if c.PodsPerSecond > 0 {
+		limiter.global = newTokenBucket(c.PodsPerSecond, c.Burst)
+	}
+	return limiter
+}
+
+// Returns true if any limit is set, the best node caches are then skipped between bindings
+func (l *bindLimiter) enabled() bool {
+	return l != nil && (l.config.PodsPerSecond > 0 || l.config.PerNodePodsPerSecond > 0)
+}
+
+// Waits for the global limit, before the nodes are scored so the metrics are fresh
+func (l *bindLimiter) waitGlobal(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return l.global.wait(ctx)
+}
+
+// Waits for the limit of the node, right before the binding
+func (l *bindLimiter) waitNode(ctx context.Context, nodeName string) error {
+	if l == nil || l.config.PerNodePodsPerSecond <= 0 {
+		return nil
+	}
+	l.mutex.Lock()
+	bucket, ok := l.nodes[nodeName]
+	if !ok {
+		bucket = newTokenBucket(l.config.PerNodePodsPerSecond, l.config.PerNodeBurst)
+		l.nodes[nodeName] = bucket
+	}
+	l.mutex.Unlock()
+	return bucket.wait(ctx)
+}
+
+// Limits of a profile, shared by the copies of the profile made by the tunings and schedules
+type profileLimiter struct {
+	slots   chan struct{}
+	kube    *tokenBucket
+	metrics *tokenBucket
+}
+
+// Limiters of the profiles by name, created on first use
+type profileLimiters struct {
+	mutex  sync.Mutex
+	byName map[string]*profileLimiter
+}
+
+// Returns the limiter of the profile, nil if it has no limits
+func (l *profileLimiters) of(profile *Profile) *profileLimiter {
+	if profile.Limits == (ProfileLimits{}) {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	limiter, ok := l.byName[profile.Name]
+	if !ok {
+		limiter = &profileLimiter{}
+		if profile.Limits.Concurrency > 0 {
+			limiter.slots = make(chan struct{}, profile.Limits.Concurrency)
+		}
+		if profile.Limits.KubeQPS > 0 {
+			limiter.kube = newTokenBucket(profile.Limits.KubeQPS, profile.Limits.KubeBurst)
+		}
+		if profile.Limits.MetricsQPS > 0 {
+			limiter.metrics = newTokenBucket(profile.Limits.MetricsQPS, profile.Limits.MetricsBurst)
+		}
+		l.byName[profile.Name] = limiter
+	}
+	return limiter
+}
+
+// Takes a scheduling slot of the profile without waiting, false if they are all taken
+func (l *profileLimiter) acquire() bool {
+	if l == nil || l.slots == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Gives back the scheduling slot of the profile
+func (l *profileLimiter) release() {
+	if l == nil || l.slots == nil {
+		return
+	}
+	<-l.slots
+}
+
+// Waits for the api server limit of the profile
+func (l *profileLimiter) waitKube(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return l.kube.wait(ctx)
+}
+
+// Waits for the metrics limit of the profile
+func (l *profileLimiter) waitMetrics(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return l.metrics.wait(ctx)
+}
+
+// Key of the limiter of the profile doing the requests in their context
+type profileLimiterKey struct{}
+
+// Returns the context of the requests made for the profile, limited by its api server limit
+func (s *Scheduler) withProfileLimits(ctx context.Context, profile *Profile) context.Context {
+	if limiter := s.limits.of(profile); limiter != nil {
+		return context.WithValue(ctx, profileLimiterKey{}, limiter)
+	}
+	return ctx
+}
+
+// Waits for the api server limit of the profile of the request, if any
+type profileLimitTransport struct {
+	next http.RoundTripper
+}
+
+func (t *profileLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if limiter, ok := request.Context().Value(profileLimiterKey{}).(*profileLimiter); ok {
+		if err := limiter.waitKube(request.Context()); err != nil {
+			return nil, err
+		}
+	}
+	return t.next.RoundTrip(request)
+}
+
+// Applies the api server limits of the profiles to the requests made for them
+func (s *Scheduler) limitProfileRequests() {
+	s.kubeAPI.WrapTransport(func(next http.RoundTripper) http.RoundTripper {
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		return &profileLimitTransport{next: next}
+	})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(10, 3)
+	start := bucket.last
+	tests := []struct {
+		name    string
+		elapsed time.Duration // Since the creation of the bucket
+		delay   time.Duration
+	}{
+		// The burst is available at once, then a token every 100ms
+		{"burst", 0, 0},
+		{"burst", 0, 0},
+		{"burst", 0, 0},
+		{"past the burst", 0, 100 * time.Millisecond},
+		{"second past the burst", 0, 200 * time.Millisecond},
+		// The two reserved tokens are refilled after 200ms, and one more after 300ms
+		{"refilled", 300 * time.Millisecond, 0},
+		{"reserved after the refill", 300 * time.Millisecond, 100 * time.Millisecond},
+		// Refilled up to the burst only
+		{"full", time.Hour, 0},
+		{"full", time.Hour, 0},
+		{"full", time.Hour, 0},
+		{"past the full burst", time.Hour, 100 * time.Millisecond},
+	}
+	for i, test := range tests {
+		if delay := bucket.reserveAt(start.Add(test.elapsed)); delay.Round(time.Millisecond) != test.delay {
+			t.Errorf("token %d, %s: delayed by %s, want %s", i, test.name, delay, test.delay)
+		}
+	}
+}
+
+func TestTokenBucketMinimumBurst(t *testing.T) {
+	bucket := newTokenBucket(1, 0)
+	start := bucket.last
+	if delay := bucket.reserveAt(start); delay != 0 {
+		t.Errorf("first token delayed by %s", delay)
+	}
+	if delay := bucket.reserveAt(start); delay != time.Second {
+		t.Errorf("second token delayed by %s with a burst of 1, want 1s", delay)
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	var unlimited *tokenBucket
+	if err := unlimited.wait(context.Background()); err != nil {
+		t.Errorf("nil bucket: %v", err)
+	}
+
+	bucket := newTokenBucket(0.001, 1)
+	if err := bucket.wait(context.Background()); err != nil {
+		t.Fatalf("first token: %v", err)
+	}
+	// The next token is more than 16 minutes away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bucket.wait(ctx); err != context.Canceled {
+		t.Errorf("wait() past the burst = %v, want the context error", err)
+	}
+}
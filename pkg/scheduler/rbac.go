@@ -0,0 +1,277 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// A permission of the scheduler: the verb on the resource of the api group, with its subresource
+type permission struct {
+	verb     string
+	group    string
+	resource string
+}
+
+func (p permission) String() string {
+	if p.group == "" {
+		return p.verb + " " + p.resource
+	}
+	return p.verb + " " + p.resource + "." + p.group
+}
+
+// Permissions needed to schedule at all, the pods with persistent volume claims included
+var requiredPermissions = []permission{
+	{"get", "", "pods"},
+	{"list", "", "pods"},
+	{"watch", "", "pods"},
+	{"get", "", "nodes"},
+	{"list", "", "nodes"},
+	{"watch", "", "nodes"},
+	{"create", "", "pods/binding"},
+	{"create", "", "events"},
+	{"get", "", "persistentvolumeclaims"},
+	{"list", "", "persistentvolumeclaims"},
+	{"list", "", "persistentvolumes"},
+	{"list", "storage.k8s.io", "storageclasses"},
+}
+
+// A feature needing more permissions than the required ones, turned off by the minimal RBAC mode
+type optionalFeature struct {
+	name        string
+	enabled     func(c *Config) bool
+	disable     func(c *Config)
+	permissions func(c *Config) []permission
+}
+
+// Returns the permissions of the features as a constant
+func permissions(list ...permission) func(c *Config) []permission {
+	return func(c *Config) []permission {
+		return list
+	}
+}
+
+var optionalFeatures = []optionalFeature{
+	{
+		name:        "preemption",
+		enabled:     func(c *Config) bool { return !c.MinimalRBAC },
+		disable:     func(c *Config) { c.MinimalRBAC = true },
+		permissions: permissions(permission{"create", "", "pods/eviction"}, permission{"patch", "", "pods/status"}, permission{"list", "policy", "poddisruptionbudgets"}),
+	},
+	{
+		name: "default-scheduler fallback",
+		enabled: func(c *Config) bool {
+			for _, profile := range c.Profiles {
+				if profile.Fallback == fallbackDefaultScheduler {
+					return true
+				}
+			}
+			return false
+		},
+		disable: func(c *Config) {
+			for _, profile := range c.Profiles {
+				if profile.Fallback == fallbackDefaultScheduler {
+					profile.Fallback = fallbackAllocatable
+				}
+			}
+		},
+		permissions: permissions(permission{"get", "apps", "replicasets"}, permission{"list", "apps", "deployments"}, permission{"patch", "apps", "deployments"}),
+	},
+	{
+		name:        "clusterAutoscaler",
+		enabled:     func(c *Config) bool { return c.ClusterAutoscaler },
+		disable:     func(c *Config) { c.ClusterAutoscaler = false },
+		permissions: permissions(permission{"patch", "", "pods/status"}),
+	},
+	{
+		name:    "provisioning",
+		enabled: func(c *Config) bool { return c.Provisioning.Enabled },
+		disable: func(c *Config) { c.Provisioning.Enabled = false },
+		permissions: func(c *Config) []permission {
+			list := []permission{{"patch", "", "pods"}}
+			if c.Provisioning.NodeClass != nil {
+				list = append(list, permission{"create", "karpenter.sh", "nodeclaims"}, permission{"patch", "karpenter.sh", "nodeclaims"})
+			}
+			return list
+		},
+	},
+	{
+		name:        "reserveAnnotation",
+		enabled:     func(c *Config) bool { return c.ReserveAnnotation },
+		disable:     func(c *Config) { c.ReserveAnnotation = false },
+		permissions: permissions(permission{"patch", "", "pods"}),
+	},
+	{
+		// The nodes of the removed binders get the Binding subresource, without the annotations
+		name: "virtual-kubelet annotations",
+		enabled: func(c *Config) bool {
+			for _, binder := range c.Binders {
+				if binder.Type == binderVirtualKubelet && len(binder.Annotations) > 0 {
+					return true
+				}
+			}
+			return false
+		},
+		disable: func(c *Config) {
+			var binders []BinderConfig
+			for _, binder := range c.Binders {
+				if binder.Type != binderVirtualKubelet || len(binder.Annotations) == 0 {
+					binders = append(binders, binder)
+				}
+			}
+			c.Binders = binders
+		},
+		permissions: permissions(permission{"patch", "", "pods"}),
+	},
+	{
+		name:        "vpaRecommendations",
+		enabled:     func(c *Config) bool { return c.VPARecommendations },
+		disable:     func(c *Config) { c.VPARecommendations = false },
+		permissions: permissions(permission{"get", "apps", "replicasets"}, permission{"list", "autoscaling.k8s.io", "verticalpodautoscalers"}),
+	},
+	{
+		name:        "shardsFromReplicas",
+		enabled:     func(c *Config) bool { return c.Sharding.ShardsFromReplicas },
+		disable:     func(c *Config) { c.Sharding.ShardsFromReplicas = false },
+		permissions: permissions(permission{"get", "apps", "statefulsets"}),
+	},
+	{
+		name:    "nodeScores",
+		enabled: func(c *Config) bool { return c.NodeScores.Target != "" },
+		disable: func(c *Config) { c.NodeScores.Target = "" },
+		permissions: func(c *Config) []permission {
+			if c.NodeScores.Target == nodeScoresCRD {
+				return []permission{{"create", "scheduling.sysdig.com", "nodescores"}, {"patch", "scheduling.sysdig.com", "nodescores"}}
+			}
+			return []permission{{"patch", "", "nodes"}}
+		},
+	},
+	{
+		name:        "watchPolicies",
+		enabled:     func(c *Config) bool { return c.WatchPolicies },
+		disable:     func(c *Config) { c.WatchPolicies = false },
+		permissions: permissions(permission{"list", "scheduling.sysdig.com", "schedulingpolicies"}, permission{"watch", "scheduling.sysdig.com", "schedulingpolicies"}),
+	},
+	{
+		name:        "watchNodePools",
+		enabled:     func(c *Config) bool { return c.WatchNodePools },
+		disable:     func(c *Config) { c.WatchNodePools = false },
+		permissions: permissions(permission{"list", "scheduling.sysdig.com", "nodepools"}, permission{"watch", "scheduling.sysdig.com", "nodepools"}),
+	},
+	{
+		name:        "tuning",
+		enabled:     func(c *Config) bool { return c.Tuning != nil },
+		disable:     func(c *Config) { c.Tuning = nil },
+		permissions: permissions(permission{"list", "", "configmaps"}, permission{"watch", "", "configmaps"}),
+	},
+	{
+		name:        "state",
+		enabled:     func(c *Config) bool { return c.State != nil },
+		disable:     func(c *Config) { c.State = nil },
+		permissions: permissions(permission{"get", "", "configmaps"}, permission{"patch", "", "configmaps"}),
+	},
+	{
+		name:        "decisionAnnotation",
+		enabled:     func(c *Config) bool { return c.DecisionAnnotation },
+		disable:     func(c *Config) { c.DecisionAnnotation = false },
+		permissions: permissions(permission{"patch", "", "pods"}),
+	},
+	{
+		name:        "checkResourceQuotas",
+		enabled:     func(c *Config) bool { return c.CheckResourceQuotas },
+		disable:     func(c *Config) { c.CheckResourceQuotas = false },
+		permissions: permissions(permission{"list", "", "resourcequotas"}),
+	},
+	{
+		name:        "descheduler",
+		enabled:     func(c *Config) bool { return c.Descheduler.Metric != "" },
+		disable:     func(c *Config) { c.Descheduler.Metric = "" },
+		permissions: permissions(permission{"create", "", "pods/eviction"}, permission{"list", "policy", "poddisruptionbudgets"}),
+	},
+}
+
+// Turns off the optional features, so the scheduler only needs the required permissions
+func (c *Config) minimizeRBAC() {
+	c.MinimalRBAC = false
+	var disabled []string
+	for _, feature := range optionalFeatures {
+		if feature.enabled(c) {
+			feature.disable(c)
+			disabled = append(disabled, feature.name)
+		}
+	}
+	c.MinimalRBAC = true
+	log.Printf("Minimal RBAC mode, disabled: %s", strings.Join(disabled, ", "))
+}
+
+// Checks every permission the configuration needs with access reviews, and returns an error
+// listing the denied ones. A review the api server refuses only skips the check.
+func (s *Scheduler) checkPermissions(ctx context.Context, c *Config) error {
+	// Features needing every permission, none for the required ones
+	needed := map[permission][]string{}
+	var order []permission
+	for _, p := range requiredPermissions {
+		if c.Observer != nil && !p.readOnly() {
+			continue
+		}
+		needed[p] = nil
+		order = append(order, p)
+	}
+	for _, feature := range optionalFeatures {
+		if !feature.enabled(c) {
+			continue
+		}
+		for _, p := range feature.permissions(c) {
+			features, ok := needed[p]
+			if !ok {
+				order = append(order, p)
+			} else if features == nil {
+				continue
+			}
+			needed[p] = append(features, feature.name)
+		}
+	}
+
+	var denied []string
+	for _, p := range order {
+		allowed, reason, err := s.kubeAPI.CanI(ctx, kubernetes.KubeResourceAttributes{Verb: p.verb, Group: p.group, Resource: p.resource})
+		if err != nil {
+			log.Println("cannot check the permissions, skipping the check:", err)
+			return nil
+		}
+		if allowed {
+			continue
+		}
+		line := "  " + p.String()
+		if features := needed[p]; features != nil {
+			line += " (for " + strings.Join(features, ", ") + ")"
+		}
+		if reason != "" {
+			line += ": " + reason
+		}
+		denied = append(denied, line)
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("missing permissions, grant them or run with -minimal-rbac to turn the optional features off:\n%s", strings.Join(denied, "\n"))
+	}
+	return nil
+}
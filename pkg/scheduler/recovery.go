@@ -0,0 +1,84 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Pods queued at startup, whose first event of the watch is skipped
+type recoveredSet struct {
+	mutex sync.Mutex
+	uids  map[string]bool
+}
+
+// Returns true once if the pod was queued at startup
+func (s *recoveredSet) take(pod kubernetes.KubePod) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.uids[pod.Metadata.UID] {
+		return false
+	}
+	delete(s.uids, pod.Metadata.UID)
+	return true
+}
+
+func (s *recoveredSet) add(pod kubernetes.KubePod) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.uids[pod.Metadata.UID] = true
+}
+
+// Forgets a deleted pod whose first event was never seen
+func (s *recoveredSet) remove(pod kubernetes.KubePod) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.uids, pod.Metadata.UID)
+}
+
+// Queues the pods of our profiles left pending for longer than RecoverPendingAfter, like after a
+// crash of the previous scheduler, before the pod watch starts. They get a Recovered event and
+// go through the same checks as the pods of the watch.
+func (s *Scheduler) recoverPendingPods(ctx context.Context) {
+	pods, err := s.kubeAPI.ListPods(ctx, "", "spec.nodeName=,status.phase=Pending")
+	if err != nil {
+		log.Println("error while listing the pending pods to recover:", err)
+		return
+	}
+
+	var recovered int
+	for _, pod := range pods {
+		age := time.Since(pod.Metadata.CreationTimestamp)
+		if s.profiles.forPod(pod) == nil || age < s.config.RecoverPendingAfter {
+			continue
+		}
+		message := fmt.Sprintf("Pending for %s, queued again by %s after its restart", age.Round(time.Second), pod.Spec.SchedulerName)
+		s.reportPodEvent(ctx, pod, "Normal", "Recovered", message)
+		s.handlePod(ctx, kubernetes.KubePodEvent{Type: "ADDED", Object: pod})
+		s.recoveredPods.add(pod)
+		recovered++
+	}
+	if recovered > 0 {
+		log.Printf("Recovered %d pending pods", recovered)
+	}
+}
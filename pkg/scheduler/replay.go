@@ -0,0 +1,243 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// A recorded decision taken again with the profiles of a configuration
+type replayedDecision struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Profile   string    `json:"profile"`
+	Recorded  string    `json:"recorded"`
+	Replayed  string    `json:"replayed,omitempty"`
+	Changed   bool      `json:"changed"`
+	Skipped   string    `json:"skipped,omitempty"`
+}
+
+// Totals of a replay
+type replaySummary struct {
+	Replayed int `json:"replayed"`
+	Changed  int `json:"changed"`
+	Skipped  int `json:"skipped"`
+}
+
+// Takes again the decisions of an audit file recorded with recordInputs, with the profiles of a
+// configuration, and prints the ones choosing another node
+func (s *Scheduler) runReplay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	configFile := flags.String("c", "", "Configuration file with the profiles to replay the decisions with")
+	output := flags.String("o", "table", "Output format: table or json")
+	all := flags.Bool("all", false, "Print all the decisions, not only the changed ones")
+	failOnChange := flags.Bool("fail-on-change", false, "Exit with status 1 if a decision changed")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s replay -c CONFIG [flags] FILE...\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "The files are audit files written with recordInputs, - reads the standard input.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *configFile == "" || flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Printf("Error: unknown output %q\n", *output)
+		os.Exit(2)
+	}
+	var err error
+	if s.config, err = LoadConfig(*configFile); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	var decisions []replayedDecision
+	var summary replaySummary
+	for _, file := range flags.Args() {
+		err := readDecisions(file, func(record auditRecord) {
+			decision := s.replayDecision(record)
+			switch {
+			case decision.Skipped != "":
+				summary.Skipped++
+			case decision.Changed:
+				summary.Replayed++
+				summary.Changed++
+			default:
+				summary.Replayed++
+			}
+			if *all || decision.Changed {
+				decisions = append(decisions, decision)
+			}
+		})
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(struct {
+			Decisions []replayedDecision `json:"decisions"`
+			Summary   replaySummary      `json:"summary"`
+		}{decisions, summary})
+	} else {
+		printReplay(decisions, summary)
+	}
+	if *failOnChange && summary.Changed > 0 {
+		os.Exit(1)
+	}
+}
+
+// Calls fn for every decision of the JSON lines file, the standard input for -
+func readDecisions(file string, fn func(auditRecord)) error {
+	var reader io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		reader = f
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%s:%d: %s", file, line, err)
+		}
+		fn(record)
+	}
+	return scanner.Err()
+}
+
+// Scores the recorded values again with the profile of the decision and compares the best node
+// with the recorded one. The tie-breakers are not run, a recorded node tied with the best one
+// is not a change.
+func (s *Scheduler) replayDecision(record auditRecord) (decision replayedDecision) {
+	decision = replayedDecision{Time: record.Time, Namespace: record.Namespace, Pod: record.Pod, Profile: record.Profile, Recorded: record.Node}
+
+	profile := s.config.profileByName(record.Profile)
+	switch {
+	case record.Outcome != outcomeBound:
+		decision.Skipped = "outcome " + record.Outcome
+		return
+	case record.Inputs == nil:
+		decision.Skipped = "inputs not recorded"
+		return
+	case profile == nil:
+		decision.Skipped = "profile not defined"
+		return
+	case len(profile.NodePools) > 0:
+		decision.Skipped = "profile with node pools"
+		return
+	case profile.WindowConsensus == consensusRank:
+		decision.Skipped = "profile with rank consensus"
+		return
+	}
+	var pod kubernetes.KubePod
+	pod.Status.QosClass = record.Inputs.QoSClass
+	profile = profile.forQoSClass(pod)
+
+	var names []string
+	names = append(names, profile.metricNames...)
+	for _, scorer := range profile.Scorers {
+		names = append(names, scorer.Name)
+	}
+	var list NodeList
+	for _, input := range record.Inputs.Nodes {
+		if input.Values == nil {
+			// Not scored, the metrics could not be read
+			continue
+		}
+		node := Node{name: input.Node}
+		for _, name := range names {
+			value, ok := input.Values[name]
+			if !ok {
+				decision.Skipped = fmt.Sprintf("%s not recorded for node %s", name, input.Node)
+				return
+			}
+			node.metrics = append(node.metrics, value)
+		}
+		list = append(list, node)
+	}
+
+	applyThresholds(profile, list)
+	scoreList(profile, list)
+	var valid NodeList
+	for _, node := range list {
+		if node.err == nil {
+			valid = append(valid, node)
+		}
+	}
+	best, err := bestNodeFromList(profile, valid)
+	if err != nil {
+		decision.Replayed, decision.Changed = "-", true
+		return
+	}
+	decision.Replayed = best.name
+	decision.Changed = best.name != record.Node
+	if decision.Changed && profile.TieBreaker != "" {
+		for _, node := range valid {
+			if node.name == record.Node && math.Abs(node.score-best.score) <= profile.TieMargin {
+				decision.Replayed, decision.Changed = record.Node, false
+			}
+		}
+	}
+	return
+}
+
+// Prints the decisions and the totals
+func printReplay(decisions []replayedDecision, summary replaySummary) {
+	if len(decisions) > 0 {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "TIME\tPOD\tPROFILE\tRECORDED\tREPLAYED\tNOTE")
+		for _, decision := range decisions {
+			note := ""
+			if decision.Changed {
+				note = "changed"
+			}
+			replayed := decision.Replayed
+			if decision.Skipped != "" {
+				replayed, note = "-", "skipped: "+decision.Skipped
+			}
+			fmt.Fprintf(writer, "%s\t%s/%s\t%s\t%s\t%s\t%s\n", decision.Time.Format(time.RFC3339), decision.Namespace, decision.Pod,
+				decision.Profile, decision.Recorded, replayed, note)
+		}
+		writer.Flush()
+		fmt.Println()
+	}
+	fmt.Printf("%d decisions replayed, %d changed, %d skipped\n", summary.Replayed, summary.Changed, summary.Skipped)
+}
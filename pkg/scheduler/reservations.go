@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Annotation set on the pods with the node reserved for them, with reserveAnnotation
+const reservedNodeAnnotation = "sysdig-scheduler/reserved-node"
+
+// Capacity reserved on the nodes for the pods being bound, indexed by pod namespace/name. A
+// reservation is counted by the filters of the other pods until the pod shows up assigned to the node.
+type reservationSet struct {
+	scheduler *Scheduler
+	reserving sync.Mutex // Held while a node is checked and reserved
+	mutex     sync.Mutex
+	pods      map[string]reservation
+}
+
+type reservation struct {
+	node     string
+	requests resourceList
+	time     time.Time
+}
+
+// Reserves the requests of the pod on the node once the filters, that count the other
+// reservations, accept the node again. The reservations are checked one at a time so two pods
+// can't take the last room of a node.
+func (r *reservationSet) reserve(ctx context.Context, pod kubernetes.KubePod, nodeName string) error {
+	r.reserving.Lock()
+	defer r.reserving.Unlock()
+
+	r.mutex.Lock()
+	// Leftovers of attempts that never released them, the bound pods are assigned long before
+	for key, reserved := range r.pods {
+		if time.Since(reserved.time) > 2*r.scheduler.config.SchedulingTimeout {
+			delete(r.pods, key)
+		}
+	}
+	r.mutex.Unlock()
+
+	state := r.scheduler.newCycleState(ctx, pod, r.scheduler.nodesAvailable(ctx))
+	node, ok := state.node(nodeName)
+	if !ok {
+		return fmt.Errorf("node %s is no longer available", nodeName)
+	}
+	if err := filterNode(state, node); err != nil {
+		return fmt.Errorf("node %s no longer fits: %s", nodeName, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.pods[pod.Metadata.Namespace+"/"+pod.Metadata.Name] = reservation{nodeName, podRequests(pod), time.Now()}
+	return nil
+}
+
+// Releases the reservation of a pod that could not be bound
+func (r *reservationSet) release(pod kubernetes.KubePod) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.pods, pod.Metadata.Namespace+"/"+pod.Metadata.Name)
+}
+
+// Adds the reservations of the pods other than pod that are not assigned yet to the requests by node
+func (r *reservationSet) addTo(requested map[string]resourceList, assigned []kubernetes.KubePod, pod kubernetes.KubePod) {
+	seen := map[string]bool{pod.Metadata.Namespace + "/" + pod.Metadata.Name: true}
+	for _, other := range assigned {
+		seen[other.Metadata.Namespace+"/"+other.Metadata.Name] = true
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for key, reserved := range r.pods {
+		if seen[key] {
+			continue
+		}
+		if requested[reserved.node] == nil {
+			requested[reserved.node] = resourceList{}
+		}
+		requested[reserved.node].add(reserved.requests)
+	}
+}
+
+// Annotates the pod with its reserved node, errors are logged
+func (s *Scheduler) annotateReservation(ctx context.Context, pod kubernetes.KubePod, nodeName string) {
+	if !s.config.ReserveAnnotation {
+		return
+	}
+	if err := s.kubeAPI.AnnotatePod(ctx, pod.Metadata.Namespace, pod.Metadata.Name, reservedNodeAnnotation, nodeName); err != nil {
+		log.Printf("Error annotating the reservation of %s: %s", pod.Metadata.Name, err)
+	}
+}
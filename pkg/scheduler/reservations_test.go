@@ -0,0 +1,60 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+func TestFreeByNodeReservations(t *testing.T) {
+	assigned := podOn(t, "assigned", "node-1", 0, "1", nil)
+	s := testScheduler(Config{})
+	s.fakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": []kubernetes.KubePod{assigned}})
+	})
+	s.reservations = &reservationSet{scheduler: s, pods: map[string]reservation{
+		// Not assigned yet, counted on its node
+		"default/pending": {"node-1", resourceList{"cpu": 2, "pods": 1}, time.Now()},
+		// Listed with its node already, counted once
+		"default/assigned": {"node-1", resourceList{"cpu": 1, "pods": 1}, time.Now()},
+		"default/other":    {"node-2", resourceList{"cpu": 0.5, "pods": 1}, time.Now()},
+	}}
+
+	var nodes []kubernetes.KubeNode
+	for _, name := range []string{"node-1", "node-2"} {
+		var node kubernetes.KubeNode
+		node.Metadata.Name = name
+		node.Status.Allocatable = map[string]string{"cpu": "4", "pods": "110"}
+		nodes = append(nodes, node)
+	}
+	free, err := s.freeByNode(context.Background(), nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free["node-1"]["cpu"] != 1 || free["node-1"]["pods"] != 108 {
+		t.Errorf("free on node-1 %v, want 1 cpu and 108 pods", free["node-1"])
+	}
+	if free["node-2"]["cpu"] != 3.5 || free["node-2"]["pods"] != 109 {
+		t.Errorf("free on node-2 %v, want 3.5 cpu and 109 pods", free["node-2"])
+	}
+}
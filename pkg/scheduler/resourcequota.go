@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Returns a QuotaExceeded failure if a ResourceQuota of the namespace of the pod, with scopes
+// matching the pod, uses more of a resource the pod consumes than its hard limit, like after the
+// quota was lowered. The pod is counted in the usage since its creation, so a quota used up to
+// its limit is fine. The quotas that can't be listed are not checked.
+func (s *Scheduler) checkResourceQuotas(ctx context.Context, pod kubernetes.KubePod) error {
+	quotas, err := s.kubeAPI.ListResourceQuotas(ctx, pod.Metadata.Namespace)
+	if err != nil {
+		log.Printf("Resource quotas of %s not checked: %s", pod.Metadata.Namespace, err)
+		return nil
+	}
+	requests, limits := podRequests(pod), podLimits(pod)
+	for _, quota := range quotas {
+		if !quotaSelects(quota, pod) {
+			continue
+		}
+		hard, used := parseResourceList(quota.Status.Hard), parseResourceList(quota.Status.Used)
+		for name, limit := range hard {
+			if consumesQuota(name, requests, limits) && used[name] > limit {
+				return failure.New(failure.QuotaExceeded, failure.Filter, fmt.Sprintf("resource quota %s of namespace %s is exceeded: %s used %s of %s",
+					quota.Metadata.Name, pod.Metadata.Namespace, name, quota.Status.Used[name], quota.Status.Hard[name]))
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the sum of the limits of the containers of the pod
+func podLimits(pod kubernetes.KubePod) resourceList {
+	limits := resourceList{}
+	for _, container := range pod.Spec.Containers {
+		limits.add(parseResourceList(container.Resources.Limits))
+	}
+	return limits
+}
+
+// Returns true if the pod consumes the quota resource: the pod counts, its requests as
+// requests.NAME or NAME, and its limits as limits.NAME
+func consumesQuota(name string, requests, limits resourceList) bool {
+	switch {
+	case name == "pods" || name == "count/pods":
+		return true
+	case strings.HasPrefix(name, "requests."):
+		return requests[strings.TrimPrefix(name, "requests.")] > 0
+	case strings.HasPrefix(name, "limits."):
+		return limits[strings.TrimPrefix(name, "limits.")] > 0
+	case name == "cpu" || name == "memory" || name == ephemeralStorage:
+		return requests[name] > 0
+	}
+	return false
+}
+
+// Returns true if the pod is in all the scopes of the quota
+func quotaSelects(quota kubernetes.KubeResourceQuota, pod kubernetes.KubePod) bool {
+	for _, scope := range quota.Spec.Scopes {
+		if !inQuotaScope(scope, kubernetes.KubeScopedResourceSelectorRequirement{Operator: "Exists"}, pod) {
+			return false
+		}
+	}
+	if selector := quota.Spec.ScopeSelector; selector != nil {
+		for _, requirement := range selector.MatchExpressions {
+			if !inQuotaScope(requirement.ScopeName, requirement, pod) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns true if the pod is in the scope. Only the PriorityClass scope has values, the others
+// are matched with Exists and negated with DoesNotExist.
+func inQuotaScope(scope string, requirement kubernetes.KubeScopedResourceSelectorRequirement, pod kubernetes.KubePod) bool {
+	var in bool
+	switch scope {
+	case "Terminating":
+		in = pod.Spec.ActiveDeadlineSeconds != nil
+	case "NotTerminating":
+		in = pod.Spec.ActiveDeadlineSeconds == nil
+	case "BestEffort":
+		in = pod.Status.QosClass == "BestEffort"
+	case "NotBestEffort":
+		in = pod.Status.QosClass != "BestEffort"
+	case "CrossNamespacePodAffinity":
+		in = crossNamespaceAffinity(pod)
+	case "PriorityClass":
+		class := pod.Spec.PriorityClassName
+		switch requirement.Operator {
+		case "In", "NotIn":
+			matches := false
+			for _, value := range requirement.Values {
+				matches = matches || value == class
+			}
+			return matches == (requirement.Operator == "In")
+		}
+		in = class != ""
+	default:
+		// Not a scope of the pods
+		return false
+	}
+	if requirement.Operator == "DoesNotExist" {
+		return !in
+	}
+	return in
+}
+
+// Returns true if a pod affinity or anti-affinity term of the pod names other namespaces
+func crossNamespaceAffinity(pod kubernetes.KubePod) bool {
+	affinity := pod.Spec.Affinity
+	if affinity == nil {
+		return false
+	}
+	for _, podAffinity := range []*kubernetes.KubePodAffinity{affinity.PodAffinity, affinity.PodAntiAffinity} {
+		if podAffinity == nil {
+			continue
+		}
+		terms := podAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+		for _, weighted := range podAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			terms = append(terms, weighted.PodAffinityTerm)
+		}
+		for _, term := range terms {
+			if len(term.Namespaces) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
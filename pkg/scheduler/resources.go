@@ -0,0 +1,172 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Resource quantities in base units indexed by resource name ("cpu", "memory", ...)
+type resourceList map[string]float64
+
+// Parses a map of Kubernetes quantities, ignoring the invalid ones
+func parseResourceList(quantities map[string]string) resourceList {
+	list := resourceList{}
+	for name, quantity := range quantities {
+		if value, err := kubernetes.ParseQuantity(quantity); err == nil {
+			list[name] = value
+		}
+	}
+	return list
+}
+
+// Adds the quantities of other to the list
+func (r resourceList) add(other resourceList) {
+	for name, value := range other {
+		r[name] += value
+	}
+}
+
+// Removes the quantities of other from the list
+func (r resourceList) sub(other resourceList) {
+	for name, value := range other {
+		r[name] -= value
+	}
+}
+
+// Raises the quantities of the list to the ones of other where they are higher
+func (r resourceList) max(other resourceList) {
+	for name, value := range other {
+		if value > r[name] {
+			r[name] = value
+		}
+	}
+}
+
+// Returns the list as Kubernetes quantities, the cpu in millicores and the others in whole units
+func (r resourceList) quantities() map[string]string {
+	quantities := map[string]string{}
+	for name, value := range r {
+		if name == "cpu" {
+			quantities[name] = fmt.Sprintf("%dm", int64(math.Ceil(value*1000)))
+		} else {
+			quantities[name] = fmt.Sprint(int64(math.Ceil(value)))
+		}
+	}
+	return quantities
+}
+
+// Returns true if there is enough of every requested resource in the list
+func (r resourceList) fits(requests resourceList) bool {
+	for name, value := range requests {
+		if value > 0 && r[name] < value {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the resources requested by a pod as the Kubernetes resource model counts them: the
+// highest of the containers plus the sidecars and of every init container plus the sidecars
+// started before it, plus the overhead of its runtime class. The pod itself counts as one "pods".
+func podRequests(pod kubernetes.KubePod) resourceList {
+	requests := resourceList{}
+	for _, container := range pod.Spec.Containers {
+		requests.add(parseResourceList(container.Resources.Requests))
+	}
+
+	sidecars, initMax := resourceList{}, resourceList{}
+	for _, container := range pod.Spec.InitContainers {
+		if container.RestartPolicy == "Always" {
+			sidecars.add(parseResourceList(container.Resources.Requests))
+			continue
+		}
+		init := parseResourceList(container.Resources.Requests)
+		init.add(sidecars)
+		initMax.max(init)
+	}
+	requests.add(sidecars)
+	requests.max(initMax)
+
+	requests.add(parseResourceList(pod.Spec.Overhead))
+	requests["pods"] = 1
+	return requests
+}
+
+// Returns the resources requested by the running pods of every node, and reserved for the pods
+// being bound to it, indexed by node name
+func (s *Scheduler) requestedByNode(ctx context.Context) (requested map[string]resourceList, err error) {
+	pods, err := s.kubeAPI.ListAssignedPods(ctx)
+	if err != nil {
+		return
+	}
+
+	requested = map[string]resourceList{}
+	for _, pod := range pods {
+		if requested[pod.Spec.NodeName] == nil {
+			requested[pod.Spec.NodeName] = resourceList{}
+		}
+		requested[pod.Spec.NodeName].add(podRequests(pod))
+	}
+	s.reservations.addTo(requested, pods, kubernetes.KubePod{})
+	return
+}
+
+// Returns the allocatable resources of every node minus the requests of its pods and the
+// reservations of the pods being bound to it, indexed by node name
+func (s *Scheduler) freeByNode(ctx context.Context, nodes []kubernetes.KubeNode) (free map[string]resourceList, err error) {
+	requested, err := s.requestedByNode(ctx)
+	if err != nil {
+		return
+	}
+
+	free = map[string]resourceList{}
+	for _, node := range nodes {
+		available := parseResourceList(node.Status.Allocatable)
+		available.sub(requested[node.Metadata.Name])
+		free[node.Metadata.Name] = available
+	}
+	return
+}
+
+// Scores the nodes with a metric of the profile provider, like the GPU utilization, for the pods
+// requesting a resource. The metric is not read for the other pods.
+type resourceMetricScorer struct {
+	profile  *Profile
+	resource string
+	metric   string
+}
+
+func (s *resourceMetricScorer) Name() string {
+	return s.resource
+}
+
+func (s *resourceMetricScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (float64, error) {
+	if pod.Requests[s.resource] <= 0 {
+		return 0, nil
+	}
+	values, err := s.profile.provider.NodeMetrics(ctx, node.Name, []string{s.metric})
+	if err != nil {
+		return 0, fmt.Errorf("%s of node %s: %s", s.metric, node.Name, err)
+	}
+	return values[0], nil
+}
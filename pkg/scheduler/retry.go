@@ -0,0 +1,109 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+)
+
+var circuitOpen = failure.New(failure.CircuitOpen, failure.Metrics, "circuit breaker open, metrics not requested")
+
+// Calls fn until it succeeds, returns a non transient error, the attempts are exhausted
+// or the context is done. Between attempts it sleeps an exponential backoff with full jitter.
+func withRetries(ctx context.Context, retry RetryConfig, fn func() error) (err error) {
+	backoff := retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		transient, isTransient := err.(metrics.TransientError)
+		if err == nil || !isTransient {
+			return
+		}
+		if attempt >= retry.Attempts {
+			return transient.Err
+		}
+
+		select {
+		case <-time.After(time.Duration(random.Int63n(int64(backoff) + 1))):
+		case <-ctx.Done():
+			return transient.Err
+		}
+		backoff *= 2
+		if backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
+	}
+}
+
+// Per node circuit breakers. A breaker opens after FailureThreshold consecutive
+// failures and lets a single request through once OpenDuration has passed.
+type circuitBreakers struct {
+	scheduler *Scheduler
+	mutex     sync.Mutex
+	nodes     map[string]*circuitState
+}
+
+type circuitState struct {
+	failures  int
+	openUntil time.Time
+}
+
+// Returns true if requests for the node are allowed
+func (b *circuitBreakers) allow(node string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state, ok := b.nodes[node]
+	if !ok || state.failures < b.scheduler.config.CircuitBreaker.FailureThreshold {
+		return true
+	}
+	if time.Now().After(state.openUntil) {
+		// Half open: let this request through and re-open on failure
+		state.openUntil = time.Now().Add(b.scheduler.config.CircuitBreaker.OpenDuration)
+		return true
+	}
+	return false
+}
+
+// Records the outcome of a request for the node
+func (b *circuitBreakers) record(node string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		delete(b.nodes, node)
+		return
+	}
+	state, ok := b.nodes[node]
+	if !ok {
+		state = &circuitState{}
+		b.nodes[node] = state
+	}
+	state.failures++
+	if state.failures == b.scheduler.config.CircuitBreaker.FailureThreshold {
+		state.openUntil = time.Now().Add(b.scheduler.config.CircuitBreaker.OpenDuration)
+	}
+}
+
+// Forgets the breaker of a deleted node
+func (b *circuitBreakers) remove(node string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.nodes, node)
+}
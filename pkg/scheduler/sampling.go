@@ -0,0 +1,47 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"sync/atomic"
+)
+
+// Smallest number of nodes scored when only a percentage of them is, like kube-scheduler
+const minNodesToScore = 100
+
+// Returns the candidates to score: PercentageOfNodesToScore percent of them, at least
+// minNodesToScore, taken in turns from a different offset at every attempt. All of them
+// if the percentage is not set.
+func (s *Scheduler) sampleNodes(candidates []string) []string {
+	if s.config.PercentageOfNodesToScore <= 0 || s.config.PercentageOfNodesToScore >= 100 {
+		return candidates
+	}
+	count := len(candidates) * s.config.PercentageOfNodesToScore / 100
+	if count < minNodesToScore {
+		count = minNodesToScore
+	}
+	if count >= len(candidates) {
+		return candidates
+	}
+
+	start := int(atomic.AddUint32(&s.nextNodeToScore, uint32(count)) - uint32(count))
+	sampled := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		sampled = append(sampled, candidates[(start+i)%len(candidates)])
+	}
+	return sampled
+}
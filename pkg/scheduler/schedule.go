@@ -0,0 +1,173 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// How often the strategy schedules of the profiles are checked
+const scheduleCheckInterval = time.Minute
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// StrategySchedule switches the profile to Strategy every day of Days (mon, tue... all of them
+// if empty) from From to To, HH:MM times in Timezone (the local time zone by default). A window
+// ending before its start ends the next day, like 20:00 to 06:00, and one ending at its start
+// lasts 24 hours.
+type StrategySchedule struct {
+	Strategy string   `yaml:"strategy"`
+	Days     []string `yaml:"days"`
+	From     string   `yaml:"from"`
+	To       string   `yaml:"to"`
+	Timezone string   `yaml:"timezone"`
+
+	days     map[time.Weekday]bool
+	from, to int // Minutes since midnight
+	location *time.Location
+}
+
+func (s *StrategySchedule) init() (err error) {
+	if s.Strategy != strategySpread && s.Strategy != strategyBinpack {
+		return fmt.Errorf("unknown strategy %q", s.Strategy)
+	}
+	s.days = map[time.Weekday]bool{}
+	for _, day := range s.Days {
+		weekday, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return fmt.Errorf("unknown day %q, expected mon, tue, wed, thu, fri, sat or sun", day)
+		}
+		s.days[weekday] = true
+	}
+	if len(s.days) == 0 {
+		for _, weekday := range weekdays {
+			s.days[weekday] = true
+		}
+	}
+	if s.from, err = parseClock(s.From); err != nil {
+		return fmt.Errorf("from: %s", err)
+	}
+	if s.to, err = parseClock(s.To); err != nil {
+		return fmt.Errorf("to: %s", err)
+	}
+	if s.location, err = time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("timezone: %s", err)
+	}
+	return nil
+}
+
+// Returns the minutes since midnight of a HH:MM time
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Returns true if the time is in the window of the schedule
+func (s *StrategySchedule) active(now time.Time) bool {
+	now = now.In(s.location)
+	minutes := now.Hour()*60 + now.Minute()
+	if s.from < s.to {
+		return s.days[now.Weekday()] && minutes >= s.from && minutes < s.to
+	}
+	// Past midnight the window belongs to the day it started
+	yesterday := now.AddDate(0, 0, -1).Weekday()
+	return (s.days[now.Weekday()] && minutes >= s.from) || (s.days[yesterday] && minutes < s.to)
+}
+
+// Returns the index of the first schedule of the profile active at the time, -1 if none is
+func (p *Profile) activeSchedule(now time.Time) int {
+	for i := range p.Schedules {
+		if p.Schedules[i].active(now) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Switches the strategy of the configuration profiles while one of their schedules is active,
+// and back to the strategy of the file when it ends, until the context is done. An active
+// schedule wins over the strategy of the tuning ConfigMap.
+func (s *Scheduler) watchSchedules(ctx context.Context) {
+	active := map[string]int{}
+	for _, profile := range s.config.Profiles {
+		active[profile.Name] = -1
+	}
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		for _, profile := range s.config.Profiles {
+			index := profile.activeSchedule(now)
+			if index >= 0 {
+				schedule := profile.Schedules[index]
+				s.switchStrategy(ctx, profile, schedule.Strategy, fmt.Sprintf("schedule %s-%s is active", schedule.From, schedule.To))
+			} else if active[profile.Name] >= 0 {
+				s.switchStrategy(ctx, profile, profile.Strategy, "no schedule is active")
+			}
+			active[profile.Name] = index
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Replaces the profile in use with a copy using the strategy, and records an event about it.
+// Only the strategy changes: the copy shares the provider, the scorers and the smoothed and
+// prefetched values of the profile, so a switch doesn't reset the smoothing.
+func (s *Scheduler) switchStrategy(ctx context.Context, profile *Profile, strategy, reason string) {
+	current := s.profiles.staticByName(profile.Name)
+	if current == nil || current.Strategy == strategy {
+		return
+	}
+	switched := *current
+	switched.Strategy = strategy
+	s.profiles.setStatic(&switched)
+
+	message := fmt.Sprintf("Profile %s switched from the %s to the %s strategy: %s", profile.Name, current.Strategy, strategy, reason)
+	log.Println(message)
+	s.reportSchedulerEvent(ctx, profile.SchedulerName, "StrategySwitched", message)
+}
+
+// Records a Normal event on the pod of the scheduler, known from the POD_NAME and POD_NAMESPACE
+// env of the downward api. Without them the event is not recorded.
+func (s *Scheduler) reportSchedulerEvent(ctx context.Context, component, reason, message string) {
+	name, okName := os.LookupEnv("POD_NAME")
+	namespace, okNamespace := os.LookupEnv("POD_NAMESPACE")
+	if !okName || !okNamespace {
+		return
+	}
+	event := kubernetes.NewEvent("Pod", namespace, name, "", component, "Normal", reason, message)
+	if err := s.kubeAPI.CreateEvent(ctx, event); err != nil {
+		log.Printf("Error creating the %s event of %s: %s", reason, name, err)
+	}
+}
@@ -0,0 +1,434 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/cache"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+	"github.com/draios/kubernetes-scheduler/pkg/sysdig"
+	"github.com/draios/kubernetes-scheduler/pkg/tracing"
+)
+
+// SchedulerOptions are the settings of a Scheduler: the loaded configuration, whose profiles get
+// their metric providers from it, the admin server serving the pprof profiles or not, and the
+// clients. The kubeconfig file is used with its context, the current one if empty; without a file
+// the env KUBECONFIG, or the service account of the pod, is used.
+type SchedulerOptions struct {
+	Config      Config
+	Profiling   bool
+	Kubeconfig  string
+	KubeContext string
+	SysdigToken string // Token the Sysdig provider reads the metrics with
+}
+
+// Scheduler runs the scheduling loop of a configuration: the watches, the background loops, the
+// HTTP servers and the scheduling attempts of the pods. It owns its Kubernetes and Sysdig clients,
+// caches and state, so several schedulers can run in the same process.
+type Scheduler struct {
+	options  SchedulerOptions
+	inFlight sync.WaitGroup // Scheduling attempts, waited for on shutdown so no binding is cut mid-request
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	kubeAPI     kubernetes.KubernetesCoreV1Api
+	sysdigAPI   sysdig.SysdigApiClient
+	config      Config
+	profiles    profileSet
+	cachedNodes cache.Cache
+	// Store of the metric values read from the providers, shared by the replicas with Redis.
+	// The memory store is used until the configuration is loaded.
+	metricCache cache.Store
+	fetches     *metricFetches
+	// Offset of the first node scored by the next attempt, so every node is scored over time
+	nextNodeToScore uint32
+
+	health            healthState
+	queue             *schedulingQueue
+	reservations      *reservationSet
+	recoveredPods     *recoveredSet
+	unschedulablePods *unschedulablePodSet
+	gatedPods         *gatedPodSet
+	gangs             gangScheduler
+	pins              *ordinalPins
+	clusters          map[string]*remoteCluster
+	nodePoolResources *nodePoolSet
+	transitions       *readyTransitions
+	breakers          circuitBreakers
+	alerted           *alertExclusions
+	features          featureFlags
+	experiments       *experimentOutcomes
+	observer          *observedDecisions
+	shadow            *shadowComparisons
+	history           *scoreHistory
+	gauges            scoreGauges
+	ledger            *bindingLedger
+	limits            *profileLimiters
+	bindLimits        *bindLimiter
+	auditLog          *auditLogger
+	notifications     *notifier
+
+	roundRobinMutex   sync.Mutex
+	roundRobinNext    map[string]int // Next round robin position indexed by profile name
+	lastBindingsMutex sync.Mutex
+	lastBindings      map[string]time.Time // Last time a pod was bound to a node, indexed by node name
+
+	serversMutex sync.Mutex
+	servers      []*http.Server
+}
+
+// Returns a scheduler with empty state and clients, before the configuration is loaded
+func newScheduler() *Scheduler {
+	s := &Scheduler{
+		stop:              make(chan struct{}),
+		cachedNodes:       cache.Cache{Timeout: 15 * time.Second},
+		metricCache:       cache.NewMemory(),
+		fetches:           &metricFetches{calls: map[string]*metricFetch{}},
+		health:            healthState{reason: "starting"},
+		queue:             &schedulingQueue{ready: make(chan struct{}, 1)},
+		reservations:      &reservationSet{pods: map[string]reservation{}},
+		recoveredPods:     &recoveredSet{uids: map[string]bool{}},
+		unschedulablePods: &unschedulablePodSet{pods: map[string]unschedulablePod{}},
+		gatedPods:         &gatedPodSet{pods: map[string]bool{}},
+		gangs:             gangScheduler{groups: map[string]*podGroup{}},
+		pins:              &ordinalPins{nodes: map[string]string{}},
+		clusters:          map[string]*remoteCluster{},
+		nodePoolResources: &nodePoolSet{pools: map[string]nodePoolResource{}},
+		transitions:       &readyTransitions{nodes: map[string]*nodeTransitions{}},
+		breakers:          circuitBreakers{nodes: map[string]*circuitState{}},
+		alerted:           &alertExclusions{nodes: map[string]alertExclusion{}},
+		features:          featureFlags{overrides: map[string]FeatureFlag{}},
+		experiments:       &experimentOutcomes{arms: map[string]map[string]*experimentArm{}, pods: map[string]*experimentPod{}},
+		observer:          &observedDecisions{pods: map[string]*observedPod{}, outcomes: observedOutcomes},
+		shadow:            &shadowComparisons{pods: map[string]*shadowPod{}, decisions: shadowDecisions},
+		history:           newScoreHistory(0, 0),
+		gauges:            scoreGauges{profiles: map[string]map[string]nodeGauges{}},
+		ledger:            &bindingLedger{nodes: map[string][]ledgerEntry{}},
+		limits:            &profileLimiters{byName: map[string]*profileLimiter{}},
+		roundRobinNext:    map[string]int{},
+		lastBindings:      map[string]time.Time{},
+	}
+	s.profiles.scheduler = s
+	s.queue.scheduler = s
+	s.reservations.scheduler = s
+	s.unschedulablePods.scheduler = s
+	s.gangs.scheduler = s
+	s.pins.scheduler = s
+	s.transitions.scheduler = s
+	s.breakers.scheduler = s
+	s.features.scheduler = s
+	s.experiments.scheduler = s
+	s.observer.scheduler = s
+	s.shadow.scheduler = s
+	return s
+}
+
+// Returns the scheduler of the options, with its clients, the metric providers, the caches and the
+// sinks of its configuration ready
+func NewScheduler(options SchedulerOptions) (*Scheduler, error) {
+	s := newScheduler()
+	var err error
+	if options.Kubeconfig == "" {
+		err = s.kubeAPI.LoadKubeConfig()
+	} else {
+		err = s.kubeAPI.LoadKubeConfigFile(options.Kubeconfig)
+	}
+	if err == nil && options.KubeContext != "" {
+		err = s.kubeAPI.UseContext(options.KubeContext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.sysdigAPI.SetToken(options.SysdigToken)
+	if err := s.init(options); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Loads the configuration of the options in the scheduler, whose clients are ready
+func (s *Scheduler) init(options SchedulerOptions) error {
+	c := options.Config
+	if c.Observer != nil {
+		log.Printf("Observer mode, nothing is bound, disabled: %s", strings.Join(c.observe(), ", "))
+	} else if c.MinimalRBAC {
+		c.minimizeRBAC()
+	}
+	for _, profile := range c.Profiles {
+		provider, err := s.newProvider(profile.providerConfig(c))
+		if err != nil {
+			return err
+		}
+		if _, ok := provider.(metrics.SeriesProvider); profile.hasStability() && !ok {
+			return fmt.Errorf("profile %q: the %s provider can't read the stability of the metrics", profile.Name, provider.Name())
+		}
+		if _, ok := provider.(metrics.SeriesProvider); profile.hasMemoryTrend() && !ok {
+			return fmt.Errorf("profile %q: the %s provider can't read the memory trend of the nodes", profile.Name, provider.Name())
+		}
+		if _, ok := provider.(metrics.SeriesProvider); len(profile.Windows) > 0 && !ok {
+			return fmt.Errorf("profile %q: the %s provider can't read the metrics over windows", profile.Name, provider.Name())
+		}
+		if _, ok := provider.(metrics.ScopedProvider); profile.hasScopedMetrics() && !ok {
+			return fmt.Errorf("profile %q: the %s provider can't read scoped metrics", profile.Name, provider.Name())
+		}
+		profile.setProvider(s, provider)
+	}
+	for i := range c.NamespaceQuotas {
+		if err := c.NamespaceQuotas[i].init(s, c); err != nil {
+			return err
+		}
+	}
+	if err := c.Sharding.init(&s.kubeAPI); err != nil {
+		return err
+	}
+	if err := s.loadClusters(c); err != nil {
+		return err
+	}
+	store, err := s.newMetricCache(context.Background(), c.Cache)
+	if err != nil {
+		return err
+	}
+
+	s.config = c
+	s.metricCache = store
+	// A copy, the tuning replaces the served profiles and keeps the configuration ones
+	s.profiles.static = append([]*Profile(nil), c.Profiles...)
+	s.auditLog = s.newAuditLogger(c.Audit)
+	s.notifications = newNotifier(c.Notifications)
+	s.history = newScoreHistory(c.Admin.NodeHistory, c.Admin.PodHistory)
+	s.bindLimits = newBindLimiter(c.BindRateLimit)
+	if c.Tracing.Endpoint != "" {
+		tracing.Init(&tracing.Exporter{Endpoint: c.Tracing.Endpoint, ServiceName: c.Tracing.ServiceName, Headers: c.Tracing.Headers})
+	}
+	if c.WarmUp.BindingsPerMinute > 0 {
+		// The bindings of the last minute are counted by the ledger
+		s.ledger.retain(time.Minute)
+	}
+	s.options = options
+	return nil
+}
+
+// Schedules the pods until the context is done, Stop is called or the pod watch is closed, then
+// shuts down cleanly: no new pod is accepted, the attempts in flight are waited for up to the
+// shutdown timeout and the state, audit and notifications are flushed. Returns an error if the
+// Kubernetes version is not supported, a permission is missing or the pod watch can't be opened.
+func (s *Scheduler) Run(ctx context.Context) error {
+	// Cancelled when the scheduler stops, aborting any request still running
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Published in the runtime variables while it runs
+	running.add(s)
+	defer running.remove(s)
+
+	// Requests are adapted to the version of the api server, the unsupported ones are refused
+	if err := s.detectKubernetesVersion(ctx); err != nil {
+		return err
+	}
+
+	// Fails fast rather than on the first pod needing a missing permission, before anything started
+	if err := s.checkPermissions(ctx, &s.config); err != nil {
+		return err
+	}
+
+	// Nodes and pods are read from memory once listed
+	s.kubeAPI.StartInformers(ctx)
+
+	go s.gangs.retryLoop(ctx)
+	go s.watchNodes(ctx)
+	for _, experiment := range s.config.Experiments {
+		go s.reportExperiments(ctx, experiment)
+	}
+
+	if s.config.Sharding.ShardsFromReplicas {
+		go s.watchShardReplicas(ctx, s.config.Sharding)
+	}
+
+	for _, profile := range s.config.Profiles {
+		if profile.PrefetchInterval > 0 {
+			go s.prefetchLoop(ctx, profile)
+		}
+	}
+
+	if s.config.WatchPolicies {
+		go s.watchPolicies(ctx)
+	}
+	if s.config.WatchNodePools {
+		go s.watchNodePools(ctx)
+	}
+
+	if s.config.Tuning != nil {
+		go s.watchTuning(ctx)
+	}
+
+	if s.config.hasSchedules() {
+		go s.watchSchedules(ctx)
+	}
+
+	if s.config.ClusterAutoscaler || s.config.Provisioning.Enabled {
+		go s.watchNewNodes(ctx)
+	}
+
+	if s.config.Extender.Address != "" {
+		profile := s.config.Profiles[0]
+		if s.config.Extender.Profile != "" {
+			profile = s.config.profileByName(s.config.Extender.Profile)
+		}
+		s.startHTTPServer("extender", s.config.Extender.Address, s.config.Extender.ServerSecurity, s.extenderHandler(profile))
+	}
+
+	if s.config.Descheduler.Metric != "" {
+		profile := s.config.Profiles[0]
+		if s.config.Descheduler.Profile != "" {
+			profile = s.config.profileByName(s.config.Descheduler.Profile)
+		}
+		go s.runDescheduler(ctx, profile)
+	}
+
+	if s.config.Admin.Address != "" {
+		s.startHTTPServer("admin", s.config.Admin.Address, s.config.Admin.ServerSecurity, s.adminHandler(s.options.Profiling))
+		if s.config.Admin.ScoreInterval > 0 {
+			go s.exportScoresLoop(ctx, s.config.Admin.ScoreInterval)
+		}
+	}
+
+	if s.config.NodeScores.Target != "" {
+		go s.publishNodeScoresLoop(ctx, s.config.NodeScores)
+	}
+
+	// Restored before the first pod is scheduled, so the pending pods see the bindings made before the restart
+	if s.config.State != nil {
+		if err := s.restoreState(ctx, *s.config.State); err != nil {
+			log.Println("error while restoring the state:", err)
+		}
+		go s.saveStateLoop(ctx, *s.config.State)
+	}
+
+	// Without the watch trigger, the pending pods wait for their trigger again
+	if s.config.Trigger.watch() && s.config.Observer == nil {
+		s.recoverPendingPods(ctx)
+	}
+	if s.config.Trigger.Mode == triggerQueue && s.config.Observer == nil {
+		go s.subscribeTriggers(ctx, s.config.Trigger)
+	}
+
+	// Opened again when it ends, the pods changed meanwhile are listed when its version is too old
+	ch := s.kubeAPI.WatchEvents(ctx, "api/v1/pods")
+	s.health.set(true, "")
+
+	go s.dispatch(ctx, &s.inFlight)
+
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				// Only closed once the context is done
+				s.health.set(false, "shutting down")
+				s.shutdown()
+				return nil
+			}
+			s.inFlight.Add(1)
+			go func(data []byte) {
+				defer s.inFlight.Done()
+				s.handlePodEvent(ctx, data)
+			}(data)
+		case <-s.stop:
+			log.Println("stopping, no more pods will be accepted")
+			s.health.set(false, "shutting down")
+			s.shutdown()
+			return nil
+		case <-ctx.Done():
+			s.health.set(false, "shutting down")
+			s.shutdown()
+			return nil
+		}
+	}
+}
+
+// Waits for the in-flight scheduling attempts up to the shutdown timeout, then flushes the sinks
+func (s *Scheduler) shutdown() {
+	s.queue.close()
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+	s.stopHTTPServers(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("all in-flight bindings finished, exiting")
+	case <-ctx.Done():
+		log.Printf("shutdown timeout of %s reached, exiting with bindings still in flight", s.config.ShutdownTimeout)
+	}
+	if s.config.State != nil {
+		if err := s.saveState(ctx, *s.config.State); err != nil {
+			log.Println("error while saving the state:", err)
+		}
+	}
+	s.auditLog.close(ctx)
+	s.notifications.close(ctx)
+	tracing.Shutdown(ctx)
+}
+
+// Stops the scheduler, Run returns once it has shut down
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// Schedulers running in the process, in the order they started
+type runningSchedulers struct {
+	mutex      sync.Mutex
+	schedulers []*Scheduler
+}
+
+var running = &runningSchedulers{}
+
+func (r *runningSchedulers) add(s *Scheduler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.schedulers = append(r.schedulers, s)
+}
+
+func (r *runningSchedulers) remove(s *Scheduler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, scheduler := range r.schedulers {
+		if scheduler == s {
+			r.schedulers = append(r.schedulers[:i:i], r.schedulers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Returns a copy of the running schedulers
+func (r *runningSchedulers) all() []*Scheduler {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*Scheduler(nil), r.schedulers...)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+func TestNewSchedulerKubeconfig(t *testing.T) {
+	_, err := NewScheduler(SchedulerOptions{Kubeconfig: filepath.Join(t.TempDir(), "missing")})
+	if err == nil {
+		t.Fatal("NewScheduler() with a missing kubeconfig returned no error")
+	}
+}
+
+func TestSchedulersHaveTheirOwnState(t *testing.T) {
+	var node kubernetes.KubeNode
+	node.Metadata.Name = "node-1"
+	node.Status.Allocatable = map[string]string{"cpu": "4", "pods": "110"}
+	nodes := []kubernetes.KubeNode{node}
+
+	first, second := testScheduler(Config{}), testScheduler(Config{})
+	for _, s := range []*Scheduler{first, second} {
+		s.fakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"items": []kubernetes.KubePod{}})
+		})
+	}
+	first.reservations.pods["default/pending"] = reservation{"node-1", resourceList{"cpu": 2, "pods": 1}, time.Now()}
+
+	free, err := first.freeByNode(context.Background(), nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free["node-1"]["cpu"] != 2 {
+		t.Errorf("free with the reservation %v, want 2 cpu", free["node-1"])
+	}
+	free, err = second.freeByNode(context.Background(), nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free["node-1"]["cpu"] != 4 {
+		t.Errorf("free on the other scheduler %v, want 4 cpu", free["node-1"])
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Sysdig labels of the scope of the scoped metric scorer, taken from the pod being scheduled
+const (
+	namespaceScopeLabel = "kubernetes.namespace.name"
+	podLabelScopePrefix = "kubernetes.pod.label."
+)
+
+// Scores the nodes with a metric of the containers sharing a scope with the pod, like the cpu used
+// by its namespace or by the pods with the same app label, summed over the containers of the node.
+// The scope is a list of kubernetes.namespace.name and kubernetes.pod.label.KEY labels.
+type scopedMetricScorer struct {
+	profile *Profile
+	metric  string
+	scope   []string
+}
+
+// Returns an error if a label of the scope can't be taken from the pod
+func validateScope(scope []string) error {
+	if len(scope) == 0 {
+		return fmt.Errorf("scope must be set")
+	}
+	for _, label := range scope {
+		if label != namespaceScopeLabel && (!strings.HasPrefix(label, podLabelScopePrefix) || label == podLabelScopePrefix) {
+			return fmt.Errorf("unsupported scope label %q, only %s and %sKEY", label, namespaceScopeLabel, podLabelScopePrefix)
+		}
+	}
+	return nil
+}
+
+// Returns true if a scorer of the profile reads scoped metrics
+func (p *Profile) hasScopedMetrics() bool {
+	for _, scorer := range p.Scorers {
+		if scorer.Type == "scoped-metric" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scopedMetricScorer) Name() string {
+	return s.metric
+}
+
+func (s *scopedMetricScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (float64, error) {
+	provider, ok := s.profile.provider.(metrics.ScopedProvider)
+	if !ok {
+		return 0, fmt.Errorf("the %s provider can't read scoped metrics", s.profile.provider.Name())
+	}
+
+	scope := map[string]string{}
+	for _, label := range s.scope {
+		if label == namespaceScopeLabel {
+			scope[label] = pod.Namespace
+			continue
+		}
+		value, ok := pod.Labels[strings.TrimPrefix(label, podLabelScopePrefix)]
+		if !ok {
+			// Nothing shares the scope of a pod without the label
+			return 0, nil
+		}
+		scope[label] = value
+	}
+
+	values, err := provider.ScopedMetrics(ctx, node.Name, scope, []string{s.metric})
+	if err == metrics.NoDataFound {
+		// No container of the scope runs on the node
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s of node %s: %s", s.metric, node.Name, err)
+	}
+	return values[0], nil
+}
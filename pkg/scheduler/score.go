@@ -0,0 +1,207 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// A node of the ranking printed by the score command
+type rankedNode struct {
+	Node    string             `json:"node"`
+	Score   *float64           `json:"score,omitempty"`
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+// Flags of the commands reading the metrics of the nodes with the metrics given on the command
+// line or a profile of a configuration file
+type profileFlags struct {
+	metricNames    *string
+	strategy       *string
+	configFile     *string
+	profileName    *string
+	token          *string
+	kubeConfigFile *string
+	kubeContext    *string
+}
+
+// Registers the flags of the profile, the Sysdig token and the Kubernetes config
+func newProfileFlags(flags *flag.FlagSet) profileFlags {
+	f := profileFlags{
+		metricNames:    flags.String("metric", "", "Comma separated Sysdig metrics, weighted equally"),
+		strategy:       flags.String("strategy", strategySpread, "spread: the lowest score is the best, binpack: the highest"),
+		configFile:     flags.String("c", "", "Configuration file, to use one of its profiles instead of -metric"),
+		profileName:    flags.String("profile", "", "Profile of the configuration file, the first one by default"),
+		token:          flags.String("t", "", "Sysdig Cloud token, SDC_TOKEN by default"),
+		kubeConfigFile: flags.String("k", "", "Kubernetes config file"),
+		kubeContext:    flags.String("context", "", "Context of the Kubernetes config file, instead of its current context"),
+	}
+	flags.StringVar(f.kubeConfigFile, "kubeconfig", "", "Kubernetes config file, same as -k")
+	return f
+}
+
+// Returns the profile of the flags with its provider, once the configuration and the Kubernetes
+// config are loaded in the scheduler. Exits on errors.
+func (f profileFlags) load(s *Scheduler, flags *flag.FlagSet, name string) (profile *Profile) {
+	if *f.configFile != "" {
+		var err error
+		if s.config, err = LoadConfig(*f.configFile); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+		profile = s.config.Profiles[0]
+		if *f.profileName != "" {
+			if profile = s.config.profileByName(*f.profileName); profile == nil {
+				fmt.Printf("Error: profile %q is not defined\n", *f.profileName)
+				os.Exit(2)
+			}
+		}
+	} else {
+		if *f.metricNames == "" {
+			fmt.Println("Error: -metric or -c must be set")
+			flags.Usage()
+			os.Exit(2)
+		}
+		profile = &Profile{Name: name, SchedulerName: name, Strategy: *f.strategy}
+		for _, metric := range strings.Split(*f.metricNames, ",") {
+			profile.Metrics = append(profile.Metrics, MetricConfig{Name: strings.TrimSpace(metric)})
+		}
+		if err := profile.init(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+		s.config.Profiles = []*Profile{profile}
+		s.config.setDefaults()
+	}
+
+	if *f.kubeConfigFile != "" {
+		os.Setenv("KUBECONFIG", *f.kubeConfigFile)
+	}
+	if err := s.kubeAPI.LoadKubeConfig(); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	if *f.kubeContext != "" {
+		if err := s.kubeAPI.UseContext(*f.kubeContext); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+	}
+	if *f.token != "" {
+		s.sysdigAPI.SetToken(*f.token)
+	} else if envToken, ok := os.LookupEnv("SDC_TOKEN"); ok {
+		s.sysdigAPI.SetToken(envToken)
+	} else if s.config.needsSysdigToken() {
+		fmt.Println("Error: Sysdig Cloud token is not set.")
+		os.Exit(2)
+	}
+	provider, err := s.newProvider(profile.providerConfig(s.config))
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	profile.setProvider(s, provider)
+	return
+}
+
+// Scores the ready nodes with the metrics given on the command line or a profile of a configuration
+// file, and prints them from the best to the worst without scheduling anything
+func (s *Scheduler) runScore(args []string) {
+	flags := flag.NewFlagSet("score", flag.ExitOnError)
+	profileFlags := newProfileFlags(flags)
+	output := flags.String("o", "table", "Output format: table or json")
+	flags.Parse(args)
+
+	if *output != "table" && *output != "json" {
+		fmt.Printf("Error: unknown output %q\n", *output)
+		os.Exit(2)
+	}
+	profile := profileFlags.load(s, flags, "score")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.SchedulingTimeout)
+	defer cancel()
+	var names []string
+	for _, node := range s.nodesAvailable(ctx) {
+		names = append(names, node.Metadata.Name)
+	}
+	ranking := rankNodes(profile, s.scoreNodes(ctx, profile, kubernetes.KubePod{}, names))
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(ranking)
+		return
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	header := []string{"RANK", "NODE", "SCORE"}
+	for _, name := range profile.metricNames {
+		header = append(header, strings.ToUpper(name))
+	}
+	fmt.Fprintln(writer, strings.Join(append(header, "ERROR"), "\t"))
+	for i, node := range ranking {
+		row := []string{fmt.Sprint(i + 1), node.Node, "-"}
+		if node.Score != nil {
+			row[2] = fmt.Sprintf("%.4g", *node.Score)
+		}
+		for _, name := range profile.metricNames {
+			if value, ok := node.Metrics[name]; ok {
+				row = append(row, fmt.Sprintf("%.4g", value))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintln(writer, strings.Join(append(row, node.Error), "\t"))
+	}
+	writer.Flush()
+}
+
+// Orders the scored nodes from the best to the worst for the profile strategy, the failed ones last
+func rankNodes(profile *Profile, scored NodeList) (ranking []rankedNode) {
+	sort.SliceStable(scored, func(i, j int) bool {
+		if (scored[i].err == nil) != (scored[j].err == nil) {
+			return scored[i].err == nil
+		}
+		if profile.lowerIsBetter() {
+			return scored[i].score < scored[j].score
+		}
+		return scored[i].score > scored[j].score
+	})
+	for _, node := range scored {
+		ranked := rankedNode{Node: node.name}
+		if node.err != nil {
+			ranked.Error = node.err.Error()
+		} else {
+			score := node.score
+			ranked.Score, ranked.Metrics = &score, map[string]float64{}
+			for i, name := range node.metricNames(profile) {
+				ranked.Metrics[name] = node.metrics[i]
+			}
+		}
+		ranking = append(ranking, ranked)
+	}
+	return
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Source of the randomized behaviors: the jitter of the retries and of the trigger reconnections,
+// the injected faults and the errors of the Sysdig mock. Seeded with the Seed of the configuration
+// the same run draws the same values, the time is used otherwise.
+var random = rand.New(&lockedSource{source: rand.NewSource(time.Now().UnixNano())})
+
+// A rand.Source safe for concurrent use, like the one of the top-level functions of math/rand
+type lockedSource struct {
+	mutex  sync.Mutex
+	source rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.source.Seed(seed)
+}
+
+// Seeds the random source, nothing is done for 0
+func seedRandom(seed int64) {
+	if seed != 0 {
+		random.Seed(seed)
+	}
+}
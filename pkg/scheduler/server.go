@@ -0,0 +1,72 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Starts an HTTP server in the background, over TLS and with authentication if the security
+// settings ask for it. It is stopped on shutdown.
+func (s *Scheduler) startHTTPServer(name, address string, security ServerSecurity, handler http.Handler) {
+	tlsConfig, err := security.tlsConfig()
+	if err != nil {
+		log.Fatalf("fatal: %s server: %s", name, err)
+	}
+	server := &http.Server{Addr: address, Handler: authenticate(security, handler), TLSConfig: tlsConfig}
+
+	s.serversMutex.Lock()
+	s.servers = append(s.servers, server)
+	s.serversMutex.Unlock()
+
+	go func() {
+		log.Printf("%s listening on %s", name, address)
+		var err error
+		if tlsConfig != nil {
+			// The certificate comes from the TLS configuration, reloaded when its files change
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("fatal: %s server: %s", name, err)
+		}
+	}()
+}
+
+// Stops accepting connections and waits for the active requests to finish
+func (s *Scheduler) stopHTTPServers(ctx context.Context) {
+	s.serversMutex.Lock()
+	defer s.serversMutex.Unlock()
+	for _, server := range s.servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("error while stopping the server on", server.Addr, err)
+		}
+	}
+}
+
+// Writes the value as a json response
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Println("error while writing the response:", err)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Outcomes of the shadow comparisons
+const (
+	shadowAgree    = "agree"    // The pod was bound to the best node of the shadow profile
+	shadowDisagree = "disagree" // The pod was bound to another node
+	shadowUnscored = "unscored" // The shadow profile found no node for the pod
+)
+
+// Pod compared with the shadow profile, the comparison is made once both nodes are known
+type shadowPod struct {
+	ranked  bool
+	ranking []string // Nodes ranked by the shadow profile, best first
+	bound   string
+}
+
+// Comparisons of the shadow profile with the scheduler of the pods
+type shadowComparisons struct {
+	scheduler *Scheduler
+	mutex     sync.Mutex
+	pods      map[string]*shadowPod
+	decisions *expvar.Map
+}
+
+// Outcomes of the shadow comparisons, counted over the schedulers of the process
+var shadowDecisions = expvar.NewMap("shadowDecisions")
+
+// Follows the pods of the compared scheduler: a pending pod is ranked by the shadow profile, and
+// compared when it is bound
+func (s *shadowComparisons) observe(ctx context.Context, event kubernetes.KubePodEvent) {
+	pod := event.Object
+	key := pod.Metadata.Namespace + "/" + pod.Metadata.Name + "/" + pod.Metadata.UID
+	if event.Type == "DELETED" {
+		s.mutex.Lock()
+		delete(s.pods, key)
+		s.mutex.Unlock()
+		return
+	}
+	if pod.Spec.SchedulerName != s.scheduler.config.Shadow.SchedulerName {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tracked, ok := s.pods[key]
+	switch {
+	case !ok && pod.Spec.NodeName == "" && pod.Status.Phase == "Pending":
+		s.pods[key] = &shadowPod{}
+		go s.rank(ctx, key, pod)
+	case ok && pod.Spec.NodeName != "" && tracked.bound == "":
+		tracked.bound = pod.Spec.NodeName
+		s.compare(key, tracked)
+	}
+}
+
+// Ranks the nodes for the pod with the shadow profile, without binding it
+func (s *shadowComparisons) rank(ctx context.Context, key string, pod kubernetes.KubePod) {
+	ctx, cancel := context.WithTimeout(ctx, s.scheduler.config.SchedulingTimeout)
+	defer cancel()
+	var ranking []string
+	if profile := s.scheduler.profiles.staticByName(s.scheduler.config.Shadow.Profile); profile != nil {
+		for _, node := range s.scheduler.placeNodes(ctx, profile, pod).Nodes {
+			if node.Score != nil {
+				ranking = append(ranking, node.Node)
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tracked, ok := s.pods[key]
+	if !ok {
+		return
+	}
+	tracked.ranked, tracked.ranking = true, ranking
+	s.compare(key, tracked)
+}
+
+// Counts the outcome of the comparison once the pod is ranked and bound, the mutex being held
+func (s *shadowComparisons) compare(key string, tracked *shadowPod) {
+	if !tracked.ranked || tracked.bound == "" {
+		return
+	}
+	delete(s.pods, key)
+
+	outcome := shadowDisagree
+	switch {
+	case len(tracked.ranking) == 0:
+		outcome = shadowUnscored
+	case tracked.ranking[0] == tracked.bound:
+		outcome = shadowAgree
+	default:
+		rank := "not a candidate"
+		for i, node := range tracked.ranking {
+			if node == tracked.bound {
+				rank = fmt.Sprintf("ranked %d of %d", i+1, len(tracked.ranking))
+			}
+		}
+		log.Printf("Shadow profile %s would have bound %s to %s instead of %s (%s)", s.scheduler.config.Shadow.Profile, key, tracked.ranking[0], tracked.bound, rank)
+	}
+	s.decisions.Add(outcome, 1)
+}
+
+// Writes the comparisons of the shadow profile as Prometheus counters
+func (s *shadowComparisons) write(w http.ResponseWriter) {
+	if s.scheduler.config.Shadow == nil {
+		return
+	}
+	var lines []string
+	for _, outcome := range []string{shadowAgree, shadowDisagree, shadowUnscored} {
+		var count int64
+		if value, ok := s.decisions.Get(outcome).(*expvar.Int); ok {
+			count = value.Value()
+		}
+		lines = append(lines, fmt.Sprintf("sysdig_scheduler_shadow_decisions_total{profile=%s,scheduler=%s,outcome=%s} %d",
+			promLabel(s.scheduler.config.Shadow.Profile), promLabel(s.scheduler.config.Shadow.SchedulerName), promLabel(outcome), count))
+	}
+	sort.Strings(lines)
+	fmt.Fprintln(w, "# HELP sysdig_scheduler_shadow_decisions_total Pods bound by the compared scheduler to the best node of the shadow profile or not.")
+	fmt.Fprintln(w, "# TYPE sysdig_scheduler_shadow_decisions_total counter")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Ordinal ending the name of a StatefulSet pod
+var hostnameOrdinal = regexp.MustCompile(`-(\d+)$`)
+
+// How often the replicas of the StatefulSet are read, with shardsFromReplicas
+const shardReplicasInterval = 30 * time.Second
+
+func (s ShardingConfig) validate() error {
+	if s.Shards < 0 {
+		return errors.New("sharding: shards can't be negative")
+	}
+	if s.ShardsFromReplicas && (s.Shards == 0 || !s.ShardFromHostname) {
+		return errors.New("sharding: shardsFromReplicas needs shards and shardFromHostname")
+	}
+	if s.Shards > 0 && !s.ShardFromHostname && (s.Shard < 0 || s.Shard >= s.Shards) {
+		return fmt.Errorf("sharding: shard must be between 0 and %d", s.Shards-1)
+	}
+	return nil
+}
+
+// Reads the shard from the hostname if asked to, and the shards from the replicas of the
+// StatefulSet with the client
+func (s *ShardingConfig) init(api *kubernetes.KubernetesCoreV1Api) error {
+	if s.Shards == 0 {
+		return nil
+	}
+	if s.ShardFromHostname {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("sharding: %s", err)
+		}
+		match := hostnameOrdinal.FindStringSubmatch(hostname)
+		if match == nil {
+			return fmt.Errorf("sharding: hostname %s does not end with an ordinal", hostname)
+		}
+		s.Shard, _ = strconv.Atoi(match[1])
+		if s.ShardsFromReplicas {
+			namespace, ok := os.LookupEnv("POD_NAMESPACE")
+			if !ok {
+				return errors.New("sharding: POD_NAMESPACE must be set to read the replicas of the StatefulSet")
+			}
+			s.statefulSet, s.namespace, s.replicas = strings.TrimSuffix(hostname, match[0]), namespace, new(int32)
+			s.readReplicas(context.Background(), api)
+		} else if s.Shard >= s.Shards {
+			return fmt.Errorf("sharding: ordinal %d of hostname %s is past the %d shards", s.Shard, hostname, s.Shards)
+		}
+	}
+	log.Printf("Scheduling the pods of shard %d of %d", s.Shard, s.shards())
+	return nil
+}
+
+// Returns the number of shards, the replicas of the StatefulSet once read with ShardsFromReplicas
+func (s ShardingConfig) shards() int {
+	if s.replicas != nil {
+		if replicas := atomic.LoadInt32(s.replicas); replicas > 0 {
+			return int(replicas)
+		}
+	}
+	return s.Shards
+}
+
+// Reads the replicas of the StatefulSet into the shards and returns the previous number of
+// shards. The shards are kept if the StatefulSet can't be read.
+func (s ShardingConfig) readReplicas(ctx context.Context, api *kubernetes.KubernetesCoreV1Api) (previous int) {
+	previous = s.shards()
+	statefulSet, err := api.GetStatefulSet(ctx, s.namespace, s.statefulSet)
+	if err != nil {
+		log.Printf("Error reading the replicas of statefulset %s/%s, keeping %d shards: %s", s.namespace, s.statefulSet, previous, err)
+		return
+	}
+	if statefulSet.Spec.Replicas != nil && *statefulSet.Spec.Replicas > 0 {
+		atomic.StoreInt32(s.replicas, int32(*statefulSet.Spec.Replicas))
+	}
+	return
+}
+
+// Follows the replicas of the StatefulSet until the context is done. When they change, the pending
+// pods this replica didn't own and owns now are queued, the pods it already owned are queued already.
+func (s *Scheduler) watchShardReplicas(ctx context.Context, sharding ShardingConfig) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(shardReplicasInterval):
+		}
+
+		previous := sharding.readReplicas(ctx, &s.kubeAPI)
+		if sharding.shards() == previous {
+			continue
+		}
+		log.Printf("Scheduling the pods of shard %d of %d, instead of %d", sharding.Shard, sharding.shards(), previous)
+		if !s.config.Trigger.watch() {
+			// The triggered pods are sent again to the replica of their shard
+			continue
+		}
+		pods, err := s.kubeAPI.ListPods(ctx, "", "spec.nodeName=,status.phase=Pending")
+		if err != nil {
+			log.Println("error while listing the pending pods of the new shards:", err)
+			continue
+		}
+		for _, pod := range pods {
+			if profile := s.profiles.forPod(pod); profile != nil && !sharding.ownsOf(previous, pod) && sharding.owns(pod) {
+				s.admitPod(ctx, profile, pod)
+			}
+		}
+	}
+}
+
+// Returns true if the pod is scheduled by this replica. The pods of a group are owned by the
+// shard of the group, so it is bound together.
+func (s ShardingConfig) owns(pod kubernetes.KubePod) bool {
+	return s.ownsOf(s.shards(), pod)
+}
+
+// Returns true if the pod is scheduled by this replica when there are that many shards
+func (s ShardingConfig) ownsOf(shards int, pod kubernetes.KubePod) bool {
+	if shards <= 1 {
+		return true
+	}
+	key, ok := podGroupOf(pod)
+	if !ok {
+		key = pod.Metadata.Namespace + "/" + pod.Metadata.Name
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32()%uint32(shards)) == s.Shard
+}
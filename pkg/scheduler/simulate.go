@@ -0,0 +1,319 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+	"gopkg.in/yaml.v2"
+)
+
+// Cluster simulated by the simulate command: the nodes, the pods already on them and the metric
+// values of every node by metric name, the "*" node having the values of the nodes not listed
+type clusterSnapshot struct {
+	Nodes   []kubernetes.KubeNode         `json:"nodes"`
+	Pods    []kubernetes.KubePod          `json:"pods"`
+	Metrics map[string]map[string]float64 `json:"metrics"`
+}
+
+// Placement of a pod by the simulation
+type simulatedPlacement struct {
+	Namespace string   `json:"namespace"`
+	Pod       string   `json:"pod"`
+	Profile   string   `json:"profile"`
+	Node      string   `json:"node,omitempty"`
+	Score     *float64 `json:"score,omitempty"`
+	Outcome   string   `json:"outcome"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Schedules the pods of a file on a cluster snapshot, against an in-memory Kubernetes api and
+// the metric values of the snapshot, and prints the placements the profiles would choose
+func (s *Scheduler) runSimulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	snapshotFile := flags.String("snapshot", "", "JSON file with the nodes, the pods and the metric values of the cluster")
+	podsFile := flags.String("pods", "", "YAML or JSON file with the pods to place, - reads the standard input")
+	configFile := flags.String("c", "", "Configuration file with the profiles, instead of -metric and -strategy")
+	profileName := flags.String("profile", "", "Profile of the pods of no profile, the first one by default")
+	metricNames := flags.String("metric", "", "Comma separated metrics of the profile without configuration")
+	strategy := flags.String("strategy", strategySpread, "spread or binpack")
+	output := flags.String("o", "table", "Output format: table or json")
+	verbose := flags.Bool("v", false, "Print the logs of the attempts")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s simulate -snapshot CLUSTER.json -pods PODS.yaml [-c CONFIG | -metric METRICS] [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *snapshotFile == "" || *podsFile == "" || (*configFile == "" && *metricNames == "") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Printf("Error: unknown output %q\n", *output)
+		os.Exit(2)
+	}
+	if *configFile != "" {
+		var err error
+		if s.config, err = LoadConfig(*configFile); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+	} else {
+		profile := &Profile{Name: "simulate", SchedulerName: "simulate", Strategy: *strategy}
+		for _, name := range strings.Split(*metricNames, ",") {
+			profile.Metrics = append(profile.Metrics, MetricConfig{Name: strings.TrimSpace(name)})
+		}
+		if err := profile.init(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+		s.config.Profiles = []*Profile{profile}
+		s.config.setDefaults()
+	}
+	defaultProfile := s.config.Profiles[0]
+	if *profileName != "" {
+		if defaultProfile = s.config.profileByName(*profileName); defaultProfile == nil {
+			fmt.Printf("Error: profile %q is not defined\n", *profileName)
+			os.Exit(2)
+		}
+	}
+
+	snapshot, err := readSnapshot(*snapshotFile)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	pods, err := readPods(*podsFile)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	// Every profile reads the values of the snapshot
+	provider := &metrics.StaticProvider{Values: snapshot.Metrics}
+	for _, profile := range s.config.Profiles {
+		profile.setProvider(s, provider)
+	}
+	cluster := &benchCluster{nodes: snapshot.Nodes, pods: map[string]*kubernetes.KubePod{}, calls: map[string]int{}}
+	for _, pod := range snapshot.Pods {
+		cluster.add(pod)
+	}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+	if err := s.useBenchCluster(server.URL); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+	s.history = newScoreHistory(0, len(pods))
+	var placements []simulatedPlacement
+	// One pod at a time, in the order of the file, every placement is seen by the next pods
+	for i, pod := range pods {
+		profile := defaultProfile
+		for _, candidate := range s.config.Profiles {
+			if candidate.SchedulerName == pod.Spec.SchedulerName {
+				profile = candidate
+			}
+		}
+		pod = simulatedPod(pod, profile, i)
+		cluster.add(pod)
+		// The default scheduler is not simulated, its pods are left unplaced
+		enabled := profile.Fallback != fallbackDefaultScheduler
+		s.features.set(featureFallback, FeatureFlag{Enabled: &enabled})
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.SchedulingTimeout)
+		s.schedulePod(ctx, profile, pod)
+		cancel()
+		placements = append(placements, s.simulatedPlacementOf(profile, pod))
+	}
+	log.SetOutput(os.Stderr)
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(placements)
+		return
+	}
+	printPlacements(placements)
+}
+
+// Reads the cluster snapshot, the pods on a node are running
+func readSnapshot(file string) (snapshot clusterSnapshot, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("snapshot %s: %s", file, err)
+	}
+	for i, node := range snapshot.Nodes {
+		if node.Metadata.Name == "" {
+			return snapshot, fmt.Errorf("snapshot %s: node %d has no name", file, i)
+		}
+		if len(node.Status.Conditions) == 0 {
+			snapshot.Nodes[i].Status.Conditions = []kubernetes.KubeNodeStatusConditions{{Type: "Ready", Status: "True"}}
+		}
+	}
+	for i, pod := range snapshot.Pods {
+		if pod.Metadata.Namespace == "" {
+			snapshot.Pods[i].Metadata.Namespace = "default"
+		}
+		if pod.Status.Phase == "" && pod.Spec.NodeName != "" {
+			snapshot.Pods[i].Status.Phase = "Running"
+		}
+	}
+	return
+}
+
+// Reads the pods of a YAML or JSON file: pods, or lists of pods, in one or more documents
+func readPods(file string) (pods []kubernetes.KubePod, err error) {
+	var reader io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	decoder := yaml.NewDecoder(reader)
+	for {
+		var document interface{}
+		if err = decoder.Decode(&document); err == io.EOF {
+			return pods, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("pods %s: %s", file, err)
+		}
+		if document == nil {
+			continue
+		}
+		// The pods have the json names of the api
+		data, err := json.Marshal(jsonValue(document))
+		if err != nil {
+			return nil, fmt.Errorf("pods %s: %s", file, err)
+		}
+		var list struct {
+			Kind  string            `json:"kind"`
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(data, &list)
+		items := []json.RawMessage{data}
+		if list.Kind == "List" || list.Kind == "PodList" {
+			items = list.Items
+		}
+		for _, item := range items {
+			var pod kubernetes.KubePod
+			if err := json.Unmarshal(item, &pod); err != nil {
+				return nil, fmt.Errorf("pods %s: %s", file, err)
+			}
+			if pod.Metadata.Name == "" {
+				return nil, fmt.Errorf("pods %s: pod %d has no name", file, len(pods))
+			}
+			pods = append(pods, pod)
+		}
+	}
+}
+
+// Returns the value decoded from YAML with string keys, so it can be encoded to JSON
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		object := map[string]interface{}{}
+		for key, item := range value {
+			object[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return object
+	case []interface{}:
+		for i, item := range value {
+			value[i] = jsonValue(item)
+		}
+	}
+	return value
+}
+
+// Returns the pod pending for the profile, with the defaults of the api server
+func simulatedPod(pod kubernetes.KubePod, profile *Profile, i int) kubernetes.KubePod {
+	if pod.Metadata.Namespace == "" {
+		pod.Metadata.Namespace = "default"
+	}
+	if pod.Metadata.UID == "" {
+		pod.Metadata.UID = fmt.Sprintf("simulated-%d", i)
+	}
+	if pod.Metadata.CreationTimestamp.IsZero() {
+		pod.Metadata.CreationTimestamp = time.Now()
+	}
+	pod.Spec.SchedulerName = profile.SchedulerName
+	pod.Spec.NodeName = ""
+	pod.Status.Phase = "Pending"
+	return pod
+}
+
+// Returns the placement of the last decision for the pod
+func (s *Scheduler) simulatedPlacementOf(profile *Profile, pod kubernetes.KubePod) simulatedPlacement {
+	placement := simulatedPlacement{Namespace: pod.Metadata.Namespace, Pod: pod.Metadata.Name, Profile: profile.Name, Outcome: "queued"}
+	decisions := s.history.pod(pod.Metadata.Namespace, pod.Metadata.Name)
+	if len(decisions) == 0 {
+		// Like the pods of a group, bound with the whole group
+		return placement
+	}
+	decision := decisions[len(decisions)-1]
+	placement.Profile, placement.Node, placement.Outcome, placement.Error = decision.Profile, decision.Node, decision.Outcome, decision.Error
+	for _, candidate := range decision.Candidates {
+		if candidate.Node == decision.Node {
+			placement.Score = candidate.Score
+		}
+	}
+	return placement
+}
+
+// Prints the placements and the number of pods by node
+func printPlacements(placements []simulatedPlacement) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "POD\tPROFILE\tNODE\tSCORE\tOUTCOME\tERROR")
+	placed := 0
+	for _, placement := range placements {
+		node, score := "-", "-"
+		if placement.Node != "" {
+			node = placement.Node
+			placed++
+		}
+		if placement.Score != nil {
+			score = fmt.Sprintf("%.4g", *placement.Score)
+		}
+		fmt.Fprintf(writer, "%s/%s\t%s\t%s\t%s\t%s\t%s\n", placement.Namespace, placement.Pod, placement.Profile, node, score, placement.Outcome, placement.Error)
+	}
+	writer.Flush()
+	fmt.Printf("\n%d pods placed, %d unplaced\n", placed, len(placements)-placed)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A node whose last value is older restarts its averages, like a node back after an outage
+const smoothingMaxAge = time.Hour
+
+// Exponential moving averages of the metrics of a profile by node, updated with every value read
+// from the provider. The cached and prefetched values are the smoothed ones.
+type smoothedMetrics struct {
+	mutex  sync.Mutex
+	nodes  map[string]smoothedValues
+	pruned time.Time
+}
+
+type smoothedValues struct {
+	values  []float64
+	updated time.Time
+}
+
+func (m *MetricConfig) validateSmoothing() error {
+	if m.Smoothing < 0 || m.Smoothing > 1 {
+		return fmt.Errorf("metric %s: smoothing must be between 0 and 1", m.Name)
+	}
+	return nil
+}
+
+// Returns the values read for the node with the metrics having a Smoothing replaced by their
+// average: Smoothing times the value read plus 1-Smoothing times the previous average
+func (p *Profile) smooth(nodeName string, values []float64) []float64 {
+	if p.smoothed == nil || len(values) != len(p.Metrics) {
+		return values
+	}
+	m := p.smoothed
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.pruned) > smoothingMaxAge {
+		for name, previous := range m.nodes {
+			if now.Sub(previous.updated) > smoothingMaxAge {
+				delete(m.nodes, name)
+			}
+		}
+		m.pruned = now
+	}
+
+	smoothed := append([]float64(nil), values...)
+	if previous, ok := m.nodes[nodeName]; ok && now.Sub(previous.updated) <= smoothingMaxAge {
+		for i, metric := range p.Metrics {
+			if alpha := metric.Smoothing; alpha > 0 {
+				smoothed[i] = alpha*values[i] + (1-alpha)*previous.values[i]
+			}
+		}
+	}
+	m.nodes[nodeName] = smoothedValues{smoothed, now}
+	return smoothed
+}
+
+// Restarts the averages of the node from its next value
+func (m *smoothedMetrics) remove(nodeName string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.nodes, nodeName)
+}
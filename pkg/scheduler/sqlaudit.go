@@ -0,0 +1,224 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Table of the decisions when the sql sink doesn't name one
+const defaultAuditTable = "scheduling_decisions"
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Inserts the decisions of every batch in a table, created on the first write. The database
+// handle is opened on the first write too, with the DSN of the secret.
+type sqlSink struct {
+	config SQLConfig
+	dsn    func(ctx context.Context) ([]string, error)
+
+	mutex sync.Mutex
+	db    *sql.DB
+}
+
+func (s *sqlSink) write(ctx context.Context, batch []byte) error {
+	db, err := s.open(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	statement, err := tx.PrepareContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (time, namespace, pod, profile, node, outcome, error, duration_seconds, record) VALUES (%s)",
+		s.config.table(), s.config.placeholders(9)))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer statement.Close()
+
+	scanner := bufio.NewScanner(bytes.NewReader(batch))
+	scanner.Buffer(nil, len(batch)+1)
+	for scanner.Scan() {
+		var record auditRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = statement.ExecContext(ctx, record.Time.UTC(), record.Namespace, record.Pod, record.Profile,
+			record.Node, record.Outcome, record.Error, record.Duration, scanner.Text()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Returns the database handle, opened and with its table created on the first call
+func (s *sqlSink) open(ctx context.Context) (*sql.DB, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db != nil {
+		return s.db, nil
+	}
+	dsn, err := s.dsn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openAuditDB(ctx, s.config, dsn[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, statement := range s.config.schema() {
+		if _, err = db.ExecContext(ctx, statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("sql: %s", err)
+		}
+	}
+	s.db = db
+	return db, nil
+}
+
+// Opens the database of the configuration and checks it can be reached
+func openAuditDB(ctx context.Context, c SQLConfig, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(c.Driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %s, the driver is compiled in with the postgres or sqlite build tag", err)
+	}
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sql: %s", err)
+	}
+	return db, nil
+}
+
+// Returns an error if the driver is not compiled in the binary, the drivers are behind build tags
+func (c SQLConfig) checkDriver() error {
+	for _, name := range sql.Drivers() {
+		if name == c.Driver {
+			return nil
+		}
+	}
+	return fmt.Errorf("sql driver %q is not compiled in, build with -tags postgres or -tags sqlite", c.Driver)
+}
+
+// Returns the function reading the DSN of the database
+func (c SQLConfig) dsn(scheduler *Scheduler) func(ctx context.Context) ([]string, error) {
+	return scheduler.credentials(c.Secret, []string{"dsn"}, []string{"AUDIT_SQL_DSN"})
+}
+
+// Returns the table of the decisions
+func (c SQLConfig) table() string {
+	if c.Table == "" {
+		return defaultAuditTable
+	}
+	return c.Table
+}
+
+// Returns the statements creating the table and its indexes, the decisions are looked up by
+// node or pod over a time range
+func (c SQLConfig) schema() []string {
+	table := c.table()
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	time TIMESTAMP NOT NULL,
+	namespace VARCHAR(253) NOT NULL,
+	pod VARCHAR(253) NOT NULL,
+	profile VARCHAR(253) NOT NULL,
+	node VARCHAR(253) NOT NULL,
+	outcome VARCHAR(32) NOT NULL,
+	error TEXT NOT NULL,
+	duration_seconds DOUBLE PRECISION NOT NULL,
+	record TEXT NOT NULL
+)`, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_time ON %s (time)", table, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_node ON %s (node, time)", table, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_pod ON %s (namespace, pod, time)", table, table),
+	}
+}
+
+// Returns the placeholder of the nth parameter of a statement, from 1
+func (c SQLConfig) placeholder(n int) string {
+	switch c.Driver {
+	case "postgres", "pgx":
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// Returns the comma separated placeholders of count parameters
+func (c SQLConfig) placeholders(count int) string {
+	list := make([]string, count)
+	for i := range list {
+		list[i] = c.placeholder(i + 1)
+	}
+	return strings.Join(list, ", ")
+}
+
+// A decision read back from the table
+type storedDecision struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Profile   string    `json:"profile"`
+	Node      string    `json:"node,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	Duration  float64   `json:"durationSeconds"`
+}
+
+// Returns the decisions since the time, of the node and/or the namespace/pod if they are set,
+// oldest first and at most limit of them
+func queryDecisions(ctx context.Context, db *sql.DB, c SQLConfig, since time.Time, node, namespace, pod string, limit int) (decisions []storedDecision, err error) {
+	conditions := []string{"time >= " + c.placeholder(1)}
+	args := []interface{}{since.UTC()}
+	for _, filter := range []struct{ column, value string }{{"node", node}, {"namespace", namespace}, {"pod", pod}} {
+		if filter.value != "" {
+			args = append(args, filter.value)
+			conditions = append(conditions, filter.column+" = "+c.placeholder(len(args)))
+		}
+	}
+	query := fmt.Sprintf("SELECT time, namespace, pod, profile, node, outcome, error, duration_seconds FROM %s WHERE %s ORDER BY time LIMIT %d",
+		c.table(), strings.Join(conditions, " AND "), limit)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var decision storedDecision
+		if err = rows.Scan(&decision.Time, &decision.Namespace, &decision.Pod, &decision.Profile, &decision.Node,
+			&decision.Outcome, &decision.Error, &decision.Duration); err != nil {
+			return
+		}
+		decisions = append(decisions, decision)
+	}
+	err = rows.Err()
+	return
+}
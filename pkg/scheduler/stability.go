@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+)
+
+// Default window and sampling of the metrics stability
+const (
+	defaultStabilityWindow   = 15 * time.Minute
+	defaultStabilitySampling = time.Minute
+)
+
+// Returns true if a metric of the profile rejects the unstable nodes
+func (p *Profile) hasStability() bool {
+	for _, metric := range p.Metrics {
+		if metric.Stability != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a thresholdError if a metric of the node moved more than its stability allows.
+// The nodes whose history can't be read are not rejected, their current values are used.
+func (s *Scheduler) checkStability(ctx context.Context, profile *Profile, nodeName string) error {
+	provider, ok := profile.provider.(metrics.SeriesProvider)
+	if !ok {
+		return nil
+	}
+	for _, metric := range profile.Metrics {
+		if metric.Stability == nil {
+			continue
+		}
+		stdDev, err := s.metricStdDev(ctx, provider, profile, metric, nodeName)
+		if err != nil {
+			log.Printf("Error reading the stability of %s on %s: %s", metric.Name, nodeName, err)
+			continue
+		}
+		if stdDev > metric.Stability.MaxStdDev {
+			return thresholdError{metric.Name + " standard deviation", stdDev, metric.Stability.MaxStdDev, true}
+		}
+	}
+	return nil
+}
+
+// Returns the standard deviation of the metric of the node over its stability window. It is
+// cached for a sampling interval, the window moves by a datapoint in that time.
+func (s *Scheduler) metricStdDev(ctx context.Context, provider metrics.SeriesProvider, profile *Profile, metric MetricConfig, nodeName string) (stdDev float64, err error) {
+	key := "stability/" + profile.Name + "/" + metric.Name + "/" + metric.Stability.Window.String() + "/" + nodeName
+	if data, ok, _ := s.metricCache.Get(ctx, key); ok && json.Unmarshal(data, &stdDev) == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.MetricsTimeout)
+	defer cancel()
+	var series [][]float64
+	err = withRetries(ctx, s.config.Retry, func() (err error) {
+		series, err = provider.NodeSeries(ctx, nodeName, []string{metric.Name}, metric.Stability.Window, metric.Stability.Sampling)
+		return
+	})
+	if err != nil {
+		return
+	}
+	if len(series) != 1 || len(series[0]) == 0 {
+		return 0, metrics.NoDataFound
+	}
+	stdDev = metrics.Aggregate(series[0], metrics.AggregationStdDev)
+
+	if data, err := json.Marshal(stdDev); err == nil {
+		s.metricCache.Set(ctx, key, data, metric.Stability.Sampling)
+	}
+	return
+}
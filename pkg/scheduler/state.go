@@ -0,0 +1,230 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Key of the state in its ConfigMap
+const stateConfigMapKey = "state.json"
+
+// StateConfig saves the state the placements depend on every Interval (30s if unset) and on
+// shutdown, and restores it on startup: the recent bindings of the ledger, the last binding of
+// every node, the circuit breakers and the nodes of the StatefulSet ordinals. It is saved to File, or to the ConfigMap Namespace/Name.
+type StateConfig struct {
+	File      string        `yaml:"file"`
+	Namespace string        `yaml:"namespace"`
+	Name      string        `yaml:"name"`
+	Interval  time.Duration `yaml:"interval"`
+}
+
+// Returns an error unless a file or a config map is set
+func (c StateConfig) validate() error {
+	if (c.File == "") == (c.Name == "") {
+		return fmt.Errorf("state: either file or name must be set")
+	}
+	if c.Name != "" && c.Namespace == "" {
+		return fmt.Errorf("state: the configmap namespace must be set")
+	}
+	return nil
+}
+
+// State of the scheduler kept across restarts
+type schedulerState struct {
+	Saved        time.Time                    `json:"saved"`
+	Ledger       map[string][]savedBinding    `json:"ledger"`
+	LastBindings map[string]time.Time         `json:"lastBindings"`
+	Breakers     map[string]savedCircuitState `json:"breakers"`
+	Pins         map[string]string            `json:"pins,omitempty"`
+}
+
+type savedBinding struct {
+	Requests resourceList `json:"requests"`
+	Time     time.Time    `json:"time"`
+}
+
+type savedCircuitState struct {
+	Failures  int       `json:"failures"`
+	OpenUntil time.Time `json:"openUntil"`
+}
+
+// Returns the bindings recorded by the ledger
+func (l *bindingLedger) snapshot() map[string][]savedBinding {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	saved := map[string][]savedBinding{}
+	for node, entries := range l.nodes {
+		for _, entry := range entries {
+			saved[node] = append(saved[node], savedBinding{entry.requests, entry.time})
+		}
+	}
+	return saved
+}
+
+// Adds the saved bindings still within the retention, nothing is kept if no scorer reads them
+func (l *bindingLedger) restore(saved map[string][]savedBinding) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for node, bindings := range saved {
+		for _, binding := range bindings {
+			if time.Since(binding.Time) < l.retention {
+				l.nodes[node] = append(l.nodes[node], ledgerEntry{binding.Requests, binding.Time})
+			}
+		}
+	}
+}
+
+// Returns the state of the circuit breakers
+func (b *circuitBreakers) snapshot() map[string]savedCircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	saved := map[string]savedCircuitState{}
+	for node, state := range b.nodes {
+		saved[node] = savedCircuitState{state.failures, state.openUntil}
+	}
+	return saved
+}
+
+// Restores the saved circuit breakers of the nodes without a breaker yet
+func (b *circuitBreakers) restore(saved map[string]savedCircuitState) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for node, state := range saved {
+		if _, ok := b.nodes[node]; !ok {
+			b.nodes[node] = &circuitState{state.Failures, state.OpenUntil}
+		}
+	}
+}
+
+// Returns the current state
+func (s *Scheduler) currentState() (state schedulerState) {
+	state.Saved = time.Now()
+	state.Ledger = s.ledger.snapshot()
+	state.Breakers = s.breakers.snapshot()
+	state.Pins = s.pins.snapshot()
+
+	s.lastBindingsMutex.Lock()
+	defer s.lastBindingsMutex.Unlock()
+	state.LastBindings = map[string]time.Time{}
+	for node, last := range s.lastBindings {
+		state.LastBindings[node] = last
+	}
+	return
+}
+
+// Reads the saved state and restores it, before any pod is scheduled. A missing state is not an error.
+func (s *Scheduler) restoreState(ctx context.Context, c StateConfig) error {
+	var data []byte
+	if c.File != "" {
+		read, err := ioutil.ReadFile(c.File)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data = read
+	} else {
+		configMap, err := s.kubeAPI.GetConfigMap(ctx, c.Namespace, c.Name)
+		if statusErr, ok := err.(*kubernetes.StatusError); ok && statusErr.Code == 404 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data = []byte(configMap[stateConfigMapKey])
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	state := schedulerState{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("decoding the saved state: %s", err)
+	}
+	s.ledger.restore(state.Ledger)
+	s.breakers.restore(state.Breakers)
+	s.pins.restore(state.Pins)
+	s.lastBindingsMutex.Lock()
+	for node, last := range state.LastBindings {
+		if last.After(s.lastBindings[node]) {
+			s.lastBindings[node] = last
+		}
+	}
+	s.lastBindingsMutex.Unlock()
+	log.Printf("Restored the state saved at %s", state.Saved.Format(time.RFC3339))
+	return nil
+}
+
+// Saves the current state. The file is replaced atomically, so a crash leaves the previous state.
+func (s *Scheduler) saveState(ctx context.Context, c StateConfig) error {
+	data, err := json.Marshal(s.currentState())
+	if err != nil {
+		return err
+	}
+
+	if c.File != "" {
+		temporary, err := ioutil.TempFile(filepath.Dir(c.File), filepath.Base(c.File)+".")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(temporary.Name())
+		if _, err := temporary.Write(data); err != nil {
+			temporary.Close()
+			return err
+		}
+		if err := temporary.Close(); err != nil {
+			return err
+		}
+		return os.Rename(temporary.Name(), c.File)
+	}
+
+	manifest, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]string{"name": c.Name, "namespace": c.Namespace},
+		"data":       map[string]string{stateConfigMapKey: string(data)},
+	})
+	if err != nil {
+		return err
+	}
+	return s.kubeAPI.Apply(ctx, fmt.Sprintf("api/v1/namespaces/%s/configmaps/%s", c.Namespace, c.Name), manifest, "sysdig-scheduler")
+}
+
+// Saves the state every interval until the context is done
+func (s *Scheduler) saveStateLoop(ctx context.Context, c StateConfig) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.Interval):
+		}
+		if err := s.saveState(ctx, c); err != nil {
+			log.Println("error while saving the state:", err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/draios/kubernetes-scheduler/pkg/failure"
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Error of the nodes rejected by a hard threshold of a metric, whatever their score
+type thresholdError struct {
+	metric    string
+	value     float64
+	threshold float64
+	above     bool
+}
+
+func (e thresholdError) FailureReason() failure.Reason {
+	return failure.ThresholdReached
+}
+
+func (e thresholdError) Error() string {
+	if e.above {
+		return fmt.Sprintf("%s is %g, above the threshold of %g", e.metric, e.value, e.threshold)
+	}
+	return fmt.Sprintf("%s is %g, below the threshold of %g", e.metric, e.value, e.threshold)
+}
+
+// Returns true if a metric of the profile has a hard threshold
+func (p *Profile) hasThresholds() bool {
+	for _, metric := range p.Metrics {
+		if metric.RejectAbove != nil || metric.RejectBelow != nil || metric.Stability != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the names of the nodes not past a threshold of the profile, the ones a fallback can take
+func withinThresholds(nodes []string, scored NodeList) (within []string) {
+	past := map[string]bool{}
+	for _, node := range scored {
+		if failure.ReasonOf(node.err) == failure.ThresholdReached {
+			past[node.name] = true
+		}
+	}
+	for _, name := range nodes {
+		if !past[name] {
+			within = append(within, name)
+		}
+	}
+	return
+}
+
+// Returns the nodes a node without metrics may be chosen from for the pod, the ones not past a
+// threshold, or none if the fallback of the profile hands the pods over to the default scheduler
+// or is disabled by its feature flag
+func (s *Scheduler) fallbackCandidates(profile *Profile, pod kubernetes.KubePod, nodes []string, scored NodeList) []string {
+	if profile.Fallback == fallbackDefaultScheduler || !s.features.enabled(featureFallback, pod.Metadata.Namespace) {
+		return nil
+	}
+	return withinThresholds(nodes, scored)
+}
+
+// Returns the nodes past a threshold, as rejected by the MetricThresholds filter
+func thresholdRejections(scored NodeList) map[string]error {
+	rejected := map[string]error{}
+	for _, node := range scored {
+		if failure.ReasonOf(node.err) == failure.ThresholdReached {
+			rejected[node.name] = filterError{"MetricThresholds", node.err}
+		}
+	}
+	return rejected
+}
+
+// Sets the error of the nodes of the list with a raw metric value past a threshold of the profile
+func applyThresholds(profile *Profile, list NodeList) {
+	for i, node := range list {
+		if node.err != nil {
+			continue
+		}
+		for m, metric := range profile.Metrics {
+			value := node.metrics[m]
+			if metric.RejectAbove != nil && value > *metric.RejectAbove {
+				list[i].err = thresholdError{metric.Name, value, *metric.RejectAbove, true}
+				break
+			}
+			if metric.RejectBelow != nil && value < *metric.RejectBelow {
+				list[i].err = thresholdError{metric.Name, value, *metric.RejectBelow, false}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFallbackCandidates(t *testing.T) {
+	nodes := []string{"hot", "stale", "cool", "unscored"}
+	scored := NodeList{
+		{name: "hot", err: thresholdError{"cpu.used.percent", 95, 90, true}},
+		{name: "stale", err: errors.New("no recent datapoint")},
+		{name: "cool", score: 20},
+	}
+	tests := []struct {
+		fallback string
+		want     []string
+	}{
+		{fallbackDefaultScheduler, nil},
+		{fallbackRoundRobin, []string{"stale", "cool", "unscored"}},
+		{fallbackAllocatable, []string{"stale", "cool", "unscored"}},
+	}
+	for _, test := range tests {
+		t.Run(test.fallback, func(t *testing.T) {
+			s := testScheduler(Config{})
+			got := s.fallbackCandidates(&Profile{Fallback: test.fallback}, testPod("default", "web", nil, nil), nodes, scored)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("fallbackCandidates() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOverThresholds(t *testing.T) {
+	hot := Node{name: "hot", err: thresholdError{"cpu.used.percent", 95, 90, true}}
+	tests := []struct {
+		name   string
+		scored NodeList
+		want   bool
+	}{
+		{"no node", nil, false},
+		{"every node past a threshold", NodeList{hot, hot}, true},
+		{"a node without metrics", NodeList{hot, {name: "stale", err: errors.New("no datapoint")}}, false},
+		{"a scored node", NodeList{hot, {name: "cool"}}, false},
+	}
+	for _, test := range tests {
+		if got := overThresholds(test.scored); got != test.want {
+			t.Errorf("%s: overThresholds() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
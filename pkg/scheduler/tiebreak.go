@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Tie-breakers choosing among the nodes with the same score
+const (
+	tieBreakerHeadroom      = "headroom"       // The node with the most free allocatable resources
+	tieBreakerFewestPods    = "fewest-pods"    // The node running the fewest pods
+	tieBreakerImageLocality = "image-locality" // The node with the most bytes of the pod images
+	tieBreakerRoundRobin    = "round-robin"    // Rotate over the tied nodes
+)
+
+// Checks the tie-breaker of the profile
+func (p *Profile) validateTieBreaker() error {
+	switch p.TieBreaker {
+	case "", tieBreakerHeadroom, tieBreakerFewestPods, tieBreakerImageLocality, tieBreakerRoundRobin:
+	default:
+		return fmt.Errorf("unknown tie-breaker %q", p.TieBreaker)
+	}
+	if p.TieMargin < 0 {
+		return fmt.Errorf("the tie margin can't be negative")
+	}
+	return nil
+}
+
+// Returns the node chosen by the tie-breaker of the profile among the nodes whose score is within
+// the tie margin of the best one. The best node is returned if it is not tied or the tie-breaker fails.
+func (s *Scheduler) breakTie(ctx context.Context, profile *Profile, pod kubernetes.KubePod, list NodeList, best Node) Node {
+	if profile.TieBreaker == "" {
+		return best
+	}
+	tied := map[string]Node{}
+	var names []string
+	for _, node := range list {
+		if math.Abs(node.score-best.score) <= profile.TieMargin {
+			tied[node.name] = node
+			names = append(names, node.name)
+		}
+	}
+	if len(names) < 2 {
+		return best
+	}
+	sort.Strings(names)
+
+	name, err := s.tieBreaker(ctx, profile, pod, names)
+	if err != nil {
+		log.Printf("error while breaking the tie of %d nodes: %s", len(names), err)
+		return best
+	}
+	log.Printf("Tie of %d nodes broken by %s: %s", len(names), profile.TieBreaker, name)
+	return tied[name]
+}
+
+// Returns the name of the tied node chosen by the tie-breaker, the names are sorted
+func (s *Scheduler) tieBreaker(ctx context.Context, profile *Profile, pod kubernetes.KubePod, names []string) (string, error) {
+	switch profile.TieBreaker {
+	case tieBreakerHeadroom:
+		node, err := s.mostAllocatableNode(ctx, names)
+		return node.name, err
+
+	case tieBreakerFewestPods:
+		pods, err := s.kubeAPI.ListAssignedPods(ctx)
+		if err != nil {
+			return "", err
+		}
+		counts := map[string]int{}
+		for _, pod := range pods {
+			counts[pod.Spec.NodeName]++
+		}
+		best := names[0]
+		for _, name := range names[1:] {
+			if counts[name] < counts[best] {
+				best = name
+			}
+		}
+		return best, nil
+
+	case tieBreakerImageLocality:
+		best, bestBytes := names[0], int64(-1)
+		for _, name := range names {
+			node, err := s.findNode(ctx, name)
+			if err != nil {
+				continue
+			}
+			if bytes := imageBytesOnNode(pod, node); bytes > bestBytes {
+				best, bestBytes = name, bytes
+			}
+		}
+		return best, nil
+
+	case tieBreakerRoundRobin:
+		s.roundRobinMutex.Lock()
+		defer s.roundRobinMutex.Unlock()
+		key := "tie:" + profile.Name
+		position := s.roundRobinNext[key] % len(names)
+		s.roundRobinNext[key] = position + 1
+		return names[position], nil
+	}
+	return names[0], nil
+}
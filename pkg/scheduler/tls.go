@@ -0,0 +1,226 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checks that the certificate and the key are both set
+func (s ServerSecurity) validate() error {
+	if s.TLS != nil && (s.TLS.CertFile == "" || s.TLS.KeyFile == "") {
+		return errors.New("tls: certFile and keyFile must be set")
+	}
+	if s.TLS == nil && s.BearerTokenFile != "" {
+		return errors.New("bearerTokenFile needs tls, tokens are not sent in clear")
+	}
+	return nil
+}
+
+// Returns the TLS configuration of the server, nil without TLS
+func (s ServerSecurity) tlsConfig() (*tls.Config, error) {
+	if s.TLS == nil {
+		return nil, nil
+	}
+	certificates, err := newCertReloader(s.TLS.CertFile, s.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certificates.getCertificate}
+	if s.TLS.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(s.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", s.TLS.ClientCAFile)
+		}
+		// Verified if given, the clients without one can still use a token or reach /healthz
+		tlsConfig.ClientCAs, tlsConfig.ClientAuth = pool, tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// Serves the certificate and key files, loaded again when one of them changes
+type certReloader struct {
+	certFile, keyFile string
+	mutex             sync.Mutex
+	certificate       *tls.Certificate
+	modTime           time.Time
+}
+
+// Returns the reloader of the files, which must hold a valid pair already
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Loads the files if they changed since the last load
+func (r *certReloader) reload() error {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if r.certificate != nil && !modTime.After(r.modTime) {
+		return nil
+	}
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if r.certificate != nil {
+		log.Printf("reloaded the certificate %s", r.certFile)
+	}
+	r.certificate, r.modTime = &certificate, modTime
+	return nil
+}
+
+// Returns the current certificate, the previous one is kept while the files are being rewritten
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.reload(); err != nil {
+		log.Printf("error while reloading the certificate %s: %s", r.certFile, err)
+	}
+	return r.certificate, nil
+}
+
+func latestModTime(files ...string) (latest time.Time, err error) {
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return
+}
+
+// Bearer tokens of a file, one per line, loaded again when it changes
+type tokenFile struct {
+	path    string
+	mutex   sync.Mutex
+	tokens  []string
+	modTime time.Time
+}
+
+// Returns true if the token is one of the file
+func (t *tokenFile) valid(token string) bool {
+	for _, expected := range t.current() {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the tokens of the file, read again if it changed. The previous tokens are kept
+// while the file can't be read, like while a secret volume is being updated.
+func (t *tokenFile) current() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if modTime, err := latestModTime(t.path); err != nil {
+		log.Printf("error while reading the tokens %s: %s", t.path, err)
+	} else if modTime.After(t.modTime) {
+		tokens, err := readLines(t.path)
+		if err != nil {
+			log.Printf("error while reading the tokens %s: %s", t.path, err)
+		} else {
+			if !t.modTime.IsZero() {
+				log.Printf("reloaded the tokens %s", t.path)
+			}
+			t.tokens, t.modTime = tokens, modTime
+		}
+	}
+	return t.tokens
+}
+
+// Reads the token of the Sysdig api from the first line of the file before every request, so
+// the rotated tokens of a mounted secret are used without restarting
+func (s *Scheduler) watchSysdigToken(path string) error {
+	file := &tokenFile{path: path}
+	if len(file.current()) == 0 {
+		return fmt.Errorf("no Sysdig token in %s", path)
+	}
+	s.sysdigAPI.SetTokenSource(func() string {
+		tokens := file.current()
+		if len(tokens) == 0 {
+			return ""
+		}
+		return tokens[0]
+	})
+	return nil
+}
+
+// Returns the non empty lines of a file
+func readLines(path string) (lines []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// Only lets through the requests with a verified client certificate or a valid bearer token,
+// if the server requires one of them. /healthz is left open for the kubelet probes.
+func authenticate(security ServerSecurity, handler http.Handler) http.Handler {
+	clientCerts := security.TLS != nil && security.TLS.ClientCAFile != ""
+	if !clientCerts && security.BearerTokenFile == "" {
+		return handler
+	}
+	tokens := &tokenFile{path: security.BearerTokenFile}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || (r.TLS != nil && len(r.TLS.VerifiedChains) > 0) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		authorization := r.Header.Get("Authorization")
+		if security.BearerTokenFile != "" && strings.HasPrefix(authorization, "Bearer ") && tokens.valid(strings.TrimPrefix(authorization, "Bearer ")) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sysdig-scheduler"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	})
+}
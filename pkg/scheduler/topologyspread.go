@@ -0,0 +1,77 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+// Scores the nodes with the skew the pod would add to the failure domain of the node, the value of
+// its topologyKey label like a rack, counting the pods of the controller of the pod in every domain
+// of the ready nodes. The skews up to maxSkew score 0, the metrics decide among those domains, and
+// every replica past it adds 1, lower is better. Bare pods and the nodes without the label score 0.
+type topologySpreadScorer struct {
+	schedulerScorer
+	topologyKey string
+	maxSkew     int
+}
+
+func (s *topologySpreadScorer) Name() string {
+	return "topology-spread"
+}
+
+func (s *topologySpreadScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (float64, error) {
+	domain, ok := node.Labels[s.topologyKey]
+	if pod.Controller == "" || !ok {
+		return 0, nil
+	}
+
+	domains := map[string]string{} // Domain of every node, by name
+	counts := map[string]int{}
+	for _, other := range s.scheduler.nodesAvailable(ctx) {
+		if value, ok := other.Metadata.Labels[s.topologyKey]; ok {
+			domains[other.Metadata.Name] = value
+			counts[value] = 0
+		}
+	}
+	pods, err := s.scheduler.kubeAPI.ListAssignedPods(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, other := range pods {
+		value, ok := domains[other.Spec.NodeName]
+		if !ok {
+			continue
+		}
+		if controller, ok := controllerOf(other); ok && controller == pod.Controller {
+			counts[value]++
+		}
+	}
+
+	minimum := -1
+	for _, count := range counts {
+		if minimum < 0 || count < minimum {
+			minimum = count
+		}
+	}
+	if skew := counts[domain] + 1 - minimum; skew > s.maxSkew {
+		return float64(skew - s.maxSkew), nil
+	}
+	return 0, nil
+}
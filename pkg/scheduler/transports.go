@@ -0,0 +1,181 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/transport"
+)
+
+// Defaults of the transports. The idle connections cover the concurrent scheduling attempts, net/http
+// keeps 2 per host and opens a new connection for every other request.
+var (
+	defaultSysdigTransport = TransportConfig{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 32,
+		MaxConnsPerHost:     64,
+		IdleConnTimeout:     90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		DialTimeout:         10 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		Timeout:             30 * time.Second,
+	}
+	// Every watch holds a connection, the connections to the api server are not limited
+	defaultKubernetesTransport = TransportConfig{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		DialTimeout:         10 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		Timeout:             time.Minute,
+	}
+)
+
+// Sets the settings left at 0 to the ones of the defaults
+func (c *TransportConfig) setDefaults(defaults TransportConfig) {
+	if c.MaxIdleConns == 0 {
+		c.MaxIdleConns = defaults.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = defaults.MaxIdleConnsPerHost
+	}
+	if c.MaxConnsPerHost == 0 {
+		c.MaxConnsPerHost = defaults.MaxConnsPerHost
+	}
+	if c.IdleConnTimeout == 0 {
+		c.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+	if c.KeepAlive == 0 {
+		c.KeepAlive = defaults.KeepAlive
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = defaults.DialTimeout
+	}
+	if c.TLSHandshakeTimeout == 0 {
+		c.TLSHandshakeTimeout = defaults.TLSHandshakeTimeout
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaults.Timeout
+	}
+}
+
+// Checks that no setting is negative
+func (c HTTPConfig) validate() error {
+	for _, t := range []struct {
+		name   string
+		config TransportConfig
+	}{{"sysdig", c.Sysdig}, {"kubernetes", c.Kubernetes}} {
+		if t.config.MaxIdleConns < 0 || t.config.MaxIdleConnsPerHost < 0 || t.config.MaxConnsPerHost < 0 {
+			return fmt.Errorf("http %s: the connection counts can't be negative", t.name)
+		}
+		if t.config.IdleConnTimeout < 0 || t.config.KeepAlive < 0 || t.config.DialTimeout < 0 || t.config.TLSHandshakeTimeout < 0 ||
+			t.config.ResponseHeaderTimeout < 0 || t.config.Timeout < 0 || t.config.DNSCacheTTL < 0 {
+			return fmt.Errorf("http %s: the durations can't be negative", t.name)
+		}
+	}
+	return nil
+}
+
+// Returns the options of the transport, the requests for which exempt returns true have no deadline
+func (c TransportConfig) options(exempt func(*http.Request) bool) transport.Options {
+	return transport.Options{
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		IdleConnTimeout:       c.IdleConnTimeout,
+		KeepAlive:             c.KeepAlive,
+		DialTimeout:           c.DialTimeout,
+		TLSHandshakeTimeout:   c.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: c.ResponseHeaderTimeout,
+		Timeout:               c.Timeout,
+		Exempt:                exempt,
+		DNSCacheTTL:           c.DNSCacheTTL,
+	}
+}
+
+// Connections and requests of the tuned transports, by client
+type transportCounters struct {
+	sysdig     transport.Stats
+	kubernetes transport.Stats
+}
+
+var transports = &transportCounters{}
+
+// Returns true for the watches, streaming until they are stopped
+func isWatch(request *http.Request) bool {
+	return request.URL.Query().Get("watch") == "true"
+}
+
+// Tunes the transports of the api server and of the Sysdig api, once the faults to inject are known
+func (s *Scheduler) tuneTransports() error {
+	if err := s.kubeAPI.TuneTransport(s.config.HTTP.Kubernetes.options(isWatch), &transports.kubernetes); err != nil {
+		return err
+	}
+	s.sysdigAPI.SetHTTPClient(s.tunedSysdigClient(s.sysdigAPI.HTTPClient()))
+	expvar.Publish("httpTransports", expvar.Func(func() interface{} {
+		return map[string]transport.Stats{"sysdig": transports.sysdig.Snapshot(), "kubernetes": transports.kubernetes.Snapshot()}
+	}))
+	return nil
+}
+
+// Returns a client with the transport of the client tuned for the Sysdig api, a copy of
+// http.DefaultTransport if the client is nil
+func (s *Scheduler) tunedSysdigClient(client *http.Client) *http.Client {
+	var base *http.Transport
+	if client != nil {
+		base, _ = client.Transport.(*http.Transport)
+	}
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	tuned := transport.Apply(base, s.config.HTTP.Sysdig.options(nil), &transports.sysdig)
+	return &http.Client{Transport: wrapMetricFaults(tuned)}
+}
+
+// Writes the counters in the Prometheus text format
+func (t *transportCounters) write(w http.ResponseWriter) {
+	clients := []struct {
+		name  string
+		stats transport.Stats
+	}{{"kubernetes", t.kubernetes.Snapshot()}, {"sysdig", t.sysdig.Snapshot()}}
+	metrics := []struct {
+		name, kind, help string
+		value            func(transport.Stats) int64
+	}{
+		{"connections_opened_total", "counter", "Connections opened.", func(s transport.Stats) int64 { return s.Dials }},
+		{"dial_errors_total", "counter", "Connections that could not be opened.", func(s transport.Stats) int64 { return s.DialErrors }},
+		{"connections_open", "gauge", "Connections currently open, idle ones included.", func(s transport.Stats) int64 { return s.Open }},
+		{"requests_reused_connection_total", "counter", "Requests sent on a kept alive connection.", func(s transport.Stats) int64 { return s.Reused }},
+		{"requests_new_connection_total", "counter", "Requests that needed a new connection.", func(s transport.Stats) int64 { return s.NotReused }},
+		{"requests_in_flight", "gauge", "Requests whose answer is still read.", func(s transport.Stats) int64 { return s.InFlight }},
+		{"request_timeouts_total", "counter", "Requests past the timeout of the transport.", func(s transport.Stats) int64 { return s.Timeouts }},
+		{"dns_lookups_total", "counter", "Host names resolved.", func(s transport.Stats) int64 { return s.DNSLookups }},
+		{"dns_cache_hits_total", "counter", "Host names answered by the DNS cache.", func(s transport.Stats) int64 { return s.DNSCacheHit }},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP sysdig_scheduler_http_%s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE sysdig_scheduler_http_%s %s\n", metric.name, metric.kind)
+		for _, client := range clients {
+			fmt.Fprintf(w, "sysdig_scheduler_http_%s{client=%s} %d\n", metric.name, promLabel(client.name), metric.value(client.stats))
+		}
+	}
+}
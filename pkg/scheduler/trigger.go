@@ -0,0 +1,204 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/nats"
+)
+
+const (
+	triggerWatch   = "watch"
+	triggerWebhook = "webhook"
+	triggerQueue   = "queue"
+)
+
+var (
+	errNotOwned = errors.New("pod is scheduled by the replica of another shard")
+	errGated    = errors.New("pod waits for its scheduling gates, it is queued once they are removed")
+)
+
+// Triggers received by source and outcome
+var triggers = expvar.NewMap("triggers")
+
+func (t TriggerConfig) validate() error {
+	switch t.Mode {
+	case "", triggerWatch, triggerWebhook:
+	case triggerQueue:
+		if t.URL == "" || t.Subject == "" {
+			return errors.New("trigger: the queue mode needs an url and a subject")
+		}
+		if !strings.HasPrefix(t.URL, "nats://") && !strings.HasPrefix(t.URL, "tls://") {
+			return fmt.Errorf("trigger: unsupported queue url %s, only NATS servers are supported", t.URL)
+		}
+	default:
+		return fmt.Errorf("trigger: unknown mode %q", t.Mode)
+	}
+	return nil
+}
+
+// Returns true if the added pods are queued by their watch
+func (t TriggerConfig) watch() bool {
+	return t.Mode == "" || t.Mode == triggerWatch
+}
+
+// Queues the pod named by a trigger as if its watch had just added it. Returns an error if the
+// pod can't be read, isn't a pending pod of the profiles or isn't queued.
+func (s *Scheduler) triggerPod(ctx context.Context, namespace, name string) error {
+	pod, err := s.kubeAPI.GetPod(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	if pod.Spec.NodeName != "" {
+		return fmt.Errorf("pod is already assigned to node %s", pod.Spec.NodeName)
+	}
+	if pod.Status.Phase != "Pending" {
+		return fmt.Errorf("pod is %s", pod.Status.Phase)
+	}
+	profile := s.profiles.forPod(pod)
+	if profile == nil {
+		return fmt.Errorf("scheduler %s is not one of the profiles", pod.Spec.SchedulerName)
+	}
+	return s.admitPod(ctx, profile, pod)
+}
+
+// Queues the pod of a POST to /v1/schedule/NAMESPACE/NAME, answering 202 once queued
+func (s *Scheduler) scheduleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "expected a POST"})
+		return
+	}
+	if s.config.Observer != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "the observer doesn't schedule pods"})
+		return
+	}
+	if s.config.Trigger.watch() {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "the pods are queued by their watch"})
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/schedule/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected /v1/schedule/NAMESPACE/NAME"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.SchedulingTimeout)
+	defer cancel()
+	err := s.triggerPod(ctx, parts[0], parts[1])
+	if statusError, ok := err.(*kubernetes.StatusError); ok && statusError.Code == http.StatusNotFound {
+		triggers.Add("webhook.notFound", 1)
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("pod %s/%s not found", parts[0], parts[1])})
+		return
+	}
+	switch {
+	case err == nil || err == errGated:
+		triggers.Add("webhook.queued", 1)
+		message := "queued"
+		if err != nil {
+			message = err.Error()
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": message})
+	case err == errNotOwned:
+		triggers.Add("webhook.rejected", 1)
+		writeJSON(w, http.StatusMisdirectedRequest, map[string]string{"error": err.Error()})
+	default:
+		if _, ok := err.(*kubernetes.StatusError); ok {
+			triggers.Add("webhook.failed", 1)
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		triggers.Add("webhook.rejected", 1)
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+}
+
+// Queues the pods named NAMESPACE/NAME by the messages of the subject, connecting again with a
+// backoff until the context is done
+func (s *Scheduler) subscribeTriggers(ctx context.Context, trigger TriggerConfig) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		connected := time.Now()
+		err := nats.Subscribe(ctx, trigger.URL, trigger.Subject, trigger.QueueGroup, func(payload []byte) {
+			parts := strings.Split(strings.TrimSpace(string(payload)), "/")
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				triggers.Add("queue.malformed", 1)
+				log.Printf("Ignoring the trigger %q, expected NAMESPACE/NAME", payload)
+				return
+			}
+			requestCtx, cancel := context.WithTimeout(ctx, s.config.SchedulingTimeout)
+			defer cancel()
+			if err := s.triggerPod(requestCtx, parts[0], parts[1]); err != nil && err != errGated {
+				if err != errNotOwned {
+					triggers.Add("queue.rejected", 1)
+					log.Printf("Trigger of %s/%s: %s", parts[0], parts[1], err)
+				}
+				return
+			}
+			triggers.Add("queue.queued", 1)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Error while reading the triggers of %s: %s", trigger.Subject, err)
+		if time.Since(connected) > time.Minute {
+			backoff = time.Second
+		}
+		select {
+		case <-time.After(backoff + time.Duration(random.Int63n(int64(backoff)))):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
+// Asks the admin server of the scheduler to queue a pod, for the webhook and queue triggers
+func runSchedule(args []string) {
+	flags := flag.NewFlagSet("schedule", flag.ExitOnError)
+	server := adminServerFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s schedule [flags] NAMESPACE/POD\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	parts := strings.Split(flags.Arg(0), "/")
+	if flags.NArg() != 1 || len(parts) != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	var answer map[string]string
+	if err := server.do("POST", "/v1/schedule/"+parts[0]+"/"+parts[1], &answer); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Pod %s %s\n", flags.Arg(0), answer["status"])
+}
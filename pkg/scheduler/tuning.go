@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"gopkg.in/yaml.v2"
+)
+
+// Number of tunings rejected as invalid, served in /debug/vars
+var rejectedTunings = expvar.NewInt("rejectedTunings")
+
+type tuningEvent struct {
+	Type   string `json:"type"`
+	Object struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			UID       string `json:"uid"`
+		} `json:"metadata"`
+		Data map[string]string `json:"data"`
+	} `json:"object"`
+}
+
+// Tuning of a profile, the YAML value of its key in the ConfigMap
+type profileTuning struct {
+	Strategy string         `yaml:"strategy"`
+	Metrics  []MetricConfig `yaml:"metrics"`
+	Score    string         `yaml:"score"`
+}
+
+// Keeps the metrics and strategy of the configuration profiles in sync with the tuning ConfigMap
+// until the context is done. A profile without a key in the ConfigMap keeps its configuration.
+func (s *Scheduler) watchTuning(ctx context.Context) {
+	path := fmt.Sprintf("api/v1/namespaces/%s/configmaps", s.config.Tuning.Namespace)
+	query := url.Values{"fieldSelector": {"metadata.name=" + s.config.Tuning.Name}}
+	for ctx.Err() == nil {
+		ch, err := s.kubeAPI.Watch(ctx, "GET", path, query, nil)
+		if err != nil {
+			log.Println("error while watching the tuning configmap:", err)
+		} else {
+			for data := range ch {
+				s.handleTuningEvent(ctx, data)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Applies a change of the tuning ConfigMap. An invalid tuning is rejected as a whole, the
+// profiles keep their current values and a Warning event is recorded on the ConfigMap.
+func (s *Scheduler) handleTuningEvent(ctx context.Context, data []byte) {
+	event := tuningEvent{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Println("error while decoding a tuning event:", err)
+		return
+	}
+
+	var tuned []*Profile
+	switch event.Type {
+	case "ADDED", "MODIFIED":
+		for _, profile := range s.config.Profiles {
+			value, ok := event.Object.Data[profile.Name]
+			if !ok {
+				tuned = append(tuned, profile)
+				continue
+			}
+			tunedProfile, err := tuneProfile(profile, value)
+			if err != nil {
+				s.rejectTuning(ctx, event, err)
+				return
+			}
+			tunedProfile.setProvider(s, profile.provider)
+			tuned = append(tuned, tunedProfile)
+		}
+	case "DELETED":
+		tuned = s.config.Profiles
+	default:
+		return
+	}
+
+	log.Printf("applying the tuning of configmap %s/%s", s.config.Tuning.Namespace, s.config.Tuning.Name)
+	for _, profile := range tuned {
+		s.profiles.setStatic(profile)
+	}
+}
+
+// Returns a copy of the profile with the strategy, metrics and score of the tuning
+func tuneProfile(profile *Profile, value string) (*Profile, error) {
+	tuning := profileTuning{}
+	if err := yaml.UnmarshalStrict([]byte(value), &tuning); err != nil {
+		return nil, fmt.Errorf("profile %q: %s", profile.Name, err)
+	}
+
+	tuned := *profile
+	if tuning.Strategy != "" {
+		tuned.Strategy = tuning.Strategy
+	}
+	if len(tuning.Metrics) > 0 {
+		tuned.Metrics = tuning.Metrics
+	}
+	if tuning.Score != "" {
+		tuned.Score = tuning.Score
+	}
+	if err := tuned.init(); err != nil {
+		return nil, err
+	}
+	if reflect.DeepEqual(tuned.metricNames, profile.metricNames) {
+		// The prefetch loop keeps filling the values of the configuration profile
+		tuned.prefetched = profile.prefetched
+	} else {
+		tuned.prefetched = nil
+	}
+	return &tuned, nil
+}
+
+// Logs and reports a rejected tuning
+func (s *Scheduler) rejectTuning(ctx context.Context, event tuningEvent, err error) {
+	rejectedTunings.Add(1)
+	log.Printf("rejecting the tuning of configmap %s/%s: %s", s.config.Tuning.Namespace, s.config.Tuning.Name, err)
+
+	metadata := event.Object.Metadata
+	reported := kubernetes.NewEvent("ConfigMap", metadata.Namespace, metadata.Name, metadata.UID, s.config.Profiles[0].SchedulerName, "Warning", "InvalidTuning", err.Error())
+	if err := s.kubeAPI.CreateEvent(ctx, reported); err != nil {
+		log.Printf("Error creating the InvalidTuning event of %s: %s", metadata.Name, err)
+	}
+}
@@ -14,12 +14,15 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package main
+package scheduler
 
 type Node struct {
-	name   string
-	metric float64
-	err    error
+	name    string
+	score   float64
+	metrics []float64   // Values the score was calculated from
+	names   []string    // Names of the metrics when they are the ones of a node pool
+	windows [][]float64 // Metric values of every window of the profile
+	err     error
 }
 
 type NodeList []Node
@@ -29,7 +32,7 @@ func (n NodeList) Len() int {
 }
 
 func (n NodeList) Less(i, j int) bool {
-	return n[i].metric < n[j].metric
+	return n[i].score < n[j].score
 }
 
 func (n NodeList) Swap(i, j int) {
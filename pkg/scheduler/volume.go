@@ -0,0 +1,218 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Claims, volumes and storage classes of the cluster, listed once per attempt
+type volumeState struct {
+	claims   map[string]kubernetes.KubePersistentVolumeClaim
+	volumes  map[string]kubernetes.KubePersistentVolume
+	classes  map[string]kubernetes.KubeStorageClass
+	attached map[string]map[string]map[string]bool
+	csiNodes map[string]*kubernetes.KubeCSINode
+}
+
+// Returns the names of the persistent volume claims used by the pod
+func podClaims(pod kubernetes.KubePod) (claims []string) {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	return
+}
+
+func (s *cycleState) volumeState() (*volumeState, error) {
+	if s.volumes != nil {
+		return s.volumes, nil
+	}
+	claims, err := s.scheduler.kubeAPI.ListPersistentVolumeClaims(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := s.scheduler.kubeAPI.ListPersistentVolumes(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	classes, err := s.scheduler.kubeAPI.ListStorageClasses(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &volumeState{
+		claims:   map[string]kubernetes.KubePersistentVolumeClaim{},
+		volumes:  map[string]kubernetes.KubePersistentVolume{},
+		classes:  map[string]kubernetes.KubeStorageClass{},
+		attached: map[string]map[string]map[string]bool{},
+		csiNodes: map[string]*kubernetes.KubeCSINode{},
+	}
+	for _, claim := range claims {
+		state.claims[claim.Metadata.Namespace+"/"+claim.Metadata.Name] = claim
+	}
+	for _, volume := range volumes {
+		state.volumes[volume.Metadata.Name] = volume
+	}
+	for _, class := range classes {
+		state.classes[class.Metadata.Name] = class
+	}
+
+	pods, err := s.assignedPods()
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		for _, name := range podClaims(pod) {
+			claim, ok := state.claims[pod.Metadata.Namespace+"/"+name]
+			if !ok {
+				continue
+			}
+			if volume, ok := state.volumes[claim.Spec.VolumeName]; ok && volume.Spec.CSI != nil {
+				state.attach(pod.Spec.NodeName, volume.Spec.CSI.Driver, volume.Spec.CSI.VolumeHandle)
+			}
+		}
+	}
+	s.volumes = state
+	return state, nil
+}
+
+// Records a volume of a CSI driver attached to a node
+func (v *volumeState) attach(nodeName, driver, handle string) {
+	if v.attached[nodeName] == nil {
+		v.attached[nodeName] = map[string]map[string]bool{}
+	}
+	if v.attached[nodeName][driver] == nil {
+		v.attached[nodeName][driver] = map[string]bool{}
+	}
+	v.attached[nodeName][driver][handle] = true
+}
+
+// Returns the volume count limit of the driver on the node, or -1 if there is none
+func (s *cycleState) volumeLimit(nodeName, driver string) (int, error) {
+	csiNode, ok := s.volumes.csiNodes[nodeName]
+	if !ok {
+		node, err := s.scheduler.kubeAPI.GetCSINode(s.ctx, nodeName)
+		if statusError, isStatus := err.(*kubernetes.StatusError); isStatus && statusError.Code == 404 {
+			err = nil
+		} else if err != nil {
+			return 0, err
+		} else {
+			csiNode = &node
+		}
+		s.volumes.csiNodes[nodeName] = csiNode
+	}
+	if csiNode == nil {
+		return -1, nil
+	}
+	for _, d := range csiNode.Spec.Drivers {
+		if d.Name == driver && d.Allocatable != nil && d.Allocatable.Count != nil {
+			return *d.Allocatable.Count, nil
+		}
+	}
+	return -1, nil
+}
+
+// Rejects the nodes that don't satisfy the node affinity of the bound volumes of the pod,
+// the allowed topologies of the storage class of its unbound claims, or the CSI volume limits
+func volumeBindingFilter(state *cycleState, node kubernetes.KubeNode) error {
+	claims := podClaims(state.pod)
+	if len(claims) == 0 {
+		return nil
+	}
+	volumes, err := state.volumeState()
+	if err != nil {
+		return err
+	}
+
+	labels := node.Metadata.Labels
+	added := map[string]map[string]bool{}
+	for _, name := range claims {
+		claim, ok := volumes.claims[state.pod.Metadata.Namespace+"/"+name]
+		if !ok {
+			return fmt.Errorf("persistent volume claim %s not found", name)
+		}
+
+		if claim.Spec.VolumeName == "" {
+			var class kubernetes.KubeStorageClass
+			if claim.Spec.StorageClassName != nil {
+				class, ok = volumes.classes[*claim.Spec.StorageClassName]
+			}
+			if !ok || !class.WaitForFirstConsumer() {
+				return fmt.Errorf("persistent volume claim %s is not bound", name)
+			}
+			if !class.Allows(labels) {
+				return fmt.Errorf("storage class %s does not allow the topology of the node", class.Metadata.Name)
+			}
+			// The volume will be provisioned by the driver once the node is chosen
+			if added[class.Provisioner] == nil {
+				added[class.Provisioner] = map[string]bool{}
+			}
+			added[class.Provisioner][claim.Metadata.Namespace+"/"+name] = true
+			continue
+		}
+
+		volume, ok := volumes.volumes[claim.Spec.VolumeName]
+		if !ok {
+			return fmt.Errorf("persistent volume %s of claim %s not found", claim.Spec.VolumeName, name)
+		}
+		if volume.Spec.NodeAffinity != nil && !volume.Spec.NodeAffinity.Required.Matches(labels, node.Metadata.Name) {
+			return fmt.Errorf("node affinity of volume %s of claim %s not satisfied", volume.Metadata.Name, name)
+		}
+		if csi := volume.Spec.CSI; csi != nil && !volumes.attached[node.Metadata.Name][csi.Driver][csi.VolumeHandle] {
+			if added[csi.Driver] == nil {
+				added[csi.Driver] = map[string]bool{}
+			}
+			added[csi.Driver][csi.VolumeHandle] = true
+		}
+	}
+
+	for driver, handles := range added {
+		limit, err := state.volumeLimit(node.Metadata.Name, driver)
+		if err != nil {
+			return err
+		}
+		if count := len(volumes.attached[node.Metadata.Name][driver]) + len(handles); limit >= 0 && count > limit {
+			return fmt.Errorf("%d %s volumes exceed the node limit of %d", count, driver, limit)
+		}
+	}
+	return nil
+}
+
+// Tells the provisioner of the unbound claims of the pod the node it was placed on,
+// so the volumes of storage classes with delayed binding are created in its topology
+func (s *Scheduler) bindVolumes(ctx context.Context, pod kubernetes.KubePod, nodeName string) error {
+	for _, name := range podClaims(pod) {
+		claim, err := s.kubeAPI.GetPersistentVolumeClaim(ctx, pod.Metadata.Namespace, name)
+		if err != nil {
+			return fmt.Errorf("retrieving persistent volume claim %s: %s", name, err)
+		}
+		if claim.Spec.VolumeName != "" || claim.Metadata.Annotations[kubernetes.SelectedNodeAnnotation] != "" {
+			continue
+		}
+		if err = s.kubeAPI.AnnotatePersistentVolumeClaim(ctx, pod.Metadata.Namespace, name, kubernetes.SelectedNodeAnnotation, nodeName); err != nil {
+			return fmt.Errorf("selecting node %s for claim %s: %s", nodeName, name, err)
+		}
+		log.Printf("Selected node %s for persistent volume claim %s/%s", nodeName, pod.Metadata.Namespace, name)
+	}
+	return nil
+}
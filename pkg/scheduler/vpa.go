@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"log"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Pods checked with the recommendations of their VerticalPodAutoscaler
+var vpaRecommended = expvar.NewInt("vpaRecommended")
+
+// Returns the requests checked by the NodeResourcesFit filter: with VPARecommendations, the
+// requests of every container raised to the target of the VerticalPodAutoscaler of its workload.
+// A pod without a VerticalPodAutoscaler, or whose one can't be read, is checked with its requests.
+func (s *Scheduler) fitRequests(ctx context.Context, pod kubernetes.KubePod) resourceList {
+	if !s.config.VPARecommendations {
+		return podRequests(pod)
+	}
+	targets, err := s.vpaTargets(ctx, pod)
+	if err != nil {
+		log.Printf("Cannot read the VerticalPodAutoscaler of %s/%s, checking its requests: %s", pod.Metadata.Namespace, pod.Metadata.Name, err)
+		return podRequests(pod)
+	}
+	if len(targets) == 0 {
+		return podRequests(pod)
+	}
+
+	// The containers are copied, the pod is the one bound and reserved with its own requests
+	recommended := pod
+	recommended.Spec.Containers = append(recommended.Spec.Containers[:0:0], pod.Spec.Containers...)
+	for i, container := range recommended.Spec.Containers {
+		target, ok := targets[container.Name]
+		if !ok {
+			continue
+		}
+		requests := parseResourceList(container.Resources.Requests)
+		requests.max(parseResourceList(target))
+		recommended.Spec.Containers[i].Resources.Requests = requests.quantities()
+	}
+	vpaRecommended.Add(1)
+	return podRequests(recommended)
+}
+
+// Returns the target recommendations by container name of the VerticalPodAutoscaler of the
+// workload of the pod, the Deployment of its ReplicaSet or its controller itself
+func (s *Scheduler) vpaTargets(ctx context.Context, pod kubernetes.KubePod) (targets map[string]map[string]string, err error) {
+	owners := map[string]string{}
+	for _, owner := range pod.Metadata.OwnerReferences {
+		if !owner.Controller {
+			continue
+		}
+		owners[owner.Kind] = owner.Name
+		if owner.Kind == "ReplicaSet" {
+			replicaSet, err := s.kubeAPI.ListNamespacedReplicaset(ctx, pod.Metadata.Namespace, owner.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, rsOwner := range replicaSet.Metadata.OwnerReferences {
+				if rsOwner.Controller {
+					owners[rsOwner.Kind] = rsOwner.Name
+				}
+			}
+		}
+	}
+	if len(owners) == 0 {
+		return
+	}
+
+	autoscalers, err := s.kubeAPI.ListVerticalPodAutoscalers(ctx, pod.Metadata.Namespace)
+	if err != nil {
+		return
+	}
+	for _, autoscaler := range autoscalers {
+		target := autoscaler.Spec.TargetRef
+		if name, ok := owners[target.Kind]; !ok || name != target.Name || autoscaler.Status.Recommendation == nil {
+			continue
+		}
+		targets = map[string]map[string]string{}
+		for _, recommendation := range autoscaler.Status.Recommendation.ContainerRecommendations {
+			targets[recommendation.ContainerName] = recommendation.Target
+		}
+		return
+	}
+	return
+}
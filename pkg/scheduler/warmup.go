@@ -0,0 +1,84 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+	"github.com/draios/kubernetes-scheduler/pkg/scoring"
+)
+
+func (c WarmUpConfig) validate() error {
+	if c.Period < 0 || c.BindingsPerMinute < 0 {
+		return errors.New("warmUp: the period and bindingsPerMinute can't be negative")
+	}
+	return nil
+}
+
+// Returns the time left to the warm-up of the node, 0 if the node is warm or its Ready time unknown
+func (s *Scheduler) warmUpLeft(node kubernetes.KubeNode) time.Duration {
+	if s.config.WarmUp.Period <= 0 {
+		return 0
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != "Ready" || condition.Status != "True" {
+			continue
+		}
+		ready, err := time.Parse(time.RFC3339, condition.LastTransitionTime)
+		if err != nil {
+			return 0
+		}
+		if left := s.config.WarmUp.Period - time.Since(ready); left > 0 {
+			return left
+		}
+	}
+	return 0
+}
+
+// Rejects the warming up nodes that got BindingsPerMinute pods during the last minute
+func nodeWarmUpFilter(state *cycleState, node kubernetes.KubeNode) error {
+	if state.scheduler.config.WarmUp.BindingsPerMinute <= 0 || state.scheduler.warmUpLeft(node) == 0 {
+		return nil
+	}
+	if count := state.scheduler.ledger.count(node.Metadata.Name, time.Minute); count >= state.scheduler.config.WarmUp.BindingsPerMinute {
+		return fmt.Errorf("node is warming up and got %d pods in the last minute", count)
+	}
+	return nil
+}
+
+// Scores the nodes with the percentage of their warm-up period left, 100 when they become Ready
+// and 0 once warm: their low utilization is dampened while the pods they get start
+type warmUpScorer struct {
+	schedulerScorer
+}
+
+func (s *warmUpScorer) Name() string {
+	return "warm-up"
+}
+
+func (s *warmUpScorer) Score(ctx context.Context, pod scoring.Pod, node scoring.Node) (float64, error) {
+	kubeNode, err := s.scheduler.findNode(ctx, node.Name)
+	if err != nil || s.scheduler.config.WarmUp.Period <= 0 {
+		// The nodes of the other clusters are not known
+		return 0, nil
+	}
+	return float64(s.scheduler.warmUpLeft(kubeNode)) / float64(s.scheduler.config.WarmUp.Period) * 100, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPodWatchResumes(t *testing.T) {
+	pod := func(name, version string) string {
+		return fmt.Sprintf(`{"metadata":{"namespace":"default","name":%q,"resourceVersion":%q}}`, name, version)
+	}
+	var (
+		mutex sync.Mutex
+		lists int
+	)
+	watches := map[string]int{}
+	s := testScheduler(Config{})
+	s.fakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		query := r.URL.Query()
+		if query.Get("watch") != "true" {
+			lists++
+			if lists == 1 {
+				fmt.Fprintf(w, `{"metadata":{"resourceVersion":"1"},"items":[%s]}`, pod("first", "1"))
+			} else {
+				fmt.Fprintf(w, `{"metadata":{"resourceVersion":"3"},"items":[%s]}`, pod("second", "3"))
+			}
+			return
+		}
+		version := query.Get("resourceVersion")
+		watches[version]++
+		switch version {
+		case "1":
+			// Ends after one event, opened again from its version
+			fmt.Fprintf(w, "{\"type\":\"MODIFIED\",\"object\":%s}\n", pod("first", "2"))
+		case "2":
+			fmt.Fprintln(w, `{"type":"ERROR","object":{"kind":"Status","code":410,"message":"too old resource version"}}`)
+		default:
+			mutex.Unlock()
+			<-r.Context().Done()
+			mutex.Lock()
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := s.kubeAPI.WatchEvents(ctx, "api/v1/pods")
+
+	expected := []string{"ADDED first", "MODIFIED first", "ADDED second", "DELETED first"}
+	var received []string
+	for len(received) < len(expected) {
+		data, ok := <-events
+		if !ok {
+			t.Fatalf("watch closed after %v", received)
+		}
+		var event struct {
+			Type   string `json:"type"`
+			Object struct {
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			} `json:"object"`
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, event.Type+" "+event.Object.Metadata.Name)
+	}
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Fatalf("events %v, expected %v", received, expected)
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if lists != 2 || watches["1"] != 1 || watches["2"] != 1 {
+		t.Errorf("%d lists and watches %v, expected 2 lists and one watch from versions 1 and 2", lists, watches)
+	}
+}
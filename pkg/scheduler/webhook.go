@@ -0,0 +1,217 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// What the webhook does with the pods of an unhealthy scheduler
+const (
+	webhookReject = "reject" // The pod creation is denied
+	webhookMutate = "mutate" // The pod is given to the default scheduler
+)
+
+// AdmissionReview of the admission.k8s.io/v1 api, with only the fields the webhook uses
+type admissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *admissionRequest  `json:"request,omitempty"`
+	Response   *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID    string `json:"uid"`
+	Object struct {
+		Metadata struct {
+			Name         string `json:"name"`
+			GenerateName string `json:"generateName"`
+			Namespace    string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			SchedulerName string `json:"schedulerName"`
+		} `json:"spec"`
+	} `json:"object"`
+}
+
+type admissionResponse struct {
+	UID       string `json:"uid"`
+	Allowed   bool   `json:"allowed"`
+	PatchType string `json:"patchType,omitempty"`
+	Patch     []byte `json:"patch,omitempty"`
+	Result    *struct {
+		Message string `json:"message"`
+	} `json:"status,omitempty"`
+}
+
+// Health of the scheduler as last polled by the webhook
+type schedulerHealth struct {
+	mutex   sync.Mutex
+	healthy bool
+}
+
+func (h *schedulerHealth) check(client *http.Client, url string) {
+	healthy := false
+	response, err := client.Get(url)
+	if err == nil {
+		healthy = response.StatusCode == http.StatusOK
+		response.Body.Close()
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if healthy != h.healthy {
+		log.Printf("scheduler healthy: %t", healthy)
+	}
+	h.healthy = healthy
+}
+
+func (h *schedulerHealth) get() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.healthy
+}
+
+// Runs the admission webhook: while the health url of the scheduler doesn't answer 200, the
+// pods naming one of its scheduler names are rejected or moved to the default scheduler
+func runWebhook(args []string) {
+	flags := flag.NewFlagSet("webhook", flag.ExitOnError)
+	listen := flags.String("listen", ":8443", "Address the webhook listens on")
+	certFile := flags.String("tls-cert", "", "TLS certificate file")
+	keyFile := flags.String("tls-key", "", "TLS key file")
+	healthURL := flags.String("health-url", "", "Health url of the scheduler, like http://sysdig-scheduler:8080/healthz")
+	healthCA := flags.String("health-ca", "", "CA certificate file of the admin server of the scheduler, if it uses TLS")
+	schedulerNames := flags.String("scheduler-names", "", "Comma separated scheduler names served by the scheduler")
+	defaultScheduler := flags.String("default-scheduler", "default-scheduler", "Scheduler the pods are moved to in mutate mode")
+	mode := flags.String("mode", webhookReject, "What to do with the pods while the scheduler is unhealthy: reject or mutate")
+	interval := flags.Duration("check-interval", 5*time.Second, "How often the health of the scheduler is checked")
+	flags.Parse(args)
+
+	if *certFile == "" || *keyFile == "" || *healthURL == "" || *schedulerNames == "" {
+		fmt.Println("Error: -tls-cert, -tls-key, -health-url and -scheduler-names must be set")
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *mode != webhookReject && *mode != webhookMutate {
+		fmt.Printf("Error: unknown mode %q\n", *mode)
+		os.Exit(2)
+	}
+	names := map[string]bool{}
+	for _, name := range strings.Split(*schedulerNames, ",") {
+		names[strings.TrimSpace(name)] = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	if *healthCA != "" {
+		data, err := ioutil.ReadFile(*healthCA)
+		if err != nil {
+			log.Fatalln("fatal: health CA:", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			log.Fatalf("fatal: no certificate found in %s", *healthCA)
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	certificates, err := newCertReloader(*certFile, *keyFile)
+	if err != nil {
+		log.Fatalln("fatal: webhook certificate:", err)
+	}
+	scheduler := &schedulerHealth{}
+	scheduler.check(client, *healthURL)
+	go func() {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				scheduler.check(client, *healthURL)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	server := &http.Server{
+		Addr:      *listen,
+		Handler:   webhookHandler(names, *mode, *defaultScheduler, scheduler),
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certificates.getCertificate},
+	}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		<-signals
+		shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("webhook listening on %s", *listen)
+	if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		log.Fatalln("fatal: webhook server:", err)
+	}
+}
+
+// Answers the admission reviews of the pods
+func webhookHandler(names map[string]bool, mode, defaultScheduler string, scheduler *schedulerHealth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review admissionReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid admission review"})
+			return
+		}
+		request := review.Request
+		response := &admissionResponse{UID: request.UID, Allowed: true}
+
+		if names[request.Object.Spec.SchedulerName] && !scheduler.get() {
+			pod := request.Object.Metadata.Name
+			if pod == "" {
+				pod = request.Object.Metadata.GenerateName
+			}
+			if mode == webhookMutate {
+				log.Printf("Pod %s/%s moved to %s", request.Object.Metadata.Namespace, pod, defaultScheduler)
+				response.PatchType = "JSONPatch"
+				response.Patch, _ = json.Marshal([]map[string]string{{"op": "replace", "path": "/spec/schedulerName", "value": defaultScheduler}})
+			} else {
+				log.Printf("Pod %s/%s rejected", request.Object.Metadata.Namespace, pod)
+				response.Allowed = false
+				response.Result = &struct {
+					Message string `json:"message"`
+				}{fmt.Sprintf("scheduler %s is unhealthy, the pod would stay Pending", request.Object.Spec.SchedulerName)}
+			}
+		}
+
+		writeJSON(w, http.StatusOK, admissionReview{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview", Response: response})
+	})
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/draios/kubernetes-scheduler/pkg/metrics"
+	"github.com/draios/kubernetes-scheduler/pkg/tracing"
+)
+
+// How the scores of the windows of a profile are combined
+const (
+	consensusWeighted = "weighted"
+	consensusRank     = "rank"
+)
+
+// Checks the windows of the profile and sets their defaults
+func (p *Profile) validateWindows() error {
+	switch p.WindowConsensus {
+	case "":
+		p.WindowConsensus = consensusWeighted
+	case consensusWeighted, consensusRank:
+	default:
+		return fmt.Errorf("unknown window consensus %q", p.WindowConsensus)
+	}
+	if len(p.Windows) > 0 && len(p.NodePools) > 0 {
+		return fmt.Errorf("the windows can't be used with node pools")
+	}
+	for i := range p.Windows {
+		window := &p.Windows[i]
+		if window.Window <= 0 || window.Window%time.Second != 0 {
+			return fmt.Errorf("window %d: the window must be a positive number of seconds", i)
+		}
+		if window.Sampling <= 0 {
+			window.Sampling = window.Window
+		}
+		if window.Sampling > window.Window || window.Sampling%time.Second != 0 {
+			return fmt.Errorf("window %s: the sampling must be whole seconds up to the window", window.Window)
+		}
+		if window.Weight < 0 {
+			return fmt.Errorf("window %s: the weight can't be negative", window.Window)
+		}
+		if window.Weight == 0 {
+			window.Weight = 1
+		}
+	}
+	return nil
+}
+
+// Reads the metrics of the profile for a node over every window of the profile. The values are
+// the average of the values of the windows by their weight, with the values of every window.
+func (s *Scheduler) getWindowMetrics(ctx context.Context, profile *Profile, nodeName string) (metricValues []float64, windows [][]float64, err error) {
+	ctx, span := tracing.Start(ctx, "metrics")
+	span.SetAttribute("node", nodeName)
+	span.SetAttribute("provider", profile.provider.Name())
+	span.SetAttribute("windows", len(profile.Windows))
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	metricValues = make([]float64, len(profile.metricNames))
+	var total float64
+	for _, window := range profile.Windows {
+		values, err := s.windowMetrics(ctx, profile, window, nodeName)
+		if err != nil {
+			return nil, nil, err
+		}
+		for m, value := range values {
+			metricValues[m] += window.Weight * value
+		}
+		total += window.Weight
+		windows = append(windows, values)
+	}
+	for m := range metricValues {
+		metricValues[m] /= total
+	}
+	return
+}
+
+// Returns the average of the metrics of the profile for a node over the window. They are cached
+// for a sampling interval, the window moves by a datapoint in that time.
+func (s *Scheduler) windowMetrics(ctx context.Context, profile *Profile, window WindowConfig, nodeName string) (values []float64, err error) {
+	key := "window/" + profile.Name + "/" + window.Window.String() + "/" + nodeName
+	if data, ok, _ := s.metricCache.Get(ctx, key); ok && json.Unmarshal(data, &values) == nil && len(values) == len(profile.metricNames) {
+		return
+	}
+	if !s.breakers.allow(nodeName) {
+		return nil, circuitOpen
+	}
+	provider, ok := profile.provider.(metrics.SeriesProvider)
+	if !ok {
+		return nil, fmt.Errorf("the %s provider can't read the metrics over windows", profile.provider.Name())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.MetricsTimeout)
+	defer cancel()
+	var series [][]float64
+	err = withRetries(ctx, s.config.Retry, func() (err error) {
+		if err = s.limits.of(profile).waitMetrics(ctx); err != nil {
+			return
+		}
+		series, err = provider.NodeSeries(ctx, nodeName, profile.metricNames, window.Window, window.Sampling)
+		return
+	})
+	if err == nil && len(series) != len(profile.metricNames) {
+		err = metrics.NoDataFound
+	}
+	for m := 0; err == nil && m < len(series); m++ {
+		if len(series[m]) == 0 {
+			err = metrics.NoDataFound
+		}
+	}
+	if err != metrics.NoDataFound {
+		s.breakers.record(nodeName, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, datapoints := range series {
+		values = append(values, metrics.Aggregate(datapoints, metrics.AggregationAvg))
+	}
+	if data, err := json.Marshal(values); err == nil {
+		s.metricCache.Set(ctx, key, data, window.Sampling)
+	}
+	return
+}
+
+// Replaces the score of the nodes with the average by weight of their points in every window. In
+// a window the nodes are scored with the values of the window and get 100 points for the best one
+// down to 0 for the worst, the tied nodes sharing the same points. The points are reversed when
+// lower scores are better, so the best node stays first.
+func rankConsensus(profile *Profile, list NodeList) {
+	var valid []int
+	for i, node := range list {
+		if node.err == nil && len(node.windows) == len(profile.Windows) {
+			valid = append(valid, i)
+		}
+	}
+	if len(valid) == 0 {
+		return
+	}
+
+	points := make([]float64, len(valid))
+	var total float64
+	for w, window := range profile.Windows {
+		windowList := make(NodeList, len(valid))
+		for k, i := range valid {
+			node := list[i]
+			// The scorer values, after the metrics, are the same in every window
+			values := append(append([]float64(nil), node.windows[w]...), node.metrics[len(node.windows[w]):]...)
+			windowList[k] = Node{name: node.name, metrics: values}
+		}
+		scoreList(profile, windowList)
+
+		for k, node := range windowList {
+			// The rank is the number of nodes scored better, a node without a score is the worst
+			rank := 0
+			for _, other := range windowList {
+				if other.err == nil && (node.err != nil || better(profile, other, node)) {
+					rank++
+				}
+			}
+			if len(windowList) > 1 {
+				points[k] += window.Weight * 100 * float64(len(windowList)-1-rank) / float64(len(windowList)-1)
+			} else {
+				points[k] += window.Weight * 100
+			}
+		}
+		total += window.Weight
+	}
+
+	for k, i := range valid {
+		score := points[k] / total
+		if profile.lowerIsBetter() {
+			score = 100 - score
+		}
+		list[i].score = score
+	}
+}
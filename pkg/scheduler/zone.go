@@ -0,0 +1,102 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"log"
+
+	"github.com/draios/kubernetes-scheduler/pkg/kubernetes"
+)
+
+// Well-known topology labels of the nodes
+const (
+	zoneLabel   = "topology.kubernetes.io/zone"
+	regionLabel = "topology.kubernetes.io/region"
+)
+
+// Returns the region/zone of a node, empty if it has no zone label
+func nodeZone(node kubernetes.KubeNode) string {
+	zone := node.Metadata.Labels[zoneLabel]
+	if zone == "" {
+		return ""
+	}
+	return node.Metadata.Labels[regionLabel] + "/" + zone
+}
+
+// Returns the uid of the controller owning the pod (ReplicaSet, StatefulSet, ...)
+func controllerOf(pod kubernetes.KubePod) (uid string, ok bool) {
+	for _, owner := range pod.Metadata.OwnerReferences {
+		if owner.Controller {
+			return owner.UID, true
+		}
+	}
+	return "", false
+}
+
+// Restricts the candidates to the nodes of the zones running the fewest replicas of the workload
+// of the pod, so the best node by metrics is chosen within the least populated zone. The candidates
+// are returned unchanged for pods without a controller or if no candidate has a zone.
+func (s *Scheduler) balanceZones(ctx context.Context, pod kubernetes.KubePod, nodes []kubernetes.KubeNode, candidates []string) []string {
+	owner, ok := controllerOf(pod)
+	if !ok {
+		return candidates
+	}
+
+	zones := map[string]string{}
+	for _, node := range nodes {
+		zones[node.Metadata.Name] = nodeZone(node)
+	}
+
+	replicas := map[string]int{}
+	for _, name := range candidates {
+		if zone := zones[name]; zone != "" {
+			replicas[zone] = 0
+		}
+	}
+	if len(replicas) == 0 {
+		return candidates
+	}
+
+	pods, err := s.kubeAPI.ListPods(ctx, pod.Metadata.Namespace, "spec.nodeName!=,status.phase!=Succeeded,status.phase!=Failed")
+	if err != nil {
+		log.Println("error while listing the replicas for zone balancing:", err)
+		return candidates
+	}
+	for _, other := range pods {
+		if uid, ok := controllerOf(other); ok && uid == owner {
+			if zone, ok := zones[other.Spec.NodeName]; ok && zone != "" {
+				replicas[zone]++
+			}
+		}
+	}
+
+	minimum := -1
+	for _, count := range replicas {
+		if minimum < 0 || count < minimum {
+			minimum = count
+		}
+	}
+
+	var balanced []string
+	for _, name := range candidates {
+		if zone := zones[name]; zone != "" && replicas[zone] == minimum {
+			balanced = append(balanced, name)
+		}
+	}
+	return balanced
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoring
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Well-known label of the instance type of a node
+const InstanceTypeLabel = "node.kubernetes.io/instance-type"
+
+// Cost scores a node with its hourly price. The price is read from the PriceLabel of the node if
+// it has one, otherwise from the Prices table by instance type, where "default" is used for the
+// types that are not listed.
+type Cost struct {
+	Prices     map[string]float64
+	PriceLabel string
+}
+
+func (c *Cost) Name() string {
+	return "cost"
+}
+
+func (c *Cost) Score(ctx context.Context, pod Pod, node Node) (float64, error) {
+	if c.PriceLabel != "" {
+		if value, ok := node.Labels[c.PriceLabel]; ok {
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return 0, fmt.Errorf("cost: node %s: invalid price label: %s", node.Name, err)
+			}
+			return price, nil
+		}
+	}
+	if price, ok := c.Prices[node.Labels[InstanceTypeLabel]]; ok {
+		return price, nil
+	}
+	if price, ok := c.Prices["default"]; ok {
+		return price, nil
+	}
+	return 0, fmt.Errorf("cost: no price for node %s of instance type %q", node.Name, node.Labels[InstanceTypeLabel])
+}
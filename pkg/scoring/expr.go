@@ -0,0 +1,295 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoring
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Expression is an arithmetic expression over metric values, like
+// "0.6*cpu.used.percent + 0.4*(100 - fs.free.percent)": numbers, variables named like the metrics,
+// + - * / with the usual precedence, parentheses and the functions min, max, abs, log and sqrt
+type Expression struct {
+	text      string
+	root      expressionNode
+	variables map[string]bool
+}
+
+type expressionNode func(values map[string]float64) (float64, error)
+
+// Functions callable in an expression, with their number of arguments (0 for any, at least one)
+var expressionFunctions = map[string]struct {
+	arguments int
+	call      func(arguments []float64) float64
+}{
+	"min":  {0, func(a []float64) float64 { return extreme(a, math.Min) }},
+	"max":  {0, func(a []float64) float64 { return extreme(a, math.Max) }},
+	"abs":  {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"log":  {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"sqrt": {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+}
+
+func extreme(values []float64, pick func(a, b float64) float64) float64 {
+	result := values[0]
+	for _, value := range values[1:] {
+		result = pick(result, value)
+	}
+	return result
+}
+
+// Parses an expression
+func ParseExpression(text string) (*Expression, error) {
+	p := &expressionParser{text: text, variables: map[string]bool{}}
+	p.next()
+	root, err := p.sum()
+	if err == nil && p.token != "" {
+		err = p.errorf("unexpected %q", p.token)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %s", text, err)
+	}
+	return &Expression{text: text, root: root, variables: p.variables}, nil
+}
+
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Returns the sorted names of the variables of the expression
+func (e *Expression) Variables() (names []string) {
+	for name := range e.variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Returns the value of the expression, an error if a variable has no value or if the value, or
+// the result of a function like the log of 0, is not a finite number
+func (e *Expression) Eval(values map[string]float64) (float64, error) {
+	value, err := e.root(values)
+	if err == nil && !finite(value) {
+		err = fmt.Errorf("%g is not a finite number", value)
+	}
+	return value, err
+}
+
+func finite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+// Recursive descent parser, token is the current token and position the offset after it
+type expressionParser struct {
+	text      string
+	position  int
+	token     string
+	number    bool
+	variables map[string]bool
+}
+
+func (p *expressionParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", p.position, fmt.Sprintf(format, args...))
+}
+
+// Reads the next token: a number, an identifier, or an operator character
+func (p *expressionParser) next() {
+	for p.position < len(p.text) && (p.text[p.position] == ' ' || p.text[p.position] == '\t') {
+		p.position++
+	}
+	start := p.position
+	p.number = false
+	switch {
+	case p.position == len(p.text):
+	case isDigit(p.text[p.position]) || p.text[p.position] == '.':
+		for p.position < len(p.text) && (isDigit(p.text[p.position]) || p.text[p.position] == '.') {
+			p.position++
+		}
+		p.number = true
+	case isIdentifierStart(p.text[p.position]):
+		// Metric names have dots, underscores and digits, like cpu.used.percent
+		for p.position < len(p.text) && (isIdentifierStart(p.text[p.position]) || isDigit(p.text[p.position]) || p.text[p.position] == '.') {
+			p.position++
+		}
+	default:
+		p.position++
+	}
+	p.token = p.text[start:p.position]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// sum: product (("+" | "-") product)*
+func (p *expressionParser) sum() (expressionNode, error) {
+	left, err := p.product()
+	for err == nil && (p.token == "+" || p.token == "-") {
+		operator := p.token
+		p.next()
+		var right expressionNode
+		if right, err = p.product(); err == nil {
+			left = binary(operator, left, right)
+		}
+	}
+	return left, err
+}
+
+// product: unary (("*" | "/") unary)*
+func (p *expressionParser) product() (expressionNode, error) {
+	left, err := p.unary()
+	for err == nil && (p.token == "*" || p.token == "/") {
+		operator := p.token
+		p.next()
+		var right expressionNode
+		if right, err = p.unary(); err == nil {
+			left = binary(operator, left, right)
+		}
+	}
+	return left, err
+}
+
+// unary: "-" unary | primary
+func (p *expressionParser) unary() (expressionNode, error) {
+	if p.token != "-" {
+		return p.primary()
+	}
+	p.next()
+	operand, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(values map[string]float64) (float64, error) {
+		value, err := operand(values)
+		return -value, err
+	}, nil
+}
+
+// primary: number | variable | function "(" sum ("," sum)* ")" | "(" sum ")"
+func (p *expressionParser) primary() (expressionNode, error) {
+	token := p.token
+	switch {
+	case token == "":
+		return nil, p.errorf("unexpected end")
+	case p.number:
+		value, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", token)
+		}
+		p.next()
+		return func(map[string]float64) (float64, error) { return value, nil }, nil
+	case token == "(":
+		p.next()
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.token != ")" {
+			return nil, p.errorf("missing )")
+		}
+		p.next()
+		return inner, nil
+	case isIdentifierStart(token[0]):
+		p.next()
+		if p.token == "(" {
+			return p.call(token)
+		}
+		p.variables[token] = true
+		return func(values map[string]float64) (float64, error) {
+			value, ok := values[token]
+			if !ok {
+				return 0, fmt.Errorf("no value for %s", token)
+			}
+			return value, nil
+		}, nil
+	}
+	return nil, p.errorf("unexpected %q", token)
+}
+
+// Parses the arguments of a function call, the current token being its "("
+func (p *expressionParser) call(name string) (expressionNode, error) {
+	function, ok := expressionFunctions[name]
+	if !ok {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	var arguments []expressionNode
+	for {
+		p.next()
+		argument, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument)
+		if p.token != "," {
+			break
+		}
+	}
+	if p.token != ")" {
+		return nil, p.errorf("missing ) after the arguments of %s", name)
+	}
+	p.next()
+	if function.arguments > 0 && len(arguments) != function.arguments {
+		return nil, p.errorf("%s takes %d argument(s)", name, function.arguments)
+	}
+
+	return func(values map[string]float64) (float64, error) {
+		evaluated := make([]float64, len(arguments))
+		for i, argument := range arguments {
+			value, err := argument(values)
+			if err != nil {
+				return 0, err
+			}
+			evaluated[i] = value
+		}
+		result := function.call(evaluated)
+		if !finite(result) {
+			return 0, fmt.Errorf("%s of %v is not a finite number", name, evaluated)
+		}
+		return result, nil
+	}, nil
+}
+
+func binary(operator string, left, right expressionNode) expressionNode {
+	return func(values map[string]float64) (float64, error) {
+		a, err := left(values)
+		if err != nil {
+			return 0, err
+		}
+		b, err := right(values)
+		if err != nil {
+			return 0, err
+		}
+		switch operator {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		}
+		if b == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoring
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpressionEval(t *testing.T) {
+	values := map[string]float64{"cpu.used.percent": 60, "fs.free.percent": 30, "mem_2": 4}
+	tests := []struct {
+		text string
+		want float64
+		err  string
+	}{
+		{text: "1 + 2 * 3", want: 7},
+		{text: "(1 + 2) * 3", want: 9},
+		{text: "10 - 4 - 3", want: 3},
+		{text: "12 / 3 / 2", want: 2},
+		{text: "-2 * -3", want: 6},
+		{text: "--2", want: 2},
+		{text: "2 - -1", want: 3},
+		{text: "0.6*cpu.used.percent + 0.4*(100 - fs.free.percent)", want: 64},
+		{text: "mem_2 * 0.5", want: 2},
+		{text: "min(3, 1, 2) + max(4, 5)", want: 6},
+		{text: "abs(-2.5)", want: 2.5},
+		{text: "sqrt(mem_2) * log(1)", want: 0},
+		{text: "max(log(0), 1)", err: "log of [0] is not a finite number"},
+		{text: "log(0)", err: "not a finite number"},
+		{text: "log(-1)", err: "not a finite number"},
+		{text: "sqrt(-4)", err: "not a finite number"},
+		{text: "cpu.used.percent / (mem_2 - 4)", err: "division by zero"},
+		{text: "unknown.metric + 1", err: "no value for unknown.metric"},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			expression, err := ParseExpression(test.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := expression.Eval(values)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("Eval() error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("Eval() = %v, %v, want %v", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestExpressionNotFinite(t *testing.T) {
+	expression, err := ParseExpression("x * 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := expression.Eval(map[string]float64{"x": value}); err == nil {
+			t.Errorf("Eval() of x=%v is not an error", value)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{"", "unexpected end"},
+		{"1 +", "unexpected end"},
+		{"(1 + 2", "missing )"},
+		{"1 + 2)", `unexpected ")"`},
+		{"2 3", `unexpected "3"`},
+		{"* 2", `unexpected "*"`},
+		{"1..2", "invalid number"},
+		{"pow(2, 3)", "unknown function pow"},
+		{"log(1, 2)", "log takes 1 argument(s)"},
+		{"abs()", "unexpected \")\""},
+		{"max(1, 2", "missing ) after the arguments of max"},
+		{"cpu # 2", `unexpected "#"`},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			_, err := ParseExpression(test.text)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseExpression() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestExpressionVariables(t *testing.T) {
+	expression, err := ParseExpression("max(cpu.used.percent, mem) / cpu.used.percent + log(disk)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := expression.Variables(), []string{"cpu.used.percent", "disk", "mem"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Variables() = %v, want %v", got, want)
+	}
+}
+
+func TestBestNotFinite(t *testing.T) {
+	candidates := []Candidate{{Name: "nan", Score: math.NaN()}, {Name: "a", Score: 3}, {Name: "inf", Score: math.Inf(-1)}, {Name: "b", Score: 1}}
+	if best, ok := Best(candidates, true); !ok || best.Name != "b" {
+		t.Errorf("Best(lowest) = %s, %v, want b", best.Name, ok)
+	}
+	if best, ok := Best(candidates, false); !ok || best.Name != "a" {
+		t.Errorf("Best(highest) = %s, %v, want a", best.Name, ok)
+	}
+	if _, ok := Best([]Candidate{{Name: "nan", Score: math.NaN()}}, true); ok {
+		t.Error("Best() of a NaN score is ok")
+	}
+}
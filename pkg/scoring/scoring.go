@@ -0,0 +1,111 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Scores of the candidate nodes from their metric values, and the external scorers adding
+// custom logic to them
+package scoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"plugin"
+	"strconv"
+	"strings"
+)
+
+// Pod being scheduled, as seen by the scorers. Requests are the resources requested by its
+// containers in base units ("cpu" in cores, "memory" in bytes, "nvidia.com/gpu" in devices).
+// Images are the images of its containers. Controller is the uid of the controller owning it, like
+// its ReplicaSet or Job, empty for a bare pod.
+type Pod struct {
+	Name        string             `json:"name"`
+	Namespace   string             `json:"namespace"`
+	Labels      map[string]string  `json:"labels"`
+	Annotations map[string]string  `json:"annotations"`
+	Requests    map[string]float64 `json:"requests"`
+	Images      []string           `json:"images"`
+	Controller  string             `json:"controller,omitempty"`
+}
+
+// Candidate node, with the metric values read by the profile provider
+type Node struct {
+	Name    string             `json:"name"`
+	Labels  map[string]string  `json:"labels"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// Scorer returns a value for the node that is weighted and added to its score like a metric
+type Scorer interface {
+	Name() string
+	Score(ctx context.Context, pod Pod, node Node) (float64, error)
+}
+
+// Opens a Go plugin exporting a Scorer variable implementing the interface
+func LoadPlugin(path string) (Scorer, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := p.Lookup("Scorer")
+	if err != nil {
+		return nil, err
+	}
+	// Lookup returns a pointer to the variable
+	if scorer, ok := symbol.(*Scorer); ok {
+		return *scorer, nil
+	}
+	if scorer, ok := symbol.(Scorer); ok {
+		return scorer, nil
+	}
+	return nil, fmt.Errorf("plugin %s: Scorer does not implement scoring.Scorer", path)
+}
+
+// Exec runs a command for every node, with {"pod": ..., "node": ...} as json on its standard
+// input, and reads the score as a number on its standard output. Any runtime can be used this
+// way, like a WASM module run with "wasmtime run scorer.wasm".
+type Exec struct {
+	ScorerName string
+	Path       string
+	Args       []string
+}
+
+func (e *Exec) Name() string {
+	return e.ScorerName
+}
+
+func (e *Exec) Score(ctx context.Context, pod Pod, node Node) (score float64, err error) {
+	input, err := json.Marshal(map[string]interface{}{"pod": pod, "node": node})
+	if err != nil {
+		return
+	}
+
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, e.Path, e.Args...)
+	command.Stdin = bytes.NewReader(input)
+	command.Stdout, command.Stderr = &stdout, &stderr
+	if err = command.Run(); err != nil {
+		return 0, fmt.Errorf("scorer %s: %s: %s", e.ScorerName, err, strings.TrimSpace(stderr.String()))
+	}
+
+	score, err = strconv.ParseFloat(strings.TrimSpace(stdout.String()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("scorer %s: invalid score: %s", e.ScorerName, err)
+	}
+	return
+}
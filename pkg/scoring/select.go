@@ -0,0 +1,176 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoring
+
+import (
+	"math"
+	"sort"
+)
+
+// Normalizations of the metric values before they are weighted
+const (
+	NormalizeNone   = "none"   // The raw value
+	NormalizeMinMax = "minmax" // Scaled to 0-1 between the lowest and highest value of the candidates
+	NormalizeZScore = "zscore" // Distance to the mean of the candidates in standard deviations
+	NormalizeRange  = "range"  // Scaled to 0-1 between Min and Max, clamped
+)
+
+// Transformations of the raw metric values, applied in order before the normalization
+const (
+	TransformInvert     = "invert"       // 1/(1+x), negative values counted as 0
+	TransformLog        = "log"          // log(1+x), negative values counted as 0
+	TransformClamp      = "clamp"        // Clamped between Min and Max
+	TransformFreeToUsed = "free-to-used" // 100-x, a free percent mapped to a used percent
+)
+
+// Metric is transformed with Transforms and normalized over the candidates with Normalize,
+// reversed if Reverse, then multiplied by Weight
+type Metric struct {
+	Name       string
+	Weight     float64
+	Normalize  string
+	Min        float64
+	Max        float64
+	Transforms []string
+	Reverse    bool
+}
+
+// Candidate is a node with the values of the metrics, in the order of the metrics, followed by
+// the values of the scorers
+type Candidate struct {
+	Name   string
+	Values []float64
+	Score  float64
+}
+
+// Normalizes the values of the metrics over the candidates and sets their score: the sum of the
+// weighted normalized metric values plus the scorer values weighted by scorerWeights
+func Score(metrics []Metric, scorerWeights []float64, candidates []Candidate) {
+	normalized := make([][]float64, len(candidates))
+	for i := range candidates {
+		normalized[i] = append([]float64(nil), candidates[i].Values...)
+	}
+
+	for m, metric := range metrics {
+		values := make([]float64, len(candidates))
+		for i, candidate := range candidates {
+			values[i] = Transform(metric, candidate.Values[m])
+		}
+		for i, value := range Normalize(metric, values) {
+			normalized[i][m] = reverse(metric, value)
+		}
+	}
+
+	for i := range candidates {
+		candidates[i].Score = 0
+		for m, metric := range metrics {
+			candidates[i].Score += metric.Weight * normalized[i][m]
+		}
+		for s, weight := range scorerWeights {
+			candidates[i].Score += weight * normalized[i][len(metrics)+s]
+		}
+	}
+}
+
+// Sorts the candidates by increasing score and returns the best one, the lowest if lowerIsBetter.
+// The candidates whose score is not a finite number are moved after the others, they are never the best.
+func Best(candidates []Candidate, lowerIsBetter bool) (best Candidate, ok bool) {
+	valid := 0
+	for i := range candidates {
+		if finite(candidates[i].Score) {
+			candidates[valid], candidates[i] = candidates[i], candidates[valid]
+			valid++
+		}
+	}
+	candidates = candidates[:valid]
+	if len(candidates) == 0 {
+		return
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score < candidates[j].Score
+	})
+	if lowerIsBetter {
+		return candidates[0], true
+	}
+	return candidates[len(candidates)-1], true
+}
+
+// Returns the values of a metric for all the candidates normalized as the metric is configured
+func Normalize(metric Metric, values []float64) []float64 {
+	result := make([]float64, len(values))
+	switch metric.Normalize {
+	case NormalizeMinMax:
+		low, high := math.Inf(1), math.Inf(-1)
+		for _, value := range values {
+			low, high = math.Min(low, value), math.Max(high, value)
+		}
+		for i, value := range values {
+			if high > low {
+				result[i] = (value - low) / (high - low)
+			}
+		}
+	case NormalizeZScore:
+		var mean, variance float64
+		for _, value := range values {
+			mean += value / float64(len(values))
+		}
+		for _, value := range values {
+			variance += (value - mean) * (value - mean) / float64(len(values))
+		}
+		for i, value := range values {
+			if variance > 0 {
+				result[i] = (value - mean) / math.Sqrt(variance)
+			}
+		}
+	case NormalizeRange:
+		for i, value := range values {
+			result[i] = math.Max(0, math.Min(1, (value-metric.Min)/(metric.Max-metric.Min)))
+		}
+	default:
+		copy(result, values)
+	}
+	return result
+}
+
+// Returns the value with the transformations of the metric applied in order
+func Transform(metric Metric, value float64) float64 {
+	for _, transform := range metric.Transforms {
+		switch transform {
+		case TransformInvert:
+			value = 1 / (1 + math.Max(0, value))
+		case TransformLog:
+			value = math.Log1p(math.Max(0, value))
+		case TransformClamp:
+			value = math.Max(metric.Min, math.Min(metric.Max, value))
+		case TransformFreeToUsed:
+			value = 100 - value
+		}
+	}
+	return value
+}
+
+// Reverses the order of a normalized value if the metric is reversed, keeping the values
+// scaled to 0-1 in that range
+func reverse(metric Metric, value float64) float64 {
+	if !metric.Reverse {
+		return value
+	}
+	if metric.Normalize == NormalizeMinMax || metric.Normalize == NormalizeRange {
+		return 1 - value
+	}
+	return -value
+}
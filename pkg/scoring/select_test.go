@@ -0,0 +1,116 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoring
+
+import (
+	"math"
+	"testing"
+)
+
+func equalValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric Metric
+		values []float64
+		want   []float64
+	}{
+		{"none", Metric{Normalize: NormalizeNone}, []float64{10, 20, 40}, []float64{10, 20, 40}},
+		{"default", Metric{}, []float64{-5, 7}, []float64{-5, 7}},
+		{"minmax", Metric{Normalize: NormalizeMinMax}, []float64{10, 20, 30}, []float64{0, 0.5, 1}},
+		{"minmax of equal values", Metric{Normalize: NormalizeMinMax}, []float64{42, 42}, []float64{0, 0}},
+		{"minmax of one value", Metric{Normalize: NormalizeMinMax}, []float64{42}, []float64{0}},
+		{"zscore", Metric{Normalize: NormalizeZScore}, []float64{2, 4, 4, 4, 5, 5, 7, 9}, []float64{-1.5, -0.5, -0.5, -0.5, 0, 0, 1, 2}},
+		{"zscore of equal values", Metric{Normalize: NormalizeZScore}, []float64{3, 3, 3}, []float64{0, 0, 0}},
+		{"range", Metric{Normalize: NormalizeRange, Min: 0, Max: 200}, []float64{50, 100}, []float64{0.25, 0.5}},
+		{"range clamped", Metric{Normalize: NormalizeRange, Min: 10, Max: 20}, []float64{5, 15, 25}, []float64{0, 0.5, 1}},
+		{"no values", Metric{Normalize: NormalizeMinMax}, nil, []float64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Normalize(test.metric, test.values); !equalValues(got, test.want) {
+				t.Errorf("Normalize(%v) = %v, want %v", test.values, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		transforms []string
+		value      float64
+		want       float64
+	}{
+		{nil, 7, 7},
+		{[]string{TransformInvert}, 3, 0.25},
+		{[]string{TransformInvert}, -3, 1},
+		{[]string{TransformLog}, math.E - 1, 1},
+		{[]string{TransformLog}, -1, 0},
+		{[]string{TransformClamp}, 150, 100},
+		{[]string{TransformClamp}, -5, 0},
+		{[]string{TransformFreeToUsed}, 30, 70},
+		{[]string{TransformFreeToUsed, TransformClamp}, 130, 0},
+		// Applied in order
+		{[]string{TransformInvert, TransformLog}, 3, math.Log1p(0.25)},
+		{[]string{TransformLog, TransformInvert}, 3, 1 / (1 + math.Log1p(3))},
+	}
+	for _, test := range tests {
+		got := Transform(Metric{Transforms: test.transforms, Min: 0, Max: 100}, test.value)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("Transform(%v, %v) = %v, want %v", test.transforms, test.value, got, test.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	metrics := []Metric{
+		{Name: "cpu", Weight: 2, Normalize: NormalizeMinMax},
+		{Name: "free", Weight: 1, Normalize: NormalizeMinMax, Reverse: true},
+		{Name: "load", Weight: 1, Normalize: NormalizeZScore, Reverse: true},
+	}
+	candidates := []Candidate{
+		{Name: "a", Values: []float64{10, 100, 1, 5}},
+		{Name: "b", Values: []float64{30, 0, 3, 1}},
+	}
+	Score(metrics, []float64{0.5}, candidates)
+
+	// cpu 0 and 1, free reversed 0 and 1, load reversed 1 and -1, the scorer value weighted by 0.5
+	want := []float64{2*0 + 0 + 1 + 2.5, 2*1 + 1 - 1 + 0.5}
+	for i, candidate := range candidates {
+		if math.Abs(candidate.Score-want[i]) > 1e-9 {
+			t.Errorf("score of %s = %v, want %v", candidate.Name, candidate.Score, want[i])
+		}
+	}
+	best, ok := Best(candidates, true)
+	if !ok || best.Name != "b" {
+		t.Errorf("Best() = %s, %v, want b", best.Name, ok)
+	}
+	if _, ok := Best(nil, true); ok {
+		t.Error("Best() of no candidate is ok")
+	}
+}
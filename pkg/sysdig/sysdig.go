@@ -18,26 +18,79 @@ limitations under the License.
 package sysdig
 
 import (
-	"net/http"
-	"fmt"
-	"encoding/json"
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
-	"time"
+	"net/http"
 )
 
 const apiUrl = "https://api.sysdigcloud.com/"
 
+// Api urls of the Sysdig SaaS regions
+var Regions = map[string]string{
+	"us1": "https://app.sysdigcloud.com/",
+	"us2": "https://us2.app.sysdig.com/",
+	"us4": "https://app.us4.sysdig.com/",
+	"eu1": "https://eu1.app.sysdig.com/",
+	"au1": "https://app.au1.sysdig.com/",
+}
+
 type SysdigApiClient struct {
-	token string
+	token  string
+	tokenSource func() string
+	url    string
+	client *http.Client
 }
 
 func (api *SysdigApiClient) SetToken(token string) {
 	api.token = token
 }
 
+// Reads the token from source before every request instead of the token set, so a rotated token
+// is used without restarting
+func (api *SysdigApiClient) SetTokenSource(source func() string) {
+	api.tokenSource = source
+}
+
+func (api SysdigApiClient) bearerToken() string {
+	if api.tokenSource != nil {
+		return api.tokenSource()
+	}
+	return api.token
+}
+
+// Sets the url of the Sysdig api, for other SaaS regions or on-prem installations
+func (api *SysdigApiClient) SetURL(url string) {
+	if url != "" && url[len(url)-1] != '/' {
+		url += "/"
+	}
+	api.url = url
+}
+
+// Sets the http client of the requests, with the TLS or proxy settings of an on-prem installation
+func (api *SysdigApiClient) SetHTTPClient(client *http.Client) {
+	api.client = client
+}
+
+// Returns the http client of the requests, nil for http.DefaultClient
+func (api SysdigApiClient) HTTPClient() *http.Client {
+	return api.client
+}
+
+func (api SysdigApiClient) endpoint() string {
+	if api.url == "" {
+		return apiUrl
+	}
+	return api.url
+}
+
 // Export metric data (both time-series and table-based)
 //
+// - ctx:
+// 		Context of the request, its deadline or cancellation aborts the call.
+//
 // - metrics:
 // 		A list of dictionaries, specifying the metrics and grouping keys that the query will return.
 // 		A metric is any of the entries that can be found in the *Metrics* section of the Explore page in Sysdig Monitor.
@@ -75,7 +128,7 @@ func (api *SysdigApiClient) SetToken(token string) {
 // 		In cases where grouping keys are missing or apply to both hosts and containers (e.g. "tag.Name"),
 // 		datasourceType can be explicitly set to avoid any ambiguity and allow the user to select precisely what kind of
 // 		data should be used for the request.
-func (api SysdigApiClient) GetData(metrics []map[string]interface{}, start, end, sampling int, filter, dataSourceType string) (response *http.Response, err error) {
+func (api SysdigApiClient) GetData(ctx context.Context, metrics []map[string]interface{}, start, end, sampling int, filter, dataSourceType string) (response *http.Response, err error) {
 	if dataSourceType == "" {
 		dataSourceType = "host"
 	}
@@ -106,11 +159,14 @@ func (api SysdigApiClient) GetData(metrics []map[string]interface{}, start, end,
 	reqBytes, err := json.Marshal(reqBody)
 	body := bytes.NewReader(reqBytes)
 
-	return api.Request("POST", "api/data", body)
+	return api.Request(ctx, "POST", "api/data", body)
 }
 
 // Makes a request to the Sysdig API endpoint.
 //
+// - ctx:
+// 		Context of the request, its deadline or cancellation aborts the call.
+//
 // - httpMethod:
 // 		The HTTP request method ("GET", "POST", "PUT", ...).
 //
@@ -119,16 +175,19 @@ func (api SysdigApiClient) GetData(metrics []map[string]interface{}, start, end,
 //
 // - body:
 // 		Information that will be sent to the endpoint.
-func (api SysdigApiClient) Request(httpMethod, apiMethod string, body io.Reader) (response *http.Response, err error) {
+func (api SysdigApiClient) Request(ctx context.Context, httpMethod, apiMethod string, body io.Reader) (response *http.Response, err error) {
 
 	// Create the request
-	client := http.Client{Timeout: 5 * time.Second}
-	request, err := http.NewRequest(httpMethod, apiUrl+apiMethod, body)
+	client := api.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	request, err := http.NewRequestWithContext(ctx, httpMethod, api.endpoint()+apiMethod, body)
 	if err != nil {
 		return
 	}
 	// Header needed to connect with Sysdig Cloud
-	request.Header.Add("Authorization", "Bearer "+api.token)
+	request.Header.Add("Authorization", "Bearer "+api.bearerToken())
 	// Get the info in json
 	request.Header.Add("Content-Type", "application/json")
 
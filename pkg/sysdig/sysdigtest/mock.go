@@ -0,0 +1,162 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Mock of the Sysdig data api for the tests, the demo mode and the benchmarks, kept out of the client
+package sysdigtest
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Mock serves the api/data endpoint of Sysdig Monitor with the Values of every host, indexed by
+// host name and then metric id, "*" being the host of the values of the hosts that are not listed.
+// The values of "host/namespace" answer the requests filtered by that namespace.
+// Every answer is delayed by Latency, and a share ErrorRate of the requests, or all the requests
+// for the hosts of Errors, are answered with an error status instead, drawn with Random
+// (rand.Float64 if nil) so that a seeded source gives the same answers. The hosts without values
+// are given the values of Generate if it is set. The metrics without aggregations are grouping
+// keys, they are answered with the host name as the only segment. A filter on several hosts,
+// host.hostName in ('a', 'b'), is answered with a datapoint for every host.
+type Mock struct {
+	Values    map[string]map[string]float64
+	Latency   time.Duration
+	ErrorRate float64
+	Errors    map[string]int
+	Generate  func(host, metric string) float64
+	Random    func() float64
+
+	// Values can be changed while serving, with Set
+	mutex sync.RWMutex
+}
+
+var (
+	hostFilter      = regexp.MustCompile(`host\.hostName\s*=\s*'([^']*)'`)
+	hostsFilter     = regexp.MustCompile(`host\.hostName\s+in\s*\(([^)]*)\)`)
+	quotedName      = regexp.MustCompile(`'([^']*)'`)
+	namespaceFilter = regexp.MustCompile(`kubernetes\.namespace\.name\s*=\s*'([^']*)'`)
+)
+
+// Sets the value of a metric of a host
+func (m *Mock) Set(host, metric string, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.Values == nil {
+		m.Values = map[string]map[string]float64{}
+	}
+	if m.Values[host] == nil {
+		m.Values[host] = map[string]float64{}
+	}
+	m.Values[host][metric] = value
+}
+
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/data" || r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	var request struct {
+		Metrics []struct {
+			ID           string            `json:"id"`
+			Aggregations map[string]string `json:"aggregations"`
+		} `json:"metrics"`
+		Filter string `json:"filter"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case <-time.After(m.Latency):
+	case <-r.Context().Done():
+		return
+	}
+
+	hosts := []string{""}
+	if match := hostFilter.FindStringSubmatch(request.Filter); match != nil {
+		hosts = []string{match[1]}
+	} else if match := hostsFilter.FindStringSubmatch(request.Filter); match != nil {
+		hosts = nil
+		for _, quoted := range quotedName.FindAllStringSubmatch(match[1], -1) {
+			hosts = append(hosts, quoted[1])
+		}
+	}
+	for _, host := range hosts {
+		if status, ok := m.Errors[host]; ok {
+			http.Error(w, "injected error", status)
+			return
+		}
+	}
+	draw := rand.Float64
+	if m.Random != nil {
+		draw = m.Random
+	}
+	if m.ErrorRate > 0 && draw() < m.ErrorRate {
+		http.Error(w, "injected error", http.StatusServiceUnavailable)
+		return
+	}
+
+	type datapoint struct {
+		T int64         `json:"t"`
+		D []interface{} `json:"d"`
+	}
+	response := struct {
+		Data []datapoint `json:"data"`
+	}{Data: []datapoint{}}
+
+	m.mutex.RLock()
+	for _, host := range hosts {
+		values, listed := m.Values[host]
+		if match := namespaceFilter.FindStringSubmatch(request.Filter); match != nil {
+			if namespaceValues, ok := m.Values[host+"/"+match[1]]; ok {
+				values, listed = namespaceValues, true
+			}
+		}
+		if !listed {
+			values, listed = m.Values["*"]
+		}
+		complete := listed || m.Generate != nil
+		point := datapoint{T: time.Now().Unix()}
+		for _, metric := range request.Metrics {
+			if metric.Aggregations == nil {
+				point.D = append(point.D, host)
+				continue
+			}
+			value, found := values[metric.ID]
+			if !found && m.Generate != nil {
+				value, found = m.Generate(host, metric.ID), true
+			}
+			if !found {
+				complete = false
+				break
+			}
+			point.D = append(point.D, value)
+		}
+
+		// Hosts without values have no datapoints, like the hosts without an agent
+		if complete {
+			response.Data = append(response.Data, point)
+		}
+	}
+	m.mutex.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Minimal OpenTelemetry tracing, exported with OTLP over HTTP in its JSON encoding
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP status codes
+const (
+	statusOk    = 1
+	statusError = 2
+)
+
+// Span is an operation of a trace. A nil span, returned when tracing is disabled, does nothing.
+type Span struct {
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	start      time.Time
+	attributes map[string]interface{}
+	err        error
+	exporter   *Exporter
+}
+
+type spanKey struct{}
+
+var exporter *Exporter
+
+// Starts a span, child of the span of the context if there is one
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if exporter == nil {
+		return ctx, nil
+	}
+	span := &Span{spanID: randomID(8), name: name, start: time.Now(), attributes: map[string]interface{}{}, exporter: exporter}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		span.traceID, span.parentID = parent.traceID, parent.spanID
+	} else {
+		span.traceID = randomID(16)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Sets an attribute of the span, strings, bools, integers and floats are supported
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attributes[key] = value
+}
+
+// Marks the span as failed if err is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.err = err
+}
+
+// Ends the span and queues it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.exporter.add(s.encode(time.Now()))
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Encodes the span as an OTLP json span
+func (s *Span) encode(end time.Time) map[string]interface{} {
+	var attributes []map[string]interface{}
+	for key, value := range s.attributes {
+		attributes = append(attributes, map[string]interface{}{"key": key, "value": encodeValue(value)})
+	}
+	status := map[string]interface{}{"code": statusOk}
+	if s.err != nil {
+		status = map[string]interface{}{"code": statusError, "message": s.err.Error()}
+	}
+
+	span := map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.name,
+		"kind":              1, // Internal
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(end.UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            status,
+	}
+	if s.parentID != "" {
+		span["parentSpanId"] = s.parentID
+	}
+	return span
+}
+
+func encodeValue(value interface{}) map[string]interface{} {
+	switch value := value.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": value}
+	case bool:
+		return map[string]interface{}{"boolValue": value}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(value)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": value}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(value)}
+	}
+}
+
+// Exporter sends the ended spans in batches to an OTLP/HTTP collector
+type Exporter struct {
+	Endpoint    string            // Base url of the collector, the spans are posted to Endpoint/v1/traces
+	ServiceName string            // service.name resource attribute
+	Headers     map[string]string // Sent with every request, for authentication
+	Interval    time.Duration     // How often the batch is exported
+
+	mutex sync.Mutex
+	spans []map[string]interface{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Starts exporting the spans created by Start with the exporter
+func Init(e *Exporter) {
+	if e.Interval <= 0 {
+		e.Interval = 5 * time.Second
+	}
+	e.stop, e.done = make(chan struct{}), make(chan struct{})
+	exporter = e
+	go e.run()
+}
+
+// Exports the spans still queued and stops the exporter
+func Shutdown(ctx context.Context) {
+	if exporter == nil {
+		return
+	}
+	close(exporter.stop)
+	select {
+	case <-exporter.done:
+	case <-ctx.Done():
+	}
+}
+
+func (e *Exporter) add(span map[string]interface{}) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	// Bounded so a collector outage doesn't grow the memory without limit
+	if len(e.spans) < 10000 {
+		e.spans = append(e.spans, span)
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.flush()
+		case <-e.stop:
+			e.flush()
+			return
+		}
+	}
+}
+
+// Posts the queued spans to the collector
+func (e *Exporter) flush() {
+	e.mutex.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mutex.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []interface{}{map[string]interface{}{"key": "service.name", "value": encodeValue(e.ServiceName)}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "github.com/draios/kubernetes-scheduler"},
+				"spans": spans,
+			}},
+		}},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		log.Println("tracing: error while encoding the spans:", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	httpRequest, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(e.Endpoint, "/")+"/v1/traces", bytes.NewReader(data))
+	if err != nil {
+		log.Println("tracing:", err)
+		return
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	for name, value := range e.Headers {
+		httpRequest.Header.Set(name, value)
+	}
+
+	response, err := http.DefaultClient.Do(httpRequest)
+	if err != nil {
+		log.Printf("tracing: error while exporting %d spans: %s", len(spans), err)
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode != 200 {
+		log.Printf("tracing: error code %d while exporting %d spans", response.StatusCode, len(spans))
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2018 Sysdig.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Tuned http transports: pooled connections kept alive between requests, cached DNS answers and
+// a deadline over every request, with the connections they open and reuse counted
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options of a transport, the zero values keep the settings of the transport
+type Options struct {
+	MaxIdleConns          int           // Idle connections kept over all the hosts
+	MaxIdleConnsPerHost   int           // Idle connections kept for every host, 2 in net/http
+	MaxConnsPerHost       int           // Connections to a host, the requests past it wait for one
+	IdleConnTimeout       time.Duration // Idle connections are closed after it
+	KeepAlive             time.Duration // Period of the TCP keep-alive probes
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+
+	// Timeout is the deadline of every request, reading the answer included, unless Exempt
+	// returns true for it, like for the long running watches
+	Timeout time.Duration
+	Exempt  func(*http.Request) bool
+
+	// DNSCacheTTL keeps the addresses of the hosts that long instead of resolving them on every
+	// new connection. The answer is resolved again when no address can be dialed.
+	DNSCacheTTL time.Duration
+}
+
+// Stats counts the connections and the requests of a transport, updated atomically
+type Stats struct {
+	Dials       int64 // Connections opened
+	DialErrors  int64
+	Open        int64 // Connections currently open
+	Reused      int64 // Requests sent on a kept alive connection
+	NotReused   int64 // Requests that needed a new connection
+	InFlight    int64 // Requests whose answer is not closed yet
+	Timeouts    int64 // Requests past the Timeout
+	DNSLookups  int64
+	DNSCacheHit int64
+}
+
+// Snapshot returns a copy of the counters
+func (s *Stats) Snapshot() Stats {
+	return Stats{
+		Dials:       atomic.LoadInt64(&s.Dials),
+		DialErrors:  atomic.LoadInt64(&s.DialErrors),
+		Open:        atomic.LoadInt64(&s.Open),
+		Reused:      atomic.LoadInt64(&s.Reused),
+		NotReused:   atomic.LoadInt64(&s.NotReused),
+		InFlight:    atomic.LoadInt64(&s.InFlight),
+		Timeouts:    atomic.LoadInt64(&s.Timeouts),
+		DNSLookups:  atomic.LoadInt64(&s.DNSLookups),
+		DNSCacheHit: atomic.LoadInt64(&s.DNSCacheHit),
+	}
+}
+
+// Apply sets the options on the transport, whose proxy and TLS settings are kept, and returns it
+// wrapped with the Timeout. The connections and requests are counted in stats.
+func Apply(t *http.Transport, options Options, stats *Stats) http.RoundTripper {
+	if options.MaxIdleConns > 0 {
+		t.MaxIdleConns = options.MaxIdleConns
+	}
+	if options.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = options.MaxIdleConnsPerHost
+	}
+	if options.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = options.MaxConnsPerHost
+	}
+	if options.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = options.IdleConnTimeout
+	}
+	if options.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = options.TLSHandshakeTimeout
+	}
+	if options.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = options.ResponseHeaderTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: options.DialTimeout, KeepAlive: options.KeepAlive}
+	if dialer.Timeout <= 0 {
+		dialer.Timeout = 30 * time.Second
+	}
+	d := &countingDialer{dialer: dialer, stats: stats}
+	if options.DNSCacheTTL > 0 {
+		d.cache = &dnsCache{ttl: options.DNSCacheTTL, hosts: map[string]dnsEntry{}, stats: stats}
+	}
+	t.DialContext = d.DialContext
+	return &roundTripper{next: t, options: options, stats: stats}
+}
+
+// Dials the connections, with the cached addresses of the host, and counts them
+type countingDialer struct {
+	dialer *net.Dialer
+	cache  *dnsCache
+	stats  *Stats
+}
+
+func (d *countingDialer) DialContext(ctx context.Context, network, address string) (conn net.Conn, err error) {
+	if d.cache == nil {
+		conn, err = d.dialer.DialContext(ctx, network, address)
+	} else {
+		conn, err = d.dialCached(ctx, network, address)
+	}
+	if err != nil {
+		atomic.AddInt64(&d.stats.DialErrors, 1)
+		return
+	}
+	atomic.AddInt64(&d.stats.Dials, 1)
+	atomic.AddInt64(&d.stats.Open, 1)
+	return &countedConn{Conn: conn, stats: d.stats}, nil
+}
+
+// Dials the addresses of the host in order, resolving it again if none answers
+func (d *countingDialer) dialCached(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+	addresses, err := d.cache.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range addresses {
+		conn, dialErr := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if dialErr == nil {
+			return conn, nil
+		}
+		err = dialErr
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	d.cache.forget(host)
+	return nil, err
+}
+
+// Decrements the open connections once closed
+type countedConn struct {
+	net.Conn
+	stats *Stats
+	once  sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&c.stats.Open, -1) })
+	return c.Conn.Close()
+}
+
+// Addresses of the hosts, resolved at most once every ttl
+type dnsCache struct {
+	ttl   time.Duration
+	mutex sync.Mutex
+	hosts map[string]dnsEntry
+	stats *Stats
+}
+
+type dnsEntry struct {
+	addresses []string
+	expires   time.Time
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mutex.Lock()
+	entry, ok := c.hosts[host]
+	c.mutex.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		atomic.AddInt64(&c.stats.DNSCacheHit, 1)
+		return entry.addresses, nil
+	}
+
+	atomic.AddInt64(&c.stats.DNSLookups, 1)
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("no address found for " + host)
+	}
+	c.mutex.Lock()
+	c.hosts[host] = dnsEntry{addresses: addresses, expires: time.Now().Add(c.ttl)}
+	c.mutex.Unlock()
+	return addresses, nil
+}
+
+func (c *dnsCache) forget(host string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.hosts, host)
+}
+
+// Applies the deadline to the requests and counts them until their answer is closed
+type roundTripper struct {
+	next    http.RoundTripper
+	options Options
+	stats   *Stats
+}
+
+func (t *roundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx := httptrace.WithClientTrace(request.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&t.stats.Reused, 1)
+			} else {
+				atomic.AddInt64(&t.stats.NotReused, 1)
+			}
+		},
+	})
+	cancel := context.CancelFunc(func() {})
+	if t.options.Timeout > 0 && (t.options.Exempt == nil || !t.options.Exempt(request)) {
+		ctx, cancel = context.WithTimeout(ctx, t.options.Timeout)
+	}
+
+	atomic.AddInt64(&t.stats.InFlight, 1)
+	response, err := t.next.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded && request.Context().Err() == nil {
+			atomic.AddInt64(&t.stats.Timeouts, 1)
+		}
+		atomic.AddInt64(&t.stats.InFlight, -1)
+		cancel()
+		return nil, err
+	}
+	response.Body = &closingBody{ReadCloser: response.Body, done: func() {
+		atomic.AddInt64(&t.stats.InFlight, -1)
+		cancel()
+	}}
+	return response, nil
+}
+
+// Ends the request once its answer is closed
+type closingBody struct {
+	io.ReadCloser
+	done func()
+	once sync.Once
+}
+
+func (b *closingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}